@@ -20,12 +20,14 @@ var (
 type BytesCache interface {
 	Get(k string) ([]byte, error)
 	Set(k string, v []byte, expire int32)
+	Delete(k string)
 }
 
 type NullCache struct{}
 
 func (NullCache) Get(string) ([]byte, error) { return nil, ErrNotFound }
 func (NullCache) Set(string, []byte, int32)  {}
+func (NullCache) Delete(string)              {}
 
 func NewExpireCache(maxsize uint64) BytesCache {
 	ec := expirecache.New(maxsize)
@@ -51,6 +53,11 @@ func (ec ExpireCache) Set(k string, v []byte, expire int32) {
 	ec.ec.Set(k, v, uint64(len(v)), expire)
 }
 
+// Delete makes item expired, it will be removed by cleaner
+func (ec ExpireCache) Delete(k string) {
+	ec.ec.Set(k, nil, 0, -1)
+}
+
 func (ec ExpireCache) Items() int { return ec.ec.Items() }
 
 func (ec ExpireCache) Size() uint64 { return ec.ec.Size() }
@@ -104,6 +111,12 @@ func (m *MemcachedCache) Set(k string, v []byte, expire int32) {
 	go m.client.Set(&memcache.Item{Key: m.prefix + hk, Value: v, Expiration: expire})
 }
 
+func (m *MemcachedCache) Delete(k string) {
+	key := sha1.Sum([]byte(k))
+	hk := hex.EncodeToString(key[:])
+	go m.client.Delete(m.prefix + hk)
+}
+
 func (m *MemcachedCache) Timeouts() uint64 {
 	return atomic.LoadUint64(&m.timeouts)
 }
@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	diskCacheMagic      = "CAPI"
+	diskCacheVersion    = 1
+	diskCacheHeaderSize = len(diskCacheMagic) + 1 + 8 + 4
+	diskCacheTmpSuffix  = ".tmp"
+)
+
+type diskItem struct {
+	name   string
+	size   uint64
+	expire int64
+	elem   *list.Element
+}
+
+// DiskCache stores values in files in a directory, so cached responses survive restarts of carbonapi. Each file
+// contains expiration time and checksum of the value, corrupted files are removed instead of being served.
+type DiskCache struct {
+	dir     string
+	maxSize uint64
+
+	sync.Mutex
+	size  uint64
+	items map[string]*diskItem
+	// lru holds items from the most to the least recently used one
+	lru *list.List
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDiskCache creates cache in dir, maxsize is in bytes, 0 means unlimited. Valid items that are already in dir are
+// loaded, expired, partially written or corrupted ones are removed.
+func NewDiskCache(dir string, maxsize uint64) (*DiskCache, error) {
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &DiskCache{
+		dir:     dir,
+		maxSize: maxsize,
+		items:   make(map[string]*diskItem),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+	}
+
+	err = c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	go c.ApproximateCleaner(10 * time.Second)
+
+	return c, nil
+}
+
+func (c *DiskCache) fileName(k string) string {
+	key := sha1.Sum([]byte(k))
+	return hex.EncodeToString(key[:])
+}
+
+func (c *DiskCache) load() error {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	// the oldest files are the least recently used ones
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	now := time.Now().Unix()
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name := f.Name()
+		path := filepath.Join(c.dir, name)
+		if strings.HasSuffix(name, diskCacheTmpSuffix) {
+			// leftover from interrupted Set
+			os.Remove(path)
+			continue
+		}
+		if _, err := hex.DecodeString(name); err != nil || len(name) != 2*sha1.Size {
+			// not ours, leave it alone
+			continue
+		}
+
+		expire, ok := readDiskCacheHeader(path)
+		if !ok || (expire != 0 && expire < now) {
+			os.Remove(path)
+			continue
+		}
+
+		c.add(&diskItem{
+			name:   name,
+			size:   uint64(f.Size()),
+			expire: expire,
+		})
+	}
+
+	c.Lock()
+	c.evict()
+	c.Unlock()
+
+	return nil
+}
+
+func readDiskCacheHeader(path string) (int64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	header := make([]byte, diskCacheHeaderSize)
+	n, err := f.Read(header)
+	if err != nil || n != diskCacheHeaderSize {
+		return 0, false
+	}
+
+	return parseDiskCacheHeader(header)
+}
+
+func parseDiskCacheHeader(header []byte) (int64, bool) {
+	if len(header) < diskCacheHeaderSize || string(header[:len(diskCacheMagic)]) != diskCacheMagic || header[len(diskCacheMagic)] != diskCacheVersion {
+		return 0, false
+	}
+
+	return int64(binary.BigEndian.Uint64(header[len(diskCacheMagic)+1:])), true
+}
+
+func (c *DiskCache) Get(k string) ([]byte, error) {
+	name := c.fileName(k)
+	now := time.Now().Unix()
+
+	c.Lock()
+	item, ok := c.items[name]
+	if !ok {
+		c.Unlock()
+		return nil, ErrNotFound
+	}
+	if item.expire != 0 && item.expire < now {
+		c.remove(name)
+		c.Unlock()
+		return nil, ErrNotFound
+	}
+	c.lru.MoveToFront(item.elem)
+	c.Unlock()
+
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if err == nil {
+		if _, ok := parseDiskCacheHeader(data); ok {
+			value := data[diskCacheHeaderSize:]
+			checksum := binary.BigEndian.Uint32(data[diskCacheHeaderSize-4:])
+			if crc32.ChecksumIEEE(value) == checksum {
+				return value, nil
+			}
+		}
+	}
+
+	// file is corrupted or was removed by someone else. It's removed only if it wasn't replaced by concurrent Set
+	// after the read, files are replaced under the lock
+	c.Lock()
+	if c.items[name] == item {
+		c.remove(name)
+	}
+	c.Unlock()
+	return nil, ErrNotFound
+}
+
+func (c *DiskCache) Set(k string, v []byte, expire int32) {
+	name := c.fileName(k)
+
+	var expireAt int64
+	if expire > 0 {
+		expireAt = time.Now().Unix() + int64(expire)
+	}
+
+	data := make([]byte, diskCacheHeaderSize, diskCacheHeaderSize+len(v))
+	copy(data, diskCacheMagic)
+	data[len(diskCacheMagic)] = diskCacheVersion
+	binary.BigEndian.PutUint64(data[len(diskCacheMagic)+1:], uint64(expireAt))
+	binary.BigEndian.PutUint32(data[diskCacheHeaderSize-4:], crc32.ChecksumIEEE(v))
+	data = append(data, v...)
+
+	// write to temporary file first, so readers will never see partially written one
+	path := filepath.Join(c.dir, name)
+	f, err := ioutil.TempFile(c.dir, name+".*"+diskCacheTmpSuffix)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+
+	c.Lock()
+	if err := os.Rename(f.Name(), path); err != nil {
+		c.Unlock()
+		os.Remove(f.Name())
+		return
+	}
+	if item, ok := c.items[name]; ok {
+		c.size -= item.size
+		c.lru.Remove(item.elem)
+	}
+	c.add(&diskItem{
+		name:   name,
+		size:   uint64(len(data)),
+		expire: expireAt,
+	})
+	c.evict()
+	c.Unlock()
+}
+
+func (c *DiskCache) Delete(k string) {
+	c.Lock()
+	c.remove(c.fileName(k))
+	c.Unlock()
+}
+
+// add registers item as the most recently used one, must be called with lock held
+func (c *DiskCache) add(item *diskItem) {
+	item.elem = c.lru.PushFront(item)
+	c.items[item.name] = item
+	c.size += item.size
+}
+
+// remove deletes item, must be called with lock held
+func (c *DiskCache) remove(name string) {
+	if item, ok := c.items[name]; ok {
+		c.size -= item.size
+		c.lru.Remove(item.elem)
+		delete(c.items, name)
+	}
+	os.Remove(filepath.Join(c.dir, name))
+}
+
+// evict removes least recently used items until cache fits into maxSize, must be called with lock held
+func (c *DiskCache) evict() {
+	if c.maxSize == 0 {
+		return
+	}
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back().Value.(*diskItem).name)
+	}
+}
+
+// ApproximateCleaner removes expired items every interval until the cache is closed
+func (c *DiskCache) ApproximateCleaner(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now().Unix()
+		c.Lock()
+		for name, item := range c.items {
+			if item.expire != 0 && item.expire < now {
+				c.remove(name)
+			}
+		}
+		c.Unlock()
+	}
+}
+
+// Close stops the cleaner. Files are kept, so they are loaded by the next cache in the same directory
+func (c *DiskCache) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+func (c *DiskCache) Items() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.items)
+}
+
+func (c *DiskCache) Size() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.size
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carbonapi-disk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Set("key1", []byte("value1"), 60)
+	c.Set("key2", []byte("value2"), 0)
+
+	v, err := c.Get("key1")
+	if err != nil || string(v) != "value1" {
+		t.Fatalf("unexpected result for key1: %q, %v", v, err)
+	}
+
+	// reopen cache, values should survive
+	c.Close()
+	c, err = NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Items() != 2 {
+		t.Fatalf("expected 2 items after reload, got %v", c.Items())
+	}
+	v, err = c.Get("key2")
+	if err != nil || string(v) != "value2" {
+		t.Fatalf("unexpected result for key2 after reload: %q, %v", v, err)
+	}
+
+	// corrupt one of the files
+	path := filepath.Join(dir, c.fileName("key1"))
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	err = ioutil.WriteFile(path, data, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Get("key1")
+	if err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for corrupted item, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("corrupted file wasn't removed")
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carbonapi-disk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	value := make([]byte, 100)
+	c, err := NewDiskCache(dir, uint64(2*(len(value)+diskCacheHeaderSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Set("key1", value, 0)
+	c.Set("key2", value, 0)
+	// key1 becomes the most recently used one, so key2 is evicted
+	if _, err := c.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+	c.Set("key3", value, 0)
+
+	if c.Items() != 2 {
+		t.Errorf("expected 2 items after eviction, got %v", c.Items())
+	}
+	if c.Size() > c.maxSize {
+		t.Errorf("cache size %v exceeds max size %v", c.Size(), c.maxSize)
+	}
+	if _, err := c.Get("key3"); err != nil {
+		t.Errorf("last item shouldn't be evicted, got %v", err)
+	}
+	if _, err := c.Get("key1"); err != nil {
+		t.Errorf("recently used item shouldn't be evicted, got %v", err)
+	}
+	if _, err := c.Get("key2"); err != ErrNotFound {
+		t.Errorf("least recently used item should be evicted, got %v", err)
+	}
+	if c.lru.Len() != c.Items() {
+		t.Errorf("%v items in LRU list, %v items in cache", c.lru.Len(), c.Items())
+	}
+}
+
+func TestDiskCacheCleaner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carbonapi-disk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &DiskCache{
+		dir:   dir,
+		items: make(map[string]*diskItem),
+		lru:   list.New(),
+		stop:  make(chan struct{}),
+	}
+	c.Set("key1", []byte("value1"), 60)
+	c.Set("key2", []byte("value2"), 0)
+	c.Lock()
+	c.items[c.fileName("key1")].expire = time.Now().Unix() - 1
+	c.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.ApproximateCleaner(time.Millisecond)
+		close(done)
+	}()
+	for i := 0; c.Items() != 1; i++ {
+		if i == 1000 {
+			t.Fatalf("expired item wasn't removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Close()
+	c.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleaner wasn't stopped by Close")
+	}
+}
+
+func TestCacheDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carbonapi-disk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	diskCache, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer diskCache.Close()
+
+	for name, c := range map[string]BytesCache{"disk": diskCache, "mem": NewExpireCache(0)} {
+		c.Set("key1", []byte("value1"), 60)
+		c.Set("key2", []byte("value2"), 60)
+		c.Delete("key1")
+
+		if _, err := c.Get("key1"); err != ErrNotFound {
+			t.Errorf("%v: expected ErrNotFound for deleted item, got %v", name, err)
+		}
+		if v, err := c.Get("key2"); err != nil || string(v) != "value2" {
+			t.Errorf("%v: unexpected result for key2: %q, %v", name, v, err)
+		}
+	}
+	if diskCache.Items() != 1 {
+		t.Errorf("expected 1 item in disk cache, got %v", diskCache.Items())
+	}
+}
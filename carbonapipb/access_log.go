@@ -0,0 +1,87 @@
+package carbonapipb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AccessLogField is a field of AccessLogDetails that is written to access log
+type AccessLogField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// AccessLogFields returns fields of AccessLogDetails except excluded ones, fields are named by their json names.
+// Returns error if any of excluded fields doesn't exist
+func AccessLogFields(exclude []string) ([]AccessLogField, error) {
+	excluded := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		excluded[name] = true
+	}
+
+	t := reflect.TypeOf(AccessLogDetails{})
+	fields := make([]AccessLogField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		if excluded[tag[0]] {
+			delete(excluded, tag[0])
+			continue
+		}
+		fields = append(fields, AccessLogField{
+			name:      tag[0],
+			index:     i,
+			omitEmpty: len(tag) > 1 && tag[1] == "omitempty",
+		})
+	}
+	for name := range excluded {
+		return nil, fmt.Errorf("unknown access log field '%s'", name)
+	}
+	return fields, nil
+}
+
+// LogObject returns details as zap object that contains only given fields. Empty fields are omitted the same way
+// json does
+func (d *AccessLogDetails) LogObject(fields []AccessLogField) zapcore.ObjectMarshaler {
+	return zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		v := reflect.ValueOf(d).Elem()
+		for _, f := range fields {
+			fieldValue(f, v.Field(f.index)).AddTo(enc)
+		}
+		return nil
+	})
+}
+
+func fieldValue(f AccessLogField, v reflect.Value) zap.Field {
+	switch v.Kind() {
+	case reflect.String:
+		if f.omitEmpty && v.Len() == 0 {
+			return zap.Skip()
+		}
+		return zap.String(f.name, v.String())
+	case reflect.Bool:
+		if f.omitEmpty && !v.Bool() {
+			return zap.Skip()
+		}
+		return zap.Bool(f.name, v.Bool())
+	case reflect.Int32, reflect.Int64:
+		if f.omitEmpty && v.Int() == 0 {
+			return zap.Skip()
+		}
+		return zap.Int64(f.name, v.Int())
+	case reflect.Float64:
+		if f.omitEmpty && v.Float() == 0 {
+			return zap.Skip()
+		}
+		return zap.Float64(f.name, v.Float())
+	case reflect.Slice, reflect.Map:
+		if f.omitEmpty && v.Len() == 0 {
+			return zap.Skip()
+		}
+	}
+	return zap.Any(f.name, v.Interface())
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	carbonapiHttp "github.com/go-graphite/carbonapi/cmd/carbonapi/http"
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr"
+	"github.com/go-graphite/carbonapi/expr/functions"
+	"github.com/go-graphite/carbonapi/expr/tags"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/zipper/protocols/v3"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/lomik/zapwriter"
+	"gopkg.in/yaml.v2"
+)
+
+// Metric is a series of fixture. Fixtures are compatible with mockbackend ones, which series start at 1 with step 1
+type Metric struct {
+	MetricName string    `yaml:"metricName"`
+	Values     []float64 `yaml:"values"`
+	StartTime  int64     `yaml:"startTime"`
+	StepTime   int64     `yaml:"stepTime"`
+}
+
+type Response struct {
+	PathExpression string   `yaml:"pathExpression"`
+	Data           []Metric `yaml:"data"`
+}
+
+type Fixture struct {
+	Expressions map[string]Response `yaml:"expressions"`
+}
+
+// fetcher returns series of path expressions for the time range
+type fetcher func(req pb.MultiFetchRequest) ([]*types.MetricData, error)
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	var targets stringList
+	flag.Var(&targets, "target", "target to evaluate, could be specified several times. Targets are read from stdin, one per line, if not set")
+	from := flag.String("from", "", "start of time range in render request syntax, default: -24h or start of fixture data")
+	until := flag.String("until", "", "end of time range in render request syntax, default: now or end of fixture data")
+	tz := flag.String("tz", "", "time zone of from and until")
+	backend := flag.String("backend", "", "URL of backend that supports carbonapi_v3_pb protocol (go-carbon, graphite-clickhouse, carbonapi)")
+	fixture := flag.String("fixture", "", "YAML file with series of path expressions, in mockbackend format")
+	format := flag.String("format", "json", "output format, one of render formats: "+strings.Join(carbonapiHttp.Formats(), ", "))
+	maxDataPoints := flag.Int("maxDataPoints", 0, "consolidate values to that many points, if format supports it (e.x. json)")
+	params := flag.String("params", "", "other render parameters, e.x. of png and svg formats: 'width=800&height=600'")
+	timeout := flag.Duration("timeout", time.Minute, "timeout of requests to backend")
+	flag.Parse()
+
+	known := false
+	for _, f := range carbonapiHttp.Formats() {
+		known = known || f == *format
+	}
+	if !known {
+		log.Fatalf("unknown format %s", *format)
+	}
+	values, err := url.ParseQuery(*params)
+	if err != nil {
+		log.Fatalf("invalid params: %v", err)
+	}
+	if *maxDataPoints > 0 {
+		values.Set("maxDataPoints", strconv.Itoa(*maxDataPoints))
+	}
+	paramsRequest, err := http.NewRequest("GET", "/render/?"+values.Encode(), nil)
+	if err != nil {
+		log.Fatalf("invalid params: %v", err)
+	}
+
+	if len(targets) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if t := strings.TrimSpace(scanner.Text()); t != "" {
+				targets = append(targets, t)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("failed to read targets: %v", err)
+		}
+	}
+	if len(targets) == 0 {
+		log.Fatal("no targets")
+	}
+
+	defaultFrom, defaultUntil := time.Now().Add(-24*time.Hour).Unix(), time.Now().Unix()
+	var fetch fetcher
+	switch {
+	case *fixture != "" && *backend == "":
+		f, err := loadFixture(*fixture)
+		if err != nil {
+			log.Fatalf("failed to load fixture: %v", err)
+		}
+		defaultFrom, defaultUntil = f.timeRange()
+		fetch = f.fetch
+	case *backend != "" && *fixture == "":
+		fetch, err = backendFetcher(*backend, *timeout)
+		if err != nil {
+			log.Fatalf("failed to create backend: %v", err)
+		}
+	default:
+		log.Fatal("either backend or fixture should be set")
+	}
+
+	fromEpoch := date.DateParamToEpoch(*from, *tz, defaultFrom, time.Local)
+	untilEpoch := date.DateParamToEpoch(*until, *tz, defaultUntil, time.Local)
+
+	functions.New(make(map[string]string))
+	results, err := evalTargets(fetch, targets, fromEpoch, untilEpoch)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	b, err := carbonapiHttp.MarshalResults(paramsRequest, *format, results)
+	if err != nil {
+		log.Fatalf("failed to marshal results: %v", err)
+	}
+	if _, err := os.Stdout.Write(b); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// evalTargets fetches and evaluates targets like render request does
+func evalTargets(fetch fetcher, targets []string, from, until int64) ([]*types.MetricData, error) {
+	var results []*types.MetricData
+	metricMap := make(map[parser.MetricRequest][]*types.MetricData)
+
+	fetchBatch := func(batch []string, exps []parser.Expr) error {
+		var req pb.MultiFetchRequest
+		for _, exp := range exps {
+			for _, m := range exp.Metrics() {
+				m.From += from
+				m.Until += until
+				if _, ok := metricMap[m]; ok {
+					continue
+				}
+				metricMap[m] = nil
+				req.Metrics = append(req.Metrics, pb.FetchRequest{
+					Name:           m.Metric,
+					PathExpression: m.Metric,
+					StartTime:      m.From,
+					StopTime:       m.Until,
+				})
+			}
+		}
+		if len(req.Metrics) == 0 {
+			return nil
+		}
+
+		fetched, err := fetch(req)
+		if err != nil {
+			return err
+		}
+		// backends that don't report requested range of series get the first range of the path expression
+		expr.StoreFetched(metricMap, fetched, func(path string) (int64, int64) {
+			for _, m := range req.Metrics {
+				if m.PathExpression == path {
+					return m.StartTime, m.StopTime
+				}
+			}
+			return 0, 0
+		})
+		return nil
+	}
+
+	eval := func(target string, exp parser.Expr, rewritten bool) error {
+		if rewritten {
+			return nil
+		}
+		expressions, err := expr.EvalExpr(exp, from, until, metricMap)
+		if err != nil && err != parser.ErrSeriesDoesNotExist {
+			return err
+		}
+		results = append(results, expressions...)
+		return nil
+	}
+
+	if err := expr.EvalBatches(targets, from, until, metricMap, fetchBatch, eval); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func loadFixture(path string) (*Fixture, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fixture{}
+	if err := yaml.Unmarshal(b, f); err != nil {
+		return nil, err
+	}
+	for _, r := range f.Expressions {
+		for i := range r.Data {
+			if r.Data[i].StartTime == 0 {
+				r.Data[i].StartTime = 1
+			}
+			if r.Data[i].StepTime <= 0 {
+				r.Data[i].StepTime = 1
+			}
+		}
+	}
+	return f, nil
+}
+
+// timeRange returns range that covers all series of fixture
+func (f *Fixture) timeRange() (int64, int64) {
+	var from, until int64 = math.MaxInt64, math.MinInt64
+	for _, r := range f.Expressions {
+		for _, m := range r.Data {
+			if m.StartTime < from {
+				from = m.StartTime
+			}
+			if stop := m.StartTime + int64(len(m.Values))*m.StepTime; stop > until {
+				until = stop
+			}
+		}
+	}
+	if from > until {
+		return 0, 1
+	}
+	// points are in (from, until]
+	return from - 1, until - 1
+}
+
+// fetch returns series of path expressions as is, path expressions are matched exactly
+func (f *Fixture) fetch(req pb.MultiFetchRequest) ([]*types.MetricData, error) {
+	var res []*types.MetricData
+	for _, m := range req.Metrics {
+		for _, d := range f.Expressions[m.PathExpression].Data {
+			values := make([]float64, len(d.Values))
+			copy(values, d.Values)
+			s := types.MakeMetricData(d.MetricName, values, d.StepTime, d.StartTime)
+			s.PathExpression = m.PathExpression
+			s.RequestStartTime = m.StartTime
+			s.RequestStopTime = m.StopTime
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func backendFetcher(url string, timeout time.Duration) (fetcher, error) {
+	concurrency, maxTries, idle, keepAlive := 0, 1, 1, 30*time.Second
+	backend, e := v3.New(zapwriter.Logger("backend"), zipperTypes.BackendV2{
+		GroupName:           url,
+		Protocol:            "carbonapi_v3_pb",
+		Servers:             []string{url},
+		ConcurrencyLimit:    &concurrency,
+		MaxTries:            &maxTries,
+		MaxIdleConnsPerHost: &idle,
+		KeepAliveInterval:   &keepAlive,
+		Timeouts:            &zipperTypes.Timeouts{Find: timeout, Render: timeout, Connect: timeout},
+	})
+	if e != nil {
+		return nil, fmt.Errorf("%v", e.Errors)
+	}
+
+	return func(req pb.MultiFetchRequest) ([]*types.MetricData, error) {
+		resp, _, e := backend.Fetch(context.Background(), &req)
+		if e != nil && (resp == nil || len(resp.Metrics) == 0) {
+			if e.HaveFatalErrors || !isNotFound(e.Errors) {
+				return nil, fmt.Errorf("%v", e.Errors)
+			}
+			return nil, nil
+		}
+		var res []*types.MetricData
+		for _, m := range resp.Metrics {
+			res = append(res, &types.MetricData{FetchResponse: m, Tags: tags.ExtractTags(m.Name)})
+		}
+		return res, nil
+	}, nil
+}
+
+func isNotFound(errs []error) bool {
+	for _, err := range errs {
+		if err != zipperTypes.ErrNotFound && err != zipperTypes.ErrNoMetricsFetched {
+			return false
+		}
+	}
+	return true
+}
@@ -1,12 +1,20 @@
 package config
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/interfaces"
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/util/tlsconfig"
 	zipperCfg "github.com/go-graphite/carbonapi/zipper/config"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 
@@ -23,10 +31,18 @@ var DefaultLoggerConfig = zapwriter.Config{
 }
 
 type CacheConfig struct {
-	Type              string   `mapstructure:"type"`
-	Size              int      `mapstructure:"size_mb"`
-	MemcachedServers  []string `mapstructure:"memcachedServers"`
-	DefaultTimeoutSec int32    `mapstructure:"defaultTimeoutSec"`
+	Type              string           `mapstructure:"type"`
+	Size              int              `mapstructure:"size_mb"`
+	MemcachedServers  []string         `mapstructure:"memcachedServers"`
+	Path              string           `mapstructure:"path"`
+	DefaultTimeoutSec int32            `mapstructure:"defaultTimeoutSec"`
+	RecencyTimeouts   []RecencyTimeout `mapstructure:"recencyTimeouts"`
+}
+
+// RecencyTimeout overrides default cache timeout for queries which 'until' is older than UntilOlderThan
+type RecencyTimeout struct {
+	UntilOlderThan time.Duration `mapstructure:"untilOlderThan"`
+	TimeoutSec     int32         `mapstructure:"timeoutSec"`
 }
 
 type GraphiteConfig struct {
@@ -47,35 +63,534 @@ type ExpvarConfig struct {
 	PProfEnabled bool   `mapstructure:"pprofEnabled"`
 }
 
+type AdminConfig struct {
+	Listen  string `mapstructure:"listen"`
+	Enabled bool   `mapstructure:"enabled"`
+	// Token is required in 'Authorization: Bearer <token>' header of admin requests if set
+	Token string `mapstructure:"token"`
+	// PProfEnabled exposes net/http/pprof handlers under /admin/pprof/
+	PProfEnabled bool `mapstructure:"pprofEnabled"`
+}
+
+// TagIndexConfig configures in-memory index of tags and their values, that is used to answer autocomplete requests
+// without querying backends
+type TagIndexConfig struct {
+	// Enabled turns index on
+	Enabled bool `mapstructure:"enabled"`
+	// FullRefreshInterval is an interval between fetches of all tags and values from backends
+	FullRefreshInterval time.Duration `mapstructure:"fullRefreshInterval"`
+	// DeltaRefreshInterval is an interval between fetches of tag names, values are fetched only for new tags
+	DeltaRefreshInterval time.Duration `mapstructure:"deltaRefreshInterval"`
+	// Timeout limits duration of a single refresh
+	Timeout time.Duration `mapstructure:"timeout"`
+	// FindWalk fills index by walking the whole metric tree with find requests instead of using tag API of backends.
+	// Series are kept too, so seriesByTag could be evaluated by carbonapi itself for backends without tag support
+	FindWalk bool `mapstructure:"findWalk"`
+	// MaxSeries limits amount of series that could be found by find walk, refresh fails if there are more
+	MaxSeries int `mapstructure:"maxSeries"`
+}
+
+// MetricIndexConfig configures in-memory trie of metric names, that is used to answer find requests and to expand
+// globs of render requests without querying backends
+type MetricIndexConfig struct {
+	// Enabled turns index on
+	Enabled bool `mapstructure:"enabled"`
+	// FullRefreshInterval is an interval between rebuilds of the index from the full list of metrics of backends
+	FullRefreshInterval time.Duration `mapstructure:"fullRefreshInterval"`
+	// DeltaRefreshInterval is an interval between syncs that add new metrics to the index, removed metrics are dropped
+	// by full refreshes only
+	DeltaRefreshInterval time.Duration `mapstructure:"deltaRefreshInterval"`
+	// Timeout limits duration of a single refresh
+	Timeout time.Duration `mapstructure:"timeout"`
+	// MaxMetrics limits amount of metrics in the index, index is disabled while backends have more
+	MaxMetrics int `mapstructure:"maxMetrics"`
+	// ExpandGlobs makes render requests fetch metrics found by index instead of sending globs to backends
+	ExpandGlobs bool `mapstructure:"expandGlobs"`
+}
+
+// FunctionCacheConfig configures cache of results of expensive deterministic functions. Results are keyed by the
+// function call and hash of input series, so they are reused only if data is the same
+type FunctionCacheConfig struct {
+	// Size is a limit of size of cached results, in megabytes. 0 - disabled
+	Size int `mapstructure:"size_mb"`
+	// TTL is a time during which result is kept in the cache
+	TTL time.Duration `mapstructure:"ttl"`
+	// Functions are names of functions which results are cached
+	Functions []string `mapstructure:"functions"`
+}
+
+// FunctionComparisonConfig configures evaluation of functions by both current and alternate implementations, e.x. to
+// validate changes of semantics. Discrepancies of results are logged
+type FunctionComparisonConfig struct {
+	// Functions are names of functions which implementations are compared. Empty - disabled
+	Functions []string `mapstructure:"functions"`
+	// Tolerance is a max relative difference of equal values
+	Tolerance float64 `mapstructure:"tolerance"`
+}
+
+// IncrementalCacheConfig configures cache of series fetched by requests that end at now, so repeated requests fetch
+// only points after the cached ones
+type IncrementalCacheConfig struct {
+	// Size is a limit of size of cached series, in megabytes. 0 - disabled
+	Size int `mapstructure:"size_mb"`
+	// MutableWindow is a time before now, points of which could still change, they are never cached
+	MutableWindow time.Duration `mapstructure:"mutableWindow"`
+	// TTL is a time during which series are kept in the cache after the last request
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// ChunkedFetchConfig configures fetch of long time ranges by sequential requests of shorter chunks, so backends and
+// carbonapi don't hold all points of the range at once
+type ChunkedFetchConfig struct {
+	// MinRange is a time range of requests, that are fetched by chunks. 0 - disabled
+	MinRange time.Duration `mapstructure:"minRange"`
+	// ChunkSize is a time range of a single chunk
+	ChunkSize time.Duration `mapstructure:"chunkSize"`
+	// MaxPoints limits points of series fetched by chunks, they are consolidated as chunks arrive. 0 - unlimited
+	MaxPoints int `mapstructure:"maxPoints"`
+}
+
+// SavedQueriesConfig configures storage of named queries, that are rendered by name (/render?queryName=foo)
+type SavedQueriesConfig struct {
+	// Path is a JSON file queries are stored in. Empty - disabled
+	Path string `mapstructure:"path"`
+}
+
+// DashboardsConfig configures storage of graphite-web dashboards (/dashboard/load, /dashboard/save)
+type DashboardsConfig struct {
+	// Type of the store: "file" or "dir". Empty - disabled
+	Type string `mapstructure:"type"`
+	// Path is a JSON file dashboards are stored in for "file", directory with a file per dashboard for "dir"
+	Path string `mapstructure:"path"`
+}
+
+// ExportConfig configures export of render results to external storages by background jobs (/export)
+type ExportConfig struct {
+	// MaxConcurrent limits jobs that are rendered at once. 0 - export is disabled
+	MaxConcurrent int `mapstructure:"maxConcurrent"`
+	// MaxJobs limits jobs that are waiting or running, new jobs are rejected above the limit. 0 - unlimited
+	MaxJobs int `mapstructure:"maxJobs"`
+	// Timeout limits render and upload of a job, 10 minutes by default
+	Timeout time.Duration `mapstructure:"timeout"`
+	// KeepFinished is how long statuses of finished jobs are kept, 1 hour by default
+	KeepFinished time.Duration `mapstructure:"keepFinished"`
+	// LocalDir allows file:// destinations inside of the directory. Empty - file destinations are disabled
+	LocalDir string `mapstructure:"localDir"`
+	// AllowedDestinations are http(s) and s3 URL prefixes, results could be uploaded only to URLs under them. Empty -
+	// http(s) and s3 destinations are disabled
+	AllowedDestinations []string `mapstructure:"allowedDestinations"`
+	// S3 configures client of s3:// destinations
+	S3 ExportS3Config `mapstructure:"s3"`
+}
+
+// ExportS3Config configures uploads to S3 or compatible storages
+type ExportS3Config struct {
+	// Endpoint is URL of the storage, https://s3.<region>.amazonaws.com by default
+	Endpoint string `mapstructure:"endpoint"`
+	// Region is used to sign requests, us-east-1 by default
+	Region string `mapstructure:"region"`
+	// PathStyle puts bucket into path of URL instead of host name, e.x. for MinIO
+	PathStyle bool `mapstructure:"pathStyle"`
+	// AccessKeyID, SecretAccessKey and SessionToken are credentials. If they are not set, AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables are used
+	AccessKeyID     string `mapstructure:"accessKeyID"`
+	SecretAccessKey string `mapstructure:"secretAccessKey"`
+	SessionToken    string `mapstructure:"sessionToken"`
+}
+
+// ReportConfig is a render request that is rendered on a cron schedule and delivered by email and/or webhook as
+// attachments, one per format
+type ReportConfig struct {
+	// Name identifies report in logs, it's also a name of attachments
+	Name string `mapstructure:"name"`
+	// Schedule is a cron expression: "minute hour day-of-month month day-of-week" or @hourly, @daily, @weekly, @monthly
+	Schedule string `mapstructure:"schedule"`
+	// Targets, From and Until are the same as in render request
+	Targets []string `mapstructure:"targets"`
+	From    string   `mapstructure:"from"`
+	Until   string   `mapstructure:"until"`
+	// Formats are render formats of attachments, png by default
+	Formats []string `mapstructure:"formats"`
+	// Params are other render parameters, e.x. width or title
+	Params map[string]string `mapstructure:"params"`
+	// Tenant which backends and time zone are used, global ones if empty
+	Tenant string `mapstructure:"tenant"`
+	// Timeout limits render and delivery of the report, 5 minutes by default
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Email are recipients of the report, it's sent by SMTP server of reporting config
+	Email []string `mapstructure:"email"`
+	// Subject of emails, "carbonapi report <name>" by default
+	Subject string `mapstructure:"subject"`
+	// Webhook is URL attachments are POSTed to as multipart/form-data
+	Webhook string `mapstructure:"webhook"`
+
+	// Cron is parsed Schedule
+	Cron *CronSchedule `mapstructure:"-"`
+}
+
+// SMTPConfig is an SMTP server reports are sent by. STARTTLS is used if the server supports it
+type SMTPConfig struct {
+	// Address is host:port of the server
+	Address string `mapstructure:"address"`
+	// Username and Password are used for PLAIN authentication, authentication is disabled if Username is empty
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// From is a sender address of emails
+	From string `mapstructure:"from"`
+}
+
+type ReportingConfig struct {
+	SMTP    SMTPConfig     `mapstructure:"smtp"`
+	Reports []ReportConfig `mapstructure:"reports"`
+}
+
+// StepNormalizationConfig configures how functions that combine series point by point (e.x. divideSeries) bring
+// series with different steps together
+type StepNormalizationConfig struct {
+	// Strict makes such functions fail instead of normalizing series
+	Strict bool `mapstructure:"strict"`
+	// Aggregation is a consolidation function values are consolidated by to the common step. Empty - consolidation
+	// function of the series
+	Aggregation string `mapstructure:"aggregation"`
+}
+
+// StorageSchema describes retentions of metrics like a section of storage-schemas.conf of carbon, e.x. pattern
+// "^servers\." with retentions "60s:1d,5m:30d,1h:1y". Schemas are used to predict steps returned by backends
+type StorageSchema struct {
+	Name string `mapstructure:"name"`
+	// Pattern is a regular expression metric paths are matched against, the first matched schema is used
+	Pattern string `mapstructure:"pattern"`
+	// Retentions are comma separated archives from the finest to the coarsest, as step:retention. Step and retention
+	// are either intervals with units (e.x. 5m:30d) or seconds and amount of points (e.x. 300:8640)
+	Retentions string `mapstructure:"retentions"`
+
+	Re       *regexp.Regexp `mapstructure:"-" json:"-"`
+	Archives []Archive      `mapstructure:"-" json:"-"`
+}
+
+// Archive is a parsed retention of a storage schema, in seconds
+type Archive struct {
+	Step      int64
+	Retention int64
+}
+
+// ShadowTrafficConfig configures mirroring of render and find requests to a backend group, e.x. to load-test a new
+// storage cluster with production queries. Responses of mirrored requests are discarded
+type ShadowTrafficConfig struct {
+	// Group is a name of backend group requests are mirrored to. Empty - disabled
+	Group string `mapstructure:"group"`
+	// Percent of requests that are mirrored
+	Percent float64 `mapstructure:"percent"`
+	// MaxConcurrent limits mirrored requests in progress, requests above the limit are dropped. 0 - unlimited
+	MaxConcurrent int `mapstructure:"maxConcurrent"`
+	// Timeout limits duration of a mirrored request
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// MemoryLimitsConfig limits memory used by render requests. Usage is accounted approximately: 8 bytes per fetched
+// point plus estimated size of response
+type MemoryLimitsConfig struct {
+	// Request is a hard limit of single request, requests that exceed it fail with 413. 0 - unlimited
+	Request int64 `mapstructure:"request"`
+	// Global is a soft limit of all requests in progress, new requests are rejected with 503 while it's exceeded.
+	// 0 - unlimited
+	Global int64 `mapstructure:"global"`
+}
+
+// Actions that are taken when path expression matches more series than allowed
+const (
+	SeriesLimitTruncate = "truncate"
+	SeriesLimitReject   = "reject"
+)
+
+// SeriesLimitsConfig limits amount of series that a single path expression of a target could match, so globs and
+// seriesByTag like seriesByTag('name=~.*') can't expand to millions of series
+type SeriesLimitsConfig struct {
+	// MaxSeries is a limit for all path expressions. 0 - unlimited
+	MaxSeries int `mapstructure:"maxSeries"`
+	// Action is taken when limit is exceeded: truncate keeps the first series (in order of the response, i.e. sorted
+	// by name for globs) and adds a warning to the response, reject fails the whole request
+	Action string `mapstructure:"action"`
+	// Overrides set limits of path expressions that start with the prefix, the longest matching prefix wins
+	Overrides []SeriesLimitOverride `mapstructure:"overrides"`
+}
+
+type SeriesLimitOverride struct {
+	Prefix    string `mapstructure:"prefix"`
+	MaxSeries int    `mapstructure:"maxSeries"`
+}
+
+// Limit returns limit of series of path expression and prefix of the override it comes from, empty for global limit
+func (c SeriesLimitsConfig) Limit(pathExpression string) (int, string) {
+	limit, prefix := c.MaxSeries, ""
+	for _, o := range c.Overrides {
+		if strings.HasPrefix(pathExpression, o.Prefix) && len(o.Prefix) > len(prefix) {
+			limit, prefix = o.MaxSeries, o.Prefix
+		}
+	}
+	return limit, prefix
+}
+
+// ScheduledQueryConfig is a query that is evaluated periodically, results are posted to webhook and/or written to
+// carbon, so derived metrics could be recorded
+type ScheduledQueryConfig struct {
+	// Name identifies query in logs and webhook payload
+	Name string `mapstructure:"name"`
+	// Targets are evaluated like targets of render request
+	Targets []string `mapstructure:"targets"`
+	// From and Until are time range of evaluation, in render request syntax
+	From  string `mapstructure:"from"`
+	Until string `mapstructure:"until"`
+	// Interval is a time between evaluations
+	Interval time.Duration `mapstructure:"interval"`
+	// Timeout limits single evaluation including delivery of results, Interval by default
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Tenant which backends and settings are used, global ones if empty
+	Tenant string `mapstructure:"tenant"`
+	// Webhook is URL results are POSTed to as JSON
+	Webhook string `mapstructure:"webhook"`
+	// Carbon is an address of carbon relay, the latest value of each series is written there in plaintext protocol
+	Carbon string `mapstructure:"carbon"`
+	// Prefix is prepended to series names written to carbon
+	Prefix string `mapstructure:"prefix"`
+	// CarbonProtocol is "plaintext" (default) or "pickle"
+	CarbonProtocol string `mapstructure:"carbonProtocol"`
+	// Retries is how many times failed carbon write is retried within Timeout
+	Retries int `mapstructure:"retries"`
+	// Jitter is a maximal random delay of each evaluation, so queries with the same interval don't hit backends at once
+	Jitter time.Duration `mapstructure:"jitter"`
+}
+
+type SchedulerConfig struct {
+	Queries []ScheduledQueryConfig `mapstructure:"queries"`
+}
+
+type TopQueriesConfig struct {
+	// Size is the amount of most expensive queries to keep. 0 - disabled
+	Size int `mapstructure:"size"`
+	// Window is a time during which query is kept in the list after it was last seen
+	Window time.Duration `mapstructure:"window"`
+}
+
+type AccessLogConfig struct {
+	// ExcludeFields contains list of fields (json names) that won't be written to access log
+	ExcludeFields []string `mapstructure:"excludeFields"`
+
+	// fields are written to access log, set by SetExcludeFields
+	fields []carbonapipb.AccessLogField
+}
+
+var allAccessLogFields, _ = carbonapipb.AccessLogFields(nil)
+
+// SetExcludeFields sets ExcludeFields and builds list of fields that are written to access log
+func (c *AccessLogConfig) SetExcludeFields(exclude []string) error {
+	fields, err := carbonapipb.AccessLogFields(exclude)
+	if err != nil {
+		return err
+	}
+	c.ExcludeFields = exclude
+	c.fields = fields
+	return nil
+}
+
+// Fields returns fields that are written to access log, all of them if SetExcludeFields wasn't called
+func (c *AccessLogConfig) Fields() []carbonapipb.AccessLogField {
+	if c.fields == nil {
+		return allAccessLogFields
+	}
+	return c.fields
+}
+
+type SlowLogConfig struct {
+	// Threshold is a minimal duration of the request to be logged as slow. 0 - disabled
+	Threshold time.Duration `mapstructure:"threshold"`
+	// DatapointsThreshold is a minimal amount of returned datapoints to log the request. 0 - disabled
+	DatapointsThreshold int64 `mapstructure:"datapointsThreshold"`
+	// SampleRate is a fraction of slow requests that will be logged
+	SampleRate float64 `mapstructure:"sampleRate"`
+}
+
+type BackendSelectionConfig struct {
+	// Header is a name of the header that selects backend group for the request. Empty - disabled
+	Header string `mapstructure:"header"`
+	// AllowedGroups contains names of backend groups that could be selected
+	AllowedGroups []string `mapstructure:"allowedGroups"`
+}
+
+// IsAllowed checks if group could be selected by the client
+func (c *BackendSelectionConfig) IsAllowed(group string) bool {
+	for _, g := range c.AllowedGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+type TenantsConfig struct {
+	// Header is a name of the header that contains tenant name
+	Header string `mapstructure:"header"`
+	// APIKeyHeader is a name of the header that contains API key, tenant is found by its key
+	APIKeyHeader string `mapstructure:"apiKeyHeader"`
+	// URLPrefix enables tenant detection by first element of the path, e.x. /tenant1/render
+	URLPrefix bool `mapstructure:"urlPrefix"`
+	// Required rejects requests that doesn't belong to any tenant
+	Required bool `mapstructure:"required"`
+	// Tenants contains per-tenant overrides
+	Tenants map[string]*TenantConfig `mapstructure:"tenants"`
+}
+
+// Get returns tenant by name or nil if it's unknown. Tenant names are case-insensitive, as config keys are
+func (c *TenantsConfig) Get(name string) *TenantConfig {
+	return c.Tenants[strings.ToLower(name)]
+}
+
+// ByAPIKey returns tenant that owns API key or nil if key is unknown
+func (c *TenantsConfig) ByAPIKey(key string) *TenantConfig {
+	for _, t := range c.Tenants {
+		for _, k := range t.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// CheckAPIKey checks if key is one of API keys of the tenant. Tenants without API keys accept any request
+func (t *TenantConfig) CheckAPIKey(key string) bool {
+	if len(t.APIKeys) == 0 {
+		return true
+	}
+	for _, k := range t.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantConfig overrides global settings for requests of the tenant. Unset options are inherited
+type TenantConfig struct {
+	APIKeys        []string                `mapstructure:"apiKeys" json:"-"`
+	Backends       []string                `mapstructure:"backends"`
+	BackendsV2     *zipperTypes.BackendsV2 `mapstructure:"backendsv2"`
+	Concurency     int                     `mapstructure:"concurency"`
+	CacheNamespace string                  `mapstructure:"cacheNamespace"`
+	TimezoneString string                  `mapstructure:"tz"`
+
+	Name string `mapstructure:"-" json:"-"`
+
+	// Upstreams is a global upstreams config with tenant's backends
+	Upstreams *zipperCfg.Config `mapstructure:"-" json:"-"`
+
+	DefaultTimeZone *time.Location `mapstructure:"-" json:"-"`
+
+	// ZipperInstance is nil if tenant uses global backends
+	ZipperInstance interfaces.CarbonZipper `mapstructure:"-" json:"-"`
+
+	// Limiter is nil if tenant uses global limiter
+	Limiter limiter.SimpleLimiter `mapstructure:"-" json:"-"`
+}
+
+// GetZipper returns zipper that should be used for tenant's requests. t could be nil
+func (t *TenantConfig) GetZipper() interfaces.CarbonZipper {
+	if t == nil || t.ZipperInstance == nil {
+		return Config.ZipperInstance
+	}
+	return t.ZipperInstance
+}
+
+// GetLimiter returns limiter that should be used for tenant's requests. t could be nil
+func (t *TenantConfig) GetLimiter() limiter.SimpleLimiter {
+	if t == nil || t.Limiter == nil {
+		return Current().Limiter
+	}
+	return t.Limiter
+}
+
+// GetTimeZone returns default timezone of the tenant. t could be nil
+func (t *TenantConfig) GetTimeZone() *time.Location {
+	if t == nil || t.DefaultTimeZone == nil {
+		return Config.DefaultTimeZone
+	}
+	return t.DefaultTimeZone
+}
+
+// CacheKey returns query cache key in tenant's namespace. t could be nil
+func (t *TenantConfig) CacheKey(key string) string {
+	if t == nil {
+		return key
+	}
+	return t.CacheNamespace + "\x00" + key
+}
+
 type ConfigType struct {
-	ExtrapolateExperiment      bool               `mapstructure:"extrapolateExperiment"`
-	Logger                     []zapwriter.Config `mapstructure:"logger"`
-	Listen                     string             `mapstructure:"listen"`
-	Buckets                    int                `mapstructure:"buckets"`
-	Concurency                 int                `mapstructure:"concurency"`
-	Cache                      CacheConfig        `mapstructure:"cache"`
-	Cpus                       int                `mapstructure:"cpus"`
-	TimezoneString             string             `mapstructure:"tz"`
-	UnicodeRangeTables         []string           `mapstructure:"unicodeRangeTables"`
-	Graphite                   GraphiteConfig     `mapstructure:"graphite"`
-	IdleConnections            int                `mapstructure:"idleConnections"`
-	PidFile                    string             `mapstructure:"pidFile"`
-	SendGlobsAsIs              bool               `mapstructure:"sendGlobsAsIs"`
-	AlwaysSendGlobsAsIs        bool               `mapstructure:"alwaysSendGlobsAsIs"`
-	MaxBatchSize               int                `mapstructure:"maxBatchSize"`
-	Zipper                     string             `mapstructure:"zipper"`
-	Upstreams                  zipperCfg.Config   `mapstructure:"upstreams"`
-	ExpireDelaySec             int32              `mapstructure:"expireDelaySec"`
-	GraphiteWeb09Compatibility bool               `mapstructure:"graphite09compat"`
-	IgnoreClientTimeout        bool               `mapstructure:"ignoreClientTimeout"`
-	DefaultColors              map[string]string  `mapstructure:"defaultColors"`
-	GraphTemplates             string             `mapstructure:"graphTemplates"`
-	FunctionsConfigs           map[string]string  `mapstructure:"functionsConfig"`
-	HeadersToPass              []string           `mapstructure:"headersToPass"`
-	HeadersToLog               []string           `mapstructure:"headersToLog"`
-	Define                     []Define           `mapstructure:"define"`
-	Prefix                     string             `mapstructure:"prefix"`
-	Expvar                     ExpvarConfig       `mapstructure:"expvar"`
+	ExtrapolateExperiment      bool                          `mapstructure:"extrapolateExperiment"`
+	NormalizeMethod            string                        `mapstructure:"normalizeMethod"`
+	StepNormalization          StepNormalizationConfig       `mapstructure:"stepNormalization"`
+	ConsolidationFallback      bool                          `mapstructure:"consolidationFallback"`
+	RetainAggregatedValues     bool                          `mapstructure:"retainAggregatedValues"`
+	Float32Values              bool                          `mapstructure:"float32Values"`
+	SparseValues               bool                          `mapstructure:"sparseValues"`
+	JSONFloatPrecision         int                           `mapstructure:"jsonFloatPrecision"`
+	MaxResponseSize            int                           `mapstructure:"maxResponseSize"`
+	MemoryLimits               MemoryLimitsConfig            `mapstructure:"memoryLimits"`
+	SeriesLimits               SeriesLimitsConfig            `mapstructure:"seriesLimits"`
+	UnitSystems                map[string][]types.UnitPrefix `mapstructure:"unitSystems"`
+	Logger                     []zapwriter.Config            `mapstructure:"logger"`
+	Listen                     string                        `mapstructure:"listen"`
+	TLS                        *tlsconfig.ServerConfig       `mapstructure:"tls"`
+	DrainTimeout               time.Duration                 `mapstructure:"drainTimeout"`
+	ReusePort                  bool                          `mapstructure:"reusePort"`
+	Buckets                    int                           `mapstructure:"buckets"`
+	Concurency                 int                           `mapstructure:"concurency"`
+	Cache                      CacheConfig                   `mapstructure:"cache"`
+	Cpus                       int                           `mapstructure:"cpus"`
+	TimezoneString             string                        `mapstructure:"tz"`
+	UnicodeRangeTables         []string                      `mapstructure:"unicodeRangeTables"`
+	Graphite                   GraphiteConfig                `mapstructure:"graphite"`
+	IdleConnections            int                           `mapstructure:"idleConnections"`
+	PidFile                    string                        `mapstructure:"pidFile"`
+	SendGlobsAsIs              bool                          `mapstructure:"sendGlobsAsIs"`
+	AlwaysSendGlobsAsIs        bool                          `mapstructure:"alwaysSendGlobsAsIs"`
+	MaxBatchSize               int                           `mapstructure:"maxBatchSize"`
+	Zipper                     string                        `mapstructure:"zipper"`
+	Upstreams                  zipperCfg.Config              `mapstructure:"upstreams"`
+	ExpireDelaySec             int32                         `mapstructure:"expireDelaySec"`
+	GraphiteWeb09Compatibility bool                          `mapstructure:"graphite09compat"`
+	IgnoreClientTimeout        bool                          `mapstructure:"ignoreClientTimeout"`
+	DefaultColors              map[string]string             `mapstructure:"defaultColors"`
+	GraphTemplates             string                        `mapstructure:"graphTemplates"`
+	FunctionsConfigs           map[string]string             `mapstructure:"functionsConfig"`
+	HeadersToPass              []string                      `mapstructure:"headersToPass"`
+	HeadersToLog               []string                      `mapstructure:"headersToLog"`
+	Define                     []Define                      `mapstructure:"define"`
+	Macros                     []string                      `mapstructure:"macros"`
+	Prefix                     string                        `mapstructure:"prefix"`
+	Expvar                     ExpvarConfig                  `mapstructure:"expvar"`
+	AccessLog                  AccessLogConfig               `mapstructure:"accessLog"`
+	SlowLog                    SlowLogConfig                 `mapstructure:"slowLog"`
+	Admin                      AdminConfig                   `mapstructure:"admin"`
+	TopQueries                 TopQueriesConfig              `mapstructure:"topQueries"`
+	TagIndex                   TagIndexConfig                `mapstructure:"tagIndex"`
+	MetricIndex                MetricIndexConfig             `mapstructure:"metricIndex"`
+	FunctionCache              FunctionCacheConfig           `mapstructure:"functionCache"`
+	FunctionComparison         FunctionComparisonConfig      `mapstructure:"functionComparison"`
+	IncrementalCache           IncrementalCacheConfig        `mapstructure:"incrementalCache"`
+	ChunkedFetch               ChunkedFetchConfig            `mapstructure:"chunkedFetch"`
+	SavedQueries               SavedQueriesConfig            `mapstructure:"savedQueries"`
+	Dashboards                 DashboardsConfig              `mapstructure:"dashboards"`
+	Export                     ExportConfig                  `mapstructure:"export"`
+	Reporting                  ReportingConfig               `mapstructure:"reporting"`
+	StorageSchemas             []StorageSchema               `mapstructure:"storageSchemas"`
+	ShadowTraffic              ShadowTrafficConfig           `mapstructure:"shadowTraffic"`
+	Tenants                    TenantsConfig                 `mapstructure:"tenants"`
+	BackendSelection           BackendSelectionConfig        `mapstructure:"backendSelection"`
+	Scheduler                  SchedulerConfig               `mapstructure:"scheduler"`
+	DeprecatedFunctions        map[string]string             `mapstructure:"deprecatedFunctions"`
+
+	CustomAggregators map[string]consolidations.CustomAggregator `mapstructure:"customAggregators"`
 
 	QueryCache cache.BytesCache `mapstructure:"-" json:"-"`
 	FindCache  cache.BytesCache `mapstructure:"-" json:"-"`
@@ -87,6 +602,9 @@ type ConfigType struct {
 
 	// Limiter limits concurrent zipper requests
 	Limiter limiter.SimpleLimiter `mapstructure:"-" json:"-"`
+
+	// defines are compiled define and macros sections, set by ReadConfig
+	defines *parser.Defines
 }
 
 func (c ConfigType) String() string {
@@ -98,51 +616,60 @@ func (c ConfigType) String() string {
 	}
 }
 
-var Config = ConfigType{
-	ExtrapolateExperiment: false,
-	Listen:                "[::]:8081",
-	Buckets:               10,
-	Concurency:            1000,
-	SendGlobsAsIs:         false,
-	AlwaysSendGlobsAsIs:   false,
-	MaxBatchSize:          100,
-	Cache: CacheConfig{
-		Type:              "mem",
-		DefaultTimeoutSec: 60,
-	},
-	TimezoneString: "",
-	Graphite: GraphiteConfig{
-		Pattern:  "{prefix}.{fqdn}",
-		Host:     "",
-		Interval: 60 * time.Second,
-		Prefix:   "carbon.api",
-	},
-	Cpus:            0,
-	IdleConnections: 10,
-	PidFile:         "",
-
-	QueryCache: cache.NullCache{},
-	FindCache:  cache.NullCache{},
-
-	DefaultTimeZone: time.Local,
-	Logger:          []zapwriter.Config{DefaultLoggerConfig},
-
-	Upstreams: zipperCfg.Config{
-		Timeouts: zipperTypes.Timeouts{
-			Render:  10000 * time.Second,
-			Find:    2 * time.Second,
-			Connect: 200 * time.Millisecond,
+// defaultConfig returns configuration with default values
+func defaultConfig() ConfigType {
+	return ConfigType{
+		ExtrapolateExperiment:  false,
+		JSONFloatPrecision:     -1,
+		ConsolidationFallback:  true,
+		RetainAggregatedValues: true,
+		Listen:                 "[::]:8081",
+		DrainTimeout:           time.Minute,
+		Buckets:                10,
+		Concurency:             1000,
+		SendGlobsAsIs:          false,
+		AlwaysSendGlobsAsIs:    false,
+		MaxBatchSize:           100,
+		Cache: CacheConfig{
+			Type:              "mem",
+			DefaultTimeoutSec: 60,
+		},
+		TimezoneString: "",
+		Graphite: GraphiteConfig{
+			Pattern:  "{prefix}.{fqdn}",
+			Host:     "",
+			Interval: 60 * time.Second,
+			Prefix:   "carbon.api",
+		},
+		Cpus:            0,
+		IdleConnections: 10,
+		PidFile:         "",
+
+		QueryCache: cache.NullCache{},
+		FindCache:  cache.NullCache{},
+
+		DefaultTimeZone: time.Local,
+		Logger:          []zapwriter.Config{DefaultLoggerConfig},
+
+		Upstreams: zipperCfg.Config{
+			Timeouts: zipperTypes.Timeouts{
+				Render:  10000 * time.Second,
+				Find:    2 * time.Second,
+				Connect: 200 * time.Millisecond,
+			},
+			KeepAliveInterval: 30 * time.Second,
+
+			MaxIdleConnsPerHost: 100,
 		},
-		KeepAliveInterval: 30 * time.Second,
-
-		MaxIdleConnsPerHost: 100,
-	},
-	ExpireDelaySec:             10 * 60,
-	GraphiteWeb09Compatibility: false,
-	Prefix:                     "",
-	Expvar: ExpvarConfig{
-		Listen:       "",
-		Enabled:      true,
-		PProfEnabled: false,
-	},
+		ExpireDelaySec:             10 * 60,
+		GraphiteWeb09Compatibility: false,
+		Prefix:                     "",
+		Expvar: ExpvarConfig{
+			Listen:       "",
+			Enabled:      true,
+			PProfEnabled: false,
+		},
+	}
 }
+
+var Config = defaultConfig()
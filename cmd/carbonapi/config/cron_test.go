@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronSchedule(t *testing.T) {
+	// Wednesday
+	now := time.Date(2020, 1, 15, 10, 20, 30, 0, time.UTC)
+	tests := []struct {
+		schedule string
+		want     time.Time
+		err      bool
+	}{
+		{schedule: "* * * * *", want: time.Date(2020, 1, 15, 10, 21, 0, 0, time.UTC)},
+		{schedule: "*/15 * * * *", want: time.Date(2020, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{schedule: "5/15 * * * *", want: time.Date(2020, 1, 15, 10, 35, 0, 0, time.UTC)},
+		{schedule: "0 9 * * 1-5", want: time.Date(2020, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{schedule: "0 9 * * 7", want: time.Date(2020, 1, 19, 9, 0, 0, 0, time.UTC)},
+		{schedule: "30 8,20 * * *", want: time.Date(2020, 1, 15, 20, 30, 0, 0, time.UTC)},
+		{schedule: "0 0 1 */3 *", want: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)},
+		// day of month or day of week
+		{schedule: "0 0 20 * 5", want: time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{schedule: "0 0 29 2 *", want: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{schedule: "@weekly", want: time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{schedule: "@monthly", want: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{schedule: "", err: true},
+		{schedule: "* * * *", err: true},
+		{schedule: "60 * * * *", err: true},
+		{schedule: "*/0 * * * *", err: true},
+		{schedule: "5-1 * * * *", err: true},
+		{schedule: "0 0 * * mon", err: true},
+		{schedule: "0 0 30 2 *", err: true},
+	}
+	for _, tt := range tests {
+		c, err := ParseCronSchedule(tt.schedule)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.schedule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.schedule, err)
+		} else if got := c.Next(now); !got.Equal(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.schedule, got, tt.want)
+		}
+	}
+
+	// schedule is evaluated in location of the time
+	loc := time.FixedZone("UTC+3", 3*3600)
+	c, _ := ParseCronSchedule("@daily")
+	if got, want := c.Next(now.In(loc)), time.Date(2020, 1, 16, 0, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
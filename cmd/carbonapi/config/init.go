@@ -3,8 +3,11 @@ package config
 import (
 	"bytes"
 	"expvar"
+	"fmt"
 	"io/ioutil"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -12,10 +15,12 @@ import (
 
 	"github.com/facebookgo/pidfile"
 	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/functions"
 	"github.com/go-graphite/carbonapi/expr/functions/cairo/png"
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/rewrite"
+	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
@@ -26,6 +31,19 @@ import (
 
 var graphTemplates map[string]png.PictureParams
 
+// config file and environment prefix that were used at startup, needed to reload config
+var (
+	configFile string
+	envPrefix  string
+)
+
+// sortRecencyTimeouts puts most specific (oldest) rules first, as they should be checked first
+func sortRecencyTimeouts(rules []RecencyTimeout) {
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].UntilOlderThan > rules[j].UntilOlderThan
+	})
+}
+
 func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 	Config.Cache.MemcachedServers = viper.GetStringSlice("cache.memcachedServers")
 	if n := viper.GetString("logger.logger"); n != "" {
@@ -134,6 +152,16 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 		Config.FunctionsConfigs = make(map[string]string)
 	}
 
+	// custom aggregators should be known before functions are initialized, so they are listed in descriptions
+	for name, agg := range Config.CustomAggregators {
+		err := consolidations.RegisterCustomAggregator(name, agg)
+		if err != nil {
+			logger.Fatal("invalid custom aggregator",
+				zap.Error(err),
+			)
+		}
+	}
+
 	rewrite.New(Config.FunctionsConfigs)
 	functions.New(Config.FunctionsConfigs)
 
@@ -160,6 +188,29 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 	case "mem":
 		Config.QueryCache = cache.NewExpireCache(uint64(Config.Cache.Size * 1024 * 1024))
 
+		// find cache is only used if SendGlobsAsIs is false.
+		if !Config.SendGlobsAsIs {
+			Config.FindCache = cache.NewExpireCache(0)
+		}
+	case "disk":
+		if Config.Cache.Path == "" {
+			logger.Fatal("disk cache requested but no path provided")
+		}
+
+		diskCache, err := cache.NewDiskCache(Config.Cache.Path, uint64(Config.Cache.Size*1024*1024))
+		if err != nil {
+			logger.Fatal("failed to initialize disk cache",
+				zap.String("path", Config.Cache.Path),
+				zap.Error(err),
+			)
+		}
+		logger.Info("disk cache configured",
+			zap.String("path", Config.Cache.Path),
+			zap.Int("items", diskCache.Items()),
+			zap.Uint64("size", diskCache.Size()),
+		)
+		Config.QueryCache = diskCache
+
 		// find cache is only used if SendGlobsAsIs is false.
 		if !Config.SendGlobsAsIs {
 			Config.FindCache = cache.NewExpireCache(0)
@@ -171,36 +222,82 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 	default:
 		logger.Error("unknown cache type",
 			zap.String("cache_type", Config.Cache.Type),
-			zap.Strings("known_cache_types", []string{"null", "mem", "memcache"}),
+			zap.Strings("known_cache_types", []string{"null", "mem", "memcache", "disk"}),
 		)
 	}
 
-	if Config.TimezoneString != "" {
-		fields := strings.Split(Config.TimezoneString, ",")
+	sortRecencyTimeouts(Config.Cache.RecencyTimeouts)
 
-		if len(fields) != 2 {
-			logger.Fatal("unexpected amount of fields in tz",
-				zap.String("timezone_string", Config.TimezoneString),
-				zap.Int("fields_got", len(fields)),
-				zap.Int("fields_expected", 2),
-			)
-		}
-
-		offs, err := strconv.Atoi(fields[1])
+	if Config.TimezoneString != "" {
+		tz, err := parseTimezone(Config.TimezoneString)
 		if err != nil {
-			logger.Fatal("unable to parse seconds",
-				zap.String("field[1]", fields[1]),
+			logger.Fatal("unable to parse tz",
+				zap.String("timezone_string", Config.TimezoneString),
 				zap.Error(err),
 			)
 		}
 
-		Config.DefaultTimeZone = time.FixedZone(fields[0], offs)
+		Config.DefaultTimeZone = tz
 		logger.Info("using fixed timezone",
 			zap.String("timezone", Config.DefaultTimeZone.String()),
-			zap.Int("offset", offs),
 		)
 	}
 
+	err = checkAdmin(&Config)
+	if err != nil {
+		logger.Fatal("invalid admin config",
+			zap.Error(err),
+		)
+	}
+
+	err = Config.AccessLog.SetExcludeFields(Config.AccessLog.ExcludeFields)
+	if err != nil {
+		logger.Fatal("invalid access log config",
+			zap.Error(err),
+		)
+	}
+
+	err = setUpTenants(&Config)
+	if err != nil {
+		logger.Fatal("failed to set up tenants",
+			zap.Error(err),
+		)
+	}
+
+	err = setUpScheduler(&Config)
+	if err != nil {
+		logger.Fatal("failed to set up scheduler",
+			zap.Error(err),
+		)
+	}
+
+	err = setUpReporting(&Config)
+	if err != nil {
+		logger.Fatal("failed to set up reporting",
+			zap.Error(err),
+		)
+	}
+
+	err = setUpStorageSchemas(&Config)
+	if err != nil {
+		logger.Fatal("failed to set up storage schemas",
+			zap.Error(err),
+		)
+	}
+
+	// legacy backends are converted to a group named "backends"
+	groups := map[string]bool{"backends": len(Config.Upstreams.Backends) != 0}
+	for _, backend := range Config.Upstreams.BackendsV2.Backends {
+		groups[backend.GroupName] = true
+	}
+	for _, group := range Config.BackendSelection.AllowedGroups {
+		if !groups[group] {
+			logger.Warn("backend group allowed for selection is not configured in upstreams",
+				zap.String("group", group),
+			)
+		}
+	}
+
 	if len(Config.UnicodeRangeTables) != 0 {
 		if strings.ToLower(Config.UnicodeRangeTables[0]) == "all" {
 			for _, t := range unicode.Scripts {
@@ -249,88 +346,427 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 		)
 	}
 
-	for _, define := range Config.Define {
-		if define.Name == "" {
-			logger.Fatal("empty define name")
+	if Config.NormalizeMethod != "" {
+		if !types.IsValidNormalizeMethod(Config.NormalizeMethod) {
+			logger.Fatal("unknown normalizeMethod",
+				zap.String("normalizeMethod", Config.NormalizeMethod),
+				zap.Strings("supported", types.NormalizeMethods),
+			)
+		}
+		types.DefaultNormalizeMethod = Config.NormalizeMethod
+		helper.NormalizeSeries = true
+	}
+
+	if a := Config.StepNormalization.Aggregation; a != "" {
+		if _, ok := consolidations.ConsolidationFunc(a); !ok {
+			logger.Fatal("unknown stepNormalization.aggregation",
+				zap.String("aggregation", a),
+			)
 		}
-		err := parser.Define(define.Name, define.Template)
+	}
+	helper.StrictSteps = Config.StepNormalization.Strict
+	helper.StepAggregation = Config.StepNormalization.Aggregation
+
+	types.ConsolidationFallback = Config.ConsolidationFallback
+	types.RetainAggregatedValues = Config.RetainAggregatedValues
+	types.Float32Values = Config.Float32Values
+	types.SparseValues = Config.SparseValues
+
+	if a := Config.SeriesLimits.Action; a != SeriesLimitTruncate && a != SeriesLimitReject {
+		logger.Fatal("unknown seriesLimits.action",
+			zap.String("action", a),
+			zap.Strings("supported", []string{SeriesLimitTruncate, SeriesLimitReject}),
+		)
+	}
+
+	for name, prefixes := range Config.UnitSystems {
+		err := types.RegisterUnitSystem(name, prefixes)
 		if err != nil {
-			logger.Fatal("unable to compile define template",
+			logger.Fatal("invalid unit system",
 				zap.Error(err),
-				zap.String("template", define.Template),
 			)
 		}
 	}
+
+	defines, err := buildDefines(&Config)
+	if err != nil {
+		logger.Fatal("invalid defines or macros",
+			zap.Error(err),
+		)
+	}
+	parser.SetDefines(defines)
 }
 
-func SetUpViper(logger *zap.Logger, configPath *string, viperPrefix string) {
-	if *configPath != "" {
-		b, err := ioutil.ReadFile(*configPath)
+// buildDefines compiles defines and macros of config
+func buildDefines(cfg *ConfigType) (*parser.Defines, error) {
+	defines := parser.NewDefines()
+	for _, define := range cfg.Define {
+		if define.Name == "" {
+			return nil, fmt.Errorf("empty define name")
+		}
+		err := defines.Define(define.Name, define.Template)
 		if err != nil {
-			logger.Fatal("error reading config file",
-				zap.String("config_path", *configPath),
-				zap.Error(err),
-			)
+			return nil, fmt.Errorf("unable to compile define template %q: %v", define.Template, err)
+		}
+	}
+	for _, m := range cfg.Macros {
+		err := defines.DefineMacro(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return defines, nil
+}
+
+// parseTimezone parses fixed timezone in "name,offset_in_seconds" format
+func parseTimezone(s string) (*time.Location, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected amount of fields in tz: got %v, expected 2", len(fields))
+	}
+
+	offs, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse seconds: %v", err)
+	}
+
+	return time.FixedZone(fields[0], offs), nil
+}
+
+// setUpTenants validates tenants and creates their upstreams, limiters and timezones
+func setUpTenants(cfg *ConfigType) error {
+	apiKeys := make(map[string]string)
+	for name, t := range cfg.Tenants.Tenants {
+		if t == nil {
+			t = &TenantConfig{}
+			cfg.Tenants.Tenants[name] = t
 		}
+		t.Name = name
+		if t.CacheNamespace == "" {
+			t.CacheNamespace = name
+		}
+
+		if len(t.APIKeys) != 0 && cfg.Tenants.APIKeyHeader == "" {
+			return fmt.Errorf("tenant %q has API keys, but tenants.apiKeyHeader is not set", name)
+		}
+		for _, key := range t.APIKeys {
+			if other, ok := apiKeys[key]; ok {
+				return fmt.Errorf("tenant %q uses the same API key as tenant %q", name, other)
+			}
+			apiKeys[key] = name
+		}
+
+		if len(t.Backends) != 0 || t.BackendsV2 != nil {
+			upstreams := cfg.Upstreams
+			upstreams.Backends = t.Backends
+			upstreams.BackendsV2 = zipperTypes.BackendsV2{}
+			if t.BackendsV2 != nil {
+				upstreams.BackendsV2 = *t.BackendsV2
+			}
+			t.Upstreams = &upstreams
+		}
+
+		if t.Concurency < 0 {
+			return fmt.Errorf("concurency of tenant %q must not be negative, got %v", name, t.Concurency)
+		}
+		if t.Concurency > 0 {
+			t.Limiter = limiter.NewSimpleLimiter(t.Concurency)
+		}
+
+		if t.TimezoneString != "" {
+			tz, err := parseTimezone(t.TimezoneString)
+			if err != nil {
+				return fmt.Errorf("tenant %q: %v", name, err)
+			}
+			t.DefaultTimeZone = tz
+		}
+	}
+	return nil
+}
+
+// checkAdmin refuses admin endpoints without token, as they allow to change state of carbonapi and could be
+// served on the main listener
+func checkAdmin(cfg *ConfigType) error {
+	if cfg.Admin.Enabled && cfg.Admin.Token == "" {
+		return fmt.Errorf("admin endpoints are enabled, but admin.token is not set")
+	}
+	return nil
+}
+
+// setUpScheduler validates scheduled queries and fills defaults. Tenants should be set up already
+func setUpScheduler(cfg *ConfigType) error {
+	names := make(map[string]bool)
+	for i := range cfg.Scheduler.Queries {
+		q := &cfg.Scheduler.Queries[i]
+		if q.Name == "" {
+			return fmt.Errorf("scheduled query #%d has no name", i)
+		}
+		if names[q.Name] {
+			return fmt.Errorf("scheduled query %q is defined twice", q.Name)
+		}
+		names[q.Name] = true
+
+		if len(q.Targets) == 0 {
+			return fmt.Errorf("scheduled query %q has no targets", q.Name)
+		}
+		if q.Webhook == "" && q.Carbon == "" {
+			return fmt.Errorf("scheduled query %q has neither webhook nor carbon", q.Name)
+		}
+		if q.Tenant != "" && cfg.Tenants.Get(q.Tenant) == nil {
+			return fmt.Errorf("scheduled query %q uses unknown tenant %q", q.Name, q.Tenant)
+		}
+		if q.Interval < 0 || q.Timeout < 0 {
+			return fmt.Errorf("scheduled query %q: interval and timeout must not be negative", q.Name)
+		}
+		if q.Interval == 0 {
+			q.Interval = time.Minute
+		}
+		if q.Timeout == 0 {
+			q.Timeout = q.Interval
+		}
+		if q.From == "" {
+			q.From = "-5min"
+		}
+		switch q.CarbonProtocol {
+		case "":
+			q.CarbonProtocol = "plaintext"
+		case "plaintext", "pickle":
+		default:
+			return fmt.Errorf("scheduled query %q: unknown carbon protocol %q", q.Name, q.CarbonProtocol)
+		}
+		if q.Retries < 0 {
+			return fmt.Errorf("scheduled query %q: retries must not be negative", q.Name)
+		}
+		if q.Jitter < 0 || q.Jitter >= q.Interval {
+			return fmt.Errorf("scheduled query %q: jitter must be less than interval", q.Name)
+		}
+	}
+	return nil
+}
+
+// setUpReporting validates reports, parses their schedules and fills defaults. Tenants should be set up already
+func setUpReporting(cfg *ConfigType) error {
+	smtp := cfg.Reporting.SMTP
+	names := make(map[string]bool)
+	for i := range cfg.Reporting.Reports {
+		r := &cfg.Reporting.Reports[i]
+		if r.Name == "" {
+			return fmt.Errorf("report #%d has no name", i)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("report %q is defined twice", r.Name)
+		}
+		names[r.Name] = true
+
+		if len(r.Targets) == 0 {
+			return fmt.Errorf("report %q has no targets", r.Name)
+		}
+		cron, err := ParseCronSchedule(r.Schedule)
+		if err != nil {
+			return fmt.Errorf("report %q: %v", r.Name, err)
+		}
+		if cron.Next(time.Now()).IsZero() {
+			return fmt.Errorf("report %q is never scheduled", r.Name)
+		}
+		r.Cron = cron
+		if len(r.Email) == 0 && r.Webhook == "" {
+			return fmt.Errorf("report %q has neither email nor webhook", r.Name)
+		}
+		if len(r.Email) > 0 && (smtp.Address == "" || smtp.From == "") {
+			return fmt.Errorf("report %q is sent by email, but smtp address or from isn't set", r.Name)
+		}
+		if r.Tenant != "" && cfg.Tenants.Get(r.Tenant) == nil {
+			return fmt.Errorf("report %q uses unknown tenant %q", r.Name, r.Tenant)
+		}
+		if r.Timeout < 0 {
+			return fmt.Errorf("report %q: timeout must not be negative", r.Name)
+		}
+		if r.Timeout == 0 {
+			r.Timeout = 5 * time.Minute
+		}
+		if len(r.Formats) == 0 {
+			r.Formats = []string{"png"}
+		}
+		if r.Subject == "" {
+			r.Subject = "carbonapi report " + r.Name
+		}
+	}
+	return nil
+}
 
-		if strings.HasSuffix(*configPath, ".toml") {
+// setUpStorageSchemas compiles patterns and parses retentions of storage schemas
+func setUpStorageSchemas(cfg *ConfigType) error {
+	for i := range cfg.StorageSchemas {
+		schema := &cfg.StorageSchemas[i]
+		re, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("storage schema %q: invalid pattern: %v", schema.Name, err)
+		}
+		schema.Re = re
+		schema.Archives, err = parseRetentions(schema.Retentions)
+		if err != nil {
+			return fmt.Errorf("storage schema %q: %v", schema.Name, err)
+		}
+	}
+	return nil
+}
+
+// parseRetentions parses retentions of storage schema, like carbon does
+func parseRetentions(s string) ([]Archive, error) {
+	var archives []Archive
+	for _, retention := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(retention), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid retention %q", retention)
+		}
+		step, err := parseRetentionInterval(parts[0])
+		if err != nil || step <= 0 {
+			return nil, fmt.Errorf("invalid step of retention %q", retention)
+		}
+		points, err := strconv.ParseInt(parts[1], 10, 64)
+		var length int64
+		if err == nil {
+			length = points * step
+		} else {
+			length, err = parseRetentionInterval(parts[1])
+		}
+		if err != nil || length < step {
+			return nil, fmt.Errorf("invalid retention %q", retention)
+		}
+		if n := len(archives); n > 0 && (step <= archives[n-1].Step || length <= archives[n-1].Retention) {
+			return nil, fmt.Errorf("retention %q should be coarser and longer than previous ones", retention)
+		}
+		archives = append(archives, Archive{Step: step, Retention: length})
+	}
+	return archives, nil
+}
+
+// parseRetentionInterval parses interval with units or seconds
+func parseRetentionInterval(s string) (int64, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return seconds, nil
+	}
+	if s == "" {
+		return 0, parser.ErrUnknownTimeUnits
+	}
+	interval, err := parser.IntervalString(s, 1)
+	return int64(interval), err
+}
+
+// readViper reads config file and sets up defaults for specified viper instance
+func readViper(logger *zap.Logger, v *viper.Viper, configPath string, viperPrefix string) error {
+	if configPath != "" {
+		b, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return fmt.Errorf("error reading config file: %v", err)
+		}
+
+		if strings.HasSuffix(configPath, ".toml") {
 			logger.Info("will parse config as toml",
-				zap.String("config_file", *configPath),
+				zap.String("config_file", configPath),
 			)
-			viper.SetConfigType("TOML")
+			v.SetConfigType("TOML")
 		} else {
 			logger.Info("will parse config as yaml",
-				zap.String("config_file", *configPath),
+				zap.String("config_file", configPath),
 			)
-			viper.SetConfigType("YAML")
+			v.SetConfigType("YAML")
 		}
-		err = viper.ReadConfig(bytes.NewBuffer(b))
+		err = v.ReadConfig(bytes.NewBuffer(b))
 		if err != nil {
-			logger.Fatal("failed to parse config",
-				zap.String("config_path", *configPath),
-				zap.Error(err),
-			)
+			return fmt.Errorf("failed to parse config: %v", err)
 		}
 	}
 
 	if viperPrefix != "" {
-		viper.SetEnvPrefix(viperPrefix)
-	}
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	viper.BindEnv("tz", "carbonapi_tz")
-	viper.SetDefault("listen", "localhost:8081")
-	viper.SetDefault("concurency", 20)
-	viper.SetDefault("cache.type", "mem")
-	viper.SetDefault("cache.size_mb", 0)
-	viper.SetDefault("cache.defaultTimeoutSec", 60)
-	viper.SetDefault("cache.memcachedServers", []string{})
-	viper.SetDefault("cpus", 0)
-	viper.SetDefault("tz", "")
-	viper.SetDefault("sendGlobsAsIs", false)
-	viper.SetDefault("AlwaysSendGlobsAsIs", false)
-	viper.SetDefault("maxBatchSize", 100)
-	viper.SetDefault("graphite.host", "")
-	viper.SetDefault("graphite.interval", "60s")
-	viper.SetDefault("graphite.prefix", "carbon.api")
-	viper.SetDefault("graphite.pattern", "{prefix}.{fqdn}")
-	viper.SetDefault("idleConnections", 10)
-	viper.SetDefault("pidFile", "")
-	viper.SetDefault("upstreams.internalRoutingCache", "600s")
-	viper.SetDefault("upstreams.buckets", 10)
-	viper.SetDefault("upstreams.timeouts.global", "10s")
-	viper.SetDefault("upstreams.timeouts.afterStarted", "2s")
-	viper.SetDefault("upstreams.timeouts.connect", "200ms")
-	viper.SetDefault("upstreams.concurrencyLimit", 0)
-	viper.SetDefault("upstreams.keepAliveInterval", "30s")
-	viper.SetDefault("upstreams.maxIdleConnsPerHost", 100)
-	viper.SetDefault("upstreams.carbonsearch.backend", "")
-	viper.SetDefault("upstreams.carbonsearch.prefix", "virt.v1.*")
-	viper.SetDefault("upstreams.graphite09compat", false)
-	viper.SetDefault("expireDelaySec", 600)
-	viper.SetDefault("logger", map[string]string{})
-	viper.AutomaticEnv()
-
-	err := viper.Unmarshal(&Config)
+		v.SetEnvPrefix(viperPrefix)
+	}
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.BindEnv("tz", "carbonapi_tz")
+	v.SetDefault("listen", "localhost:8081")
+	v.SetDefault("drainTimeout", "60s")
+	v.SetDefault("concurency", 20)
+	v.SetDefault("cache.type", "mem")
+	v.SetDefault("cache.size_mb", 0)
+	v.SetDefault("cache.defaultTimeoutSec", 60)
+	v.SetDefault("cache.memcachedServers", []string{})
+	v.SetDefault("cache.path", "")
+	v.SetDefault("cpus", 0)
+	v.SetDefault("tz", "")
+	v.SetDefault("sendGlobsAsIs", false)
+	v.SetDefault("AlwaysSendGlobsAsIs", false)
+	v.SetDefault("maxBatchSize", 100)
+	v.SetDefault("graphite.host", "")
+	v.SetDefault("graphite.interval", "60s")
+	v.SetDefault("graphite.prefix", "carbon.api")
+	v.SetDefault("graphite.pattern", "{prefix}.{fqdn}")
+	v.SetDefault("idleConnections", 10)
+	v.SetDefault("pidFile", "")
+	v.SetDefault("upstreams.internalRoutingCache", "600s")
+	v.SetDefault("upstreams.buckets", 10)
+	v.SetDefault("upstreams.timeouts.global", "10s")
+	v.SetDefault("upstreams.timeouts.afterStarted", "2s")
+	v.SetDefault("upstreams.timeouts.connect", "200ms")
+	v.SetDefault("upstreams.concurrencyLimit", 0)
+	v.SetDefault("upstreams.keepAliveInterval", "30s")
+	v.SetDefault("upstreams.maxIdleConnsPerHost", 100)
+	v.SetDefault("upstreams.carbonsearch.backend", "")
+	v.SetDefault("upstreams.carbonsearch.prefix", "virt.v1.*")
+	v.SetDefault("upstreams.graphite09compat", false)
+	v.SetDefault("expireDelaySec", 600)
+	v.SetDefault("slowLog.threshold", "0s")
+	v.SetDefault("slowLog.datapointsThreshold", 0)
+	v.SetDefault("slowLog.sampleRate", 1.0)
+	v.SetDefault("admin.enabled", false)
+	v.SetDefault("admin.listen", "")
+	v.SetDefault("admin.token", "")
+	v.SetDefault("admin.pprofEnabled", false)
+	v.SetDefault("topQueries.size", 0)
+	v.SetDefault("topQueries.window", "10m")
+	v.SetDefault("tagIndex.enabled", false)
+	v.SetDefault("tagIndex.fullRefreshInterval", "10m")
+	v.SetDefault("tagIndex.deltaRefreshInterval", "1m")
+	v.SetDefault("tagIndex.timeout", "1m")
+	v.SetDefault("tagIndex.findWalk", false)
+	v.SetDefault("tagIndex.maxSeries", 1000000)
+	v.SetDefault("seriesLimits.maxSeries", 0)
+	v.SetDefault("seriesLimits.action", "truncate")
+	v.SetDefault("metricIndex.enabled", false)
+	v.SetDefault("metricIndex.fullRefreshInterval", "1h")
+	v.SetDefault("metricIndex.deltaRefreshInterval", "5m")
+	v.SetDefault("metricIndex.timeout", "5m")
+	v.SetDefault("metricIndex.maxMetrics", 10000000)
+	v.SetDefault("metricIndex.expandGlobs", false)
+	v.SetDefault("functionCache.size_mb", 0)
+	v.SetDefault("functionCache.ttl", "1h")
+	v.SetDefault("functionCache.functions", []string{"holtWintersForecast", "holtWintersConfidenceBands", "holtWintersAberration", "summarize"})
+	v.SetDefault("functionComparison.functions", []string{})
+	v.SetDefault("functionComparison.tolerance", 1e-9)
+	v.SetDefault("incrementalCache.size_mb", 0)
+	v.SetDefault("incrementalCache.mutableWindow", "2m")
+	v.SetDefault("incrementalCache.ttl", "10m")
+	v.SetDefault("shadowTraffic.group", "")
+	v.SetDefault("shadowTraffic.percent", 0)
+	v.SetDefault("shadowTraffic.maxConcurrent", 100)
+	v.SetDefault("shadowTraffic.timeout", "1m")
+	v.SetDefault("logger", map[string]string{})
+	v.AutomaticEnv()
+
+	return nil
+}
+
+func SetUpViper(logger *zap.Logger, configPath *string, viperPrefix string) {
+	err := readViper(logger, viper.GetViper(), *configPath, viperPrefix)
+	if err != nil {
+		logger.Fatal("failed to read config",
+			zap.String("config_path", *configPath),
+			zap.Error(err),
+		)
+	}
+	configFile = *configPath
+	envPrefix = viperPrefix
+
+	err = viper.Unmarshal(&Config)
 	if err != nil {
 		logger.Fatal("failed to parse config",
 			zap.Error(err),
@@ -339,23 +775,27 @@ func SetUpViper(logger *zap.Logger, configPath *string, viperPrefix string) {
 }
 
 func SetUpConfigUpstreams(logger *zap.Logger) {
-	if Config.Zipper != "" {
+	setUpUpstreams(logger, &Config)
+	if len(Config.Upstreams.Backends) == 0 && len(Config.Upstreams.BackendsV2.Backends) == 0 {
+		logger.Fatal("no backends specified for upstreams!")
+	}
+
+}
+
+func setUpUpstreams(logger *zap.Logger, cfg *ConfigType) {
+	if cfg.Zipper != "" {
 		logger.Warn("found legacy 'zipper' option, will use it instead of any 'upstreams' specified. This will be removed in future versions!")
 
-		Config.Upstreams.Backends = []string{Config.Zipper}
-		Config.Upstreams.ConcurrencyLimitPerServer = Config.Concurency
-		Config.Upstreams.MaxIdleConnsPerHost = Config.IdleConnections
-		Config.Upstreams.MaxBatchSize = Config.MaxBatchSize
-		Config.Upstreams.KeepAliveInterval = 10 * time.Second
+		cfg.Upstreams.Backends = []string{cfg.Zipper}
+		cfg.Upstreams.ConcurrencyLimitPerServer = cfg.Concurency
+		cfg.Upstreams.MaxIdleConnsPerHost = cfg.IdleConnections
+		cfg.Upstreams.MaxBatchSize = cfg.MaxBatchSize
+		cfg.Upstreams.KeepAliveInterval = 10 * time.Second
 		// To emulate previous behavior
-		Config.Upstreams.Timeouts = zipperTypes.Timeouts{
+		cfg.Upstreams.Timeouts = zipperTypes.Timeouts{
 			Connect: 1 * time.Second,
 			Render:  600 * time.Second,
 			Find:    600 * time.Second,
 		}
 	}
-	if len(Config.Upstreams.Backends) == 0 && len(Config.Upstreams.BackendsV2.Backends) == 0 {
-		logger.Fatal("no backends specified for upstreams!")
-	}
-
 }
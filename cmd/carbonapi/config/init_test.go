@@ -0,0 +1,72 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRetentions(t *testing.T) {
+	tests := []struct {
+		retentions string
+		want       []Archive
+		err        bool
+	}{
+		{retentions: "60s:1d,5m:30d,1h:1y", want: []Archive{{60, 86400}, {300, 2592000}, {3600, 31536000}}},
+		{retentions: "60:1440, 300:8640", want: []Archive{{60, 86400}, {300, 2592000}}},
+		{retentions: "1m:7d", want: []Archive{{60, 604800}}},
+		{retentions: "", err: true},
+		{retentions: "60s", err: true},
+		{retentions: "60q:1d", err: true},
+		{retentions: "5m:30d,60s:1d", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRetentions(tt.retentions)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", tt.retentions, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.retentions, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.retentions, got, tt.want)
+		}
+	}
+}
+
+func TestSetUpReporting(t *testing.T) {
+	valid := func() ReportConfig {
+		return ReportConfig{Name: "daily", Schedule: "0 9 * * 1-5", Targets: []string{"foo"}, Webhook: "http://localhost/"}
+	}
+	cfg := ConfigType{Reporting: ReportingConfig{Reports: []ReportConfig{valid()}}}
+	if err := setUpReporting(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := cfg.Reporting.Reports[0]
+	if r.Cron == nil || r.Timeout != 5*time.Minute || !reflect.DeepEqual(r.Formats, []string{"png"}) || r.Subject != "carbonapi report daily" {
+		t.Errorf("defaults aren't set: %+v", r)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *ReportConfig)
+	}{
+		{"no name", func(r *ReportConfig) { r.Name = "" }},
+		{"no targets", func(r *ReportConfig) { r.Targets = nil }},
+		{"invalid schedule", func(r *ReportConfig) { r.Schedule = "0 25 * * *" }},
+		{"never scheduled", func(r *ReportConfig) { r.Schedule = "0 9 30 2 *" }},
+		{"no delivery", func(r *ReportConfig) { r.Webhook = "" }},
+		{"email without smtp", func(r *ReportConfig) { r.Email = []string{"ops@example.com"} }},
+		{"unknown tenant", func(r *ReportConfig) { r.Tenant = "none" }},
+	}
+	for _, tt := range tests {
+		r := valid()
+		tt.modify(&r)
+		cfg := ConfigType{Reporting: ReportingConfig{Reports: []ReportConfig{r}}}
+		if err := setUpReporting(&cfg); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ReadConfig reads config file that was used at startup and returns parsed configuration. Current configuration
+// is not changed.
+func ReadConfig(logger *zap.Logger) (*ConfigType, error) {
+	v := viper.New()
+	err := readViper(logger, v, configFile, envPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	err = v.Unmarshal(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+
+	setUpUpstreams(logger, &cfg)
+	if len(cfg.Upstreams.Backends) == 0 && len(cfg.Upstreams.BackendsV2.Backends) == 0 {
+		return nil, fmt.Errorf("no backends specified for upstreams")
+	}
+	if cfg.Concurency <= 0 {
+		return nil, fmt.Errorf("concurency must be positive, got %v", cfg.Concurency)
+	}
+	if cfg.Cache.DefaultTimeoutSec < 0 {
+		return nil, fmt.Errorf("cache.defaultTimeoutSec must not be negative, got %v", cfg.Cache.DefaultTimeoutSec)
+	}
+	for _, rule := range cfg.Cache.RecencyTimeouts {
+		if rule.UntilOlderThan < 0 || rule.TimeoutSec < 0 {
+			return nil, fmt.Errorf("cache.recencyTimeouts must not be negative, got %+v", rule)
+		}
+	}
+	sortRecencyTimeouts(cfg.Cache.RecencyTimeouts)
+	err = checkAdmin(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.AccessLog.SetExcludeFields(cfg.AccessLog.ExcludeFields)
+	if err != nil {
+		return nil, err
+	}
+	cfg.defines, err = buildDefines(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	// tenants are not reloadable, but config with invalid ones should be refused
+	err = setUpTenants(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// current is a snapshot of configuration with reloadable options applied, it's replaced as a whole on reload
+var current atomic.Value // *ConfigType
+
+// Current returns current configuration. Options that could be changed by reload must be read from it instead of
+// Config. Returned configuration must not be modified
+func Current() *ConfigType {
+	if c, ok := current.Load().(*ConfigType); ok {
+		return c
+	}
+	return &Config
+}
+
+// ApplyReloadable copies sections that are safe to change at runtime from cfg to a new snapshot of current
+// configuration and publishes it. Returns list of changed options.
+func ApplyReloadable(cfg *ConfigType) []string {
+	var changes []string
+	prev := Current()
+	next := *prev
+
+	if cfg.Concurency != prev.Concurency {
+		changes = append(changes, fmt.Sprintf("concurency: %v -> %v", prev.Concurency, cfg.Concurency))
+		next.Concurency = cfg.Concurency
+		// Requests that are already running will leave old limiter
+		next.Limiter = limiter.NewSimpleLimiter(cfg.Concurency)
+	}
+
+	if cfg.Cache.DefaultTimeoutSec != prev.Cache.DefaultTimeoutSec {
+		changes = append(changes, fmt.Sprintf("cache.defaultTimeoutSec: %v -> %v", prev.Cache.DefaultTimeoutSec, cfg.Cache.DefaultTimeoutSec))
+		next.Cache.DefaultTimeoutSec = cfg.Cache.DefaultTimeoutSec
+	}
+
+	if !reflect.DeepEqual(cfg.Cache.RecencyTimeouts, prev.Cache.RecencyTimeouts) {
+		changes = append(changes, "cache.recencyTimeouts")
+		next.Cache.RecencyTimeouts = cfg.Cache.RecencyTimeouts
+	}
+
+	if !reflect.DeepEqual(cfg.AccessLog.ExcludeFields, prev.AccessLog.ExcludeFields) {
+		changes = append(changes, "accessLog")
+		next.AccessLog = cfg.AccessLog
+	}
+
+	if !reflect.DeepEqual(cfg.BackendSelection, prev.BackendSelection) {
+		changes = append(changes, "backendSelection")
+		next.BackendSelection = cfg.BackendSelection
+	}
+
+	if cfg.SlowLog != prev.SlowLog {
+		changes = append(changes, "slowLog")
+		next.SlowLog = cfg.SlowLog
+	}
+
+	if cfg.Admin.Token != prev.Admin.Token {
+		changes = append(changes, "admin.token")
+		next.Admin.Token = cfg.Admin.Token
+	}
+
+	if !reflect.DeepEqual(cfg.DeprecatedFunctions, prev.DeprecatedFunctions) {
+		changes = append(changes, "deprecatedFunctions")
+		next.DeprecatedFunctions = cfg.DeprecatedFunctions
+	}
+
+	definesChanged := false
+	if !reflect.DeepEqual(cfg.Define, prev.Define) {
+		changes = append(changes, "define")
+		next.Define = cfg.Define
+		definesChanged = true
+	}
+	if !reflect.DeepEqual(cfg.Macros, prev.Macros) {
+		changes = append(changes, "macros")
+		next.Macros = cfg.Macros
+		definesChanged = true
+	}
+	// defines are compiled by ReadConfig
+	if definesChanged && cfg.defines != nil {
+		parser.SetDefines(cfg.defines)
+	}
+
+	if len(changes) > 0 {
+		current.Store(&next)
+	}
+	return changes
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"go.uber.org/zap"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "carbonapi*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestReloadConfig(t *testing.T) {
+	logger := zap.NewNop()
+	saved := Config
+	defer func() {
+		Config = saved
+		current.Store(&Config)
+		configFile = ""
+	}()
+
+	configFile = writeConfig(t, `
+concurency: 10
+cache:
+    defaultTimeoutSec: 30
+    recencyTimeouts:
+        - untilOlderThan: "1h"
+          timeoutSec: 3600
+        - untilOlderThan: "24h"
+          timeoutSec: 86400
+upstreams:
+    backends:
+        - "http://127.0.0.1:8080"
+`)
+	defer os.Remove(configFile)
+
+	cfg, err := ReadConfig(logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Cache.RecencyTimeouts[0].UntilOlderThan != 24*time.Hour {
+		t.Errorf("recency timeouts are not sorted: %+v", cfg.Cache.RecencyTimeouts)
+	}
+
+	Config.Concurency = 20
+	Config.Cache.DefaultTimeoutSec = 30
+	Config.SlowLog = SlowLogConfig{SampleRate: 1}
+	current.Store(&Config)
+	changes := ApplyReloadable(cfg)
+	expected := []string{"concurency: 20 -> 10", "cache.recencyTimeouts"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes, got %v, expected %v", changes, expected)
+	}
+	if cap(Current().Limiter) != 10 {
+		t.Errorf("limiter is not updated, capacity %v", cap(Current().Limiter))
+	}
+	if Config.Concurency != 20 {
+		t.Errorf("startup config should not be modified, concurency %v", Config.Concurency)
+	}
+
+	if changes = ApplyReloadable(cfg); len(changes) != 0 {
+		t.Errorf("unexpected changes on second reload: %v", changes)
+	}
+
+	configFile = writeConfig(t, `
+concurency: 10
+cache:
+    defaultTimeoutSec: 30
+    recencyTimeouts:
+        - untilOlderThan: "1h"
+          timeoutSec: 3600
+        - untilOlderThan: "24h"
+          timeoutSec: 86400
+upstreams:
+    backends:
+        - "http://127.0.0.1:8080"
+define:
+    - name: "reloadedDefine"
+      template: "sum({{.argString}})"
+deprecatedFunctions:
+    foo: "use bar"
+`)
+	defer os.Remove(configFile)
+
+	cfg, err = ReadConfig(logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes = ApplyReloadable(cfg)
+	expected = []string{"deprecatedFunctions", "define"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes, got %v, expected %v", changes, expected)
+	}
+	if Current().DeprecatedFunctions["foo"] != "use bar" {
+		t.Errorf("deprecated functions are not updated: %v", Current().DeprecatedFunctions)
+	}
+	e, _, err := parser.ParseExpr("reloadedDefine(a.b)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ToString() != "sum(a.b)" {
+		t.Errorf("define is not reloaded, got %v", e.ToString())
+	}
+	parser.SetDefines(parser.NewDefines())
+}
+
+func TestReloadConfigInvalid(t *testing.T) {
+	logger := zap.NewNop()
+	defer func() { configFile = "" }()
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"no backends", "concurency: 10\n"},
+		{"negative concurency", "concurency: -1\nupstreams:\n    backends:\n        - \"http://127.0.0.1:8080\"\n"},
+		{"broken yaml", "concurency: [\n"},
+		{"admin without token", "upstreams:\n    backends:\n        - \"http://127.0.0.1:8080\"\nadmin:\n    enabled: true\n"},
+		{"unknown access log field", "upstreams:\n    backends:\n        - \"http://127.0.0.1:8080\"\naccessLog:\n    excludeFields: [\"no_such_field\"]\n"},
+		{"empty define name", "upstreams:\n    backends:\n        - \"http://127.0.0.1:8080\"\ndefine:\n    - template: \"sum(a)\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile = writeConfig(t, tt.config)
+			defer os.Remove(configFile)
+
+			_, err := ReadConfig(logger)
+			if err == nil {
+				t.Errorf("expected error, got none")
+			}
+		})
+	}
+}
+
+func TestReadConfigTenants(t *testing.T) {
+	logger := zap.NewNop()
+	defer func() { configFile = "" }()
+
+	configFile = writeConfig(t, `
+upstreams:
+    backends: ["http://global:8080"]
+tenants:
+    header: "X-Tenant"
+    apiKeyHeader: "X-Api-Key"
+    tenants:
+        TeamA:
+            apiKeys: ["keyA"]
+            backends: ["http://a:8080"]
+            concurency: 5
+            tz: "EST,-18000"
+        teamB:
+            cacheNamespace: "b"
+`)
+	defer os.Remove(configFile)
+
+	cfg, err := ReadConfig(logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a := cfg.Tenants.Get("teama")
+	if a == nil {
+		t.Fatalf("tenant teamA not found: %+v", cfg.Tenants.Tenants)
+	}
+	if cfg.Tenants.ByAPIKey("keyA") != a || cfg.Tenants.ByAPIKey("keyB") != nil {
+		t.Errorf("unexpected tenant lookup by API key")
+	}
+	if a.Upstreams == nil || len(a.Upstreams.Backends) != 1 || a.Upstreams.Backends[0] != "http://a:8080" {
+		t.Errorf("unexpected upstreams of teamA: %+v", a.Upstreams)
+	}
+	if a.Upstreams != nil && a.Upstreams.Timeouts != cfg.Upstreams.Timeouts {
+		t.Errorf("timeouts should be inherited, got %+v", a.Upstreams.Timeouts)
+	}
+	if cap(a.GetLimiter()) != 5 {
+		t.Errorf("unexpected limiter capacity %v", cap(a.GetLimiter()))
+	}
+	if _, offset := time.Unix(0, 0).In(a.GetTimeZone()).Zone(); offset != -18000 {
+		t.Errorf("unexpected timezone offset %v", offset)
+	}
+	if a.CacheKey("k") == "k" || a.CacheKey("k") == cfg.Tenants.Get("teamB").CacheKey("k") {
+		t.Errorf("cache keys of tenants should be in different namespaces")
+	}
+
+	b := cfg.Tenants.Get("teamB")
+	if b.Upstreams != nil || b.GetZipper() != Config.ZipperInstance || b.GetLimiter() != Config.Limiter {
+		t.Errorf("teamB should use global settings")
+	}
+
+	configFile = writeConfig(t, `
+upstreams:
+    backends: ["http://global:8080"]
+tenants:
+    apiKeyHeader: "X-Api-Key"
+    tenants:
+        a:
+            apiKeys: ["key"]
+        b:
+            apiKeys: ["key"]
+`)
+	defer os.Remove(configFile)
+
+	_, err = ReadConfig(logger)
+	if err == nil {
+		t.Errorf("expected error for duplicate API keys")
+	}
+
+	configFile = writeConfig(t, `
+upstreams:
+    backends: ["http://global:8080"]
+tenants:
+    tenants:
+        a:
+            apiKeys: ["key"]
+`)
+	defer os.Remove(configFile)
+
+	_, err = ReadConfig(logger)
+	if err == nil {
+		t.Errorf("expected error for API keys without apiKeyHeader")
+	}
+}
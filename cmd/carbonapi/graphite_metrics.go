@@ -8,12 +8,14 @@ import (
 
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/http"
+	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/mstats"
 	"github.com/peterbourgon/g2g"
 	"go.uber.org/zap"
 )
 
-func setupGraphiteMetrics(logger *zap.Logger) {
+// setupGraphiteMetrics starts sending metrics to graphite if it's configured, returns nil otherwise
+func setupGraphiteMetrics(logger *zap.Logger) *g2g.Graphite {
 	var host string
 	if envhost := os.Getenv("GRAPHITEHOST") + ":" + os.Getenv("GRAPHITEPORT"); envhost != ":" || config.Config.Graphite.Host != "" {
 		switch {
@@ -59,6 +61,52 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 		graphite.Register(fmt.Sprintf("%s.find_cache_overhead_ns", pattern), http.ApiMetrics.FindCacheOverheadNS)
 
 		graphite.Register(fmt.Sprintf("%s.render_requests", pattern), http.ApiMetrics.RenderRequests)
+		graphite.Register(fmt.Sprintf("%s.unknown_consolidations", pattern), types.UnknownConsolidations)
+
+		graphite.Register(fmt.Sprintf("%s.memory_used", pattern), http.ApiMetrics.MemoryUsed)
+		graphite.Register(fmt.Sprintf("%s.memory_limit_exceeded", pattern), http.ApiMetrics.MemoryLimitExceeded)
+		graphite.Register(fmt.Sprintf("%s.memory_shed_requests", pattern), http.ApiMetrics.MemoryShedRequests)
+		graphite.Register(fmt.Sprintf("%s.eval_panics", pattern), http.ApiMetrics.EvalPanics)
+		graphite.Register(fmt.Sprintf("%s.series_limit_exceeded", pattern), http.ApiMetrics.SeriesLimitExceeded)
+		graphite.Register(fmt.Sprintf("%s.scheduled_queries", pattern), http.ApiMetrics.ScheduledQueries)
+		graphite.Register(fmt.Sprintf("%s.scheduled_query_errors", pattern), http.ApiMetrics.ScheduledQueryErrors)
+		graphite.Register(fmt.Sprintf("%s.scheduled_points_written", pattern), http.ApiMetrics.ScheduledPointsWritten)
+		graphite.Register(fmt.Sprintf("%s.scheduled_write_retries", pattern), http.ApiMetrics.ScheduledWriteRetries)
+		graphite.Register(fmt.Sprintf("%s.scheduled_write_lag", pattern), http.ApiMetrics.ScheduledWriteLag)
+
+		if config.Config.FunctionCache.Size > 0 {
+			graphite.Register(fmt.Sprintf("%s.function_cache_hits", pattern), http.ApiMetrics.FunctionCacheHits)
+			graphite.Register(fmt.Sprintf("%s.function_cache_misses", pattern), http.ApiMetrics.FunctionCacheMisses)
+			graphite.Register(fmt.Sprintf("%s.function_cache_size", pattern), http.ApiMetrics.FunctionCacheSize)
+			graphite.Register(fmt.Sprintf("%s.function_cache_items", pattern), http.ApiMetrics.FunctionCacheItems)
+		}
+		if len(config.Config.FunctionComparison.Functions) > 0 {
+			graphite.Register(fmt.Sprintf("%s.function_comparisons", pattern), http.ApiMetrics.FunctionComparisons)
+			graphite.Register(fmt.Sprintf("%s.function_comparison_mismatches", pattern), http.ApiMetrics.FunctionComparisonMismatches)
+			graphite.Register(fmt.Sprintf("%s.function_comparison_errors", pattern), http.ApiMetrics.FunctionComparisonErrors)
+		}
+		if config.Config.IncrementalCache.Size > 0 {
+			graphite.Register(fmt.Sprintf("%s.incremental_cache_hits", pattern), http.ApiMetrics.IncrementalCacheHits)
+			graphite.Register(fmt.Sprintf("%s.incremental_cache_misses", pattern), http.ApiMetrics.IncrementalCacheMisses)
+			graphite.Register(fmt.Sprintf("%s.incremental_cache_refetches", pattern), http.ApiMetrics.IncrementalCacheRefetches)
+		}
+		if config.Config.ChunkedFetch.MinRange > 0 {
+			graphite.Register(fmt.Sprintf("%s.chunked_fetch_requests", pattern), http.ApiMetrics.ChunkedFetchRequests)
+		}
+		if config.Config.ShadowTraffic.Group != "" {
+			graphite.Register(fmt.Sprintf("%s.shadow_requests", pattern), http.ApiMetrics.ShadowRequests)
+			graphite.Register(fmt.Sprintf("%s.shadow_errors", pattern), http.ApiMetrics.ShadowErrors)
+			graphite.Register(fmt.Sprintf("%s.shadow_dropped", pattern), http.ApiMetrics.ShadowDropped)
+			graphite.Register(fmt.Sprintf("%s.shadow_runtime_ns", pattern), http.ApiMetrics.ShadowRuntimeNS)
+		}
+		if config.Config.Export.MaxConcurrent > 0 {
+			graphite.Register(fmt.Sprintf("%s.export_jobs", pattern), http.ApiMetrics.ExportJobs)
+			graphite.Register(fmt.Sprintf("%s.export_errors", pattern), http.ApiMetrics.ExportErrors)
+		}
+		if len(config.Config.Reporting.Reports) > 0 {
+			graphite.Register(fmt.Sprintf("%s.reports", pattern), http.ApiMetrics.Reports)
+			graphite.Register(fmt.Sprintf("%s.report_errors", pattern), http.ApiMetrics.ReportErrors)
+		}
 
 		if http.ApiMetrics.MemcacheTimeouts != nil {
 			graphite.Register(fmt.Sprintf("%s.memcache_timeouts", pattern), http.ApiMetrics.MemcacheTimeouts)
@@ -83,6 +131,24 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 		graphite.Register(fmt.Sprintf("%s.zipper.cache_hits", pattern), http.ZipperMetrics.CacheHits)
 		graphite.Register(fmt.Sprintf("%s.zipper.cache_misses", pattern), http.ZipperMetrics.CacheMisses)
 
+		graphite.Register(fmt.Sprintf("%s.zipper.new_connections", pattern), http.ZipperMetrics.NewConnections)
+		graphite.Register(fmt.Sprintf("%s.zipper.reused_connections", pattern), http.ZipperMetrics.ReusedConnections)
+		graphite.Register(fmt.Sprintf("%s.zipper.reused_idle_connections", pattern), http.ZipperMetrics.ReusedIdleConnections)
+		graphite.Register(fmt.Sprintf("%s.zipper.dial_errors", pattern), http.ZipperMetrics.DialErrors)
+
+		graphite.Register(fmt.Sprintf("%s.zipper.backend_queued", pattern), http.ZipperMetrics.BackendQueued)
+		graphite.Register(fmt.Sprintf("%s.zipper.backend_rejected", pattern), http.ZipperMetrics.BackendRejected)
+		graphite.Register(fmt.Sprintf("%s.zipper.backend_throttled", pattern), http.ZipperMetrics.BackendThrottled)
+		graphite.Register(fmt.Sprintf("%s.zipper.responses_too_large", pattern), http.ZipperMetrics.ResponsesTooLarge)
+
+		graphite.Register(fmt.Sprintf("%s.zipper.retries", pattern), http.ZipperMetrics.Retries)
+		graphite.Register(fmt.Sprintf("%s.zipper.retry_budget_exhausted", pattern), http.ZipperMetrics.RetryBudgetExhausted)
+
+		graphite.Register(fmt.Sprintf("%s.zipper.circuit_breakers_open", pattern), http.ZipperMetrics.CircuitBreakersOpen)
+		graphite.Register(fmt.Sprintf("%s.zipper.circuit_breaker_rejected", pattern), http.ZipperMetrics.CircuitBreakerRejected)
+
+		graphite.Register(fmt.Sprintf("%s.zipper.prefix_index_skipped", pattern), http.ZipperMetrics.PrefixIndexSkipped)
+
 		go mstats.Start(config.Config.Graphite.Interval)
 
 		graphite.Register(fmt.Sprintf("%s.alloc", pattern), &mstats.Alloc)
@@ -90,5 +156,7 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 		graphite.Register(fmt.Sprintf("%s.num_gc", pattern), &mstats.NumGC)
 		graphite.Register(fmt.Sprintf("%s.pause_ns", pattern), &mstats.PauseNS)
 
+		return graphite
 	}
+	return nil
 }
@@ -0,0 +1,329 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+)
+
+// topQueriesTracker is nil if tracking of top queries is disabled
+var topQueriesTracker *topQueries
+
+// ConfigReloader re-reads config and returns list of changes
+var ConfigReloader func() ([]string, error)
+
+// InitAdminHandlers registers handlers that are used by operators to inspect and manage carbonapi
+func InitAdminHandlers(r *http.ServeMux) {
+	handle := func(path string, h http.HandlerFunc) {
+		r.HandleFunc(config.Config.Prefix+path, adminAuth(h))
+	}
+
+	handle("/admin/topqueries", topQueriesHandler)
+	handle("/admin/topqueries/", topQueriesHandler)
+
+	handle("/admin/reload", reloadHandler)
+	handle("/admin/reload/", reloadHandler)
+
+	handle("/admin/cache", cacheStatsHandler)
+	handle("/admin/cache/", cacheStatsHandler)
+	handle("/admin/cache/lookup", cacheLookupHandler)
+	handle("/admin/cache/lookup/", cacheLookupHandler)
+	handle("/admin/cache/invalidate", cacheInvalidateHandler)
+	handle("/admin/cache/invalidate/", cacheInvalidateHandler)
+
+	handle("/admin/runtime", runtimeHandler)
+	handle("/admin/runtime/", runtimeHandler)
+
+	handle("/admin/index", indexStatusHandler)
+	handle("/admin/index/", indexStatusHandler)
+	handle("/admin/index/cardinality", indexCardinalityHandler)
+	handle("/admin/index/cardinality/", indexCardinalityHandler)
+	handle("/admin/index/dump", indexDumpHandler)
+	handle("/admin/index/dump/", indexDumpHandler)
+	handle("/admin/index/expand", indexExpandHandler)
+	handle("/admin/index/expand/", indexExpandHandler)
+
+	if config.Config.Admin.PProfEnabled {
+		handle("/admin/pprof/", pprofHandler(config.Config.Prefix+"/admin/pprof/"))
+		handle("/admin/pprof/cmdline", pprof.Cmdline)
+		handle("/admin/pprof/profile", pprof.Profile)
+		handle("/admin/pprof/symbol", pprof.Symbol)
+		handle("/admin/pprof/trace", pprof.Trace)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, b, jsonFormat, "")
+}
+
+type cacheStats struct {
+	Type        string  `json:"type"`
+	Items       *int    `json:"items,omitempty"`
+	Size        *uint64 `json:"size,omitempty"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	IndexedKeys int     `json:"indexed_keys"`
+}
+
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := cacheStats{
+		Type:        config.Config.Cache.Type,
+		Hits:        ApiMetrics.RequestCacheHits.Value(),
+		Misses:      ApiMetrics.RequestCacheMisses.Value(),
+		IndexedKeys: queryCacheIndex.Len(),
+	}
+	if c, ok := config.Config.QueryCache.(interface {
+		Items() int
+		Size() uint64
+	}); ok {
+		items, size := c.Items(), c.Size()
+		stats.Items = &items
+		stats.Size = &size
+	}
+
+	writeJSON(w, stats)
+}
+
+// cacheLookupHandler accepts the same parameters and backend selection header as /render and reports if response
+// for them is cached.
+// Optional 'tenant' parameter specifies cache namespace
+func cacheLookupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(r.Form["target"]) == 0 {
+		http.Error(w, "no target specified", http.StatusBadRequest)
+		return
+	}
+
+	var tenant *config.TenantConfig
+	if name := r.Form.Get("tenant"); name != "" {
+		tenant = config.Config.Tenants.Get(name)
+		if tenant == nil {
+			http.Error(w, "unknown tenant", http.StatusBadRequest)
+			return
+		}
+		r.Form.Del("tenant")
+	}
+
+	group, ok := getBackendGroup(r)
+	if !ok {
+		http.Error(w, "backend group is not allowed", http.StatusBadRequest)
+		return
+	}
+
+	cleanupParams(r)
+	key := renderCacheKey(tenant, group, r.Form)
+	res := struct {
+		Key    string `json:"key"`
+		Cached bool   `json:"cached"`
+		Size   int    `json:"size"`
+	}{Key: key}
+
+	response, err := config.Config.QueryCache.Get(key)
+	switch err {
+	case nil:
+		res.Cached = true
+		res.Size = len(response)
+	case cache.ErrNotFound:
+	default:
+		http.Error(w, "cache lookup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// cacheInvalidateHandler removes cached render responses for all targets or metrics that match glob pattern
+func cacheInvalidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	pattern := r.FormValue("target")
+	if pattern == "" {
+		http.Error(w, "no target specified", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := queryCacheIndex.Match(pattern, timeNow())
+	if err != nil {
+		http.Error(w, "invalid target pattern: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, k := range keys {
+		config.Config.QueryCache.Delete(k)
+	}
+
+	writeJSON(w, map[string]int{"invalidated": len(keys)})
+}
+
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if ConfigReloader == nil {
+		http.Error(w, "config reload is not supported", http.StatusNotFound)
+		return
+	}
+
+	changes, err := ConfigReloader()
+	if err != nil {
+		http.Error(w, "config reload failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if changes == nil {
+		changes = []string{}
+	}
+
+	b, err := json.Marshal(map[string][]string{"changes": changes})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, b, jsonFormat, "")
+}
+
+func topQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	if topQueriesTracker == nil {
+		http.Error(w, "top queries tracking is disabled", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		b, err := json.Marshal(topQueriesTracker.Top(r.FormValue("sort"), timeNow()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, b, jsonFormat, "")
+	case http.MethodDelete, http.MethodPost:
+		topQueriesTracker.Reset()
+		w.Write([]byte("Ok\n"))
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// adminMetricIndex returns metric index of the tenant from optional 'tenant' parameter, error is written to w if there
+// is no such index
+func adminMetricIndex(w http.ResponseWriter, r *http.Request) (*metricIndex, bool) {
+	var tenant *config.TenantConfig
+	if name := r.FormValue("tenant"); name != "" {
+		tenant = config.Config.Tenants.Get(name)
+		if tenant == nil {
+			http.Error(w, "unknown tenant", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	index := getMetricIndex(tenant)
+	if index == nil {
+		http.Error(w, "metric index is disabled", http.StatusNotFound)
+		return nil, false
+	}
+	return index, true
+}
+
+func indexNotReady(w http.ResponseWriter) {
+	http.Error(w, "metric index is not ready", http.StatusServiceUnavailable)
+}
+
+func indexStatusHandler(w http.ResponseWriter, r *http.Request) {
+	index, ok := adminMetricIndex(w, r)
+	if !ok {
+		return
+	}
+	ready, metrics := index.Status()
+	writeJSON(w, struct {
+		Ready   bool `json:"ready"`
+		Metrics int  `json:"metrics"`
+	}{ready, metrics})
+}
+
+// indexCardinalityHandler reports amount of metrics under each node that matches 'query' glob, top-level nodes by
+// default
+func indexCardinalityHandler(w http.ResponseWriter, r *http.Request) {
+	index, ok := adminMetricIndex(w, r)
+	if !ok {
+		return
+	}
+	query := r.FormValue("query")
+	if query == "" {
+		query = "*"
+	}
+
+	prefixes, ok := index.Cardinality(query)
+	if !ok {
+		indexNotReady(w)
+		return
+	}
+	total := 0
+	for _, p := range prefixes {
+		total += p.Metrics
+	}
+	writeJSON(w, struct {
+		Query    string              `json:"query"`
+		Metrics  int                 `json:"metrics"`
+		Prefixes []prefixCardinality `json:"prefixes"`
+	}{query, total, prefixes})
+}
+
+// indexDumpHandler writes names of all metrics of the index, or only ones under nodes that match 'query' glob, one
+// per line
+func indexDumpHandler(w http.ResponseWriter, r *http.Request) {
+	index, ok := adminMetricIndex(w, r)
+	if !ok {
+		return
+	}
+
+	// index could be big, so it's streamed, Dump writes nothing if index is not ready
+	w.Header().Set("Content-Type", contentTypeRaw)
+	if ok, _ := index.Dump(w, r.FormValue("query")); !ok {
+		indexNotReady(w)
+	}
+}
+
+// indexExpandHandler expands all 'query' globs in one call, large lists could be sent as POST form
+func indexExpandHandler(w http.ResponseWriter, r *http.Request) {
+	index, ok := adminMetricIndex(w, r)
+	if !ok {
+		return
+	}
+	queries := r.Form["query"]
+	if len(queries) == 0 {
+		http.Error(w, "no query specified", http.StatusBadRequest)
+		return
+	}
+
+	res := make(map[string][]string, len(queries))
+	for _, q := range queries {
+		names, ok := index.leaves(q)
+		if !ok {
+			indexNotReady(w)
+			return
+		}
+		res[q] = names
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheAdminHandlers(t *testing.T) {
+	oldCache := config.Config.QueryCache
+	config.Config.QueryCache = cache.NewExpireCache(1024 * 1024)
+	queryCacheIndex = newCacheIndex(0)
+	defer func() { config.Config.QueryCache = oldCache }()
+
+	const query = "target=foo.bar&from=-10minutes&format=json"
+	req, rr := setUpRequest(t, "/render/?"+query)
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, rr = setUpRequest(t, "/admin/cache")
+	cacheStatsHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var stats cacheStats
+	err := json.Unmarshal(rr.Body.Bytes(), &stats)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.IndexedKeys)
+	if assert.NotNil(t, stats.Items) {
+		assert.Equal(t, 1, *stats.Items)
+	}
+
+	lookup := func() bool {
+		req, rr := setUpRequest(t, "/admin/cache/lookup?"+query+"&_salt=123")
+		cacheLookupHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var res struct {
+			Cached bool `json:"cached"`
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &res)
+		assert.NoError(t, err)
+		return res.Cached
+	}
+	assert.True(t, lookup())
+
+	req, rr = setUpRequest(t, "/admin/cache/invalidate?target=foo.bar")
+	cacheInvalidateHandler(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	for _, tc := range []struct {
+		pattern     string
+		code        int
+		invalidated int
+	}{
+		{"[", http.StatusBadRequest, 0},
+		{"baz.*", http.StatusOK, 0},
+		{"foo.*", http.StatusOK, 1},
+	} {
+		rr = serveRequest(cacheInvalidateHandler, "POST", "/admin/cache/invalidate?target="+tc.pattern, "", "")
+		assert.Equal(t, tc.code, rr.Code, tc.pattern)
+		if tc.code == http.StatusOK {
+			assert.Equal(t, fmt.Sprintf("{\"invalidated\":%d}", tc.invalidated), rr.Body.String(), tc.pattern)
+		}
+	}
+
+	assert.False(t, lookup())
+	assert.Equal(t, 0, queryCacheIndex.Len())
+}
+
+func TestReloadHandler(t *testing.T) {
+	defer func() { ConfigReloader = nil }()
+
+	req, rr := setUpRequest(t, "/admin/reload")
+	reloadHandler(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	ConfigReloader = func() ([]string, error) { return []string{"concurency"}, nil }
+	rr = serveRequest(reloadHandler, "POST", "/admin/reload", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"changes":["concurency"]}`, rr.Body.String())
+
+	ConfigReloader = func() ([]string, error) { return nil, fmt.Errorf("no backends specified") }
+	rr = serveRequest(reloadHandler, "POST", "/admin/reload", "", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "no backends specified")
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+)
+
+// requester is an authenticated client, that changes objects shared between clients (saved queries, dashboards,
+// export jobs)
+type requester struct {
+	// owner is a name of the tenant, objects created by admin have no owner
+	owner string
+	admin bool
+}
+
+// isAdmin checks if request has admin token. There is no admin if the token isn't configured
+func isAdmin(r *http.Request) bool {
+	token := config.Current().Admin.Token
+	return token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// authenticate identifies client by admin token or by API key of its tenant, that is checked by TenantHandler.
+// Anonymous clients and tenants without API keys aren't authenticated
+func authenticate(r *http.Request) (requester, bool) {
+	if isAdmin(r) {
+		return requester{admin: true}, true
+	}
+	if t := getTenant(r.Context()); t != nil && len(t.APIKeys) > 0 {
+		return requester{owner: t.Name}, true
+	}
+	return requester{}, false
+}
+
+// requireAuth authenticates client, 401 Unauthorized is returned to clients that aren't authenticated
+func requireAuth(w http.ResponseWriter, r *http.Request) (requester, bool) {
+	u, ok := authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized)+": API key of tenant or admin token is required", http.StatusUnauthorized)
+	}
+	return u, ok
+}
+
+// canModify checks if requester could change or remove object of the owner. Admin could change all objects, objects
+// without owner could be changed only by admin
+func (u requester) canModify(owner string) bool {
+	return u.admin || (owner != "" && owner == u.owner)
+}
+
+// ownerName is used in errors, objects without owner belong to admin
+func ownerName(owner string) string {
+	if owner == "" {
+		return "admin"
+	}
+	return owner
+}
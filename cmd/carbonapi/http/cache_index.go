@@ -0,0 +1,161 @@
+package http
+
+import (
+	"container/heap"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheIndexSize limits memory used by cache index if query cache size isn't limited
+const defaultCacheIndexSize = 16 * 1024 * 1024
+
+// cacheIndexEntry describes render response that was put to query cache
+type cacheIndexEntry struct {
+	key       string
+	targets   []string
+	metrics   []string
+	expiresAt time.Time
+	size      int
+	// pos is a position of the entry in the expiration heap
+	pos int
+}
+
+// cacheIndexHeap orders entries by expiration time
+type cacheIndexHeap []*cacheIndexEntry
+
+func (h cacheIndexHeap) Len() int           { return len(h) }
+func (h cacheIndexHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h cacheIndexHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *cacheIndexHeap) Push(x interface{}) {
+	e := x.(*cacheIndexEntry)
+	e.pos = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *cacheIndexHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// cacheIndex keeps track of query cache keys and targets they were created for, so cached responses can be found
+// and invalidated by target. Caches only store hashes of the keys, so it's not possible to get them from the cache.
+// Expired entries are removed on each change. Approximate size of the index is limited by maxSize, if it's exceeded,
+// entries that expire first are dropped and their responses can't be invalidated anymore.
+type cacheIndex struct {
+	sync.Mutex
+	entries map[string]*cacheIndexEntry
+	expire  cacheIndexHeap
+	size    int
+	maxSize int
+}
+
+var queryCacheIndex = newCacheIndex(defaultCacheIndexSize)
+
+func newCacheIndex(maxSize int) *cacheIndex {
+	if maxSize <= 0 {
+		maxSize = defaultCacheIndexSize
+	}
+	return &cacheIndex{
+		entries: make(map[string]*cacheIndexEntry),
+		maxSize: maxSize,
+	}
+}
+
+func cacheIndexEntrySize(key string, targets, metrics []string) int {
+	size := len(key)
+	for _, s := range targets {
+		size += len(s)
+	}
+	for _, s := range metrics {
+		size += len(s)
+	}
+	return size
+}
+
+func (c *cacheIndex) Add(key string, targets, metrics []string, timeout int32, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	e := &cacheIndexEntry{
+		key:       key,
+		targets:   targets,
+		metrics:   metrics,
+		expiresAt: now.Add(time.Duration(timeout) * time.Second),
+		size:      cacheIndexEntrySize(key, targets, metrics),
+	}
+	c.entries[key] = e
+	heap.Push(&c.expire, e)
+	c.size += e.size
+
+	c.prune(now)
+	for c.size > c.maxSize && len(c.expire) > 0 {
+		c.remove(c.expire[0])
+	}
+}
+
+// prune removes expired entries
+func (c *cacheIndex) prune(now time.Time) {
+	for len(c.expire) > 0 && now.After(c.expire[0].expiresAt) {
+		c.remove(c.expire[0])
+	}
+}
+
+func (c *cacheIndex) remove(e *cacheIndexEntry) {
+	heap.Remove(&c.expire, e.pos)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+// Match returns keys for all entries that have target or metric that matches graphite glob pattern and removes them
+// from the index
+func (c *cacheIndex) Match(pattern string, now time.Time) ([]string, error) {
+	// check pattern syntax once, so errors won't be hidden by absence of entries
+	for _, alt := range expandBraces(pattern) {
+		if _, err := path.Match(alt, ""); err != nil {
+			return nil, err
+		}
+	}
+	parts := strings.Split(pattern, ".")
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.prune(now)
+	var keys []string
+	for k, e := range c.entries {
+		if matchAny(parts, e.targets) || matchAny(parts, e.metrics) {
+			keys = append(keys, k)
+			c.remove(e)
+		}
+	}
+	return keys, nil
+}
+
+func (c *cacheIndex) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	c.prune(timeNow())
+	return len(c.entries)
+}
+
+func matchAny(parts []string, names []string) bool {
+	for _, name := range names {
+		if matchGlob(parts, name) {
+			return true
+		}
+	}
+	return false
+}
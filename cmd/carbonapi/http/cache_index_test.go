@@ -0,0 +1,52 @@
+package http
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCacheIndex(t *testing.T) {
+	now := time.Unix(1510913759, 0)
+	c := newCacheIndex(100)
+
+	c.Add("k1", []string{"sum(a.b.*)"}, []string{"a.b.c"}, 60, now)
+	c.Add("k2", []string{"a.bb.c"}, []string{"a.bb.c"}, 120, now)
+	c.Add("k3", []string{"x.y"}, []string{"x.y"}, 10, now)
+
+	// expired entries are pruned on change
+	c.Add("k4", []string{"x.z"}, []string{"x.z"}, 60, now.Add(30*time.Second))
+	if _, ok := c.entries["k3"]; ok {
+		t.Errorf("expired entry is not pruned")
+	}
+
+	keys, err := c.Match("a.{b,bb}.c", now.Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "k1" || keys[1] != "k2" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	// glob doesn't match across nodes
+	if keys, _ = c.Match("x*", now.Add(30*time.Second)); len(keys) != 0 {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if _, err = c.Match("a.{b,[}", now); err == nil {
+		t.Errorf("expected error for invalid pattern")
+	}
+
+	// entries that expire first are dropped, if index exceeds its size
+	for i := 0; i < 20; i++ {
+		c.Add(string(rune('a'+i))+"-key", []string{"a.b"}, []string{"a.b"}, int32(100+i), now)
+	}
+	if c.size > c.maxSize {
+		t.Errorf("index size %d exceeds limit %d", c.size, c.maxSize)
+	}
+	if _, ok := c.entries["t-key"]; !ok {
+		t.Errorf("entry that expires last is dropped")
+	}
+	if _, ok := c.entries["a-key"]; ok {
+		t.Errorf("entry that expires first is kept")
+	}
+}
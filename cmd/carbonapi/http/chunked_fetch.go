@@ -0,0 +1,323 @@
+package http
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/interfaces"
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// chunkedFetcher splits fetch of long time ranges (e.x. a year of minutely points) into sequential requests of
+// shorter chunks, so neither backends nor carbonapi hold all raw points of the range at once. Series are stitched
+// from chunks as they arrive and, if maxPoints is set, consolidated on the fly
+type chunkedFetcher struct {
+	minRange  int64
+	chunk     int64
+	maxPoints int
+}
+
+var chunkedFetch *chunkedFetcher
+
+func initChunkedFetch(cfg config.ChunkedFetchConfig) {
+	if cfg.MinRange <= 0 || cfg.ChunkSize < time.Second {
+		chunkedFetch = nil
+		return
+	}
+	chunkedFetch = &chunkedFetcher{
+		minRange:  int64(cfg.MinRange.Seconds()),
+		chunk:     int64(cfg.ChunkSize.Seconds()),
+		maxPoints: cfg.MaxPoints,
+	}
+}
+
+// chunkedZipper fetches long requests by chunks, other requests are passed to the zipper as is
+type chunkedZipper struct {
+	interfaces.CarbonZipper
+	c *chunkedFetcher
+}
+
+// wrap returns zipper, that fetches long requests by chunks
+func (c *chunkedFetcher) wrap(zipper interfaces.CarbonZipper) interfaces.CarbonZipper {
+	return &chunkedZipper{CarbonZipper: zipper, c: c}
+}
+
+// chunkedResults collects results of several zipper requests. Absence of metrics in some of them isn't an error
+type chunkedResults struct {
+	series   []*types.MetricData
+	stats    *zipperTypes.Stats
+	err      error
+	notFound error
+}
+
+func (r *chunkedResults) add(series []*types.MetricData, stats *zipperTypes.Stats, err error) {
+	r.series = append(r.series, series...)
+	if r.stats == nil {
+		r.stats = stats
+	} else if stats != nil {
+		r.stats.Merge(stats)
+	}
+	switch {
+	case err == zipperTypes.ErrNotFound || err == zipperTypes.ErrNoMetricsFetched:
+		r.notFound = err
+	case err != nil && r.err == nil:
+		r.err = err
+	}
+}
+
+func (r *chunkedResults) result() ([]*types.MetricData, *zipperTypes.Stats, error) {
+	if len(r.series) == 0 && r.err == nil {
+		return nil, r.stats, r.notFound
+	}
+	return r.series, r.stats, r.err
+}
+
+// Render fetches requests, that are longer than minRange, by chunks. Requests with filtering functions, that select
+// series by values of the whole range, are fetched as usual
+func (z *chunkedZipper) Render(ctx context.Context, req pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	var long []pb.FetchRequest
+	var short pb.MultiFetchRequest
+	for _, m := range req.Metrics {
+		if m.StopTime-m.StartTime > z.c.minRange && len(m.FilterFunctions) == 0 {
+			long = append(long, m)
+		} else {
+			short.Metrics = append(short.Metrics, m)
+		}
+	}
+	if len(long) == 0 {
+		return z.CarbonZipper.Render(ctx, req)
+	}
+
+	var res chunkedResults
+	if len(short.Metrics) > 0 {
+		res.add(z.CarbonZipper.Render(ctx, short))
+	}
+	z.renderChunks(ctx, long, &res)
+	return res.result()
+}
+
+// chunkKey identifies a series of a request
+type chunkKey struct {
+	request int
+	name    string
+}
+
+// renderChunks fetches chunks of all requests one by one, starting from the oldest ones
+func (z *chunkedZipper) renderChunks(ctx context.Context, requests []pb.FetchRequest, res *chunkedResults) {
+	accumulators := make(map[chunkKey]*chunkAccumulator)
+	var order []*chunkAccumulator
+	// series are consolidated to the step of the whole range, so chunks fetched from finer archives aren't rebucketed
+	now := timeNow().Unix()
+	predicted := make([]int64, len(requests))
+	for i, m := range requests {
+		predicted[i], _ = predictStep(m.PathExpression, m.StartTime, now)
+	}
+
+	for offset := int64(0); ; offset += z.c.chunk {
+		var chunk pb.MultiFetchRequest
+		// requests are found by path expression and start time of the chunk
+		requestIdx := make(map[string]map[int64]int)
+		for i, m := range requests {
+			from := m.StartTime + offset
+			if from >= m.StopTime {
+				continue
+			}
+			m.StartTime = from
+			if until := from + z.c.chunk; until < m.StopTime {
+				m.StopTime = until
+			}
+			chunk.Metrics = append(chunk.Metrics, m)
+			if requestIdx[m.PathExpression] == nil {
+				requestIdx[m.PathExpression] = make(map[int64]int)
+			}
+			requestIdx[m.PathExpression][from] = i
+		}
+		if len(chunk.Metrics) == 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			res.add(nil, nil, err)
+			break
+		}
+
+		ApiMetrics.ChunkedFetchRequests.Add(1)
+		r, stats, err := z.CarbonZipper.Render(ctx, chunk)
+		res.add(nil, stats, err)
+		for _, s := range r {
+			i, ok := requestIdx[s.PathExpression][s.RequestStartTime]
+			if !ok {
+				// response doesn't contain request times, the first request of the path expression is used
+				i, ok = z.firstRequest(requests, s.PathExpression)
+				if !ok {
+					continue
+				}
+			}
+			key := chunkKey{request: i, name: s.Name}
+			acc, ok := accumulators[key]
+			if !ok {
+				acc = newChunkAccumulator(s, requests[i], z.c.maxPoints, predicted[i])
+				accumulators[key] = acc
+				order = append(order, acc)
+			}
+			acc.add(s)
+		}
+	}
+
+	for _, acc := range order {
+		res.series = append(res.series, acc.finish())
+	}
+}
+
+func (z *chunkedZipper) firstRequest(requests []pb.FetchRequest, pathExpression string) (int, bool) {
+	for i, m := range requests {
+		if m.PathExpression == pathExpression {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// chunkAccumulator stitches points of a series fetched by chunks. Points are consolidated to step, that could be
+// greater than step of fetched points, points of the last incomplete step are kept until the next chunk arrives.
+// Points of chunks that overlap the previous ones are skipped
+type chunkAccumulator struct {
+	series    *types.MetricData
+	request   pb.FetchRequest
+	step      int64
+	rawStep   int64
+	aggregate func([]float64) float64
+	values    []float64
+	// bucket contains points of the last step, that starts at bucketStart
+	bucket      []float64
+	bucketStart int64
+	// last is the timestamp of the last added point
+	last int64
+}
+
+// newChunkAccumulator creates accumulator of the series fetched by request m. Step of the series is increased to
+// predicted step of the whole range, if it's known, and so the whole range contains at most maxPoints points, if
+// maxPoints isn't 0
+func newChunkAccumulator(s *types.MetricData, m pb.FetchRequest, maxPoints int, predicted int64) *chunkAccumulator {
+	rawStep := s.StepTime
+	if rawStep <= 0 {
+		rawStep = 1
+	}
+	step := rawStep
+	if predicted > step && predicted%step == 0 {
+		step = predicted
+	}
+	if points := (m.StopTime - m.StartTime) / step; maxPoints > 0 && points > int64(maxPoints) {
+		step *= (points + int64(maxPoints) - 1) / int64(maxPoints)
+	}
+	aggregate, ok := consolidations.ConsolidationFunc(s.ConsolidationFunc)
+	if !ok {
+		aggregate = consolidations.AggMean
+	}
+
+	series := s.CopyLink()
+	series.Values = nil
+	series.RequestStartTime = m.StartTime
+	series.RequestStopTime = m.StopTime
+	// points with timestamps in (from, until] are returned
+	first := m.StartTime - m.StartTime%rawStep + rawStep
+	series.StartTime = first - first%step
+	return &chunkAccumulator{
+		series:      series,
+		request:     m,
+		step:        step,
+		rawStep:     rawStep,
+		aggregate:   aggregate,
+		bucketStart: series.StartTime,
+		last:        m.StartTime,
+	}
+}
+
+// add appends points of the next chunk
+func (a *chunkAccumulator) add(s *types.MetricData) {
+	if s.StepTime <= 0 {
+		return
+	}
+	if a.step%s.StepTime != 0 {
+		// steps of chunks differ (e.x. they are fetched from different archives)
+		a.rebucket(lcm(a.step, s.StepTime))
+	}
+	a.rawStep = s.StepTime
+	for i, v := range s.Values {
+		t := s.StartTime + int64(i)*s.StepTime
+		if t <= a.last {
+			continue
+		}
+		a.last = t
+		if b := t - t%a.step; b != a.bucketStart {
+			a.advance(b)
+		}
+		a.bucket = append(a.bucket, v)
+	}
+}
+
+// advance completes the current step and fills steps without points until b
+func (a *chunkAccumulator) advance(b int64) {
+	switch {
+	case len(a.bucket) == 0:
+		a.values = append(a.values, math.NaN())
+	case a.step == a.rawStep:
+		a.values = append(a.values, a.bucket[0])
+	default:
+		a.values = append(a.values, a.aggregate(a.bucket))
+	}
+	a.bucket = a.bucket[:0]
+	for a.bucketStart += a.step; a.bucketStart < b; a.bucketStart += a.step {
+		a.values = append(a.values, math.NaN())
+	}
+}
+
+// rebucket consolidates accumulated values to a greater step
+func (a *chunkAccumulator) rebucket(step int64) {
+	// points of the current step are consolidated first
+	a.advance(a.bucketStart + a.step)
+	values, start, oldStep := a.values, a.series.StartTime, a.step
+
+	a.series.StartTime = start - start%step
+	a.values = make([]float64, 0, len(values)/int(step/oldStep)+1)
+	a.bucketStart = a.series.StartTime
+	a.step, a.rawStep = step, oldStep
+	for i, v := range values {
+		t := start + int64(i)*oldStep
+		if b := t - t%step; b != a.bucketStart {
+			a.advance(b)
+		}
+		a.bucket = append(a.bucket, v)
+	}
+}
+
+// finish returns stitched series, steps without points are filled up to the end of the request
+func (a *chunkAccumulator) finish() *types.MetricData {
+	until := a.request.StopTime - a.request.StopTime%a.step
+	if until < a.bucketStart {
+		until = a.bucketStart
+	}
+	a.advance(until + a.step)
+
+	s := a.series
+	s.Values = a.values
+	s.StepTime = a.step
+	s.StopTime = s.StartTime + int64(len(s.Values))*s.StepTime
+	return s
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b int64) int64 {
+	return a / gcd(a, b) * b
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedFetch(t *testing.T) {
+	z := &incrementalMockZipper{}
+	defer useZipper(z)()
+	origCache := config.Config.QueryCache
+	config.Config.QueryCache = cache.NullCache{}
+	defer func() {
+		config.Config.QueryCache = origCache
+		initChunkedFetch(config.ChunkedFetchConfig{})
+	}()
+
+	const until = int64(1510913400)
+	const from = until - 4*3600
+	render := func() [][2]float64 {
+		req, rr := setUpRequest(t, fmt.Sprintf("/render/?format=json&target=foo.bar&target=foo.baz&from=%d&until=%d", from, until))
+		renderHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var series []struct {
+			Target     string       `json:"target"`
+			Datapoints [][2]float64 `json:"datapoints"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &series))
+		if !assert.Len(t, series, 2) {
+			return nil
+		}
+		assert.Equal(t, "foo.bar", series[0].Target)
+		assert.Equal(t, series[0].Datapoints, series[1].Datapoints)
+		return series[0].Datapoints
+	}
+
+	// the same points are returned, but each request contains an hour
+	initChunkedFetch(config.ChunkedFetchConfig{MinRange: 2 * time.Hour, ChunkSize: time.Hour})
+	points := render()
+	if assert.Len(t, points, 240) {
+		for i, p := range points {
+			ts := from + 60 + int64(i)*60
+			assert.Equal(t, [2]float64{float64(ts / 60), float64(ts)}, p)
+		}
+	}
+	if assert.Len(t, z.requests, 4) {
+		for i, r := range z.requests {
+			if assert.Len(t, r.Metrics, 2) {
+				assert.Equal(t, from+int64(i)*3600, r.Metrics[0].StartTime)
+				assert.Equal(t, from+int64(i+1)*3600, r.Metrics[0].StopTime)
+			}
+		}
+	}
+
+	// points are consolidated by average as chunks arrive
+	initChunkedFetch(config.ChunkedFetchConfig{MinRange: 2 * time.Hour, ChunkSize: time.Hour, MaxPoints: 24})
+	points = render()
+	if assert.Len(t, points, 25) {
+		assert.Equal(t, [2]float64{float64(from/60 + 5), float64(from)}, points[0])
+		assert.Equal(t, [2]float64{float64(from/60) + 14.5, float64(from + 600)}, points[1])
+		assert.Equal(t, [2]float64{float64(until / 60), float64(until)}, points[24])
+	}
+
+	// short requests aren't split
+	z.requests = nil
+	req, rr := setUpRequest(t, fmt.Sprintf("/render/?format=json&target=foo.bar&from=%d&until=%d", until-3600, until))
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, z.requests, 1)
+}
@@ -0,0 +1,364 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+// dashboard is a graphite-web dashboard. State is a JSON document of the dashboard UI, that is stored as is
+type dashboard struct {
+	// Owner is a name of the tenant, dashboards saved by admin have no owner
+	Owner string          `json:"owner,omitempty"`
+	State json.RawMessage `json:"state"`
+}
+
+// dashboardStore keeps graphite-web dashboards
+type dashboardStore interface {
+	// Load returns the dashboard, false if it doesn't exist
+	Load(name string) (*dashboard, bool, error)
+	// Save creates or replaces the dashboard
+	Save(name string, d *dashboard) error
+	// Delete removes the dashboard, false is returned if it doesn't exist
+	Delete(name string) (bool, error)
+	// Names returns names of all dashboards
+	Names() ([]string, error)
+}
+
+// dashboards is nil if dashboard API is disabled
+var dashboards dashboardStore
+
+// dashboardsLock serializes changes of dashboards, so owner of the dashboard doesn't change between its check and
+// the change
+var dashboardsLock sync.Mutex
+
+func initDashboards(cfg config.DashboardsConfig) {
+	s, err := newDashboardStore(cfg)
+	if err != nil {
+		zapwriter.Logger("dashboards").Fatal("failed to init dashboard store",
+			zap.String("type", cfg.Type),
+			zap.Error(err),
+		)
+	}
+	dashboards = s
+}
+
+func newDashboardStore(cfg config.DashboardsConfig) (dashboardStore, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case "file":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("path of dashboards file isn't specified")
+		}
+		s, err := loadFileDashboardStore(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "dir":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("path of dashboards directory isn't specified")
+		}
+		if err := os.MkdirAll(cfg.Path, 0755); err != nil {
+			return nil, err
+		}
+		return &dirDashboardStore{dir: cfg.Path}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dashboard store type '%s', supported: file, dir", cfg.Type)
+	}
+}
+
+// fileDashboardStore keeps dashboards in memory and writes all of them to the file on each change
+type fileDashboardStore struct {
+	sync.RWMutex
+	path       string
+	dashboards map[string]*dashboard
+}
+
+// loadFileDashboardStore reads dashboards from the file, missing file is an empty store
+func loadFileDashboardStore(path string) (*fileDashboardStore, error) {
+	s := &fileDashboardStore{path: path, dashboards: make(map[string]*dashboard)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.dashboards); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileDashboardStore) Load(name string) (*dashboard, bool, error) {
+	s.RLock()
+	defer s.RUnlock()
+	d, ok := s.dashboards[name]
+	return d, ok, nil
+}
+
+func (s *fileDashboardStore) Save(name string, d *dashboard) error {
+	s.Lock()
+	defer s.Unlock()
+	old, ok := s.dashboards[name]
+	s.dashboards[name] = d
+	if err := s.save(); err != nil {
+		if ok {
+			s.dashboards[name] = old
+		} else {
+			delete(s.dashboards, name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *fileDashboardStore) Delete(name string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	old, ok := s.dashboards[name]
+	if !ok {
+		return false, nil
+	}
+	delete(s.dashboards, name)
+	if err := s.save(); err != nil {
+		s.dashboards[name] = old
+		return true, err
+	}
+	return true, nil
+}
+
+func (s *fileDashboardStore) Names() ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+	names := make([]string, 0, len(s.dashboards))
+	for name := range s.dashboards {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// save writes all dashboards to the file. Must be called under the write lock
+func (s *fileDashboardStore) save() error {
+	// keys of maps are sorted by encoding/json
+	b, err := json.MarshalIndent(s.dashboards, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b)
+}
+
+// dirDashboardStore keeps each dashboard in its own JSON file in the directory. Dashboards aren't cached, so the
+// directory could be shared by several carbonapi instances
+type dirDashboardStore struct {
+	dir string
+}
+
+// dashboardFileExt is appended to escaped names of dashboards, so names like ".." can't refer to other files
+const dashboardFileExt = ".json"
+
+func (s *dirDashboardStore) path(name string) string {
+	return filepath.Join(s.dir, url.PathEscape(name)+dashboardFileExt)
+}
+
+func (s *dirDashboardStore) Load(name string) (*dashboard, bool, error) {
+	b, err := ioutil.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var d dashboard
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, false, fmt.Errorf("dashboard '%s' is corrupted: %v", name, err)
+	}
+	return &d, true, nil
+}
+
+func (s *dirDashboardStore) Save(name string, d *dashboard) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(name), b)
+}
+
+func (s *dirDashboardStore) Delete(name string) (bool, error) {
+	err := os.Remove(s.path(name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *dirDashboardStore) Names() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		// temporary files of writeFileAtomic have other extension
+		if f.IsDir() || !strings.HasSuffix(f.Name(), dashboardFileExt) {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(f.Name(), dashboardFileExt))
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// dashboardHandler serves graphite-web's dashboard API, responses are the same as graphite-web's ones:
+//
+//	/dashboard/load/<name>             {"state": {...}}
+//	/dashboard/save/<name>  (state)    {"success": true}
+//	/dashboard/delete/<name>           {"success": true}
+//	/dashboard/find/?query=<words>     {"dashboards": [{"name": "..."}]}
+//
+// Errors are returned as {"error": "..."} with 200 OK, like graphite-web does. Save and delete change shared state,
+// so they are allowed only by POST of authenticated clients, dashboards could be changed by their owners and admin
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if dashboards == nil {
+		http.Error(w, "dashboards are disabled", http.StatusNotFound)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, config.Config.Prefix+"/dashboard"), "/")
+	action, name := path, ""
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		action, name = path[:i], path[i+1:]
+	}
+
+	var resp interface{}
+	var err error
+	switch action {
+	case "load":
+		resp, err = loadDashboard(name)
+	case "save", "delete":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		u, ok := requireAuth(w, r)
+		if !ok {
+			return
+		}
+		dashboardsLock.Lock()
+		defer dashboardsLock.Unlock()
+		owner, code, ownerErr := dashboardOwner(name, u)
+		if ownerErr != nil {
+			http.Error(w, ownerErr.Error(), code)
+			return
+		}
+		if action == "save" {
+			resp, err = saveDashboard(name, r.PostFormValue("state"), owner)
+		} else {
+			resp, err = deleteDashboard(name)
+		}
+	case "find":
+		resp, err = findDashboards(r.FormValue("query"))
+	default:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		resp = map[string]string{"error": err.Error()}
+	}
+	writeJSON(w, resp)
+}
+
+func loadDashboard(name string) (interface{}, error) {
+	d, ok, err := dashboards.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("Dashboard '%s' does not exist. ", name)
+	}
+	return map[string]json.RawMessage{"state": d.State}, nil
+}
+
+// dashboardOwner returns owner of the dashboard changed by the requester: the current owner is kept, new dashboards
+// are owned by the requester. Dashboards of other owners can't be changed. Must be called under dashboardsLock
+func dashboardOwner(name string, u requester) (string, int, error) {
+	d, ok, err := dashboards.Load(name)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if !ok {
+		return u.owner, http.StatusOK, nil
+	}
+	if !u.canModify(d.Owner) {
+		return "", http.StatusForbidden, fmt.Errorf("dashboard '%s' is owned by %s", name, ownerName(d.Owner))
+	}
+	return d.Owner, http.StatusOK, nil
+}
+
+func saveDashboard(name, state, owner string) (interface{}, error) {
+	if name == "" {
+		return nil, fmt.Errorf("dashboard name is empty")
+	}
+	if !json.Valid([]byte(state)) {
+		return nil, fmt.Errorf("state of dashboard '%s' is not a valid JSON", name)
+	}
+	if err := dashboards.Save(name, &dashboard{Owner: owner, State: json.RawMessage(state)}); err != nil {
+		return nil, err
+	}
+	return map[string]bool{"success": true}, nil
+}
+
+func deleteDashboard(name string) (interface{}, error) {
+	ok, err := dashboards.Delete(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("Dashboard '%s' does not exist. ", name)
+	}
+	return map[string]bool{"success": true}, nil
+}
+
+// findDashboards returns dashboards, that contain all words of the query in their names, case-insensitive
+func findDashboards(query string) (interface{}, error) {
+	names, err := dashboards.Names()
+	if err != nil {
+		return nil, err
+	}
+	words := strings.Fields(strings.ToLower(query))
+	type dashboard struct {
+		Name string `json:"name"`
+	}
+	found := make([]dashboard, 0)
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		matched := true
+		for _, word := range words {
+			if !strings.Contains(lower, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			found = append(found, dashboard{Name: name})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return map[string]interface{}{"dashboards": found}, nil
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboards(t *testing.T) {
+	dir, cleanup := tempDir(t, "carbonapi-dashboards")
+	defer cleanup()
+	defer initDashboards(config.DashboardsConfig{})
+	defer useAdminToken()()
+
+	_, err := newDashboardStore(config.DashboardsConfig{Type: "s3"})
+	assert.Error(t, err)
+
+	for _, cfg := range []config.DashboardsConfig{
+		{Type: "file", Path: filepath.Join(dir, "dashboards.json")},
+		{Type: "dir", Path: filepath.Join(dir, "dashboards")},
+	} {
+		initDashboards(cfg)
+
+		serve := func(method, path, user string, form url.Values) *httptest.ResponseRecorder {
+			req := newUserRequest(method, path, user, form.Encode())
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			dashboardHandler(rr, req)
+			return rr
+		}
+		request := func(method, path, user string, form url.Values) string {
+			rr := serve(method, path, user, form)
+			assert.Equal(t, http.StatusOK, rr.Code, cfg.Type)
+			return rr.Body.String()
+		}
+
+		state := `{"name":"Web Servers","graphs":[["target=foo.bar",{"target":["foo.bar"]},"/render?target=foo.bar"]]}`
+		assert.Equal(t, `{"success":true}`, request("POST", "/dashboard/save/Web%20Servers", "alice", url.Values{"state": {state}}))
+		assert.Equal(t, `{"success":true}`, request("POST", "/dashboard/save/db", "alice", url.Values{"state": {`{}`}}))
+		assert.Equal(t, `{"success":true}`, request("POST", "/dashboard/save/..%2Fdb", "admin", url.Values{"state": {`{}`}}))
+		assert.Equal(t, `{"error":"state of dashboard 'db' is not a valid JSON"}`, request("POST", "/dashboard/save/db", "alice", url.Values{"state": {`{`}}))
+
+		assert.Equal(t, `{"state":`+state+`}`, request("GET", "/dashboard/load/Web%20Servers", "", nil))
+		assert.Equal(t, `{"error":"Dashboard 'none' does not exist. "}`, request("GET", "/dashboard/load/none", "", nil))
+
+		assert.Equal(t, `{"dashboards":[{"name":"../db"},{"name":"Web Servers"},{"name":"db"}]}`, request("GET", "/dashboard/find/?query=", "", nil))
+		assert.Equal(t, `{"dashboards":[{"name":"Web Servers"}]}`, request("GET", "/dashboard/find/?query=web+SERV", "", nil))
+		assert.Equal(t, `{"dashboards":[]}`, request("GET", "/dashboard/find/?query=none", "", nil))
+
+		// changes require POST of authenticated clients
+		assert.Equal(t, http.StatusMethodNotAllowed, serve("GET", "/dashboard/save/db?state={}", "alice", nil).Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, serve("GET", "/dashboard/delete/db", "alice", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, serve("POST", "/dashboard/save/new", "", url.Values{"state": {`{}`}}).Code)
+		assert.Equal(t, http.StatusUnauthorized, serve("POST", "/dashboard/delete/db", "anonymous", nil).Code)
+
+		// dashboards of other owners can't be changed, admin could change all of them and the owner is kept
+		assert.Equal(t, http.StatusForbidden, serve("POST", "/dashboard/save/db", "bob", url.Values{"state": {`{}`}}).Code)
+		assert.Equal(t, http.StatusForbidden, serve("POST", "/dashboard/delete/db", "bob", nil).Code)
+		assert.Equal(t, http.StatusForbidden, serve("POST", "/dashboard/delete/..%2Fdb", "alice", nil).Code)
+		assert.Equal(t, `{"success":true}`, request("POST", "/dashboard/save/db", "admin", url.Values{"state": {`{"name":"db"}`}}))
+		assert.Equal(t, `{"success":true}`, request("POST", "/dashboard/delete/..%2Fdb", "admin", nil))
+
+		// dashboards are persisted
+		assert.Equal(t, `{"success":true}`, request("POST", "/dashboard/delete/db", "alice", nil))
+		assert.Equal(t, `{"error":"Dashboard 'db' does not exist. "}`, request("POST", "/dashboard/delete/db", "alice", nil))
+		initDashboards(cfg)
+		assert.Equal(t, `{"dashboards":[{"name":"Web Servers"}]}`, request("GET", "/dashboard/find/", "", nil))
+		assert.Equal(t, `{"state":`+state+`}`, request("GET", "/dashboard/load/Web%20Servers", "", nil))
+		assert.Equal(t, http.StatusForbidden, serve("POST", "/dashboard/delete/Web%20Servers", "bob", nil).Code)
+	}
+}
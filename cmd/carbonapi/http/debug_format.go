@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// fetchedSeries describes series fetched from backends, without values
+type fetchedSeries struct {
+	Name   string `json:"name"`
+	Start  int64  `json:"start"`
+	Stop   int64  `json:"stop"`
+	Step   int64  `json:"step"`
+	Points int    `json:"points"`
+	Nulls  int    `json:"nulls"`
+}
+
+// consumedMetrics is a path expression that is an argument of the function and series fetched for it. Function is
+// empty if target is a bare path expression
+type consumedMetrics struct {
+	Function       string          `json:"function,omitempty"`
+	PathExpression string          `json:"pathExpression"`
+	From           int64           `json:"from"`
+	Until          int64           `json:"until"`
+	Series         []fetchedSeries `json:"series"`
+}
+
+type targetDebug struct {
+	Target   string            `json:"target"`
+	Consumed []consumedMetrics `json:"consumed"`
+}
+
+type targetDebugKey struct{}
+
+func getTargetDebug(ctx context.Context) []targetDebug {
+	d, _ := ctx.Value(targetDebugKey{}).([]targetDebug)
+	return d
+}
+
+func setTargetDebug(ctx context.Context, d []targetDebug) context.Context {
+	return context.WithValue(ctx, targetDebugKey{}, d)
+}
+
+// newTargetDebug lists series that were fetched for path expressions of each function of the target
+func newTargetDebug(target string, exp parser.Expr, from, until int64, metricMap map[parser.MetricRequest][]*types.MetricData) targetDebug {
+	d := targetDebug{Target: target, Consumed: []consumedMetrics{}}
+	// requests of the whole expression have time ranges changed by functions like timeShift
+	requests := exp.Metrics()
+	consume := func(function, pathExpression string) {
+		for _, m := range requests {
+			if m.Metric != pathExpression {
+				continue
+			}
+			m.From += from
+			m.Until += until
+			c := consumedMetrics{
+				Function:       function,
+				PathExpression: m.Metric,
+				From:           m.From,
+				Until:          m.Until,
+				Series:         []fetchedSeries{},
+			}
+			for _, s := range metricMap[m] {
+				c.Series = append(c.Series, newFetchedSeries(s))
+			}
+			d.Consumed = append(d.Consumed, c)
+		}
+	}
+
+	var walk func(e parser.Expr)
+	walk = func(e parser.Expr) {
+		for _, arg := range e.Args() {
+			switch {
+			case arg.IsName():
+				consume(e.Target(), arg.Target())
+			case arg.IsFunc():
+				walk(arg)
+			}
+		}
+	}
+	if exp.IsName() {
+		consume("", exp.Target())
+	} else if exp.IsFunc() {
+		walk(exp)
+	}
+	return d
+}
+
+func newFetchedSeries(s *types.MetricData) fetchedSeries {
+	f := fetchedSeries{
+		Name:   s.Name,
+		Start:  s.StartTime,
+		Stop:   s.StopTime,
+		Step:   s.StepTime,
+		Points: len(s.Values),
+	}
+	for _, v := range s.Values {
+		if math.IsNaN(v) {
+			f.Nulls++
+		}
+	}
+	return f
+}
+
+// marshalDebug returns json series with series that were fetched for each target
+func marshalDebug(r *http.Request, results []*types.MetricData) ([]byte, error) {
+	precision := config.Config.JSONFloatPrecision
+	if p, err := strconv.Atoi(r.FormValue("jsonFloatPrecision")); err == nil {
+		precision = p
+	}
+	targets := getTargetDebug(r.Context())
+	if targets == nil {
+		targets = []targetDebug{}
+	}
+	t, err := json.Marshal(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = append(b, `{"series":`...)
+	b = append(b, types.MarshalJSONWithPrecision(results, precision)...)
+	b = append(b, `,"targets":`...)
+	b = append(b, t...)
+	b = append(b, '}')
+	return b, nil
+}
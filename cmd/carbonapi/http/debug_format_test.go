@@ -0,0 +1,37 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderDebugFormat(t *testing.T) {
+	for _, query := range []string{"format=debug", "includeRaw=true"} {
+		req, rr := setUpRequest(t, "/render/?target=sumSeries(foo.bar)&target=foo.bar&from=-10minutes&noCache=1&"+query)
+		renderHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var resp struct {
+			Series  []json.RawMessage `json:"series"`
+			Targets []targetDebug     `json:"targets"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Len(t, resp.Series, 2)
+		if !assert.Len(t, resp.Targets, 2) {
+			continue
+		}
+
+		sum := resp.Targets[0]
+		assert.Equal(t, "sumSeries(foo.bar)", sum.Target)
+		if assert.Len(t, sum.Consumed, 1) {
+			assert.Equal(t, "sumSeries", sum.Consumed[0].Function)
+			assert.Equal(t, "foo.bar", sum.Consumed[0].PathExpression)
+			assert.Equal(t, []fetchedSeries{{Name: "foo.bar", Start: 1510913280, Stop: 1510913880, Step: 60, Points: 3, Nulls: 1}}, sum.Consumed[0].Series)
+		}
+		if assert.Len(t, resp.Targets[1].Consumed, 1) {
+			assert.Equal(t, "", resp.Targets[1].Consumed[0].Function)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr/types"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+)
+
+// defaultDiffMaxDeltas is the max amount of point deltas reported per series, if 'maxDeltas' isn't set
+const defaultDiffMaxDeltas = 100
+
+// diffDelta is a point that differs more than epsilon, absent points are null
+type diffDelta struct {
+	Timestamp int64    `json:"timestamp"`
+	Baseline  *float64 `json:"baseline"`
+	Candidate *float64 `json:"candidate"`
+}
+
+// diffSeries describes a series that differs between groups. Points are compared only if steps and alignment of
+// timestamps are the same
+type diffSeries struct {
+	Name          string      `json:"name"`
+	BaselineStep  int64       `json:"baseline_step"`
+	CandidateStep int64       `json:"candidate_step"`
+	StepMismatch  bool        `json:"step_mismatch,omitempty"`
+	DeltasCount   int         `json:"deltas_count"`
+	MaxDelta      float64     `json:"max_delta"`
+	Deltas        []diffDelta `json:"deltas,omitempty"`
+}
+
+type diffResponse struct {
+	From      int64   `json:"from"`
+	Until     int64   `json:"until"`
+	Baseline  string  `json:"baseline"`
+	Candidate string  `json:"candidate"`
+	Epsilon   float64 `json:"epsilon"`
+	// Equal is amount of series that are the same in both groups
+	Equal              int          `json:"equal"`
+	MissingInBaseline  []string     `json:"missing_in_baseline"`
+	MissingInCandidate []string     `json:"missing_in_candidate"`
+	Different          []diffSeries `json:"different"`
+}
+
+// diffHandler serves /render/diff: targets are evaluated against 'baseline' and 'candidate' backend groups (e.x.
+// old and new cluster during migration) and results are compared by series name. Groups must be allowed by
+// backendSelection config. Points are different if they differ more than 'epsilon' or only one of them is absent
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	targets := r.Form["target"]
+	if len(targets) == 0 {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": no targets", http.StatusBadRequest)
+		return
+	}
+	baseline, candidate := r.FormValue("baseline"), r.FormValue("candidate")
+	for _, group := range []string{baseline, candidate} {
+		if !config.Current().BackendSelection.IsAllowed(group) {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": backend group '"+group+"' is not allowed", http.StatusBadRequest)
+			return
+		}
+	}
+	var epsilon float64
+	if s := r.FormValue("epsilon"); s != "" {
+		var err error
+		epsilon, err = strconv.ParseFloat(s, 64)
+		if err != nil || epsilon < 0 {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": invalid epsilon '"+s+"'", http.StatusBadRequest)
+			return
+		}
+	}
+	maxDeltas := defaultDiffMaxDeltas
+	if s := r.FormValue("maxDeltas"); s != "" {
+		var err error
+		maxDeltas, err = strconv.Atoi(s)
+		if err != nil || maxDeltas < 0 {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": invalid maxDeltas '"+s+"'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	tenant := getTenant(ctx)
+	qtz := r.FormValue("tz")
+	from := date.DateParamToEpoch(r.FormValue("from"), qtz, timeNow().Add(-24*time.Hour).Unix(), tenant.GetTimeZone())
+	until := date.DateParamToEpoch(r.FormValue("until"), qtz, timeNow().Unix(), tenant.GetTimeZone())
+	if from == until {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": Invalid or empty time range", http.StatusBadRequest)
+		return
+	}
+
+	baselineResults, err := evalTargets(utilctx.SetBackendGroup(ctx, baseline), tenant, targets, from, until)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway)+": "+baseline+": "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	candidateResults, err := evalTargets(utilctx.SetBackendGroup(ctx, candidate), tenant, targets, from, until)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway)+": "+candidate+": "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	resp := diffResults(baselineResults, candidateResults, epsilon, maxDeltas)
+	resp.From = from
+	resp.Until = until
+	resp.Baseline = baseline
+	resp.Candidate = candidate
+	writeJSON(w, resp)
+}
+
+// diffResults compares series with the same names, the first one is used if names are duplicated
+func diffResults(baseline, candidate []*types.MetricData, epsilon float64, maxDeltas int) diffResponse {
+	resp := diffResponse{
+		Epsilon:            epsilon,
+		MissingInBaseline:  []string{},
+		MissingInCandidate: []string{},
+		Different:          []diffSeries{},
+	}
+	byName := func(results []*types.MetricData) map[string]*types.MetricData {
+		m := make(map[string]*types.MetricData, len(results))
+		for _, s := range results {
+			if _, ok := m[s.Name]; !ok {
+				m[s.Name] = s
+			}
+		}
+		return m
+	}
+	baselineByName, candidateByName := byName(baseline), byName(candidate)
+
+	for name, b := range baselineByName {
+		c, ok := candidateByName[name]
+		if !ok {
+			resp.MissingInCandidate = append(resp.MissingInCandidate, name)
+			continue
+		}
+		if d, ok := diffSeriesValues(b, c, epsilon, maxDeltas); ok {
+			resp.Equal++
+		} else {
+			resp.Different = append(resp.Different, d)
+		}
+	}
+	for name := range candidateByName {
+		if _, ok := baselineByName[name]; !ok {
+			resp.MissingInBaseline = append(resp.MissingInBaseline, name)
+		}
+	}
+
+	sort.Strings(resp.MissingInBaseline)
+	sort.Strings(resp.MissingInCandidate)
+	sort.Slice(resp.Different, func(i, j int) bool { return resp.Different[i].Name < resp.Different[j].Name })
+	return resp
+}
+
+// diffSeriesValues compares points with the same timestamps, points out of range of the other series are absent.
+// true is returned if series are equal
+func diffSeriesValues(b, c *types.MetricData, epsilon float64, maxDeltas int) (diffSeries, bool) {
+	d := diffSeries{Name: b.Name, BaselineStep: b.StepTime, CandidateStep: c.StepTime}
+	if b.StepTime != c.StepTime || b.StepTime <= 0 || (c.StartTime-b.StartTime)%b.StepTime != 0 {
+		d.StepMismatch = true
+		return d, false
+	}
+
+	start, stop := b.StartTime, b.StopTime
+	if c.StartTime < start {
+		start = c.StartTime
+	}
+	if c.StopTime > stop {
+		stop = c.StopTime
+	}
+	value := func(s *types.MetricData, t int64) float64 {
+		if t < s.StartTime || (t-s.StartTime)%s.StepTime != 0 {
+			return math.NaN()
+		}
+		i := int((t - s.StartTime) / s.StepTime)
+		if i >= len(s.Values) {
+			return math.NaN()
+		}
+		return s.Values[i]
+	}
+	optional := func(v float64) *float64 {
+		if math.IsNaN(v) {
+			return nil
+		}
+		return &v
+	}
+
+	for t := start; t < stop; t += b.StepTime {
+		bv, cv := value(b, t), value(c, t)
+		if math.IsNaN(bv) && math.IsNaN(cv) {
+			continue
+		}
+		delta := math.Abs(bv - cv)
+		if math.IsNaN(bv) != math.IsNaN(cv) {
+			delta = math.Inf(1)
+		} else if delta <= epsilon || bv == cv {
+			continue
+		}
+
+		d.DeltasCount++
+		if !math.IsInf(delta, 0) && delta > d.MaxDelta {
+			d.MaxDelta = delta
+		}
+		if len(d.Deltas) < maxDeltas {
+			d.Deltas = append(d.Deltas, diffDelta{Timestamp: t, Baseline: optional(bv), Candidate: optional(cv)})
+		}
+	}
+	return d, d.DeltasCount == 0
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// groupMockZipper returns series of the selected backend group
+type groupMockZipper struct {
+	mockCarbonZipper
+	series map[string][]*types.MetricData
+}
+
+func (z *groupMockZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	var res []*types.MetricData
+	for _, s := range z.series[utilctx.GetBackendGroup(ctx)] {
+		r := s.CopyData()
+		r.PathExpression = request.Metrics[0].PathExpression
+		res = append(res, r)
+	}
+	return res, nil, nil
+}
+
+func TestRenderDiff(t *testing.T) {
+	saved := config.Config.BackendSelection
+	defer func() { config.Config.BackendSelection = saved }()
+	config.Config.BackendSelection = config.BackendSelectionConfig{AllowedGroups: []string{"whisper", "clickhouse"}}
+
+	nan := math.NaN()
+	z := &groupMockZipper{series: map[string][]*types.MetricData{
+		"whisper": {
+			types.MakeMetricData("foo.equal", []float64{1, 2, 3}, 60, 1510913460),
+			types.MakeMetricData("foo.changed", []float64{1, 2, 3}, 60, 1510913460),
+			types.MakeMetricData("foo.step", []float64{1, 2, 3}, 60, 1510913460),
+			types.MakeMetricData("foo.old", []float64{1, 2, 3}, 60, 1510913460),
+		},
+		"clickhouse": {
+			types.MakeMetricData("foo.equal", []float64{1, 2.0001, 3}, 60, 1510913460),
+			types.MakeMetricData("foo.changed", []float64{1, 5, nan}, 60, 1510913460),
+			types.MakeMetricData("foo.step", []float64{1, 2, 3}, 10, 1510913460),
+			types.MakeMetricData("foo.new", []float64{1, 2, 3}, 60, 1510913460),
+		},
+	}}
+	defer useZipper(z)()
+
+	req, rr := setUpRequest(t, "/render/diff?target=foo.*&from=1510913400&until=1510913700&baseline=whisper&candidate=clickhouse&epsilon=0.001")
+	diffHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp diffResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Equal)
+	assert.Equal(t, []string{"foo.new"}, resp.MissingInBaseline)
+	assert.Equal(t, []string{"foo.old"}, resp.MissingInCandidate)
+	if assert.Len(t, resp.Different, 2) {
+		changed := resp.Different[0]
+		assert.Equal(t, "foo.changed", changed.Name)
+		assert.Equal(t, 2, changed.DeltasCount)
+		assert.Equal(t, 3.0, changed.MaxDelta)
+		if assert.Len(t, changed.Deltas, 2) {
+			assert.Equal(t, int64(1510913520), changed.Deltas[0].Timestamp)
+			assert.Equal(t, 5.0, *changed.Deltas[0].Candidate)
+			assert.Equal(t, 3.0, *changed.Deltas[1].Baseline)
+			assert.Nil(t, changed.Deltas[1].Candidate)
+		}
+		assert.Equal(t, "foo.step", resp.Different[1].Name)
+		assert.True(t, resp.Different[1].StepMismatch)
+		assert.Equal(t, int64(10), resp.Different[1].CandidateStep)
+	}
+
+	req, rr = setUpRequest(t, "/render/diff?target=foo.*&baseline=whisper&candidate=prod")
+	diffHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -3,9 +3,23 @@ package http
 import (
 	"net/http"
 
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 )
 
+// getBackendGroup returns backend group that was selected by the client. Returns false if group is not allowed
+func getBackendGroup(req *http.Request) (string, bool) {
+	cfg := &config.Current().BackendSelection
+	if cfg.Header == "" {
+		return "", true
+	}
+	group := req.Header.Get(cfg.Header)
+	if group == "" {
+		return "", true
+	}
+	return group, cfg.IsAllowed(group)
+}
+
 // TrackConnections exports via expvar a list of all currently executing requests
 func enrichContextWithHeaders(headersToPass, headersToLog []string, fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -27,6 +41,13 @@ func enrichContextWithHeaders(headersToPass, headersToLog []string, fn http.Hand
 
 		ctx := utilctx.SetPassHeaders(req.Context(), headersToPassMap)
 		ctx = utilctx.SetLogHeaders(ctx, headersToLogMap)
+
+		group, ok := getBackendGroup(req)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": backend group is not allowed", http.StatusBadRequest)
+			return
+		}
+		ctx = utilctx.SetBackendGroup(ctx, group)
 		req = req.WithContext(ctx)
 
 		fn(w, req)
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendSelection(t *testing.T) {
+	saved := config.Config.BackendSelection
+	defer func() { config.Config.BackendSelection = saved }()
+	config.Config.BackendSelection = config.BackendSelectionConfig{
+		Header:        "X-Graphite-Cluster",
+		AllowedGroups: []string{"prod", "staging"},
+	}
+
+	var gotGroup string
+	h := enrichContextWithHeaders(nil, nil, func(w http.ResponseWriter, r *http.Request) {
+		gotGroup = utilctx.GetBackendGroup(r.Context())
+	})
+
+	for _, tt := range []struct {
+		group string
+		code  int
+	}{
+		{"", http.StatusOK},
+		{"staging", http.StatusOK},
+		{"dev", http.StatusBadRequest},
+	} {
+		gotGroup = ""
+		req := httptest.NewRequest("GET", "/render?target=foo", nil)
+		if tt.group != "" {
+			req.Header.Set("X-Graphite-Cluster", tt.group)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		assert.Equal(t, tt.code, rr.Code, tt.group)
+		if tt.code == http.StatusOK {
+			assert.Equal(t, tt.group, gotGroup)
+		}
+	}
+
+	form := map[string][]string{"target": {"foo"}}
+	assert.NotEqual(t, renderCacheKey(nil, "prod", form), renderCacheKey(nil, "staging", form))
+	assert.Equal(t, "target=foo", renderCacheKey(nil, "", form))
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// evalHandler serves /eval, which is render request that returns each series reduced to a single value. It's meant
+// for alerting systems that don't need datapoints. Besides render parameters, it accepts 'func' (consolidation
+// function, 'last' by default) and 'window' (only the last part of series is reduced)
+func evalHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := evalReducer(r); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renderAs(w, r, evalFormat)
+}
+
+// evalReducer returns reduce function and window in seconds requested by 'func' and 'window' parameters
+func evalReducer(r *http.Request) (func([]float64) float64, int64, error) {
+	name := r.FormValue("func")
+	if name == "" {
+		name = "last"
+	}
+	reduce, ok := consolidations.ConsolidationFunc(name)
+	if !ok {
+		// percentiles are supported by summarize only
+		if !consolidations.IsValidSummarizer(name) {
+			return nil, 0, fmt.Errorf("unknown function '%s'", name)
+		}
+		reduce = func(values []float64) float64 {
+			return consolidations.SummarizeValues(name, values)
+		}
+	}
+
+	var window int64
+	if s := r.FormValue("window"); s != "" {
+		w, err := parser.IntervalString(s, 1)
+		if err != nil || w <= 0 {
+			return nil, 0, fmt.Errorf("invalid window '%s'", s)
+		}
+		window = int64(w)
+	}
+
+	return reduce, window, nil
+}
+
+func marshalEval(r *http.Request, results []*types.MetricData) ([]byte, error) {
+	reduce, window, err := evalReducer(r)
+	if err != nil {
+		return nil, err
+	}
+	return types.MarshalScalars(results, reduce, window), nil
+}
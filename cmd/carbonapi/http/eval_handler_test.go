@@ -0,0 +1,33 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalHandler(t *testing.T) {
+	tests := []struct {
+		query    string
+		code     int
+		expected string
+	}{
+		{"", http.StatusOK, `[{"target":"foo.bar","tags":{},"value":1510913818}]`},
+		{"&func=min", http.StatusOK, `[{"target":"foo.bar","tags":{},"value":1510913759}]`},
+		{"&func=min&window=1min", http.StatusOK, `[{"target":"foo.bar","tags":{},"value":1510913818}]`},
+		{"&func=p50", http.StatusOK, `[{"target":"foo.bar","tags":{},"value":1510913788.5}]`},
+		{"&func=unknown", http.StatusBadRequest, ""},
+		{"&window=-1min", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req, rr := setUpRequest(t, "/eval?target=foo.bar&from=-10minutes&format=png"+tt.query)
+		evalHandler(rr, req)
+		assert.Equal(t, tt.code, rr.Code, tt.query)
+		if tt.code == http.StatusOK {
+			assert.Equal(t, contentTypeJSON, rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.expected, rr.Body.String(), tt.query)
+		}
+	}
+}
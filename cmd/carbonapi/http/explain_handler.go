@@ -0,0 +1,198 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/lomik/zapwriter"
+)
+
+// explainNode is a node of parsed expression
+type explainNode struct {
+	Type      string                  `json:"type"`
+	Value     string                  `json:"value"`
+	Args      []*explainNode          `json:"args,omitempty"`
+	NamedArgs map[string]*explainNode `json:"named_args,omitempty"`
+}
+
+// explainFetch is a request to backends. Metrics requested with narrower time ranges by the same targets are cut
+// from the fetched series
+type explainFetch struct {
+	Name           string `json:"name"`
+	PathExpression string `json:"path_expression"`
+	From           int64  `json:"from"`
+	Until          int64  `json:"until"`
+	// FilterFunctions are pushed down to backends that support them
+	FilterFunctions []string `json:"filter_functions,omitempty"`
+	// Step and Points are predicted by storage schemas, ValuesPerPoint is consolidation of them to maxDataPoints
+	Step           int64 `json:"step,omitempty"`
+	Points         int64 `json:"points,omitempty"`
+	ValuesPerPoint int64 `json:"values_per_point,omitempty"`
+}
+
+type explainTarget struct {
+	Target string       `json:"target"`
+	AST    *explainNode `json:"ast,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Cost   lintCost     `json:"cost"`
+}
+
+type explainCache struct {
+	Key     string `json:"key"`
+	Timeout int32  `json:"timeout"`
+	Enabled bool   `json:"enabled"`
+	Cached  bool   `json:"cached"`
+}
+
+type explainResponse struct {
+	From          int64           `json:"from"`
+	Until         int64           `json:"until"`
+	MaxDataPoints int             `json:"max_data_points"`
+	Format        string          `json:"format"`
+	Targets       []explainTarget `json:"targets"`
+	Fetches       []explainFetch  `json:"fetches"`
+	Cache         explainCache    `json:"cache"`
+	Cost          lintCost        `json:"cost"`
+	Warnings      []string        `json:"warnings,omitempty"`
+}
+
+// explainHandler serves /render/explain: render request is planned the same way render does, but no data is fetched.
+// Response contains parsed targets, requests to backends, cache key with timeout and estimated cost. Metrics of
+// targets produced by rewrite functions (e.x. applyByNode) are known only after fetch, so they are not included
+func explainHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	targets := r.Form["target"]
+	if len(targets) == 0 {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": no targets", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	tenant := getTenant(ctx)
+	qtz := r.FormValue("tz")
+	from := date.DateParamToEpoch(r.FormValue("from"), qtz, timeNow().Add(-24*time.Hour).Unix(), tenant.GetTimeZone())
+	until := date.DateParamToEpoch(r.FormValue("until"), qtz, timeNow().Unix(), tenant.GetTimeZone())
+	maxDataPoints, _ := strconv.Atoi(r.FormValue("maxDataPoints"))
+
+	resp := explainResponse{
+		From:          from,
+		Until:         until,
+		MaxDataPoints: maxDataPoints,
+		Format:        getFormat(r),
+		Targets:       []explainTarget{},
+		Fetches:       []explainFetch{},
+	}
+
+	var exps []parser.Expr
+	var parsed []string
+	for _, target := range targets {
+		t := explainTarget{Target: target}
+		exp, e, err := parser.ParseExpr(target)
+		if err != nil || e != "" {
+			t.Error = buildParseErrorString(target, e, err)
+		} else {
+			t.AST = explainExpr(exp)
+			t.Cost = lintTargetExpr(target, nil).Cost
+			exps = append(exps, exp)
+			parsed = append(parsed, target)
+		}
+		t.Cost.TimeRange = until - from
+		resp.Cost.Fetches += t.Cost.Fetches
+		resp.Cost.Wildcards += t.Cost.Wildcards
+		resp.Cost.Functions += t.Cost.Functions
+		resp.Targets = append(resp.Targets, t)
+	}
+	resp.Cost.TimeRange = until - from
+	resp.Warnings = resolutionWarnings(parsed, exps, from)
+
+	fetches := newFetchBatch(exps, from, until)
+	metricMap := make(map[parser.MetricRequest][]*types.MetricData)
+	index := getTagIndex(tenant)
+	for _, exp := range exps {
+		// tag index errors are reported by render, metrics are planned anyway
+		_ = fetches.add(exp, index, getMetricIndex(tenant), metricMap)
+	}
+	now := timeNow().Unix()
+	for _, m := range fetches.req.Metrics {
+		f := explainFetch{
+			Name:           m.Name,
+			PathExpression: m.PathExpression,
+			From:           m.StartTime,
+			Until:          m.StopTime,
+		}
+		for _, filter := range m.FilterFunctions {
+			f.FilterFunctions = append(f.FilterFunctions, filter.Name+"("+strings.Join(filter.Arguments, ",")+")")
+		}
+		if step, ok := predictStep(m.PathExpression, m.StartTime, now); ok {
+			f.Step = step
+			f.Points = (m.StopTime - m.StartTime) / step
+			if maxDataPoints > 0 && f.Points > int64(maxDataPoints) {
+				f.ValuesPerPoint = (f.Points + int64(maxDataPoints) - 1) / int64(maxDataPoints)
+			}
+		}
+		resp.Fetches = append(resp.Fetches, f)
+	}
+
+	// cache key is built the same way as by render
+	r.Form.Set("format", resp.Format)
+	useCache := !parser.TruthyBool(r.FormValue("noCache"))
+	cacheTimeout := getCacheTimeout(zapwriter.Logger("explain"), r)
+	if r.FormValue("cacheTimeout") == "" {
+		cacheTimeout = getRecencyCacheTimeout(cacheTimeout, until)
+	}
+	cleanupParams(r)
+	resp.Cache = explainCache{
+		Key:     renderCacheKey(tenant, utilctx.GetBackendGroup(ctx), r.Form),
+		Timeout: cacheTimeout,
+		Enabled: useCache,
+	}
+	if _, err := config.Config.QueryCache.Get(resp.Cache.Key); err == nil {
+		resp.Cache.Cached = true
+	}
+
+	writeJSON(w, resp)
+}
+
+// explainExpr converts parsed expression to a tree of nodes
+func explainExpr(exp parser.Expr) *explainNode {
+	n := &explainNode{Value: exp.Target()}
+	switch {
+	case exp.IsFunc():
+		n.Type = "function"
+	case exp.IsName():
+		n.Type = "series"
+	case exp.IsConst():
+		n.Type = "number"
+		n.Value = exp.ToString()
+	case exp.IsBool():
+		n.Type = "bool"
+		n.Value = exp.ToString()
+	default:
+		n.Type = "string"
+		n.Value = exp.StringValue()
+	}
+	if !exp.IsFunc() {
+		return n
+	}
+
+	for _, arg := range exp.Args() {
+		n.Args = append(n.Args, explainExpr(arg))
+	}
+	if len(exp.NamedArgs()) > 0 {
+		n.NamedArgs = make(map[string]*explainNode, len(exp.NamedArgs()))
+		for name, arg := range exp.NamedArgs() {
+			n.NamedArgs[name] = explainExpr(arg)
+		}
+	}
+	return n
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainHandler(t *testing.T) {
+	req, rr := setUpRequest(t, "/render/explain?target=sumSeries(foo.*)&target=timeShift(foo.bar,'1min')&target=foo.bar&from=1510913280&until=1510913880&format=json&maxDataPoints=100&_salt=1")
+	explainHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp explainResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 100, resp.MaxDataPoints)
+	assert.Equal(t, "json", resp.Format)
+	if assert.Len(t, resp.Targets, 3) {
+		assert.Equal(t, &explainNode{Type: "function", Value: "sumSeries", Args: []*explainNode{{Type: "series", Value: "foo.*"}}}, resp.Targets[0].AST)
+		assert.Equal(t, lintCost{Fetches: 1, Wildcards: 1, Functions: 1, TimeRange: 600}, resp.Targets[0].Cost)
+	}
+	assert.Equal(t, lintCost{Fetches: 3, Wildcards: 1, Functions: 2, TimeRange: 600}, resp.Cost)
+	assert.Equal(t, []explainFetch{
+		{Name: "foo.*", PathExpression: "foo.*", From: 1510913280, Until: 1510913880},
+		// overlapping windows are merged
+		{Name: "foo.bar", PathExpression: "foo.bar", From: 1510913220, Until: 1510913880},
+	}, resp.Fetches)
+	assert.NotContains(t, resp.Cache.Key, "_salt")
+	assert.True(t, resp.Cache.Enabled)
+
+	req, rr = setUpRequest(t, "/render/explain?target=sumSeries(foo.bar")
+	explainHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"error":`)
+}
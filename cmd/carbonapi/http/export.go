@@ -0,0 +1,482 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/lomik/zapwriter"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	exportPending = "pending"
+	exportRunning = "running"
+	exportDone    = "done"
+	exportFailed  = "failed"
+)
+
+// exportRequest is a render request, that is evaluated in background and uploaded to the destination
+type exportRequest struct {
+	Targets []string `json:"targets"`
+	From    string   `json:"from"`
+	Until   string   `json:"until"`
+	Format  string   `json:"format"`
+	// Params are other render parameters, e.x. maxDataPoints or queryName
+	Params map[string]string `json:"params"`
+	// Destination is an s3://bucket/key URL, an http(s) URL the result is uploaded to by PUT (e.x. presigned URL of
+	// S3 or GCS) or file:// URL inside of the local directory
+	Destination string `json:"destination"`
+}
+
+// exportJob is a status of an export request
+type exportJob struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	Destination string `json:"destination"`
+	Format      string `json:"format"`
+	Error       string `json:"error,omitempty"`
+	Size        int    `json:"size,omitempty"`
+	Created     int64  `json:"created"`
+	Finished    int64  `json:"finished,omitempty"`
+	// owner is a name of the tenant that started the job, jobs started by admin have no owner
+	owner string
+}
+
+// exporter runs export jobs, statuses of finished jobs are kept for keepFinished
+type exporter struct {
+	sync.Mutex
+	jobs         map[string]*exportJob
+	slots        chan struct{}
+	maxJobs      int
+	timeout      time.Duration
+	keepFinished time.Duration
+	localDir     string
+	destinations []*url.URL
+	client       *http.Client
+	// s3 is nil if there are no s3 destinations
+	s3 *s3Client
+}
+
+// export is nil if export is disabled
+var export *exporter
+
+func initExport(cfg config.ExportConfig) {
+	if cfg.MaxConcurrent <= 0 {
+		export = nil
+		return
+	}
+	e := &exporter{
+		jobs:         make(map[string]*exportJob),
+		slots:        make(chan struct{}, cfg.MaxConcurrent),
+		maxJobs:      cfg.MaxJobs,
+		timeout:      cfg.Timeout,
+		keepFinished: cfg.KeepFinished,
+		client:       &http.Client{},
+	}
+	if e.timeout <= 0 {
+		e.timeout = 10 * time.Minute
+	}
+	if e.keepFinished <= 0 {
+		e.keepFinished = time.Hour
+	}
+	if cfg.LocalDir != "" {
+		e.localDir = filepath.Clean(cfg.LocalDir)
+	}
+	for _, prefix := range cfg.AllowedDestinations {
+		u, err := url.Parse(prefix)
+		if err == nil && (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "s3" || u.Host == "" || u.User != nil) {
+			err = fmt.Errorf("prefix must be http(s) or s3 URL without credentials")
+		}
+		if err == nil && u.Scheme == "s3" && e.s3 == nil {
+			e.s3, err = newS3Client(cfg.S3, e.client)
+		}
+		if err != nil {
+			zapwriter.Logger("export").Fatal("invalid allowed destination",
+				zap.String("prefix", prefix),
+				zap.Error(err),
+			)
+		}
+		e.destinations = append(e.destinations, u)
+	}
+	export = e
+}
+
+// checkDestination checks if the result could be uploaded to the destination
+func (e *exporter) checkDestination(destination string) error {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "s3":
+		if !e.allowedDestination(u) {
+			return fmt.Errorf("destination isn't allowed")
+		}
+		return nil
+	case "file":
+		if e.localDir == "" {
+			return fmt.Errorf("file destinations are disabled")
+		}
+		if !strings.HasPrefix(filepath.Clean(u.Path), e.localDir+string(filepath.Separator)) {
+			return fmt.Errorf("file destination must be inside of %s", e.localDir)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported destination scheme '%s'", u.Scheme)
+	}
+}
+
+// allowedDestination checks if http(s) or s3 destination is under one of allowed prefixes. Paths with dot segments
+// or credentials in the URL are rejected, so they can't escape the prefix
+func (e *exporter) allowedDestination(u *url.URL) bool {
+	if u.User != nil || u.Path == "" || u.Path == "/" || path.Clean(u.Path) != u.Path {
+		return false
+	}
+	for _, p := range e.destinations {
+		if u.Scheme == p.Scheme && strings.EqualFold(u.Host, p.Host) && underPath(u.Path, p.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// underPath checks if clean path is the prefix or inside of it, "/reports" allows "/reports/x", but not "/reports-x"
+func underPath(p, prefix string) bool {
+	prefix = path.Clean("/" + prefix)
+	if prefix == "/" {
+		return true
+	}
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// start creates a job of the requester and runs it in background. Render request inherits headers of the original
+// request, so it's rendered for the same user and tenant
+func (e *exporter) start(r *http.Request, req exportRequest, u requester) (*exportJob, int, error) {
+	if len(req.Targets) == 0 && req.Params["queryName"] == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("no targets")
+	}
+	if err := e.checkDestination(req.Destination); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if req.Format == "" {
+		req.Format = csvFormat
+	}
+	if _, ok := lookupFormat(req.Format); !ok {
+		return nil, http.StatusBadRequest, fmt.Errorf("unsupported format '%s'", req.Format)
+	}
+
+	values := url.Values{"target": req.Targets, "format": {req.Format}}
+	for k, v := range req.Params {
+		values.Set(k, v)
+	}
+	if req.From != "" {
+		values.Set("from", req.From)
+	}
+	if req.Until != "" {
+		values.Set("until", req.Until)
+	}
+	render, err := http.NewRequest("GET", config.Config.Prefix+"/render/?"+values.Encode(), nil)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	for k, v := range r.Header {
+		render.Header[k] = v
+	}
+
+	now := timeNow()
+	e.Lock()
+	active := 0
+	for id, j := range e.jobs {
+		if j.Finished != 0 && now.Sub(time.Unix(j.Finished, 0)) > e.keepFinished {
+			delete(e.jobs, id)
+		} else if j.Finished == 0 {
+			active++
+		}
+	}
+	if e.maxJobs > 0 && active >= e.maxJobs {
+		e.Unlock()
+		return nil, http.StatusTooManyRequests, fmt.Errorf("too many export jobs")
+	}
+	job := &exportJob{
+		ID:          uuid.NewV4().String(),
+		Status:      exportPending,
+		Destination: req.Destination,
+		Format:      req.Format,
+		Created:     now.Unix(),
+		owner:       u.owner,
+	}
+	e.jobs[job.ID] = job
+	e.Unlock()
+	ApiMetrics.ExportJobs.Add(1)
+
+	ctx := utilctx.SetUUID(context.Background(), job.ID)
+	ctx = utilctx.SetPassHeaders(ctx, utilctx.GetPassHeaders(r.Context()))
+	ctx = utilctx.SetLogHeaders(ctx, utilctx.GetLogHeaders(r.Context()))
+	ctx = utilctx.SetBackendGroup(ctx, utilctx.GetBackendGroup(r.Context()))
+	ctx = setTenant(ctx, getTenant(r.Context()))
+	go e.run(ctx, job, render)
+
+	return e.status(job.ID, u), http.StatusAccepted, nil
+}
+
+func (e *exporter) run(ctx context.Context, job *exportJob, render *http.Request) {
+	e.slots <- struct{}{}
+	defer func() { <-e.slots }()
+	e.update(job, func(j *exportJob) { j.Status = exportRunning })
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	size, err := e.export(ctx, job.Destination, render.WithContext(ctx))
+
+	e.update(job, func(j *exportJob) {
+		j.Finished = timeNow().Unix()
+		if err != nil {
+			j.Status, j.Error = exportFailed, err.Error()
+			return
+		}
+		j.Status, j.Size = exportDone, int(size)
+	})
+	if err != nil {
+		ApiMetrics.ExportErrors.Add(1)
+		zapwriter.Logger("export").Warn("export failed",
+			zap.String("id", job.ID),
+			zap.String("destination", job.Destination),
+			zap.Error(err),
+		)
+	}
+}
+
+// export renders the request to a temporary file and uploads it to the destination, that is already checked. Results
+// aren't kept in memory, so they could be larger than responses of render requests. Size of the result is returned
+func (e *exporter) export(ctx context.Context, destination string, render *http.Request) (int64, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return 0, err
+	}
+	// file is moved to the local destination, so it's created in the same directory
+	dir, pattern := "", "carbonapi-export"
+	if u.Scheme == "file" {
+		file := filepath.Clean(u.Path)
+		dir, pattern = filepath.Dir(file), filepath.Base(file)+".tmp"
+	}
+	f, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	contentType, err := renderToFile(render, f)
+	if err != nil {
+		return 0, err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if u.Scheme == "file" {
+		if err := f.Close(); err != nil {
+			return 0, err
+		}
+		return size, os.Rename(f.Name(), filepath.Clean(u.Path))
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if u.Scheme == "s3" {
+		// hash of the payload is signed, so the file is read twice
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return 0, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		key := strings.TrimPrefix(u.Path, "/")
+		return size, e.s3.put(ctx, u.Host, key, contentType, f, size, hex.EncodeToString(h.Sum(nil)))
+	}
+	return size, e.upload(ctx, destination, contentType, f, size)
+}
+
+// upload sends the result by PUT. Content-Length is set, because presigned URLs of storages don't accept chunked
+// requests
+func (e *exporter) upload(ctx context.Context, destination, contentType string, body io.Reader, size int64) error {
+	if size == 0 {
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(http.MethodPut, destination, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("upload failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (e *exporter) update(job *exportJob, f func(j *exportJob)) {
+	e.Lock()
+	f(job)
+	e.Unlock()
+}
+
+// status returns a copy of the job status, nil if it's unknown. Destinations could contain credentials (e.x.
+// presigned URLs), so jobs of other owners are unknown to the requester
+func (e *exporter) status(id string, u requester) *exportJob {
+	e.Lock()
+	defer e.Unlock()
+	j, ok := e.jobs[id]
+	if !ok || !u.canModify(j.owner) {
+		return nil
+	}
+	res := *j
+	return &res
+}
+
+// renderBuffered serves the render request in memory and returns the response with its content type. Responses
+// other than 200 OK are errors
+func renderBuffered(r *http.Request) ([]byte, string, error) {
+	w := &bufferResponseWriter{header: make(http.Header), code: http.StatusOK}
+	renderHandler(w, r)
+	if err := r.Context().Err(); err != nil {
+		return nil, "", err
+	}
+	if w.code != http.StatusOK {
+		return nil, "", fmt.Errorf("render failed: %s", strings.TrimSpace(w.body.String()))
+	}
+	return w.body.Bytes(), w.header.Get("Content-Type"), nil
+}
+
+// renderToFile serves the render request and writes the response to the file, its content type is returned.
+// Responses other than 200 OK are errors
+func renderToFile(r *http.Request, f *os.File) (string, error) {
+	w := &fileResponseWriter{header: make(http.Header), code: http.StatusOK, f: f}
+	renderHandler(w, r)
+	if err := r.Context().Err(); err != nil {
+		return "", err
+	}
+	if w.code != http.StatusOK {
+		return "", fmt.Errorf("render failed: %s", strings.TrimSpace(w.body.String()))
+	}
+	if w.err != nil {
+		return "", w.err
+	}
+	return w.header.Get("Content-Type"), nil
+}
+
+// fileResponseWriter writes successful response to the file, bodies of errors are kept in memory
+type fileResponseWriter struct {
+	header http.Header
+	code   int
+	f      *os.File
+	body   bytes.Buffer
+	err    error
+}
+
+func (w *fileResponseWriter) Header() http.Header { return w.header }
+
+func (w *fileResponseWriter) Write(b []byte) (int, error) {
+	if w.code != http.StatusOK {
+		return w.body.Write(b)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.f.Write(b)
+	w.err = err
+	return n, err
+}
+
+func (w *fileResponseWriter) WriteHeader(code int) { w.code = code }
+
+// bufferResponseWriter keeps response in memory
+type bufferResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *bufferResponseWriter) Header() http.Header { return w.header }
+
+func (w *bufferResponseWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+func (w *bufferResponseWriter) WriteHeader(code int) { w.code = code }
+
+// exportHandler serves /export: POST starts export of render request from JSON body and returns status of the job.
+// /export/<id>: GET returns status of the job. Jobs are started and seen only by authenticated clients
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if export == nil {
+		http.Error(w, "export is disabled", http.StatusNotFound)
+		return
+	}
+	u, ok := requireAuth(w, r)
+	if !ok {
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, config.Config.Prefix+"/export"), "/")
+
+	if id != "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		job := export.status(id, u)
+		if job == nil {
+			http.Error(w, "job "+id+" not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, job)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var req exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid export request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	job, code, err := export.start(r, req, u)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	b, err := json.Marshal(job)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(b)
+}
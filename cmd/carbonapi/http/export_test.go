@@ -0,0 +1,156 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	dir, cleanup := tempDir(t, "carbonapi-export")
+	defer cleanup()
+	defer initExport(config.ExportConfig{})
+	defer useAdminToken()()
+
+	uploaded := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		// results are uploaded with known size, not chunked
+		assert.Equal(t, int64(len(b)), r.ContentLength)
+		assert.Empty(t, r.TransferEncoding)
+		uploaded <- r.Method + " " + r.Header.Get("Content-Type") + " " + string(b)
+	}))
+	defer srv.Close()
+	s3Uploaded := make(chan *http.Request, 1)
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, sha256Hex(b), r.Header.Get("X-Amz-Content-Sha256"))
+		assert.True(t, strings.HasPrefix(string(b), "PAR1"))
+		s3Uploaded <- r
+	}))
+	defer s3.Close()
+	initExport(config.ExportConfig{
+		MaxConcurrent:       1,
+		LocalDir:            dir,
+		AllowedDestinations: []string{srv.URL + "/bucket/", "s3://bucket/reports"},
+		S3: config.ExportS3Config{
+			Endpoint:        s3.URL,
+			PathStyle:       true,
+			AccessKeyID:     "key",
+			SecretAccessKey: "secret",
+		},
+	})
+
+	start := func(body string) (int, *exportJob) {
+		rr := serveRequest(exportHandler, "POST", "/export", "alice", body)
+		var job exportJob
+		if rr.Code == http.StatusAccepted {
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+		}
+		return rr.Code, &job
+	}
+	wait := func(id string) *exportJob {
+		for i := 0; i < 100; i++ {
+			rr := serveRequest(exportHandler, "GET", "/export/"+id, "alice", "")
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var job exportJob
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+			if job.Status == exportDone || job.Status == exportFailed {
+				return &job
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("export job isn't finished")
+		return nil
+	}
+
+	code, job := start(`{"targets":["foo.bar"],"from":"1510913280","until":"1510913880","destination":"` + srv.URL + `/bucket/key.csv"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, csvFormat, job.Format)
+	job = wait(job.ID)
+	assert.Equal(t, exportDone, job.Status, job.Error)
+	upload := <-uploaded
+	assert.True(t, strings.HasPrefix(upload, "PUT text/csv"), upload)
+	assert.Contains(t, upload, `"foo.bar",2017-11-17 10:09:00,1510913759`)
+	assert.Equal(t, len(upload)-len("PUT text/csv "), job.Size)
+
+	// jobs are seen only by their owners and admin
+	assert.Equal(t, http.StatusNotFound, serveRequest(exportHandler, "GET", "/export/"+job.ID, "bob", "").Code)
+	assert.Equal(t, http.StatusOK, serveRequest(exportHandler, "GET", "/export/"+job.ID, "admin", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serveRequest(exportHandler, "GET", "/export/"+job.ID, "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serveRequest(exportHandler, "POST", "/export", "anonymous", `{"targets":["foo.bar"],"destination":"`+srv.URL+`/bucket/key"}`).Code)
+
+	code, job = start(`{"targets":["foo.bar"],"format":"parquet","destination":"s3://bucket/reports/foo.parquet"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	job = wait(job.ID)
+	assert.Equal(t, exportDone, job.Status, job.Error)
+	req := <-s3Uploaded
+	assert.Equal(t, "PUT /bucket/reports/foo.parquet", req.Method+" "+req.URL.Path)
+	assert.Equal(t, contentTypeParquet, req.Header.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/"), req.Header.Get("Authorization"))
+
+	path := filepath.Join(dir, "foo.json")
+	code, job = start(`{"targets":["foo.bar"],"format":"json","destination":"file://` + path + `"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	job = wait(job.ID)
+	assert.Equal(t, exportDone, job.Status, job.Error)
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"target":"foo.bar"`)
+
+	// render errors are reported by status of the job
+	code, job = start(`{"targets":["foo.bar("],"destination":"` + srv.URL + `/bucket/key"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	job = wait(job.ID)
+	assert.Equal(t, exportFailed, job.Status)
+	assert.NotEmpty(t, job.Error)
+
+	for _, body := range []string{
+		`{"targets":[],"destination":"` + srv.URL + `/bucket/key"}`,
+		// only destinations under allowed prefixes are accepted
+		`{"targets":["foo.bar"],"destination":"` + srv.URL + `/key"}`,
+		`{"targets":["foo.bar"],"destination":"` + srv.URL + `/bucket-evil/key"}`,
+		`{"targets":["foo.bar"],"destination":"` + srv.URL + `/bucket/../key"}`,
+		`{"targets":["foo.bar"],"destination":"` + srv.URL + `/bucket/..%2Fkey"}`,
+		`{"targets":["foo.bar"],"destination":"` + strings.Replace(srv.URL, "http://", "http://user:pass@", 1) + `/bucket/key"}`,
+		`{"targets":["foo.bar"],"destination":"http://169.254.169.254/bucket/key"}`,
+		`{"targets":["foo.bar"],"format":"xlsx","destination":"` + srv.URL + `/bucket/key"}`,
+		`{"targets":["foo.bar"],"destination":"s3://bucket/key"}`,
+		`{"targets":["foo.bar"],"destination":"s3://bucket/reports-evil/key"}`,
+		`{"targets":["foo.bar"],"destination":"s3://other/reports/key"}`,
+		`{"targets":["foo.bar"],"destination":"file:///etc/passwd"}`,
+		`{"targets":["foo.bar"],"destination":"file://` + dir + `/../key"}`,
+	} {
+		code, _ = start(body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+
+	assert.Equal(t, http.StatusNotFound, serveRequest(exportHandler, "GET", "/export/none", "alice", "").Code)
+}
+
+func TestUnderPath(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		expected     bool
+	}{
+		{"/reports/a.csv", "/reports", true},
+		{"/reports/a.csv", "/reports/", true},
+		{"/reports", "/reports", true},
+		{"/reports-evil/a.csv", "/reports", false},
+		{"/reports-evil/a.csv", "/reports/", false},
+		{"/other/a.csv", "/reports", false},
+		{"/a.csv", "", true},
+		{"/a.csv", "/", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, underPath(tt.path, tt.prefix), "%s under %s", tt.path, tt.prefix)
+	}
+}
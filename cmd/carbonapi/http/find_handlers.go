@@ -6,17 +6,22 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/intervalset"
+	"github.com/go-graphite/carbonapi/pkg/parser"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	pickle "github.com/lomik/og-rek"
 	"github.com/lomik/zapwriter"
 	"github.com/satori/go.uuid"
+
+	protov2 "github.com/go-graphite/protocol/carbonapi_v2_pb"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
 )
 
@@ -32,10 +37,14 @@ type treejson struct {
 
 var treejsonContext = make(map[string]int)
 
-func findTreejson(multiGlobs *pb.MultiGlobResponse) ([]byte, error) {
+// findTreejson marshals find response in the format of graphite-web's treejson, that is used by composer.
+// Like in graphite-web, nodes are sorted by name, branches go before leaves and if wildcards is set, there is
+// a '*' node in front of them when there is more than one node
+func findTreejson(multiGlobs *pb.MultiGlobResponse, wildcards bool) ([]byte, error) {
 	var b bytes.Buffer
 
-	var tree = make([]treejson, 0)
+	var branches, leaves []treejson
+	var wildcardPath string
 
 	seen := make(map[string]struct{})
 
@@ -72,14 +81,39 @@ func findTreejson(multiGlobs *pb.MultiGlobResponse) ([]byte, error) {
 
 			if g.IsLeaf {
 				t.Leaf = 1
+				leaves = append(leaves, t)
 			} else {
 				t.AllowChildren = 1
 				t.Expandable = 1
+				branches = append(branches, t)
 			}
+			wildcardPath = basepath + "*"
+		}
+	}
 
-			tree = append(tree, t)
+	byText := func(nodes []treejson) func(i, j int) bool {
+		return func(i, j int) bool { return nodes[i].Text < nodes[j].Text }
+	}
+	sort.Slice(branches, byText(branches))
+	sort.Slice(leaves, byText(leaves))
+
+	var tree = make([]treejson, 0, len(branches)+len(leaves)+1)
+	if wildcards && len(branches)+len(leaves) > 1 {
+		t := treejson{
+			ID:      wildcardPath,
+			Context: treejsonContext,
+			Text:    "*",
 		}
+		if len(branches) > 0 {
+			t.AllowChildren = 1
+			t.Expandable = 1
+		} else {
+			t.Leaf = 1
+		}
+		tree = append(tree, t)
 	}
+	tree = append(tree, branches...)
+	tree = append(tree, leaves...)
 
 	err := json.NewEncoder(&b).Encode(tree)
 	return b.Bytes(), err
@@ -157,12 +191,93 @@ func findList(multiGlobs *pb.MultiGlobResponse) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// findProtobufV2 encodes find response as carbonapi_v2_pb GlobResponse. That format can carry only one query, so all
+// matches are merged under the first query name, same as carbonzipper does.
+func findProtobufV2(multiGlobs *pb.MultiGlobResponse, query []string) ([]byte, error) {
+	var result protov2.GlobResponse
+	if len(query) > 0 {
+		result.Name = query[0]
+	}
+
+	seen := make(map[string]struct{})
+	result.Matches = make([]protov2.GlobMatch, 0)
+	for _, globs := range multiGlobs.Metrics {
+		if result.Name == "" {
+			result.Name = globs.Name
+		}
+		for _, g := range globs.Matches {
+			if _, ok := seen[g.Path]; ok {
+				continue
+			}
+			seen[g.Path] = struct{}{}
+			result.Matches = append(result.Matches, protov2.GlobMatch{
+				Path:   g.Path,
+				IsLeaf: g.IsLeaf,
+			})
+		}
+	}
+
+	return result.Marshal()
+}
+
+func findPickle(multiGlobs *pb.MultiGlobResponse) ([]byte, error) {
+	var result []map[string]interface{}
+	now := int32(time.Now().Unix() + 60)
+	for _, globs := range multiGlobs.Metrics {
+		for _, metric := range globs.Matches {
+			if strings.HasPrefix(metric.Path, "_tag") {
+				continue
+			}
+			// Tell graphite-web that we have everything
+			var mm map[string]interface{}
+			if config.Config.GraphiteWeb09Compatibility {
+				// graphite-web 0.9.x
+				mm = map[string]interface{}{
+					// graphite-web 0.9.x
+					"metric_path": metric.Path,
+					"isLeaf":      metric.IsLeaf,
+				}
+			} else {
+				// graphite-web 1.0
+				interval := &intervalset.IntervalSet{Start: 0, End: now}
+				mm = map[string]interface{}{
+					"is_leaf":   metric.IsLeaf,
+					"path":      metric.Path,
+					"intervals": interval,
+				}
+			}
+			result = append(result, mm)
+		}
+	}
+
+	var b bytes.Buffer
+	pEnc := pickle.NewEncoder(&b)
+	err := pEnc.Encode(result)
+	return b.Bytes(), err
+}
+
+// findFormats are formats findHandler could respond in
+var findFormats = map[string]bool{
+	treejsonFormat:   true,
+	jsonFormat:       true,
+	"completer":      true,
+	rawFormat:        true,
+	protobufFormat:   true,
+	protobuf3Format:  true,
+	protobufV2Format: true,
+	protobufV3Format: true,
+	pickleFormat:     true,
+}
+
 func findHandler(w http.ResponseWriter, r *http.Request) {
 	t0 := time.Now()
 	uuid := uuid.NewV4()
 	// TODO: Migrate to context.WithTimeout
 	// ctx, _ := context.WithTimeout(context.TODO(), config.Config.ZipperTimeout)
 	ctx := utilctx.SetUUID(r.Context(), uuid.String())
+	if s := shadow; s != nil {
+		ctx = s.sample(ctx)
+	}
 	username, _, _ := r.BasicAuth()
 
 	format := r.FormValue("format")
@@ -175,6 +290,7 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = carbonapipb.AccessLogDetails{
 		Handler:        "find",
 		Username:       username,
+		Tenant:         tenantName(getTenant(ctx)),
 		CarbonapiUUID:  uuid.String(),
 		URL:            r.URL.RequestURI(),
 		PeerIP:         srcIP,
@@ -202,7 +318,7 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if format == "carbonapi_v3_pb" {
+	if format == protobufV3Format {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, "missing request body", http.StatusBadRequest)
@@ -225,8 +341,26 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 	if format == "" {
 		format = treejsonFormat
 	}
+	if !findFormats[format] {
+		setError(w, &accessLogDetails, "unknown format "+format, http.StatusBadRequest)
+		logAsError = true
+		return
+	}
 
-	multiGlobs, stats, err := config.Config.ZipperInstance.Find(ctx, query)
+	var multiGlobs *pb.MultiGlobResponse
+	var stats *zipperTypes.Stats
+	var err error
+	var fromIndex bool
+	if utilctx.GetBackendGroup(ctx) == "" {
+		// index covers all backends, so it can't answer requests routed to a single group
+		multiGlobs, fromIndex = getMetricIndex(getTenant(ctx)).FindAll(query)
+	}
+	if !fromIndex {
+		multiGlobs, stats, err = getTenant(ctx).GetZipper().Find(ctx, query)
+	}
+	if s := shadow; s != nil {
+		s.mirrorFind(ctx, getTenant(ctx), query)
+	}
 	if stats != nil {
 		accessLogDetails.ZipperRequests = stats.ZipperRequests
 		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
@@ -241,7 +375,7 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 	var b []byte
 	switch format {
 	case treejsonFormat, jsonFormat:
-		b, err = findTreejson(multiGlobs)
+		b, err = findTreejson(multiGlobs, parser.TruthyBool(r.FormValue("wildcards")))
 		format = jsonFormat
 	case "completer":
 		b, err = findCompleter(multiGlobs)
@@ -249,43 +383,16 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 	case rawFormat:
 		b, err = findList(multiGlobs)
 		format = rawFormat
-	case protobufFormat, protobuf3Format, "carbonapi_v3_pb":
-		b, err = multiGlobs.Marshal()
+	case protobufFormat, protobuf3Format, protobufV2Format:
+		// carbonapi_v2_pb backends (including other carbonapi instances) expect single GlobResponse
+		b, err = findProtobufV2(multiGlobs, query)
 		format = protobufFormat
-	case "", pickleFormat:
-		var result []map[string]interface{}
-		now := int32(time.Now().Unix() + 60)
-		for _, globs := range multiGlobs.Metrics {
-			for _, metric := range globs.Matches {
-				if strings.HasPrefix(metric.Path, "_tag") {
-					continue
-				}
-				// Tell graphite-web that we have everything
-				var mm map[string]interface{}
-				if config.Config.GraphiteWeb09Compatibility {
-					// graphite-web 0.9.x
-					mm = map[string]interface{}{
-						// graphite-web 0.9.x
-						"metric_path": metric.Path,
-						"isLeaf":      metric.IsLeaf,
-					}
-				} else {
-					// graphite-web 1.0
-					interval := &intervalset.IntervalSet{Start: 0, End: now}
-					mm = map[string]interface{}{
-						"is_leaf":   metric.IsLeaf,
-						"path":      metric.Path,
-						"intervals": interval,
-					}
-				}
-				result = append(result, mm)
-			}
-		}
-
-		p := bytes.NewBuffer(b)
-		pEnc := pickle.NewEncoder(p)
-		err = pEnc.Encode(result)
-		b = p.Bytes()
+	case protobufV3Format:
+		b, err = multiGlobs.Marshal()
+		format = protobufV3Format
+	case pickleFormat:
+		b, err = findPickle(multiGlobs)
+		format = pickleFormat
 	}
 
 	if err != nil {
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	protov2 "github.com/go-graphite/protocol/carbonapi_v2_pb"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindHandlerProtobufV2(t *testing.T) {
+	req, rr := setUpRequest(t, "/metrics/find/?query=foo.*&format=protobuf")
+	findHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+	assert.Equal(t, contentTypeProtobuf, rr.Header().Get("Content-Type"))
+
+	var globs protov2.GlobResponse
+	err := globs.Unmarshal(rr.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "foo.*", globs.Name)
+	assert.Equal(t, []protov2.GlobMatch{{Path: "foo.bar", IsLeaf: true}}, globs.Matches)
+}
+
+func TestFindHandlerProtobufV3(t *testing.T) {
+	body, err := (&pb.MultiGlobRequest{Metrics: []string{"foo.*"}}).Marshal()
+	assert.NoError(t, err)
+	req, err := http.NewRequest("GET", "/metrics/find/?format=carbonapi_v3_pb", bytes.NewReader(body))
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	findHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+	assert.Equal(t, contentTypeProtobufV3, rr.Header().Get("Content-Type"))
+
+	var globs pb.MultiGlobResponse
+	err = globs.Unmarshal(rr.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, *getGlobResponse(), globs)
+}
+
+func TestFindHandlerPickle(t *testing.T) {
+	req, rr := setUpRequest(t, "/metrics/find/?query=foo.*&format=pickle")
+	findHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+	assert.Equal(t, contentTypePickle, rr.Header().Get("Content-Type"))
+
+	assert.Contains(t, rr.Body.String(), "foo.bar")
+}
+
+func TestFindHandlerUnknownFormat(t *testing.T) {
+	req, rr := setUpRequest(t, "/metrics/find/?query=foo.*&format=unknown")
+	findHandler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown format unknown")
+}
+
+func TestFindTreejsonWildcards(t *testing.T) {
+	globs := &pb.MultiGlobResponse{
+		Metrics: []pb.GlobResponse{
+			{
+				Name: "foo.*",
+				Matches: []pb.GlobMatch{
+					{Path: "foo.leaf", IsLeaf: true},
+					{Path: "foo.b", IsLeaf: false},
+					{Path: "foo.a", IsLeaf: false},
+				},
+			},
+		},
+	}
+
+	b, err := findTreejson(globs, true)
+	assert.NoError(t, err)
+	expected := `[{"allowChildren":1,"expandable":1,"leaf":0,"id":"foo.*","text":"*","context":{}},` +
+		`{"allowChildren":1,"expandable":1,"leaf":0,"id":"foo.a","text":"a","context":{}},` +
+		`{"allowChildren":1,"expandable":1,"leaf":0,"id":"foo.b","text":"b","context":{}},` +
+		`{"allowChildren":0,"expandable":0,"leaf":1,"id":"foo.leaf","text":"leaf","context":{}}]` + "\n"
+	assert.Equal(t, expected, string(b))
+
+	b, err = findTreejson(globs, false)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), `"text":"*"`)
+}
@@ -0,0 +1,40 @@
+package http
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// normalizeExpr returns expression with all constant arguments replaced by '?', so queries that differ only
+// in arguments (e.x. scale factor or alias) will be normalized to the same string
+func normalizeExpr(e parser.Expr) string {
+	switch {
+	case e.IsName():
+		return e.Target()
+	case e.IsFunc():
+		args := make([]string, 0, len(e.Args())+len(e.NamedArgs()))
+		for _, arg := range e.Args() {
+			args = append(args, normalizeExpr(arg))
+		}
+		named := make([]string, 0, len(e.NamedArgs()))
+		for k, arg := range e.NamedArgs() {
+			named = append(named, k+"="+normalizeExpr(arg))
+		}
+		sort.Strings(named)
+		args = append(args, named...)
+		return e.Target() + "(" + strings.Join(args, ",") + ")"
+	default:
+		return "?"
+	}
+}
+
+// exprFingerprint returns short hash of normalized expression, it can be used to group similar queries in logs
+func exprFingerprint(e parser.Expr) string {
+	h := fnv.New64a()
+	h.Write([]byte(normalizeExpr(e)))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExprFingerprint(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"scale(foo.bar, 2)", "scale(foo.bar, 10)", true},
+		{"alias(sumSeries(foo.*), 'a')", "alias(sumSeries(foo.*),\"b\")", true},
+		{"movingAverage(foo.bar, windowSize='5min')", "movingAverage(foo.bar, windowSize='1h')", true},
+		{"scale(foo.bar, 2)", "scale(foo.baz, 2)", false},
+		{"sumSeries(foo.bar)", "averageSeries(foo.bar)", false},
+	}
+
+	for _, tt := range tests {
+		a, _, err := parser.ParseExpr(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _, err := parser.ParseExpr(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.same {
+			assert.Equal(t, exprFingerprint(a), exprFingerprint(b), tt.a+" vs "+tt.b)
+		} else {
+			assert.NotEqual(t, exprFingerprint(a), exprFingerprint(b), tt.a+" vs "+tt.b)
+		}
+	}
+}
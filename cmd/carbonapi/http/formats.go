@@ -1 +1,236 @@
 package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/functions/cairo/png"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// MarshalFunc encodes results of render request. Format specific parameters could be read from the request
+type MarshalFunc func(r *http.Request, results []*types.MetricData) ([]byte, error)
+
+// FormatFlags describe capabilities of output format
+type FormatFlags uint
+
+const (
+	// FormatConsolidation means that values are consolidated according to maxDataPoints before marshaling
+	FormatConsolidation FormatFlags = 1 << iota
+	// FormatTags means that tags of series are included in output
+	FormatTags
+	// FormatJSONP means that response is wrapped in callback if jsonp parameter is set
+	FormatJSONP
+)
+
+type outputFormat struct {
+	name        string
+	contentType string
+	marshal     MarshalFunc
+	flags       FormatFlags
+	pointSize   int
+}
+
+var formats = make(map[string]*outputFormat)
+
+// acceptTypes maps MIME types of Accept header to formats, the first format registered for the type is used
+var acceptTypes = make(map[string]string)
+
+// RegisterFormat adds output format of render requests or replaces existing one. Formats are selected by format
+// parameter or by Accept header if parameter is not set. pointSize is approximate size of one point in response in
+// bytes, it's used to reject responses larger than maxResponseSize before marshaling, 0 means that size of response
+// doesn't depend on amount of points. Must be called before handlers are initialized
+func RegisterFormat(name, contentType string, marshal MarshalFunc, flags FormatFlags, pointSize int) {
+	formats[name] = &outputFormat{
+		name:        name,
+		contentType: contentType,
+		marshal:     marshal,
+		flags:       flags,
+		pointSize:   pointSize,
+	}
+	if _, ok := acceptTypes[contentType]; !ok {
+		acceptTypes[contentType] = name
+	}
+}
+
+func lookupFormat(name string) (*outputFormat, bool) {
+	f, ok := formats[name]
+	return f, ok
+}
+
+func (f *outputFormat) has(flags FormatFlags) bool {
+	return f.flags&flags == flags
+}
+
+// Formats returns names of registered formats in alphabetical order
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MarshalResults marshals series to the format like render request does: values are consolidated according to
+// maxDataPoints parameter of the request if format supports it, other parameters are read by marshaler
+func MarshalResults(r *http.Request, format string, results []*types.MetricData) ([]byte, error) {
+	f, ok := lookupFormat(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+	maxDataPoints, _ := strconv.Atoi(r.FormValue("maxDataPoints"))
+	return f.marshalResults(r, results, maxDataPoints)
+}
+
+// marshalResults consolidates values to maxDataPoints if format supports it and marshals results. Consolidated values
+// are dropped after that, as series could outlive the request (e.x. be cached)
+func (f *outputFormat) marshalResults(r *http.Request, results []*types.MetricData, maxDataPoints int) ([]byte, error) {
+	if f.has(FormatConsolidation) && maxDataPoints != 0 {
+		if err := types.ConsolidateJSON(maxDataPoints, results); err != nil {
+			return nil, err
+		}
+	}
+	body, err := f.marshal(r, results)
+	for _, res := range results {
+		res.ResetAggregatedValues()
+	}
+	return body, err
+}
+
+// seriesOverhead is approximate size of series in response apart from its name and points
+const seriesOverhead = 64
+
+// estimateSize returns approximate size of response in bytes. maxDataPoints is ignored if format doesn't consolidate
+// values
+func (f *outputFormat) estimateSize(results []*types.MetricData, maxDataPoints int) int {
+	if f.pointSize == 0 {
+		return 0
+	}
+
+	size := 0
+	for _, r := range results {
+		points := len(r.Values)
+		if f.has(FormatConsolidation) && maxDataPoints > 0 && points > maxDataPoints {
+			points = maxDataPoints
+		}
+		size += seriesOverhead + len(r.Name) + points*f.pointSize
+	}
+	return size
+}
+
+// suggestMaxDataPoints returns maxDataPoints that fits response of results into limit or 0 if there is no such value
+func (f *outputFormat) suggestMaxDataPoints(results []*types.MetricData, limit int) int {
+	if f.pointSize == 0 || !f.has(FormatConsolidation) || len(results) == 0 {
+		return 0
+	}
+
+	for _, r := range results {
+		limit -= seriesOverhead + len(r.Name)
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return limit / (len(results) * f.pointSize)
+}
+
+// formatFromAccept returns format for the first MIME type of Accept header that has registered format or empty
+// string if there is no such type. Quality values are ignored
+func formatFromAccept(accept string) string {
+	for _, t := range strings.Split(accept, ",") {
+		if i := strings.IndexByte(t, ';'); i >= 0 {
+			t = t[:i]
+		}
+		if name, ok := acceptTypes[strings.TrimSpace(t)]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func marshalJSON(r *http.Request, results []*types.MetricData) ([]byte, error) {
+	precision := config.Config.JSONFloatPrecision
+	if p, err := strconv.Atoi(r.FormValue("jsonFloatPrecision")); err == nil {
+		precision = p
+	}
+	b := types.MarshalJSONWithPrecision(results, precision)
+	if !parser.TruthyBool(r.FormValue("meta")) {
+		return b, nil
+	}
+
+	// envelope with metadata is opt-in, as graphite-web returns bare list of series
+	warnings := deprecationWarnings(r.Form["target"], config.Current().DeprecatedFunctions)
+	if warnings == nil {
+		warnings = []string{}
+	}
+	w, err := json.Marshal(warnings)
+	if err != nil {
+		return nil, err
+	}
+	errors := getTargetErrors(r.Context())
+	if errors == nil {
+		errors = map[string]string{}
+	}
+	e, err := json.Marshal(errors)
+	if err != nil {
+		return nil, err
+	}
+	var env []byte
+	env = append(env, `{"series":`...)
+	env = append(env, b...)
+	env = append(env, `,"meta":{"warnings":`...)
+	env = append(env, w...)
+	env = append(env, `,"errors":`...)
+	env = append(env, e...)
+	env = append(env, "}}"...)
+	return env, nil
+}
+
+// wrapMarshal adapts marshalers that can't fail
+func wrapMarshal(marshal func([]*types.MetricData) []byte) MarshalFunc {
+	return func(r *http.Request, results []*types.MetricData) ([]byte, error) {
+		return marshal(results), nil
+	}
+}
+
+func init() {
+	RegisterFormat(jsonFormat, contentTypeJSON, marshalJSON, FormatConsolidation|FormatTags|FormatJSONP, 24)
+	RegisterFormat(graphlotFormat, contentTypeJSON, wrapMarshal(types.MarshalGraphlot), FormatJSONP, 12)
+	RegisterFormat(dygraphFormat, contentTypeJSON, wrapMarshal(types.MarshalDygraph), FormatConsolidation|FormatJSONP, 16)
+	RegisterFormat(rickshawFormat, contentTypeJSON, wrapMarshal(types.MarshalRickshaw), FormatConsolidation|FormatJSONP, 26)
+	RegisterFormat(c3Format, contentTypeJSON, wrapMarshal(types.MarshalC3), FormatConsolidation|FormatJSONP, 12)
+	RegisterFormat(evalFormat, contentTypeJSON, marshalEval, FormatTags, 0)
+	RegisterFormat(thresholdFormat, contentTypeJSON, marshalThreshold, FormatTags, 0)
+	RegisterFormat(debugFormat, contentTypeJSON, marshalDebug, FormatConsolidation|FormatTags|FormatJSONP, 24)
+
+	protobufV3 := func(r *http.Request, results []*types.MetricData) ([]byte, error) {
+		return types.MarshalProtobufV3(results)
+	}
+	// protobuf and protobuf3 are carbonapi_v3_pb, as they always were
+	RegisterFormat(protobufFormat, contentTypeProtobuf, protobufV3, 0, 9)
+	RegisterFormat(protobuf3Format, contentTypeProtobuf, protobufV3, 0, 9)
+	RegisterFormat(protobufV2Format, contentTypeProtobuf, func(r *http.Request, results []*types.MetricData) ([]byte, error) {
+		return types.MarshalProtobufV2(results)
+	}, 0, 10)
+	RegisterFormat(protobufV3Format, contentTypeProtobufV3, protobufV3, 0, 9)
+
+	RegisterFormat(rawFormat, contentTypeRaw, wrapMarshal(types.MarshalRaw), 0, 12)
+	RegisterFormat(csvFormat, contentTypeCSV, func(r *http.Request, results []*types.MetricData) ([]byte, error) {
+		return types.MarshalCSVHumanized(results, r.FormValue("humanize")), nil
+	}, 0, 48)
+	RegisterFormat(pickleFormat, contentTypePickle, wrapMarshal(types.MarshalPickle), 0, 10)
+	RegisterFormat(parquetFormat, contentTypeParquet, wrapMarshal(types.MarshalParquet), 0, 24)
+
+	RegisterFormat(pngFormat, contentTypePNG, func(r *http.Request, results []*types.MetricData) ([]byte, error) {
+		return png.MarshalPNGRequest(r, results, r.FormValue("template")), nil
+	}, 0, 0)
+	RegisterFormat(svgFormat, contentTypeSVG, func(r *http.Request, results []*types.MetricData) ([]byte, error) {
+		return png.MarshalSVGRequest(r, results, r.FormValue("template")), nil
+	}, 0, 16)
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderFormats(t *testing.T) {
+	RegisterFormat("names", "text/x-names", func(r *http.Request, results []*types.MetricData) ([]byte, error) {
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Name)
+		}
+		return []byte(strings.Join(names, "\n")), nil
+	}, 0, 0)
+	defer delete(formats, "names")
+	defer delete(acceptTypes, "text/x-names")
+
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=names&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/x-names", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "foo.bar", rr.Body.String())
+
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&noCache=1")
+	req.Header.Set("Accept", "text/html, text/x-names;q=0.9, */*")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/x-names", rr.Header().Get("Content-Type"))
+
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&noCache=1")
+	req.Header.Set("Accept", "application/json")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, contentTypeJSON, rr.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(rr.Body.String(), `[{"target":"foo.bar"`))
+
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=unknown")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -2,7 +2,9 @@ package http
 
 import (
 	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -22,63 +24,99 @@ type requestInterval struct {
 }
 
 const (
-	jsonFormat      = "json"
-	treejsonFormat  = "treejson"
-	pngFormat       = "png"
-	csvFormat       = "csv"
-	rawFormat       = "raw"
-	svgFormat       = "svg"
-	protobufFormat  = "protobuf"
-	protobuf3Format = "protobuf3"
-	pickleFormat    = "pickle"
+	jsonFormat       = "json"
+	treejsonFormat   = "treejson"
+	pngFormat        = "png"
+	csvFormat        = "csv"
+	rawFormat        = "raw"
+	svgFormat        = "svg"
+	protobufFormat   = "protobuf"
+	protobuf3Format  = "protobuf3"
+	protobufV2Format = "carbonapi_v2_pb"
+	protobufV3Format = "carbonapi_v3_pb"
+	pickleFormat     = "pickle"
+	graphlotFormat   = "graphlot"
+	dygraphFormat    = "dygraph"
+	rickshawFormat   = "rickshaw"
+	c3Format         = "c3"
+	evalFormat       = "eval"
+	thresholdFormat  = "threshold"
+	debugFormat      = "debug"
+	parquetFormat    = "parquet"
 )
 
 const (
 	contentTypeJSON       = "application/json"
 	contentTypeProtobuf   = "application/x-protobuf"
+	contentTypeProtobufV3 = "application/x-carbonapi-v3-pb"
 	contentTypeJavaScript = "text/javascript"
 	contentTypeRaw        = "text/plain"
 	contentTypePickle     = "application/pickle"
 	contentTypePNG        = "image/png"
 	contentTypeCSV        = "text/csv"
 	contentTypeSVG        = "image/svg+xml"
+	contentTypeParquet    = "application/vnd.apache.parquet"
 )
 
+// warningsHeader contains warnings about the request, e.x. usage of deprecated functions, one per value
+const warningsHeader = "X-Carbonapi-Warnings"
+
+// targetErrorsHeader contains errors of targets, that are omitted from partial response, one per value as
+// "<target>: <error>"
+const targetErrorsHeader = "X-Carbonapi-Target-Errors"
+
 func writeResponse(w http.ResponseWriter, b []byte, format string, jsonp string) {
+	f, ok := lookupFormat(format)
+	if !ok {
+		return
+	}
 
-	switch format {
-	case jsonFormat:
-		if jsonp != "" {
-			w.Header().Set("Content-Type", contentTypeJavaScript)
-			w.Write([]byte(jsonp))
-			w.Write([]byte{'('})
-			w.Write(b)
-			w.Write([]byte{')'})
-		} else {
-			w.Header().Set("Content-Type", contentTypeJSON)
-			w.Write(b)
-		}
-	case protobufFormat, protobuf3Format:
-		w.Header().Set("Content-Type", contentTypeProtobuf)
-		w.Write(b)
-	case rawFormat:
-		w.Header().Set("Content-Type", contentTypeRaw)
-		w.Write(b)
-	case pickleFormat:
-		w.Header().Set("Content-Type", contentTypePickle)
+	if jsonp != "" && f.has(FormatJSONP) {
+		w.Header().Set("Content-Type", contentTypeJavaScript)
+		w.Write([]byte(jsonp))
+		w.Write([]byte{'('})
 		w.Write(b)
-	case csvFormat:
-		w.Header().Set("Content-Type", contentTypeCSV)
-		w.Write(b)
-	case pngFormat:
-		w.Header().Set("Content-Type", contentTypePNG)
-		w.Write(b)
-	case svgFormat:
-		w.Header().Set("Content-Type", contentTypeSVG)
+		w.Write([]byte{')'})
+	} else {
+		w.Header().Set("Content-Type", f.contentType)
 		w.Write(b)
 	}
 }
 
+// responseETag returns strong ETag for the response, it depends only on response content
+func responseETag(b []byte, jsonp string) string {
+	h := fnv.New64a()
+	h.Write([]byte(jsonp))
+	h.Write(b)
+	return `"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// etagMatches checks if etag is listed in If-None-Match header value
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResponseIfModified sets ETag header and responds with 304 Not Modified if client already have the same
+// response, otherwise response is written as usual. Returns HTTP status code that was sent.
+func writeResponseIfModified(w http.ResponseWriter, r *http.Request, b []byte, format string, jsonp string) int {
+	etag := responseETag(b, jsonp)
+	w.Header().Set("ETag", etag)
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return http.StatusNotModified
+	}
+
+	writeResponse(w, b, format, jsonp)
+	return http.StatusOK
+}
+
 func bucketRequestTimes(req *http.Request, t time.Duration) {
 	logger := zapwriter.Logger("slow")
 
@@ -128,9 +166,11 @@ func buildParseErrorString(target, e string, err error) string {
 func deferredAccessLogging(accessLogger *zap.Logger, accessLogDetails *carbonapipb.AccessLogDetails, t time.Time, logAsError bool) {
 	accessLogDetails.Runtime = time.Since(t).Seconds()
 	if logAsError {
-		accessLogger.Error("request failed", zap.Any("data", *accessLogDetails))
+		accessLogger.Error("request failed", zap.Object("data", accessLogDetails.LogObject(config.Current().AccessLog.Fields())))
 	} else {
-		accessLogDetails.HTTPCode = http.StatusOK
-		accessLogger.Info("request served", zap.Any("data", *accessLogDetails))
+		if accessLogDetails.HTTPCode == 0 {
+			accessLogDetails.HTTPCode = http.StatusOK
+		}
+		accessLogger.Info("request served", zap.Object("data", accessLogDetails.LogObject(config.Current().AccessLog.Fields())))
 	}
 }
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAccessLogExcludeFields(t *testing.T) {
+	details := &carbonapipb.AccessLogDetails{
+		Handler:      "render",
+		Targets:      []string{"foo.bar"},
+		URL:          "/render/?target=foo.bar",
+		HTTPCode:     200,
+		TargetErrors: map[string]string{"foo(": "parse error"},
+		EvalRuntime:  0.25,
+	}
+
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zapcore.EncoderConfig{}), zapcore.AddSync(&buf), zap.InfoLevel))
+	logAccess := func() map[string]interface{} {
+		buf.Reset()
+		deferredAccessLogging(logger, details, time.Now(), false)
+		var data struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &data), buf.String())
+		delete(data.Data, "runtime")
+		return data.Data
+	}
+
+	// fields are written as json of details would be
+	expected := map[string]interface{}{}
+	b, err := json.Marshal(details)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(b, &expected))
+	delete(expected, "runtime")
+	assert.Equal(t, expected, logAccess())
+
+	defer func(accessLog config.AccessLogConfig) { config.Config.AccessLog = accessLog }(config.Config.AccessLog)
+	assert.NoError(t, config.Config.AccessLog.SetExcludeFields([]string{"url", "targets"}))
+	data := logAccess()
+	assert.Equal(t, "render", data["handler"])
+	assert.NotContains(t, data, "url")
+	assert.NotContains(t, data, "targets")
+
+	assert.Error(t, config.Config.AccessLog.SetExcludeFields([]string{"no_such_field"}))
+	assert.Equal(t, []string{"url", "targets"}, config.Config.AccessLog.ExcludeFields)
+}
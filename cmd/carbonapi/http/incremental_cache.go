@@ -0,0 +1,226 @@
+package http
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/dgryski/go-expirecache"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// incrementalCache keeps immutable part of series fetched by requests that end at now. The next request of the same
+// path expression (e.x. auto-refresh of a dashboard) fetches only points after the cached ones, result is stitched
+// from cached and fetched series
+type incrementalCache struct {
+	ec *expirecache.Cache
+	// points newer than now - mutableWindow could be changed by backends (not yet written or aggregated), so they are
+	// always fetched
+	mutableWindow int64
+	ttl           int32
+}
+
+// incrementalEntry contains series of a path expression fetched for a request that started at from. Each series
+// is cut at the start of the mutable window
+type incrementalEntry struct {
+	from   int64
+	until  int64
+	series []types.PackedSeries
+}
+
+var incrementalFetchCache *incrementalCache
+
+func initIncrementalCache(cfg config.IncrementalCacheConfig) {
+	if cfg.Size <= 0 {
+		incrementalFetchCache = nil
+		return
+	}
+	c := &incrementalCache{
+		ec:            expirecache.New(uint64(cfg.Size * 1024 * 1024)),
+		mutableWindow: int64(cfg.MutableWindow.Seconds()),
+		ttl:           int32(cfg.TTL.Seconds()),
+	}
+	go c.ec.ApproximateCleaner(10 * time.Second)
+	incrementalFetchCache = c
+}
+
+// eligibleRequests returns requests, that end within the mutable window, by path expression. Path expressions that
+// are requested several times (e.x. with different windows or expanded by indexes) and requests with filtering
+// functions, that select series by values of the whole range, are fetched as usual
+func (c *incrementalCache) eligibleRequests(req pb.MultiFetchRequest, now int64) map[string]pb.FetchRequest {
+	count := make(map[string]int)
+	for _, m := range req.Metrics {
+		count[m.PathExpression]++
+	}
+	eligible := make(map[string]pb.FetchRequest)
+	for _, m := range req.Metrics {
+		if count[m.PathExpression] == 1 && len(m.FilterFunctions) == 0 && m.StopTime > now-c.mutableWindow {
+			eligible[m.PathExpression] = m
+		}
+	}
+	return eligible
+}
+
+func (c *incrementalCache) get(key string) *incrementalEntry {
+	if v, ok := c.ec.Get(key); ok {
+		return v.(*incrementalEntry)
+	}
+	return nil
+}
+
+// set caches points of series that are older than the mutable window
+func (c *incrementalCache) set(key string, m pb.FetchRequest, series []*types.MetricData, now int64) {
+	if len(series) == 0 {
+		return
+	}
+	entry := &incrementalEntry{from: m.StartTime, until: math.MaxInt64}
+	var size uint64
+	for _, s := range series {
+		if s.StepTime <= 0 {
+			return
+		}
+		cut := types.PackSeries(s.Slice(s.StartTime, now-c.mutableWindow))
+		if stop := cut.Series().StopTime; stop < entry.until {
+			entry.until = stop
+		}
+		entry.series = append(entry.series, cut)
+		size += cut.Size()
+	}
+	if entry.until <= entry.from {
+		return
+	}
+	c.ec.Set(key, entry, size, c.ttl)
+}
+
+// stitch appends fetched points to the cached series. Series are stitched only if the same series were fetched with
+// the same steps, false is returned otherwise (e.x. new series matched the glob), so the whole range is refetched
+func stitch(entry *incrementalEntry, m pb.FetchRequest, delta []*types.MetricData) ([]*types.MetricData, bool) {
+	if len(delta) != len(entry.series) {
+		return nil, false
+	}
+	byName := make(map[string]*types.MetricData, len(delta))
+	for _, d := range delta {
+		byName[d.Name] = d
+	}
+
+	res := make([]*types.MetricData, 0, len(entry.series))
+	for _, packed := range entry.series {
+		cached := packed.Series()
+		d, ok := byName[cached.Name]
+		if !ok || d.StepTime != cached.StepTime || (d.StartTime-cached.StartTime)%cached.StepTime != 0 {
+			return nil, false
+		}
+		s := packed.Unpack().Slice(m.StartTime+1, cached.StopTime)
+		values := make([]float64, len(s.Values), len(s.Values)+len(d.Values))
+		copy(values, s.Values)
+		for t := s.StopTime; t < d.StartTime; t += s.StepTime {
+			values = append(values, math.NaN())
+		}
+		skip := 0
+		if d.StartTime < s.StopTime {
+			skip = int((s.StopTime - d.StartTime) / s.StepTime)
+		}
+		if skip < len(d.Values) {
+			values = append(values, d.Values[skip:]...)
+		}
+
+		s.Values = values
+		s.StopTime = s.StartTime + int64(len(values))*s.StepTime
+		s.RequestStartTime = m.StartTime
+		s.RequestStopTime = m.StopTime
+		res = append(res, s)
+	}
+	return res, true
+}
+
+// render fetches requests, only points after cached ones are fetched for path expressions found in the cache.
+// Results of all eligible requests are cached for the next requests
+func (c *incrementalCache) render(ctx context.Context, zipper interfaces.CarbonZipper, tenant *config.TenantConfig, req pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	now := timeNow().Unix()
+	eligible := c.eligibleRequests(req, now)
+	if len(eligible) == 0 {
+		return zipper.Render(ctx, req)
+	}
+	keyPrefix := tenantName(tenant) + "\x00" + utilctx.GetBackendGroup(ctx) + "\x00"
+
+	entries := make(map[string]*incrementalEntry)
+	var fetch pb.MultiFetchRequest
+	for _, m := range req.Metrics {
+		if _, ok := eligible[m.PathExpression]; ok {
+			entry := c.get(keyPrefix + m.PathExpression)
+			if entry != nil && entry.from <= m.StartTime && entry.until > m.StartTime && entry.until < m.StopTime {
+				entries[m.PathExpression] = entry
+				// points with timestamps in (from, until] are returned
+				m.StartTime = entry.until - 1
+				ApiMetrics.IncrementalCacheHits.Add(1)
+			} else {
+				ApiMetrics.IncrementalCacheMisses.Add(1)
+			}
+		}
+		fetch.Metrics = append(fetch.Metrics, m)
+	}
+
+	r, stats, err := zipper.Render(ctx, fetch)
+	if len(entries) > 0 {
+		r, stats, err = c.stitchAll(ctx, zipper, eligible, entries, r, stats, err)
+	}
+
+	byPathExpr := make(map[string][]*types.MetricData)
+	for _, s := range r {
+		byPathExpr[s.PathExpression] = append(byPathExpr[s.PathExpression], s)
+	}
+	for pathExpression, m := range eligible {
+		c.set(keyPrefix+pathExpression, m, byPathExpr[pathExpression], now)
+	}
+	return r, stats, err
+}
+
+// stitchAll replaces delta series with stitched ones. Path expressions that couldn't be stitched are refetched with
+// the original time range
+func (c *incrementalCache) stitchAll(ctx context.Context, zipper interfaces.CarbonZipper, eligible map[string]pb.FetchRequest, entries map[string]*incrementalEntry,
+	r []*types.MetricData, stats *zipperTypes.Stats, err error) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	deltas := make(map[string][]*types.MetricData)
+	res := make([]*types.MetricData, 0, len(r))
+	for _, s := range r {
+		if _, ok := entries[s.PathExpression]; ok {
+			deltas[s.PathExpression] = append(deltas[s.PathExpression], s)
+		} else {
+			res = append(res, s)
+		}
+	}
+
+	var refetch pb.MultiFetchRequest
+	for pathExpression, entry := range entries {
+		stitched, ok := stitch(entry, eligible[pathExpression], deltas[pathExpression])
+		if !ok {
+			ApiMetrics.IncrementalCacheRefetches.Add(1)
+			refetch.Metrics = append(refetch.Metrics, eligible[pathExpression])
+			continue
+		}
+		res = append(res, stitched...)
+	}
+	if len(refetch.Metrics) > 0 {
+		refetched, refetchStats, refetchErr := zipper.Render(ctx, refetch)
+		if stats == nil {
+			stats = refetchStats
+		} else if refetchStats != nil {
+			stats.Merge(refetchStats)
+		}
+		if err == nil {
+			err = refetchErr
+		}
+		res = append(res, refetched...)
+	}
+
+	// stitched series are found even if nothing was fetched after cached points
+	if len(res) > 0 && (err == zipperTypes.ErrNotFound || err == zipperTypes.ErrNoMetricsFetched) {
+		err = nil
+	}
+	return res, stats, err
+}
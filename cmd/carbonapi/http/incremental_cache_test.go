@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+type incrementalMockZipper struct {
+	mockCarbonZipper
+	requests []pb.MultiFetchRequest
+}
+
+// Render returns points with timestamps in (from, until], value of the point is its timestamp in minutes
+func (z *incrementalMockZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	z.requests = append(z.requests, request)
+	var res []*types.MetricData
+	for _, m := range request.Metrics {
+		start := m.StartTime - m.StartTime%60 + 60
+		var values []float64
+		for ts := start; ts <= m.StopTime; ts += 60 {
+			values = append(values, float64(ts/60))
+		}
+		r := types.MakeMetricData(m.Name, values, 60, start)
+		r.PathExpression = m.PathExpression
+		r.RequestStartTime = m.StartTime
+		r.RequestStopTime = m.StopTime
+		res = append(res, r)
+	}
+	return res, nil, nil
+}
+
+func TestIncrementalCache(t *testing.T) {
+	z := &incrementalMockZipper{}
+	defer useZipper(z)()
+	origCache, origNow := config.Config.QueryCache, timeNow
+	config.Config.QueryCache = cache.NullCache{}
+	initIncrementalCache(config.IncrementalCacheConfig{Size: 1, MutableWindow: 2 * time.Minute, TTL: time.Hour})
+	defer func() {
+		config.Config.QueryCache, timeNow = origCache, origNow
+		initIncrementalCache(config.IncrementalCacheConfig{})
+	}()
+
+	now := int64(1510913700)
+	timeNow = func() time.Time { return time.Unix(now, 0) }
+	render := func() [][2]float64 {
+		req, rr := setUpRequest(t, fmt.Sprintf("/render/?format=json&target=foo.bar&from=%d&until=%d", now-3600, now))
+		renderHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var series []struct {
+			Datapoints [][2]float64 `json:"datapoints"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &series))
+		if !assert.Len(t, series, 1) {
+			return nil
+		}
+		return series[0].Datapoints
+	}
+	assertPoints := func(points [][2]float64) {
+		if assert.Len(t, points, 60) {
+			for i, p := range points {
+				ts := now - 3540 + int64(i)*60
+				assert.Equal(t, [2]float64{float64(ts / 60), float64(ts)}, p)
+			}
+		}
+	}
+
+	assertPoints(render())
+	hits := ApiMetrics.IncrementalCacheHits.Value()
+
+	// only points after the cached ones are fetched, the last ones are in the mutable window
+	now += 300
+	assertPoints(render())
+	assert.Equal(t, hits+1, ApiMetrics.IncrementalCacheHits.Value())
+	if assert.Len(t, z.requests, 2) {
+		assert.Equal(t, now-300-121, z.requests[1].Metrics[0].StartTime)
+		assert.Equal(t, now, z.requests[1].Metrics[0].StopTime)
+	}
+
+	// noCache requests fetch the whole range
+	req, rr := setUpRequest(t, fmt.Sprintf("/render/?format=json&target=foo.bar&from=%d&until=%d&noCache=1", now-3600, now))
+	renderHandler(rr, req)
+	if assert.Len(t, z.requests, 3) {
+		assert.Equal(t, now-3600, z.requests[2].Metrics[0].StartTime)
+	}
+}
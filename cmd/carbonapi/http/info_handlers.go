@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
-	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 
 	"github.com/lomik/zapwriter"
@@ -34,6 +33,7 @@ func infoHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = carbonapipb.AccessLogDetails{
 		Handler:        "info",
 		Username:       username,
+		Tenant:         tenantName(getTenant(ctx)),
 		CarbonapiUUID:  uuid.String(),
 		URL:            r.URL.RequestURI(),
 		PeerIP:         srcIP,
@@ -59,7 +59,7 @@ func infoHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, stats, err := config.Config.ZipperInstance.Info(ctx, query)
+	data, stats, err := getTenant(ctx).GetZipper().Info(ctx, query)
 	if stats != nil {
 		accessLogDetails.ZipperRequests = stats.ZipperRequests
 		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
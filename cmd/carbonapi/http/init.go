@@ -7,13 +7,27 @@ import (
 
 	"github.com/dgryski/httputil"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr"
 	"github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
 )
 
 func InitHandlers(headersToPass, headersToLog []string) *http.ServeMux {
 	r := http.NewServeMux()
 	r.HandleFunc(config.Config.Prefix+"/render/", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(renderHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
 	r.HandleFunc(config.Config.Prefix+"/render", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(renderHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+	r.HandleFunc(config.Config.Prefix+"/render/explain", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(explainHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+	r.HandleFunc(config.Config.Prefix+"/render/diff", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(diffHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+
+	r.HandleFunc(config.Config.Prefix+"/graphlot/rawdata", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(graphlotRawdataHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+
+	r.HandleFunc(config.Config.Prefix+"/eval", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(evalHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+	r.HandleFunc(config.Config.Prefix+"/eval/", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(evalHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+	r.HandleFunc(config.Config.Prefix+"/threshold/", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(thresholdHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+	r.HandleFunc(config.Config.Prefix+"/threshold", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(thresholdHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+	r.HandleFunc(config.Config.Prefix+"/lint", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(lintHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
+	r.HandleFunc(config.Config.Prefix+"/lint/", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(lintHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
 
 	r.HandleFunc(config.Config.Prefix+"/metrics/find/", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(findHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
 	r.HandleFunc(config.Config.Prefix+"/metrics/find", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(findHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
@@ -26,14 +40,60 @@ func InitHandlers(headersToPass, headersToLog []string) *http.ServeMux {
 	r.HandleFunc(config.Config.Prefix+"/version", versionHandler)
 	r.HandleFunc(config.Config.Prefix+"/version/", versionHandler)
 
+	r.HandleFunc(config.Config.Prefix+"/status", statusHandler)
+	r.HandleFunc(config.Config.Prefix+"/status/", statusHandler)
+
 	r.HandleFunc(config.Config.Prefix+"/functions", enrichContextWithHeaders(headersToPass, headersToLog, functionsHandler))
 	r.HandleFunc(config.Config.Prefix+"/functions/", enrichContextWithHeaders(headersToPass, headersToLog, functionsHandler))
 
 	r.HandleFunc(config.Config.Prefix+"/tags", enrichContextWithHeaders(headersToPass, headersToLog, tagHandler))
 	r.HandleFunc(config.Config.Prefix+"/tags/", enrichContextWithHeaders(headersToPass, headersToLog, tagHandler))
 
+	r.HandleFunc(config.Config.Prefix+"/queries", enrichContextWithHeaders(headersToPass, headersToLog, savedQueriesHandler))
+	r.HandleFunc(config.Config.Prefix+"/queries/", enrichContextWithHeaders(headersToPass, headersToLog, savedQueriesHandler))
+
+	r.HandleFunc(config.Config.Prefix+"/dashboard/", enrichContextWithHeaders(headersToPass, headersToLog, dashboardHandler))
+
+	r.HandleFunc(config.Config.Prefix+"/export", enrichContextWithHeaders(headersToPass, headersToLog, exportHandler))
+	r.HandleFunc(config.Config.Prefix+"/export/", enrichContextWithHeaders(headersToPass, headersToLog, exportHandler))
+
 	r.HandleFunc(config.Config.Prefix+"/", enrichContextWithHeaders(headersToPass, headersToLog, usageHandler))
 
+	initTagIndexes(config.Config.TagIndex)
+	initMetricIndexes(config.Config.MetricIndex)
+	initScheduler(config.Config.Scheduler, config.Config.Reporting)
+	initIncrementalCache(config.Config.IncrementalCache)
+	initChunkedFetch(config.Config.ChunkedFetch)
+	if err := initShadowTraffic(config.Config.ShadowTraffic, config.Config.Upstreams.BackendsV2.Backends); err != nil {
+		zapwriter.Logger("shadow").Fatal("failed to init shadow traffic",
+			zap.Error(err),
+		)
+	}
+	initSavedQueries(config.Config.SavedQueries)
+	initDashboards(config.Config.Dashboards)
+	initExport(config.Config.Export)
+
+	// index of cached responses shouldn't take more memory than the cache itself
+	queryCacheIndex = newCacheIndex(config.Config.Cache.Size * 1024 * 1024)
+
+	if config.Config.TopQueries.Size > 0 {
+		topQueriesTracker = newTopQueries(config.Config.TopQueries.Size, config.Config.TopQueries.Window)
+	}
+
+	if cfg := config.Config.FunctionCache; cfg.Size > 0 {
+		expr.SetFunctionCache(expr.NewFunctionCache(uint64(cfg.Size*1024*1024), int32(cfg.TTL.Seconds()), cfg.Functions))
+	}
+
+	if cfg := config.Config.FunctionComparison; len(cfg.Functions) > 0 {
+		expr.SetFunctionComparison(expr.NewFunctionComparison(cfg.Functions, cfg.Tolerance))
+	}
+
+	if config.Config.Admin.Enabled {
+		if config.Config.Admin.Listen == "" || config.Config.Admin.Listen == config.Config.Listen {
+			InitAdminHandlers(r)
+		}
+	}
+
 	if config.Config.Expvar.Enabled {
 		if config.Config.Expvar.Listen == "" || config.Config.Expvar.Listen == config.Config.Listen {
 			r.HandleFunc(config.Config.Prefix+"/debug/vars", expvar.Handler().ServeHTTP)
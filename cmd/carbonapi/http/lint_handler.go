@@ -0,0 +1,297 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+type lintDiagnostic struct {
+	Severity string `json:"severity"`
+	Function string `json:"function,omitempty"`
+	Message  string `json:"message"`
+}
+
+// lintCost is a rough estimation of query cost, that is known without fetching data
+type lintCost struct {
+	// Fetches is a number of path expressions that are fetched from backends
+	Fetches int `json:"fetches"`
+	// Wildcards is a number of fetched path expressions that contain globs
+	Wildcards int `json:"wildcards"`
+	// Functions is a number of function calls
+	Functions int `json:"functions"`
+	// TimeRange is a requested time range in seconds
+	TimeRange int64 `json:"time_range"`
+}
+
+type lintTarget struct {
+	Target      string           `json:"target"`
+	Diagnostics []lintDiagnostic `json:"diagnostics"`
+	Cost        lintCost         `json:"cost"`
+}
+
+type lintResponse struct {
+	Valid   bool         `json:"valid"`
+	Targets []lintTarget `json:"targets"`
+}
+
+// lintHandler serves /lint (and /render with validateOnly=1): targets are parsed and checked against descriptions of
+// functions without fetching any data. Response is always 200 if request is well-formed, 'valid' is false if any
+// target has errors. Warnings (e.x. deprecated functions) don't affect validity
+func lintHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	targets := r.Form["target"]
+	if len(targets) == 0 {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": no targets", http.StatusBadRequest)
+		return
+	}
+
+	tenant := getTenant(r.Context())
+	qtz := r.FormValue("tz")
+	from := date.DateParamToEpoch(r.FormValue("from"), qtz, timeNow().Add(-24*time.Hour).Unix(), tenant.GetTimeZone())
+	until := date.DateParamToEpoch(r.FormValue("until"), qtz, timeNow().Unix(), tenant.GetTimeZone())
+
+	resp := lintResponse{Valid: true}
+	for _, target := range targets {
+		t := lintTargetExpr(target, config.Current().DeprecatedFunctions)
+		t.Cost.TimeRange = until - from
+		for _, d := range t.Diagnostics {
+			if d.Severity == lintError {
+				resp.Valid = false
+			}
+		}
+		resp.Targets = append(resp.Targets, t)
+	}
+
+	writeJSON(w, resp)
+}
+
+// lintTargetExpr parses target and checks all function calls, deprecated maps names of deprecated functions to hints
+func lintTargetExpr(target string, deprecated map[string]string) lintTarget {
+	t := lintTarget{Target: target, Diagnostics: []lintDiagnostic{}}
+	exp, e, err := parser.ParseExpr(target)
+	if err != nil || e != "" {
+		t.Diagnostics = append(t.Diagnostics, lintDiagnostic{
+			Severity: lintError,
+			Message:  buildParseErrorString(target, e, err),
+		})
+		return t
+	}
+
+	for _, m := range exp.Metrics() {
+		t.Cost.Fetches++
+		if strings.ContainsAny(m.Metric, "*?[{") {
+			t.Cost.Wildcards++
+		}
+		if strings.HasPrefix(m.Metric, "*") {
+			t.Diagnostics = append(t.Diagnostics, lintDiagnostic{
+				Severity: lintWarning,
+				Message:  fmt.Sprintf("'%s' starts with wildcard, whole metric tree is searched", m.Metric),
+			})
+		}
+	}
+
+	metadata.FunctionMD.RLock()
+	defer metadata.FunctionMD.RUnlock()
+	lintCall(&t, exp, deprecated)
+	return t
+}
+
+// lintCall checks function call and its arguments recursively, metadata should be locked
+func lintCall(t *lintTarget, exp parser.Expr, deprecated map[string]string) {
+	if !exp.IsFunc() {
+		return
+	}
+	name := exp.Target()
+	t.Cost.Functions++
+	report := func(severity, format string, args ...interface{}) {
+		t.Diagnostics = append(t.Diagnostics, lintDiagnostic{
+			Severity: severity,
+			Function: name,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	named := make([]string, 0, len(exp.NamedArgs()))
+	for argName := range exp.NamedArgs() {
+		named = append(named, argName)
+	}
+	// diagnostics should be stable
+	sort.Strings(named)
+
+	// node() and tag() are not functions, they are checked as arguments
+	for _, arg := range exp.Args() {
+		if !helper.IsSeriesStringExpr(arg) {
+			lintCall(t, arg, deprecated)
+		}
+	}
+	for _, argName := range named {
+		if arg := exp.NamedArgs()[argName]; !helper.IsSeriesStringExpr(arg) {
+			lintCall(t, arg, deprecated)
+		}
+	}
+
+	_, isFunc := metadata.FunctionMD.Functions[name]
+	_, isRewrite := metadata.FunctionMD.RewriteFunctions[name]
+	if !isFunc && !isRewrite {
+		report(lintError, "unknown function")
+		return
+	}
+	if hint, ok := deprecated[name]; ok {
+		if hint == "" {
+			report(lintWarning, "function is deprecated")
+		} else {
+			report(lintWarning, "function is deprecated: %s", hint)
+		}
+	}
+
+	desc, ok := metadata.FunctionMD.Descriptions[name]
+	if !ok {
+		return
+	}
+	params := desc.Params
+
+	set := make([]bool, len(params))
+	for i, arg := range exp.Args() {
+		p := i
+		if p >= len(params) {
+			if len(params) == 0 || !params[len(params)-1].Multiple {
+				report(lintError, "too many arguments, at most %d expected", len(params))
+				break
+			}
+			p = len(params) - 1
+		}
+		set[p] = true
+		if severity, msg := lintArgType(params[p], arg); msg != "" {
+			report(severity, "argument %d (%s): %s", i+1, params[p].Name, msg)
+		}
+	}
+
+	for _, argName := range named {
+		arg := exp.NamedArgs()[argName]
+		p := -1
+		for i := range params {
+			if params[i].Name == argName {
+				p = i
+				break
+			}
+		}
+		if p < 0 {
+			report(lintError, "unknown argument '%s'", argName)
+			continue
+		}
+		set[p] = true
+		if severity, msg := lintArgType(params[p], arg); msg != "" {
+			report(severity, "argument %s: %s", argName, msg)
+		}
+	}
+
+	// some arguments required by graphite-web have defaults in carbonapi
+	for i, p := range params {
+		if p.Required && !set[i] {
+			report(lintWarning, "missing required argument %d (%s)", i+1, p.Name)
+		}
+	}
+}
+
+// lintArgType checks that argument could be used as parameter, returns severity and description of the problem.
+// Series passed instead of scalar and vice versa are errors, other mismatches are warnings, as carbonapi accepts
+// some arguments that graphite-web doesn't (e.x. legacy argument order or percentiles as aggregation function)
+func lintArgType(p types.FunctionParam, arg parser.Expr) (string, string) {
+	isSeriesString := helper.IsSeriesStringExpr(arg)
+	isSeries := (arg.IsName() || arg.IsFunc()) && !isSeriesString
+	var ok bool
+	switch p.Type {
+	case types.SeriesList, types.SeriesLists:
+		if !isSeries {
+			return lintError, fmt.Sprintf("seriesList expected, got '%s'", arg.ToString())
+		}
+		return "", ""
+	case types.Integer, types.Float, types.Node:
+		ok = arg.IsConst()
+	case types.IntOrInterval, types.NodeOrTag, types.Date:
+		ok = arg.IsConst() || arg.IsString()
+	case types.String, types.AggFunc:
+		ok = arg.IsString() || isSeriesString && p.PerSeries
+	case types.Interval, types.Tag:
+		ok = arg.IsString()
+	case types.Boolean:
+		ok = arg.IsBool() || arg.IsConst()
+	default:
+		return "", ""
+	}
+	if !ok {
+		typ, _ := p.Type.MarshalJSON()
+		severity := lintWarning
+		if isSeries || isSeriesString {
+			severity = lintError
+		}
+		return severity, fmt.Sprintf("%s expected, got '%s'", strings.Trim(string(typ), `"`), arg.ToString())
+	}
+
+	if len(p.Options) != 0 && arg.IsString() {
+		v := arg.StringValue()
+		for _, o := range p.Options {
+			if strings.EqualFold(o, v) {
+				return "", ""
+			}
+		}
+		if p.Type == types.AggFunc && consolidations.IsValidSummarizer(v) {
+			return "", ""
+		}
+		return lintWarning, fmt.Sprintf("'%s' is not one of %s", v, strings.Join(p.Options, ", "))
+	}
+	return "", ""
+}
+
+// deprecationWarnings returns warning for each call of deprecated function in targets. Targets that can't be parsed
+// are skipped, they are reported by evaluation
+func deprecationWarnings(targets []string, deprecated map[string]string) []string {
+	if len(deprecated) == 0 {
+		return nil
+	}
+
+	var warnings []string
+	var walk func(exp parser.Expr)
+	walk = func(exp parser.Expr) {
+		if !exp.IsFunc() {
+			return
+		}
+		if hint, ok := deprecated[exp.Target()]; ok {
+			msg := exp.Target() + " is deprecated"
+			if hint != "" {
+				msg += ": " + hint
+			}
+			warnings = append(warnings, msg)
+		}
+		for _, arg := range exp.Args() {
+			walk(arg)
+		}
+	}
+
+	for _, target := range targets {
+		exp, _, err := parser.ParseExpr(target)
+		if err == nil {
+			walk(exp)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintHandler(t *testing.T) {
+	orig := config.Config.DeprecatedFunctions
+	config.Config.DeprecatedFunctions = map[string]string{"sumSeries": "use aggregate"}
+	defer func() { config.Config.DeprecatedFunctions = orig }()
+
+	tests := []struct {
+		target   string
+		valid    bool
+		messages []string
+	}{
+		{"sumSeries(foo.*.bar)", true, []string{"function is deprecated: use aggregate"}},
+		{"*.bar", true, []string{"'*.bar' starts with wildcard, whole metric tree is searched"}},
+		{"unknownFunction(foo)", false, []string{"unknown function"}},
+		{"scale(foo, 'x')", true, []string{"argument 2 (factor): float expected, got ''x''"}},
+		{"scale(foo, bar)", false, []string{"argument 2 (factor): float expected, got 'bar'"}},
+		{"scale(1, 2)", false, []string{"argument 1 (seriesList): seriesList expected, got '1'"}},
+		{"absolute(foo, 1)", false, []string{"too many arguments, at most 1 expected"}},
+		{"alias(foo, newName='x', unknown=1)", false, []string{"unknown argument 'unknown'"}},
+		{"summarize(foo, '1h', 'p95')", true, []string{}},
+		{"alias(foo.*, node(1))", true, []string{}},
+		{"groupByNode(foo.*, 1, tag('aggregation'))", true, []string{}},
+		{"scale(foo, node(1))", false, []string{"argument 2 (factor): float expected, got 'node(1)'"}},
+		{"absolute(tag('dc'))", false, []string{"argument 1 (seriesList): seriesList expected, got 'tag('dc')'"}},
+		{"foo(", false, nil},
+	}
+
+	for _, tt := range tests {
+		for _, path := range []string{"/lint?", "/render?validateOnly=1&"} {
+			req, rr := setUpRequest(t, path+"from=-1h&target="+url.QueryEscape(tt.target))
+			renderOrLint := lintHandler
+			if strings.HasPrefix(path, "/render") {
+				renderOrLint = renderHandler
+			}
+			renderOrLint(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code, tt.target)
+
+			var resp lintResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tt.valid, resp.Valid, tt.target)
+			if assert.Len(t, resp.Targets, 1) {
+				assert.Equal(t, int64(3600), resp.Targets[0].Cost.TimeRange)
+				if tt.messages != nil {
+					messages := []string{}
+					for _, d := range resp.Targets[0].Diagnostics {
+						messages = append(messages, d.Message)
+					}
+					assert.Equal(t, tt.messages, messages, tt.target)
+				}
+			}
+		}
+	}
+
+	req, rr := setUpRequest(t, "/lint?target=sumSeries(a.*,b.c)&target=d")
+	lintHandler(rr, req)
+	var resp lintResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, lintCost{Fetches: 2, Wildcards: 1, Functions: 1, TimeRange: 86400}, resp.Targets[0].Cost)
+}
@@ -3,12 +3,16 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -129,6 +133,55 @@ func setUpRequest(t *testing.T, url string) (*http.Request, *httptest.ResponseRe
 	return req, rr
 }
 
+// testAdminToken is admin token, that is set by useAdminToken and sent by serveRequest for "admin" user
+const testAdminToken = "secret"
+
+// useZipper replaces zipper of global backends, returned function restores the original one
+func useZipper(z interfaces.CarbonZipper) func() {
+	orig := config.Config.ZipperInstance
+	config.Config.ZipperInstance = z
+	return func() { config.Config.ZipperInstance = orig }
+}
+
+// useAdminToken configures testAdminToken, returned function restores admin config
+func useAdminToken() func() {
+	orig := config.Config.Admin
+	config.Config.Admin.Token = testAdminToken
+	return func() { config.Config.Admin = orig }
+}
+
+// tempDir creates temporary directory, returned function removes it
+func tempDir(t *testing.T, prefix string) (string, func()) {
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// newUserRequest creates request of the user. User "admin" sends testAdminToken, "anonymous" is a tenant without API
+// keys, other non-empty users are tenants authenticated by API key
+func newUserRequest(method, url, user, body string) *http.Request {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	switch user {
+	case "":
+	case "admin":
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	case "anonymous":
+		req = req.WithContext(setTenant(req.Context(), &config.TenantConfig{Name: user}))
+	default:
+		req = req.WithContext(setTenant(req.Context(), &config.TenantConfig{Name: user, APIKeys: []string{"key"}}))
+	}
+	return req
+}
+
+// serveRequest sends request of the user to the handler, see newUserRequest for users
+func serveRequest(handler http.HandlerFunc, method, url, user, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handler(rr, newUserRequest(method, url, user, body))
+	return rr
+}
+
 func TestRenderHandler(t *testing.T) {
 	req, rr := setUpRequest(t, "/render/?target=fallbackSeries(foo.bar,foo.baz)&from=-10minutes&format=json")
 	renderHandler(rr, req)
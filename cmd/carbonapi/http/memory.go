@@ -0,0 +1,48 @@
+package http
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+)
+
+// pointMemorySize is amount of memory accounted for each fetched point
+const pointMemorySize = 8
+
+// memoryUsed is approximate amount of memory used by render requests in progress
+var memoryUsed int64
+
+// memoryAccount tracks memory used by a single render request
+type memoryAccount struct {
+	used  int64
+	limit int64
+}
+
+func newMemoryAccount(limit int64) *memoryAccount {
+	return &memoryAccount{limit: limit}
+}
+
+// reserve accounts n more bytes and returns false if request exceeds its limit. Memory is accounted anyway until
+// release is called
+func (a *memoryAccount) reserve(n int64) bool {
+	a.used += n
+	atomic.AddInt64(&memoryUsed, n)
+	return a.limit <= 0 || a.used <= a.limit
+}
+
+// release returns all memory of the request, must be called when request is finished
+func (a *memoryAccount) release() {
+	atomic.AddInt64(&memoryUsed, -a.used)
+	a.used = 0
+}
+
+func memoryLimitMessage(a *memoryAccount) string {
+	return fmt.Sprintf("request exceeds memory limit of %d bytes, reduce number of series or time range", a.limit)
+}
+
+// memoryOverloaded returns true if render requests in progress exceed global soft limit, so new ones should be shed
+func memoryOverloaded() bool {
+	limit := config.Config.MemoryLimits.Global
+	return limit > 0 && atomic.LoadInt64(&memoryUsed) > limit
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMemoryLimits(t *testing.T) {
+	defer func(limits config.MemoryLimitsConfig) { config.Config.MemoryLimits = limits }(config.Config.MemoryLimits)
+
+	// 3 fetched points are accounted as 24 bytes
+	config.Config.MemoryLimits = config.MemoryLimitsConfig{Request: 16}
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=png&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), "memory limit of 16 bytes")
+	assert.Equal(t, int64(0), atomic.LoadInt64(&memoryUsed))
+
+	// response of 1 series of 3 points in json is estimated as 143 bytes
+	config.Config.MemoryLimits = config.MemoryLimitsConfig{Request: 100}
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	config.Config.MemoryLimits = config.MemoryLimitsConfig{Request: 1000, Global: 10}
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&memoryUsed))
+
+	// memory used by other requests
+	atomic.AddInt64(&memoryUsed, 20)
+	defer atomic.AddInt64(&memoryUsed, -20)
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
@@ -0,0 +1,535 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/interfaces"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+// metricLister is implemented by zippers that can dump names of all metrics of backends (go-carbon's /metrics/list/)
+type metricLister interface {
+	List(ctx context.Context) ([]string, error)
+}
+
+var errTooManyMetrics = fmt.Errorf("too many metrics for metric index")
+
+// metricNode is a node of the metric name trie, a node could be both a leaf and a branch
+type metricNode struct {
+	children map[string]*metricNode
+	leaf     bool
+	// metrics is an amount of metrics under the node, including the node itself
+	metrics int
+}
+
+// insert adds metric to the trie, returns true if it wasn't there
+func (n *metricNode) insert(name string) bool {
+	if n.has(name) {
+		return false
+	}
+	n.metrics++
+	for _, part := range strings.Split(name, ".") {
+		child, ok := n.children[part]
+		if !ok {
+			child = &metricNode{}
+			if n.children == nil {
+				n.children = make(map[string]*metricNode)
+			}
+			n.children[part] = child
+		}
+		child.metrics++
+		n = child
+	}
+	n.leaf = true
+	return true
+}
+
+// has checks if metric is in the trie
+func (n *metricNode) has(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		n = n.children[part]
+		if n == nil {
+			return false
+		}
+	}
+	return n.leaf
+}
+
+// walk calls f for the node at path and all nodes below it
+func (n *metricNode) walk(path string, f func(path string, n *metricNode)) {
+	f(path, n)
+	for name, child := range n.children {
+		child.walk(path+"."+name, f)
+	}
+}
+
+// matchNodes calls f for every node that matches glob parts
+func (n *metricNode) matchNodes(prefix string, parts []string, f func(path string, n *metricNode)) {
+	visit := func(name string, child *metricNode) {
+		if len(parts) == 1 {
+			f(prefix+name, child)
+		} else {
+			child.matchNodes(prefix+name+".", parts[1:], f)
+		}
+	}
+
+	if !strings.ContainsAny(parts[0], "*?[{") {
+		if child, ok := n.children[parts[0]]; ok {
+			visit(parts[0], child)
+		}
+		return
+	}
+	alternatives := expandBraces(parts[0])
+	for name, child := range n.children {
+		if matchGlobNode(alternatives, name) {
+			visit(name, child)
+		}
+	}
+}
+
+// matchGlobNode checks if node of metric name matches any of expanded alternatives of glob node
+func matchGlobNode(alternatives []string, name string) bool {
+	for _, a := range alternatives {
+		if ok, _ := path.Match(a, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob checks if metric name matches graphite glob split by nodes, like backends match it
+func matchGlob(parts []string, name string) bool {
+	nodes := strings.Split(name, ".")
+	if len(nodes) != len(parts) {
+		return false
+	}
+	for i, part := range parts {
+		if part != nodes[i] && !matchGlobNode(expandBraces(part), nodes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// match appends nodes that match glob parts to res
+func (n *metricNode) match(parts []string, res []pb.GlobMatch) []pb.GlobMatch {
+	n.matchNodes("", parts, func(p string, child *metricNode) {
+		if child.leaf {
+			res = append(res, pb.GlobMatch{Path: p, IsLeaf: true})
+		}
+		if len(child.children) > 0 {
+			res = append(res, pb.GlobMatch{Path: p, IsLeaf: false})
+		}
+	})
+	return res
+}
+
+// expandBraces expands graphite alternatives: 'a{b,c}d' becomes 'abd' and 'acd'. Patterns without closing brace are
+// kept as is
+func expandBraces(pattern string) []string {
+	start := strings.IndexByte(pattern, '{')
+	if start < 0 {
+		return []string{pattern}
+	}
+	end := strings.IndexByte(pattern[start:], '}')
+	if end < 0 {
+		return []string{pattern}
+	}
+	end += start
+
+	var res []string
+	for _, alt := range strings.Split(pattern[start+1:end], ",") {
+		res = append(res, expandBraces(pattern[:start]+alt+pattern[end+1:])...)
+	}
+	return res
+}
+
+// metricIndex keeps names of all metrics of backends in a trie, so find requests and globs could be resolved without
+// fan-out to backends. Index is rebuilt from the full list of metrics by full refreshes and new metrics are added by
+// delta refreshes in between, removed metrics are dropped by the next full refresh.
+//
+// Zippers that can't list metrics are walked with find requests, like tag index does, and are updated by full
+// refreshes only.
+type metricIndex struct {
+	sync.RWMutex
+	zipper interfaces.CarbonZipper
+	root   *metricNode
+	count  int
+	ready  bool
+
+	maxMetrics  int
+	expandGlobs bool
+}
+
+// metricIndexes contains index for each tenant that has its own backends, "" is for global backends
+var metricIndexes = make(map[string]*metricIndex)
+
+func newMetricIndex(zipper interfaces.CarbonZipper, cfg config.MetricIndexConfig) *metricIndex {
+	return &metricIndex{
+		zipper:      zipper,
+		root:        &metricNode{},
+		maxMetrics:  cfg.MaxMetrics,
+		expandGlobs: cfg.ExpandGlobs,
+	}
+}
+
+// getMetricIndex returns index that should be used for tenant's requests or nil if index is disabled. t could be nil
+func getMetricIndex(t *config.TenantConfig) *metricIndex {
+	if t != nil && t.ZipperInstance != nil {
+		return metricIndexes[t.Name]
+	}
+	return metricIndexes[""]
+}
+
+// initMetricIndexes creates and starts indexes for global backends and tenants with their own backends
+func initMetricIndexes(cfg config.MetricIndexConfig) {
+	if !cfg.Enabled {
+		return
+	}
+
+	metricIndexes[""] = newMetricIndex(config.Config.ZipperInstance, cfg)
+	for name, t := range config.Config.Tenants.Tenants {
+		if t.ZipperInstance != nil {
+			metricIndexes[name] = newMetricIndex(t.ZipperInstance, cfg)
+		}
+	}
+
+	for name, idx := range metricIndexes {
+		go idx.run(name, cfg)
+	}
+}
+
+func (m *metricIndex) run(tenant string, cfg config.MetricIndexConfig) {
+	logger := zapwriter.Logger("metricIndex").With(zap.String("tenant", tenant))
+
+	refresh := func(full bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+
+		t0 := time.Now()
+		var err error
+		if full {
+			err = m.fullRefresh(ctx)
+		} else {
+			err = m.deltaRefresh(ctx)
+		}
+		if err != nil {
+			logger.Error("failed to refresh metric index",
+				zap.Bool("full", full),
+				zap.Error(err),
+			)
+			return
+		}
+		m.RLock()
+		count := m.count
+		m.RUnlock()
+		logger.Debug("metric index refreshed",
+			zap.Bool("full", full),
+			zap.Int("metrics", count),
+			zap.Duration("runtime", time.Since(t0)),
+		)
+	}
+
+	refresh(true)
+	fullTicker := time.NewTicker(cfg.FullRefreshInterval)
+	deltaTicker := time.NewTicker(cfg.DeltaRefreshInterval)
+	for {
+		select {
+		case <-fullTicker.C:
+			refresh(true)
+		case <-deltaTicker.C:
+			refresh(false)
+		}
+	}
+}
+
+// fetchMetrics returns names of all metrics, ok is false if zipper can't list them
+func (m *metricIndex) fetchMetrics(ctx context.Context) ([]string, bool, error) {
+	lister, ok := m.zipper.(metricLister)
+	if !ok {
+		return nil, false, nil
+	}
+	metrics, err := lister.List(ctx)
+	if err != nil {
+		return nil, true, err
+	}
+	return metrics, true, nil
+}
+
+// fullRefresh builds a new trie and replaces content of the index with it. Index is disabled if there are more
+// metrics than allowed
+func (m *metricIndex) fullRefresh(ctx context.Context) error {
+	metrics, ok, err := m.fetchMetrics(ctx)
+	if !ok {
+		metrics, err = m.walk(ctx)
+	}
+	if err != nil {
+		if err == errTooManyMetrics {
+			m.reset()
+		}
+		return err
+	}
+	if m.maxMetrics > 0 && len(metrics) > m.maxMetrics {
+		m.reset()
+		return errTooManyMetrics
+	}
+
+	root := &metricNode{}
+	count := 0
+	for _, name := range metrics {
+		if root.insert(name) {
+			count++
+		}
+	}
+
+	m.Lock()
+	m.root = root
+	m.count = count
+	m.ready = true
+	m.Unlock()
+	return nil
+}
+
+// deltaRefresh adds metrics that appeared since the last refresh
+func (m *metricIndex) deltaRefresh(ctx context.Context) error {
+	m.RLock()
+	ready := m.ready
+	m.RUnlock()
+	if !ready {
+		return m.fullRefresh(ctx)
+	}
+
+	metrics, ok, err := m.fetchMetrics(ctx)
+	if !ok {
+		// there is no cheaper way to find new metrics than the full walk, so index is updated by full refreshes only
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.RLock()
+	var added []string
+	for _, name := range metrics {
+		if !m.root.has(name) {
+			added = append(added, name)
+		}
+	}
+	m.RUnlock()
+	if len(added) == 0 {
+		return nil
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if m.maxMetrics > 0 && m.count+len(added) > m.maxMetrics {
+		m.root = &metricNode{}
+		m.count = 0
+		m.ready = false
+		return errTooManyMetrics
+	}
+	for _, name := range added {
+		if m.root.insert(name) {
+			m.count++
+		}
+	}
+	return nil
+}
+
+// reset disables index until the next successful full refresh
+func (m *metricIndex) reset() {
+	m.Lock()
+	m.root = &metricNode{}
+	m.count = 0
+	m.ready = false
+	m.Unlock()
+}
+
+// walk finds all metrics level by level, starting from "*"
+func (m *metricIndex) walk(ctx context.Context) ([]string, error) {
+	var metrics []string
+	seen := make(map[string]bool)
+
+	patterns := []string{"*"}
+	for len(patterns) > 0 {
+		var next []string
+		for len(patterns) > 0 {
+			n := findWalkBatchSize
+			if n > len(patterns) {
+				n = len(patterns)
+			}
+			res, _, err := m.zipper.Find(ctx, patterns[:n])
+			patterns = patterns[n:]
+			if err != nil && err != types.ErrNonFatalErrors && err != types.ErrNoMetricsFetched {
+				return nil, err
+			}
+			if res == nil {
+				continue
+			}
+
+			for _, glob := range res.Metrics {
+				for _, match := range glob.Matches {
+					key := fmt.Sprintf("%s %v", match.Path, match.IsLeaf)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+					if !match.IsLeaf {
+						next = append(next, match.Path+".*")
+						continue
+					}
+					if m.maxMetrics > 0 && len(metrics) >= m.maxMetrics {
+						return nil, errTooManyMetrics
+					}
+					metrics = append(metrics, match.Path)
+				}
+			}
+		}
+		patterns = next
+	}
+	return metrics, nil
+}
+
+// Find returns metrics that match the glob, like backends do. Returns false if index can't answer, i.e. it's not
+// ready yet or query isn't a plain glob
+func (m *metricIndex) Find(query string) (pb.GlobResponse, bool) {
+	res := pb.GlobResponse{Name: query, Matches: []pb.GlobMatch{}}
+	if m == nil || query == "" || strings.HasPrefix(query, "seriesByTag") || strings.ContainsAny(query, ";()") {
+		return res, false
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	if !m.ready {
+		return res, false
+	}
+	res.Matches = m.root.match(strings.Split(query, "."), res.Matches)
+	sort.Slice(res.Matches, func(i, j int) bool {
+		if res.Matches[i].Path != res.Matches[j].Path {
+			return res.Matches[i].Path < res.Matches[j].Path
+		}
+		return res.Matches[i].IsLeaf
+	})
+	return res, true
+}
+
+// FindAll answers all queries of find request. Returns false if any of them can't be answered by index
+func (m *metricIndex) FindAll(queries []string) (*pb.MultiGlobResponse, bool) {
+	if m == nil {
+		return nil, false
+	}
+	res := &pb.MultiGlobResponse{Metrics: make([]pb.GlobResponse, 0, len(queries))}
+	for _, q := range queries {
+		glob, ok := m.Find(q)
+		if !ok {
+			return nil, false
+		}
+		res.Metrics = append(res.Metrics, glob)
+	}
+	return res, true
+}
+
+// Expand returns names of metrics that match the glob. Returns false if index can't resolve it or expansion is
+// disabled, metrics without wildcards are left to backends as well
+func (m *metricIndex) Expand(metric string) ([]string, bool) {
+	if m == nil || !m.expandGlobs || !strings.ContainsAny(metric, "*?[{") {
+		return nil, false
+	}
+	return m.leaves(metric)
+}
+
+// leaves returns names of metrics that match the glob
+func (m *metricIndex) leaves(query string) ([]string, bool) {
+	glob, ok := m.Find(query)
+	if !ok {
+		return nil, false
+	}
+	names := make([]string, 0, len(glob.Matches))
+	for _, match := range glob.Matches {
+		if match.IsLeaf {
+			names = append(names, match.Path)
+		}
+	}
+	return names, true
+}
+
+// prefixCardinality is an amount of metrics under the node
+type prefixCardinality struct {
+	Prefix  string `json:"prefix"`
+	Metrics int    `json:"metrics"`
+}
+
+// Cardinality returns amount of metrics under each node that matches the glob, the biggest ones first. Returns false
+// if index is not ready
+func (m *metricIndex) Cardinality(query string) ([]prefixCardinality, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if !m.ready {
+		return nil, false
+	}
+
+	res := make([]prefixCardinality, 0)
+	m.root.matchNodes("", strings.Split(query, "."), func(p string, n *metricNode) {
+		res = append(res, prefixCardinality{Prefix: p, Metrics: n.metrics})
+	})
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Metrics != res[j].Metrics {
+			return res[i].Metrics > res[j].Metrics
+		}
+		return res[i].Prefix < res[j].Prefix
+	})
+	return res, true
+}
+
+// Dump writes sorted names of all metrics under nodes that match the glob, one per line. Empty query means all
+// metrics. Returns false if index is not ready
+func (m *metricIndex) Dump(w io.Writer, query string) (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+	if !m.ready {
+		return false, nil
+	}
+
+	var names []string
+	collect := func(p string, n *metricNode) {
+		if n.leaf {
+			names = append(names, p)
+		}
+	}
+	if query == "" {
+		for name, child := range m.root.children {
+			child.walk(name, collect)
+		}
+	} else {
+		m.root.matchNodes("", strings.Split(query, "."), func(p string, n *metricNode) {
+			n.walk(p, collect)
+		})
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		bw.WriteString(name)
+		bw.WriteByte('\n')
+	}
+	return true, bw.Flush()
+}
+
+// Status reports if index is ready and amount of metrics in it
+func (m *metricIndex) Status() (bool, int) {
+	m.RLock()
+	defer m.RUnlock()
+	return m.ready, m.count
+}
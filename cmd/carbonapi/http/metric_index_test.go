@@ -0,0 +1,166 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+type listMockZipper struct {
+	findWalkMockZipper
+	lists int
+}
+
+func (z *listMockZipper) List(ctx context.Context) ([]string, error) {
+	z.lists++
+	return z.series, nil
+}
+
+func TestMetricIndex(t *testing.T) {
+	z := &listMockZipper{findWalkMockZipper: findWalkMockZipper{series: []string{
+		"cpu.load.web1",
+		"cpu.load.web2",
+		"cpu.idle.web1",
+		"disk.sda",
+		"disk.sda.used",
+	}}}
+	idx := newMetricIndex(z, config.MetricIndexConfig{ExpandGlobs: true})
+
+	_, ok := idx.Find("cpu.*")
+	assert.False(t, ok, "index shouldn't answer before refresh")
+
+	assert.NoError(t, idx.fullRefresh(context.Background()))
+	assert.Equal(t, 1, z.lists)
+	assert.Equal(t, 0, z.finds, "zipper that can list metrics shouldn't be walked")
+
+	tests := []struct {
+		query   string
+		matches []pb.GlobMatch
+	}{
+		{"*", []pb.GlobMatch{{Path: "cpu"}, {Path: "disk"}}},
+		{"cpu.load.*", []pb.GlobMatch{{Path: "cpu.load.web1", IsLeaf: true}, {Path: "cpu.load.web2", IsLeaf: true}}},
+		{"cpu.*.web1", []pb.GlobMatch{{Path: "cpu.idle.web1", IsLeaf: true}, {Path: "cpu.load.web1", IsLeaf: true}}},
+		{"cpu.{idle,load}.web[2-3]", []pb.GlobMatch{{Path: "cpu.load.web2", IsLeaf: true}}},
+		{"disk.s?a", []pb.GlobMatch{{Path: "disk.sda", IsLeaf: true}, {Path: "disk.sda"}}},
+		{"net.*", []pb.GlobMatch{}},
+	}
+	for _, tt := range tests {
+		res, ok := idx.Find(tt.query)
+		assert.True(t, ok, tt.query)
+		assert.Equal(t, tt.matches, res.Matches, tt.query)
+	}
+
+	_, ok = idx.Find("seriesByTag('name=cpu')")
+	assert.False(t, ok, "index can't evaluate tag expressions")
+
+	z.series = append(z.series, "net.eth0.rx")
+	assert.NoError(t, idx.deltaRefresh(context.Background()))
+	names, ok := idx.Expand("net.*.rx")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"net.eth0.rx"}, names)
+	_, ok = idx.Expand("net.eth0.rx")
+	assert.False(t, ok, "metrics without wildcards should be left to backends")
+
+	idx.maxMetrics = 5
+	assert.Error(t, idx.fullRefresh(context.Background()))
+	_, ok = idx.Find("*")
+	assert.False(t, ok, "index should be disabled if there are too many metrics")
+	idx.maxMetrics = 0
+	assert.NoError(t, idx.fullRefresh(context.Background()))
+
+	defer useZipper(z)()
+	metricIndexes[""] = idx
+	defer delete(metricIndexes, "")
+
+	req, rr := setUpRequest(t, "/metrics/find/?query=cpu.load.*&format=json")
+	findHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"cpu.load.web2"`)
+	assert.Equal(t, 0, z.finds, "find should be answered by index")
+
+	req, rr = setUpRequest(t, "/render/?target="+url.QueryEscape("sumSeries(cpu.*.web1)")+"&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, z.request.Metrics, 2)
+	for _, m := range z.request.Metrics {
+		assert.Equal(t, "cpu.*.web1", m.PathExpression)
+	}
+}
+
+func TestMetricIndexFindWalk(t *testing.T) {
+	z := &findWalkMockZipper{series: []string{"cpu.load.web1", "cpu.idle.web1", "disk.sda.used"}}
+	idx := newMetricIndex(z, config.MetricIndexConfig{})
+
+	assert.NoError(t, idx.fullRefresh(context.Background()))
+	assert.Equal(t, 3, z.finds, "tree should be walked level by level")
+
+	res, ok := idx.Find("*.*.web1")
+	assert.True(t, ok)
+	assert.Equal(t, []pb.GlobMatch{{Path: "cpu.idle.web1", IsLeaf: true}, {Path: "cpu.load.web1", IsLeaf: true}}, res.Matches)
+
+	_, ok = idx.Expand("cpu.*.web1")
+	assert.False(t, ok, "globs of render requests shouldn't be expanded unless enabled")
+}
+
+func TestMetricIndexAdminHandlers(t *testing.T) {
+	req, rr := setUpRequest(t, "/admin/index")
+	indexStatusHandler(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "index is disabled")
+
+	z := &listMockZipper{findWalkMockZipper: findWalkMockZipper{series: []string{
+		"teams.a.cpu.web1",
+		"teams.a.cpu.web2",
+		"teams.a.mem",
+		"teams.b.cpu.web1",
+		"infra.dns",
+	}}}
+	idx := newMetricIndex(z, config.MetricIndexConfig{})
+	metricIndexes[""] = idx
+	defer delete(metricIndexes, "")
+
+	req, rr = setUpRequest(t, "/admin/index/cardinality")
+	indexCardinalityHandler(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "index is not ready")
+
+	assert.NoError(t, idx.fullRefresh(context.Background()))
+
+	req, rr = setUpRequest(t, "/admin/index")
+	indexStatusHandler(rr, req)
+	assert.Equal(t, `{"ready":true,"metrics":5}`, rr.Body.String())
+
+	req, rr = setUpRequest(t, "/admin/index/cardinality?query=teams.*")
+	indexCardinalityHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"query":"teams.*","metrics":4,"prefixes":[{"prefix":"teams.a","metrics":3},{"prefix":"teams.b","metrics":1}]}`, rr.Body.String())
+
+	req, rr = setUpRequest(t, "/admin/index/cardinality")
+	indexCardinalityHandler(rr, req)
+	assert.Contains(t, rr.Body.String(), `"metrics":5`, "top-level prefixes should be reported by default")
+
+	req, rr = setUpRequest(t, "/admin/index/dump?query=teams.a.cpu")
+	indexDumpHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "teams.a.cpu.web1\nteams.a.cpu.web2\n", rr.Body.String())
+
+	req, rr = setUpRequest(t, "/admin/index/dump")
+	indexDumpHandler(rr, req)
+	assert.Equal(t, strings.Join([]string{"infra.dns", "teams.a.cpu.web1", "teams.a.cpu.web2", "teams.a.mem", "teams.b.cpu.web1", ""}, "\n"), rr.Body.String())
+
+	req, _ = http.NewRequest("POST", "/admin/index/expand", strings.NewReader("query=teams.*.cpu.web1&query=infra.dns&query=net.*"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	indexExpandHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"infra.dns":["infra.dns"],"net.*":[],"teams.*.cpu.web1":["teams.a.cpu.web1","teams.b.cpu.web1"]}`, rr.Body.String())
+
+	req, rr = setUpRequest(t, "/admin/index/expand?tenant=unknown&query=*")
+	indexExpandHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -7,6 +7,10 @@ import (
 
 	"github.com/go-graphite/carbonapi/cache"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/zipper/broadcast"
+	zipperHelper "github.com/go-graphite/carbonapi/zipper/helper"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	"go.uber.org/zap"
 )
@@ -26,8 +30,49 @@ var ApiMetrics = struct {
 
 	MemcacheTimeouts expvar.Func
 
+	MemoryUsed          expvar.Func
+	MemoryLimitExceeded *expvar.Int
+	MemoryShedRequests  *expvar.Int
+
+	EvalPanics *expvar.Int
+
+	SeriesLimitExceeded  *expvar.Int
+	SeriesLimitOffenders *expvar.Map
+
+	ScheduledQueries       *expvar.Int
+	ScheduledQueryErrors   *expvar.Int
+	ScheduledPointsWritten *expvar.Int
+	ScheduledWriteRetries  *expvar.Int
+	ScheduledWriteLag      expvar.Func
+
 	CacheSize  expvar.Func
 	CacheItems expvar.Func
+
+	FunctionCacheHits   expvar.Func
+	FunctionCacheMisses expvar.Func
+	FunctionCacheSize   expvar.Func
+	FunctionCacheItems  expvar.Func
+
+	FunctionComparisons          expvar.Func
+	FunctionComparisonMismatches expvar.Func
+	FunctionComparisonErrors     expvar.Func
+
+	IncrementalCacheHits      *expvar.Int
+	IncrementalCacheMisses    *expvar.Int
+	IncrementalCacheRefetches *expvar.Int
+
+	ChunkedFetchRequests *expvar.Int
+
+	ShadowRequests  *expvar.Int
+	ShadowErrors    *expvar.Int
+	ShadowDropped   *expvar.Int
+	ShadowRuntimeNS *expvar.Int
+
+	ExportJobs   *expvar.Int
+	ExportErrors *expvar.Int
+
+	Reports      *expvar.Int
+	ReportErrors *expvar.Int
 }{
 	Requests: expvar.NewInt("requests"),
 	// TODO: request_cache -> render_cache
@@ -41,6 +86,47 @@ var ApiMetrics = struct {
 	FindCacheHits:       expvar.NewInt("find_cache_hits"),
 	FindCacheMisses:     expvar.NewInt("find_cache_misses"),
 	FindCacheOverheadNS: expvar.NewInt("find_cache_overhead_ns"),
+
+	MemoryUsed:          expvar.Func(func() interface{} { return atomic.LoadInt64(&memoryUsed) }),
+	MemoryLimitExceeded: expvar.NewInt("memory_limit_exceeded"),
+	MemoryShedRequests:  expvar.NewInt("memory_shed_requests"),
+
+	EvalPanics: expvar.NewInt("eval_panics"),
+
+	SeriesLimitExceeded:  expvar.NewInt("series_limit_exceeded"),
+	SeriesLimitOffenders: expvar.NewMap("series_limit_offenders"),
+
+	ScheduledQueries:       expvar.NewInt("scheduled_queries"),
+	ScheduledQueryErrors:   expvar.NewInt("scheduled_query_errors"),
+	ScheduledPointsWritten: expvar.NewInt("scheduled_points_written"),
+	ScheduledWriteRetries:  expvar.NewInt("scheduled_write_retries"),
+	ScheduledWriteLag:      expvar.Func(func() interface{} { return scheduledWriteLag() }),
+
+	FunctionCacheHits:   expvar.Func(func() interface{} { return expr.GetFunctionCacheStats().Hits }),
+	FunctionCacheMisses: expvar.Func(func() interface{} { return expr.GetFunctionCacheStats().Misses }),
+	FunctionCacheSize:   expvar.Func(func() interface{} { return expr.GetFunctionCacheStats().Size }),
+	FunctionCacheItems:  expvar.Func(func() interface{} { return expr.GetFunctionCacheStats().Items }),
+
+	FunctionComparisons:          expvar.Func(func() interface{} { return expr.GetFunctionComparisonStats().Comparisons }),
+	FunctionComparisonMismatches: expvar.Func(func() interface{} { return expr.GetFunctionComparisonStats().Mismatches }),
+	FunctionComparisonErrors:     expvar.Func(func() interface{} { return expr.GetFunctionComparisonStats().Errors }),
+
+	IncrementalCacheHits:      expvar.NewInt("incremental_cache_hits"),
+	IncrementalCacheMisses:    expvar.NewInt("incremental_cache_misses"),
+	IncrementalCacheRefetches: expvar.NewInt("incremental_cache_refetches"),
+
+	ChunkedFetchRequests: expvar.NewInt("chunked_fetch_requests"),
+
+	ShadowRequests:  expvar.NewInt("shadow_requests"),
+	ShadowErrors:    expvar.NewInt("shadow_errors"),
+	ShadowDropped:   expvar.NewInt("shadow_dropped"),
+	ShadowRuntimeNS: expvar.NewInt("shadow_runtime_ns"),
+
+	ExportJobs:   expvar.NewInt("export_jobs"),
+	ExportErrors: expvar.NewInt("export_errors"),
+
+	Reports:      expvar.NewInt("reports"),
+	ReportErrors: expvar.NewInt("report_errors"),
 }
 
 var ZipperMetrics = struct {
@@ -61,6 +147,24 @@ var ZipperMetrics = struct {
 	CacheItems  expvar.Func
 	CacheMisses *expvar.Int
 	CacheHits   *expvar.Int
+
+	NewConnections        expvar.Func
+	ReusedConnections     expvar.Func
+	ReusedIdleConnections expvar.Func
+	DialErrors            expvar.Func
+
+	BackendQueued     expvar.Func
+	BackendRejected   expvar.Func
+	BackendThrottled  expvar.Func
+	ResponsesTooLarge expvar.Func
+
+	Retries              expvar.Func
+	RetryBudgetExhausted expvar.Func
+
+	CircuitBreakersOpen    expvar.Func
+	CircuitBreakerRejected expvar.Func
+
+	PrefixIndexSkipped expvar.Func
 }{
 	FindRequests: expvar.NewInt("zipper_find_requests"),
 	FindErrors:   expvar.NewInt("zipper_find_errors"),
@@ -77,6 +181,24 @@ var ZipperMetrics = struct {
 
 	CacheHits:   expvar.NewInt("zipper_cache_hits"),
 	CacheMisses: expvar.NewInt("zipper_cache_misses"),
+
+	NewConnections:        expvar.Func(func() interface{} { return zipperHelper.GetPoolStats().NewConnections }),
+	ReusedConnections:     expvar.Func(func() interface{} { return zipperHelper.GetPoolStats().ReusedConnections }),
+	ReusedIdleConnections: expvar.Func(func() interface{} { return zipperHelper.GetPoolStats().ReusedIdleConnections }),
+	DialErrors:            expvar.Func(func() interface{} { return zipperHelper.GetPoolStats().DialErrors }),
+
+	BackendQueued:     expvar.Func(func() interface{} { return zipperHelper.GetShapingStats().Queued }),
+	BackendRejected:   expvar.Func(func() interface{} { return zipperHelper.GetShapingStats().Rejected }),
+	BackendThrottled:  expvar.Func(func() interface{} { return zipperHelper.GetShapingStats().Throttled }),
+	ResponsesTooLarge: expvar.Func(func() interface{} { return zipperHelper.GetShapingStats().TooLarge }),
+
+	Retries:              expvar.Func(func() interface{} { return zipperHelper.GetRetryStats().Retries }),
+	RetryBudgetExhausted: expvar.Func(func() interface{} { return zipperHelper.GetRetryStats().BudgetExhausted }),
+
+	CircuitBreakersOpen:    expvar.Func(func() interface{} { return zipperHelper.GetCircuitBreakersOpen() }),
+	CircuitBreakerRejected: expvar.Func(func() interface{} { return zipperHelper.GetCircuitBreakerRejected() }),
+
+	PrefixIndexSkipped: expvar.Func(func() interface{} { return broadcast.GetPrefixIndexSkipped() }),
 }
 
 func ZipperStats(stats *zipperTypes.Stats) {
@@ -122,6 +244,18 @@ func SetupMetrics(logger *zap.Logger) {
 		})
 		expvar.Publish("cache_size", ApiMetrics.CacheSize)
 
+		ApiMetrics.CacheItems = expvar.Func(func() interface{} {
+			return qcache.Items()
+		})
+		expvar.Publish("cache_items", ApiMetrics.CacheItems)
+	case "disk":
+		qcache := config.Config.QueryCache.(*cache.DiskCache)
+
+		ApiMetrics.CacheSize = expvar.Func(func() interface{} {
+			return qcache.Size()
+		})
+		expvar.Publish("cache_size", ApiMetrics.CacheSize)
+
 		ApiMetrics.CacheItems = expvar.Func(func() interface{} {
 			return qcache.Items()
 		})
@@ -132,4 +266,28 @@ func SetupMetrics(logger *zap.Logger) {
 	// +1 to track every over the number of buckets we track
 	TimeBuckets = make([]int64, config.Config.Buckets+1)
 	expvar.Publish("requestBuckets", expvar.Func(RenderTimeBuckets))
+
+	expvar.Publish("zipper_new_connections", ZipperMetrics.NewConnections)
+	expvar.Publish("zipper_reused_connections", ZipperMetrics.ReusedConnections)
+	expvar.Publish("zipper_reused_idle_connections", ZipperMetrics.ReusedIdleConnections)
+	expvar.Publish("zipper_dial_errors", ZipperMetrics.DialErrors)
+	expvar.Publish("zipper_backend_queued", ZipperMetrics.BackendQueued)
+	expvar.Publish("zipper_backend_rejected", ZipperMetrics.BackendRejected)
+	expvar.Publish("zipper_backend_throttled", ZipperMetrics.BackendThrottled)
+	expvar.Publish("zipper_responses_too_large", ZipperMetrics.ResponsesTooLarge)
+	expvar.Publish("zipper_retries", ZipperMetrics.Retries)
+	expvar.Publish("zipper_retry_budget_exhausted", ZipperMetrics.RetryBudgetExhausted)
+	expvar.Publish("zipper_circuit_breakers_open", ZipperMetrics.CircuitBreakersOpen)
+	expvar.Publish("zipper_circuit_breaker_rejected", ZipperMetrics.CircuitBreakerRejected)
+	expvar.Publish("zipper_prefix_index_skipped", ZipperMetrics.PrefixIndexSkipped)
+	expvar.Publish("unknown_consolidations", types.UnknownConsolidations)
+	expvar.Publish("memory_used", ApiMetrics.MemoryUsed)
+	expvar.Publish("scheduled_write_lag", ApiMetrics.ScheduledWriteLag)
+	expvar.Publish("function_cache_hits", ApiMetrics.FunctionCacheHits)
+	expvar.Publish("function_cache_misses", ApiMetrics.FunctionCacheMisses)
+	expvar.Publish("function_cache_size", ApiMetrics.FunctionCacheSize)
+	expvar.Publish("function_cache_items", ApiMetrics.FunctionCacheItems)
+	expvar.Publish("function_comparisons", ApiMetrics.FunctionComparisons)
+	expvar.Publish("function_comparison_mismatches", ApiMetrics.FunctionComparisonMismatches)
+	expvar.Publish("function_comparison_errors", ApiMetrics.FunctionComparisonErrors)
 }
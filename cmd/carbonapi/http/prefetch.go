@@ -0,0 +1,298 @@
+package http
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// fetchPlan maps metric requests to wider windows of the same metric, that are fetched instead of them. Functions
+// with lookback (e.x. holtWintersForecast or movingAverage('1h')) request the same metric with earlier start time,
+// so overlapping requests are merged into one and the data is fetched once at the widest window.
+type fetchPlan map[parser.MetricRequest]parser.MetricRequest
+
+// newFetchPlan merges overlapping windows of every metric in requests. Windows that don't overlap (e.x. timeStack)
+// are fetched separately, so fetched range isn't extended by gaps between them
+func newFetchPlan(requests []parser.MetricRequest) fetchPlan {
+	byMetric := make(map[string][]parser.MetricRequest)
+	for _, m := range requests {
+		byMetric[m.Metric] = append(byMetric[m.Metric], m)
+	}
+
+	plan := make(fetchPlan)
+	for _, windows := range byMetric {
+		if len(windows) < 2 {
+			continue
+		}
+		sort.Slice(windows, func(i, j int) bool { return windows[i].From < windows[j].From })
+
+		start := 0
+		merged := windows[0]
+		for i := 1; i <= len(windows); i++ {
+			if i < len(windows) && windows[i].From <= merged.Until {
+				if windows[i].Until > merged.Until {
+					merged.Until = windows[i].Until
+				}
+				continue
+			}
+			for _, m := range windows[start:i] {
+				if m != merged {
+					plan[m] = merged
+				}
+			}
+			if i < len(windows) {
+				start, merged = i, windows[i]
+			}
+		}
+	}
+	return plan
+}
+
+// window returns request that should be fetched to get m
+func (p fetchPlan) window(m parser.MetricRequest) parser.MetricRequest {
+	if w, ok := p[m]; ok {
+		return w
+	}
+	return m
+}
+
+// fetchBatch is a planning pass over a batch of targets: metrics of all of them are collected, with time ranges
+// adjusted by functions, into a single zipper request, that is issued before any target is evaluated. So backend
+// round trips aren't serialized by evaluation of targets
+type fetchBatch struct {
+	from  int64
+	until int64
+	plan  fetchPlan
+	req   pb.MultiFetchRequest
+	// filtering functions of path expressions that are pushed down to backends
+	filters map[string]*pb.FilteringFunction
+	// time ranges of path expressions for responses, that don't contain request times
+	pathExprTimeMap map[string]requestInterval
+	// requests that are cut from wider windows after fetch
+	derived []parser.MetricRequest
+	// requests that are fetched, their series are checked against series limits
+	planned []parser.MetricRequest
+	// warnings about truncated series and the first path expression that exceeded the limit if request is rejected
+	warnings []string
+	limitErr error
+	// fetched series could be stitched from incremental cache and fetched points after the cached ones
+	incremental bool
+}
+
+// pushdownFunctions select series by their values, backends that apply filtering functions (e.x. graphite-clickhouse)
+// could return only selected series instead of all matched ones. carbonapi evaluates them anyway, so results are the
+// same with backends that ignore them
+var pushdownFunctions = map[string]bool{
+	"highest":        true,
+	"highestAverage": true,
+	"highestCurrent": true,
+	"highestMax":     true,
+	"lowest":         true,
+	"lowestAverage":  true,
+	"lowestCurrent":  true,
+	"lowestMax":      true,
+}
+
+// filterFunctions returns filtering functions of path expressions, that could be pushed down to backends. Function is
+// pushed down only if path expression is its first argument and isn't used anywhere else in the request, otherwise
+// other consumers of the same series would get only selected ones. Requests with rewrite functions are never pushed
+// down, as targets of the next batches aren't known in advance
+func filterFunctions(exps []parser.Expr) map[string]*pb.FilteringFunction {
+	uses := make(map[string]int)
+	filters := make(map[string]*pb.FilteringFunction)
+	rewrite := false
+
+	var walk func(e parser.Expr)
+	walk = func(e parser.Expr) {
+		if e.IsName() {
+			uses[e.Target()]++
+			return
+		}
+		if !e.IsFunc() {
+			return
+		}
+		if _, ok := metadata.FunctionMD.RewriteFunctions[e.Target()]; ok {
+			rewrite = true
+		}
+		args := e.Args()
+		if pushdownFunctions[e.Target()] && len(args) > 0 && args[0].IsName() && len(e.NamedArgs()) == 0 {
+			f := &pb.FilteringFunction{Name: e.Target()}
+			for _, arg := range args[1:] {
+				if arg.IsString() {
+					f.Arguments = append(f.Arguments, arg.StringValue())
+				} else {
+					f.Arguments = append(f.Arguments, arg.ToString())
+				}
+			}
+			filters[args[0].Target()] = f
+		}
+		for _, arg := range args {
+			walk(arg)
+		}
+		for _, arg := range e.NamedArgs() {
+			walk(arg)
+		}
+	}
+	for _, exp := range exps {
+		walk(exp)
+	}
+
+	if rewrite {
+		return nil
+	}
+	for name := range filters {
+		if uses[name] > 1 {
+			delete(filters, name)
+		}
+	}
+	return filters
+}
+
+func newFetchBatch(exps []parser.Expr, from, until int64) *fetchBatch {
+	var requests []parser.MetricRequest
+	for _, exp := range exps {
+		for _, m := range exp.Metrics() {
+			m.From += from
+			m.Until += until
+			requests = append(requests, m)
+		}
+	}
+	return &fetchBatch{
+		from:            from,
+		until:           until,
+		plan:            newFetchPlan(requests),
+		filters:         filterFunctions(exps),
+		pathExprTimeMap: make(map[string]requestInterval),
+	}
+}
+
+// add plans fetch of metrics of exp, that aren't in metricMap yet. Error of tag index is returned, but all metrics
+// are planned anyway. Globs are expanded by metric index if it's enabled for render requests
+func (b *fetchBatch) add(exp parser.Expr, index *tagIndex, metrics *metricIndex, metricMap map[parser.MetricRequest][]*types.MetricData) error {
+	var tagErr error
+	for _, m := range exp.Metrics() {
+		mFetch := m
+		mFetch.From += b.from
+		mFetch.Until += b.until
+
+		if _, ok := metricMap[mFetch]; ok {
+			// we already have this metric in fetch queue
+			continue
+		}
+		if window := b.plan.window(mFetch); window != mFetch {
+			// series are cut from the wider window after fetch
+			b.derived = append(b.derived, mFetch)
+			mFetch = window
+			if _, ok := metricMap[mFetch]; ok {
+				continue
+			}
+		}
+		metricMap[mFetch] = make([]*types.MetricData, 0, 1)
+		b.pathExprTimeMap[m.Metric] = requestInterval{from: mFetch.From, until: mFetch.Until}
+		b.planned = append(b.planned, mFetch)
+
+		names := []string{m.Metric}
+		if found, ok, err := index.SeriesByTag(m.Metric); ok {
+			// seriesByTag is evaluated by carbonapi, found series are requested by name
+			if err != nil {
+				tagErr = err
+			}
+			names = found
+		} else if found, ok := metrics.Expand(m.Metric); ok {
+			names = found
+		}
+		if len(names) > 1 {
+			// series found by indexes are checked before fetch
+			names = names[:b.limitSeries(m.Metric, len(names))]
+		}
+		var filters []*pb.FilteringFunction
+		if f, ok := b.filters[m.Metric]; ok && len(names) == 1 && names[0] == m.Metric {
+			// series found by indexes are requested one by one, there is nothing to select from
+			filters = []*pb.FilteringFunction{f}
+		}
+		for _, name := range names {
+			b.req.Metrics = append(b.req.Metrics, pb.FetchRequest{
+				Name:            name,
+				PathExpression:  m.Metric,
+				StartTime:       mFetch.From,
+				StopTime:        mFetch.Until,
+				FilterFunctions: filters,
+			})
+		}
+	}
+	return tagErr
+}
+
+// empty checks if there is nothing to fetch
+func (b *fetchBatch) empty() bool {
+	return len(b.req.Metrics) == 0
+}
+
+// fetch issues single zipper request for the whole batch
+func (b *fetchBatch) fetch(ctx context.Context, tenant *config.TenantConfig) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	ApiMetrics.RenderRequests.Add(1)
+	// limiter could be replaced by config reload, so the same one should be left
+	limiter := tenant.GetLimiter()
+	limiter.Enter()
+	defer limiter.Leave()
+
+	if s := shadow; s != nil {
+		s.mirrorRender(ctx, tenant, b.req)
+	}
+	zipper := tenant.GetZipper()
+	if c := chunkedFetch; c != nil {
+		zipper = c.wrap(zipper)
+	}
+	if c := incrementalFetchCache; c != nil && b.incremental {
+		return c.render(ctx, zipper, tenant, b.req)
+	}
+	return zipper.Render(ctx, b.req)
+}
+
+// missing checks if any metric of exp has no fetched series, it's called after store
+func (b *fetchBatch) missing(exp parser.Expr, metricMap map[parser.MetricRequest][]*types.MetricData) bool {
+	for _, m := range exp.Metrics() {
+		m.From += b.from
+		m.Until += b.until
+		if len(metricMap[m]) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// store puts fetched series to metricMap and cuts series for requests, that were fetched with wider windows
+func (b *fetchBatch) store(r []*types.MetricData, metricMap map[parser.MetricRequest][]*types.MetricData) {
+	expr.StoreFetched(metricMap, r, func(path string) (int64, int64) {
+		return b.pathExprTimeMap[path].from, b.pathExprTimeMap[path].until
+	})
+	for _, m := range b.planned {
+		if series := metricMap[m]; len(series) > 0 {
+			metricMap[m] = series[:b.limitSeries(m.Metric, len(series))]
+		}
+	}
+
+	for _, m := range b.derived {
+		if _, ok := metricMap[m]; !ok {
+			metricMap[m] = sliceFetched(metricMap[b.plan.window(m)], m)
+		}
+	}
+}
+
+// sliceFetched returns series fetched for a wider window, that are cut to m. Like whisper does, points with
+// timestamps in (from, until] are returned. Values are shared with the fetched series
+func sliceFetched(series []*types.MetricData, m parser.MetricRequest) []*types.MetricData {
+	res := make([]*types.MetricData, 0, len(series))
+	for _, s := range series {
+		res = append(res, s.Slice(m.From+1, m.Until+1))
+	}
+	return res
+}
@@ -0,0 +1,237 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperErrors "github.com/go-graphite/carbonapi/zipper/errors"
+	"github.com/go-graphite/carbonapi/zipper/protocols/v3"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/lomik/zapwriter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchPlan(t *testing.T) {
+	plan := newFetchPlan([]parser.MetricRequest{
+		{Metric: "foo", From: 100, Until: 200},
+		{Metric: "foo", From: 50, Until: 200},
+		{Metric: "foo", From: 100, Until: 200},
+		{Metric: "foo", From: 150, Until: 250},
+		{Metric: "foo", From: 1000, Until: 1100},
+		{Metric: "bar", From: 100, Until: 200},
+	})
+
+	assert.Equal(t, parser.MetricRequest{Metric: "foo", From: 50, Until: 250}, plan.window(parser.MetricRequest{Metric: "foo", From: 100, Until: 200}))
+	assert.Equal(t, parser.MetricRequest{Metric: "foo", From: 50, Until: 250}, plan.window(parser.MetricRequest{Metric: "foo", From: 150, Until: 250}))
+	// windows that don't overlap are fetched separately
+	assert.Equal(t, parser.MetricRequest{Metric: "foo", From: 1000, Until: 1100}, plan.window(parser.MetricRequest{Metric: "foo", From: 1000, Until: 1100}))
+	assert.Equal(t, parser.MetricRequest{Metric: "bar", From: 100, Until: 200}, plan.window(parser.MetricRequest{Metric: "bar", From: 100, Until: 200}))
+	assert.Len(t, plan, 3)
+}
+
+type prefetchMockZipper struct {
+	mockCarbonZipper
+	requests []pb.MultiFetchRequest
+	// failed metrics are not returned, fetch returns error if there are any
+	failed map[string]bool
+}
+
+func (z *prefetchMockZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	z.requests = append(z.requests, request)
+	var res []*types.MetricData
+	var err error
+	for _, m := range request.Metrics {
+		if z.failed[m.Name] {
+			err = fmt.Errorf("backend failed")
+			continue
+		}
+		values := make([]float64, (m.StopTime-m.StartTime)/60+1)
+		for i := range values {
+			values[i] = float64(i)
+		}
+		r := types.MakeMetricData(m.Name, values, 60, m.StartTime)
+		r.PathExpression = m.PathExpression
+		r.RequestStartTime = m.StartTime
+		r.RequestStopTime = m.StopTime
+		res = append(res, r)
+	}
+	return res, nil, err
+}
+
+func TestRenderFetchErrorOfBatch(t *testing.T) {
+	z := &prefetchMockZipper{failed: map[string]bool{"foo.baz": true}}
+	defer useZipper(z)()
+
+	targets := []string{"foo.bar", "foo.baz", "sumSeries(foo.bar,foo.baz)"}
+	query := "/render/?format=json&noCache=1&from=1510913400&until=1510913700"
+	for _, target := range targets {
+		query += "&target=" + url.QueryEscape(target)
+	}
+	req, rr := setUpRequest(t, query)
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, z.requests, 1)
+
+	// only targets which metrics weren't fetched get the error
+	assert.Equal(t, []string{
+		"foo.baz: backend failed",
+		"sumSeries(foo.bar,foo.baz): backend failed",
+	}, rr.Header()[targetErrorsHeader])
+}
+
+func TestRenderFetchesLookbackOnce(t *testing.T) {
+	z := &prefetchMockZipper{}
+	defer useZipper(z)()
+
+	targets := []string{"foo.bar", "movingSum(foo.bar,'2min')", "movingAverage(foo.bar,'5min')"}
+	query := "/render/?format=json&noCache=1&from=1510913400&until=1510913700"
+	for _, target := range targets {
+		query += "&target=" + url.QueryEscape(target)
+	}
+	req, rr := setUpRequest(t, query)
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	if assert.Len(t, z.requests, 1) && assert.Len(t, z.requests[0].Metrics, 1) {
+		assert.Equal(t, int64(1510913100), z.requests[0].Metrics[0].StartTime)
+		assert.Equal(t, int64(1510913700), z.requests[0].Metrics[0].StopTime)
+	}
+
+	var series []struct {
+		Target     string       `json:"target"`
+		Datapoints [][2]float64 `json:"datapoints"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &series))
+	if assert.Len(t, series, 3) {
+		// points are in (from, until] and cut from the widest window
+		assert.Equal(t, "foo.bar", series[0].Target)
+		assert.Equal(t, [][2]float64{{6, 1510913460}, {7, 1510913520}, {8, 1510913580}, {9, 1510913640}, {10, 1510913700}}, series[0].Datapoints)
+		assert.Equal(t, `movingAverage(foo.bar,"5min")`, series[2].Target)
+	}
+}
+
+func TestRenderFetchesTargetsInOneBatch(t *testing.T) {
+	z := &prefetchMockZipper{}
+	defer useZipper(z)()
+
+	targets := []string{"foo.bar", "sumSeries(foo.baz)", "applyByNode(foo.bar,1,'%.qux')"}
+	query := "/render/?format=json&noCache=1&from=1510913400&until=1510913700"
+	for _, target := range targets {
+		query += "&target=" + url.QueryEscape(target)
+	}
+	req, rr := setUpRequest(t, query)
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// the first batch is the request's targets, the second one is produced by applyByNode
+	if assert.Len(t, z.requests, 2) {
+		var names []string
+		for _, m := range z.requests[0].Metrics {
+			names = append(names, m.Name)
+		}
+		assert.Equal(t, []string{"foo.bar", "foo.baz"}, names)
+		if assert.Len(t, z.requests[1].Metrics, 1) {
+			assert.Equal(t, "foo.qux", z.requests[1].Metrics[0].Name)
+		}
+	}
+
+	var series []struct {
+		Target string `json:"target"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &series))
+	assert.Len(t, series, 3)
+}
+
+func TestFilterFunctionsPushdown(t *testing.T) {
+	tests := []struct {
+		targets []string
+		filters map[string]*pb.FilteringFunction
+	}{
+		{
+			[]string{"highestMax(foo.*, 3)"},
+			map[string]*pb.FilteringFunction{"foo.*": {Name: "highestMax", Arguments: []string{"3"}}},
+		},
+		{
+			[]string{"sumSeries(lowest(foo.*, 2, 'max'))", "bar.*"},
+			map[string]*pb.FilteringFunction{"foo.*": {Name: "lowest", Arguments: []string{"2", "max"}}},
+		},
+		// other consumers of the same series need all of them
+		{[]string{"highestMax(foo.*, 3)", "foo.*"}, map[string]*pb.FilteringFunction{}},
+		{[]string{"highestMax(foo.*, 3)", "sumSeries(foo.*)"}, map[string]*pb.FilteringFunction{}},
+		{[]string{"highestMax(timeShift(foo.*, '1d'), 3)"}, map[string]*pb.FilteringFunction{}},
+		{[]string{"highest(foo.*, n=3)"}, map[string]*pb.FilteringFunction{}},
+		// targets of the next batches aren't known
+		{[]string{"highestMax(foo.*, 3)", "applyByNode(bar.*, 1, '%.baz')"}, nil},
+	}
+	for _, tt := range tests {
+		var exps []parser.Expr
+		for _, target := range tt.targets {
+			exp, _, err := parser.ParseExpr(target)
+			assert.NoError(t, err)
+			exps = append(exps, exp)
+		}
+		assert.Equal(t, tt.filters, filterFunctions(exps), strings.Join(tt.targets, ", "))
+	}
+
+	z := &prefetchMockZipper{}
+	defer useZipper(z)()
+
+	req, rr := setUpRequest(t, "/render/?format=json&noCache=1&target="+url.QueryEscape("highestMax(foo.*, 3)")+"&target=bar.*")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.Len(t, z.requests, 1) && assert.Len(t, z.requests[0].Metrics, 2) {
+		assert.Equal(t, []*pb.FilteringFunction{{Name: "highestMax", Arguments: []string{"3"}}}, z.requests[0].Metrics[0].FilterFunctions)
+		assert.Empty(t, z.requests[0].Metrics[1].FilterFunctions)
+	}
+}
+
+func TestFetchTransportCompression(t *testing.T) {
+	z := &prefetchMockZipper{}
+	defer useZipper(z)()
+
+	srv := httptest.NewServer(http.HandlerFunc(renderHandler))
+	defer srv.Close()
+
+	newBackend := func(compression string) (zipperTypes.BackendServer, *zipperErrors.Errors) {
+		concurrency, maxTries, idle, keepAlive := 0, 1, 1, time.Second
+		return v3.New(zapwriter.Logger("test"), zipperTypes.BackendV2{
+			GroupName:            "carbonapi",
+			Protocol:             "carbonapi_v3_pb",
+			Servers:              []string{srv.URL},
+			ConcurrencyLimit:     &concurrency,
+			MaxTries:             &maxTries,
+			MaxIdleConnsPerHost:  &idle,
+			KeepAliveInterval:    &keepAlive,
+			Timeouts:             &zipperTypes.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+			TransportCompression: compression,
+		})
+	}
+
+	request := &pb.MultiFetchRequest{Metrics: []pb.FetchRequest{{Name: "foo.bar", PathExpression: "foo.*", StartTime: 1510913400, StopTime: 1510913700}}}
+	for _, compression := range []string{"", "gorilla", "gzip"} {
+		backend, e := newBackend(compression)
+		if !assert.Nil(t, e, compression) {
+			continue
+		}
+		res, _, e := backend.Fetch(context.Background(), request)
+		if assert.Nil(t, e, compression) && assert.Len(t, res.Metrics, 1, compression) {
+			m := res.Metrics[0]
+			assert.Equal(t, "foo.bar", m.Name, compression)
+			assert.Equal(t, "foo.*", m.PathExpression, compression)
+			assert.Equal(t, []float64{0, 1, 2, 3, 4, 5}, m.Values, compression)
+		}
+	}
+
+	_, e := newBackend("zstd")
+	assert.NotNil(t, e)
+}
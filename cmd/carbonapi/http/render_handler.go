@@ -1,7 +1,14 @@
 package http
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"runtime/debug"
 	"strconv"
 	"time"
 
@@ -9,10 +16,10 @@ import (
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/date"
 	"github.com/go-graphite/carbonapi/expr"
-	"github.com/go-graphite/carbonapi/expr/functions/cairo/png"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
 
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"github.com/lomik/zapwriter"
@@ -33,12 +40,48 @@ func cleanupParams(r *http.Request) {
 	r.Form.Del("_t") // Used by jquery.graphite.js
 }
 
+// renderCacheKey returns query cache key for render request, form should be cleaned up by cleanupParams. Series are
+// cached before they are consolidated and marshaled, so requests that differ only in format and maxDataPoints share
+// the key
+func renderCacheKey(tenant *config.TenantConfig, backendGroup string, form url.Values) string {
+	series := make(url.Values, len(form))
+	for k, v := range form {
+		if k != "format" && k != "maxDataPoints" {
+			series[k] = v
+		}
+	}
+	key := series.Encode()
+	if backendGroup != "" {
+		// responses of different backend groups should never be mixed
+		key = backendGroup + "\x00" + key
+	}
+	return tenant.CacheKey(key)
+}
+
 func setError(w http.ResponseWriter, accessLogDetails *carbonapipb.AccessLogDetails, msg string, status int) {
 	http.Error(w, http.StatusText(status)+": "+msg, status)
 	accessLogDetails.Reason = msg
 	accessLogDetails.HTTPCode = int32(status)
 }
 
+// graphlotRawdataHandler serves graphite-web's /graphlot/rawdata, which is render request in graphlot format
+func graphlotRawdataHandler(w http.ResponseWriter, r *http.Request) {
+	renderAs(w, r, graphlotFormat)
+}
+
+// renderAs serves render request in format, regardless of format parameter
+func renderAs(w http.ResponseWriter, r *http.Request, format string) {
+	q := r.URL.Query()
+	q.Set("format", format)
+	r.URL.RawQuery = q.Encode()
+	if r.PostForm != nil {
+		r.PostForm.Del("format")
+	}
+	// form will be parsed again with the new query
+	r.Form = nil
+	renderHandler(w, r)
+}
+
 func getFormat(r *http.Request) string {
 	format := r.FormValue("format")
 
@@ -46,6 +89,14 @@ func getFormat(r *http.Request) string {
 		format = rawFormat
 	}
 
+	if format == "" && parser.TruthyBool(r.FormValue("includeRaw")) {
+		format = debugFormat
+	}
+
+	if format == "" {
+		format = formatFromAccept(r.Header.Get("Accept"))
+	}
+
 	if format == "" {
 		format = pngFormat
 	}
@@ -54,7 +105,7 @@ func getFormat(r *http.Request) string {
 }
 
 func getCacheTimeout(logger *zap.Logger, r *http.Request) int32 {
-	cacheTimeout := config.Config.Cache.DefaultTimeoutSec
+	cacheTimeout := config.Current().Cache.DefaultTimeoutSec
 
 	if tstr := r.FormValue("cacheTimeout"); tstr != "" {
 		t, err := strconv.Atoi(tstr)
@@ -71,15 +122,112 @@ func getCacheTimeout(logger *zap.Logger, r *http.Request) int32 {
 	return cacheTimeout
 }
 
+// getRecencyCacheTimeout returns cache timeout for the query that ends at until. Data in the past doesn't change, so
+// such responses can be cached for longer, see cache.recencyTimeouts.
+func getRecencyCacheTimeout(cacheTimeout int32, until int64) int32 {
+	age := timeNow().Unix() - until
+	for _, rule := range config.Current().Cache.RecencyTimeouts {
+		if age >= int64(rule.UntilOlderThan.Seconds()) {
+			return rule.TimeoutSec
+		}
+	}
+
+	return cacheTimeout
+}
+
+// fetchProtobufV3 serves carbonapi_v3_pb fetch requests, sent by zipper of another carbonapi that use this one as a
+// backend. Request is passed to zipper as-is, without any expression evaluation. Response is compressed if client
+// requested it, applied compression is returned
+func fetchProtobufV3(ctx context.Context, r *http.Request, accessLogDetails *carbonapipb.AccessLogDetails) ([]byte, string, int, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	var req pb.MultiFetchRequest
+	err = req.Unmarshal(body)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	if len(req.Metrics) == 0 {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("empty request")
+	}
+
+	for _, m := range req.Metrics {
+		accessLogDetails.Targets = append(accessLogDetails.Targets, m.PathExpression)
+	}
+
+	ApiMetrics.RenderRequests.Add(1)
+	tenant := getTenant(ctx)
+	if s := shadow; s != nil {
+		s.mirrorRender(ctx, tenant, req)
+	}
+	limiter := tenant.GetLimiter()
+	limiter.Enter()
+	results, stats, err := tenant.GetZipper().Render(ctx, req)
+	limiter.Leave()
+	if stats != nil {
+		accessLogDetails.ZipperRequests += stats.ZipperRequests
+		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
+	}
+	if err != nil && len(results) == 0 {
+		return nil, "", http.StatusInternalServerError, err
+	}
+
+	b, encoding, err := marshalFetchResponse(results, r.Header.Get(httpHeaders.HeaderAcceptEncoding))
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, err
+	}
+
+	return b, encoding, http.StatusOK, nil
+}
+
+// marshalFetchResponse encodes fetch response with compression requested by carbonapi client and returns applied
+// compression. Unknown compressions are ignored, plain protobuf is sent then
+func marshalFetchResponse(results []*types.MetricData, encoding string) ([]byte, string, error) {
+	switch encoding {
+	case httpHeaders.EncodingGorilla:
+		b, err := types.MarshalColumnar(results)
+		return b, encoding, err
+	case httpHeaders.EncodingGzip:
+		b, err := types.MarshalProtobufV3(results)
+		if err != nil {
+			return nil, "", err
+		}
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(b); err != nil {
+			return nil, "", err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), encoding, nil
+	default:
+		b, err := types.MarshalProtobufV3(results)
+		return b, "", err
+	}
+}
+
 func renderHandler(w http.ResponseWriter, r *http.Request) {
+	if parser.TruthyBool(r.FormValue("validateOnly")) {
+		lintHandler(w, r)
+		return
+	}
+
 	t0 := time.Now()
 	uuid := uuid.NewV4()
 
 	// TODO: Migrate to context.WithTimeout
 	// ctx, _ := context.WithTimeout(context.TODO(), config.Config.ZipperTimeout)
 	ctx := utilctx.SetUUID(r.Context(), uuid.String())
+	if s := shadow; s != nil {
+		ctx = s.sample(ctx)
+	}
 	username, _, _ := r.BasicAuth()
 	requestHeaders := utilctx.GetLogHeaders(ctx)
+	tenant := getTenant(ctx)
 
 	logger := zapwriter.Logger("render").With(
 		zap.String("carbonapi_uuid", uuid.String()),
@@ -93,6 +241,7 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = &carbonapipb.AccessLogDetails{
 		Handler:        "render",
 		Username:       username,
+		Tenant:         tenantName(tenant),
 		CarbonapiUUID:  uuid.String(),
 		URL:            r.URL.RequestURI(),
 		PeerIP:         srcIP,
@@ -104,8 +253,11 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logAsError := false
+	var timings []targetTiming
 	defer func() {
 		deferredAccessLogging(accessLogger, accessLogDetails, t0, logAsError)
+		logSlowQuery(accessLogDetails, timings, time.Since(t0))
+		topQueriesTracker.Add(accessLogDetails, time.Since(t0), timeNow())
 	}()
 
 	size := 0
@@ -118,30 +270,69 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if name := r.FormValue("queryName"); name != "" {
+		if code, err := applySavedQuery(r, name); err != nil {
+			setError(w, accessLogDetails, err.Error(), code)
+			logAsError = true
+			return
+		}
+	}
+
 	targets := r.Form["target"]
 	from := r.FormValue("from")
 	until := r.FormValue("until")
-	template := r.FormValue("template")
 	useCache := !parser.TruthyBool(r.FormValue("noCache"))
 	format := getFormat(r)
 
-	var jsonp string
+	outFormat, ok := lookupFormat(format)
+	if !ok {
+		setError(w, accessLogDetails, "unknown format "+format, http.StatusBadRequest)
+		logAsError = true
+		return
+	}
+	// format could be chosen by Accept header
+	r.Form.Set("format", format)
+
+	for _, msg := range deprecationWarnings(targets, config.Current().DeprecatedFunctions) {
+		w.Header().Add(warningsHeader, msg)
+	}
 
-	if format == jsonFormat {
+	var jsonp string
+	if outFormat.has(FormatJSONP) {
 		// TODO(dgryski): check jsonp only has valid characters
 		jsonp = r.FormValue("jsonp")
 	}
 
+	if format == protobufV3Format {
+		accessLogDetails.Format = format
+		body, encoding, status, err := fetchProtobufV3(ctx, r, accessLogDetails)
+		if err != nil {
+			setError(w, accessLogDetails, err.Error(), status)
+			logAsError = true
+			return
+		}
+		if encoding != "" {
+			w.Header().Set(httpHeaders.HeaderEncoding, encoding)
+		}
+		accessLogDetails.CarbonapiResponseSizeBytes = int64(len(body))
+		writeResponse(w, body, format, jsonp)
+		return
+	}
+
 	cacheTimeout := getCacheTimeout(logger, r)
 
 	cleanupParams(r)
 
-	cacheKey := r.Form.Encode()
+	cacheKey := renderCacheKey(tenant, utilctx.GetBackendGroup(ctx), r.Form)
 
 	// normalize from and until values
 	qtz := r.FormValue("tz")
-	from32 := date.DateParamToEpoch(from, qtz, timeNow().Add(-24*time.Hour).Unix(), config.Config.DefaultTimeZone)
-	until32 := date.DateParamToEpoch(until, qtz, timeNow().Unix(), config.Config.DefaultTimeZone)
+	from32 := date.DateParamToEpoch(from, qtz, timeNow().Add(-24*time.Hour).Unix(), tenant.GetTimeZone())
+	until32 := date.DateParamToEpoch(until, qtz, timeNow().Unix(), tenant.GetTimeZone())
+
+	if r.FormValue("cacheTimeout") == "" {
+		cacheTimeout = getRecencyCacheTimeout(cacheTimeout, until32)
+	}
 
 	accessLogDetails.UseCache = useCache
 	accessLogDetails.FromRaw = from
@@ -152,19 +343,34 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	accessLogDetails.CacheTimeout = cacheTimeout
 	accessLogDetails.Format = format
 	accessLogDetails.Targets = targets
-	if useCache {
+	mem := newMemoryAccount(config.Config.MemoryLimits.Request)
+	defer mem.release()
+
+	// debug format describes fetched series, that are not cached
+	if useCache && format != debugFormat {
 		tc := time.Now()
+		var results []*types.MetricData
 		response, err := config.Config.QueryCache.Get(cacheKey)
+		if err == nil {
+			results, err = types.UnmarshalColumnar(response)
+			if err != nil {
+				logger.Warn("failed to decode cached series",
+					zap.String("cache_key", cacheKey),
+					zap.Error(err),
+				)
+			}
+		}
 		td := time.Since(tc).Nanoseconds()
 		ApiMetrics.RenderCacheOverheadNS.Add(td)
 
 		accessLogDetails.CarbonzipperResponseSizeBytes = 0
-		accessLogDetails.CarbonapiResponseSizeBytes = int64(len(response))
 
 		if err == nil {
 			ApiMetrics.RequestCacheHits.Add(1)
-			writeResponse(w, response, format, jsonp)
 			accessLogDetails.FromCache = true
+			if !writeRenderResults(w, r, results, outFormat, jsonp, mem, accessLogDetails) {
+				logAsError = true
+			}
 			return
 		}
 		ApiMetrics.RequestCacheMisses.Add(1)
@@ -176,176 +382,282 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if memoryOverloaded() {
+		ApiMetrics.MemoryShedRequests.Add(1)
+		setError(w, accessLogDetails, "too much memory is used by requests in progress, try again later", http.StatusServiceUnavailable)
+		logAsError = true
+		return
+	}
 	var results []*types.MetricData
+	var debug []targetDebug
 	errors := make(map[string]string)
+	// partial response of the request with panicked targets isn't cached
+	var panicked bool
+	index := getTagIndex(tenant)
+	metricsIndex := getMetricIndex(tenant)
 	metricMap := make(map[parser.MetricRequest][]*types.MetricData)
 
 	var metrics []string
-	// Iterate over all targets, check if we need to fetch them
-	// TODO(civil): replace loop with 'for targetIdx := 0; targetIdx < len(targets); targetIdx++'
-	var targetIdx = 0
-	for targetIdx < len(targets) {
-		var target = targets[targetIdx]
-		targetIdx++
-
-		exp, e, err := parser.ParseExpr(target)
-
-		// if expression cannot be parsed return error
-		if err != nil || e != "" {
-			msg := buildParseErrorString(target, e, err)
-			setError(w, accessLogDetails, msg, http.StatusBadRequest)
-			logAsError = true
-			return
+	// targets of the request and ones they are rewritten to
+	var evaluated []string
+	// zipper request is shared by all targets of the batch
+	var zipperRuntime float64
+	var zipperRequests int64
+	fetch := func(batch []string, exps []parser.Expr) error {
+		for _, exp := range exps {
+			accessLogDetails.TargetFingerprints = append(accessLogDetails.TargetFingerprints, exprFingerprint(exp))
+		}
+		for _, msg := range resolutionWarnings(batch, exps, from32) {
+			w.Header().Add(warningsHeader, msg)
 		}
 
-		// Splitting requests into batches is now done by carbonzipper
-		pathExprTimeMap := make(map[string]requestInterval)
-		var req pb.MultiFetchRequest
-		for _, m := range exp.Metrics() {
-			metrics = append(metrics, m.Metric)
-			mFetch := m
-			mFetch.From += from32
-			mFetch.Until += until32
-
-			if _, ok := metricMap[mFetch]; ok {
-				// we already have this metric in fetch queue
-				continue
+		fetches := newFetchBatch(exps, from32, until32)
+		fetches.incremental = useCache
+		for i, exp := range exps {
+			for _, m := range exp.Metrics() {
+				metrics = append(metrics, m.Metric)
+			}
+			if err := fetches.add(exp, index, metricsIndex, metricMap); err != nil {
+				errors[batch[i]] = err.Error()
 			}
-			metricMap[mFetch] = make([]*types.MetricData, 0, 1)
-
-			req.Metrics = append(req.Metrics, pb.FetchRequest{
-				Name:           m.Metric,
-				PathExpression: m.Metric,
-				StartTime:      mFetch.From,
-				StopTime:       mFetch.Until,
-			})
-			pathExprTimeMap[m.Metric] = requestInterval{from: mFetch.From, until: mFetch.Until}
+		}
+		accessLogDetails.Metrics = metrics
+		if fetches.limitErr != nil {
+			setError(w, accessLogDetails, fetches.limitErr.Error(), http.StatusRequestEntityTooLarge)
+			return errResponseWritten
 		}
 
-		// Do we need to fetch anything?
-		if len(req.Metrics) > 0 {
-			ApiMetrics.RenderRequests.Add(1)
-			config.Config.Limiter.Enter()
-
-			r, stats, err := config.Config.ZipperInstance.Render(ctx, req)
+		// Splitting requests into batches is now done by carbonzipper
+		var fetched []*types.MetricData
+		var fetchErr error
+		zipperRuntime, zipperRequests = 0, 0
+		if !fetches.empty() {
+			tz := time.Now()
+			r, stats, err := fetches.fetch(ctx, tenant)
+			zipperRuntime = time.Since(tz).Seconds()
+			accessLogDetails.ZipperRuntime += zipperRuntime
 			if stats != nil {
+				zipperRequests = stats.ZipperRequests
 				accessLogDetails.ZipperRequests += stats.ZipperRequests
 				accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
 			}
-			if err != nil {
-				errors[target] = err.Error()
-			}
-
-			config.Config.Limiter.Leave()
-			for _, m := range r {
-				var from int64
-				var until int64
-				if m.RequestStartTime != 0 && m.RequestStopTime != 0 {
-					from = m.RequestStartTime
-					until = m.RequestStopTime
-				} else {
-					from = pathExprTimeMap[m.PathExpression].from
-					until = pathExprTimeMap[m.PathExpression].until
-				}
-
-				mFetch := parser.MetricRequest{
-					Metric: m.PathExpression,
-					From:   from,
-					Until:  until,
-				}
-
-				d := metricMap[mFetch]
-				metricMap[mFetch] = append(d, m)
+			fetchErr = err
 
-			}
+			points := 0
 			for i := range r {
 				size += r[i].Size()
+				points += len(r[i].Values)
 			}
-
-			for mFetch := range metricMap {
-				expr.SortMetrics(metricMap[mFetch], mFetch)
+			if !mem.reserve(int64(points) * pointMemorySize) {
+				ApiMetrics.MemoryLimitExceeded.Add(1)
+				setError(w, accessLogDetails, memoryLimitMessage(mem), http.StatusRequestEntityTooLarge)
+				return errResponseWritten
 			}
+			fetched = r
 		}
-		accessLogDetails.Metrics = metrics
+		fetches.store(fetched, metricMap)
+		if fetches.limitErr != nil {
+			setError(w, accessLogDetails, fetches.limitErr.Error(), http.StatusRequestEntityTooLarge)
+			return errResponseWritten
+		}
+		for _, msg := range fetches.warnings {
+			w.Header().Add(warningsHeader, msg)
+		}
+		if fetchErr != nil {
+			// error of the batch belongs only to targets, which metrics weren't fetched
+			for i, exp := range exps {
+				if fetches.missing(exp, metricMap) {
+					errors[batch[i]] = fetchErr.Error()
+				}
+			}
+		}
+		return nil
+	}
 
-		var rewritten bool
-		var newTargets []string
+	eval := func(target string, exp parser.Expr, rewritten bool) error {
+		timing := targetTiming{Target: target, ZipperRuntime: zipperRuntime, ZipperRequests: zipperRequests}
+		if exp.IsFunc() {
+			timing.Function = exp.Target()
+		}
+		if format == debugFormat {
+			debug = append(debug, newTargetDebug(target, exp, from32, until32, metricMap))
+		}
+		evaluated = append(evaluated, target)
+		if rewritten {
+			timings = append(timings, timing)
+			return nil
+		}
 
-		rewritten, newTargets, err = expr.RewriteExpr(exp, from32, until32, metricMap)
+		te := time.Now()
+		expressions, err := evalTarget(exp, from32, until32, metricMap)
+		timing.EvalRuntime = time.Since(te).Seconds()
+		accessLogDetails.EvalRuntime += timing.EvalRuntime
+		if perr, ok := err.(*evalPanicError); ok {
+			logger.Error("panic during eval",
+				zap.String("target", target),
+				zap.String("cache_key", cacheKey),
+				zap.Any("reason", perr.reason),
+				zap.ByteString("stack", perr.stack),
+			)
+			panicked = true
+		}
 		if err != nil && err != parser.ErrSeriesDoesNotExist {
 			errors[target] = err.Error()
 			accessLogDetails.Reason = err.Error()
 			logAsError = true
-			return
-		}
-
-		if rewritten {
-			targets = append(targets, newTargets...)
 		} else {
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						logger.Error("panic during eval:",
-							zap.String("cache_key", cacheKey),
-							zap.Any("reason", r),
-							zap.Stack("stack"),
-						)
-					}
-				}()
-				expressions, err := expr.EvalExpr(exp, from32, until32, metricMap)
-				if err != nil && err != parser.ErrSeriesDoesNotExist {
-					errors[target] = err.Error()
-					accessLogDetails.Reason = err.Error()
-					logAsError = true
-					return
-				}
-				results = append(results, expressions...)
-			}()
+			results = append(results, expressions...)
 		}
+		timings = append(timings, timing)
+		return nil
 	}
 
-	var body []byte
-
-	if len(results) == 0 {
-		logger.Info("empty response or no response")
-		results = append(results, &types.MetricData{})
+	err = expr.EvalBatches(targets, from32, until32, metricMap, fetch, eval)
+	switch e := err.(type) {
+	case nil:
+	case *expr.ParseError:
+		setError(w, accessLogDetails, buildParseErrorString(e.Target, e.Rest, e.Err), http.StatusBadRequest)
+		logAsError = true
+		return
+	case *expr.RewriteError:
+		errors[e.Target] = e.Error()
+		accessLogDetails.Reason = e.Error()
+		logAsError = true
+		return
+	default:
+		logAsError = true
+		return
 	}
 
-	switch format {
-	case jsonFormat:
-		if maxDataPoints, _ := strconv.Atoi(r.FormValue("maxDataPoints")); maxDataPoints != 0 {
-			types.ConsolidateJSON(maxDataPoints, results)
-		}
+	// series are cached before consolidation, that changes them in place
+	cached, err := types.MarshalColumnar(results)
+	if err != nil {
+		logger.Warn("failed to encode series for cache",
+			zap.Error(err),
+		)
+	}
 
-		body = types.MarshalJSON(results)
-	case protobufFormat, protobuf3Format:
-		body, err = types.MarshalProtobuf(results)
-		if err != nil {
-			setError(w, accessLogDetails, err.Error(), http.StatusInternalServerError)
-			logAsError = true
-			return
+	if panicked {
+		cached = nil
+	}
+	if len(errors) > 0 {
+		accessLogDetails.TargetErrors = errors
+		for _, target := range evaluated {
+			if msg, ok := errors[target]; ok {
+				w.Header().Add(targetErrorsHeader, target+": "+msg)
+			}
 		}
-	case rawFormat:
-		body = types.MarshalRaw(results)
-	case csvFormat:
-		body = types.MarshalCSV(results)
-	case pickleFormat:
-		body = types.MarshalPickle(results)
-	case pngFormat:
-		body = png.MarshalPNGRequest(r, results, template)
-	case svgFormat:
-		body = png.MarshalSVGRequest(r, results, template)
 	}
 
-	writeResponse(w, body, format, jsonp)
+	if format == debugFormat {
+		r = r.WithContext(setTargetDebug(r.Context(), debug))
+	}
+	if len(errors) > 0 {
+		r = r.WithContext(setTargetErrors(r.Context(), errors))
+	}
+	if !writeRenderResults(w, r, results, outFormat, jsonp, mem, accessLogDetails) {
+		logAsError = true
+		return
+	}
 
-	if len(results) != 0 {
+	if cached != nil {
 		tc := time.Now()
-		config.Config.QueryCache.Set(cacheKey, body, cacheTimeout)
+		config.Config.QueryCache.Set(cacheKey, cached, cacheTimeout)
 		td := time.Since(tc).Nanoseconds()
 		ApiMetrics.RenderCacheOverheadNS.Add(td)
+
+		metrics := make([]string, 0, len(metricMap))
+		for m := range metricMap {
+			metrics = append(metrics, m.Metric)
+		}
+		queryCacheIndex.Add(cacheKey, evaluated, metrics, cacheTimeout, timeNow())
 	}
 
 	gotErrors := len(errors) > 0
 	accessLogDetails.HaveNonFatalErrors = gotErrors
 }
+
+// errResponseWritten stops evaluation of render request, if error response is already written
+var errResponseWritten = fmt.Errorf("response is written")
+
+// evalPanicError is returned by evalTarget if evaluation panics
+type evalPanicError struct {
+	reason interface{}
+	stack  []byte
+}
+
+func (e *evalPanicError) Error() string {
+	return fmt.Sprintf("panic during evaluation: %v", e.reason)
+}
+
+type targetErrorsKey struct{}
+
+// getTargetErrors returns errors of targets, that are omitted from response, by target
+func getTargetErrors(ctx context.Context) map[string]string {
+	e, _ := ctx.Value(targetErrorsKey{}).(map[string]string)
+	return e
+}
+
+func setTargetErrors(ctx context.Context, e map[string]string) context.Context {
+	return context.WithValue(ctx, targetErrorsKey{}, e)
+}
+
+// evalTarget evaluates parsed target, panic is recovered and returned as *evalPanicError, so other targets of the
+// request aren't affected
+func evalTarget(exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (results []*types.MetricData, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ApiMetrics.EvalPanics.Add(1)
+			results = nil
+			err = &evalPanicError{reason: r, stack: debug.Stack()}
+		}
+	}()
+	return expr.EvalExpr(exp, from, until, values)
+}
+
+// writeRenderResults consolidates evaluated or cached series for the format and writes the response. false is
+// returned if response can't be built, error is already written then
+func writeRenderResults(w http.ResponseWriter, r *http.Request, results []*types.MetricData, outFormat *outputFormat, jsonp string, mem *memoryAccount, accessLogDetails *carbonapipb.AccessLogDetails) bool {
+	accessLogDetails.SeriesCount = int64(len(results))
+	for _, res := range results {
+		accessLogDetails.DatapointsCount += int64(len(res.Values))
+	}
+
+	if len(results) == 0 {
+		zapwriter.Logger("render").Info("empty response or no response")
+		results = append(results, &types.MetricData{})
+	}
+
+	maxDataPoints, _ := strconv.Atoi(r.FormValue("maxDataPoints"))
+	if limit := config.Config.MaxResponseSize; limit > 0 {
+		// building of huge response could exhaust memory, so it's rejected in advance
+		if size := outFormat.estimateSize(results, maxDataPoints); size > limit {
+			msg := fmt.Sprintf("estimated response size %d bytes exceeds limit of %d bytes", size, limit)
+			if suggested := outFormat.suggestMaxDataPoints(results, limit); suggested > 0 {
+				msg += fmt.Sprintf(", set maxDataPoints=%d or less", suggested)
+			} else {
+				msg += ", reduce number of series or time range"
+			}
+			setError(w, accessLogDetails, msg, http.StatusRequestEntityTooLarge)
+			return false
+		}
+	}
+
+	if !mem.reserve(int64(outFormat.estimateSize(results, maxDataPoints))) {
+		ApiMetrics.MemoryLimitExceeded.Add(1)
+		setError(w, accessLogDetails, memoryLimitMessage(mem), http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	tm := time.Now()
+	body, err := outFormat.marshalResults(r, results, maxDataPoints)
+	if err != nil {
+		setError(w, accessLogDetails, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	accessLogDetails.MarshalRuntime = time.Since(tm).Seconds()
+	accessLogDetails.CarbonapiResponseSizeBytes = int64(len(body))
+
+	accessLogDetails.HTTPCode = int32(writeResponseIfModified(w, r, body, accessLogDetails.Format, jsonp))
+	return true
+}
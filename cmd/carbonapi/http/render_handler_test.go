@@ -0,0 +1,206 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRecencyCacheTimeout(t *testing.T) {
+	savedTimeouts := config.Config.Cache.RecencyTimeouts
+	defer func() { config.Config.Cache.RecencyTimeouts = savedTimeouts }()
+
+	config.Config.Cache.RecencyTimeouts = []config.RecencyTimeout{
+		{UntilOlderThan: 24 * time.Hour, TimeoutSec: 7 * 86400},
+		{UntilOlderThan: time.Hour, TimeoutSec: 86400},
+	}
+
+	now := timeNow().Unix()
+	assert.Equal(t, int32(60), getRecencyCacheTimeout(60, now))
+	assert.Equal(t, int32(86400), getRecencyCacheTimeout(60, now-2*3600))
+	assert.Equal(t, int32(7*86400), getRecencyCacheTimeout(60, now-2*86400))
+}
+
+func TestRenderHandlerNotModified(t *testing.T) {
+	req, rr := setUpRequest(t, "/render/?target=fallbackSeries(foo.bar,foo.baz)&from=-10minutes&format=json&cacheTimeout=0")
+	renderHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	req, rr = setUpRequest(t, "/render/?target=fallbackSeries(foo.bar,foo.baz)&from=-10minutes&format=json&cacheTimeout=0")
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	renderHandler(rr, req)
+
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+	assert.Empty(t, rr.Body.String())
+
+	req, rr = setUpRequest(t, "/render/?target=fallbackSeries(foo.bar,foo.baz)&from=-10minutes&format=json&cacheTimeout=0")
+	req.Header.Set("If-None-Match", `"other"`)
+	renderHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEmpty(t, rr.Body.String())
+}
+
+func TestGraphlotRawdataHandler(t *testing.T) {
+	req, rr := setUpRequest(t, "/graphlot/rawdata?target=foo.bar&from=-10minutes&format=png&jsonp=cb")
+	graphlotRawdataHandler(rr, req)
+
+	expected := `cb([{"name":"foo.bar","start":1510913280,"end":1510913880,"step":60,"data":[null,1510913759,1510913818]}])`
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, contentTypeJavaScript, rr.Header().Get("Content-Type"))
+	assert.Equal(t, expected, rr.Body.String())
+}
+
+func TestRenderDeprecationWarnings(t *testing.T) {
+	orig := config.Config.DeprecatedFunctions
+	config.Config.DeprecatedFunctions = map[string]string{"sumSeries": "use aggregate", "absolute": ""}
+	defer func() { config.Config.DeprecatedFunctions = orig }()
+
+	req, rr := setUpRequest(t, "/render/?target=absolute(sumSeries(foo.bar))&from=-10minutes&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"absolute is deprecated", "sumSeries is deprecated: use aggregate"}, rr.Header()[warningsHeader])
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "["), "envelope should be opt-in")
+
+	req, rr = setUpRequest(t, "/render/?target=sumSeries(foo.bar)&from=-10minutes&format=json&meta=1&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp struct {
+		Series []json.RawMessage `json:"series"`
+		Meta   struct {
+			Warnings []string `json:"warnings"`
+		} `json:"meta"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Len(t, resp.Series, 1)
+	assert.Equal(t, []string{"sumSeries is deprecated: use aggregate"}, resp.Meta.Warnings)
+
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=json&meta=1&noCache=1")
+	renderHandler(rr, req)
+	assert.Empty(t, rr.Header()[warningsHeader])
+	assert.Contains(t, rr.Body.String(), `"meta":{"warnings":[],"errors":{}}`)
+}
+
+func TestRenderMaxResponseSize(t *testing.T) {
+	defer func(size int) { config.Config.MaxResponseSize = size }(config.Config.MaxResponseSize)
+
+	// 1 series of 3 points in json is estimated as 64 + len("foo.bar") + 3*24 = 143 bytes
+	config.Config.MaxResponseSize = 100
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), "maxDataPoints=1 ")
+
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1&maxDataPoints=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=raw&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), "reduce number of series")
+
+	config.Config.MaxResponseSize = 1000
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRenderCacheSharedByFormats(t *testing.T) {
+	z := &prefetchMockZipper{}
+	defer useZipper(z)()
+	origCache := config.Config.QueryCache
+	config.Config.QueryCache = cache.NewExpireCache(1024 * 1024)
+	defer func() { config.Config.QueryCache = origCache }()
+
+	const query = "/render/?target=foo.bar&from=1510913400&until=1510913700"
+	req, rr := setUpRequest(t, query+"&format=json")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	hits := ApiMetrics.RequestCacheHits.Value()
+	req, rr = setUpRequest(t, query+"&format=csv")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"foo.bar",2017-11-17 10:15:00,5`)
+
+	// series are consolidated after they are taken from the cache
+	req, rr = setUpRequest(t, query+"&format=json&maxDataPoints=2")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var series []struct {
+		Datapoints [][2]float64 `json:"datapoints"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &series))
+	if assert.Len(t, series, 1) {
+		assert.Len(t, series[0].Datapoints, 2)
+	}
+
+	assert.Len(t, z.requests, 1)
+	assert.Equal(t, hits+2, ApiMetrics.RequestCacheHits.Value())
+}
+
+// panicFunction panics on every call
+type panicFunction struct {
+	interfaces.FunctionBase
+}
+
+func (f *panicFunction) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	panic("boom")
+}
+
+func (f *panicFunction) Description() map[string]types.FunctionDescription {
+	return nil
+}
+
+func TestRenderPanicIsolation(t *testing.T) {
+	metadata.RegisterFunction("testPanic", &panicFunction{})
+	defer func() {
+		metadata.FunctionMD.Lock()
+		delete(metadata.FunctionMD.Functions, "testPanic")
+		metadata.FunctionMD.Unlock()
+	}()
+	panics := ApiMetrics.EvalPanics.Value()
+
+	// partial response isn't cached, so the error is returned by the second request too
+	for i := 0; i < 2; i++ {
+		req, rr := setUpRequest(t, "/render/?target=testPanic(foo.bar)&target=foo.bar&from=1510913280&until=1510913880&format=json&meta=1")
+		renderHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []string{"testPanic(foo.bar): panic during evaluation: boom"}, rr.Header()[targetErrorsHeader])
+
+		var resp struct {
+			Series []struct {
+				Target string `json:"target"`
+			} `json:"series"`
+			Meta struct {
+				Errors map[string]string `json:"errors"`
+			} `json:"meta"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		if assert.Len(t, resp.Series, 1) {
+			assert.Equal(t, "foo.bar", resp.Series[0].Target)
+		}
+		assert.Equal(t, map[string]string{"testPanic(foo.bar)": "panic during evaluation: boom"}, resp.Meta.Errors)
+	}
+	assert.Equal(t, panics+2, ApiMetrics.EvalPanics.Value())
+
+	// targets evaluated outside of render requests fail with error
+	_, err := evalTargets(context.Background(), nil, []string{"testPanic(foo.bar)"}, 1510913280, 1510913880)
+	assert.EqualError(t, err, "panic during evaluation: boom")
+}
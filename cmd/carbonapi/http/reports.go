@@ -0,0 +1,260 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/lomik/zapwriter"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+)
+
+// report renders targets on a cron schedule and delivers them by email and/or webhook, one attachment per format
+type report struct {
+	config.ReportConfig
+
+	smtp   config.SMTPConfig
+	tenant *config.TenantConfig
+	client *http.Client
+	logger *zap.Logger
+}
+
+type reportAttachment struct {
+	filename    string
+	format      string
+	contentType string
+	data        []byte
+}
+
+func newReport(cfg config.ReportConfig, smtp config.SMTPConfig) *report {
+	return &report{
+		ReportConfig: cfg,
+		smtp:         smtp,
+		tenant:       config.Config.Tenants.Get(cfg.Tenant),
+		client:       &http.Client{},
+		logger:       zapwriter.Logger("reports").With(zap.String("report", cfg.Name)),
+	}
+}
+
+// generate renders and delivers the report, it's run by scheduler at scheduled times in time zone of its tenant
+func (r *report) generate(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	ApiMetrics.Reports.Add(1)
+	t0 := time.Now()
+	err := r.execute(ctx)
+	if err != nil {
+		ApiMetrics.ReportErrors.Add(1)
+		r.logger.Error("report failed",
+			zap.Strings("targets", r.Targets),
+			zap.Duration("runtime", time.Since(t0)),
+			zap.Error(err),
+		)
+		return
+	}
+	r.logger.Info("report delivered",
+		zap.Duration("runtime", time.Since(t0)),
+	)
+}
+
+// execute renders and delivers the report
+func (r *report) execute(ctx context.Context) error {
+	ctx = utilctx.SetUUID(ctx, uuid.NewV4().String())
+	ctx = setTenant(ctx, r.tenant)
+
+	attachments, err := r.render(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(r.Email) > 0 {
+		msg := r.emailMessage(attachments, timeNow())
+		if err := r.sendEmail(ctx, msg); err != nil {
+			return fmt.Errorf("email: %v", err)
+		}
+	}
+	if r.Webhook != "" {
+		if err := r.postWebhook(ctx, attachments); err != nil {
+			return fmt.Errorf("webhook: %v", err)
+		}
+	}
+	return nil
+}
+
+// render renders targets in each format like render request does
+func (r *report) render(ctx context.Context) ([]reportAttachment, error) {
+	values := url.Values{"target": r.Targets}
+	for k, v := range r.Params {
+		values.Set(k, v)
+	}
+	if r.From != "" {
+		values.Set("from", r.From)
+	}
+	if r.Until != "" {
+		values.Set("until", r.Until)
+	}
+
+	attachments := make([]reportAttachment, 0, len(r.Formats))
+	for _, format := range r.Formats {
+		values.Set("format", format)
+		req, err := http.NewRequest("GET", config.Config.Prefix+"/render/?"+values.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType, err := renderBuffered(req.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("format %s: %v", format, err)
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		attachments = append(attachments, reportAttachment{
+			filename:    r.Name + "." + format,
+			format:      format,
+			contentType: contentType,
+			data:        body,
+		})
+	}
+	return attachments, nil
+}
+
+// emailMessage formats multipart/mixed message with the list of targets as text and base64 encoded attachments
+func (r *report) emailMessage(attachments []reportAttachment, date time.Time) []byte {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", r.smtp.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(r.Email, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", r.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	// writes to bytes.Buffer don't fail
+	w, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	fmt.Fprintf(w, "Report %s, targets:\r\n", r.Name)
+	for _, t := range r.Targets {
+		fmt.Fprintf(w, "  %s\r\n", t)
+	}
+
+	for _, a := range attachments {
+		w, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.filename})},
+		})
+		// lines of base64 encoded data are limited to 76 characters
+		encoded := base64.StdEncoding.EncodeToString(a.data)
+		for len(encoded) > 76 {
+			io.WriteString(w, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(w, encoded+"\r\n")
+	}
+	mw.Close()
+	return buf.Bytes()
+}
+
+// sendEmail sends the message to recipients of the report, connection is upgraded by STARTTLS if the server supports
+// it. Unlike smtp.SendMail it's limited by the context deadline
+func (r *report) sendEmail(ctx context.Context, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", r.smtp.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, err := net.SplitHostPort(r.smtp.Address)
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if r.smtp.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", r.smtp.Username, r.smtp.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(r.smtp.From); err != nil {
+		return err
+	}
+	for _, rcpt := range r.Email {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// postWebhook sends attachments as multipart/form-data: "name" field is a name of the report, each attachment is a
+// file field named by its format
+func (r *report) postWebhook(ctx context.Context, attachments []reportAttachment) error {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("name", r.Name)
+	for _, a := range attachments {
+		w, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":        {a.contentType},
+			"Content-Disposition": {mime.FormatMediaType("form-data", map[string]string{"name": a.format, "filename": a.filename})},
+		})
+		w.Write(a.data)
+	}
+	mw.Close()
+
+	req, err := http.NewRequest(http.MethodPost, r.Webhook, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// body is drained, so connection could be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
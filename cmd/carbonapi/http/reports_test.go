@@ -0,0 +1,118 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTPServer accepts a single message and sends its data to the channel
+func fakeSMTPServer(t *testing.T, messages chan<- string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tc := textproto.NewConn(conn)
+		tc.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tc.ReadLine()
+			if err != nil {
+				return
+			}
+			switch strings.ToUpper(strings.Fields(line)[0]) {
+			case "DATA":
+				tc.PrintfLine("354 go ahead")
+				b, _ := tc.ReadDotBytes()
+				messages <- string(b)
+				tc.PrintfLine("250 OK")
+			case "QUIT":
+				tc.PrintfLine("221 bye")
+				return
+			default:
+				tc.PrintfLine("250 OK")
+			}
+		}
+	}()
+	return l
+}
+
+func TestReports(t *testing.T) {
+	cfg := config.ConfigType{Reporting: config.ReportingConfig{
+		SMTP: config.SMTPConfig{From: "carbonapi@example.com"},
+		Reports: []config.ReportConfig{{
+			Name:     "daily",
+			Schedule: "0 9 * * 1-5",
+			Targets:  []string{"foo.bar"},
+			From:     "1510913280",
+			Until:    "1510913880",
+			Formats:  []string{"csv", "json"},
+			Email:    []string{"ops@example.com"},
+			Subject:  "carbonapi report daily",
+		}},
+	}}
+	c := cfg.Reporting.Reports[0]
+
+	messages := make(chan string, 1)
+	l := fakeSMTPServer(t, messages)
+	defer l.Close()
+	cfg.Reporting.SMTP.Address = l.Addr().String()
+
+	uploads := make(chan *multipart.Form, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		uploads <- r.MultipartForm
+	}))
+	defer srv.Close()
+	c.Webhook = srv.URL
+
+	r := newReport(c, cfg.Reporting.SMTP)
+	assert.NoError(t, r.execute(context.Background()))
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-messages))
+	assert.NoError(t, err)
+	assert.Equal(t, "carbonapi report daily", msg.Header.Get("Subject"))
+	assert.Equal(t, "ops@example.com", msg.Header.Get("To"))
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+		if p.FileName() == "daily.csv" {
+			assert.Contains(t, string(b), `"foo.bar",2017-11-17 10:09:00,1510913759`)
+		}
+		parts = append(parts, p.FileName())
+	}
+	assert.Equal(t, []string{"", "daily.csv", "daily.json"}, parts)
+
+	form := <-uploads
+	assert.Equal(t, []string{"daily"}, form.Value["name"])
+	assert.Equal(t, "daily.csv", form.File["csv"][0].Filename)
+	assert.Equal(t, "daily.json", form.File["json"][0].Filename)
+
+	// unknown format fails the whole report
+	r.Formats = []string{"csv", "unknown"}
+	assert.Error(t, r.execute(context.Background()))
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// storageSchema returns the first storage schema, that matches the metric
+func storageSchema(metric string) *config.StorageSchema {
+	for i := range config.Config.StorageSchemas {
+		if s := &config.Config.StorageSchemas[i]; s.Re != nil && s.Re.MatchString(metric) {
+			return s
+		}
+	}
+	return nil
+}
+
+// predictStep returns step, that backends are expected to return for the metric fetched since from. Like whisper
+// does, the finest archive that covers time since from till now is chosen, the coarsest one if none of them does.
+// Path expressions are matched by patterns as is. False is returned if no storage schema matches the metric
+func predictStep(metric string, from, now int64) (int64, bool) {
+	schema := storageSchema(metric)
+	if schema == nil || len(schema.Archives) == 0 {
+		return 0, false
+	}
+	for _, a := range schema.Archives {
+		if now-from <= a.Retention {
+			return a.Step, true
+		}
+	}
+	return schema.Archives[len(schema.Archives)-1].Step, true
+}
+
+// resolutionWarnings returns warnings about targets, that combine metrics with different predicted steps (e.x.
+// metrics of different schemas or the same metric shifted to the past). Functions align such series to a common
+// step, so finer ones are consolidated
+func resolutionWarnings(targets []string, exps []parser.Expr, from int64) []string {
+	if len(config.Config.StorageSchemas) == 0 {
+		return nil
+	}
+	now := timeNow().Unix()
+	var warnings []string
+	for i, exp := range exps {
+		if !exp.IsFunc() {
+			continue
+		}
+		metrics := make(map[int64]string)
+		var steps []int64
+		for _, m := range exp.Metrics() {
+			step, ok := predictStep(m.Metric, from+m.From, now)
+			if !ok {
+				continue
+			}
+			if _, ok := metrics[step]; !ok {
+				metrics[step] = m.Metric
+				steps = append(steps, step)
+			}
+		}
+		if len(steps) < 2 {
+			continue
+		}
+		sort.Slice(steps, func(i, j int) bool { return steps[i] < steps[j] })
+		parts := make([]string, 0, len(steps))
+		for _, step := range steps {
+			parts = append(parts, fmt.Sprintf("%s (%ds)", metrics[step], step))
+		}
+		warnings = append(warnings, fmt.Sprintf("target %s combines metrics with different resolutions: %s", targets[i], strings.Join(parts, ", ")))
+	}
+	return warnings
+}
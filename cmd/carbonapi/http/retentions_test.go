@@ -0,0 +1,50 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageSchemas(t *testing.T) {
+	now := int64(1510913880)
+	origSchemas, origNow := config.Config.StorageSchemas, timeNow
+	config.Config.StorageSchemas = []config.StorageSchema{
+		{Name: "fine", Re: regexp.MustCompile(`^foo\.`), Archives: []config.Archive{{Step: 60, Retention: 86400}, {Step: 300, Retention: 30 * 86400}}},
+		{Name: "coarse", Re: regexp.MustCompile(`.`), Archives: []config.Archive{{Step: 600, Retention: 365 * 86400}}},
+	}
+	timeNow = func() time.Time { return time.Unix(now, 0) }
+	defer func() { config.Config.StorageSchemas, timeNow = origSchemas, origNow }()
+
+	step, ok := predictStep("foo.bar", now-3600, now)
+	assert.True(t, ok)
+	assert.Equal(t, int64(60), step)
+	// the finest archive that covers the range is chosen
+	step, _ = predictStep("foo.bar", now-2*86400, now)
+	assert.Equal(t, int64(300), step)
+	step, _ = predictStep("foo.bar", now-400*86400, now)
+	assert.Equal(t, int64(300), step)
+
+	req, rr := setUpRequest(t, fmt.Sprintf("/render/explain?target=sumSeries(foo.bar,bar.baz)&target=foo.bar&from=%d&until=%d&maxDataPoints=30", now-3600, now))
+	explainHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp explainResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Fetches, 2) {
+		assert.Equal(t, explainFetch{Name: "foo.bar", PathExpression: "foo.bar", From: now - 3600, Until: now, Step: 60, Points: 60, ValuesPerPoint: 2}, resp.Fetches[0])
+		assert.Equal(t, int64(600), resp.Fetches[1].Step)
+	}
+	assert.Equal(t, []string{"target sumSeries(foo.bar,bar.baz) combines metrics with different resolutions: foo.bar (60s), bar.baz (600s)"}, resp.Warnings)
+
+	// the same metric shifted to the past is fetched from the coarser archive
+	req, rr = setUpRequest(t, fmt.Sprintf("/render/?format=json&target=diffSeries(foo.bar,timeShift(foo.bar,'7d'))&from=%d&until=%d", now-3600, now))
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"target diffSeries(foo.bar,timeShift(foo.bar,'7d')) combines metrics with different resolutions: foo.bar (60s), foo.bar (300s)"}, rr.Header()[warningsHeader])
+}
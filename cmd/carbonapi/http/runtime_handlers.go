@@ -0,0 +1,157 @@
+package http
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap/zapcore"
+)
+
+// adminAuth requires admin token in Authorization header. Requests are refused if token isn't configured. Token is
+// checked on every request, so it could be changed by config reload
+func adminAuth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// pprofHandler serves index of profiles and named profiles (heap, goroutine, etc.) under path
+func pprofHandler(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, path)
+		if name == "" {
+			pprof.Index(w, r)
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+// runtimeLoggers is a copy of loggers config with levels changed at runtime, loggers aren't affected by config reload.
+// gcPercent is GOGC value, it's kept when changed, as runtime doesn't allow to read it without setting
+var runtimeLoggers struct {
+	sync.Mutex
+	config    []zapwriter.Config
+	gcPercent int
+}
+
+type runtimeSettings struct {
+	GOGC       int               `json:"gogc"`
+	GOMAXPROCS int               `json:"gomaxprocs"`
+	LogLevels  map[string]string `json:"log_levels"`
+}
+
+// initialGCPercent returns GOGC value the process was started with, like runtime parses it
+func initialGCPercent() int {
+	s := os.Getenv("GOGC")
+	if s == "off" {
+		return -1
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return 100
+}
+
+// runtimeHandler reports GOGC, GOMAXPROCS and levels of loggers. POST request changes them, parameters:
+// 'gogc' (percent or 'off'), 'gomaxprocs', 'logLevel' and 'logger' (name of logger to change, all if not set).
+// Changes are kept until restart
+func runtimeHandler(w http.ResponseWriter, r *http.Request) {
+	runtimeLoggers.Lock()
+	defer runtimeLoggers.Unlock()
+	if runtimeLoggers.config == nil {
+		runtimeLoggers.config = append([]zapwriter.Config(nil), config.Config.Logger...)
+		runtimeLoggers.gcPercent = initialGCPercent()
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if msg := applyRuntimeSettings(r); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings := runtimeSettings{
+		GOGC:       runtimeLoggers.gcPercent,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		LogLevels:  make(map[string]string),
+	}
+	for _, c := range runtimeLoggers.config {
+		settings.LogLevels[c.Logger] = c.Level
+	}
+	writeJSON(w, settings)
+}
+
+// applyRuntimeSettings validates all parameters before changing anything, returns error message
+func applyRuntimeSettings(r *http.Request) string {
+	gogc := 0
+	if s := r.FormValue("gogc"); s != "" {
+		if s == "off" {
+			gogc = -1
+		} else if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			gogc = n
+		} else {
+			return "gogc should be positive integer or 'off'"
+		}
+	}
+
+	procs := 0
+	if s := r.FormValue("gomaxprocs"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return "gomaxprocs should be positive integer"
+		}
+		procs = n
+	}
+
+	var loggers []zapwriter.Config
+	if level := r.FormValue("logLevel"); level != "" {
+		var l zapcore.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return "invalid logLevel: " + err.Error()
+		}
+		name, found := r.FormValue("logger"), false
+		loggers = append([]zapwriter.Config(nil), runtimeLoggers.config...)
+		for i := range loggers {
+			if name == "" || loggers[i].Logger == name {
+				loggers[i].Level = l.String()
+				found = true
+			}
+		}
+		if !found {
+			return "unknown logger " + name
+		}
+		if err := zapwriter.ApplyConfig(loggers); err != nil {
+			return "failed to apply logger config: " + err.Error()
+		}
+		runtimeLoggers.config = loggers
+	}
+
+	if gogc != 0 {
+		debug.SetGCPercent(gogc)
+		runtimeLoggers.gcPercent = gogc
+	}
+	if procs != 0 {
+		runtime.GOMAXPROCS(procs)
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/lomik/zapwriter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth(t *testing.T) {
+	defer func(admin config.AdminConfig) { config.Config.Admin = admin }(config.Config.Admin)
+	config.Config.Admin.PProfEnabled = true
+	r := http.NewServeMux()
+	InitAdminHandlers(r)
+
+	for _, tt := range []struct {
+		token         string
+		authorization string
+		code          int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "Bearer secret", http.StatusOK},
+	} {
+		config.Config.Admin.Token = tt.token
+		for _, url := range []string{"/admin/runtime", "/admin/pprof/", "/admin/pprof/goroutine?debug=1"} {
+			req, rr := setUpRequest(t, url)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, tt.code, rr.Code, "%s with token %q and authorization %q", url, tt.token, tt.authorization)
+		}
+	}
+}
+
+func TestRuntimeHandler(t *testing.T) {
+	defer debug.SetGCPercent(debug.SetGCPercent(100))
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	defer func() {
+		zapwriter.ApplyConfig(config.Config.Logger)
+		runtimeLoggers.config = nil
+	}()
+
+	rr := serveRequest(runtimeHandler, "POST", "/admin/runtime?gogc=200&gomaxprocs=2&logLevel=warn&logger=", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var settings runtimeSettings
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &settings))
+	assert.Equal(t, 200, settings.GOGC)
+	assert.Equal(t, 2, settings.GOMAXPROCS)
+	assert.Equal(t, map[string]string{"": "warn"}, settings.LogLevels)
+
+	// GOGC is reported without resetting it
+	rr = serveRequest(runtimeHandler, "GET", "/admin/runtime", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &settings))
+	assert.Equal(t, 200, settings.GOGC)
+	assert.Equal(t, 200, debug.SetGCPercent(200))
+
+	for _, query := range []string{"gogc=0", "gomaxprocs=x", "logLevel=verbose", "logLevel=info&logger=unknown"} {
+		rr = serveRequest(runtimeHandler, "POST", "/admin/runtime?"+query, "", "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
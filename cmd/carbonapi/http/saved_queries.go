@@ -0,0 +1,319 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+// savedQuery is a named set of targets. Targets could reference variables as ${name}, they are replaced by form values
+// with the same name or by defaults. Params are defaults of render parameters (e.x. from, format)
+type savedQuery struct {
+	Name        string            `json:"name"`
+	Targets     []string          `json:"targets"`
+	Params      map[string]string `json:"params,omitempty"`
+	Variables   map[string]string `json:"variables,omitempty"`
+	Description string            `json:"description,omitempty"`
+	// Owner is a tenant that created the query, only the owner or admin could change or delete it. Queries without
+	// owner are created by admin
+	Owner   string `json:"owner,omitempty"`
+	Created int64  `json:"created"`
+	Updated int64  `json:"updated"`
+}
+
+var savedQueryName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// savedQueryStore keeps queries in memory and writes all of them to the file on each change
+type savedQueryStore struct {
+	sync.RWMutex
+	path    string
+	queries map[string]*savedQuery
+}
+
+// savedQueries is nil if saved queries are disabled
+var savedQueries *savedQueryStore
+
+func initSavedQueries(cfg config.SavedQueriesConfig) {
+	if cfg.Path == "" {
+		savedQueries = nil
+		return
+	}
+	s, err := loadSavedQueries(cfg.Path)
+	if err != nil {
+		zapwriter.Logger("savedQueries").Fatal("failed to load saved queries",
+			zap.String("path", cfg.Path),
+			zap.Error(err),
+		)
+	}
+	savedQueries = s
+}
+
+// loadSavedQueries reads queries from the file, missing file is an empty store
+func loadSavedQueries(path string) (*savedQueryStore, error) {
+	s := &savedQueryStore{path: path, queries: make(map[string]*savedQuery)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var queries []*savedQuery
+	if err := json.Unmarshal(b, &queries); err != nil {
+		return nil, err
+	}
+	for _, q := range queries {
+		s.queries[q.Name] = q
+	}
+	return s, nil
+}
+
+// list returns queries sorted by name
+func (s *savedQueryStore) list() []*savedQuery {
+	s.RLock()
+	res := make([]*savedQuery, 0, len(s.queries))
+	for _, q := range s.queries {
+		res = append(res, q)
+	}
+	s.RUnlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func (s *savedQueryStore) get(name string) (*savedQuery, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	q, ok := s.queries[name]
+	return q, ok
+}
+
+// put creates or replaces the query on behalf of the requester. Queries of other owners can't be replaced
+func (s *savedQueryStore) put(q *savedQuery, u requester) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	now := timeNow().Unix()
+	q.Owner, q.Created, q.Updated = u.owner, now, now
+	old, ok := s.queries[q.Name]
+	if ok {
+		if !u.canModify(old.Owner) {
+			return http.StatusForbidden, fmt.Errorf("query %s is owned by %s", q.Name, ownerName(old.Owner))
+		}
+		q.Owner, q.Created = old.Owner, old.Created
+	}
+	s.queries[q.Name] = q
+	if err := s.save(); err != nil {
+		if ok {
+			s.queries[q.Name] = old
+		} else {
+			delete(s.queries, q.Name)
+		}
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// delete removes the query on behalf of the requester
+func (s *savedQueryStore) delete(name string, u requester) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	q, ok := s.queries[name]
+	if !ok {
+		return http.StatusNotFound, fmt.Errorf("query %s not found", name)
+	}
+	if !u.canModify(q.Owner) {
+		return http.StatusForbidden, fmt.Errorf("query %s is owned by %s", name, ownerName(q.Owner))
+	}
+	delete(s.queries, name)
+	if err := s.save(); err != nil {
+		s.queries[name] = q
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// save writes all queries to the file. Must be called under the write lock
+func (s *savedQueryStore) save() error {
+	queries := make([]*savedQuery, 0, len(s.queries))
+	for _, q := range s.queries {
+		queries = append(queries, q)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	b, err := json.MarshalIndent(queries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b)
+}
+
+// writeFileAtomic writes data to a temporary file, that replaces the file, so it's never written partially
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// expand returns targets with variables replaced by form values or defaults
+func (q *savedQuery) expand(form map[string][]string) ([]string, error) {
+	var missing []string
+	mapping := func(name string) string {
+		if v, ok := form[name]; ok && len(v) > 0 {
+			return v[0]
+		}
+		if v, ok := q.Variables[name]; ok {
+			return v
+		}
+		missing = append(missing, name)
+		return ""
+	}
+	targets := make([]string, len(q.Targets))
+	for i, t := range q.Targets {
+		var err error
+		targets[i], err = expandVariables(t, mapping)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %v", q.Name, err)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("query %s: missing variables %s", q.Name, strings.Join(missing, ", "))
+	}
+	return targets, nil
+}
+
+// expandVariables replaces ${name} by value of the variable, $${ is a literal ${. Other $ are kept as is, as they are
+// used by regular expressions and replacements (e.x. aliasSub(foo.*, '(\w+)$', '$1'))
+func expandVariables(s string, mapping func(name string) string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			b.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "${"):
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable at %d", i)
+			}
+			name := s[i+2 : i+2+end]
+			if name == "" {
+				return "", fmt.Errorf("empty variable name at %d", i)
+			}
+			b.WriteString(mapping(name))
+			i += end + 3
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// applySavedQuery replaces targets of the parsed render request by targets of the saved query and sets its params,
+// that aren't specified by the request
+func applySavedQuery(r *http.Request, name string) (int, error) {
+	if savedQueries == nil {
+		return http.StatusBadRequest, fmt.Errorf("saved queries are disabled")
+	}
+	q, ok := savedQueries.get(name)
+	if !ok {
+		return http.StatusNotFound, fmt.Errorf("query %s not found", name)
+	}
+	targets, err := q.expand(r.Form)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	r.Form["target"] = targets
+	for k, v := range q.Params {
+		if _, ok := r.Form[k]; !ok {
+			r.Form[k] = []string{v}
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// savedQueriesHandler serves /queries: GET lists queries, POST creates or replaces a query from JSON body.
+// /queries/<name>: GET returns the query, DELETE removes it
+func savedQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	if savedQueries == nil {
+		http.Error(w, "saved queries are disabled", http.StatusNotFound)
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, config.Config.Prefix+"/queries"), "/")
+
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, savedQueries.list())
+		case http.MethodPost, http.MethodPut:
+			u, ok := requireAuth(w, r)
+			if !ok {
+				return
+			}
+			var q savedQuery
+			if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+				http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !savedQueryName.MatchString(q.Name) {
+				http.Error(w, "invalid query name, letters, digits, '_', '.' and '-' are allowed", http.StatusBadRequest)
+				return
+			}
+			if len(q.Targets) == 0 {
+				http.Error(w, "query has no targets", http.StatusBadRequest)
+				return
+			}
+			if code, err := savedQueries.put(&q, u); err != nil {
+				http.Error(w, err.Error(), code)
+				return
+			}
+			writeJSON(w, &q)
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		q, ok := savedQueries.get(name)
+		if !ok {
+			http.Error(w, "query "+name+" not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, q)
+	case http.MethodDelete:
+		u, ok := requireAuth(w, r)
+		if !ok {
+			return
+		}
+		if code, err := savedQueries.delete(name, u); err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavedQueries(t *testing.T) {
+	dir, cleanup := tempDir(t, "carbonapi-queries")
+	defer cleanup()
+	path := filepath.Join(dir, "queries.json")
+	initSavedQueries(config.SavedQueriesConfig{Path: path})
+	defer initSavedQueries(config.SavedQueriesConfig{})
+
+	defer useAdminToken()()
+
+	request := func(method, url, user, body string) *httptest.ResponseRecorder {
+		return serveRequest(savedQueriesHandler, method, url, user, body)
+	}
+
+	// changes require authentication
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/queries", "", `{"name":"fallback","targets":["foo"]}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/queries", "anonymous", `{"name":"fallback","targets":["foo"]}`).Code)
+
+	rr := request("POST", "/queries", "alice", `{"name":"fallback","targets":["fallbackSeries(${m},foo.baz)"],"params":{"format":"json"},"variables":{"m":"foo.bar"}}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = request("POST", "/queries", "alice", `{"name":"required","targets":["${m}.count"]}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/queries", "alice", `{"name":"bad name","targets":["foo"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/queries", "alice", `{"name":"empty"}`).Code)
+
+	// queries of other owners can't be changed
+	assert.Equal(t, http.StatusForbidden, request("POST", "/queries", "bob", `{"name":"fallback","targets":["foo"]}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/queries/fallback", "bob", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("DELETE", "/queries/fallback", "", "").Code)
+
+	// queries of admin have no owner, they could be changed by admin only
+	assert.Equal(t, http.StatusOK, request("POST", "/queries", "admin", `{"name":"shared","targets":["foo"]}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/queries", "bob", `{"name":"shared","targets":["foo"]}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/queries/shared", "bob", "").Code)
+	assert.Equal(t, http.StatusNoContent, request("DELETE", "/queries/shared", "admin", "").Code)
+	// admin could change queries of all owners, owner is kept
+	assert.Equal(t, http.StatusOK, request("POST", "/queries", "admin", `{"name":"required","targets":["${m}.count"]}`).Code)
+
+	rr = request("GET", "/queries/fallback", "", "")
+	var q savedQuery
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &q))
+	assert.Equal(t, "alice", q.Owner)
+	assert.Equal(t, []string{"fallbackSeries(${m},foo.baz)"}, q.Targets)
+
+	req, rr := setUpRequest(t, "/render/?queryName=fallback&from=-10minutes")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`, rr.Body.String())
+
+	req, rr = setUpRequest(t, "/render/?queryName=required&format=json")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "missing variables m")
+
+	req, rr = setUpRequest(t, "/render/?queryName=unknown")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// queries are kept in the file
+	assert.Equal(t, http.StatusNoContent, request("DELETE", "/queries/required", "alice", "").Code)
+	initSavedQueries(config.SavedQueriesConfig{Path: path})
+	var list []savedQuery
+	assert.NoError(t, json.Unmarshal(request("GET", "/queries", "", "").Body.Bytes(), &list))
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "fallback", list[0].Name)
+		assert.Equal(t, map[string]string{"m": "foo.bar"}, list[0].Variables)
+	}
+}
+
+func TestSavedQueryExpand(t *testing.T) {
+	q := &savedQuery{Name: "q", Variables: map[string]string{"host": "web1"}}
+	form := map[string][]string{"metric": {"cpu"}}
+	tests := []struct {
+		target   string
+		expected string
+		err      bool
+	}{
+		{target: "servers.${host}.${metric}", expected: "servers.web1.cpu"},
+		// $ of regular expressions and replacements is kept
+		{target: `aliasSub(servers.${host}.*, '^servers\.(\w+)\.(\w+)$', '$2 \1 $1')`, expected: `aliasSub(servers.web1.*, '^servers\.(\w+)\.(\w+)$', '$2 \1 $1')`},
+		{target: "grep(foo.*, '$host$')", expected: "grep(foo.*, '$host$')"},
+		{target: "$${host} is ${host}, $$ and $", expected: "${host} is web1, $$ and $"},
+		{target: "servers.${host", err: true},
+		{target: "servers.${}", err: true},
+		{target: "servers.${missing}", err: true},
+	}
+	for _, tt := range tests {
+		q.Targets = []string{tt.target}
+		targets, err := q.expand(form)
+		if tt.err {
+			assert.Error(t, err, tt.target)
+			continue
+		}
+		if assert.NoError(t, err, tt.target) {
+			assert.Equal(t, []string{tt.expected}, targets, tt.target)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+
+	pickle "github.com/lomik/og-rek"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+// scheduledQuery evaluates targets periodically and delivers results to webhook and/or carbon, so metrics derived by
+// carbonapi functions could be recorded
+type scheduledQuery struct {
+	// lastWritten is a timestamp of the newest point written to carbon, start time until the first write. It's the
+	// first field to be 64-bit aligned for atomic operations
+	lastWritten int64
+
+	config.ScheduledQueryConfig
+
+	tenant *config.TenantConfig
+	client *http.Client
+	logger *zap.Logger
+}
+
+func newScheduledQuery(cfg config.ScheduledQueryConfig) *scheduledQuery {
+	return &scheduledQuery{
+		ScheduledQueryConfig: cfg,
+		tenant:               config.Config.Tenants.Get(cfg.Tenant),
+		client:               &http.Client{},
+		logger:               zapwriter.Logger("scheduler").With(zap.String("query", cfg.Name)),
+		lastWritten:          timeNow().Unix(),
+	}
+}
+
+// scheduler runs jobs in background until it's stopped
+type scheduler struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// queries are scheduled queries run by the scheduler
+	queries []*scheduledQuery
+}
+
+func newScheduler() *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// every runs f each interval, each run is delayed by random time up to jitter. Context passed to f is cancelled when
+// scheduler is stopped
+func (s *scheduler) every(interval, jitter time.Duration, f func(ctx context.Context)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if jitter > 0 && !s.sleep(time.Duration(rand.Int63n(int64(jitter)))) {
+				return
+			}
+			f(s.ctx)
+			select {
+			case <-ticker.C:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// cron runs f at times of the schedule in the location. Context passed to f is cancelled when scheduler is stopped
+func (s *scheduler) cron(schedule *config.CronSchedule, loc *time.Location, f func(ctx context.Context)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		var last time.Time
+		for {
+			now := timeNow().In(loc)
+			// timer could fire a bit earlier than scheduled, so the same time isn't scheduled twice
+			if now.Before(last) {
+				now = last
+			}
+			next := schedule.Next(now)
+			if next.IsZero() || !s.sleep(next.Sub(timeNow())) {
+				return
+			}
+			f(s.ctx)
+			last = next
+		}
+	}()
+}
+
+// sleep waits for d, returns false if scheduler is stopped earlier
+func (s *scheduler) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// stop cancels jobs that are running and waits for them to finish
+func (s *scheduler) stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// jobScheduler is a running scheduler, it's replaced by initScheduler
+var jobScheduler struct {
+	sync.Mutex
+	s *scheduler
+}
+
+// setScheduler stops the running scheduler and replaces it by s, that could be nil
+func setScheduler(s *scheduler) {
+	jobScheduler.Lock()
+	old := jobScheduler.s
+	jobScheduler.s = s
+	jobScheduler.Unlock()
+	if old != nil {
+		old.stop()
+	}
+}
+
+// StopScheduler stops evaluation of scheduled queries and reports, evaluations that are running are cancelled
+func StopScheduler() {
+	setScheduler(nil)
+}
+
+// initScheduler starts evaluation of scheduled queries and reports, config is validated by config.SetUpConfig.
+// Scheduler that was started before is stopped, so jobs aren't duplicated
+func initScheduler(cfg config.SchedulerConfig, reporting config.ReportingConfig) {
+	s := newScheduler()
+	for _, c := range cfg.Queries {
+		q := newScheduledQuery(c)
+		s.queries = append(s.queries, q)
+		s.every(q.Interval, q.Jitter, q.evaluate)
+	}
+	for _, c := range reporting.Reports {
+		r := newReport(c, reporting.SMTP)
+		s.cron(r.Cron, r.tenant.GetTimeZone(), r.generate)
+	}
+	setScheduler(s)
+}
+
+// scheduledWriteLag returns the largest time in seconds passed since the newest point written to carbon by any query,
+// so both slow evaluations and failing writes are visible
+func scheduledWriteLag() int64 {
+	jobScheduler.Lock()
+	defer jobScheduler.Unlock()
+	if jobScheduler.s == nil {
+		return 0
+	}
+	now := timeNow().Unix()
+	var lag int64
+	for _, q := range jobScheduler.s.queries {
+		if q.Carbon == "" {
+			continue
+		}
+		if l := now - atomic.LoadInt64(&q.lastWritten); l > lag {
+			lag = l
+		}
+	}
+	return lag
+}
+
+func (q *scheduledQuery) evaluate(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, q.Timeout)
+	defer cancel()
+
+	ApiMetrics.ScheduledQueries.Add(1)
+	t0 := time.Now()
+	err := q.execute(ctx)
+	if err != nil {
+		ApiMetrics.ScheduledQueryErrors.Add(1)
+		q.logger.Error("scheduled query failed",
+			zap.Strings("targets", q.Targets),
+			zap.Duration("runtime", time.Since(t0)),
+			zap.Error(err),
+		)
+		return
+	}
+	q.logger.Debug("scheduled query evaluated",
+		zap.Duration("runtime", time.Since(t0)),
+	)
+}
+
+// execute evaluates targets and delivers results
+func (q *scheduledQuery) execute(ctx context.Context) error {
+	tz := q.tenant.GetTimeZone()
+	from := date.DateParamToEpoch(q.From, "", timeNow().Add(-5*time.Minute).Unix(), tz)
+	until := date.DateParamToEpoch(q.Until, "", timeNow().Unix(), tz)
+
+	results, err := evalTargets(ctx, q.tenant, q.Targets, from, until)
+	if err != nil {
+		return err
+	}
+
+	if q.Webhook != "" {
+		if err := q.postWebhook(ctx, results, from, until); err != nil {
+			return fmt.Errorf("webhook: %v", err)
+		}
+	}
+	if q.Carbon != "" {
+		if err := q.writeCarbon(ctx, results); err != nil {
+			return fmt.Errorf("carbon: %v", err)
+		}
+	}
+	return nil
+}
+
+// postWebhook sends results as JSON: {"name":...,"from":...,"until":...,"series":[<render response>]}
+func (q *scheduledQuery) postWebhook(ctx context.Context, results []*types.MetricData, from, until int64) error {
+	var b []byte
+	b = append(b, `{"name":`...)
+	b = types.AppendJSONString(b, q.Name)
+	b = append(b, `,"from":`...)
+	b = strconv.AppendInt(b, from, 10)
+	b = append(b, `,"until":`...)
+	b = strconv.AppendInt(b, until, 10)
+	b = append(b, `,"series":`...)
+	b = append(b, types.MarshalJSONWithPrecision(results, config.Config.JSONFloatPrecision)...)
+	b = append(b, '}')
+
+	req, err := http.NewRequest(http.MethodPost, q.Webhook, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	resp, err := q.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// body is drained, so connection could be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// writeCarbon writes the latest point of each series to carbon, failed writes are retried with exponential backoff
+func (q *scheduledQuery) writeCarbon(ctx context.Context, results []*types.MetricData) error {
+	points := latestPoints(q.Prefix, results)
+	if len(points) == 0 {
+		return nil
+	}
+	var b []byte
+	if q.CarbonProtocol == "pickle" {
+		b = marshalCarbonPickle(points)
+	} else {
+		b = marshalCarbonPlaintext(points)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = q.sendCarbon(ctx, b)
+		if err == nil || attempt >= q.Retries {
+			break
+		}
+		ApiMetrics.ScheduledWriteRetries.Add(1)
+		q.logger.Warn("failed to write to carbon, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Error(err),
+		)
+		select {
+		case <-time.After(carbonRetryDelay(attempt)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	ApiMetrics.ScheduledPointsWritten.Add(int64(len(points)))
+	newest := points[0].timestamp
+	for _, p := range points {
+		if p.timestamp > newest {
+			newest = p.timestamp
+		}
+	}
+	atomic.StoreInt64(&q.lastWritten, newest)
+	return nil
+}
+
+// carbonRetryDelay returns delay before retry of attempt: 100ms, 200ms, 400ms, etc. up to 5s
+func carbonRetryDelay(attempt int) time.Duration {
+	if attempt > 5 {
+		return 5 * time.Second
+	}
+	return 100 * time.Millisecond << uint(attempt)
+}
+
+func (q *scheduledQuery) sendCarbon(ctx context.Context, b []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", q.Carbon)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	_, err = conn.Write(b)
+	return err
+}
+
+type carbonPoint struct {
+	name      string
+	value     float64
+	timestamp int64
+}
+
+// latestPoints returns the latest non-absent point of each series. Spaces aren't allowed in names, so they are
+// replaced by underscores
+func latestPoints(prefix string, results []*types.MetricData) []carbonPoint {
+	var points []carbonPoint
+	for _, r := range results {
+		i := len(r.Values) - 1
+		for i >= 0 && math.IsNaN(r.Values[i]) {
+			i--
+		}
+		if i < 0 {
+			continue
+		}
+		points = append(points, carbonPoint{
+			name:      prefix + strings.Replace(r.Name, " ", "_", -1),
+			value:     r.Values[i],
+			timestamp: r.StartTime + int64(i)*r.StepTime,
+		})
+	}
+	return points
+}
+
+// marshalCarbonPlaintext formats points in carbon plaintext protocol: "<name> <value> <timestamp>\n"
+func marshalCarbonPlaintext(points []carbonPoint) []byte {
+	var b []byte
+	for _, p := range points {
+		b = append(b, p.name...)
+		b = append(b, ' ')
+		b = strconv.AppendFloat(b, p.value, 'f', -1, 64)
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, p.timestamp, 10)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// marshalCarbonPickle formats points in carbon pickle protocol: 4 bytes of length followed by pickled list of
+// (name, (timestamp, value)) tuples
+func marshalCarbonPickle(points []carbonPoint) []byte {
+	list := make([]interface{}, 0, len(points))
+	for _, p := range points {
+		list = append(list, pickle.Tuple{p.name, pickle.Tuple{p.timestamp, p.value}})
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 0, 0, 0})
+	pickle.NewEncoder(&buf).Encode(list)
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	return b
+}
+
+// evalTargets fetches and evaluates targets of tenant like render request does, but without caching, memory
+// accounting and access logging. t could be nil
+func evalTargets(ctx context.Context, t *config.TenantConfig, targets []string, from, until int64) ([]*types.MetricData, error) {
+	var results []*types.MetricData
+	index := getTagIndex(t)
+	metricsIndex := getMetricIndex(t)
+	metricMap := make(map[parser.MetricRequest][]*types.MetricData)
+
+	fetch := func(batch []string, exps []parser.Expr) error {
+		fetches := newFetchBatch(exps, from, until)
+		for _, exp := range exps {
+			if err := fetches.add(exp, index, metricsIndex, metricMap); err != nil {
+				return err
+			}
+		}
+		if fetches.limitErr != nil {
+			return fetches.limitErr
+		}
+
+		var fetched []*types.MetricData
+		if !fetches.empty() {
+			r, _, err := fetches.fetch(ctx, t)
+			if err != nil && len(r) == 0 && err != zipperTypes.ErrNotFound && err != zipperTypes.ErrNoMetricsFetched {
+				return err
+			}
+			fetched = r
+		}
+		fetches.store(fetched, metricMap)
+		return fetches.limitErr
+	}
+
+	eval := func(target string, exp parser.Expr, rewritten bool) error {
+		if rewritten {
+			return nil
+		}
+		expressions, err := evalTarget(exp, from, until, metricMap)
+		if err != nil && err != parser.ErrSeriesDoesNotExist {
+			return err
+		}
+		results = append(results, expressions...)
+		return nil
+	}
+
+	err := expr.EvalBatches(targets, from, until, metricMap, fetch, eval)
+	if e, ok := err.(*expr.ParseError); ok {
+		return nil, fmt.Errorf("%s", buildParseErrorString(e.Target, e.Rest, e.Err))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
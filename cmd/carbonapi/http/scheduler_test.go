@@ -0,0 +1,169 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	pickle "github.com/lomik/og-rek"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduledQuery(t *testing.T) {
+	bodies := make(chan string, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+	}))
+	defer webhook.Close()
+
+	carbon, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer carbon.Close()
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := carbon.Accept()
+		if err != nil {
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		conn.Close()
+		lines <- string(b)
+	}()
+
+	q := newScheduledQuery(config.ScheduledQueryConfig{
+		Name:    "test",
+		Targets: []string{"foo.bar"},
+		From:    "1510913280",
+		Until:   "1510913880",
+		Webhook: webhook.URL,
+		Carbon:  carbon.Addr().String(),
+		Prefix:  "recorded.",
+	})
+	err = q.execute(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"name":"test","from":1510913280,"until":1510913880,"series":`+
+		`[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]}`, <-bodies)
+	assert.Equal(t, "recorded.foo.bar 1510913818 1510913400\n", <-lines)
+
+	q.Targets = []string{"foo.bar("}
+	assert.Error(t, q.execute(context.Background()), "invalid target should fail")
+}
+
+func TestSchedulerStop(t *testing.T) {
+	var runs int32
+	started := make(chan struct{}, 1)
+	s := newScheduler()
+	s.every(time.Millisecond, 0, func(ctx context.Context) {
+		atomic.AddInt32(&runs, 1)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+	})
+	setScheduler(s)
+	<-started
+
+	// replaced scheduler is stopped, its running job is cancelled
+	setScheduler(newScheduler())
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&runs), "stopped scheduler should not run jobs")
+	assert.Equal(t, int32(1), n)
+
+	StopScheduler()
+	assert.Nil(t, jobScheduler.s)
+}
+
+func TestSchedulerCron(t *testing.T) {
+	// clock is 20ms before the next minute, so the job runs soon and the next run is a minute later
+	now := time.Now()
+	offset := now.Truncate(time.Minute).Add(time.Minute - 20*time.Millisecond).Sub(now)
+	origNow := timeNow
+	timeNow = func() time.Time { return time.Now().Add(offset) }
+	defer func() { timeNow = origNow }()
+
+	schedule, err := config.ParseCronSchedule("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runs int32
+	done := make(chan struct{}, 1)
+	s := newScheduler()
+	s.cron(schedule, time.UTC, func(ctx context.Context) {
+		atomic.AddInt32(&runs, 1)
+		done <- struct{}{}
+	})
+	setScheduler(s)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cron job isn't run")
+	}
+
+	// waiting for the next run is cancelled by stop
+	t0 := time.Now()
+	StopScheduler()
+	assert.True(t, time.Since(t0) < time.Second, "stop should cancel waiting for the next run")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+}
+
+func TestScheduledQueryPickle(t *testing.T) {
+	carbon, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := carbon.Accept()
+		if err != nil {
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		conn.Close()
+		received <- b
+	}()
+
+	q := newScheduledQuery(config.ScheduledQueryConfig{
+		Name:           "test",
+		Targets:        []string{"foo.bar"},
+		From:           "1510913280",
+		Until:          "1510913880",
+		Carbon:         carbon.Addr().String(),
+		CarbonProtocol: "pickle",
+		Retries:        2,
+	})
+	s := newScheduler()
+	s.queries = []*scheduledQuery{q}
+	setScheduler(s)
+	defer StopScheduler()
+
+	assert.NoError(t, q.execute(context.Background()))
+	b := <-received
+	if assert.True(t, len(b) > 4) {
+		assert.Equal(t, uint32(len(b)-4), binary.BigEndian.Uint32(b))
+		v, err := pickle.NewDecoder(bytes.NewReader(b[4:])).Decode()
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{pickle.Tuple{"foo.bar", pickle.Tuple{int64(1510913400), float64(1510913818)}}}, v)
+	}
+	assert.Equal(t, int64(1510913400), atomic.LoadInt64(&q.lastWritten))
+	assert.True(t, scheduledWriteLag() >= timeNow().Unix()-1510913400, "lag should be measured from the newest written point")
+
+	// nothing listens there anymore, so all attempts fail
+	carbon.Close()
+	retries := ApiMetrics.ScheduledWriteRetries.Value()
+	assert.Error(t, q.execute(context.Background()))
+	assert.Equal(t, retries+2, ApiMetrics.ScheduledWriteRetries.Value())
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"fmt"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+// seriesLimitError is returned if path expression matched more series than allowed and the request is rejected
+type seriesLimitError struct {
+	pathExpression string
+	series         int
+	limit          int
+}
+
+func (e seriesLimitError) Error() string {
+	return fmt.Sprintf("'%s' matched %d series, limit is %d, narrow down the path expression", e.pathExpression, e.series, e.limit)
+}
+
+// seriesLimitRule names override of the limit in metrics
+func seriesLimitRule(prefix string) string {
+	if prefix == "" {
+		return "default"
+	}
+	return prefix
+}
+
+// limitSeries checks amount of series that path expression matched. Allowed amount is returned: all series if limit
+// isn't exceeded or if the request is rejected, so error should be checked first
+func (b *fetchBatch) limitSeries(pathExpression string, series int) int {
+	cfg := config.Config.SeriesLimits
+	limit, prefix := cfg.Limit(pathExpression)
+	if limit <= 0 || series <= limit {
+		return series
+	}
+
+	ApiMetrics.SeriesLimitExceeded.Add(1)
+	ApiMetrics.SeriesLimitOffenders.Add(seriesLimitRule(prefix), 1)
+	zapwriter.Logger("seriesLimits").Warn("path expression matched too many series",
+		zap.String("path_expression", pathExpression),
+		zap.Int("series", series),
+		zap.Int("limit", limit),
+		zap.String("rule", seriesLimitRule(prefix)),
+		zap.String("action", cfg.Action),
+	)
+
+	if cfg.Action == config.SeriesLimitReject {
+		if b.limitErr == nil {
+			b.limitErr = seriesLimitError{pathExpression: pathExpression, series: series, limit: limit}
+		}
+		return series
+	}
+	b.warnings = append(b.warnings, fmt.Sprintf("'%s' matched %d series, only first %d are returned", pathExpression, series, limit))
+	return limit
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// manySeriesMockZipper returns the same amount of series for every requested metric
+type manySeriesMockZipper struct {
+	mockCarbonZipper
+	series int
+}
+
+func (z *manySeriesMockZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	var res []*types.MetricData
+	for _, m := range request.Metrics {
+		for i := 0; i < z.series; i++ {
+			r := types.MakeMetricData(fmt.Sprintf("%s.s%d", strings.TrimSuffix(m.Name, ".*"), i), []float64{1, 2, 3}, 60, m.StartTime)
+			r.PathExpression = m.PathExpression
+			res = append(res, r)
+		}
+	}
+	return res, nil, nil
+}
+
+func TestSeriesLimits(t *testing.T) {
+	defer useZipper(&manySeriesMockZipper{series: 5})()
+	origLimits := config.Config.SeriesLimits
+	defer func() { config.Config.SeriesLimits = origLimits }()
+	config.Config.SeriesLimits = config.SeriesLimitsConfig{
+		MaxSeries: 3,
+		Action:    config.SeriesLimitTruncate,
+		Overrides: []config.SeriesLimitOverride{{Prefix: "big.", MaxSeries: 10}, {Prefix: "big.small.", MaxSeries: 1}},
+	}
+
+	render := func(target string) ([]struct{ Target string }, *httptest.ResponseRecorder) {
+		req, rr := setUpRequest(t, "/render/?format=json&noCache=1&target="+url.QueryEscape(target))
+		renderHandler(rr, req)
+		var series []struct{ Target string }
+		if rr.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &series))
+		}
+		return series, rr
+	}
+
+	exceeded := ApiMetrics.SeriesLimitExceeded.Value()
+	series, rr := render("foo.*")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, series, 3)
+	assert.Equal(t, []string{"'foo.*' matched 5 series, only first 3 are returned"}, rr.Header()[warningsHeader])
+	assert.Equal(t, exceeded+1, ApiMetrics.SeriesLimitExceeded.Value())
+	assert.Equal(t, "1", ApiMetrics.SeriesLimitOffenders.Get("default").String())
+
+	series, rr = render("big.*")
+	assert.Len(t, series, 5, "override should raise the limit")
+	assert.Empty(t, rr.Header()[warningsHeader])
+
+	series, _ = render("big.small.*")
+	assert.Len(t, series, 1, "the longest prefix should win")
+
+	config.Config.SeriesLimits.Action = config.SeriesLimitReject
+	_, rr = render("foo.*")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), "'foo.*' matched 5 series, limit is 3")
+
+	// series found by metric index are limited before fetch
+	z := &listMockZipper{findWalkMockZipper: findWalkMockZipper{series: []string{"cpu.a", "cpu.b", "cpu.c", "cpu.d"}}}
+	idx := newMetricIndex(z, config.MetricIndexConfig{ExpandGlobs: true})
+	assert.NoError(t, idx.fullRefresh(context.Background()))
+	config.Config.ZipperInstance = z
+	metricIndexes[""] = idx
+	defer delete(metricIndexes, "")
+
+	_, rr = render("cpu.*")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Empty(t, z.request.Metrics, "rejected request shouldn't be fetched")
+
+	config.Config.SeriesLimits.Action = config.SeriesLimitTruncate
+	series, _ = render("cpu.*")
+	assert.Len(t, series, 3)
+	assert.Len(t, z.request.Metrics, 3)
+}
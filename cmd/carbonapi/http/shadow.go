@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// shadowTraffic mirrors part of render and find requests to a shadow backend group in background. Only requests
+// to all backends are mirrored, requests that select a group (e.x. by /render/diff) are not
+type shadowTraffic struct {
+	group   string
+	percent float64
+	timeout time.Duration
+	// slots limits mirrored requests in progress, nil - unlimited
+	slots chan struct{}
+}
+
+var shadow *shadowTraffic
+
+// shadowSampledKey marks requests that are mirrored
+type shadowSampledKey struct{}
+
+// initShadowTraffic enables mirroring, group must be one of backends
+func initShadowTraffic(cfg config.ShadowTrafficConfig, backends []zipperTypes.BackendV2) error {
+	if cfg.Group == "" || cfg.Percent <= 0 {
+		shadow = nil
+		return nil
+	}
+	found := false
+	for _, b := range backends {
+		found = found || b.GroupName == cfg.Group
+	}
+	if !found {
+		shadow = nil
+		return fmt.Errorf("backend group '%s' is not configured in upstreams", cfg.Group)
+	}
+	s := &shadowTraffic{
+		group:   cfg.Group,
+		percent: cfg.Percent,
+		timeout: cfg.Timeout,
+	}
+	if cfg.MaxConcurrent > 0 {
+		s.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	shadow = s
+	return nil
+}
+
+// sample decides if the request is mirrored. It's done once per request, so either all fetches of the request are
+// mirrored or none of them
+func (s *shadowTraffic) sample(ctx context.Context) context.Context {
+	return context.WithValue(ctx, shadowSampledKey{}, rand.Float64()*100 < s.percent)
+}
+
+// mirror runs request in background with context of the shadow group, if the request is sampled and there is a free
+// slot. Request isn't canceled when the original one ends, it's limited by the timeout only
+func (s *shadowTraffic) mirror(ctx context.Context, request string, do func(ctx context.Context) error) {
+	if sampled, _ := ctx.Value(shadowSampledKey{}).(bool); !sampled || utilctx.GetBackendGroup(ctx) != "" {
+		return
+	}
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			ApiMetrics.ShadowDropped.Add(1)
+			return
+		}
+	}
+
+	shadowCtx := utilctx.SetUUID(context.Background(), utilctx.GetUUID(ctx))
+	shadowCtx = utilctx.SetPassHeaders(shadowCtx, utilctx.GetPassHeaders(ctx))
+	shadowCtx = utilctx.SetBackendGroup(shadowCtx, s.group)
+	shadowCtx = setTenant(shadowCtx, getTenant(ctx))
+	ApiMetrics.ShadowRequests.Add(1)
+	go func() {
+		if s.slots != nil {
+			defer func() { <-s.slots }()
+		}
+		ctx, cancel := context.WithTimeout(shadowCtx, s.timeout)
+		defer cancel()
+
+		t0 := time.Now()
+		err := do(ctx)
+		ApiMetrics.ShadowRuntimeNS.Add(time.Since(t0).Nanoseconds())
+		if err != nil {
+			ApiMetrics.ShadowErrors.Add(1)
+			zapwriter.Logger("shadow").Debug("mirrored request failed",
+				zap.String("request", request),
+				zap.String("group", s.group),
+				zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)),
+				zap.Error(err),
+			)
+		}
+	}()
+}
+
+// mirrorRender mirrors fetch request of the tenant
+func (s *shadowTraffic) mirrorRender(ctx context.Context, tenant *config.TenantConfig, req pb.MultiFetchRequest) {
+	s.mirror(ctx, "render", func(ctx context.Context) error {
+		_, _, err := tenant.GetZipper().Render(ctx, req)
+		if err == zipperTypes.ErrNotFound || err == zipperTypes.ErrNoMetricsFetched {
+			return nil
+		}
+		return err
+	})
+}
+
+// mirrorFind mirrors find request of the tenant
+func (s *shadowTraffic) mirrorFind(ctx context.Context, tenant *config.TenantConfig, query []string) {
+	s.mirror(ctx, "find", func(ctx context.Context) error {
+		_, _, err := tenant.GetZipper().Find(ctx, query)
+		return err
+	})
+}
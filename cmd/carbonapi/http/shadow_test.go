@@ -0,0 +1,115 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// shadowMockZipper records backend groups of requests, mirrored ones are sent from background goroutines
+type shadowMockZipper struct {
+	mockCarbonZipper
+	mu     sync.Mutex
+	groups []string
+}
+
+func (z *shadowMockZipper) record(ctx context.Context, request string) {
+	z.mu.Lock()
+	z.groups = append(z.groups, request+":"+utilctx.GetBackendGroup(ctx))
+	z.mu.Unlock()
+}
+
+func (z *shadowMockZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	z.record(ctx, "render")
+	return z.mockCarbonZipper.Render(ctx, request)
+}
+
+func (z *shadowMockZipper) Find(ctx context.Context, metrics []string) (*pb.MultiGlobResponse, *zipperTypes.Stats, error) {
+	z.record(ctx, "find")
+	return z.mockCarbonZipper.Find(ctx, metrics)
+}
+
+func (z *shadowMockZipper) waitGroups(n int) []string {
+	for i := 0; i < 100; i++ {
+		z.mu.Lock()
+		if len(z.groups) >= n {
+			groups := append([]string(nil), z.groups...)
+			z.mu.Unlock()
+			sort.Strings(groups)
+			return groups
+		}
+		z.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestShadowTraffic(t *testing.T) {
+	backends := []zipperTypes.BackendV2{{GroupName: "prod"}, {GroupName: "shadow", Shadow: true}}
+	err := initShadowTraffic(config.ShadowTrafficConfig{Group: "shadow", Percent: 100, MaxConcurrent: 10, Timeout: time.Second}, backends)
+	assert.NoError(t, err)
+	defer initShadowTraffic(config.ShadowTrafficConfig{}, nil)
+	z := &shadowMockZipper{}
+	defer useZipper(z)()
+	requests := ApiMetrics.ShadowRequests.Value()
+
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&format=json&noCache=1&from=1510913280&until=1510913880")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	req, rr = setUpRequest(t, "/metrics/find/?query=foo.*&format=json")
+	findHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"find:", "find:shadow", "render:", "render:shadow"}, z.waitGroups(4))
+
+	// requests that select a group are not mirrored
+	z.mu.Lock()
+	z.groups = nil
+	z.mu.Unlock()
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&format=json&noCache=1&from=1510913280&until=1510913880")
+	renderHandler(rr, req.WithContext(utilctx.SetBackendGroup(req.Context(), "prod")))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"render:prod"}, z.waitGroups(1))
+	assert.Equal(t, requests+2, ApiMetrics.ShadowRequests.Value())
+}
+
+func TestShadowTrafficUnknownGroup(t *testing.T) {
+	err := initShadowTraffic(config.ShadowTrafficConfig{Group: "shadow", Percent: 100}, []zipperTypes.BackendV2{{GroupName: "prod"}})
+	assert.Error(t, err)
+	assert.Nil(t, shadow)
+}
+
+func TestShadowTrafficSampledPerRequest(t *testing.T) {
+	s := &shadowTraffic{group: "shadow", percent: 50, timeout: time.Second}
+	seen := make(map[bool]bool)
+	for i := 0; i < 50; i++ {
+		ctx := s.sample(context.Background())
+		sampled := ctx.Value(shadowSampledKey{}).(bool)
+		seen[sampled] = true
+
+		// every fetch of the request is mirrored or none of them
+		done := make(chan struct{}, 2)
+		for j := 0; j < 2; j++ {
+			s.mirror(ctx, "render", func(ctx context.Context) error {
+				done <- struct{}{}
+				return nil
+			})
+		}
+		if sampled {
+			<-done
+			<-done
+		} else {
+			assert.Len(t, done, 0)
+		}
+	}
+	assert.Equal(t, map[bool]bool{true: true, false: true}, seen)
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+// targetTiming contains time spent on single target of render request
+type targetTiming struct {
+	Target         string  `json:"target"`
+	Function       string  `json:"function,omitempty"`
+	ZipperRequests int64   `json:"zipper_requests,omitempty"`
+	ZipperRuntime  float64 `json:"zipper_runtime"`
+	EvalRuntime    float64 `json:"eval_runtime"`
+}
+
+// for testing
+var slowLogSample = rand.Float64
+
+func isSlowQuery(accessLogDetails *carbonapipb.AccessLogDetails, runtime time.Duration) bool {
+	cfg := config.Current().SlowLog
+	slow := (cfg.Threshold > 0 && runtime >= cfg.Threshold) ||
+		(cfg.DatapointsThreshold > 0 && accessLogDetails.DatapointsCount >= cfg.DatapointsThreshold)
+	if !slow {
+		return false
+	}
+	return cfg.SampleRate <= 0 || cfg.SampleRate >= 1 || slowLogSample() < cfg.SampleRate
+}
+
+// logSlowQuery writes request to 'slow' logger if it exceeds configured thresholds
+func logSlowQuery(accessLogDetails *carbonapipb.AccessLogDetails, timings []targetTiming, runtime time.Duration) {
+	if !isSlowQuery(accessLogDetails, runtime) {
+		return
+	}
+
+	zapwriter.Logger("slow").Warn("slow query",
+		zap.String("carbonapi_uuid", accessLogDetails.CarbonapiUUID),
+		zap.String("username", accessLogDetails.Username),
+		zap.String("url", accessLogDetails.URL),
+		zap.String("referer", accessLogDetails.Referer),
+		zap.Duration("runtime", runtime),
+		zap.Strings("targets", accessLogDetails.Targets),
+		zap.Int64("from", accessLogDetails.From),
+		zap.Int64("until", accessLogDetails.Until),
+		zap.Any("target_timings", timings),
+		zap.Int64("zipper_requests", accessLogDetails.ZipperRequests),
+		zap.Int64("total_metrics_count", accessLogDetails.TotalMetricsCount),
+		zap.Float64("zipper_runtime", accessLogDetails.ZipperRuntime),
+		zap.Float64("eval_runtime", accessLogDetails.EvalRuntime),
+		zap.Float64("marshal_runtime", accessLogDetails.MarshalRuntime),
+		zap.Int64("series_count", accessLogDetails.SeriesCount),
+		zap.Int64("datapoints_count", accessLogDetails.DatapointsCount),
+		zap.Bool("from_cache", accessLogDetails.FromCache),
+		zap.Int32("http_code", accessLogDetails.HTTPCode),
+	)
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSlowQuery(t *testing.T) {
+	defer func() {
+		config.Config.SlowLog = config.SlowLogConfig{}
+		slowLogSample = rand.Float64
+	}()
+	slowLogSample = func() float64 { return 0.5 }
+
+	tests := []struct {
+		name       string
+		cfg        config.SlowLogConfig
+		runtime    time.Duration
+		datapoints int64
+		expected   bool
+	}{
+		{"disabled", config.SlowLogConfig{}, time.Hour, 1000000, false},
+		{"fast", config.SlowLogConfig{Threshold: time.Second}, 100 * time.Millisecond, 0, false},
+		{"slow", config.SlowLogConfig{Threshold: time.Second}, 2 * time.Second, 0, true},
+		{"many datapoints", config.SlowLogConfig{Threshold: time.Second, DatapointsThreshold: 1000}, time.Millisecond, 1000, true},
+		{"sampled in", config.SlowLogConfig{Threshold: time.Second, SampleRate: 0.6}, 2 * time.Second, 0, true},
+		{"sampled out", config.SlowLogConfig{Threshold: time.Second, SampleRate: 0.4}, 2 * time.Second, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.SlowLog = tt.cfg
+			details := &carbonapipb.AccessLogDetails{DatapointsCount: tt.datapoints}
+			assert.Equal(t, tt.expected, isSlowQuery(details, tt.runtime))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	zipperHelper "github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+type statusResponse struct {
+	CircuitBreakers []zipperHelper.CircuitBreakerStatus `json:"circuit_breakers"`
+}
+
+// statusHandler reports state of backends: circuit breakers of servers that got requests
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	t0 := time.Now()
+	accessLogger := zapwriter.Logger("access")
+
+	writeJSON(w, statusResponse{
+		CircuitBreakers: zipperHelper.GetCircuitBreakers(),
+	})
+
+	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
+	var accessLogDetails = carbonapipb.AccessLogDetails{
+		Handler:  "status",
+		URL:      r.URL.RequestURI(),
+		PeerIP:   srcIP,
+		PeerPort: srcPort,
+		Host:     r.Host,
+		Referer:  r.Referer(),
+		Runtime:  time.Since(t0).Seconds(),
+		HTTPCode: http.StatusOK,
+		URI:      r.RequestURI,
+	}
+	accessLogger.Info("request served", zap.Any("data", accessLogDetails))
+}
@@ -0,0 +1,448 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/interfaces"
+	"github.com/go-graphite/carbonapi/expr/tags"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+// tagIndex keeps all tags and their values in memory, so autocomplete requests without expressions can be answered
+// without fan-out to backends. Index is filled by full refresh and then kept up to date by delta refreshes, which
+// fetch values only for tags that were not seen before.
+//
+// For backends without tag support index could be filled by walking the metric tree with find requests. In that case
+// series are kept as well and seriesByTag is evaluated by carbonapi, see SeriesByTag.
+type tagIndex struct {
+	sync.RWMutex
+	zipper interfaces.CarbonZipper
+	// tag name -> sorted values
+	values map[string][]string
+	// sorted tag names
+	names []string
+	ready bool
+
+	findWalk  bool
+	maxSeries int
+	// series are known only if index is filled by find walk
+	series []indexedSeries
+}
+
+// indexedSeries is a series that was found by find walk
+type indexedSeries struct {
+	name string
+	tags map[string]string
+}
+
+// tagIndexes contains index for each tenant that has its own backends, "" is for global backends
+var tagIndexes = make(map[string]*tagIndex)
+
+func newTagIndex(zipper interfaces.CarbonZipper) *tagIndex {
+	return &tagIndex{
+		zipper: zipper,
+		values: make(map[string][]string),
+	}
+}
+
+// getTagIndex returns index that should be used for tenant's requests or nil if index is disabled. t could be nil
+func getTagIndex(t *config.TenantConfig) *tagIndex {
+	if t != nil && t.ZipperInstance != nil {
+		return tagIndexes[t.Name]
+	}
+	return tagIndexes[""]
+}
+
+// initTagIndexes creates and starts indexes for global backends and tenants with their own backends
+func initTagIndexes(cfg config.TagIndexConfig) {
+	if !cfg.Enabled {
+		return
+	}
+
+	tagIndexes[""] = newTagIndex(config.Config.ZipperInstance)
+	for name, t := range config.Config.Tenants.Tenants {
+		if t.ZipperInstance != nil {
+			tagIndexes[name] = newTagIndex(t.ZipperInstance)
+		}
+	}
+
+	for name, idx := range tagIndexes {
+		idx.findWalk = cfg.FindWalk
+		idx.maxSeries = cfg.MaxSeries
+		go idx.run(name, cfg)
+	}
+}
+
+func (t *tagIndex) run(tenant string, cfg config.TagIndexConfig) {
+	logger := zapwriter.Logger("tagIndex").With(zap.String("tenant", tenant))
+
+	refresh := func(full bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+
+		t0 := time.Now()
+		var err error
+		if full {
+			err = t.fullRefresh(ctx)
+		} else {
+			err = t.deltaRefresh(ctx)
+		}
+		if err != nil {
+			logger.Error("failed to refresh tag index",
+				zap.Bool("full", full),
+				zap.Error(err),
+			)
+			return
+		}
+		logger.Debug("tag index refreshed",
+			zap.Bool("full", full),
+			zap.Duration("runtime", time.Since(t0)),
+		)
+	}
+
+	refresh(true)
+	fullTicker := time.NewTicker(cfg.FullRefreshInterval)
+	deltaTicker := time.NewTicker(cfg.DeltaRefreshInterval)
+	for {
+		select {
+		case <-fullTicker.C:
+			refresh(true)
+		case <-deltaTicker.C:
+			refresh(false)
+		}
+	}
+}
+
+func (t *tagIndex) fetchNames(ctx context.Context) ([]string, error) {
+	names, err := t.zipper.TagNames(ctx, "", -1)
+	if err != nil && err != types.ErrNoMetricsFetched {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (t *tagIndex) fetchValues(ctx context.Context, names []string) (map[string][]string, error) {
+	res := make(map[string][]string, len(names))
+	for _, name := range names {
+		values, err := t.zipper.TagValues(ctx, url.Values{"tag": []string{name}}.Encode(), -1)
+		if err != nil && err != types.ErrNoMetricsFetched {
+			return nil, err
+		}
+		sort.Strings(values)
+		res[name] = values
+	}
+	return res, nil
+}
+
+// fullRefresh fetches all tags and their values and replaces content of the index
+func (t *tagIndex) fullRefresh(ctx context.Context) error {
+	if t.findWalk {
+		return t.walkRefresh(ctx)
+	}
+
+	names, err := t.fetchNames(ctx)
+	if err != nil {
+		return err
+	}
+	values, err := t.fetchValues(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	t.Lock()
+	t.names = names
+	t.values = values
+	t.ready = true
+	t.Unlock()
+	return nil
+}
+
+// deltaRefresh fetches tag names, values are fetched for new tags only. Tags that disappeared are removed
+func (t *tagIndex) deltaRefresh(ctx context.Context) error {
+	t.RLock()
+	ready := t.ready
+	t.RUnlock()
+	if !ready {
+		return t.fullRefresh(ctx)
+	}
+	if t.findWalk {
+		// there is no cheaper way to find new series than the full walk, so index is updated by full refreshes only
+		return nil
+	}
+
+	names, err := t.fetchNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.RLock()
+	var newNames []string
+	for _, name := range names {
+		if _, ok := t.values[name]; !ok {
+			newNames = append(newNames, name)
+		}
+	}
+	t.RUnlock()
+
+	newValues, err := t.fetchValues(ctx, newNames)
+	if err != nil {
+		return err
+	}
+
+	t.Lock()
+	values := make(map[string][]string, len(names))
+	for _, name := range names {
+		if v, ok := newValues[name]; ok {
+			values[name] = v
+		} else {
+			values[name] = t.values[name]
+		}
+	}
+	t.names = names
+	t.values = values
+	t.Unlock()
+	return nil
+}
+
+// findWalkBatchSize is the amount of patterns that are sent in a single find request during find walk
+const findWalkBatchSize = 100
+
+// walkRefresh finds all series level by level, starting from "*", and replaces content of the index with them and
+// their tags. Series without tags have only 'name' tag, like in graphite
+func (t *tagIndex) walkRefresh(ctx context.Context) error {
+	var series []indexedSeries
+	seen := make(map[string]bool)
+	values := make(map[string]map[string]bool)
+
+	patterns := []string{"*"}
+	for len(patterns) > 0 {
+		var next []string
+		for len(patterns) > 0 {
+			n := findWalkBatchSize
+			if n > len(patterns) {
+				n = len(patterns)
+			}
+			res, _, err := t.zipper.Find(ctx, patterns[:n])
+			patterns = patterns[n:]
+			if err != nil && err != types.ErrNonFatalErrors && err != types.ErrNoMetricsFetched {
+				return err
+			}
+			if res == nil {
+				continue
+			}
+
+			for _, m := range res.Metrics {
+				for _, match := range m.Matches {
+					if seen[match.Path] {
+						continue
+					}
+					seen[match.Path] = true
+					if !match.IsLeaf {
+						next = append(next, match.Path+".*")
+						continue
+					}
+					if t.maxSeries > 0 && len(series) >= t.maxSeries {
+						return fmt.Errorf("find walk found more than %d series", t.maxSeries)
+					}
+
+					s := indexedSeries{name: match.Path, tags: tags.ExtractTags(match.Path)}
+					series = append(series, s)
+					for k, v := range s.tags {
+						if values[k] == nil {
+							values[k] = make(map[string]bool)
+						}
+						values[k][v] = true
+					}
+				}
+			}
+		}
+		patterns = next
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].name < series[j].name
+	})
+	names := make([]string, 0, len(values))
+	sortedValues := make(map[string][]string, len(values))
+	for k, vs := range values {
+		names = append(names, k)
+		sorted := make([]string, 0, len(vs))
+		for v := range vs {
+			sorted = append(sorted, v)
+		}
+		sort.Strings(sorted)
+		sortedValues[k] = sorted
+	}
+	sort.Strings(names)
+
+	t.Lock()
+	t.series = series
+	t.names = names
+	t.values = sortedValues
+	t.ready = true
+	t.Unlock()
+	return nil
+}
+
+// filterPrefix returns sorted values that start with prefix, up to limit (negative means no limit)
+func filterPrefix(sorted []string, prefix string, limit int64) []string {
+	i := sort.SearchStrings(sorted, prefix)
+	res := make([]string, 0)
+	for ; i < len(sorted) && strings.HasPrefix(sorted[i], prefix); i++ {
+		if limit >= 0 && int64(len(res)) >= limit {
+			break
+		}
+		res = append(res, sorted[i])
+	}
+	return res
+}
+
+// tagIndexParams are query parameters that index can handle, other ones (e.x. expr) require backends
+var tagIndexParams = map[string]bool{"tagPrefix": true, "valuePrefix": true, "tag": true, "limit": true}
+
+// TagNames returns tags that start with prefix. Returns false if index can't answer the query
+func (t *tagIndex) TagNames(q url.Values, limit int64) ([]string, bool) {
+	if !t.canAnswer(q) {
+		return nil, false
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+	if !t.ready {
+		return nil, false
+	}
+	return filterPrefix(t.names, q.Get("tagPrefix"), limit), true
+}
+
+// TagValues returns values of the tag that start with prefix. Returns false if index can't answer the query
+func (t *tagIndex) TagValues(q url.Values, limit int64) ([]string, bool) {
+	if !t.canAnswer(q) || q.Get("tag") == "" {
+		return nil, false
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+	if !t.ready {
+		return nil, false
+	}
+	return filterPrefix(t.values[q.Get("tag")], q.Get("valuePrefix"), limit), true
+}
+
+func (t *tagIndex) canAnswer(q url.Values) bool {
+	if t == nil {
+		return false
+	}
+	for k := range q {
+		if !tagIndexParams[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// tagExprRe matches graphite tag expressions: tag=value, tag!=value, tag=~regex or tag!=~regex
+var tagExprRe = regexp.MustCompile(`^([^;!=]+)(!?=~?)(.*)$`)
+
+// tagMatcher is a parsed tag expression
+type tagMatcher struct {
+	tag   string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func parseTagMatcher(e string) (tagMatcher, error) {
+	m := tagExprRe.FindStringSubmatch(e)
+	if m == nil {
+		return tagMatcher{}, fmt.Errorf("invalid tag expression '%s'", e)
+	}
+
+	res := tagMatcher{tag: m[1], op: m[2], value: m[3]}
+	if res.op == "=~" || res.op == "!=~" {
+		// graphite anchors regexes at the start of the value
+		re, err := regexp.Compile("^(?:" + res.value + ")")
+		if err != nil {
+			return tagMatcher{}, fmt.Errorf("invalid regex in tag expression '%s': %v", e, err)
+		}
+		res.re = re
+	}
+	return res, nil
+}
+
+// match checks value of the tag, missing tag has empty value
+func (m tagMatcher) match(v string) bool {
+	switch m.op {
+	case "=":
+		return v == m.value
+	case "!=":
+		return v != m.value
+	case "=~":
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+// SeriesByTag returns names of series that match seriesByTag expression. Returns false if index can't evaluate it,
+// i.e. metric is not a seriesByTag call, index is not filled by find walk or is not ready yet
+func (t *tagIndex) SeriesByTag(metric string) ([]string, bool, error) {
+	if t == nil || !t.findWalk || !strings.HasPrefix(metric, "seriesByTag(") {
+		return nil, false, nil
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+	if !t.ready {
+		return nil, false, nil
+	}
+
+	// parser keeps seriesByTag as a single name, so arguments are parsed as the ones of a regular function
+	e, _, err := parser.ParseExpr("tags" + strings.TrimPrefix(metric, "seriesByTag"))
+	if err != nil {
+		return nil, true, err
+	}
+	exprs, err := e.GetStringArgs(0)
+	if err != nil {
+		return nil, true, err
+	}
+
+	matchers := make([]tagMatcher, 0, len(exprs))
+	nonEmpty := false
+	for _, expr := range exprs {
+		m, err := parseTagMatcher(expr)
+		if err != nil {
+			return nil, true, err
+		}
+		if !m.match("") {
+			nonEmpty = true
+		}
+		matchers = append(matchers, m)
+	}
+	if !nonEmpty {
+		return nil, true, fmt.Errorf("at least one tag expression must require a non-empty value: %s", metric)
+	}
+
+	var res []string
+SERIES:
+	for _, s := range t.series {
+		for _, m := range matchers {
+			if !m.match(s.tags[m.tag]) {
+				continue SERIES
+			}
+		}
+		res = append(res, s.name)
+	}
+	return res, true, nil
+}
@@ -0,0 +1,181 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+type tagsMockZipper struct {
+	mockCarbonZipper
+	tags   map[string][]string
+	values int
+	query  string
+}
+
+func (z *tagsMockZipper) TagNames(ctx context.Context, query string, limit int64) ([]string, error) {
+	z.query = query
+	var res []string
+	for tag := range z.tags {
+		res = append(res, tag)
+	}
+	return res, nil
+}
+
+func (z *tagsMockZipper) TagValues(ctx context.Context, query string, limit int64) ([]string, error) {
+	z.values++
+	q, _ := url.ParseQuery(query)
+	return z.tags[q.Get("tag")], nil
+}
+
+func TestTagIndex(t *testing.T) {
+	z := &tagsMockZipper{tags: map[string][]string{
+		"dc":   {"dc2", "dc1"},
+		"host": {"web1", "db1", "web2"},
+	}}
+	idx := newTagIndex(z)
+
+	_, ok := idx.TagNames(url.Values{}, -1)
+	assert.False(t, ok, "index shouldn't answer before refresh")
+
+	assert.NoError(t, idx.fullRefresh(context.Background()))
+	assert.Equal(t, 2, z.values)
+
+	res, ok := idx.TagNames(url.Values{"tagPrefix": {"h"}}, -1)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"host"}, res)
+
+	res, ok = idx.TagValues(url.Values{"tag": {"host"}, "valuePrefix": {"web"}}, 1)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"web1"}, res)
+
+	_, ok = idx.TagValues(url.Values{"tag": {"host"}, "expr": {"dc=dc1"}}, -1)
+	assert.False(t, ok, "index can't evaluate expressions")
+
+	z.tags["env"] = []string{"prod"}
+	delete(z.tags, "dc")
+	assert.NoError(t, idx.deltaRefresh(context.Background()))
+	assert.Equal(t, 3, z.values, "values should be fetched only for new tags")
+
+	res, _ = idx.TagNames(url.Values{}, -1)
+	assert.Equal(t, []string{"env", "host"}, res)
+	res, _ = idx.TagValues(url.Values{"tag": {"env"}}, -1)
+	assert.Equal(t, []string{"prod"}, res)
+
+	var nilIndex *tagIndex
+	_, ok = nilIndex.TagNames(url.Values{}, -1)
+	assert.False(t, ok)
+}
+
+type findWalkMockZipper struct {
+	mockCarbonZipper
+	series  []string
+	finds   int
+	request pb.MultiFetchRequest
+}
+
+func (z *findWalkMockZipper) Find(ctx context.Context, metrics []string) (*pb.MultiGlobResponse, *zipperTypes.Stats, error) {
+	z.finds++
+	res := &pb.MultiGlobResponse{}
+	for _, m := range metrics {
+		prefix := strings.TrimSuffix(m, "*")
+		seen := make(map[string]bool)
+		glob := pb.GlobResponse{Name: m}
+		for _, s := range z.series {
+			if !strings.HasPrefix(s, prefix) {
+				continue
+			}
+			path, isLeaf := s, true
+			if i := strings.IndexByte(s[len(prefix):], '.'); i >= 0 {
+				path, isLeaf = s[:len(prefix)+i], false
+			}
+			if !seen[path] {
+				seen[path] = true
+				glob.Matches = append(glob.Matches, pb.GlobMatch{Path: path, IsLeaf: isLeaf})
+			}
+		}
+		res.Metrics = append(res.Metrics, glob)
+	}
+	return res, nil, nil
+}
+
+func (z *findWalkMockZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+	z.request = request
+	var res []*types.MetricData
+	for _, m := range request.Metrics {
+		r := types.MakeMetricData(m.Name, []float64{1, 2, 3}, 60, m.StartTime)
+		r.PathExpression = m.PathExpression
+		res = append(res, r)
+	}
+	return res, nil, nil
+}
+
+func TestTagIndexFindWalk(t *testing.T) {
+	z := &findWalkMockZipper{series: []string{
+		"cpu.load;dc=dc1;host=web1",
+		"cpu.load;dc=dc2;host=web2",
+		"cpu.idle;dc=dc1;host=web1",
+		"disk.sda.used",
+	}}
+	idx := newTagIndex(z)
+	idx.findWalk = true
+
+	res, ok, err := idx.SeriesByTag("seriesByTag('dc=dc1')")
+	assert.False(t, ok, "index shouldn't answer before refresh")
+
+	assert.NoError(t, idx.fullRefresh(context.Background()))
+	assert.Equal(t, 3, z.finds, "tree should be walked level by level")
+
+	names, _ := idx.TagNames(url.Values{}, -1)
+	assert.Equal(t, []string{"dc", "host", "name"}, names)
+	values, _ := idx.TagValues(url.Values{"tag": {"name"}, "valuePrefix": {"cpu"}}, -1)
+	assert.Equal(t, []string{"cpu.idle", "cpu.load"}, values)
+
+	tests := []struct {
+		metric string
+		names  []string
+	}{
+		{"seriesByTag('dc=dc1')", []string{"cpu.idle;dc=dc1;host=web1", "cpu.load;dc=dc1;host=web1"}},
+		{"seriesByTag('name=cpu.load', 'host!=web1')", []string{"cpu.load;dc=dc2;host=web2"}},
+		{"seriesByTag('name=~cpu', 'dc!=~dc1')", []string{"cpu.load;dc=dc2;host=web2"}},
+		{"seriesByTag('name=~sda')", nil},
+		{"seriesByTag('name=~disk', 'dc=')", []string{"disk.sda.used"}},
+	}
+	for _, tt := range tests {
+		res, ok, err = idx.SeriesByTag(tt.metric)
+		assert.True(t, ok, tt.metric)
+		assert.NoError(t, err, tt.metric)
+		assert.Equal(t, tt.names, res, tt.metric)
+	}
+
+	_, ok, err = idx.SeriesByTag("seriesByTag('dc!=dc1')")
+	assert.True(t, ok)
+	assert.Error(t, err, "expressions that match empty value only should be rejected")
+
+	_, ok, _ = idx.SeriesByTag("cpu.load")
+	assert.False(t, ok)
+
+	idx.maxSeries = 2
+	assert.Error(t, idx.fullRefresh(context.Background()))
+	idx.maxSeries = 0
+
+	defer useZipper(z)()
+	tagIndexes[""] = idx
+	defer delete(tagIndexes, "")
+
+	req, rr := setUpRequest(t, "/render/?target="+url.QueryEscape("sumSeries(seriesByTag('name=cpu.load'))")+"&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, z.request.Metrics, 2)
+	for _, m := range z.request.Metrics {
+		assert.Equal(t, "seriesByTag('name=cpu.load')", m.PathExpression)
+	}
+	assert.Contains(t, rr.Body.String(), `[2,`, "found series should be evaluated")
+}
@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
-	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	"github.com/lomik/zapwriter"
@@ -16,6 +15,17 @@ import (
 	"go.uber.org/zap"
 )
 
+// validateTagExprs checks syntax of expr filters before they are sent to backends, so malformed expressions are
+// reported to the user instead of being answered differently by each backend
+func validateTagExprs(exprs []string) error {
+	for _, e := range exprs {
+		if _, err := parseTagMatcher(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func tagHandler(w http.ResponseWriter, r *http.Request) {
 	t0 := time.Now()
 	uuid := uuid.NewV4()
@@ -37,6 +47,7 @@ func tagHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = &carbonapipb.AccessLogDetails{
 		Handler:        "tags",
 		Username:       username,
+		Tenant:         tenantName(getTenant(ctx)),
 		CarbonapiUUID:  uuid.String(),
 		URL:            r.URL.Path,
 		PeerIP:         srcIP,
@@ -76,14 +87,26 @@ func tagHandler(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	q.Del("pretty")
+	if err = validateTagExprs(q["expr"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		accessLogDetails.HTTPCode = http.StatusBadRequest
+		accessLogDetails.Reason = err.Error()
+		logAsError = true
+		return
+	}
 	rawQuery := q.Encode()
 
-	// TODO(civil): Implement caching
 	var res []string
+	var ok bool
+	index := getTagIndex(getTenant(ctx))
 	if strings.HasSuffix(r.URL.Path, "tags") || strings.HasSuffix(r.URL.Path, "tags/") {
-		res, err = config.Config.ZipperInstance.TagNames(ctx, rawQuery, limit)
+		if res, ok = index.TagNames(q, limit); !ok {
+			res, err = getTenant(ctx).GetZipper().TagNames(ctx, rawQuery, limit)
+		}
 	} else if strings.HasSuffix(r.URL.Path, "values") || strings.HasSuffix(r.URL.Path, "values/") {
-		res, err = config.Config.ZipperInstance.TagValues(ctx, rawQuery, limit)
+		if res, ok = index.TagValues(q, limit); !ok {
+			res, err = getTenant(ctx).GetZipper().TagValues(ctx, rawQuery, limit)
+		}
 	} else {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		accessLogDetails.HTTPCode = http.StatusNotFound
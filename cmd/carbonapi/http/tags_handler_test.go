@@ -0,0 +1,27 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagHandlerExpressions(t *testing.T) {
+	z := &tagsMockZipper{tags: map[string][]string{"dc": {"dc1"}}}
+	defer useZipper(z)()
+
+	req, rr := setUpRequest(t, "/tags/autoComplete/tags?expr=dc%3D~dc%5B12%5D&expr=host%21%3Dweb1&expr=env%21%3D~prod.*&pretty=1")
+	tagHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	q, _ := url.ParseQuery(z.query)
+	assert.Equal(t, []string{"dc=~dc[12]", "host!=web1", "env!=~prod.*"}, q["expr"], "all expressions should be forwarded")
+	assert.Empty(t, q.Get("pretty"))
+
+	for _, expr := range []string{"dc", "=dc1", "dc=~dc[", "dc!=~(", "dc!dc1"} {
+		req, rr = setUpRequest(t, "/tags/autoComplete/tags?expr="+url.QueryEscape(expr))
+		tagHandler(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, expr)
+	}
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+)
+
+type tenantKey struct{}
+
+// getTenant returns tenant of the request or nil if request doesn't belong to any tenant
+func getTenant(ctx context.Context) *config.TenantConfig {
+	t, _ := ctx.Value(tenantKey{}).(*config.TenantConfig)
+	return t
+}
+
+func setTenant(ctx context.Context, t *config.TenantConfig) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+func tenantName(t *config.TenantConfig) string {
+	if t == nil {
+		return ""
+	}
+	return t.Name
+}
+
+// tenantExemptPaths can be requested without tenant even if it's required
+var tenantExemptPaths = []string{"/lb_check", "/version", "/status"}
+
+// resolveTenant finds tenant of the request. URL prefix has priority over header, header over API key. If tenant
+// has API keys, one of them is required even if tenant is selected by URL prefix or header.
+// Returns false if request specifies unknown tenant or invalid API key
+func resolveTenant(r *http.Request) (*config.TenantConfig, bool) {
+	cfg := &config.Config.Tenants
+
+	var key string
+	if cfg.APIKeyHeader != "" {
+		key = r.Header.Get(cfg.APIKeyHeader)
+	}
+
+	if cfg.URLPrefix {
+		path := strings.TrimPrefix(r.URL.Path, config.Config.Prefix+"/")
+		if i := strings.IndexByte(path, '/'); i > 0 {
+			if t := cfg.Get(path[:i]); t != nil {
+				r.URL.Path = config.Config.Prefix + path[i:]
+				r.URL.RawPath = ""
+				return t, t.CheckAPIKey(key)
+			}
+		}
+	}
+
+	if cfg.Header != "" {
+		if name := r.Header.Get(cfg.Header); name != "" {
+			t := cfg.Get(name)
+			return t, t != nil && t.CheckAPIKey(key)
+		}
+	}
+
+	if key != "" {
+		t := cfg.ByAPIKey(key)
+		return t, t != nil
+	}
+
+	return nil, true
+}
+
+// TenantHandler detects tenant of the request and stores it in request's context. URL prefix is stripped from the path,
+// so it should wrap the router
+func TenantHandler(h http.Handler) http.Handler {
+	if len(config.Config.Tenants.Tenants) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := resolveTenant(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusForbidden)+": unknown tenant or invalid API key", http.StatusForbidden)
+			return
+		}
+		if t == nil && config.Config.Tenants.Required && !isTenantExempt(r.URL.Path) {
+			http.Error(w, http.StatusText(http.StatusForbidden)+": tenant is required", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(setTenant(r.Context(), t)))
+	})
+}
+
+func isTenantExempt(path string) bool {
+	path = strings.TrimSuffix(strings.TrimPrefix(path, config.Config.Prefix), "/")
+	for _, p := range tenantExemptPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
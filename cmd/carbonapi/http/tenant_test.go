@@ -0,0 +1,70 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantHandler(t *testing.T) {
+	saved := config.Config.Tenants
+	defer func() { config.Config.Tenants = saved }()
+
+	teamA := &config.TenantConfig{Name: "teama", APIKeys: []string{"secret"}, CacheNamespace: "teama"}
+	teamC := &config.TenantConfig{Name: "teamc", CacheNamespace: "teamc"}
+	config.Config.Tenants = config.TenantsConfig{
+		Header:       "X-Tenant",
+		APIKeyHeader: "X-Api-Key",
+		URLPrefix:    true,
+		Required:     true,
+		Tenants:      map[string]*config.TenantConfig{"teama": teamA, "teamc": teamC},
+	}
+
+	var gotTenant *config.TenantConfig
+	var gotPath string
+	h := TenantHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = getTenant(r.Context())
+		gotPath = r.URL.Path
+	}))
+
+	tests := []struct {
+		url     string
+		headers map[string]string
+		code    int
+		tenant  *config.TenantConfig
+		path    string
+	}{
+		{url: "/teamA/render", headers: map[string]string{"X-Api-Key": "secret"}, code: http.StatusOK, tenant: teamA, path: "/render"},
+		{url: "/render", headers: map[string]string{"X-Tenant": "TEAMA", "X-Api-Key": "secret"}, code: http.StatusOK, tenant: teamA, path: "/render"},
+		// tenant with API keys can't be selected without a key
+		{url: "/teamA/render", code: http.StatusForbidden},
+		{url: "/render", headers: map[string]string{"X-Tenant": "teamA"}, code: http.StatusForbidden},
+		{url: "/render", headers: map[string]string{"X-Tenant": "teamA", "X-Api-Key": "wrong"}, code: http.StatusForbidden},
+		{url: "/teamC/render", code: http.StatusOK, tenant: teamC, path: "/render"},
+		{url: "/render", headers: map[string]string{"X-Tenant": "teamC"}, code: http.StatusOK, tenant: teamC, path: "/render"},
+		{url: "/render", headers: map[string]string{"X-Api-Key": "secret"}, code: http.StatusOK, tenant: teamA, path: "/render"},
+		{url: "/render", headers: map[string]string{"X-Tenant": "teamB"}, code: http.StatusForbidden},
+		{url: "/render", headers: map[string]string{"X-Api-Key": "wrong"}, code: http.StatusForbidden},
+		{url: "/render", code: http.StatusForbidden},
+		{url: "/teamB/render", code: http.StatusForbidden},
+		{url: "/lb_check", code: http.StatusOK, path: "/lb_check"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			gotTenant, gotPath = nil, ""
+			req := httptest.NewRequest("GET", tt.url, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Equal(t, tt.tenant, gotTenant)
+			assert.Equal(t, tt.path, gotPath)
+		})
+	}
+}
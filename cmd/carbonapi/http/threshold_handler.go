@@ -0,0 +1,75 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// thresholdOperators are comparisons accepted by 'operator' parameter of /threshold
+var thresholdOperators = map[string]func(v, threshold float64) bool{
+	"above": func(v, threshold float64) bool { return v > threshold },
+	">":     func(v, threshold float64) bool { return v > threshold },
+	">=":    func(v, threshold float64) bool { return v >= threshold },
+	"below": func(v, threshold float64) bool { return v < threshold },
+	"<":     func(v, threshold float64) bool { return v < threshold },
+	"<=":    func(v, threshold float64) bool { return v <= threshold },
+	"==":    func(v, threshold float64) bool { return v == threshold },
+	"!=":    func(v, threshold float64) bool { return v != threshold },
+}
+
+// thresholdHandler serves /threshold, which is render request that returns only series breaching threshold, with
+// timestamp the breach started at. Besides render parameters, it accepts 'operator' ('above' by default),
+// 'threshold' and 'duration' (minimal length of the breach, e.x. "above 0.9 for 5m")
+func thresholdHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := thresholdCondition(r); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renderAs(w, r, thresholdFormat)
+}
+
+// thresholdCondition returns breach condition and its duration in seconds requested by 'operator', 'threshold' and
+// 'duration' parameters
+func thresholdCondition(r *http.Request) (func(float64) bool, int64, error) {
+	name := r.FormValue("operator")
+	if name == "" {
+		name = "above"
+	}
+	op, ok := thresholdOperators[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown operator '%s'", name)
+	}
+
+	s := r.FormValue("threshold")
+	if s == "" {
+		return nil, 0, fmt.Errorf("missing threshold")
+	}
+	threshold, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid threshold '%s'", s)
+	}
+
+	var duration int64
+	if s := r.FormValue("duration"); s != "" {
+		d, err := parser.IntervalString(s, 1)
+		if err != nil || d < 0 {
+			return nil, 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		duration = int64(d)
+	}
+
+	return func(v float64) bool { return op(v, threshold) }, duration, nil
+}
+
+func marshalThreshold(r *http.Request, results []*types.MetricData) ([]byte, error) {
+	breach, duration, err := thresholdCondition(r)
+	if err != nil {
+		return nil, err
+	}
+	return types.MarshalBreaches(results, breach, duration), nil
+}
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholdHandler(t *testing.T) {
+	tests := []struct {
+		query    string
+		code     int
+		expected string
+	}{
+		{"&threshold=1510913800", http.StatusOK, `[{"target":"foo.bar","tags":{},"since":1510913400,"value":1510913818}]`},
+		{"&threshold=1510913800&duration=2min", http.StatusOK, `[]`},
+		{"&operator=>=&threshold=1510913759&duration=2min", http.StatusOK, `[{"target":"foo.bar","tags":{},"since":1510913340,"value":1510913818}]`},
+		{"&operator=below&threshold=1510913800", http.StatusOK, `[]`},
+		{"", http.StatusBadRequest, ""},
+		{"&threshold=high", http.StatusBadRequest, ""},
+		{"&operator=unknown&threshold=1", http.StatusBadRequest, ""},
+		{"&threshold=1&duration=-1min", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req, rr := setUpRequest(t, "/threshold?target=foo.bar&from=-10minutes"+strings.Replace(tt.query, ">", "%3E", -1))
+		thresholdHandler(rr, req)
+		assert.Equal(t, tt.code, rr.Code, tt.query)
+		if tt.code == http.StatusOK {
+			assert.Equal(t, contentTypeJSON, rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.expected, rr.Body.String(), tt.query)
+		}
+	}
+}
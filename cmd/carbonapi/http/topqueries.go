@@ -0,0 +1,144 @@
+package http
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+)
+
+// topQuery contains aggregated statistics for all queries with the same fingerprint
+type topQuery struct {
+	Fingerprint     string    `json:"fingerprint"`
+	Targets         []string  `json:"targets"`
+	Count           int64     `json:"count"`
+	TotalRuntime    float64   `json:"total_runtime"`
+	MaxRuntime      float64   `json:"max_runtime"`
+	TotalDatapoints int64     `json:"total_datapoints"`
+	MaxDatapoints   int64     `json:"max_datapoints"`
+	ZipperRequests  int64     `json:"zipper_requests"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+}
+
+// topQueries keeps most expensive queries that were seen during the window
+type topQueries struct {
+	sync.Mutex
+	size    int
+	window  time.Duration
+	queries map[string]*topQuery
+}
+
+// topQueriesCapacityFactor defines how many queries are tracked in comparison to the amount that is reported,
+// so queries that are expensive in total but not yet in top still have a chance to get there
+const topQueriesCapacityFactor = 10
+
+var topQueriesTypes = map[string]func(q *topQuery) float64{
+	"runtime":         func(q *topQuery) float64 { return q.TotalRuntime },
+	"max_runtime":     func(q *topQuery) float64 { return q.MaxRuntime },
+	"datapoints":      func(q *topQuery) float64 { return float64(q.TotalDatapoints) },
+	"max_datapoints":  func(q *topQuery) float64 { return float64(q.MaxDatapoints) },
+	"zipper_requests": func(q *topQuery) float64 { return float64(q.ZipperRequests) },
+	"count":           func(q *topQuery) float64 { return float64(q.Count) },
+}
+
+func newTopQueries(size int, window time.Duration) *topQueries {
+	return &topQueries{
+		size:    size,
+		window:  window,
+		queries: make(map[string]*topQuery),
+	}
+}
+
+// expire removes queries that were not seen during the window, must be called with lock held
+func (t *topQueries) expire(now time.Time) {
+	for k, q := range t.queries {
+		if now.Sub(q.LastSeen) > t.window {
+			delete(t.queries, k)
+		}
+	}
+}
+
+// evictCheapest removes query with smallest total runtime, must be called with lock held
+func (t *topQueries) evictCheapest() {
+	var cheapest string
+	var cheapestRuntime float64
+	for k, q := range t.queries {
+		if cheapest == "" || q.TotalRuntime < cheapestRuntime {
+			cheapest = k
+			cheapestRuntime = q.TotalRuntime
+		}
+	}
+	delete(t.queries, cheapest)
+}
+
+func (t *topQueries) Add(accessLogDetails *carbonapipb.AccessLogDetails, runtime time.Duration, now time.Time) {
+	if t == nil || len(accessLogDetails.TargetFingerprints) == 0 {
+		return
+	}
+	fingerprint := strings.Join(accessLogDetails.TargetFingerprints, ",")
+
+	t.Lock()
+	defer t.Unlock()
+
+	q, ok := t.queries[fingerprint]
+	if !ok {
+		if len(t.queries) >= t.size*topQueriesCapacityFactor {
+			t.expire(now)
+		}
+		if len(t.queries) >= t.size*topQueriesCapacityFactor {
+			t.evictCheapest()
+		}
+		q = &topQuery{
+			Fingerprint: fingerprint,
+			Targets:     accessLogDetails.Targets,
+			FirstSeen:   now,
+		}
+		t.queries[fingerprint] = q
+	}
+
+	seconds := runtime.Seconds()
+	q.Count++
+	q.LastSeen = now
+	q.TotalRuntime += seconds
+	if seconds > q.MaxRuntime {
+		q.MaxRuntime = seconds
+	}
+	q.TotalDatapoints += accessLogDetails.DatapointsCount
+	if accessLogDetails.DatapointsCount > q.MaxDatapoints {
+		q.MaxDatapoints = accessLogDetails.DatapointsCount
+	}
+	q.ZipperRequests += accessLogDetails.ZipperRequests
+}
+
+// Top returns up to 'size' most expensive queries, sorted by specified key
+func (t *topQueries) Top(sortBy string, now time.Time) []topQuery {
+	key, ok := topQueriesTypes[sortBy]
+	if !ok {
+		key = topQueriesTypes["runtime"]
+	}
+
+	t.Lock()
+	t.expire(now)
+	res := make([]topQuery, 0, len(t.queries))
+	for _, q := range t.queries {
+		res = append(res, *q)
+	}
+	t.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		return key(&res[i]) > key(&res[j])
+	})
+	if len(res) > t.size {
+		res = res[:t.size]
+	}
+	return res
+}
+
+func (t *topQueries) Reset() {
+	t.Lock()
+	t.queries = make(map[string]*topQuery)
+	t.Unlock()
+}
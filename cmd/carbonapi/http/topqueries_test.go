@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopQueries(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	tq := newTopQueries(2, time.Minute)
+
+	add := func(fingerprint string, runtime time.Duration, datapoints int64, at time.Time) {
+		tq.Add(&carbonapipb.AccessLogDetails{
+			Targets:            []string{fingerprint},
+			TargetFingerprints: []string{fingerprint},
+			DatapointsCount:    datapoints,
+			ZipperRequests:     1,
+		}, runtime, at)
+	}
+
+	add("a", time.Second, 10, now)
+	add("a", 3*time.Second, 10, now)
+	add("b", 2*time.Second, 1000, now)
+	add("c", 100*time.Millisecond, 1, now)
+	add("old", time.Hour, 1, now.Add(-2*time.Minute))
+
+	top := tq.Top("runtime", now)
+	if assert.Len(t, top, 2) {
+		assert.Equal(t, "a", top[0].Fingerprint)
+		assert.Equal(t, int64(2), top[0].Count)
+		assert.Equal(t, 3.0, top[0].MaxRuntime)
+		assert.Equal(t, "b", top[1].Fingerprint)
+	}
+
+	top = tq.Top("max_datapoints", now)
+	if assert.Len(t, top, 2) {
+		assert.Equal(t, "b", top[0].Fingerprint)
+	}
+
+	tq.Reset()
+	assert.Len(t, tq.Top("runtime", now), 0)
+}
+
+func TestTopQueriesHandler(t *testing.T) {
+	req, rr := setUpRequest(t, "/admin/topqueries")
+	topQueriesHandler(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	topQueriesTracker = newTopQueries(10, time.Hour)
+	defer func() { topQueriesTracker = nil }()
+
+	req, rr = setUpRequest(t, "/render/?target=scale(foo.bar,2)&from=-10minutes&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, rr = setUpRequest(t, "/admin/topqueries?sort=runtime")
+	topQueriesHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var top []topQuery
+	err := json.Unmarshal(rr.Body.Bytes(), &top)
+	assert.NoError(t, err)
+	if assert.Len(t, top, 1) {
+		assert.Equal(t, []string{"scale(foo.bar,2)"}, top[0].Targets)
+		assert.Equal(t, int64(1), top[0].Count)
+	}
+
+	rr = serveRequest(topQueriesHandler, "DELETE", "/admin/topqueries", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, topQueriesTracker.Top("runtime", timeNow()), 0)
+}
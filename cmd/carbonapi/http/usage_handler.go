@@ -11,6 +11,8 @@ supported requests:
     /lb_check/
     /metrics/find/?query=
 	/render/?target=
+    /render/explain?target=
+    /status/
 	/tags/autoComplete/tags/
     /tags/autoComplete/values/
     /version/
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket activation or by parent process
+const listenFdsStart = 3
+
+// workingDir is a directory carbonapi was started in, new process is started in it on graceful restart
+var workingDir, _ = os.Getwd()
+
+// inheritedListeners returns listeners passed by systemd socket activation or by parent process on graceful restart
+// (SIGUSR2) and pid of the parent in the latter case. Parent doesn't set LISTEN_PID, as gracehttp didn't, so new
+// versions could be started by old ones. Environment variables are unset, so child processes don't inherit them
+func inheritedListeners() ([]net.Listener, int, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	if os.Getenv("LISTEN_FDS") == "" {
+		return nil, 0, nil
+	}
+	parent := 0
+	if pid := os.Getenv("LISTEN_PID"); pid == "" {
+		// started by init, if parent has already exited
+		if ppid := os.Getppid(); ppid != 1 {
+			parent = ppid
+		}
+	} else if pid != strconv.Itoa(os.Getpid()) {
+		return nil, 0, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, 0, fmt.Errorf("invalid LISTEN_FDS: '%s'", os.Getenv("LISTEN_FDS"))
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, 0, fmt.Errorf("inherited socket %d is not a listener: %v", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, parent, nil
+}
+
+// sameAddr checks if listener is bound to address, unspecified host matches any address of the same family
+func sameAddr(l net.Listener, address string) bool {
+	a, ok := l.Addr().(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	b, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil || a.Port != b.Port {
+		return false
+	}
+	if b.IP == nil {
+		return a.IP.IsUnspecified()
+	}
+	return a.IP.Equal(b.IP)
+}
+
+// listen returns listener for each server and pid of the parent that should be stopped once they are served, if
+// sockets were passed by it on graceful restart. Sockets passed by systemd socket activation or by the parent are used
+// for servers with the same address, new ones are created for the rest. If reusePort is set, new sockets have
+// SO_REUSEPORT option, so several instances could listen on the same port, e.x. during rolling restart
+func listen(logger *zap.Logger, servers []*http.Server, reusePort bool) ([]net.Listener, int, error) {
+	inherited, parent, err := inheritedListeners()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+
+	listeners := make([]net.Listener, len(servers))
+	for i, s := range servers {
+		for j, l := range inherited {
+			if l != nil && sameAddr(l, s.Addr) {
+				logger.Info("using inherited socket",
+					zap.String("listen", s.Addr),
+					zap.Int("parent_pid", parent),
+				)
+				listeners[i] = l
+				inherited[j] = nil
+				break
+			}
+		}
+		if listeners[i] != nil {
+			continue
+		}
+
+		listeners[i], err = lc.Listen(context.Background(), "tcp", s.Addr)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, l := range inherited {
+		if l != nil {
+			logger.Warn("inherited socket doesn't match any listen address, ignored",
+				zap.String("address", l.Addr().String()),
+			)
+			l.Close()
+		}
+	}
+	return listeners, parent, nil
+}
+
+// startProcess starts the same binary with the same arguments and environment, passing listeners to it, like gracehttp
+// does on SIGUSR2. New process stops the current one by SIGTERM when it's ready to serve
+func startProcess(listeners []net.Listener) (int, error) {
+	files := make([]*os.File, 0, len(listeners))
+	for _, l := range listeners {
+		tl, ok := l.(*net.TCPListener)
+		if !ok {
+			return 0, fmt.Errorf("listener %v can't be passed to new process", l.Addr())
+		}
+		f, err := tl.File()
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	env := make([]string, 0, len(os.Environ())+1)
+	for _, v := range os.Environ() {
+		if !strings.HasPrefix(v, "LISTEN_FDS=") {
+			env = append(env, v)
+		}
+	}
+	env = append(env, "LISTEN_FDS="+strconv.Itoa(len(files)))
+
+	p, err := os.StartProcess(path, os.Args, &os.ProcAttr{
+		Dir:   workingDir,
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return p.Pid, nil
+}
@@ -7,9 +7,7 @@ import (
 	"net/http"
 	"net/http/pprof"
 	_ "net/http/pprof"
-	"sync"
 
-	"github.com/facebookgo/grace/gracehttp"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	carbonapiHttp "github.com/go-graphite/carbonapi/cmd/carbonapi/http"
 	"github.com/gorilla/handlers"
@@ -40,16 +38,26 @@ func main() {
 	config.SetUpConfigUpstreams(logger)
 	config.SetUpConfig(logger, BuildVersion)
 	carbonapiHttp.SetupMetrics(logger)
-	setupGraphiteMetrics(logger)
-
-	config.Config.ZipperInstance = newZipper(carbonapiHttp.ZipperStats, &config.Config.Upstreams, config.Config.IgnoreClientTimeout, zapwriter.Logger("zipper"))
+	graphite := setupGraphiteMetrics(logger)
+
+	// Reloader should be created before zipper, as zipper modifies upstreams config
+	reloader := newConfigReloader(logger)
+	reloader.zipper = newZipper(carbonapiHttp.ZipperStats, &config.Config.Upstreams, config.Config.IgnoreClientTimeout, zapwriter.Logger("zipper"))
+	config.Config.ZipperInstance = reloader.zipper
+	for _, t := range config.Config.Tenants.Tenants {
+		if t.Upstreams != nil {
+			t.ZipperInstance = newZipper(carbonapiHttp.ZipperStats, t.Upstreams, config.Config.IgnoreClientTimeout, zapwriter.Logger("zipper").With(zap.String("tenant", t.Name)))
+		}
+	}
+	carbonapiHttp.ConfigReloader = reloader.Reload
+	go reloader.handleSignals()
 
 	r := carbonapiHttp.InitHandlers(config.Config.HeadersToPass, config.Config.HeadersToLog)
-	handler := handlers.CompressHandler(r)
+	handler := handlers.CompressHandler(carbonapiHttp.TenantHandler(r))
 	handler = handlers.CORS()(handler)
 	handler = handlers.ProxyHeaders(handler)
 
-	wg := sync.WaitGroup{}
+	servers := []*http.Server{}
 	if config.Config.Expvar.Enabled {
 		if config.Config.Expvar.Listen != "" || config.Config.Expvar.Listen != config.Config.Listen {
 			r := http.NewServeMux()
@@ -70,39 +78,61 @@ func main() {
 				zap.Bool("pprof_enabled", config.Config.Expvar.PProfEnabled),
 			)
 
-			wg.Add(1)
-			go func() {
-				err = gracehttp.Serve(&http.Server{
-					Addr:    config.Config.Expvar.Listen,
-					Handler: handler,
-				})
-
-				if err != nil {
-					logger.Fatal("gracehttp failed",
-						zap.Error(err),
-					)
-				}
-
-				wg.Done()
-			}()
+			servers = append(servers, &http.Server{
+				Addr:    config.Config.Expvar.Listen,
+				Handler: handler,
+			})
 		}
 	}
 
-	wg.Add(1)
-	go func() {
-		err = gracehttp.Serve(&http.Server{
-			Addr:    config.Config.Listen,
-			Handler: handler,
+	if config.Config.Admin.Enabled && config.Config.Admin.Listen != "" && config.Config.Admin.Listen != config.Config.Listen {
+		r := http.NewServeMux()
+		carbonapiHttp.InitAdminHandlers(r)
+
+		logger.Info("admin handlers will listen on a separate address/port",
+			zap.String("admin_listen", config.Config.Admin.Listen),
+		)
+
+		servers = append(servers, &http.Server{
+			Addr:    config.Config.Admin.Listen,
+			Handler: r,
 		})
+	}
 
+	server := &http.Server{
+		Addr:    config.Config.Listen,
+		Handler: handler,
+	}
+	if config.Config.TLS != nil {
+		server.TLSConfig, err = config.Config.TLS.TLSConfig()
 		if err != nil {
-			logger.Fatal("gracehttp failed",
+			logger.Fatal("failed to set up TLS for listener",
 				zap.Error(err),
 			)
 		}
+	}
+	servers = append(servers, server)
 
-		wg.Done()
-	}()
-
-	wg.Wait()
+	listeners, parent, err := listen(logger, servers, config.Config.ReusePort)
+	if err != nil {
+		logger.Fatal("failed to listen",
+			zap.Error(err),
+		)
+	}
+	serve(logger, servers, listeners, parent, config.Config.DrainTimeout)
+
+	// all requests are finished and background jobs are stopped, so backends and metrics aren't used anymore
+	carbonapiHttp.StopScheduler()
+	reloader.zipper.Close()
+	for _, t := range config.Config.Tenants.Tenants {
+		if z, ok := t.ZipperInstance.(*zipper); ok {
+			z.Close()
+		}
+	}
+	if graphite != nil {
+		graphite.Shutdown()
+	}
+	logger.Info("carbonapi stopped")
+	zapwriter.Default().Sync()
+	zapwriter.Logger("access").Sync()
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	realZipper "github.com/go-graphite/carbonapi/zipper"
+	"go.uber.org/zap"
+)
+
+type configReloader struct {
+	sync.Mutex
+	logger *zap.Logger
+	zipper *zipper
+
+	// upstreams is a serialized upstreams config that zipper was created with. NewZipper modifies config, so
+	// it's not possible to compare it with new one directly
+	upstreams []byte
+}
+
+func newConfigReloader(logger *zap.Logger) *configReloader {
+	upstreams, _ := json.Marshal(config.Config.Upstreams)
+	return &configReloader{
+		logger:    logger,
+		upstreams: upstreams,
+	}
+}
+
+// Reload re-reads config file and applies sections that are safe to change at runtime. Nothing is applied if
+// new config is invalid. Returns list of changes.
+func (c *configReloader) Reload() ([]string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	cfg, err := config.ReadConfig(c.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	upstreams, err := json.Marshal(cfg.Upstreams)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(upstreams, c.upstreams) {
+		err = realZipper.ValidateConfig(&cfg.Upstreams)
+		if err != nil {
+			return nil, err
+		}
+		err = c.zipper.Reload(&cfg.Upstreams)
+		if err != nil {
+			return nil, err
+		}
+		c.upstreams = upstreams
+		changes = append(changes, "upstreams")
+	}
+
+	changes = append(changes, config.ApplyReloadable(cfg)...)
+	return changes, nil
+}
+
+// handleSignals reloads config on SIGHUP
+func (c *configReloader) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		changes, err := c.Reload()
+		if err != nil {
+			c.logger.Error("config reload failed",
+				zap.Error(err),
+			)
+			continue
+		}
+		c.logger.Info("config reloaded",
+			zap.Strings("changes", changes),
+		)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package main
+
+import (
+	"syscall"
+)
+
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,4 @@
+package main
+
+// soReusePort is SO_REUSEPORT, syscall package doesn't define it for linux
+const soReusePort = 0xf
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// serve runs servers on listeners until SIGINT or SIGTERM is received, then shuts them down gracefully: listeners are
+// closed immediately and requests in progress have drainTimeout to finish, after that remaining connections are
+// closed. Second signal terminates the process without waiting. SIGUSR2 starts new process with the same listeners,
+// which stops this one when it's ready. If parent is set, it's stopped the same way once servers are started
+func serve(logger *zap.Logger, servers []*http.Server, listeners []net.Listener, parent int, drainTimeout time.Duration) {
+	errs := make(chan error, len(servers))
+	for i, s := range servers {
+		go func(s *http.Server, l net.Listener) {
+			var err error
+			if s.TLSConfig != nil {
+				// certificates are already loaded into TLSConfig
+				err = s.ServeTLS(l, "", "")
+			} else {
+				err = s.Serve(l)
+			}
+			if err != http.ErrServerClosed {
+				errs <- err
+			}
+		}(s, listeners[i])
+	}
+
+	if parent != 0 {
+		logger.Info("stopping parent process",
+			zap.Int("parent_pid", parent),
+		)
+		if err := syscall.Kill(parent, syscall.SIGTERM); err != nil {
+			logger.Warn("failed to stop parent process",
+				zap.Int("parent_pid", parent),
+				zap.Error(err),
+			)
+		}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2)
+	for stop := false; !stop; {
+		select {
+		case err := <-errs:
+			logger.Fatal("failed to serve",
+				zap.Error(err),
+			)
+		case sig := <-ch:
+			if sig != syscall.SIGUSR2 {
+				logger.Info("shutting down",
+					zap.String("signal", sig.String()),
+					zap.Duration("drain_timeout", drainTimeout),
+				)
+				stop = true
+				break
+			}
+			// current process is stopped by the new one, when it's ready to serve
+			pid, err := startProcess(listeners)
+			if err != nil {
+				logger.Error("failed to start new process for graceful restart",
+					zap.Error(err),
+				)
+				break
+			}
+			logger.Info("started new process for graceful restart",
+				zap.Int("pid", pid),
+			)
+		}
+	}
+	signal.Stop(ch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				logger.Warn("requests were not finished before drain timeout, closing connections",
+					zap.String("listen", s.Addr),
+					zap.Error(err),
+				)
+				s.Close()
+			}
+		}(s)
+	}
+	wg.Wait()
+}
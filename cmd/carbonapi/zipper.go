@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	tags2 "github.com/go-graphite/carbonapi/expr/tags"
 
@@ -19,15 +22,32 @@ import (
 var errNoMetrics = errors.New("no metrics")
 
 type zipper struct {
-	z *realZipper.Zipper
+	// z could be replaced by config reload or discovery of backend servers
+	z atomic.Value // *realZipper.Zipper
+
+	// mu serializes replacement of zipper, config is the one it was created with
+	mu     sync.Mutex
+	config *zipperCfg.Config
+	quit   chan struct{}
 
 	logger              *zap.Logger
 	statsSender         func(*zipperTypes.Stats)
 	ignoreClientTimeout bool
 }
 
+// discoveryTimeout limits time of resolving servers of all backend groups
+const discoveryTimeout = 10 * time.Second
+
 func newZipper(sender func(*zipperTypes.Stats), config *zipperCfg.Config, ignoreClientTimeout bool, logger *zap.Logger) *zipper {
 	logger.Debug("initializing zipper")
+	z := &zipper{
+		quit:                make(chan struct{}),
+		logger:              logger,
+		statsSender:         sender,
+		ignoreClientTimeout: ignoreClientTimeout,
+	}
+	config, _ = z.discoverServers(config)
+	z.config = config
 	zz, err := realZipper.NewZipper(sender, config, logger)
 	if err != nil {
 		logger.Fatal("failed to initialize zipper",
@@ -35,30 +55,125 @@ func newZipper(sender func(*zipperTypes.Stats), config *zipperCfg.Config, ignore
 		)
 		return nil
 	}
-	z := &zipper{
-		z:                   zz,
-		logger:              logger,
-		statsSender:         sender,
-		ignoreClientTimeout: ignoreClientTimeout,
-	}
+	z.z.Store(zz)
+	go z.watchDiscovery()
 
 	return z
 }
 
-func (z zipper) Find(ctx context.Context, metrics []string) (*pb.MultiGlobResponse, *zipperTypes.Stats, error) {
+func (z *zipper) get() *realZipper.Zipper {
+	return z.z.Load().(*realZipper.Zipper)
+}
+
+// Reload replaces zipper with the one created from new config. Requests that are already running will be served by
+// the old one.
+func (z *zipper) Reload(config *zipperCfg.Config) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	config, _ = z.discoverServers(config)
+	err := z.replace(config)
+	if err != nil {
+		return err
+	}
+	z.config = config
+	return nil
+}
+
+func (z *zipper) replace(config *zipperCfg.Config) error {
+	zz, err := realZipper.NewZipper(z.statsSender, config, z.logger)
+	if err != nil {
+		return err
+	}
+	old := z.get()
+	z.z.Store(zz)
+	old.Close()
+	return nil
+}
+
+// discoverServers returns copy of config with resolved servers of backend groups with discovery and the groups, which
+// servers changed. Groups that failed to resolve keep previous servers
+func (z *zipper) discoverServers(config *zipperCfg.Config) (*zipperCfg.Config, []*zipperTypes.BackendV2) {
+	if realZipper.DiscoveryInterval(config) == 0 {
+		return config, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	next, changed, err := realZipper.DiscoverServers(ctx, config)
+	if err != nil {
+		z.logger.Warn("failed to discover backend servers",
+			zap.Error(err),
+		)
+	}
+	return next, changed
+}
+
+// watchDiscovery re-resolves servers of backend groups periodically and updates them in running zipper. Zipper is
+// replaced only if some of the groups can't change servers
+func (z *zipper) watchDiscovery() {
+	for {
+		z.mu.Lock()
+		interval := realZipper.DiscoveryInterval(z.config)
+		z.mu.Unlock()
+		if interval == 0 {
+			// discovery could be enabled by config reload
+			interval = time.Minute
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-z.quit:
+			return
+		}
+
+		z.mu.Lock()
+		if next, changed := z.discoverServers(z.config); len(changed) > 0 {
+			err := z.get().SetServers(changed)
+			if err != nil {
+				z.logger.Info("recreating zipper to apply discovered backend servers",
+					zap.String("reason", err.Error()),
+				)
+				err = z.replace(next)
+			}
+			if err != nil {
+				z.logger.Error("failed to apply discovered backend servers",
+					zap.Error(err),
+				)
+			} else {
+				z.config = next
+				for _, g := range changed {
+					z.logger.Info("backend servers changed",
+						zap.String("group", g.GroupName),
+						zap.Strings("servers", g.Servers),
+					)
+				}
+			}
+		}
+		z.mu.Unlock()
+	}
+}
+
+// Close stops background probes and discovery of backends and closes connections to them, zipper must not be used
+// after that
+func (z *zipper) Close() {
+	close(z.quit)
+	z.get().Close()
+}
+
+func (z *zipper) Find(ctx context.Context, metrics []string) (*pb.MultiGlobResponse, *zipperTypes.Stats, error) {
 	newCtx := ctx
 	if z.ignoreClientTimeout {
 		uuid := util.GetUUID(ctx)
 		hdrs := util.GetPassHeaders(ctx)
 		newCtx = util.SetUUID(context.Background(), uuid)
 		newCtx = util.SetPassHeaders(newCtx, hdrs)
+		newCtx = util.SetBackendGroup(newCtx, util.GetBackendGroup(ctx))
 	}
 
 	req := pb.MultiGlobRequest{
 		Metrics: metrics,
 	}
 
-	res, stats, err := z.z.FindProtoV3(newCtx, &req)
+	res, stats, err := z.get().FindProtoV3(newCtx, &req)
 	if err != nil {
 		return nil, stats, err
 	}
@@ -68,20 +183,21 @@ func (z zipper) Find(ctx context.Context, metrics []string) (*pb.MultiGlobRespon
 	return res, stats, err
 }
 
-func (z zipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, error) {
+func (z *zipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, error) {
 	newCtx := ctx
 	if z.ignoreClientTimeout {
 		uuid := util.GetUUID(ctx)
 		hdrs := util.GetPassHeaders(ctx)
 		newCtx = util.SetUUID(context.Background(), uuid)
 		newCtx = util.SetPassHeaders(newCtx, hdrs)
+		newCtx = util.SetBackendGroup(newCtx, util.GetBackendGroup(ctx))
 	}
 
 	req := pb.MultiGlobRequest{
 		Metrics: metrics,
 	}
 
-	resp, stats, err := z.z.InfoProtoV3(newCtx, &req)
+	resp, stats, err := z.get().InfoProtoV3(newCtx, &req)
 	if err != nil {
 		return nil, stats, fmt.Errorf("http.Get: %+v", err)
 	}
@@ -91,7 +207,7 @@ func (z zipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoRespo
 	return resp, stats, nil
 }
 
-func (z zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
+func (z *zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, error) {
 	var result []*types.MetricData
 	newCtx := ctx
 	if z.ignoreClientTimeout {
@@ -99,9 +215,10 @@ func (z zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*ty
 		hdrs := util.GetPassHeaders(ctx)
 		newCtx = util.SetUUID(context.Background(), uuid)
 		newCtx = util.SetPassHeaders(newCtx, hdrs)
+		newCtx = util.SetBackendGroup(newCtx, util.GetBackendGroup(ctx))
 	}
 
-	pbresp, stats, err := z.z.FetchProtoV3(newCtx, &request)
+	pbresp, stats, err := z.get().FetchProtoV3(newCtx, &request)
 	if err != nil {
 		return result, stats, err
 	}
@@ -109,7 +226,8 @@ func (z zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*ty
 	z.statsSender(stats)
 
 	for i := range pbresp.Metrics {
-		tags := tags2.ExtractTags(pbresp.Metrics[i].Name)
+		// the same series are fetched again and again, tags are never modified in place (see MetricData.CopyLink)
+		tags := tags2.ExtractTagsCached(pbresp.Metrics[i].Name)
 		result = append(result, &types.MetricData{
 			FetchResponse: pbresp.Metrics[i],
 			Tags:          tags,
@@ -123,7 +241,7 @@ func (z zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*ty
 	return result, stats, nil
 }
 
-func (z zipper) RenderCompat(ctx context.Context, metrics []string, from, until int64) ([]*types.MetricData, *zipperTypes.Stats, error) {
+func (z *zipper) RenderCompat(ctx context.Context, metrics []string, from, until int64) ([]*types.MetricData, *zipperTypes.Stats, error) {
 	var result []*types.MetricData
 	newCtx := ctx
 	if z.ignoreClientTimeout {
@@ -131,6 +249,7 @@ func (z zipper) RenderCompat(ctx context.Context, metrics []string, from, until
 		hdrs := util.GetPassHeaders(ctx)
 		newCtx = util.SetUUID(context.Background(), uuid)
 		newCtx = util.SetPassHeaders(newCtx, hdrs)
+		newCtx = util.SetBackendGroup(newCtx, util.GetBackendGroup(ctx))
 	}
 
 	req := pb.MultiFetchRequest{}
@@ -142,7 +261,7 @@ func (z zipper) RenderCompat(ctx context.Context, metrics []string, from, until
 		})
 	}
 
-	pbresp, stats, err := z.z.FetchProtoV3(newCtx, &req)
+	pbresp, stats, err := z.get().FetchProtoV3(newCtx, &req)
 	if err != nil {
 		return result, stats, err
 	}
@@ -160,10 +279,22 @@ func (z zipper) RenderCompat(ctx context.Context, metrics []string, from, until
 	return result, stats, nil
 }
 
-func (z zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, error) {
-	return z.z.TagNames(ctx, query, limit)
+func (z *zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, error) {
+	return z.get().TagNames(ctx, query, limit)
+}
+
+func (z *zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, error) {
+	return z.get().TagValues(ctx, query, limit)
 }
 
-func (z zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, error) {
-	return z.z.TagValues(ctx, query, limit)
+// List returns names of all metrics of backends, it's used to build metric index
+func (z *zipper) List(ctx context.Context) ([]string, error) {
+	res, stats, err := z.get().ListProtoV3(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	z.statsSender(stats)
+
+	return res.Metrics, nil
 }
@@ -47,3 +47,11 @@ func TestDateParamToEpoch(t *testing.T) {
 		}
 	}
 }
+
+func TestDateParamToEpochInvalidTimeZone(t *testing.T) {
+	got := DateParamToEpoch("19940812", "Invalid/Zone", 0, time.UTC)
+	want := time.Date(1994, time.August, 12, 0, 0, 0, 0, time.UTC).Unix()
+	if got != want {
+		t.Errorf("dateParamToEpoch with invalid time zone=%v, want %v", got, want)
+	}
+}
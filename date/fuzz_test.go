@@ -0,0 +1,19 @@
+package date
+
+import (
+	"testing"
+	"time"
+)
+
+// FuzzDateParamToEpoch parses from/until parameter with time zone of the query
+func FuzzDateParamToEpoch(f *testing.F) {
+	for _, s := range []string{"midnight", "noon tomorrow", "17:04 19940812", "-1day", "now-5min", "1286269200", "19940812"} {
+		f.Add(s, "")
+	}
+	f.Add("19940812", "Invalid/Zone")
+	f.Add("noon 08/12/94", "Europe/Moscow")
+
+	f.Fuzz(func(t *testing.T, s, qtz string) {
+		DateParamToEpoch(s, qtz, -1, time.UTC)
+	})
+}
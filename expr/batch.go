@@ -0,0 +1,101 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// ParseError is returned by EvalBatches if target can't be parsed
+type ParseError struct {
+	Target string
+	// Rest is a part of target that can't be parsed
+	Rest string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("failed to parse %s: %v", e.Target, e.Err)
+	}
+	return fmt.Sprintf("failed to parse %s: could not parse '%s'", e.Target, e.Rest)
+}
+
+// RewriteError is returned by EvalBatches if target can't be rewritten
+type RewriteError struct {
+	Target string
+	Err    error
+}
+
+func (e *RewriteError) Error() string {
+	return e.Err.Error()
+}
+
+// FetchBatchFunc fetches series of metrics of all expressions of the batch and adds them to values of EvalBatches
+type FetchBatchFunc func(targets []string, exps []parser.Expr) error
+
+// EvalTargetFunc is called for each target of the batch after its series are fetched. Target that is rewritten
+// shouldn't be evaluated, targets it's rewritten to are evaluated in the next batch
+type EvalTargetFunc func(target string, exp parser.Expr, rewritten bool) error
+
+// EvalBatches evaluates targets like render request does: the first batch is targets, the next ones are produced by
+// rewrite functions (e.x. applyByNode). Metrics of the whole batch are fetched before any target of the batch is
+// evaluated. Evaluation is stopped by *ParseError, *RewriteError or error returned by callbacks
+func EvalBatches(targets []string, from, until int64, values map[parser.MetricRequest][]*types.MetricData, fetch FetchBatchFunc, eval EvalTargetFunc) error {
+	// targets could be extended by rewritten expressions
+	targets = append([]string(nil), targets...)
+	for batchStart := 0; batchStart < len(targets); {
+		batch := targets[batchStart:]
+		batchStart = len(targets)
+
+		exps := make([]parser.Expr, 0, len(batch))
+		for _, target := range batch {
+			exp, e, err := parser.ParseExpr(target)
+			if err != nil || e != "" {
+				return &ParseError{Target: target, Rest: e, Err: err}
+			}
+			exps = append(exps, exp)
+		}
+
+		if err := fetch(batch, exps); err != nil {
+			return err
+		}
+
+		for i, exp := range exps {
+			rewritten, newTargets, err := RewriteExpr(exp, from, until, values)
+			if err != nil && err != parser.ErrSeriesDoesNotExist {
+				return &RewriteError{Target: batch[i], Err: err}
+			}
+			if err := eval(batch[i], exp, rewritten); err != nil {
+				return err
+			}
+			if rewritten {
+				targets = append(targets, newTargets...)
+			}
+		}
+	}
+	return nil
+}
+
+// StoreFetched adds fetched series to values by their path expressions and requested time ranges, so series of the
+// same metric fetched for different ranges (e.x. by timeShift) are kept apart. timeRange returns the range of path
+// expression, if series don't have it. Series of each request are sorted like graphite-web does
+func StoreFetched(values map[parser.MetricRequest][]*types.MetricData, fetched []*types.MetricData, timeRange func(path string) (int64, int64)) {
+	updated := make(map[parser.MetricRequest]bool)
+	for _, m := range fetched {
+		mFetch := parser.MetricRequest{
+			Metric: m.PathExpression,
+			From:   m.RequestStartTime,
+			Until:  m.RequestStopTime,
+		}
+		if mFetch.From == 0 || mFetch.Until == 0 {
+			mFetch.From, mFetch.Until = timeRange(m.PathExpression)
+		}
+		values[mFetch] = append(values[mFetch], m)
+		updated[mFetch] = true
+	}
+	for mFetch := range updated {
+		SortMetrics(values[mFetch], mFetch)
+	}
+}
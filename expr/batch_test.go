@@ -0,0 +1,75 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalBatches(t *testing.T) {
+	const from, until = 100, 200
+	series := map[string][]string{
+		"foo":   {"foo"},
+		"b.*":   {"b.z", "b.a"},
+		"b.a.*": {"b.a.x"},
+		"b.z.*": {"b.z.x"},
+	}
+
+	var fetches [][]string
+	var evaluated []string
+	values := make(map[parser.MetricRequest][]*types.MetricData)
+	fetch := func(batch []string, exps []parser.Expr) error {
+		fetches = append(fetches, batch)
+		var fetched []*types.MetricData
+		for _, exp := range exps {
+			for _, m := range exp.Metrics() {
+				key := parser.MetricRequest{Metric: m.Metric, From: from + m.From, Until: until + m.Until}
+				if _, ok := values[key]; ok {
+					continue
+				}
+				values[key] = nil
+				for _, name := range series[m.Metric] {
+					s := types.MakeMetricData(name, []float64{1, 2}, 1, from+m.From)
+					s.PathExpression = m.Metric
+					s.RequestStartTime = from + m.From
+					s.RequestStopTime = until + m.Until
+					fetched = append(fetched, s)
+				}
+			}
+		}
+		StoreFetched(values, fetched, func(path string) (int64, int64) { return 0, 0 })
+		return nil
+	}
+	var results []*types.MetricData
+	eval := func(target string, exp parser.Expr, rewritten bool) error {
+		evaluated = append(evaluated, target)
+		if rewritten {
+			return nil
+		}
+		r, err := EvalExpr(exp, from, until, values)
+		results = append(results, r...)
+		return err
+	}
+
+	targets := []string{"foo", "timeShift(foo,'3s')", "b.*", `applyByNode(b.*, 2, "%.*")`}
+	err := EvalBatches(targets, from, until, values, fetch, eval)
+	assert.NoError(t, err)
+
+	// targets produced by rewrite are evaluated in the next batch
+	assert.Equal(t, [][]string{targets, {"b.a.*", "b.z.*"}}, fetches)
+	assert.Equal(t, append(targets, "b.a.*", "b.z.*"), evaluated)
+	// series of the same metric fetched for different ranges aren't mixed, series are sorted
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"foo", "timeShift(foo,'-3')", "b.a", "b.z", "b.a.x", "b.z.x"}, names)
+	assert.Len(t, values[parser.MetricRequest{Metric: "foo", From: from, Until: until}], 1)
+
+	err = EvalBatches([]string{"foo", "foo("}, from, until, values, fetch, eval)
+	if assert.IsType(t, &ParseError{}, err) {
+		assert.Equal(t, "foo(", err.(*ParseError).Target)
+	}
+}
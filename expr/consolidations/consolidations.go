@@ -16,20 +16,38 @@ var ConsolidationToFunc = map[string]func([]float64) float64{
 	"avg_zero": AggMeanZero,
 	"avg":      AggMean,
 	"count":    AggCount,
+	"current":  AggLast,
 	"diff":     AggDiff,
 	"max":      AggMax,
 	"maximum":  AggMax,
 	"median":   summarizeToAggregate("median"),
 	"min":      AggMin,
 	"minimum":  AggMin,
-	"multiply": summarizeToAggregate("multiply"),
-	"range":    summarizeToAggregate("range"),
+	"multiply": AggMultiply,
+	"range":    AggRange,
+	"rangeOf":  AggRange,
 	"sum":      AggSum,
-	"stddev":   summarizeToAggregate("stddev"),
+	"total":    AggSum,
+	"stddev":   AggStddev,
 	"first":    AggFirst,
 	"last":     AggLast,
 }
 
+// ConsolidationFunc returns consolidation function by name. Names are case-insensitive, as backends return them
+// in different forms, e.x. "Average" or "avg"
+func ConsolidationFunc(name string) (func([]float64) float64, bool) {
+	if f, ok := ConsolidationToFunc[name]; ok {
+		return f, true
+	}
+	lower := strings.ToLower(name)
+	for k, f := range ConsolidationToFunc {
+		if strings.ToLower(k) == lower {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
 var AvailableSummarizers = []string{"sum", "total", "avg", "average", "avg_zero", "max", "min", "last", "range", "median", "multiply", "diff", "count", "stddev"}
 
 // AvgValue returns average of list of values
@@ -108,6 +126,20 @@ func summarizeToAggregate(f string) func([]float64) float64 {
 	}
 }
 
+// IsValidSummarizer checks if f could be passed to SummarizeValues
+func IsValidSummarizer(f string) bool {
+	for _, s := range AvailableSummarizers {
+		if s == f {
+			return true
+		}
+	}
+	if strings.HasPrefix(f, "p") {
+		_, err := strconv.ParseFloat(f[1:], 64)
+		return err == nil
+	}
+	return false
+}
+
 // SummarizeValues summarizes values
 func SummarizeValues(f string, values []float64) float64 {
 	rv := 0.0
@@ -115,6 +147,9 @@ func SummarizeValues(f string, values []float64) float64 {
 	if len(values) == 0 {
 		return math.NaN()
 	}
+	if agg, ok := customAggregators[f]; ok {
+		return agg(values)
+	}
 
 	switch f {
 	case "sum", "total":
@@ -289,17 +324,14 @@ func AggSum(v []float64) float64 {
 	return sum
 }
 
-// AggFirst returns first point
+// AggFirst returns first non-NaN point
 func AggFirst(v []float64) float64 {
-	var m = math.Inf(-1)
-	var abs = true
-	if len(v) > 0 {
-		return v[0]
-	}
-	if abs {
-		return math.NaN()
+	for _, vv := range v {
+		if !math.IsNaN(vv) {
+			return vv
+		}
 	}
-	return m
+	return math.NaN()
 }
 
 // AggLast returns last point
@@ -348,6 +380,28 @@ func AggDiff(v []float64) float64 {
 	return res
 }
 
+// AggRange computes difference between max and min of values
+func AggRange(v []float64) float64 {
+	return AggMax(v) - AggMin(v)
+}
+
+// AggMultiply computes product of values. Like in graphite, product is NaN if any of the values is NaN
+func AggMultiply(v []float64) float64 {
+	if len(v) == 0 {
+		return math.NaN()
+	}
+	var res = 1.0
+	for _, vv := range v {
+		res *= vv
+	}
+	return res
+}
+
+// AggStddev computes standard deviation of non-NaN points
+func AggStddev(v []float64) float64 {
+	return math.Sqrt(VarianceValue(v))
+}
+
 // MaxValue returns maximum from the list
 func MaxValue(f64s []float64) float64 {
 	m := math.Inf(-1)
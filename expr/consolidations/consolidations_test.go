@@ -109,3 +109,41 @@ func TestSummarizeValues(t *testing.T) {
 	}
 
 }
+
+func TestConsolidationFunc(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name     string
+		values   []float64
+		expected float64
+	}{
+		{"first", []float64{nan, 2, 1}, 2},
+		{"First", []float64{nan, nan}, nan},
+		{"range", []float64{3, nan, 1, 5}, 4},
+		{"rangeOf", []float64{nan}, nan},
+		{"count", []float64{3, nan, 1}, 2},
+		{"multiply", []float64{2, 1, 3}, 6},
+		{"MULTIPLY", []float64{2, nan}, nan},
+		{"stddev", []float64{2, 4, nan, 4, 4, 5, 5, 7, 9}, 2},
+		{"Average", []float64{1, nan, 3}, 2},
+		{"total", []float64{1, nan, 3}, 4},
+		{"current", []float64{1, 3, nan}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := ConsolidationFunc(tt.name)
+			if !ok {
+				t.Fatalf("consolidation function %s not found", tt.name)
+			}
+			got := f(tt.values)
+			if got != tt.expected && !(math.IsNaN(got) && math.IsNaN(tt.expected)) {
+				t.Errorf("got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+
+	if _, ok := ConsolidationFunc("unknown"); ok {
+		t.Error("unknown consolidation function shouldn't be found")
+	}
+}
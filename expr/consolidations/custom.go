@@ -0,0 +1,95 @@
+package consolidations
+
+import (
+	"fmt"
+	"math"
+)
+
+// Handling of absent values by custom aggregators
+const (
+	// NullsKeep passes values to the function as is
+	NullsKeep = "keep"
+	// NullsSkip removes absent values, result is absent if there are no values left
+	NullsSkip = "skip"
+	// NullsZero replaces absent values with 0
+	NullsZero = "zero"
+)
+
+// CustomAggregator defines aggregation function as a composition of a built-in one and handling of absent values,
+// e.x. {Function: "p95", Nulls: "skip"} is 95th percentile of present values
+type CustomAggregator struct {
+	Function string `mapstructure:"function"`
+	Nulls    string `mapstructure:"nulls"`
+}
+
+var customAggregators = make(map[string]func([]float64) float64)
+
+// RegisterCustomAggregator makes aggregator available by name in all places where built-in aggregation functions are
+// accepted: consolidateBy, aggregate, summarize, etc. Built-in functions can't be redefined
+func RegisterCustomAggregator(name string, a CustomAggregator) error {
+	if name == "" {
+		return fmt.Errorf("empty aggregator name")
+	}
+	if _, ok := customAggregators[name]; !ok {
+		if _, ok := ConsolidationToFunc[name]; ok || IsValidSummarizer(name) {
+			return fmt.Errorf("aggregator '%s' is built-in and can't be redefined", name)
+		}
+	}
+
+	if _, ok := customAggregators[a.Function]; ok {
+		return fmt.Errorf("aggregator '%s': function '%s' is not built-in", name, a.Function)
+	}
+	f, ok := ConsolidationToFunc[a.Function]
+	if !ok {
+		if !IsValidSummarizer(a.Function) {
+			return fmt.Errorf("aggregator '%s': unknown function '%s'", name, a.Function)
+		}
+		f = summarizeToAggregate(a.Function)
+	}
+
+	switch a.Nulls {
+	case "", NullsKeep:
+	case NullsSkip:
+		f = skipNulls(f)
+	case NullsZero:
+		f = nullsAsZero(f)
+	default:
+		return fmt.Errorf("aggregator '%s': unknown nulls handling '%s', supported: %s, %s, %s",
+			name, a.Nulls, NullsKeep, NullsSkip, NullsZero)
+	}
+
+	if _, ok := customAggregators[name]; !ok {
+		AvailableSummarizers = append(AvailableSummarizers, name)
+	}
+	customAggregators[name] = f
+	ConsolidationToFunc[name] = f
+	consolidateFuncs = nil
+	return nil
+}
+
+func skipNulls(f func([]float64) float64) func([]float64) float64 {
+	return func(values []float64) float64 {
+		present := make([]float64, 0, len(values))
+		for _, v := range values {
+			if !math.IsNaN(v) {
+				present = append(present, v)
+			}
+		}
+		if len(present) == 0 {
+			return math.NaN()
+		}
+		return f(present)
+	}
+}
+
+func nullsAsZero(f func([]float64) float64) func([]float64) float64 {
+	return func(values []float64) float64 {
+		zeroed := make([]float64, len(values))
+		for i, v := range values {
+			if !math.IsNaN(v) {
+				zeroed[i] = v
+			}
+		}
+		return f(zeroed)
+	}
+}
@@ -0,0 +1,72 @@
+package consolidations
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegisterCustomAggregator(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name       string
+		aggregator CustomAggregator
+		values     []float64
+		expected   float64
+	}{
+		{"p50_nonnull", CustomAggregator{Function: "p50", Nulls: NullsSkip}, []float64{nan, 1, nan, 3, 2}, 2},
+		{"max_keep", CustomAggregator{Function: "max"}, []float64{nan, 1, 3}, 3},
+		{"avg_nulls_zero", CustomAggregator{Function: "average", Nulls: NullsZero}, []float64{nan, 1, 3, nan}, 1},
+		{"sum_nonnull", CustomAggregator{Function: "sum", Nulls: NullsSkip}, []float64{nan, nan}, nan},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterCustomAggregator(tt.name, tt.aggregator); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !IsValidSummarizer(tt.name) {
+				t.Errorf("%s should be valid summarizer", tt.name)
+			}
+
+			for _, got := range []float64{ConsolidationToFunc[tt.name](tt.values), SummarizeValues(tt.name, tt.values)} {
+				if got != tt.expected && !(math.IsNaN(got) && math.IsNaN(tt.expected)) {
+					t.Errorf("got %v, expected %v", got, tt.expected)
+				}
+			}
+		})
+	}
+
+	found := false
+	for _, name := range AvailableConsolidationFuncs() {
+		found = found || name == "p50_nonnull"
+	}
+	if !found {
+		t.Error("custom aggregator should be listed in available consolidation functions")
+	}
+}
+
+func TestRegisterCustomAggregatorErrors(t *testing.T) {
+	if err := RegisterCustomAggregator("base", CustomAggregator{Function: "sum"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		aggregator CustomAggregator
+	}{
+		{"", CustomAggregator{Function: "sum"}},
+		{"sum", CustomAggregator{Function: "max"}},
+		{"p90", CustomAggregator{Function: "max"}},
+		{"unknown_function", CustomAggregator{Function: "unknown"}},
+		{"unknown_nulls", CustomAggregator{Function: "sum", Nulls: "drop"}},
+		{"custom_base", CustomAggregator{Function: "base"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterCustomAggregator(tt.name, tt.aggregator); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
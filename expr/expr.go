@@ -45,7 +45,29 @@ func EvalExpr(e parser.Expr, from, until int64, values map[parser.MetricRequest]
 	f, ok := metadata.FunctionMD.Functions[e.Target()]
 	metadata.FunctionMD.RUnlock()
 	if ok {
-		v, err := f.Do(e, from, until, values)
+		do := f.Do
+		if c := functionComparison; c != nil {
+			if alternate, ok := c.alternate(e.Target()); ok {
+				do = func(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+					return c.do(f, alternate, e, from, until, values)
+				}
+			}
+		}
+
+		if c := functionCache; c != nil && c.cached(e.Target()) {
+			key := c.key(e, from, until, values)
+			if v, ok := c.get(key); ok {
+				return v, nil
+			}
+			v, err := do(e, from, until, values)
+			if err != nil {
+				return v, fmt.Errorf("function=%s, err=%v", e.Target(), err)
+			}
+			c.set(key, v)
+			return v, nil
+		}
+
+		v, err := do(e, from, until, values)
 		if err != nil {
 			err = fmt.Errorf("function=%s, err=%v", e.Target(), err)
 		}
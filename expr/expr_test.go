@@ -259,6 +259,47 @@ func TestEvalExpression(t *testing.T) {
 				types.MakeMetricData("devops.service.server2.filter.received.reduce.asPercent.count", []float64{25, 100, 400}, 1, now32),
 			},
 		},
+		{
+			"reduceSeries(mapSeries(servers.*.disk.*, 1), \"asPercent(diffSeries($2, $1), $2)\", 3, \"used\", \"total\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"servers.*.disk.*", 0, 1}: {
+					types.MakeMetricData("servers.server1.disk.used", []float64{2, 4, 8}, 1, now32),
+					types.MakeMetricData("servers.server1.disk.total", []float64{8, 8, 8}, 1, now32),
+					types.MakeMetricData("servers.server2.disk.total", []float64{10, 10, 10}, 1, now32),
+					types.MakeMetricData("servers.server2.disk.used", []float64{1, 5, 9}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("servers.server1.disk.reduce.asPercent", []float64{75, 50, 0}, 1, now32),
+				types.MakeMetricData("servers.server2.disk.reduce.asPercent", []float64{90, 50, 10}, 1, now32),
+			},
+		},
+		{
+			// series of a group differ by the last node, they are grouped by mapNodes
+			"reduceSeries(mapSeries(servers.*.disk.*.*, 1), \"divideSeries\", 3, \"used\", \"total\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"servers.*.disk.*.*", 0, 1}: {
+					types.MakeMetricData("servers.server1.disk.used.bytes", []float64{2, 4, 6}, 1, now32),
+					types.MakeMetricData("servers.server1.disk.total.count", []float64{4, 8, 12}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("servers.server1.disk.reduce.divideSeries.bytes", []float64{0.5, 0.5, 0.5}, 1, now32),
+			},
+		},
+		{
+			// nested useSeriesAbove can't be rewritten, so matched series are renamed
+			"alias(useSeriesAbove(foo.*.reqs, 7, \"(foo)\\.(.*)\\.reqs\", \"\\1.\\2.time\"), \"x\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"foo.*.reqs", 0, 1}: {
+					types.MakeMetricData("foo.a.reqs", []float64{3, 4, 8}, 1, now32),
+					types.MakeMetricData("foo.b.reqs", []float64{1, 2, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("x", []float64{3, 4, 8}, 1, now32),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -358,6 +399,42 @@ func TestRewriteExpr(t *testing.T) {
 			true,
 			[]string{"foo.metric1.count", "foo.metric2.count"},
 		},
+		{
+			"useSeriesAbove",
+			parser.NewExpr("useSeriesAbove",
+
+				"foo.*.reqs",
+				7,
+				parser.ArgValue("(foo)\\.(.*)\\.reqs"),
+				parser.ArgValue("\\1.\\2.time"),
+			),
+			map[parser.MetricRequest][]*types.MetricData{
+				{"foo.*.reqs", 0, 1}: {
+					types.MakeMetricData("foo.a.reqs", []float64{3, 4, 8}, 1, now32),
+					types.MakeMetricData("foo.b.reqs", []float64{1, 2, 3}, 1, now32),
+					types.MakeMetricData("foo.c.reqs", []float64{9, 2, 3}, 1, now32),
+				},
+			},
+			true,
+			[]string{"foo.a.time", "foo.c.time"},
+		},
+		{
+			"aboveSeries with string value",
+			parser.NewExpr("aboveSeries",
+
+				"foo.*.reqs",
+				parser.ArgValue("100"),
+				parser.ArgValue("reqs"),
+				parser.ArgValue("time"),
+			),
+			map[parser.MetricRequest][]*types.MetricData{
+				{"foo.*.reqs", 0, 1}: {
+					types.MakeMetricData("foo.a.reqs", []float64{3, 4, 8}, 1, now32),
+				},
+			},
+			true,
+			[]string{},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,140 @@
+package expr
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgryski/go-expirecache"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// FunctionCache keeps results of expensive deterministic functions. Key is the function call and hash of all series
+// it consumes, so re-renders of the same time range with the same data skip recomputation, while any change of input
+// data makes a new key
+type FunctionCache struct {
+	ec        *expirecache.Cache
+	ttl       int32
+	functions map[string]struct{}
+
+	hits   int64
+	misses int64
+}
+
+// FunctionCacheStats are counters of function cache
+type FunctionCacheStats struct {
+	Hits   int64
+	Misses int64
+	Items  int
+	Size   uint64
+}
+
+var functionCache *FunctionCache
+
+// SetFunctionCache enables caching of results of functions, nil disables it. Must be called before evaluation starts
+func SetFunctionCache(c *FunctionCache) {
+	functionCache = c
+}
+
+// GetFunctionCacheStats returns counters of function cache, all zeros if cache is disabled
+func GetFunctionCacheStats() FunctionCacheStats {
+	c := functionCache
+	if c == nil {
+		return FunctionCacheStats{}
+	}
+	return FunctionCacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+		Items:  c.ec.Items(),
+		Size:   c.ec.Size(),
+	}
+}
+
+// NewFunctionCache creates cache of results of the functions, limited by maxSize bytes (approximately, by size of
+// values of cached series). Results expire after ttl seconds
+func NewFunctionCache(maxSize uint64, ttl int32, functions []string) *FunctionCache {
+	c := &FunctionCache{
+		ec:        expirecache.New(maxSize),
+		ttl:       ttl,
+		functions: make(map[string]struct{}, len(functions)),
+	}
+	for _, f := range functions {
+		c.functions[f] = struct{}{}
+	}
+	go c.ec.ApproximateCleaner(10 * time.Second)
+	return c
+}
+
+func (c *FunctionCache) cached(function string) bool {
+	_, ok := c.functions[function]
+	return ok
+}
+
+// key is the call of the function with evaluation time range and hash of series of all its path expressions. Time
+// ranges of path expressions are taken from the expression, so shifts and bootstrap windows of nested functions are
+// accounted
+func (c *FunctionCache) key(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) string {
+	h := fnv.New128a()
+	var buf [8]byte
+	writeInt := func(v int64) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		h.Write(buf[:])
+	}
+
+	for _, m := range e.Metrics() {
+		m.From += from
+		m.Until += until
+		h.Write([]byte(m.Metric))
+		writeInt(m.From)
+		writeInt(m.Until)
+		series := values[m]
+		writeInt(int64(len(series)))
+		for _, s := range series {
+			h.Write([]byte(s.Name))
+			writeInt(s.StartTime)
+			writeInt(s.StopTime)
+			writeInt(s.StepTime)
+			writeInt(int64(len(s.Values)))
+			for _, v := range s.Values {
+				binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+				h.Write(buf[:])
+			}
+		}
+	}
+
+	return e.ToString() + "&from=" + strconv.FormatInt(from, 10) + "&until=" + strconv.FormatInt(until, 10) +
+		"&data=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns copies of cached series, so callers could modify them
+func (c *FunctionCache) get(key string) ([]*types.MetricData, bool) {
+	v, ok := c.ec.Get(key)
+	if !ok {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return types.UnpackSeriesList(v.([]types.PackedSeries)), true
+}
+
+func (c *FunctionCache) set(key string, results []*types.MetricData) {
+	packed := types.PackSeriesList(results)
+	var size uint64
+	for _, p := range packed {
+		size += p.Size()
+	}
+	c.ec.Set(key, packed, size, c.ttl)
+}
+
+func copySeries(series []*types.MetricData) []*types.MetricData {
+	res := make([]*types.MetricData, len(series))
+	for i, s := range series {
+		res[i] = s.CopyData()
+	}
+	return res
+}
@@ -0,0 +1,63 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+func TestFunctionCache(t *testing.T) {
+	SetFunctionCache(NewFunctionCache(1024*1024, 60, []string{"summarize"}))
+	defer SetFunctionCache(nil)
+
+	exp, _, err := parser.ParseExpr("summarize(metric1,'2s','sum')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, until := int64(0), int64(6)
+	request := parser.MetricRequest{Metric: "metric1", From: from, Until: until}
+	values := map[parser.MetricRequest][]*types.MetricData{
+		request: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, 0)},
+	}
+
+	eval := func() []float64 {
+		res, err := EvalExpr(exp, from, until, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 {
+			t.Fatalf("expected 1 series, got %d", len(res))
+		}
+		return res[0].Values
+	}
+	assertValues := func(got, want []float64) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+	}
+
+	first := eval()
+	assertValues(first, []float64{3, 7, 11})
+	// cached series are copied, so changes of results don't affect the cache
+	first[0] = 100
+	assertValues(eval(), []float64{3, 7, 11})
+	stats := GetFunctionCacheStats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Items != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// new data makes a new key
+	values[request] = []*types.MetricData{types.MakeMetricData("metric1", []float64{1, 1, 1, 1, 1, 1}, 1, 0)}
+	assertValues(eval(), []float64{2, 2, 2})
+	stats = GetFunctionCacheStats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Items != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
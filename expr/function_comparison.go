@@ -0,0 +1,167 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+// FunctionComparison evaluates calls of functions by both current and alternate implementations (registered by
+// metadata.RegisterAlternateFunction) and logs discrepancies of results. Results of the current implementation are
+// returned anyway
+type FunctionComparison struct {
+	functions map[string]struct{}
+	tolerance float64
+
+	comparisons int64
+	mismatches  int64
+	errors      int64
+}
+
+// FunctionComparisonStats are counters of function comparison. Errors are failures of alternate implementations
+// (including panics) of calls that current implementations evaluated successfully, they are mismatches too
+type FunctionComparisonStats struct {
+	Comparisons int64
+	Mismatches  int64
+	Errors      int64
+}
+
+var functionComparison *FunctionComparison
+
+// SetFunctionComparison enables comparison of functions, nil disables it. Must be called before evaluation starts
+func SetFunctionComparison(c *FunctionComparison) {
+	functionComparison = c
+}
+
+// GetFunctionComparisonStats returns counters of function comparison, all zeros if comparison is disabled
+func GetFunctionComparisonStats() FunctionComparisonStats {
+	c := functionComparison
+	if c == nil {
+		return FunctionComparisonStats{}
+	}
+	return FunctionComparisonStats{
+		Comparisons: atomic.LoadInt64(&c.comparisons),
+		Mismatches:  atomic.LoadInt64(&c.mismatches),
+		Errors:      atomic.LoadInt64(&c.errors),
+	}
+}
+
+// NewFunctionComparison creates comparison of the functions. Values are equal if they differ not more than tolerance,
+// relatively to the greater one, or absolutely if both are less than 1
+func NewFunctionComparison(functions []string, tolerance float64) *FunctionComparison {
+	c := &FunctionComparison{
+		functions: make(map[string]struct{}, len(functions)),
+		tolerance: tolerance,
+	}
+	for _, f := range functions {
+		c.functions[f] = struct{}{}
+	}
+	return c
+}
+
+// alternate returns alternate implementation of the function, if it should be compared
+func (c *FunctionComparison) alternate(function string) (interfaces.Function, bool) {
+	if _, ok := c.functions[function]; !ok {
+		return nil, false
+	}
+	metadata.FunctionMD.RLock()
+	f, ok := metadata.FunctionMD.AlternateFunctions[function]
+	metadata.FunctionMD.RUnlock()
+	return f, ok
+}
+
+// do evaluates the call by both implementations. Alternate one is evaluated first over copies of input series, so
+// changes of inputs by any of them don't affect the other
+func (c *FunctionComparison) do(f, alternate interfaces.Function, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	copied := make(map[parser.MetricRequest][]*types.MetricData, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	for _, m := range e.Metrics() {
+		m.From += from
+		m.Until += until
+		if series, ok := values[m]; ok {
+			copied[m] = copySeries(series)
+		}
+	}
+	alternateResults, alternateErr := c.doAlternate(alternate, e, from, until, copied)
+
+	results, err := f.Do(e, from, until, values)
+
+	atomic.AddInt64(&c.comparisons, 1)
+	if err == nil && alternateErr != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+	var reason string
+	switch {
+	case (err == nil) != (alternateErr == nil):
+		reason = fmt.Sprintf("error %v vs %v", err, alternateErr)
+	case err == nil:
+		reason = c.compare(results, alternateResults)
+	}
+	if reason != "" {
+		atomic.AddInt64(&c.mismatches, 1)
+		zapwriter.Logger("functionComparison").Warn("alternate implementation of function returned different results",
+			zap.String("function", e.Target()),
+			zap.String("target", e.ToString()),
+			zap.Int64("from", from),
+			zap.Int64("until", until),
+			zap.String("reason", reason),
+		)
+	}
+	return results, err
+}
+
+// doAlternate evaluates the call by alternate implementation, recovering from its panics
+func (c *FunctionComparison) doAlternate(alternate interfaces.Function, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (results []*types.MetricData, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return alternate.Do(e, from, until, values)
+}
+
+// compare returns description of the first discrepancy of results, empty string if they are equal
+func (c *FunctionComparison) compare(current, alternate []*types.MetricData) string {
+	if len(current) != len(alternate) {
+		return fmt.Sprintf("%d series vs %d", len(current), len(alternate))
+	}
+	for i, s := range current {
+		a := alternate[i]
+		switch {
+		case s.Name != a.Name:
+			return fmt.Sprintf("series %d: name '%s' vs '%s'", i, s.Name, a.Name)
+		case s.StepTime != a.StepTime:
+			return fmt.Sprintf("series '%s': step %d vs %d", s.Name, s.StepTime, a.StepTime)
+		case s.StartTime != a.StartTime:
+			return fmt.Sprintf("series '%s': start %d vs %d", s.Name, s.StartTime, a.StartTime)
+		case len(s.Values) != len(a.Values):
+			return fmt.Sprintf("series '%s': %d points vs %d", s.Name, len(s.Values), len(a.Values))
+		}
+		for j, v := range s.Values {
+			if !c.equal(v, a.Values[j]) {
+				return fmt.Sprintf("series '%s': value at %d %v vs %v", s.Name, s.StartTime+int64(j)*s.StepTime, v, a.Values[j])
+			}
+		}
+	}
+	return ""
+}
+
+func (c *FunctionComparison) equal(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	if a == b {
+		return true
+	}
+	scale := math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+	return math.Abs(a-b) <= c.tolerance*scale
+}
@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// alternateFunction is an implementation of summarize under test, that damages its input
+type alternateFunction struct {
+	interfaces.FunctionBase
+	do func(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error)
+}
+
+func (f *alternateFunction) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	res, err := f.do(e, from, until, values)
+	for _, series := range values {
+		for _, s := range series {
+			s.Values[0] = 1000
+		}
+	}
+	return res, err
+}
+
+func (f *alternateFunction) Description() map[string]types.FunctionDescription {
+	return nil
+}
+
+func TestFunctionComparison(t *testing.T) {
+	SetFunctionComparison(NewFunctionComparison([]string{"summarize"}, 0.01))
+	defer SetFunctionComparison(nil)
+	current := metadata.FunctionMD.Functions["summarize"]
+	alternate := &alternateFunction{}
+	metadata.RegisterAlternateFunction("summarize", alternate)
+	defer func() {
+		metadata.FunctionMD.Lock()
+		delete(metadata.FunctionMD.AlternateFunctions, "summarize")
+		metadata.FunctionMD.Unlock()
+	}()
+
+	request := parser.MetricRequest{Metric: "metric1", From: 0, Until: 6}
+	eval := func(target string, alternateDo func(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error)) []float64 {
+		t.Helper()
+		alternate.do = alternateDo
+		exp, _, err := parser.ParseExpr(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := map[parser.MetricRequest][]*types.MetricData{
+			request: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, 0)},
+		}
+		res, err := EvalExpr(exp, 0, 6, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 {
+			t.Fatalf("expected 1 series, got %d", len(res))
+		}
+		return res[0].Values
+	}
+	assertStats := func(want FunctionComparisonStats) {
+		t.Helper()
+		if got := GetFunctionComparisonStats(); got != want {
+			t.Fatalf("expected stats %+v, got %+v", want, got)
+		}
+	}
+
+	// the same implementation, changes of inputs by alternate one don't affect the current one
+	if got := eval("summarize(metric1,'2s','sum')", current.Do); got[0] != 3 {
+		t.Fatalf("unexpected result %v", got)
+	}
+	assertStats(FunctionComparisonStats{Comparisons: 1})
+
+	// differences within tolerance are ignored
+	eval("summarize(metric1,'2s','sum')", func(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+		return []*types.MetricData{types.MakeMetricData("summarize(metric1,'2s','sum')", []float64{3, 7.01, 11}, 2, 0)}, nil
+	})
+	assertStats(FunctionComparisonStats{Comparisons: 2})
+
+	eval("summarize(metric1,'2s','sum')", func(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+		return []*types.MetricData{types.MakeMetricData("summarize(metric1,'2s','sum')", []float64{3, 8, 11}, 2, 0)}, nil
+	})
+	assertStats(FunctionComparisonStats{Comparisons: 3, Mismatches: 1})
+
+	// results of the current implementation are returned even if alternate one panics
+	got := eval("summarize(metric1,'2s','sum')", func(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+		panic("not implemented")
+	})
+	if len(got) != 3 || got[1] != 7 {
+		t.Fatalf("unexpected result %v", got)
+	}
+	assertStats(FunctionComparisonStats{Comparisons: 4, Mismatches: 2, Errors: 1})
+
+	// functions that are not listed are not compared
+	eval("scale(metric1,2)", current.Do)
+	assertStats(FunctionComparisonStats{Comparisons: 4, Mismatches: 2, Errors: 1})
+}
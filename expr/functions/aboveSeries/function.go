@@ -2,6 +2,7 @@ package aboveSeries
 
 import (
 	"regexp"
+	"strconv"
 
 	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/helper"
@@ -28,55 +29,76 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-func (f *aboveSeries) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+// Filter returns series which maximum is greater than value and function that applies search and replace to their
+// names. It's shared with rewrite function, that fetches related series by replaced names
+func Filter(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, func(name string) string, error) {
 	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	// graphite-web accepts value as a string
 	max, err := e.GetFloatArg(1)
 	if err != nil {
-		return nil, err
+		s, errStr := e.GetStringArg(1)
+		if errStr != nil {
+			return nil, nil, err
+		}
+		max, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, nil, parser.ErrBadType
+		}
 	}
 
-	rename := true
 	search, err := e.GetStringArg(2)
 	if err != nil {
-		rename = false
+		return nil, nil, err
 	}
 
 	replace, err := e.GetStringArg(3)
 	if err != nil {
-		rename = false
+		return nil, nil, err
 	}
 
-	var rre *regexp.Regexp
-	if rename {
-		rre, err = regexp.Compile(search)
-		if err != nil {
-			return nil, err
-		}
+	rre, err := regexp.Compile(search)
+	if err != nil {
+		return nil, nil, err
 	}
+	replace = helper.RegexpReplacement(replace)
 
 	var results []*types.MetricData
 	for _, a := range args {
 		if consolidations.MaxValue(a.Values) > max {
-			r := *a
-			if rename {
-				r.Name = rre.ReplaceAllString(r.Name, replace)
-			}
-			results = append(results, &r)
+			results = append(results, a)
 		}
 	}
+	return results, func(name string) string { return rre.ReplaceAllString(name, replace) }, nil
+}
 
+// useSeriesAbove(seriesList, value, search, replace)
+// If the function is the outermost one, it's evaluated by rewrite function, that fetches related series. Nested
+// calls can't fetch anything, so matched series are renamed
+func (f *aboveSeries) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, rename, err := Filter(e, from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*types.MetricData, 0, len(args))
+	for _, a := range args {
+		r := *a
+		r.Name = rename(a.Name)
+		results = append(results, &r)
+	}
 	return results, nil
 }
 
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
 func (f *aboveSeries) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"useSeriesAbove": {
 			Name:        "useSeriesAbove",
-			Description: "Takes a seriesList and compares the maximum of each series against the given value. If the series maximum is greater than value, the regular expression search and replace is applied against the series name to plot a related metric e.g. given useSeriesAbove(ganglia.metric1.reqs,10,’reqs’,’time’), the response time metric will be plotted only when the maximum value of the corresponding request/s metric is > 10\n\nShort form: aboveSeries()",
+			Description: "Takes a seriesList and compares the maximum of each series against the given value. If the series maximum is greater than value, the regular expression search and replace is applied against the series name to plot a related metric e.g. given useSeriesAbove(ganglia.metric1.reqs,10,’reqs’,’time’), the response time metric will be plotted only when the maximum value of the corresponding request/s metric is > 10\n\nIn carbonapi related metrics are fetched only if the function is the outermost one, otherwise matched series are renamed.\n\nShort form: aboveSeries()",
 			Function:    "useSeriesAbove(seriesList, value, search, replace)",
 			Group:       "Filter Series",
 			Module:      "graphite.render.functions",
@@ -89,15 +111,17 @@ func (f *aboveSeries) Description() map[string]types.FunctionDescription {
 				{
 					Name:     "value",
 					Required: true,
-					Type:     types.Integer,
+					Type:     types.String,
 				},
 				{
-					Name: "search",
-					Type: types.String,
+					Name:     "search",
+					Required: true,
+					Type:     types.String,
 				},
 				{
-					Name: "replace",
-					Type: types.String,
+					Name:     "replace",
+					Required: true,
+					Type:     types.String,
 				},
 			},
 		},
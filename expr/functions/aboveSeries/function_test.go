@@ -52,6 +52,18 @@ func TestDiffSeries(t *testing.T) {
 				types.MakeMetricData("metricHomyak", []float64{4, 4, 5, 5, 6, 8}, 1, now32),
 			},
 		},
+		{
+			`useSeriesAbove(foo.*.reqs, "7", "(foo)\.(.*)\.reqs", "\1.\2.time")`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"foo.*.reqs", 0, 1}: {
+					types.MakeMetricData("foo.a.reqs", []float64{3, 4, 8}, 1, now32),
+					types.MakeMetricData("foo.b.reqs", []float64{1, 2, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("foo.a.time", []float64{3, 4, 8}, 1, now32),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -29,7 +29,7 @@ func (f *alias) Do(e parser.Expr, from, until int64, values map[parser.MetricReq
 	if err != nil {
 		return nil, err
 	}
-	alias, err := e.GetStringArg(1)
+	alias, err := helper.GetSeriesStringArg(e, 1)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +38,7 @@ func (f *alias) Do(e parser.Expr, from, until int64, values map[parser.MetricReq
 
 	for _, a := range arg {
 		r := *a
-		r.Name = alias
+		r.Name = alias(a)
 		results = append(results, &r)
 	}
 	return results, nil
@@ -48,7 +48,7 @@ func (f *alias) Do(e parser.Expr, from, until int64, values map[parser.MetricReq
 func (f *alias) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"alias": {
-			Description: "Takes one metric or a wildcard seriesList and a string in quotes.\nPrints the string instead of the metric name in the legend.\n\n.. code-block:: none\n\n  &target=alias(Sales.widgets.largeBlue,\"Large Blue Widgets\")",
+			Description: "Takes one metric or a wildcard seriesList and a string in quotes.\nPrints the string instead of the metric name in the legend.\n\n.. code-block:: none\n\n  &target=alias(Sales.widgets.largeBlue,\"Large Blue Widgets\")\n\nIn carbonapi newName may also be node(*nodes) or tag(name), that are resolved for each series:\n\n.. code-block:: none\n\n  &target=alias(Sales.widgets.*,node(2))",
 			Function:    "alias(seriesList, newName)",
 			Group:       "Alias",
 			Module:      "graphite.render.functions",
@@ -60,9 +60,10 @@ func (f *alias) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "newName",
-					Required: true,
-					Type:     types.String,
+					Name:      "newName",
+					Required:  true,
+					Type:      types.String,
+					PerSeries: true,
 				},
 			},
 		},
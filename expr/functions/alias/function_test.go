@@ -33,6 +33,27 @@ func TestAlias(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("renamed",
 				[]float64{1, 2, 3, 4, 5}, 1, now32)},
 		},
+		{
+			"alias(metric1.*.qux,node(1,-1))",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1.*.qux", 0, 1}: {
+					types.MakeMetricData("metric1.foo.qux", []float64{1, 2, 3, 4, 5}, 1, now32),
+					types.MakeMetricData("metric1.bar.qux", []float64{6, 7, 8, 9, 10}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("foo.qux", []float64{1, 2, 3, 4, 5}, 1, now32),
+				types.MakeMetricData("bar.qux", []float64{6, 7, 8, 9, 10}, 1, now32),
+			},
+		},
+		{
+			"alias(metric1,tag(\"dc\"))",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1;dc=us", []float64{1, 2, 3, 4, 5}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("us",
+				[]float64{1, 2, 3, 4, 5}, 1, now32)},
+		},
 	}
 
 	for _, tt := range tests {
@@ -43,3 +64,18 @@ func TestAlias(t *testing.T) {
 	}
 
 }
+
+func TestAliasBadArg(t *testing.T) {
+	for _, target := range []string{"alias(metric1,node(\"x\"))", "alias(metric1,sumSeries(metric2))", "alias(metric1)"} {
+		exp, _, err := parser.ParseExpr(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := map[parser.MetricRequest][]*types.MetricData{
+			{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1}, 1, 0)},
+		}
+		if _, err := metadata.FunctionMD.Functions["alias"].Do(exp, 0, 1, values); err == nil {
+			t.Errorf("%s: error expected", target)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package aliasFormat
+
+import (
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type aliasFormat struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &aliasFormat{}
+	for _, n := range []string{"aliasFormat"} {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// aliasFormat(seriesList, template)
+func (f *aliasFormat) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := e.GetStringArg(1)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := helper.ParseNameTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*types.MetricData
+	for _, a := range args {
+		r := *a
+		r.Name, err = tmpl.Execute(a)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &r)
+	}
+	return results, nil
+}
+
+func (f *aliasFormat) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"aliasFormat": {
+			Description: "Sets series names generated by template in Go text/template syntax. Template can reference:\n\n.. code-block:: none\n\n  {{.Name}}              name of the series\n  {{.Node 2}}            node of the metric name, negative nodes are counted from the end\n  {{.Tag \"dc\"}}          tag value, \"name\" is the metric name\n  {{.Value \"max\"}}       values reduced by consolidation function, e.x. avg, last, p95\n  {{.Sub \"re\" \"\\1\"}}     name after regexp replacement, like aliasSub\n\nMissing nodes and tags are empty strings, values could be formatted by printf. Template should be in single quotes, so double quotes could be used inside.\n\n.. code-block:: none\n\n  &target=aliasFormat(servers.*.cpu, '{{.Node 1}} - {{.Tag \"dc\"}}: {{printf \"%.1f\" (.Value \"avg\")}}')",
+			Function:    "aliasFormat(seriesList, template)",
+			Group:       "Alias",
+			Module:      "graphite.render.functions.custom",
+			Name:        "aliasFormat",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "template",
+					Required: true,
+					Type:     types.String,
+				},
+			},
+		},
+	}
+}
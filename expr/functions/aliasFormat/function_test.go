@@ -0,0 +1,92 @@
+package aliasFormat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestAliasFormat(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			`aliasFormat(servers.*.cpu, "{{.Node 1}} - {{.Node -1}}")`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"servers.*.cpu", 0, 1}: {
+					types.MakeMetricData("servers.host1.cpu", []float64{1, 2, 3}, 1, now32),
+					types.MakeMetricData("servers.host2.cpu", []float64{4, 5, 6}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("host1 - cpu", []float64{1, 2, 3}, 1, now32),
+				types.MakeMetricData("host2 - cpu", []float64{4, 5, 6}, 1, now32),
+			},
+		},
+		{
+			`aliasFormat(cpu, '{{.Tag "name"}}@{{.Tag "dc"}}{{.Tag "missing"}}')`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"cpu", 0, 1}: {types.MakeMetricData("cpu;dc=us", []float64{1, 2, 3}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("cpu@us", []float64{1, 2, 3}, 1, now32)},
+		},
+		{
+			`aliasFormat(metric1, 'max={{.Value "max"}} p50={{printf "%.1f" (.Value "p50")}}')`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 4}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("max=4 p50=2.0", []float64{1, 2, 4}, 1, now32)},
+		},
+		{
+			`aliasFormat(metric1.TCP100, 'port {{.Sub "^.*TCP(\\d+)" "\\1"}}')`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1.TCP100", 0, 1}: {types.MakeMetricData("metric1.TCP100", []float64{1, 2, 3}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("port 100", []float64{1, 2, 3}, 1, now32)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
+
+func TestAliasFormatErrors(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+	values := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32)},
+	}
+
+	for _, target := range []string{
+		`aliasFormat(metric1, "{{.Node")`,
+		`aliasFormat(metric1, '{{.Value "unknown"}}')`,
+		`aliasFormat(metric1, "{{.Unknown}}")`,
+	} {
+		exp, _, err := parser.ParseExpr(target)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", target, err)
+		}
+		_, err = metadata.GetEvaluator().EvalExpr(exp, 0, 1, values)
+		if err == nil {
+			t.Errorf("%s: expected error", target)
+		}
+	}
+}
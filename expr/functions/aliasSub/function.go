@@ -47,7 +47,7 @@ func (f *aliasSub) Do(e parser.Expr, from, until int64, values map[parser.Metric
 		return nil, err
 	}
 
-	replace = helper.Backref.ReplaceAllString(replace, "$${$1}")
+	replace = helper.RegexpReplacement(replace)
 
 	var results []*types.MetricData
 
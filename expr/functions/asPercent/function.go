@@ -47,6 +47,10 @@ func (f *asPercent) Do(e parser.Expr, from, until int64, values map[parser.Metri
 	var results []*types.MetricData
 
 	if len(e.Args()) == 1 {
+		arg, err = helper.NormalizeSteps(arg)
+		if err != nil {
+			return nil, err
+		}
 		getTotal = func(i int) float64 {
 			var t float64
 			var atLeastOne bool
@@ -84,6 +88,11 @@ func (f *asPercent) Do(e parser.Expr, from, until int64, values map[parser.Metri
 		if len(total) != 1 && len(total) != len(arg) {
 			return nil, types.ErrWildcardNotAllowed
 		}
+		normalized, err := helper.NormalizeSteps(append(append([]*types.MetricData{}, arg...), total...))
+		if err != nil {
+			return nil, err
+		}
+		arg, total = normalized[:len(arg)], normalized[len(arg):]
 		if len(total) == 1 {
 			getTotal = func(i int) float64 {
 				return total[0].Values[i]
@@ -3,6 +3,7 @@
 package cairo
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -72,6 +73,22 @@ func TestEvalExpressionGraph(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("fourty-two-aurum",
 				[]float64{42.42, 42.42}, 1, now32)},
 		},
+		{
+			"stacked(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, math.NaN(), 3}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("stacked(metric1)",
+				[]float64{1, math.NaN(), 3}, 1, now32)},
+		},
+		{
+			"stacked(metric1,'tx')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, math.NaN(), 3}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("metric1",
+				[]float64{1, math.NaN(), 3}, 1, now32)},
+		},
 	}
 
 	for _, tt := range tests {
@@ -59,33 +59,6 @@ const (
 	Day             = 24 * Hour
 )
 
-type unitPrefix struct {
-	prefix string
-	size   uint64
-}
-
-const (
-	unitSystemBinary = "binary"
-	unitSystemSI     = "si"
-)
-
-var unitSystems = map[string][]unitPrefix{
-	unitSystemBinary: {
-		{"Pi", 1125899906842624}, // 1024^5
-		{"Ti", 1099511627776},    // 1024^4
-		{"Gi", 1073741824},       // 1024^3
-		{"Mi", 1048576},          // 1024^2
-		{"Ki", 1024},
-	},
-	unitSystemSI: {
-		{"P", 1000000000000000}, // 1000^5
-		{"T", 1000000000000},    // 1000^4
-		{"G", 1000000000},       // 1000^3
-		{"M", 1000000},          // 1000^2
-		{"K", 1000},
-	},
-}
-
 type xAxisStruct struct {
 	seconds       float64
 	minorGridUnit TimeUnit
@@ -422,6 +395,12 @@ type Params struct {
 	connectedLimit int
 	hasStack       bool
 
+	graphType        string
+	valueLabels      string
+	valueLabelsMin   float64
+	valueLabelsColor color.RGBA
+	pieLabels        string
+
 	yMin   float64
 	yMax   float64
 	xMin   float64
@@ -437,6 +416,8 @@ type Params struct {
 	graphWidth     float64
 	yScaleFactor   float64
 	yUnitSystem    string
+	yUnitSystemL   string
+	yUnitSystemR   string
 	yDivisors      []float64
 	yLabelValues   []float64
 	yLabels        []string
@@ -492,6 +473,8 @@ type Params struct {
 	secondYAxis    bool
 	drawNullAsZero bool
 	drawAsInfinite bool
+	legendValues   []string
+	humanize       string
 
 	xConf xAxisStruct
 }
@@ -707,6 +690,10 @@ func EvalExprGraph(e parser.Expr, from, until int64, values map[parser.MetricReq
 
 		for _, a := range arg {
 			r := *a
+			// graphite-web renames series only for default stack, so legend can be set for named ones
+			if stackName == types.DefaultStackName {
+				r.Name = fmt.Sprintf("stacked(%s)", a.Name)
+			}
 			r.Stacked = true
 			r.StackName = stackName
 			results = append(results, &r)
@@ -925,12 +912,20 @@ func marshalCairo(p PictureParams, results []*types.MetricData, backend cairoBac
 		colorList: p.ColorList,
 		isPng:     true,
 
+		graphType:        p.GraphType,
+		valueLabels:      p.ValueLabels,
+		valueLabelsMin:   p.ValueLabelsMin,
+		valueLabelsColor: string2RGBA(p.ValueLabelsColor),
+		pieLabels:        p.PieLabels,
+
 		majorGridLineColor: p.MajorGridLineColor,
 		minorGridLineColor: p.MinorGridLineColor,
 
 		uniqueLegend:   p.UniqueLegend,
 		drawNullAsZero: p.DrawNullAsZero,
 		drawAsInfinite: p.DrawAsInfinite,
+		legendValues:   p.LegendValues,
+		humanize:       p.Humanize,
 		yMin:           p.YMin,
 		yMax:           p.YMax,
 		yStep:          p.YStep,
@@ -952,6 +947,7 @@ func marshalCairo(p PictureParams, results []*types.MetricData, backend cairoBac
 		yUnitSystem: p.YUnitSystem,
 		yDivisors:   p.YDivisors,
 	}
+	params.yUnitSystemL, params.yUnitSystemR = p.yUnitSystems()
 
 	margin := float64(params.margin)
 	params.area.xmin = margin + 10
@@ -986,7 +982,11 @@ func marshalCairo(p PictureParams, results []*types.MetricData, backend cairoBac
 	setColor(cr, params.bgColor)
 	drawRectangle(cr, &params, 0, 0, params.width, params.height, true)
 
-	drawGraph(cr, &params, results)
+	if params.graphType == graphTypePie {
+		drawPie(cr, &params, results)
+	} else {
+		drawGraph(cr, &params, results)
+	}
 
 	surface.Flush()
 
@@ -1041,13 +1041,7 @@ func drawGraph(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 	params.timeRange = params.endTime - params.startTime
 
 	if params.timeRange <= 0 {
-		x := params.width / 2.0
-		y := params.height / 2.0
-		setColor(cr, string2RGBA("red"))
-		fontSize := math.Log(params.width * params.height)
-		setFont(cr, params, fontSize)
-		drawText(cr, params, "No Data", x, y, HAlignCenter, VAlignTop, 0)
-
+		drawNoData(cr, params)
 		return
 	}
 
@@ -1131,8 +1125,13 @@ func drawGraph(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 	}
 
 	setFont(cr, params, params.fontSize)
+	var legend *legendTable
 	if !params.hideLegend {
-		drawLegend(cr, params, results)
+		if len(params.legendValues) > 0 {
+			legend = reserveLegendTable(params, results)
+		} else {
+			drawLegend(cr, params, results)
+		}
 	}
 
 	// Setup axes, labels and grid
@@ -1163,10 +1162,14 @@ func drawGraph(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 		}
 	}
 
-	// check if we need to stack all the things
+	// check if we need to stack all the things. Series with empty StackName (areaMode=first or all) are only filled,
+	// but not stacked
 	if params.areaMode == AreaModeStacked {
 		params.hasStack = true
 		for _, r := range results {
+			if r.DrawAsInfinite {
+				continue
+			}
 			r.Stacked = true
 			r.StackName = "stack"
 		}
@@ -1174,7 +1177,9 @@ func drawGraph(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 		results[0].Stacked = true
 	} else if params.areaMode == AreaModeAll {
 		for _, r := range results {
-			r.Stacked = true
+			if !r.DrawAsInfinite {
+				r.Stacked = true
+			}
 		}
 	}
 
@@ -1182,8 +1187,12 @@ func drawGraph(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 		sort.Stable(ByStacked(results))
 		// perform all aggregations / summations up so the rest of the graph drawing code doesn't need to care
 
-		var stackName = results[0].StackName
-		var total []float64
+		// left and right Y axes have different scales, so their series are stacked separately
+		type stackKey struct {
+			name        string
+			secondYAxis bool
+		}
+		totals := make(map[stackKey][]float64)
 		for _, r := range results {
 			if r.DrawAsInfinite {
 				continue
@@ -1194,23 +1203,25 @@ func drawGraph(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 				break
 			}
 
-			if r.StackName != stackName {
-				// got to a new named stack -- reset accumulator
-				total = total[:0]
-				stackName = r.StackName
+			if r.StackName == "" {
+				continue
 			}
 
+			key := stackKey{r.StackName, params.secondYAxis && r.SecondYAxis}
+			total := totals[key]
 			vals := r.AggregatedValues()
 			for i, v := range vals {
 				if len(total) <= i {
 					total = append(total, 0)
 				}
 
+				// gaps are kept as is and don't affect the total, like in graphite-web
 				if !math.IsNaN(v) {
 					vals[i] += total[i]
 					total[i] += v
 				}
 			}
+			totals[key] = total
 
 			// replace the values for the metric with our newly calculated ones
 			// since these are now post-aggregation, reset the valuesPerPoint
@@ -1251,6 +1262,106 @@ func drawGraph(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 	}
 
 	drawLines(cr, params, results)
+
+	if legend != nil {
+		drawLegendTable(cr, params, legend)
+	}
+}
+
+func drawNoData(cr *cairoSurfaceContext, params *Params) {
+	x := params.width / 2.0
+	y := params.height / 2.0
+	setColor(cr, string2RGBA("red"))
+	fontSize := math.Log(params.width * params.height)
+	setFont(cr, params, fontSize)
+	drawText(cr, params, "No Data", x, y, HAlignCenter, VAlignTop, 0)
+}
+
+// drawPie draws pie chart, where each series is represented by a slice proportional to its value reduced by pieMode
+func drawPie(cr *cairoSurfaceContext, params *Params, results []*types.MetricData) {
+	slices := makePieSlices(results, params.pieMode)
+	var hasData bool
+	for _, s := range slices {
+		hasData = hasData || s.percent > 0
+	}
+	if !hasData {
+		drawNoData(cr, params)
+		return
+	}
+
+	var colorsCur int
+	for _, res := range results {
+		if res.Color != "" {
+			continue
+		}
+		res.Color = params.colorList[colorsCur]
+		colorsCur++
+		if colorsCur >= len(params.colorList) {
+			colorsCur = 0
+		}
+	}
+
+	if params.title != "" {
+		titleSize := params.fontSize + math.Floor(math.Log(params.fontSize))
+		setColor(cr, params.fgColor)
+		setFont(cr, params, titleSize)
+		drawTitle(cr, params)
+	}
+
+	setFont(cr, params, params.fontSize)
+	if !params.hideLegend {
+		drawLegend(cr, params, results)
+	}
+
+	x0 := (params.area.xmin + params.area.xmax) / 2
+	y0 := (params.area.ymin + params.area.ymax) / 2
+	radius := math.Min(params.area.xmax-params.area.xmin, params.area.ymax-params.area.ymin) / 2
+	if radius <= 0 {
+		return
+	}
+
+	// slices are drawn clockwise starting from the top
+	midAngles := make([]float64, len(slices))
+	theta := 1.5 * math.Pi
+	for i, s := range slices {
+		if s.percent <= 0 {
+			continue
+		}
+		phi := theta + 2*math.Pi*s.percent
+		setColor(cr, string2RGBA(s.series.Color))
+		cr.context.MoveTo(x0, y0)
+		cr.context.Arc(x0, y0, radius, theta, phi)
+		cr.context.LineTo(x0, y0)
+		cr.context.ClosePath()
+		cr.context.Fill()
+		midAngles[i] = (theta + phi) / 2
+		theta = phi
+	}
+
+	if params.valueLabels == valueLabelsNone {
+		return
+	}
+
+	setColor(cr, params.valueLabelsColor)
+	for i, s := range slices {
+		label := makePieLabel(s, params.valueLabels, params.valueLabelsMin)
+		if label == "" || s.percent <= 0 {
+			continue
+		}
+		angle := math.Mod(midAngles[i], 2*math.Pi)
+		x := x0 + math.Cos(angle)*radius*0.7
+		y := y0 + math.Sin(angle)*radius*0.7
+
+		var rotate float64
+		if params.pieLabels == pieLabelsRotated {
+			rotate = angle * 180 / math.Pi
+			// keep text readable on the left half of the pie
+			if angle > math.Pi/2 && angle < 1.5*math.Pi {
+				rotate -= 180
+			}
+		}
+		drawText(cr, params, label, x, y, HAlignCenter, VAlignCenter, rotate)
+	}
 }
 
 func consolidateDataPoints(params *Params, results []*types.MetricData) {
@@ -1419,7 +1530,7 @@ func setupTwoYAxes(cr *cairoSurfaceContext, params *Params, results []*types.Met
 
 	var orderL float64
 	var orderFactorL float64
-	if params.yUnitSystem == unitSystemBinary {
+	if params.yUnitSystemL == types.UnitSystemBinary {
 		orderL = math.Log2(yVarianceL)
 		orderFactorL = math.Pow(2, math.Floor(orderL))
 	} else {
@@ -1429,7 +1540,7 @@ func setupTwoYAxes(cr *cairoSurfaceContext, params *Params, results []*types.Met
 
 	var orderR float64
 	var orderFactorR float64
-	if params.yUnitSystem == unitSystemBinary {
+	if params.yUnitSystemR == types.UnitSystemBinary {
 		orderR = math.Log2(yVarianceR)
 		orderFactorR = math.Pow(2, math.Floor(orderR))
 	} else {
@@ -1482,14 +1593,8 @@ func setupTwoYAxes(cr *cairoSurfaceContext, params *Params, results []*types.Met
 	params.yTopR = params.yStepR * math.Ceil(yMaxValueR/params.yStepR)
 
 	if params.logBase != 0 {
-		if yMinValueL > 0 && yMinValueR > 0 {
-			params.yBottomL = math.Pow(params.logBase, math.Floor(math.Log(yMinValueL)/math.Log(params.logBase)))
-			params.yTopL = math.Pow(params.logBase, math.Ceil(math.Log(yMaxValueL/math.Log(params.logBase))))
-			params.yBottomR = math.Pow(params.logBase, math.Floor(math.Log(yMinValueR)/math.Log(params.logBase)))
-			params.yTopR = math.Pow(params.logBase, math.Ceil(math.Log(yMaxValueR/math.Log(params.logBase))))
-		} else {
-			panic("logscale with minvalue <= 0")
-		}
+		params.yBottomL, params.yTopL = logAxisBounds(params.logBase, yMinValueL, yMaxValueL, minPositiveValue(Ldata))
+		params.yBottomR, params.yTopR = logAxisBounds(params.logBase, yMinValueR, yMaxValueR, minPositiveValue(Rdata))
 	}
 
 	if !math.IsNaN(params.yMaxLeft) {
@@ -1526,12 +1631,12 @@ func setupTwoYAxes(cr *cairoSurfaceContext, params *Params, results []*types.Met
 
 	params.yLabelsL = make([]string, len(params.yLabelValuesL))
 	for i, v := range params.yLabelValuesL {
-		params.yLabelsL[i] = makeLabel(v, params.yStepL, params.ySpanL, params.yUnitSystem)
+		params.yLabelsL[i] = makeLabel(v, params.yStepL, params.ySpanL, params.yUnitSystemL)
 	}
 
 	params.yLabelsR = make([]string, len(params.yLabelValuesR))
 	for i, v := range params.yLabelValuesR {
-		params.yLabelsR[i] = makeLabel(v, params.yStepR, params.ySpanR, params.yUnitSystem)
+		params.yLabelsR[i] = makeLabel(v, params.yStepR, params.ySpanR, params.yUnitSystemR)
 	}
 
 	params.yLabelWidthL = 0
@@ -1573,8 +1678,8 @@ func (d divisorInfo) Less(i int, j int) bool { return d[i].diff < d[j].diff }
 func (d divisorInfo) Swap(i int, j int)      { d[i], d[j] = d[j], d[i] }
 
 func makeLabel(yValue, yStep, ySpan float64, yUnitSystem string) string {
-	yValue, prefix := formatUnits(yValue, yStep, yUnitSystem)
-	ySpan, spanPrefix := formatUnits(ySpan, yStep, yUnitSystem)
+	yValue, prefix := types.FormatUnits(yValue, yStep, yUnitSystem)
+	ySpan, spanPrefix := types.FormatUnits(ySpan, yStep, yUnitSystem)
 
 	if prefix != "" {
 		prefix += " "
@@ -1599,6 +1704,22 @@ func makeLabel(yValue, yStep, ySpan float64, yUnitSystem string) string {
 	}
 }
 
+// minPositiveValue returns smallest positive value of the series or NaN if there is none
+func minPositiveValue(series []*types.MetricData) float64 {
+	res := math.NaN()
+	for _, s := range series {
+		if s.DrawAsInfinite {
+			continue
+		}
+		for _, v := range s.AggregatedValues() {
+			if v > 0 && !math.IsInf(v, 1) && (math.IsNaN(res) || v < res) {
+				res = v
+			}
+		}
+	}
+	return res
+}
+
 func setupYAxis(cr *cairoSurfaceContext, params *Params, results []*types.MetricData) {
 	var seriesWithMissingValues []*types.MetricData
 
@@ -1659,7 +1780,7 @@ func setupYAxis(cr *cairoSurfaceContext, params *Params, results []*types.Metric
 
 	var order float64
 	var orderFactor float64
-	if params.yUnitSystem == unitSystemBinary {
+	if params.yUnitSystem == types.UnitSystemBinary {
 		order = math.Log2(yVariance)
 		orderFactor = math.Pow(2, math.Floor(order))
 	} else {
@@ -1696,13 +1817,8 @@ func setupYAxis(cr *cairoSurfaceContext, params *Params, results []*types.Metric
 	params.yTop = params.yStep * math.Ceil(yMaxValue/params.yStep-floatEpsilon)     // Extend the top of our graph to the lowest yStep multiple >= yMaxValue
 
 	if params.logBase != 0 {
-		if yMinValue > 0 {
-			params.yBottom = math.Pow(params.logBase, math.Floor(math.Log(yMinValue)/math.Log(params.logBase)))
-			params.yTop = math.Pow(params.logBase, math.Ceil(math.Log(yMaxValue)/math.Log(params.logBase)))
-		} else {
-			panic("logscale with minvalue <= 0")
-			// raise GraphError('Logarithmic scale specified with a dataset with a minimum value less than or equal to zero')
-		}
+		// graphite-web refuses to draw non-positive values on logarithmic scale, we skip them instead
+		params.yBottom, params.yTop = logAxisBounds(params.logBase, yMinValue, yMaxValue, minPositiveValue(results))
 	}
 
 	/*
@@ -1788,36 +1904,6 @@ func getTextExtents(cr *cairoSurfaceContext, text string) cairo.TextExtents {
 	return T
 }
 
-// formatUnits formats the given value according to the given unit prefix system
-func formatUnits(v, step float64, system string) (float64, string) {
-
-	var condition func(float64) bool
-
-	if step == math.NaN() {
-		condition = func(size float64) bool { return math.Abs(v) >= size }
-	} else {
-		condition = func(size float64) bool { return math.Abs(v) >= size && step >= size }
-	}
-
-	unitsystem := unitSystems[system]
-
-	for _, p := range unitsystem {
-		fsize := float64(p.size)
-		if condition(fsize) {
-			v2 := v / fsize
-			if (v2-math.Floor(v2)) < floatEpsilon && v > 1 {
-				v2 = math.Floor(v2)
-			}
-			return v2, p.prefix
-		}
-	}
-
-	if (v-math.Floor(v)) < floatEpsilon && v > 1 {
-		v = math.Floor(v)
-	}
-	return v, ""
-}
-
 func getYLabelValues(params *Params, minYValue, maxYValue, yStep float64) []float64 {
 	if params.logBase != 0 {
 		return logrange(params.logBase, minYValue, maxYValue)
@@ -1826,21 +1912,6 @@ func getYLabelValues(params *Params, minYValue, maxYValue, yStep float64) []floa
 	return frange(minYValue, maxYValue, yStep)
 }
 
-func logrange(base, scaleMin, scaleMax float64) []float64 {
-	current := scaleMin
-	if scaleMin > 0 {
-		current = math.Floor(math.Log(scaleMin) / math.Log(base))
-	}
-	factor := current
-	var vals []float64
-	for current < scaleMax {
-		current = math.Pow(base, factor)
-		vals = append(vals, current)
-		factor++
-	}
-	return vals
-}
-
 func frange(start, end, step float64) []float64 {
 	var vals []float64
 	f := start
@@ -1917,7 +1988,7 @@ func drawYAxis(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 	if params.secondYAxis {
 
 		for _, value := range params.yLabelValuesL {
-			label := makeLabel(value, params.yStepL, params.ySpanL, params.yUnitSystem)
+			label := makeLabel(value, params.yStepL, params.ySpanL, params.yUnitSystemL)
 			y := getYCoord(params, value, YCoordSideLeft)
 			if y < 0 {
 				y = 0
@@ -1929,7 +2000,7 @@ func drawYAxis(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 		}
 
 		for _, value := range params.yLabelValuesR {
-			label := makeLabel(value, params.yStepR, params.ySpanR, params.yUnitSystem)
+			label := makeLabel(value, params.yStepR, params.ySpanR, params.yUnitSystemR)
 			y := getYCoord(params, value, YCoordSideRight)
 			if y < 0 {
 				y = 0
@@ -2305,6 +2376,11 @@ func drawLines(cr *cairoSurfaceContext, params *Params, results []*types.MetricD
 				value = 0
 			}
 
+			// values that are not positive can't be drawn on logarithmic scale, so they are treated as missing
+			if params.logBase != 0 && value <= 0 {
+				value = math.NaN()
+			}
+
 			if math.IsNaN(value) {
 				if consecutiveNones == 0 {
 					cr.context.LineTo(x, y)
@@ -2541,6 +2617,133 @@ func drawLegend(cr *cairoSurfaceContext, params *Params, results []*types.Metric
 	return
 }
 
+// legendTable is a legend with summaries of each series. Space for it is reserved before the graph is drawn, but the
+// table itself is drawn after series were consolidated, so summaries match the graph.
+type legendTable struct {
+	y     float64
+	items []SeriesLegend
+	// copies of the series, as values of stacked series are replaced by totals
+	series []*types.MetricData
+	// series that are drawn, to get consolidation from
+	sources []*types.MetricData
+}
+
+func reserveLegendTable(params *Params, results []*types.MetricData) *legendTable {
+	const (
+		padding = 5
+	)
+	var uniqueNames map[string]bool
+	if params.uniqueLegend {
+		uniqueNames = make(map[string]bool)
+	}
+
+	legend := &legendTable{}
+	for _, res := range results {
+		if res.Name == "" {
+			continue
+		}
+		if params.uniqueLegend {
+			if uniqueNames[res.Name] {
+				continue
+			}
+			uniqueNames[res.Name] = true
+		}
+		s := *res
+		legend.items = append(legend.items, SeriesLegend{
+			res.Name,
+			res.Color,
+			res.SecondYAxis,
+		})
+		legend.series = append(legend.series, &s)
+		legend.sources = append(legend.sources, res)
+	}
+
+	// one line per series and header
+	lineHeight := params.fontExtents.Height + 1
+	legendHeight := float64(len(legend.items)+1)*lineHeight + padding
+	params.area.ymax -= legendHeight
+	legend.y = params.area.ymax + (2 * padding)
+	return legend
+}
+
+func makeLegendValueLabel(v float64, yUnitSystem string) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return string(types.AppendHumanized(nil, v, yUnitSystem))
+}
+
+func drawLegendTable(cr *cairoSurfaceContext, params *Params, legend *legendTable) {
+	const (
+		padding = 5
+	)
+	setFont(cr, params, params.fontSize)
+	boxSize := params.fontExtents.Height - 1
+	lineHeight := params.fontExtents.Height + 1
+
+	var textExtents cairo.TextExtents
+	var nameWidth float64
+	for _, item := range legend.items {
+		cr.context.TextExtents(item.name, &textExtents)
+		nameWidth = math.Max(nameWidth, textExtents.XAdvance)
+	}
+
+	columnWidths := make([]float64, len(params.legendValues))
+	for j, v := range params.legendValues {
+		cr.context.TextExtents(legendValueFuncs[v].title, &textExtents)
+		columnWidths[j] = textExtents.XAdvance
+	}
+
+	rows := make([][]string, len(legend.series))
+	for i, s := range legend.series {
+		s.SetValuesPerPoint(legend.sources[i].ValuesPerPoint)
+		yUnitSystem := params.yUnitSystem
+		if params.secondYAxis {
+			yUnitSystem = params.yUnitSystemL
+			if s.SecondYAxis {
+				yUnitSystem = params.yUnitSystemR
+			}
+		}
+		if params.humanize != "" {
+			yUnitSystem = params.humanize
+		}
+		summaries := summarizeLegendValues(s.AggregatedValues(), params.legendValues)
+		rows[i] = make([]string, len(summaries))
+		for j, v := range summaries {
+			rows[i][j] = makeLegendValueLabel(v, yUnitSystem)
+			cr.context.TextExtents(rows[i][j], &textExtents)
+			columnWidths[j] = math.Max(columnWidths[j], textExtents.XAdvance)
+		}
+	}
+
+	cr.context.SetLineWidth(1.0)
+	setColor(cr, params.fgColor)
+	y := legend.y
+	x := params.area.xmin + boxSize + padding + nameWidth
+	for j, v := range params.legendValues {
+		x += columnWidths[j] + 2*padding
+		drawText(cr, params, legendValueFuncs[v].title, x, y, HAlignRight, VAlignTop, 0.0)
+	}
+	y += lineHeight
+
+	for i, item := range legend.items {
+		x = params.area.xmin
+		setColor(cr, string2RGBA(item.color))
+		drawRectangle(cr, params, x, y, boxSize, boxSize, true)
+		setColor(cr, colors["darkgray"])
+		drawRectangle(cr, params, x, y, boxSize, boxSize, false)
+		setColor(cr, params.fgColor)
+		drawText(cr, params, item.name, x+boxSize+padding, y, HAlignLeft, VAlignTop, 0.0)
+
+		x += boxSize + padding + nameWidth
+		for j, label := range rows[i] {
+			x += columnWidths[j] + 2*padding
+			drawText(cr, params, label, x, y, HAlignRight, VAlignTop, 0.0)
+		}
+		y += lineHeight
+	}
+}
+
 func drawTitle(cr *cairoSurfaceContext, params *Params) {
 	y := params.area.ymin
 	x := params.width / 2.0
@@ -0,0 +1,47 @@
+package png
+
+import (
+	"strings"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+)
+
+// legendValueFunc describes a column of legend table
+type legendValueFunc struct {
+	title string
+	f     func([]float64) float64
+}
+
+// legendValueFuncs contains summaries that can be selected by legendValues parameter
+var legendValueFuncs = map[string]legendValueFunc{
+	"min":   {"Min", consolidations.AggMin},
+	"max":   {"Max", consolidations.AggMax},
+	"avg":   {"Avg", consolidations.AggMean},
+	"last":  {"Last", consolidations.AggLast},
+	"total": {"Total", consolidations.AggSum},
+}
+
+// getLegendValues parses comma-separated list of legend columns, unknown ones are ignored
+func getLegendValues(s string, def []string) []string {
+	if s == "" {
+		return def
+	}
+
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if _, ok := legendValueFuncs[v]; ok {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// summarizeLegendValues computes selected summaries of values, NaN is returned if there are no values
+func summarizeLegendValues(values []float64, legendValues []string) []float64 {
+	res := make([]float64, len(legendValues))
+	for i, v := range legendValues {
+		res[i] = legendValueFuncs[v].f(values)
+	}
+	return res
+}
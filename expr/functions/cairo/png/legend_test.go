@@ -0,0 +1,39 @@
+package png
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestGetLegendValues(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", []string{"max"}},
+		{"min,Max, avg", []string{"min", "max", "avg"}},
+		{"last,foo,total", []string{"last", "total"}},
+	}
+
+	for _, tt := range tests {
+		got := getLegendValues(tt.s, []string{"max"})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getLegendValues(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeLegendValues(t *testing.T) {
+	values := []float64{1, math.NaN(), 5, 3, math.NaN()}
+	got := summarizeLegendValues(values, []string{"min", "max", "avg", "last", "total"})
+	want := []float64{1, 5, 3, 3, 9}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = summarizeLegendValues([]float64{math.NaN()}, []string{"min", "total"})
+	if !math.IsNaN(got[0]) || !math.IsNaN(got[1]) {
+		t.Errorf("expected NaN for empty series, got %v", got)
+	}
+}
@@ -0,0 +1,48 @@
+package png
+
+import "math"
+
+// logEpsilon compensates rounding errors of math.Log, e.x. log(1000)/log(10) = 2.9999999999999996
+const logEpsilon = 1e-9
+
+// logFloor returns the greatest power of base that is less than or equal to positive v
+func logFloor(base, v float64) float64 {
+	return math.Pow(base, math.Floor(math.Log(v)/math.Log(base)+logEpsilon))
+}
+
+// logCeil returns the least power of base that is greater than or equal to positive v
+func logCeil(base, v float64) float64 {
+	return math.Pow(base, math.Ceil(math.Log(v)/math.Log(base)-logEpsilon))
+}
+
+// logrange returns powers of base that are used as labels of logarithmic axis from scaleMin to scaleMax
+func logrange(base, scaleMin, scaleMax float64) []float64 {
+	if scaleMin <= 0 || scaleMax <= 0 || base <= 1 {
+		return nil
+	}
+
+	var vals []float64
+	for v := logFloor(base, scaleMin); ; v *= base {
+		vals = append(vals, v)
+		if v >= scaleMax*(1-logEpsilon) {
+			break
+		}
+	}
+	return vals
+}
+
+// logAxisBounds returns bottom and top of logarithmic axis for values from minValue to maxValue.
+// Values that are not positive can't be drawn, so minPositive (smallest positive value) is used instead of minValue in
+// that case. If there are no positive values at all, axis starts at 1.
+func logAxisBounds(base, minValue, maxValue, minPositive float64) (float64, float64) {
+	if minValue <= 0 {
+		minValue = minPositive
+	}
+	if math.IsNaN(minValue) || minValue <= 0 {
+		minValue = 1
+	}
+	if maxValue <= minValue {
+		maxValue = minValue * base
+	}
+	return logFloor(base, minValue), logCeil(base, maxValue)
+}
@@ -0,0 +1,66 @@
+package png
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLogrange(t *testing.T) {
+	tests := []struct {
+		base, min, max float64
+		want           []float64
+	}{
+		{10, 1, 1000, []float64{1, 10, 100, 1000}},
+		{10, 5, 500, []float64{1, 10, 100, 1000}},
+		{10, 0.01, 1, []float64{0.01, 0.1, 1}},
+		{2, 1, 16, []float64{1, 2, 4, 8, 16}},
+		{2, 3, 9, []float64{2, 4, 8, 16}},
+		{10, 0, 100, nil},
+		{1, 1, 100, nil},
+	}
+
+	for _, tt := range tests {
+		got := logrange(tt.base, tt.min, tt.max)
+		if len(got) != len(tt.want) {
+			t.Errorf("logrange(%v, %v, %v) = %v, want %v", tt.base, tt.min, tt.max, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-9*tt.want[i] {
+				t.Errorf("logrange(%v, %v, %v) = %v, want %v", tt.base, tt.min, tt.max, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLogAxisBounds(t *testing.T) {
+	tests := []struct {
+		base, min, max, minPositive float64
+		wantBottom, wantTop         float64
+	}{
+		{10, 3, 3000, 3, 1, 10000},
+		{10, 1, 1000, 1, 1, 1000},
+		{2, 3, 9, 3, 2, 16},
+		{10, -5, 50, 2, 1, 100},
+		{10, 0, 0, math.NaN(), 1, 10},
+		{10, 5, 5, 5, 1, 100},
+	}
+
+	for _, tt := range tests {
+		bottom, top := logAxisBounds(tt.base, tt.min, tt.max, tt.minPositive)
+		if math.Abs(bottom-tt.wantBottom) > 1e-9 || math.Abs(top-tt.wantTop) > 1e-9*tt.wantTop {
+			t.Errorf("logAxisBounds(%v, %v, %v, %v) = %v, %v, want %v, %v", tt.base, tt.min, tt.max, tt.minPositive,
+				bottom, top, tt.wantBottom, tt.wantTop)
+		}
+	}
+}
+
+func TestLogCeil(t *testing.T) {
+	if got := logCeil(10, 1000); got != 1000 {
+		t.Errorf("logCeil(10, 1000) = %v, want 1000", got)
+	}
+	if got := logCeil(2, 5); got != 8 {
+		t.Errorf("logCeil(2, 5) = %v, want 8", got)
+	}
+}
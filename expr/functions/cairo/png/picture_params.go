@@ -68,6 +68,7 @@ const (
 	PieModeMaximum PieMode = 1 << iota
 	PieModeMinimum
 	PieModeAverage
+	PieModeLast
 )
 
 func getPieMode(s string, def PieMode) PieMode {
@@ -80,6 +81,9 @@ func getPieMode(s string, def PieMode) PieMode {
 	if s == "minimum" {
 		return PieModeMinimum
 	}
+	if s == "last" {
+		return PieModeLast
+	}
 	return PieModeAverage
 }
 
@@ -168,6 +172,12 @@ type PictureParams struct {
 	LineWidth      float64
 	ColorList      []string
 
+	GraphType        string
+	ValueLabels      string
+	ValueLabelsMin   float64
+	ValueLabelsColor string
+	PieLabels        string
+
 	YMin    float64
 	YMax    float64
 	XMin    float64
@@ -189,9 +199,13 @@ type PictureParams struct {
 	UniqueLegend   bool
 	DrawNullAsZero bool
 	DrawAsInfinite bool
+	LegendValues   []string
+	Humanize       string
 
-	YUnitSystem string
-	YDivisors   []float64
+	YUnitSystem      string
+	YUnitSystemLeft  string
+	YUnitSystemRight string
+	YDivisors        []float64
 
 	RightWidth  float64
 	RightDashed bool
@@ -252,6 +266,12 @@ func GetPictureParamsWithTemplate(r *http.Request, template string, metricData [
 		LineWidth:      getFloat64(r.FormValue("lineWidth"), t.LineWidth),
 		ColorList:      getStringArray(r.FormValue("colorList"), t.ColorList),
 
+		GraphType:        getString(r.FormValue("graphType"), t.GraphType),
+		ValueLabels:      getString(r.FormValue("valueLabels"), t.ValueLabels),
+		ValueLabelsMin:   getFloat64(r.FormValue("valueLabelsMin"), t.ValueLabelsMin),
+		ValueLabelsColor: getString(r.FormValue("valueLabelsColor"), t.ValueLabelsColor),
+		PieLabels:        getString(r.FormValue("pieLabels"), t.PieLabels),
+
 		YMin:    getFloat64(r.FormValue("yMin"), t.YMin),
 		YMax:    getFloat64(r.FormValue("yMax"), t.YMax),
 		YStep:   getFloat64(r.FormValue("yStep"), t.YStep),
@@ -264,6 +284,8 @@ func GetPictureParamsWithTemplate(r *http.Request, template string, metricData [
 		UniqueLegend:   getBool(r.FormValue("uniqueLegend"), t.UniqueLegend),
 		DrawNullAsZero: getBool(r.FormValue("drawNullAsZero"), t.DrawNullAsZero),
 		DrawAsInfinite: getBool(r.FormValue("drawAsInfinite"), t.DrawAsInfinite),
+		LegendValues:   getLegendValues(r.FormValue("legendValues"), t.LegendValues),
+		Humanize:       getString(r.FormValue("humanize"), t.Humanize),
 
 		YMinLeft:    getFloat64(r.FormValue("yMinLeft"), t.YMinLeft),
 		YMinRight:   getFloat64(r.FormValue("yMinRight"), t.YMinRight),
@@ -274,8 +296,10 @@ func GetPictureParamsWithTemplate(r *http.Request, template string, metricData [
 		YLimitLeft:  getFloat64(r.FormValue("yLimitLeft"), t.YLimitLeft),
 		YLimitRight: getFloat64(r.FormValue("yLimitRight"), t.YLimitRight),
 
-		YUnitSystem: getString(r.FormValue("yUnitSystem"), t.YUnitSystem),
-		YDivisors:   getFloatArray(r.FormValue("yDivisors"), t.YDivisors),
+		YUnitSystem:      getString(r.FormValue("yUnitSystem"), t.YUnitSystem),
+		YUnitSystemLeft:  getString(r.FormValue("yUnitSystemLeft"), t.YUnitSystemLeft),
+		YUnitSystemRight: getString(r.FormValue("yUnitSystemRight"), t.YUnitSystemRight),
+		YDivisors:        getFloatArray(r.FormValue("yDivisors"), t.YDivisors),
 
 		RightWidth:  getFloat64(r.FormValue("rightWidth"), t.RightWidth),
 		RightDashed: getBool(r.FormValue("rightDashed"), t.RightDashed),
@@ -324,7 +348,7 @@ func getLogBase(s string) float64 {
 		return math.E
 	}
 	b, err := strconv.ParseFloat(s, 64)
-	if err != nil || b < 1 {
+	if err != nil || b <= 1 {
 		return 0
 	}
 	return b
@@ -341,6 +365,11 @@ func getTimeZone(s string, def *time.Location) *time.Location {
 	return tz
 }
 
+// yUnitSystems returns unit systems of left and right Y axes, YUnitSystem is used for the ones that aren't set
+func (p PictureParams) yUnitSystems() (string, string) {
+	return getString(p.YUnitSystemLeft, p.YUnitSystem), getString(p.YUnitSystemRight, p.YUnitSystem)
+}
+
 // SetTemplate adds a picture param template with specified name and parameters
 func SetTemplate(name string, params PictureParams) {
 	templates[name] = params
@@ -382,6 +411,12 @@ var DefaultParams = PictureParams{
 	LineWidth:      1.2,
 	ColorList:      DefaultColorList,
 
+	GraphType:        graphTypeLine,
+	ValueLabels:      valueLabelsPercent,
+	ValueLabelsMin:   5,
+	ValueLabelsColor: "black",
+	PieLabels:        pieLabelsHorizontal,
+
 	YMin:    math.NaN(),
 	YMax:    math.NaN(),
 	YStep:   math.NaN(),
@@ -455,6 +490,12 @@ var templates = map[string]PictureParams{
 		LineWidth:      1.2,
 		ColorList:      DefaultColorList,
 
+		GraphType:        graphTypeLine,
+		ValueLabels:      valueLabelsPercent,
+		ValueLabelsMin:   5,
+		ValueLabelsColor: "black",
+		PieLabels:        pieLabelsHorizontal,
+
 		YMin:    math.NaN(),
 		YMax:    math.NaN(),
 		YStep:   math.NaN(),
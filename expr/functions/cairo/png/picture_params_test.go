@@ -0,0 +1,51 @@
+package png
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetPictureParamsAxes(t *testing.T) {
+	SetTemplate("binaryRight", PictureParams{YUnitSystem: "si", YUnitSystemRight: "binary", YStepR: 1024})
+	defer delete(templates, "binaryRight")
+	nan := math.NaN()
+	sameFloat := func(a, b float64) bool {
+		return a == b || math.IsNaN(a) && math.IsNaN(b)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		template string
+		stepL    float64
+		stepR    float64
+		left     string
+		right    string
+	}{
+		{"defaults", "", "", nan, nan, "si", "si"},
+		{"common unit system", "yUnitSystem=binary", "", nan, nan, "binary", "binary"},
+		{"left unit system", "yUnitSystemLeft=binary", "", nan, nan, "binary", "si"},
+		{"right unit system", "yUnitSystem=none&yUnitSystemRight=binary", "", nan, nan, "none", "binary"},
+		{"both unit systems", "yUnitSystem=si&yUnitSystemLeft=binary&yUnitSystemRight=none", "", nan, nan, "binary", "none"},
+		{"steps", "yStepLeft=5&yStepRight=0.5", "", 5, 0.5, "si", "si"},
+		{"invalid step", "yStepLeft=foo", "", nan, nan, "si", "si"},
+		{"template", "", "binaryRight", 0, 1024, "si", "binary"},
+		{"query overrides template", "yUnitSystemRight=si&yStepRight=10", "binaryRight", 0, 10, "si", "si"},
+		{"unknown template", "yUnitSystemLeft=binary", "noSuchTemplate", nan, nan, "binary", "si"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/render?"+tt.query, nil)
+			p := GetPictureParamsWithTemplate(r, tt.template, nil)
+			if !sameFloat(p.YStepL, tt.stepL) || !sameFloat(p.YStepR, tt.stepR) {
+				t.Errorf("got steps %v and %v, want %v and %v", p.YStepL, p.YStepR, tt.stepL, tt.stepR)
+			}
+			left, right := p.yUnitSystems()
+			if left != tt.left || right != tt.right {
+				t.Errorf("got unit systems %q and %q, want %q and %q", left, right, tt.left, tt.right)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package png
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+const (
+	graphTypeLine = "line"
+	graphTypePie  = "pie"
+)
+
+const (
+	valueLabelsPercent = "percent"
+	valueLabelsNumber  = "number"
+	valueLabelsNone    = "none"
+)
+
+const (
+	pieLabelsHorizontal = "horizontal"
+	pieLabelsRotated    = "rotated"
+)
+
+// pieSlice is a part of pie chart that represents single series
+type pieSlice struct {
+	series  *types.MetricData
+	value   float64
+	percent float64
+}
+
+// pieValue reduces values of the series to a single one according to the pie mode. Series without values are
+// represented by 0, like in graphite-web
+func pieValue(values []float64, mode PieMode) float64 {
+	var res float64
+	var count int
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		switch {
+		case count == 0:
+			res = v
+		case mode == PieModeMaximum:
+			res = math.Max(res, v)
+		case mode == PieModeMinimum:
+			res = math.Min(res, v)
+		case mode == PieModeLast:
+			res = v
+		default:
+			res += v
+		}
+		count++
+	}
+
+	if mode == PieModeAverage && count > 0 {
+		res /= float64(count)
+	}
+	return res
+}
+
+// makePieSlices computes slices for the series, sorted by value in descending order. Values that are not positive
+// can't be drawn, so their share is 0
+func makePieSlices(results []*types.MetricData, mode PieMode) []pieSlice {
+	slices := make([]pieSlice, 0, len(results))
+	var total float64
+	for _, r := range results {
+		v := pieValue(r.Values, mode)
+		slices = append(slices, pieSlice{series: r, value: v})
+		if v > 0 {
+			total += v
+		}
+	}
+
+	sort.SliceStable(slices, func(i, j int) bool {
+		return slices[i].value > slices[j].value
+	})
+
+	if total > 0 {
+		for i := range slices {
+			if slices[i].value > 0 {
+				slices[i].percent = slices[i].value / total
+			}
+		}
+	}
+	return slices
+}
+
+// makePieLabel returns label of the slice or empty string if it shouldn't be drawn. Slices that take less than
+// minPercent of the pie are not labeled
+func makePieLabel(slice pieSlice, valueLabels string, minPercent float64) string {
+	if slice.percent*100 < minPercent {
+		return ""
+	}
+
+	switch valueLabels {
+	case valueLabelsNone:
+		return ""
+	case valueLabelsNumber:
+		if slice.value < 10 && slice.value != math.Floor(slice.value) {
+			return fmt.Sprintf("%.2f", slice.value)
+		}
+		return fmt.Sprintf("%d", int64(slice.value))
+	default:
+		return fmt.Sprintf("%d%%", int(slice.percent*100+0.5))
+	}
+}
@@ -0,0 +1,85 @@
+package png
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+func TestPieValue(t *testing.T) {
+	values := []float64{2, math.NaN(), 8, 5, math.NaN()}
+	tests := []struct {
+		mode PieMode
+		want float64
+	}{
+		{PieModeAverage, 5},
+		{PieModeMaximum, 8},
+		{PieModeMinimum, 2},
+		{PieModeLast, 5},
+	}
+
+	for _, tt := range tests {
+		if got := pieValue(values, tt.mode); got != tt.want {
+			t.Errorf("pieValue(%v) = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+
+	if got := pieValue([]float64{math.NaN()}, PieModeAverage); got != 0 {
+		t.Errorf("pieValue of empty series = %v, want 0", got)
+	}
+}
+
+func TestGetPieMode(t *testing.T) {
+	tests := map[string]PieMode{
+		"":        PieModeMinimum,
+		"maximum": PieModeMaximum,
+		"minimum": PieModeMinimum,
+		"last":    PieModeLast,
+		"average": PieModeAverage,
+		"foo":     PieModeAverage,
+	}
+	for s, want := range tests {
+		if got := getPieMode(s, PieModeMinimum); got != want {
+			t.Errorf("getPieMode(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestMakePieSlices(t *testing.T) {
+	results := []*types.MetricData{
+		types.MakeMetricData("a", []float64{1, 1}, 1, 0),
+		types.MakeMetricData("b", []float64{3, 3}, 1, 0),
+		types.MakeMetricData("c", []float64{-1, math.NaN()}, 1, 0),
+		types.MakeMetricData("d", []float64{6, 6}, 1, 0),
+	}
+
+	slices := makePieSlices(results, PieModeLast)
+	wantNames := []string{"d", "b", "a", "c"}
+	wantPercents := []float64{0.6, 0.3, 0.1, 0}
+	for i, s := range slices {
+		if s.series.Name != wantNames[i] || math.Abs(s.percent-wantPercents[i]) > 1e-9 {
+			t.Errorf("slice %d = %s %v, want %s %v", i, s.series.Name, s.percent, wantNames[i], wantPercents[i])
+		}
+	}
+}
+
+func TestMakePieLabel(t *testing.T) {
+	tests := []struct {
+		slice       pieSlice
+		valueLabels string
+		want        string
+	}{
+		{pieSlice{value: 30, percent: 0.256}, valueLabelsPercent, "26%"},
+		{pieSlice{value: 30, percent: 0.256}, valueLabelsNumber, "30"},
+		{pieSlice{value: 2.5, percent: 0.256}, valueLabelsNumber, "2.50"},
+		{pieSlice{value: 30, percent: 0.256}, valueLabelsNone, ""},
+		{pieSlice{value: 1, percent: 0.04}, valueLabelsPercent, ""},
+	}
+
+	for _, tt := range tests {
+		if got := makePieLabel(tt.slice, tt.valueLabels, 5); got != tt.want {
+			t.Errorf("makePieLabel(%+v, %q) = %q, want %q", tt.slice, tt.valueLabels, got, tt.want)
+		}
+	}
+}
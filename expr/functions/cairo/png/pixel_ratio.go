@@ -1,3 +1,4 @@
+//go:build cairo
 // +build cairo
 
 package png
@@ -6,12 +7,13 @@ import "github.com/evmar/gocairo/cairo"
 
 // interface with all used cairo.Context methods
 type cairoContext interface {
-	Rectangle(x, y, width, height float64) // pixel ratio required
-	GetLineWidth() float64                 // pixel ratio required
-	LineTo(x, y float64)                   // pixel ratio required
-	MoveTo(x, y float64)                   // pixel ratio required
-	SetLineWidth(width float64)            // pixel ratio required
-	SetFontSize(size float64)              // pixel ratio required
+	Rectangle(x, y, width, height float64)      // pixel ratio required
+	GetLineWidth() float64                      // pixel ratio required
+	LineTo(x, y float64)                        // pixel ratio required
+	MoveTo(x, y float64)                        // pixel ratio required
+	Arc(xc, yc, radius, angle1, angle2 float64) // pixel ratio required
+	SetLineWidth(width float64)                 // pixel ratio required
+	SetFontSize(size float64)                   // pixel ratio required
 	SetFontOptions(options *cairo.FontOptions)
 	Stroke()
 	SetDash(dashes []float64, offset float64)            // pixel ratio required
@@ -95,6 +97,10 @@ func (c *pixelRatioContext) MoveTo(x, y float64) {
 	c.Context.MoveTo(c.pr*x, c.pr*y)
 }
 
+func (c *pixelRatioContext) Arc(xc, yc, radius, angle1, angle2 float64) {
+	c.Context.Arc(c.pr*xc, c.pr*yc, c.pr*radius, angle1, angle2)
+}
+
 func (c *pixelRatioContext) SetLineWidth(width float64) {
 	c.Context.SetLineWidth(c.pr * width)
 }
@@ -1,6 +1,8 @@
 package consolidateBy
 
 import (
+	"fmt"
+
 	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
@@ -37,14 +39,19 @@ func (f *consolidateBy) Do(e parser.Expr, from, until int64, values map[parser.M
 		return nil, err
 	}
 
+	aggFunc, ok := consolidations.ConsolidationFunc(name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported consolidation function %s", name)
+	}
+
 	var results []*types.MetricData
 
 	for _, a := range arg {
-		r := *a
-
-		r.AggregateFunction = consolidations.ConsolidationToFunc[name]
+		r := a.CopyLink()
+		r.AggregateFunction = aggFunc
+		r.ConsolidationFunc = name
 
-		results = append(results, &r)
+		results = append(results, r)
 	}
 
 	return results, nil
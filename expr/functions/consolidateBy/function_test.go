@@ -0,0 +1,74 @@
+package consolidateBy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestConsolidateBy(t *testing.T) {
+	values := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{math.NaN(), 1, 3, 4, 6, math.NaN()}, 1, 0)},
+	}
+
+	tests := []struct {
+		target   string
+		expected []float64
+	}{
+		{"consolidateBy(metric1,'first')", []float64{1, 4}},
+		{"consolidateBy(metric1,'last')", []float64{3, 6}},
+		{"consolidateBy(metric1,'range')", []float64{2, 2}},
+		{"consolidateBy(metric1,'count')", []float64{2, 2}},
+		{"consolidateBy(metric1,'multiply')", []float64{math.NaN(), math.NaN()}},
+		{"consolidateBy(metric1,'stddev')", []float64{1, 1}},
+		{"consolidateBy(metric1,'Sum')", []float64{4, 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			e, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.target, err)
+			}
+			res, err := metadata.FunctionMD.Functions[e.Target()].Do(e, 0, 1, values)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(res) != 1 {
+				t.Fatalf("expected 1 series, got %d", len(res))
+			}
+
+			res[0].ValuesPerPoint = 3
+			got := res[0].AggregatedValues()
+			if len(got) != len(tt.expected) {
+				t.Fatalf("got %v, expected %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] && !(math.IsNaN(got[i]) && math.IsNaN(tt.expected[i])) {
+					t.Errorf("got %v, expected %v", got, tt.expected)
+					break
+				}
+			}
+		})
+	}
+
+	e, _, _ := parser.ParseExpr("consolidateBy(metric1,'unknown')")
+	if _, err := metadata.FunctionMD.Functions[e.Target()].Do(e, 0, 1, values); err == nil {
+		t.Error("expected error for unknown consolidation function")
+	}
+}
@@ -37,6 +37,7 @@ func (f *cumulative) Do(e parser.Expr, from, until int64, values map[parser.Metr
 	for _, a := range arg {
 		r := *a
 		r.AggregateFunction = consolidations.AggSum
+		r.ConsolidationFunc = "sum"
 		results = append(results, &r)
 	}
 	return results, nil
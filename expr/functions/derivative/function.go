@@ -27,16 +27,31 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-// derivative(seriesList)
+// derivative(seriesList, resetThreshold=None, interval=None)
 func (f *derivative) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	resetThreshold, err := e.GetFloatNamedOrPosArgDefault("resetThreshold", 1, math.NaN())
+	if err != nil {
+		return nil, err
+	}
+	interval, err := helper.GetIntervalNamedOrPosArgDefault(e, "interval", 2, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	return helper.ForEachSeriesDo(e, from, until, values, func(a *types.MetricData, r *types.MetricData) *types.MetricData {
 		prev := math.NaN()
+		prevIdx := 0
 		for i, v := range a.Values {
 			// We don't need to check for special case here. value-NaN == NaN
 
-			r.Values[i] = v - prev
+			r.Values[i] = helper.CounterDelta(v, prev, resetThreshold)
+			if interval > 0 {
+				// gaps are bridged, so delta should be normalized by actual time between values
+				r.Values[i] *= float64(interval) / float64(int64(i-prevIdx)*a.StepTime)
+			}
 			if !math.IsNaN(v) {
 				prev = v
+				prevIdx = i
 			}
 		}
 		return r
@@ -47,8 +62,8 @@ func (f *derivative) Do(e parser.Expr, from, until int64, values map[parser.Metr
 func (f *derivative) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"derivative": {
-			Description: "This is the opposite of the integral function.  This is useful for taking a\nrunning total metric and calculating the delta between subsequent data points.\n\nThis function does not normalize for periods of time, as a true derivative would.\nInstead see the perSecond() function to calculate a rate of change over time.\n\nExample:\n\n.. code-block:: none\n\n  &target=derivative(company.server.application01.ifconfig.TXPackets)\n\nEach time you run ifconfig, the RX and TXPackets are higher (assuming there\nis network traffic.) By applying the derivative function, you can get an\nidea of the packets per minute sent or received, even though you're only\nrecording the total.",
-			Function:    "derivative(seriesList)",
+			Description: "This is the opposite of the integral function.  This is useful for taking a\nrunning total metric and calculating the delta between subsequent data points.\n\nThis function does not normalize for periods of time, as a true derivative would.\nInstead see the perSecond() function to calculate a rate of change over time.\n\nExample:\n\n.. code-block:: none\n\n  &target=derivative(company.server.application01.ifconfig.TXPackets)\n\nEach time you run ifconfig, the RX and TXPackets are higher (assuming there\nis network traffic.) By applying the derivative function, you can get an\nidea of the packets per minute sent or received, even though you're only\nrecording the total.\n\nIf resetThreshold is specified, decrease by at least that amount is treated as a counter\nreset and current value is used as a delta. If interval (e.x. '1s' or '1min') is specified, deltas are\nnormalized to that interval using actual time between values, which is useful when series have mixed steps.",
+			Function:    "derivative(seriesList, resetThreshold=None, interval=None)",
 			Group:       "Transform",
 			Module:      "graphite.render.functions",
 			Name:        "derivative",
@@ -58,6 +73,14 @@ func (f *derivative) Description() map[string]types.FunctionDescription {
 					Required: true,
 					Type:     types.SeriesList,
 				},
+				{
+					Name: "resetThreshold",
+					Type: types.Float,
+				},
+				{
+					Name: "interval",
+					Type: types.Interval,
+				},
 			},
 		},
 	}
@@ -42,6 +42,22 @@ func TestDerivative(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("derivative(metric1)",
 				[]float64{math.NaN(), math.NaN(), 2, -5, 3, math.NaN(), 4}, 1, now32)},
 		},
+		{
+			"derivative(metric1,resetThreshold=3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{2, 4, 6, 1, 4, 3, 8}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("derivative(metric1)",
+				[]float64{math.NaN(), 2, 2, 1, 3, -1, 5}, 1, now32)},
+		},
+		{
+			"derivative(metric1,interval='1min')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{2, 4, math.NaN(), 10, 11}, 10, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("derivative(metric1)",
+				[]float64{math.NaN(), 12, math.NaN(), 18, 6}, 10, now32)},
+		},
 	}
 
 	for _, tt := range tests {
@@ -53,7 +53,11 @@ func (f *diffSeries) Do(e parser.Expr, from, until int64, values map[parser.Metr
 		e.SetRawArgs(strings.Join(args, ","))
 	}
 
-	minuend := minuends[0]
+	normalized, err := helper.NormalizeSteps(append([]*types.MetricData{minuends[0]}, subtrahends...))
+	if err != nil {
+		return nil, err
+	}
+	minuend, subtrahends := normalized[0], normalized[1:]
 
 	// FIXME: need more error checking on minuend, subtrahends here
 	r := *minuend
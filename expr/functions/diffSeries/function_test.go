@@ -24,6 +24,8 @@ func init() {
 
 func TestDiffSeries(t *testing.T) {
 	now32 := int64(time.Now().Unix())
+	// start time of series with different steps is aligned to the common step
+	even32 := now32 - now32%2
 
 	tests := []th.EvalTestItem{
 		{
@@ -70,12 +72,13 @@ func TestDiffSeries(t *testing.T) {
 			"diffSeries(metric*)",
 			map[parser.MetricRequest][]*types.MetricData{
 				{"metric*", 0, 1}: {
-					types.MakeMetricData("metric1", []float64{1, 2, math.NaN(), 3, 4, math.NaN()}, 1, now32),
-					types.MakeMetricData("metric2", []float64{5, math.NaN(), 6}, 2, now32),
+					types.MakeMetricData("metric1", []float64{1, 2, math.NaN(), 3, 4, math.NaN()}, 1, even32),
+					types.MakeMetricData("metric2", []float64{5, math.NaN(), 6}, 2, even32),
 				},
 			},
+			// series are consolidated to the least common multiple of steps, like in graphite-web
 			[]*types.MetricData{types.MakeMetricData("diffSeries(metric*)",
-				[]float64{-4, -3, math.NaN(), 3, -2, math.NaN()}, 1, now32)},
+				[]float64{-3.5, 3, -2}, 2, even32)},
 		},
 	}
 
@@ -63,14 +63,18 @@ func (f *divideSeries) Do(e parser.Expr, from, until int64, values map[parser.Me
 		return nil, errors.New("must be called with 2 series or a wildcard that matches exactly 2 series")
 	}
 
+	var results []*types.MetricData
 	for _, numerator := range numerators {
+		denominator := denominator
+		normalized, err := helper.NormalizeSteps([]*types.MetricData{numerator, denominator})
+		if err != nil {
+			return nil, err
+		}
+		numerator, denominator = normalized[0], normalized[1]
 		if numerator.StepTime != denominator.StepTime || len(numerator.Values) != len(denominator.Values) {
 			return nil, fmt.Errorf("series %s must have the same length as %s", numerator.Name, denominator.Name)
 		}
-	}
 
-	var results []*types.MetricData
-	for _, numerator := range numerators {
 		r := *numerator
 		if useMetricNames {
 			r.Name = fmt.Sprintf("divideSeries(%s,%s)", numerator.Name, denominator.Name)
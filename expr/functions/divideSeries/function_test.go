@@ -81,6 +81,16 @@ func TestDivideSeries(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("divideSeries(metric[12])",
 				[]float64{0.5, math.NaN(), math.NaN(), math.NaN(), math.NaN(), 2}, 1, now32)},
 		},
+		{
+			// series are consolidated to the least common multiple of steps
+			"divideSeries(metric1,metric3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 3, 4, math.NaN(), 6, 12}, 1, 0)},
+				{"metric3", 0, 1}: {types.MakeMetricData("metric3", []float64{4, 0, 3}, 2, 0)},
+			},
+			[]*types.MetricData{types.MakeMetricData("divideSeries(metric1,metric3)",
+				[]float64{0.5, math.NaN(), 3}, 2, 0)},
+		},
 	}
 
 	for _, tt := range tests {
@@ -91,3 +101,20 @@ func TestDivideSeries(t *testing.T) {
 	}
 
 }
+
+func TestDivideSeriesStrictSteps(t *testing.T) {
+	helper.StrictSteps = true
+	defer func() { helper.StrictSteps = false }()
+
+	exp, _, err := parser.ParseExpr("divideSeries(metric1,metric2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4}, 1, 0)},
+		{"metric2", 0, 1}: {types.MakeMetricData("metric2", []float64{1, 2}, 2, 0)},
+	}
+	if _, err := metadata.GetEvaluator().EvalExpr(exp, 0, 1, values); err == nil {
+		t.Error("expected error for series with different steps")
+	}
+}
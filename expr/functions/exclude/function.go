@@ -5,7 +5,6 @@ import (
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
-	"regexp"
 )
 
 type exclude struct {
@@ -19,26 +18,43 @@ func GetOrder() interfaces.Order {
 func New(configFile string) []interfaces.FunctionMetadata {
 	res := make([]interfaces.FunctionMetadata, 0)
 	f := &exclude{}
-	functions := []string{"exclude"}
+	functions := []string{"exclude", "excludeByTag"}
 	for _, n := range functions {
 		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
 	}
 	return res
 }
 
-// exclude(seriesList, pattern)
+// exclude(seriesList, pattern, flags="")
+// excludeByTag(seriesList, tag, pattern, flags="")
 func (f *exclude) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
 		return nil, err
 	}
 
-	pat, err := e.GetStringArg(1)
+	byTag := e.Target() == "excludeByTag"
+	patternArg := 1
+	var tag string
+	if byTag {
+		tag, err = e.GetStringArg(1)
+		if err != nil {
+			return nil, err
+		}
+		patternArg = 2
+	}
+
+	pat, err := e.GetStringArg(patternArg)
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := e.GetStringNamedOrPosArgDefault("flags", patternArg+1, "")
 	if err != nil {
 		return nil, err
 	}
 
-	patre, err := regexp.Compile(pat)
+	patre, err := helper.CompileRegexp(pat, flags)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +62,12 @@ func (f *exclude) Do(e parser.Expr, from, until int64, values map[parser.MetricR
 	var results []*types.MetricData
 
 	for _, a := range arg {
-		if !patre.MatchString(a.Name) {
+		value := a.Name
+		if byTag {
+			// missing tag is matched as empty string
+			value = a.Tags[tag]
+		}
+		if !patre.MatchString(value) {
 			results = append(results, a)
 		}
 	}
@@ -58,8 +79,8 @@ func (f *exclude) Do(e parser.Expr, from, until int64, values map[parser.MetricR
 func (f *exclude) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"exclude": {
-			Description: "Takes a metric or a wildcard seriesList, followed by a regular expression\nin double quotes.  Excludes metrics that match the regular expression.\n\nExample:\n\n.. code-block:: none\n\n  &target=exclude(servers*.instance*.threads.busy,\"server02\")",
-			Function:    "exclude(seriesList, pattern)",
+			Description: "Takes a metric or a wildcard seriesList, followed by a regular expression\nin double quotes.  Excludes metrics that match the regular expression.\nIn carbonapi optional flags are RE2 flags, e.x. \"i\" for case-insensitive match.\n\nExample:\n\n.. code-block:: none\n\n  &target=exclude(servers*.instance*.threads.busy,\"server02\")",
+			Function:    "exclude(seriesList, pattern, flags='')",
 			Group:       "Filter Series",
 			Module:      "graphite.render.functions",
 			Name:        "exclude",
@@ -74,6 +95,38 @@ func (f *exclude) Description() map[string]types.FunctionDescription {
 					Required: true,
 					Type:     types.String,
 				},
+				{
+					Name: "flags",
+					Type: types.String,
+				},
+			},
+		},
+		"excludeByTag": {
+			Description: "Takes a metric or a wildcard seriesList, followed by a tag name and a regular expression\nin double quotes.  Excludes metrics whose tag values match the regular expression, missing tags\nare matched as empty strings. Optional flags are RE2 flags, e.x. \"i\" for case-insensitive match.\n\nExample:\n\n.. code-block:: none\n\n  &target=excludeByTag(seriesByTag(\"name=cpu\"),\"dc\",\"^us-\",\"i\")",
+			Function:    "excludeByTag(seriesList, tag, pattern, flags='')",
+			Group:       "Filter Series",
+			Module:      "graphite.render.functions.custom",
+			Name:        "excludeByTag",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "tag",
+					Required: true,
+					Type:     types.Tag,
+				},
+				{
+					Name:     "pattern",
+					Required: true,
+					Type:     types.String,
+				},
+				{
+					Name: "flags",
+					Type: types.String,
+				},
 			},
 		},
 	}
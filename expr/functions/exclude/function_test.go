@@ -37,6 +37,31 @@ func TestExclude(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("metricBar", // NOTE(dgryski): not sure if this matches graphite
 				[]float64{2, 2, 2, 2, 2}, 1, now32)},
 		},
+		{
+			"exclude(metric1,\"foo|BAZ\",\"i\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metricFoo", []float64{1, 1, 1, 1, 1}, 1, now32),
+					types.MakeMetricData("metricBar", []float64{2, 2, 2, 2, 2}, 1, now32),
+					types.MakeMetricData("metricBaz", []float64{3, 3, 3, 3, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{types.MakeMetricData("metricBar", []float64{2, 2, 2, 2, 2}, 1, now32)},
+		},
+		{
+			"excludeByTag(metric1,\"dc\",\"^us-\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metric1;dc=us-east", []float64{1, 1, 1, 1, 1}, 1, now32),
+					types.MakeMetricData("metric1;dc=eu-west", []float64{2, 2, 2, 2, 2}, 1, now32),
+					types.MakeMetricData("metric1", []float64{3, 3, 3, 3, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metric1;dc=eu-west", []float64{2, 2, 2, 2, 2}, 1, now32),
+				types.MakeMetricData("metric1", []float64{3, 3, 3, 3, 3}, 1, now32),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -47,3 +72,16 @@ func TestExclude(t *testing.T) {
 	}
 
 }
+
+func TestExcludeBadFlags(t *testing.T) {
+	exp, _, err := parser.ParseExpr("exclude(metric1,\"foo\",\"x\")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", 0, 1}: {types.MakeMetricData("metricFoo", []float64{1}, 1, 0)},
+	}
+	if _, err := metadata.FunctionMD.Functions["exclude"].Do(exp, 0, 1, values); err == nil {
+		t.Error("error expected for unknown flag")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/aliasByNode"
 	"github.com/go-graphite/carbonapi/expr/functions/aliasByPostgres"
 	"github.com/go-graphite/carbonapi/expr/functions/aliasByTags"
+	"github.com/go-graphite/carbonapi/expr/functions/aliasFormat"
 	"github.com/go-graphite/carbonapi/expr/functions/aliasSub"
 	"github.com/go-graphite/carbonapi/expr/functions/asPercent"
 	"github.com/go-graphite/carbonapi/expr/functions/averageSeries"
@@ -31,6 +32,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/divideSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/ewma"
 	"github.com/go-graphite/carbonapi/expr/functions/exclude"
+	"github.com/go-graphite/carbonapi/expr/functions/exp"
 	"github.com/go-graphite/carbonapi/expr/functions/fallbackSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/fft"
 	"github.com/go-graphite/carbonapi/expr/functions/filter"
@@ -46,6 +48,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/holtWintersForecast"
 	"github.com/go-graphite/carbonapi/expr/functions/ifft"
 	"github.com/go-graphite/carbonapi/expr/functions/integral"
+	"github.com/go-graphite/carbonapi/expr/functions/interpolate"
 	"github.com/go-graphite/carbonapi/expr/functions/invert"
 	"github.com/go-graphite/carbonapi/expr/functions/isNotNull"
 	"github.com/go-graphite/carbonapi/expr/functions/keepLastValue"
@@ -54,6 +57,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/limit"
 	"github.com/go-graphite/carbonapi/expr/functions/linearRegression"
 	"github.com/go-graphite/carbonapi/expr/functions/logarithm"
+	"github.com/go-graphite/carbonapi/expr/functions/logit"
 	"github.com/go-graphite/carbonapi/expr/functions/lowPass"
 	"github.com/go-graphite/carbonapi/expr/functions/mapSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/minMax"
@@ -77,10 +81,14 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/reduce"
 	"github.com/go-graphite/carbonapi/expr/functions/removeBelowSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/removeEmptySeries"
+	"github.com/go-graphite/carbonapi/expr/functions/resample"
+	"github.com/go-graphite/carbonapi/expr/functions/round"
 	"github.com/go-graphite/carbonapi/expr/functions/scale"
 	"github.com/go-graphite/carbonapi/expr/functions/scaleToSeconds"
 	"github.com/go-graphite/carbonapi/expr/functions/seriesByTag"
 	"github.com/go-graphite/carbonapi/expr/functions/seriesList"
+	"github.com/go-graphite/carbonapi/expr/functions/sigmoid"
+	"github.com/go-graphite/carbonapi/expr/functions/slice"
 	"github.com/go-graphite/carbonapi/expr/functions/sortBy"
 	"github.com/go-graphite/carbonapi/expr/functions/sortByName"
 	"github.com/go-graphite/carbonapi/expr/functions/squareRoot"
@@ -116,6 +124,7 @@ func New(configs map[string]string) {
 		{name: "aliasByNode", order: aliasByNode.GetOrder(), f: aliasByNode.New},
 		{name: "aliasByPostgres", order: aliasByPostgres.GetOrder(), f: aliasByPostgres.New},
 		{name: "aliasByTags", order: aliasByTags.GetOrder(), f: aliasByTags.New},
+		{name: "aliasFormat", order: aliasFormat.GetOrder(), f: aliasFormat.New},
 		{name: "aliasSub", order: aliasSub.GetOrder(), f: aliasSub.New},
 		{name: "asPercent", order: asPercent.GetOrder(), f: asPercent.New},
 		{name: "averageSeries", order: averageSeries.GetOrder(), f: averageSeries.New},
@@ -134,6 +143,7 @@ func New(configs map[string]string) {
 		{name: "divideSeries", order: divideSeries.GetOrder(), f: divideSeries.New},
 		{name: "ewma", order: ewma.GetOrder(), f: ewma.New},
 		{name: "exclude", order: exclude.GetOrder(), f: exclude.New},
+		{name: "exp", order: exp.GetOrder(), f: exp.New},
 		{name: "fallbackSeries", order: fallbackSeries.GetOrder(), f: fallbackSeries.New},
 		{name: "fft", order: fft.GetOrder(), f: fft.New},
 		{name: "filter", order: filter.GetOrder(), f: filter.New},
@@ -149,6 +159,7 @@ func New(configs map[string]string) {
 		{name: "holtWintersForecast", order: holtWintersForecast.GetOrder(), f: holtWintersForecast.New},
 		{name: "ifft", order: ifft.GetOrder(), f: ifft.New},
 		{name: "integral", order: integral.GetOrder(), f: integral.New},
+		{name: "interpolate", order: interpolate.GetOrder(), f: interpolate.New},
 		{name: "invert", order: invert.GetOrder(), f: invert.New},
 		{name: "isNotNull", order: isNotNull.GetOrder(), f: isNotNull.New},
 		{name: "keepLastValue", order: keepLastValue.GetOrder(), f: keepLastValue.New},
@@ -157,6 +168,7 @@ func New(configs map[string]string) {
 		{name: "limit", order: limit.GetOrder(), f: limit.New},
 		{name: "linearRegression", order: linearRegression.GetOrder(), f: linearRegression.New},
 		{name: "logarithm", order: logarithm.GetOrder(), f: logarithm.New},
+		{name: "logit", order: logit.GetOrder(), f: logit.New},
 		{name: "lowPass", order: lowPass.GetOrder(), f: lowPass.New},
 		{name: "mapSeries", order: mapSeries.GetOrder(), f: mapSeries.New},
 		{name: "minMax", order: minMax.GetOrder(), f: minMax.New},
@@ -180,10 +192,14 @@ func New(configs map[string]string) {
 		{name: "reduce", order: reduce.GetOrder(), f: reduce.New},
 		{name: "removeBelowSeries", order: removeBelowSeries.GetOrder(), f: removeBelowSeries.New},
 		{name: "removeEmptySeries", order: removeEmptySeries.GetOrder(), f: removeEmptySeries.New},
+		{name: "resample", order: resample.GetOrder(), f: resample.New},
+		{name: "round", order: round.GetOrder(), f: round.New},
 		{name: "scale", order: scale.GetOrder(), f: scale.New},
 		{name: "scaleToSeconds", order: scaleToSeconds.GetOrder(), f: scaleToSeconds.New},
 		{name: "seriesByTag", order: seriesByTag.GetOrder(), f: seriesByTag.New},
 		{name: "seriesList", order: seriesList.GetOrder(), f: seriesList.New},
+		{name: "sigmoid", order: sigmoid.GetOrder(), f: sigmoid.New},
+		{name: "slice", order: slice.GetOrder(), f: slice.New},
 		{name: "sortBy", order: sortBy.GetOrder(), f: sortBy.New},
 		{name: "sortByName", order: sortByName.GetOrder(), f: sortByName.New},
 		{name: "squareRoot", order: squareRoot.GetOrder(), f: squareRoot.New},
@@ -2,6 +2,7 @@ package groupByNode
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/go-graphite/carbonapi/expr/consolidations"
@@ -36,7 +37,7 @@ func (f *groupByNode) Do(e parser.Expr, from, until int64, values map[parser.Met
 	if err != nil {
 		return nil, err
 	}
-	var callback string
+	var callback helper.SeriesString
 	var fields []int
 
 	if e.Target() == "groupByNode" {
@@ -45,13 +46,13 @@ func (f *groupByNode) Do(e parser.Expr, from, until int64, values map[parser.Met
 			return nil, err
 		}
 
-		callback, err = e.GetStringArg(2)
+		callback, err = helper.GetSeriesStringArg(e, 2)
 		if err != nil {
 			return nil, err
 		}
 		fields = []int{field}
 	} else {
-		callback, err = e.GetStringArg(1)
+		callback, err = helper.GetSeriesStringArg(e, 1)
 		if err != nil {
 			return nil, err
 		}
@@ -83,12 +84,16 @@ func (f *groupByNode) Do(e parser.Expr, from, until int64, values map[parser.Met
 		groups[node] = append(groups[node], a)
 	}
 
+	// groups are ordered naturally by their names, so host2 goes before host10
+	sort.SliceStable(nodeList, func(i, j int) bool { return helper.NaturalLess(nodeList[i], nodeList[j]) })
+
 	for _, k := range nodeList {
 		k := k // k's reference is used later, so it's important to make it unique per loop
 		v := groups[k]
 
-		// Ensure that names won't be parsed as consts, appending stub to them
-		expr := fmt.Sprintf("%s(stub_%s)", callback, k)
+		// Ensure that names won't be parsed as consts, appending stub to them. Callback that depends on series (e.x.
+		// tag("aggregation")) is resolved by the first series of the group
+		expr := fmt.Sprintf("%s(stub_%s)", callback(v[0]), k)
 
 		// create a stub context to evaluate the callback in
 		nexpr, _, err := parser.ParseExpr(expr)
@@ -139,11 +144,12 @@ func (f *groupByNode) Description() map[string]types.FunctionDescription {
 					Type:     types.NodeOrTag,
 				},
 				{
-					Default:  types.NewSuggestion("average"),
-					Name:     "callback",
-					Options:  consolidations.AvailableSummarizers,
-					Required: true,
-					Type:     types.AggFunc,
+					Default:   types.NewSuggestion("average"),
+					Name:      "callback",
+					Options:   consolidations.AvailableSummarizers,
+					Required:  true,
+					Type:      types.AggFunc,
+					PerSeries: true,
 				},
 			},
 		},
@@ -160,10 +166,11 @@ func (f *groupByNode) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "callback",
-					Options:  consolidations.AvailableSummarizers,
-					Required: true,
-					Type:     types.AggFunc,
+					Name:      "callback",
+					Options:   consolidations.AvailableSummarizers,
+					Required:  true,
+					Type:      types.AggFunc,
+					PerSeries: true,
 				},
 				{
 					Multiple: true,
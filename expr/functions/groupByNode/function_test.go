@@ -95,6 +95,21 @@ func TestGroupByNode(t *testing.T) {
 				"metric1.foo.qux": {types.MakeMetricData("metric1.foo.qux", []float64{13, 15, 17, 19, 21}, 1, now32)},
 			},
 		},
+		{
+			"groupByNode(metric1.foo.*,2,tag(\"aggregation\"))",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1.foo.*", 0, 1}: {
+					types.NewMetricDataBuilder("metric1.foo.bar", []float64{1, 2, 3, 4, 5}).WithStep(1).WithStartTime(now32).
+						WithTags(map[string]string{"aggregation": "sum"}).MustBuild(),
+					types.NewMetricDataBuilder("metric1.foo.bar", []float64{6, 7, 8, 9, 10}).WithStep(1).WithStartTime(now32).
+						WithTags(map[string]string{"aggregation": "sum"}).MustBuild(),
+				},
+			},
+			"groupByNode_tag_callback",
+			map[string][]*types.MetricData{
+				"bar": {types.MakeMetricData("bar", []float64{7, 9, 11, 13, 15}, 1, now32)},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -105,3 +120,24 @@ func TestGroupByNode(t *testing.T) {
 	}
 
 }
+
+func TestGroupByNodeOrder(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tt := th.EvalTestItem{
+		"groupByNode(host*.cpu,0,\"sum\")",
+		map[parser.MetricRequest][]*types.MetricData{
+			{"host*.cpu", 0, 1}: {
+				types.MakeMetricData("host1.cpu", []float64{1, 2, 3}, 1, now32),
+				types.MakeMetricData("host10.cpu", []float64{4, 5, 6}, 1, now32),
+				types.MakeMetricData("host2.cpu", []float64{7, 8, 9}, 1, now32),
+			},
+		},
+		[]*types.MetricData{
+			types.MakeMetricData("host1", []float64{1, 2, 3}, 1, now32),
+			types.MakeMetricData("host2", []float64{7, 8, 9}, 1, now32),
+			types.MakeMetricData("host10", []float64{4, 5, 6}, 1, now32),
+		},
+	}
+	th.TestEvalExpr(t, &tt)
+}
@@ -3,7 +3,6 @@ package groupByTags
 import (
 	"fmt"
 	"sort"
-	"strings"
 
 	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/helper"
@@ -54,18 +53,17 @@ func (f *groupByTags) Do(e parser.Expr, from, until int64, values map[parser.Met
 
 	names := make(map[string]string)
 	groups := make(map[string][]*types.MetricData)
-	// name := args[1].Name
+	groupTags := make(map[string]map[string]string)
 
-	// TODO(civil): Think how to optimize it, as it's ugly
 	for _, a := range args {
-		metricTags := tags.ExtractTags(a.Name)
-		var keyBuilder strings.Builder
+		metricTags := tags.ExtractTagsCached(a.Name)
+		t := make(map[string]string, len(tagNames))
 		for _, tag := range tagNames {
-			value := metricTags[tag]
-			keyBuilder.WriteString(";" + tag + "=" + value)
+			t[tag] = metricTags[tag]
 		}
-		key := keyBuilder.String()
+		key := types.FormatNameWithTags("", t)
 		groups[key] = append(groups[key], a)
+		groupTags[key] = t
 
 		if name, ok := names[key]; ok {
 			if name != metricTags["name"] {
@@ -103,7 +101,10 @@ func (f *groupByTags) Do(e parser.Expr, from, until int64, values map[parser.Met
 			return nil, err
 		}
 		if r != nil {
-			r[0].Name = names[k] + k
+			t := groupTags[k]
+			t["name"] = names[k]
+			r[0].Name = types.FormatNameWithTags(names[k], t)
+			r[0].Tags = t
 			results = append(results, r...)
 		}
 	}
@@ -1,9 +1,9 @@
 package highestLowest
 
 import (
-	"container/heap"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 
 	"github.com/go-graphite/carbonapi/expr/consolidations"
@@ -31,7 +31,18 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-// highestAverage(seriesList, n) , highestCurrent(seriesList, n), highestMax(seriesList, n)
+// aggregations maps aliases of highest and lowest to their aggregation functions
+var aggregations = map[string]string{
+	"highestAverage": "average",
+	"highestCurrent": "current",
+	"highestMax":     "max",
+	"lowestAverage":  "average",
+	"lowestCurrent":  "current",
+	"lowestMax":      "max",
+}
+
+// highest(seriesList, n=1, func='average'), lowest(seriesList, n=1, func='average')
+// highestAverage(seriesList, n), highestCurrent(seriesList, n), highestMax(seriesList, n) and lowest* counterparts
 func (f *highest) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
@@ -39,28 +50,16 @@ func (f *highest) Do(e parser.Expr, from, until int64, values map[parser.MetricR
 	}
 
 	n := 1
-	if len(e.Args()) > 1 && e.Target() != "highest" && e.Target() != "lowest" {
-		n, err = e.GetIntArg(1)
-		if err != nil {
-			return nil, err
+	consolidation, isAlias := aggregations[e.Target()]
+	if isAlias {
+		if len(e.Args()) > 1 {
+			n, err = e.GetIntArg(1)
+			if err != nil {
+				return nil, err
+			}
 		}
-	}
-
-	var results []*types.MetricData
-
-	// we have fewer arguments than we want result series
-	if len(arg) < n {
-		return arg, nil
-	}
-
-	var mh types.MetricHeap
-
-	var compute func([]float64) float64
-
-	isHighest := strings.HasPrefix(e.Target(), "highest")
-	switch e.Target() {
-	case "highest", "lowest":
-		consolidation := "average"
+	} else {
+		consolidation = "average"
 		switch len(e.Args()) {
 		case 2:
 			n, err = e.GetIntArg(1)
@@ -84,62 +83,100 @@ func (f *highest) Do(e parser.Expr, from, until int64, values map[parser.MetricR
 				return nil, err
 			}
 		}
-		var ok bool
-		compute, ok = consolidations.ConsolidationToFunc[consolidation]
-		if !ok {
-			return nil, fmt.Errorf("unsupported consolidation function %v", consolidation)
-		}
-	case "highestMax", "lowestMax":
-		compute = consolidations.MaxValue
-	case "highestAverage", "lowestAverage":
-		compute = consolidations.AvgValue
-	case "highestCurrent", "lowestCurrent":
-		compute = consolidations.CurrentValue
-	default:
-		return nil, fmt.Errorf("unsupported function %v", e.Target())
 	}
 
-	if isHighest {
-		for i, a := range arg {
-			m := compute(a.Values)
-			if math.IsNaN(m) {
-				continue
-			}
+	// we have fewer arguments than we want result series
+	if len(arg) < n {
+		return arg, nil
+	}
 
-			if len(mh) < n {
-				heap.Push(&mh, types.MetricHeapElement{Idx: i, Val: m})
-				continue
-			}
-			// m is bigger than smallest max found so far
-			if mh[0].Val < m {
-				mh[0].Val = m
-				mh[0].Idx = i
-				heap.Fix(&mh, 0)
-			}
+	compute, ok := consolidations.ConsolidationFunc(consolidation)
+	if !ok {
+		return nil, fmt.Errorf("unsupported consolidation function %v", consolidation)
+	}
+
+	ranked := make([]rankedSeries, 0, len(arg))
+	for i, a := range arg {
+		m := compute(a.Values)
+		// series without values can't be ranked
+		if math.IsNaN(m) {
+			continue
 		}
+		ranked = append(ranked, rankedSeries{idx: i, val: m})
+	}
+	if n > len(ranked) {
+		n = len(ranked)
+	}
+
+	less := lowerFirst
+	if strings.HasPrefix(e.Target(), "highest") {
+		less = higherFirst
+	}
+
+	// only n series are sorted, so it's O(len(arg) + n*log(n)) instead of full sort
+	selectFirst(ranked, n, less)
+	ranked = ranked[:n]
+	sort.Slice(ranked, func(i, j int) bool { return less(ranked[i], ranked[j]) })
+
+	results := make([]*types.MetricData, 0, n)
+	for _, r := range ranked {
+		results = append(results, arg[r.idx])
+	}
+
+	return results, nil
+}
+
+type rankedSeries struct {
+	idx int
+	val float64
+}
 
-		results = make([]*types.MetricData, len(mh))
+// series with equal values are ordered as in the original list
+func higherFirst(a, b rankedSeries) bool {
+	return a.val > b.val || a.val == b.val && a.idx < b.idx
+}
+
+func lowerFirst(a, b rankedSeries) bool {
+	return a.val < b.val || a.val == b.val && a.idx < b.idx
+}
 
-		// results should be ordered ascending
-		for len(mh) > 0 {
-			v := heap.Pop(&mh).(types.MetricHeapElement)
-			results[len(mh)] = arg[v.Idx]
+// selectFirst reorders elements, so that first k of them are the ones that would be first after sorting, in
+// unspecified order. It's a quickselect with median of three pivot, that takes linear time on average. Elements must
+// be distinct according to less
+func selectFirst(elements []rankedSeries, k int, less func(a, b rankedSeries) bool) {
+	lo, hi := 0, len(elements)-1
+	for lo < hi && k > lo && k <= hi {
+		mid := lo + (hi-lo)/2
+		// move median of elements[lo], elements[mid] and elements[hi] to elements[hi]
+		if less(elements[mid], elements[lo]) {
+			elements[mid], elements[lo] = elements[lo], elements[mid]
 		}
-	} else {
-		for i, a := range arg {
-			m := compute(a.Values)
-			heap.Push(&mh, types.MetricHeapElement{Idx: i, Val: m})
+		if less(elements[hi], elements[lo]) {
+			elements[hi], elements[lo] = elements[lo], elements[hi]
+		}
+		if less(elements[mid], elements[hi]) {
+			elements[mid], elements[hi] = elements[hi], elements[mid]
 		}
 
-		results = make([]*types.MetricData, n)
+		pivot := elements[hi]
+		p := lo
+		for i := lo; i < hi; i++ {
+			if less(elements[i], pivot) {
+				elements[i], elements[p] = elements[p], elements[i]
+				p++
+			}
+		}
+		elements[p], elements[hi] = elements[hi], elements[p]
 
-		for i := 0; i < n; i++ {
-			v := heap.Pop(&mh).(types.MetricHeapElement)
-			results[i] = arg[v.Idx]
+		switch {
+		case p == k:
+			return
+		case p < k:
+			lo = p + 1
+		default:
+			hi = p - 1
 		}
 	}
-
-	return results, nil
 }
 
 // Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
@@ -2,6 +2,8 @@ package highestLowest
 
 import (
 	"math"
+	"math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -159,8 +161,7 @@ func TestHighest(t *testing.T) {
 				types.MakeMetricData("metricC", []float64{1, 1, 3, 3, 4, 15}, 1, now32),
 				types.MakeMetricData("metricA", []float64{1, 1, 3, 3, 4, 12}, 1, now32),
 				types.MakeMetricData("metricB", []float64{1, 1, 3, 3, 4, 1}, 1, now32),
-				//NOTE(nnuss): highest* functions filter null-valued series as a side-effect when `n` >= number of series
-				//TODO(nnuss): bring lowest* functions into harmony with this side effect or get rid of it
+				// series without values can't be ranked, so both highest* and lowest* functions skip them
 				//types.MakeMetricData("metric0", []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN()}, 1, now32),
 			},
 		},
@@ -214,6 +215,21 @@ func TestHighest(t *testing.T) {
 			},
 		},
 
+		{
+			"lowestCurrent(metric1,2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metric0", []float64{math.NaN(), math.NaN(), math.NaN()}, 1, now32),
+					types.MakeMetricData("metricA", []float64{1, 1, 12}, 1, now32),
+					types.MakeMetricData("metricB", []float64{1, 1, 1}, 1, now32),
+					types.MakeMetricData("metricC", []float64{1, 1, 15}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metricB", []float64{1, 1, 1}, 1, now32),
+				types.MakeMetricData("metricA", []float64{1, 1, 12}, 1, now32),
+			},
+		},
 		{
 			"lowestCurrent(metric1,1)",
 			map[parser.MetricRequest][]*types.MetricData{
@@ -235,3 +251,29 @@ func TestHighest(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectFirst(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 3, 10, 1000} {
+		for _, k := range []int{0, 1, 2, size / 2, size - 1, size} {
+			if k < 0 || k > size {
+				continue
+			}
+			elements := make([]rankedSeries, size)
+			for i := range elements {
+				// duplicates are ordered by index
+				elements[i] = rankedSeries{idx: i, val: float64(rand.Intn(size/2 + 1))}
+			}
+			sorted := append([]rankedSeries(nil), elements...)
+			sort.Slice(sorted, func(i, j int) bool { return higherFirst(sorted[i], sorted[j]) })
+
+			selectFirst(elements, k, higherFirst)
+			first := elements[:k]
+			sort.Slice(first, func(i, j int) bool { return higherFirst(first[i], first[j]) })
+			for i := range first {
+				if first[i] != sorted[i] {
+					t.Fatalf("size %d, k %d: element %d is %v, expected %v", size, k, i, first[i], sorted[i])
+				}
+			}
+		}
+	}
+}
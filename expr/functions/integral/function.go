@@ -27,16 +27,26 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-// integral(seriesList)
+// integral(seriesList, interval=None)
 func (f *integral) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	interval, err := helper.GetIntervalNamedOrPosArgDefault(e, "interval", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	return helper.ForEachSeriesDo(e, from, until, values, func(a *types.MetricData, r *types.MetricData) *types.MetricData {
+		scale := 1.0
+		if interval > 0 {
+			// values are rates per interval, so each of them covers step/interval intervals
+			scale = float64(a.StepTime) / float64(interval)
+		}
 		current := 0.0
 		for i, v := range a.Values {
 			if math.IsNaN(v) {
 				r.Values[i] = math.NaN()
 				continue
 			}
-			current += v
+			current += v * scale
 			r.Values[i] = current
 		}
 		return r
@@ -47,8 +57,8 @@ func (f *integral) Do(e parser.Expr, from, until int64, values map[parser.Metric
 func (f *integral) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"integral": {
-			Description: "This will show the sum over time, sort of like a continuous addition function.\nUseful for finding totals or trends in metrics that are collected per minute.\n\nExample:\n\n.. code-block:: none\n\n  &target=integral(company.sales.perMinute)\n\nThis would start at zero on the left side of the graph, adding the sales each\nminute, and show the total sales for the time period selected at the right\nside, (time now, or the time specified by '&until=').",
-			Function:    "integral(seriesList)",
+			Description: "This will show the sum over time, sort of like a continuous addition function.\nUseful for finding totals or trends in metrics that are collected per minute.\n\nExample:\n\n.. code-block:: none\n\n  &target=integral(company.sales.perMinute)\n\nThis would start at zero on the left side of the graph, adding the sales each\nminute, and show the total sales for the time period selected at the right\nside, (time now, or the time specified by '&until=').\n\nIf interval (e.x. '1s' or '1min') is specified, values are treated as rates per that interval and\nmultiplied by actual step of the series, which is useful when series have mixed steps.",
+			Function:    "integral(seriesList, interval=None)",
 			Group:       "Transform",
 			Module:      "graphite.render.functions",
 			Name:        "integral",
@@ -58,6 +68,10 @@ func (f *integral) Description() map[string]types.FunctionDescription {
 					Required: true,
 					Type:     types.SeriesList,
 				},
+				{
+					Name: "interval",
+					Type: types.Interval,
+				},
 			},
 		},
 	}
@@ -34,6 +34,13 @@ func TestFunction(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("integral(metric1)",
 				[]float64{1, 1, 3, 6, 10, 15, math.NaN(), 22, 30}, 1, now32)},
 		},
+		{
+			"integral(metric1,interval='1s')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, math.NaN(), 3}, 10, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("integral(metric1)", []float64{10, 30, math.NaN(), 60}, 10, now32)},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,90 @@
+package interpolate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestFunction(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"interpolate(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{math.NaN(), 2, math.NaN(), math.NaN(), 8, 9, math.NaN()}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("interpolate(metric1)", []float64{math.NaN(), 2, 4, 6, 8, 9, math.NaN()}, 1, now32)},
+		},
+		{
+			"interpolate(metric1,2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, math.NaN(), math.NaN(), 4, math.NaN(), math.NaN(), math.NaN(), 8}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("interpolate(metric1,2)", []float64{1, 2, 3, 4, math.NaN(), math.NaN(), math.NaN(), 8}, 1, now32)},
+		},
+		{
+			"interpolate(metric*,limit=1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, math.NaN(), 3}, 1, now32),
+					types.MakeMetricData("metric2", []float64{4, math.NaN(), math.NaN(), 1}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("interpolate(metric1,1)", []float64{1, 2, 3}, 1, now32),
+				types.MakeMetricData("interpolate(metric2,1)", []float64{4, math.NaN(), math.NaN(), 1}, 1, now32),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
+
+func TestConsolidation(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	m := types.MakeMetricData("metric1", []float64{1, math.NaN(), 3, math.NaN()}, 1, now32)
+	m.ConsolidationFunc = "average"
+	m.SetValuesPerPoint(2)
+	// consolidated values are cached, interpolated series should not reuse them
+	m.AggregatedValues()
+
+	exp, _, err := parser.ParseExpr("interpolate(metric1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := metadata.GetEvaluator().EvalExpr(exp, 0, 1, map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", 0, 1}: {m},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []float64{1.5, 3}
+	if !th.NearlyEqual(res[0].AggregatedValues(), expected) {
+		t.Errorf("unexpected consolidated values: got %v, expected %v", res[0].AggregatedValues(), expected)
+	}
+}
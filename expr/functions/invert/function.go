@@ -29,16 +29,12 @@ func New(configFile string) []interfaces.FunctionMetadata {
 
 // invert(seriesList)
 func (f *invert) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
-	return helper.ForEachSeriesDo(e, from, until, values, func(a *types.MetricData, r *types.MetricData) *types.MetricData {
-		for i, v := range a.Values {
-			if v == 0 {
-				r.Values[i] = math.NaN()
-			} else {
-				r.Values[i] = 1 / v
-			}
+	return helper.ForEachSeriesDo(e, from, until, values, helper.PointwiseTransform(func(v float64) float64 {
+		if v == 0 {
+			return math.NaN()
 		}
-		return r
-	})
+		return 1 / v
+	}))
 }
 
 // Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
@@ -56,6 +56,8 @@ func (f *keepLastValue) Do(e parser.Expr, from, until int64, values map[parser.M
 		r := *a
 		r.Name = name
 		r.Values = make([]float64, len(a.Values))
+		// values are changed, so previously consolidated ones are not valid anymore
+		r.SetValuesPerPoint(a.ValuesPerPoint)
 
 		prev := math.NaN()
 		missing := 0
@@ -40,6 +40,13 @@ func (f *limit) Do(e parser.Expr, from, until int64, values map[parser.MetricReq
 	if limit >= len(arg) {
 		return arg, nil
 	}
+	if limit < 0 {
+		// like python slices, negative limit drops series from the end
+		limit += len(arg)
+		if limit < 0 {
+			return nil, nil
+		}
+	}
 
 	return arg[:limit], nil
 }
@@ -62,6 +62,23 @@ func TestLimit(t *testing.T) {
 				"metricE": {types.MakeMetricData("metricE", []float64{0, 0, 0, 0, 0, 1}, 1, now32)},
 			},
 		},
+		{
+			"limit(metric1,-3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metricA", []float64{0, 1, 0, 0, 0, 0}, 1, now32),
+					types.MakeMetricData("metricB", []float64{0, 0, 1, 0, 0, 0}, 1, now32),
+					types.MakeMetricData("metricC", []float64{0, 0, 0, 1, 0, 0}, 1, now32),
+					types.MakeMetricData("metricD", []float64{0, 0, 0, 0, 1, 0}, 1, now32),
+					types.MakeMetricData("metricE", []float64{0, 0, 0, 0, 0, 1}, 1, now32),
+				},
+			},
+			"limit",
+			map[string][]*types.MetricData{
+				"metricA": {types.MakeMetricData("metricA", []float64{0, 1, 0, 0, 0, 0}, 1, now32)},
+				"metricB": {types.MakeMetricData("metricB", []float64{0, 0, 1, 0, 0, 0}, 1, now32)},
+			},
+		},
 	}
 
 	for _, tt := range tests {
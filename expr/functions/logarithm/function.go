@@ -56,14 +56,19 @@ func (f *logarithm) Do(e parser.Expr, from, until int64, values map[parser.Metri
 			name = fmt.Sprintf("logarithm(%s)", a.Name)
 		}
 
-		r := *a
+		r := a.CopyLink()
 		r.Name = name
 		r.Values = make([]float64, len(a.Values))
 
 		for i, v := range a.Values {
+			// logarithm is not defined for values that are not positive, graphite-web returns None for them
+			if v <= 0 {
+				r.Values[i] = math.NaN()
+				continue
+			}
 			r.Values[i] = math.Log(v) / baseLog
 		}
-		results = append(results, &r)
+		results = append(results, r)
 	}
 	return results, nil
 }
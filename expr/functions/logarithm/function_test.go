@@ -1,6 +1,7 @@
 package logarithm
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -41,6 +42,14 @@ func TestFunction(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("logarithm(metric1,2)",
 				[]float64{0, 1, 2, 3, 4, 5}, 1, now32)},
 		},
+		{
+			"logarithm(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{-10, 0, 10, math.NaN(), 100}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("logarithm(metric1)",
+				[]float64{math.NaN(), math.NaN(), 1, math.NaN(), 2}, 1, now32)},
+		},
 	}
 
 	for _, tt := range tests {
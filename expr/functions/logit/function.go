@@ -0,0 +1,58 @@
+package logit
+
+import (
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type logit struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &logit{}
+	functions := []string{"logit"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// logit(seriesList)
+func (f *logit) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	return helper.ForEachSeriesDo(e, from, until, values, helper.PointwiseTransform(func(v float64) float64 {
+		if v <= 0 || v >= 1 {
+			return math.NaN()
+		}
+		return math.Log(v / (1 - v))
+	}))
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *logit) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"logit": {
+			Description: "Takes one metric or a wildcard seriesList and applies the logit\nfunction `log(x / (1 - x))` to each datapoint.\n\nExample:\n\n.. code-block:: none\n\n  &target=logit(Server.instance01.threads.busy)",
+			Function:    "logit(seriesList)",
+			Group:       "Transform",
+			Module:      "graphite.render.functions",
+			Name:        "logit",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+			},
+		},
+	}
+}
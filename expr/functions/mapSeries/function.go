@@ -5,7 +5,6 @@ import (
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
-	"strings"
 )
 
 type mapSeries struct {
@@ -34,35 +33,15 @@ func (f *mapSeries) Do(e parser.Expr, from, until int64, values map[parser.Metri
 		return nil, err
 	}
 
-	var fields []int
-
-	fields, err = e.GetIntArgs(1)
+	nodes, err := e.GetNodeOrTagArgs(1)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []*types.MetricData
-
-	groups := make(map[string][]*types.MetricData)
-	var nodeList []string
-
-	for _, a := range args {
-		metric := helper.ExtractMetric(a.Name)
-		nodes := strings.Split(metric, ".")
-		nodeKey := make([]string, 0, len(fields))
-		for _, f := range fields {
-			nodeKey = append(nodeKey, nodes[f])
-		}
-		node := strings.Join(nodeKey, ".")
-		if len(groups[node]) == 0 {
-			nodeList = append(nodeList, node)
-		}
-
-		groups[node] = append(groups[node], a)
-	}
-
-	for _, node := range nodeList {
-		results = append(results, groups[node]...)
+	groups, keys := helper.GroupByNodes(args, nodes)
+	results := make([]*types.MetricData, 0, len(args))
+	for _, key := range keys {
+		results = append(results, groups[key]...)
 	}
 
 	return results, nil
@@ -50,6 +50,23 @@ func TestFunction(t *testing.T) {
 				types.MakeMetricData("servers.server4.cpu.total", []float64{12, 13, 14}, 1, now32),
 			},
 		},
+		{
+			"mapSeries(servers.*.cpu.*, -3, \"dc\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"servers.*.cpu.*", 0, 1}: {
+					types.MakeMetricData("servers.server1.cpu.valid;dc=us", []float64{1, 2, 3}, 1, now32),
+					types.MakeMetricData("servers.server1.cpu.valid;dc=eu", []float64{6, 7, 8}, 1, now32),
+					types.MakeMetricData("servers.server1.cpu.total;dc=us", []float64{1, 2, 4}, 1, now32),
+					types.MakeMetricData("servers.server1.cpu.total;dc=eu", []float64{5, 7, 8}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("servers.server1.cpu.valid;dc=us", []float64{1, 2, 3}, 1, now32),
+				types.MakeMetricData("servers.server1.cpu.total;dc=us", []float64{1, 2, 4}, 1, now32),
+				types.MakeMetricData("servers.server1.cpu.valid;dc=eu", []float64{6, 7, 8}, 1, now32),
+				types.MakeMetricData("servers.server1.cpu.total;dc=eu", []float64{5, 7, 8}, 1, now32),
+			},
+		},
 	}
 
 	for _, tt := range tests {
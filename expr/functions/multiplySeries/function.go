@@ -36,27 +36,33 @@ func (f *multiplySeries) Do(e parser.Expr, from, until int64, values map[parser.
 			StopTime:  until,
 		},
 	}
+	var series []*types.MetricData
 	for _, arg := range e.Args() {
-		series, err := helper.GetSeriesArg(arg, from, until, values)
+		argSeries, err := helper.GetSeriesArg(arg, from, until, values)
 		if err != nil {
 			return nil, err
 		}
+		series = append(series, argSeries...)
+	}
+	step := series[0].StepTime
+	series, err := helper.NormalizeSteps(series)
+	if err != nil {
+		return nil, err
+	}
+	if series[0].StepTime != step {
+		r.StartTime = series[0].StartTime
+		r.StopTime = series[0].StopTime
+	}
 
-		if r.Values == nil {
-			r.StepTime = series[0].StepTime
-			r.Values = make([]float64, len(series[0].Values))
-			copy(r.Values, series[0].Values)
-			series = series[1:]
-		}
-
-		if r.ConsolidationFunc == "" && len(series) > 0 {
-			r.ConsolidationFunc = series[0].ConsolidationFunc
+	r.StepTime = series[0].StepTime
+	r.Values = make([]float64, len(series[0].Values))
+	copy(r.Values, series[0].Values)
+	for _, factor := range series[1:] {
+		if r.ConsolidationFunc == "" {
+			r.ConsolidationFunc = factor.ConsolidationFunc
 		}
-
-		for _, factor := range series {
-			for i, v := range r.Values {
-				r.Values[i] = v * factor.Values[i]
-			}
+		for i, v := range r.Values {
+			r.Values[i] = v * factor.Values[i]
 		}
 	}
 
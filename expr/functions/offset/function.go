@@ -39,14 +39,14 @@ func (f *offset) Do(e parser.Expr, from, until int64, values map[parser.MetricRe
 	var results []*types.MetricData
 
 	for _, a := range arg {
-		r := *a
+		r := a.CopyLink()
 		r.Name = fmt.Sprintf("offset(%s,%g)", a.Name, factor)
 		r.Values = make([]float64, len(a.Values))
 
 		for i, v := range a.Values {
 			r.Values[i] = v + factor
 		}
-		results = append(results, &r)
+		results = append(results, r)
 	}
 	return results, nil
 }
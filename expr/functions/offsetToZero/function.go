@@ -36,10 +36,9 @@ func (f *offsetToZero) Do(e parser.Expr, from, until int64, values map[parser.Me
 				minimum = v
 			}
 		}
-		for i, v := range a.Values {
-			r.Values[i] = v - minimum
-		}
-		return r
+		return helper.PointwiseTransform(func(v float64) float64 {
+			return v - minimum
+		})(a, r)
 	})
 }
 
@@ -29,7 +29,7 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-// perSecond(seriesList, maxValue=None)
+// perSecond(seriesList, maxValue=None, minValue=None, resetThreshold=None)
 func (f *perSecond) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
@@ -44,6 +44,10 @@ func (f *perSecond) Do(e parser.Expr, from, until int64, values map[parser.Metri
 	if err != nil {
 		return nil, err
 	}
+	resetThreshold, err := e.GetFloatNamedOrPosArgDefault("resetThreshold", 3, math.NaN())
+	if err != nil {
+		return nil, err
+	}
 	hasMax := !math.IsNaN(maxValue)
 	hasMin := !math.IsNaN(minValue)
 
@@ -89,6 +93,9 @@ func (f *perSecond) Do(e parser.Expr, from, until int64, values map[parser.Metri
 			}
 			// TODO(civil): Figure out if we can optimize this now when we have NaNs
 			diff := v - prev
+			if diff < 0 && !hasMax && !hasMin {
+				diff = helper.CounterDelta(v, prev, resetThreshold)
+			}
 			if diff >= 0 {
 				r.Values[i] = diff / float64(a.StepTime)
 			} else if hasMax && maxValue >= v {
@@ -109,8 +116,8 @@ func (f *perSecond) Do(e parser.Expr, from, until int64, values map[parser.Metri
 func (f *perSecond) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"perSecond": {
-			Description: "NonNegativeDerivative adjusted for the series time interval\nThis is useful for taking a running total metric and showing how many requests\nper second were handled.\n\nExample:\n\n.. code-block:: none\n\n  &target=perSecond(company.server.application01.ifconfig.TXPackets)\n\nEach time you run ifconfig, the RX and TXPackets are higher (assuming there\nis network traffic.) By applying the perSecond function, you can get an\nidea of the packets per second sent or received, even though you're only\nrecording the total.",
-			Function:    "perSecond(seriesList, maxValue=None)",
+			Description: "NonNegativeDerivative adjusted for the series time interval\nThis is useful for taking a running total metric and showing how many requests\nper second were handled.\n\nExample:\n\n.. code-block:: none\n\n  &target=perSecond(company.server.application01.ifconfig.TXPackets)\n\nEach time you run ifconfig, the RX and TXPackets are higher (assuming there\nis network traffic.) By applying the perSecond function, you can get an\nidea of the packets per second sent or received, even though you're only\nrecording the total.\n\nIf resetThreshold is specified and neither maxValue nor minValue are, decrease by at least that amount\nis treated as a counter reset and current value is used as a delta.",
+			Function:    "perSecond(seriesList, maxValue=None, minValue=None, resetThreshold=None)",
 			Group:       "Transform",
 			Module:      "graphite.render.functions",
 			Name:        "perSecond",
@@ -128,6 +135,10 @@ func (f *perSecond) Description() map[string]types.FunctionDescription {
 					Name: "minValue",
 					Type: types.Float,
 				},
+				{
+					Name: "resetThreshold",
+					Type: types.Float,
+				},
 			},
 		},
 	}
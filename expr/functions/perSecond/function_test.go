@@ -47,6 +47,13 @@ func TestPerSecond(t *testing.T) {
 			},
 			[]*types.MetricData{types.MakeMetricData("perSecond(metric1,minValue=1)", []float64{math.NaN(), math.NaN(), 1, 1, 1, 26, 2, 29, math.NaN()}, 1, now32)},
 		},
+		{
+			"perSecond(metric1,resetThreshold=10)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{20, 40, 5, 7, 6, 16}, 2, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("perSecond(metric1)", []float64{math.NaN(), 10, 2.5, 1, math.NaN(), 5}, 2, now32)},
+		},
 	}
 
 	for _, tt := range tests {
@@ -20,15 +20,28 @@ func GetOrder() interfaces.Order {
 func New(configFile string) []interfaces.FunctionMetadata {
 	res := make([]interfaces.FunctionMetadata, 0)
 	f := &pow{}
-	functions := []string{"pow"}
+	functions := []string{"pow", "powSeries"}
 	for _, n := range functions {
 		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
 	}
 	return res
 }
 
-// pow(seriesList,factor)
+// safePow returns NaN instead of complex and infinite results
+func safePow(x, y float64) float64 {
+	v := math.Pow(x, y)
+	if math.IsInf(v, 0) {
+		return math.NaN()
+	}
+	return v
+}
+
+// pow(seriesList,factor), powSeries(*seriesLists)
 func (f *pow) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	if e.Target() == "powSeries" {
+		return f.doPowSeries(e, from, until, values)
+	}
+
 	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
 		return nil, err
@@ -44,14 +57,32 @@ func (f *pow) Do(e parser.Expr, from, until int64, values map[parser.MetricReque
 		r.Name = fmt.Sprintf("pow(%s,%g)", a.Name, factor)
 		r.Values = make([]float64, len(a.Values))
 
-		for i, v := range a.Values {
-			r.Values[i] = math.Pow(v, factor)
-		}
-		results = append(results, &r)
+		results = append(results, helper.PointwiseTransform(func(v float64) float64 {
+			return safePow(v, factor)
+		})(a, &r))
 	}
 	return results, nil
 }
 
+func (f *pow) doPowSeries(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArgsAndRemoveNonExisting(e, from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return helper.AggregateSeries(e, args, func(values []float64) float64 {
+		v := values[0]
+		for _, factor := range values[1:] {
+			// NaN propagates through math.Pow except for pow(NaN, 0) and pow(1, NaN)
+			if math.IsNaN(v) || math.IsNaN(factor) {
+				return math.NaN()
+			}
+			v = safePow(v, factor)
+		}
+		return v
+	})
+}
+
 // Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
 func (f *pow) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
@@ -74,5 +105,20 @@ func (f *pow) Description() map[string]types.FunctionDescription {
 				},
 			},
 		},
+		"powSeries": {
+			Description: "Takes two or more series and pows their points. A constant line may be\nused.\n\nExample:\n\n.. code-block:: none\n\n  &target=powSeries(Server.instance01.app.requests, Server.instance01.app.replies)",
+			Function:    "powSeries(*seriesLists)",
+			Group:       "Combine",
+			Module:      "graphite.render.functions",
+			Name:        "powSeries",
+			Params: []types.FunctionParam{
+				{
+					Multiple: true,
+					Name:     "seriesLists",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+			},
+		},
 	}
 }
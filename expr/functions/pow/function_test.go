@@ -33,6 +33,32 @@ func TestFunction(t *testing.T) {
 			},
 			[]*types.MetricData{types.MakeMetricData("pow(metric1,3)", []float64{125, 1, math.NaN(), 0, 1728, 1953125, 1124.864, 1.331}, 1, now32)},
 		},
+		{
+			"pow(metric1,0.5)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{4, -4, math.NaN()}, 60, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("pow(metric1,0.5)", []float64{2, math.NaN(), math.NaN()}, 1, now32)},
+		},
+		{
+			"powSeries(metric1,metric2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{2, 1, math.NaN(), 0, 3, -2}, 1, now32)},
+				{"metric2", 0, 1}: {types.MakeMetricData("metric2", []float64{3, math.NaN(), 0, 0, -1, 0.5}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("powSeries(metric1,metric2)", []float64{8, math.NaN(), math.NaN(), 1, 1.0 / 3, math.NaN()}, 1, now32)},
+		},
+		{
+			"powSeries(metric*)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{2, 3}, 1, now32),
+					types.MakeMetricData("metric2", []float64{3, 2}, 1, now32),
+					types.MakeMetricData("metric3", []float64{2, 1}, 1, now32),
+				},
+			},
+			[]*types.MetricData{types.MakeMetricData("powSeries(metric*)", []float64{64, 9}, 1, now32)},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1,12 +1,14 @@
 package reduce
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
-
-	"strings"
 )
 
 type reduce struct {
@@ -61,42 +63,62 @@ func (f *reduce) Do(e parser.Expr, from, until int64, values map[parser.MetricRe
 		reduceMatchers[i-matchersStartIndex] = reduceMatcher
 	}
 
-	var results []*types.MetricData
-
-	reduceGroups := make(map[string]map[string]*types.MetricData)
-	reducedValues := values
-	var aliasNames []string
-
-	for _, series := range seriesList {
-		metric := helper.ExtractMetric(series.Name)
-		nodes := strings.Split(metric, ".")
-		reduceNodeKey := nodes[reduceNode]
-		nodes[reduceNode] = "reduce." + reduceFunction
-		aliasName := strings.Join(nodes, ".")
-		_, exist := reduceGroups[aliasName]
-		if !exist {
-			reduceGroups[aliasName] = make(map[string]*types.MetricData)
-			aliasNames = append(aliasNames, aliasName)
+	reduceName := reduceFunction
+	if isReduceExpr(reduceFunction) {
+		// validate the expression once, it's parsed again for each group
+		reducer, _, err := parser.ParseExpr(reduceFunction)
+		if err != nil {
+			return nil, err
 		}
+		reduceName = reducer.Target()
+	}
 
-		reduceGroups[aliasName][reduceNodeKey] = series
-		valueKey := parser.MetricRequest{series.Name, from, until}
-		reducedValues[valueKey] = append(reducedValues[valueKey], series)
+	// series are added to a copy of values, so the caller's map isn't modified
+	reducedValues := make(map[parser.MetricRequest][]*types.MetricData, len(values)+len(seriesList))
+	for k, v := range values {
+		reducedValues[k] = v
+	}
+	for _, series := range seriesList {
+		reducedValues[parser.MetricRequest{Metric: series.Name, From: from, Until: until}] = []*types.MetricData{series}
 	}
-AliasLoop:
-	for _, aliasName := range aliasNames {
 
-		reducedNodes := make([]parser.Expr, len(reduceMatchers))
+	var results []*types.MetricData
+	for _, group := range reduceGroups(e.Args()[0], seriesList, reduceNode, reduceName) {
+		matchedSeries := make(map[string]*types.MetricData)
+		var aliasName string
+		for _, series := range group {
+			nodes := strings.Split(helper.ExtractMetric(strings.SplitN(series.Name, ";", 2)[0]), ".")
+			if reduceNode < 0 || reduceNode >= len(nodes) {
+				return nil, fmt.Errorf("reduceNode %d is out of range of series %s", reduceNode, series.Name)
+			}
+			if _, ok := matchedSeries[nodes[reduceNode]]; ok {
+				continue
+			}
+			matchedSeries[nodes[reduceNode]] = series
+			if aliasName == "" {
+				nodes[reduceNode] = "reduce." + reduceName
+				aliasName = strings.Join(nodes, ".")
+			}
+		}
+
+		matched := make([]*types.MetricData, len(reduceMatchers))
+		complete := true
 		for i, reduceMatcher := range reduceMatchers {
-			matched, ok := reduceGroups[aliasName][reduceMatcher]
-			if !ok {
-				continue AliasLoop
+			matched[i], complete = matchedSeries[reduceMatcher]
+			if !complete {
+				break
 			}
-			reducedNodes[i] = parser.NewTargetExpr(matched.Name)
+		}
+		if !complete {
+			continue
 		}
 
+		reducer, err := reduceExpr(reduceFunction, matched)
+		if err != nil {
+			return nil, err
+		}
 		result, err := f.Evaluator.EvalExpr(parser.NewExprTyped("alias", []parser.Expr{
-			parser.NewExprTyped(reduceFunction, reducedNodes),
+			reducer,
 			parser.NewValueExpr(aliasName),
 		}), from, until, reducedValues)
 
@@ -110,6 +132,87 @@ AliasLoop:
 	return results, nil
 }
 
+// reduceGroups splits series into groups, that are reduced separately. Series mapped by mapSeries are grouped by its
+// mapNodes, other series are grouped by their names with reduceNode replaced
+func reduceGroups(arg parser.Expr, seriesList []*types.MetricData, reduceNode int, reduceName string) [][]*types.MetricData {
+	var groups map[string][]*types.MetricData
+	var keys []string
+	if arg.IsFunc() && (arg.Target() == "mapSeries" || arg.Target() == "map") {
+		if nodes, err := arg.GetNodeOrTagArgs(1); err == nil {
+			groups, keys = helper.GroupByNodes(seriesList, nodes)
+		}
+	}
+	if groups == nil {
+		groups = make(map[string][]*types.MetricData)
+		for _, series := range seriesList {
+			nodes := strings.Split(helper.ExtractMetric(strings.SplitN(series.Name, ";", 2)[0]), ".")
+			if reduceNode >= 0 && reduceNode < len(nodes) {
+				nodes[reduceNode] = "reduce." + reduceName
+			}
+			key := strings.Join(nodes, ".")
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], series)
+		}
+	}
+
+	res := make([][]*types.MetricData, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, groups[key])
+	}
+	return res
+}
+
+// isReduceExpr checks if reduceFunction is an expression (e.x. "asPercent(scale($1, 8), $2)") instead of a function name
+func isReduceExpr(reduceFunction string) bool {
+	return strings.Contains(reduceFunction, "(")
+}
+
+// reduceExpr returns expression, that reduces matched series. The function name is called with matched series as
+// arguments, in the expression matched series are referenced by $1, $2, ... in order of reduceMatchers
+func reduceExpr(reduceFunction string, matched []*types.MetricData) (parser.Expr, error) {
+	if !isReduceExpr(reduceFunction) {
+		args := make([]parser.Expr, len(matched))
+		for i, series := range matched {
+			args[i] = parser.NewTargetExpr(series.Name)
+		}
+		return parser.NewExprTyped(reduceFunction, args), nil
+	}
+
+	reducer, _, err := parser.ParseExpr(reduceFunction)
+	if err != nil {
+		return nil, err
+	}
+	if err := substituteMatched(reducer, matched); err != nil {
+		return nil, err
+	}
+	return reducer, nil
+}
+
+// substituteMatched replaces references of matched series in the expression by their names
+func substituteMatched(e parser.Expr, matched []*types.MetricData) error {
+	if e.IsName() && strings.HasPrefix(e.Target(), "$") {
+		i, err := strconv.Atoi(e.Target()[1:])
+		if err != nil || i < 1 || i > len(matched) {
+			return fmt.Errorf("unknown reference %s to matched series", e.Target())
+		}
+		e.SetTarget(matched[i-1].Name)
+		return nil
+	}
+	for _, arg := range e.Args() {
+		if err := substituteMatched(arg, matched); err != nil {
+			return err
+		}
+	}
+	for _, arg := range e.NamedArgs() {
+		if err := substituteMatched(arg, matched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
 func (f *reduce) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
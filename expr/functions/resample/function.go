@@ -0,0 +1,190 @@
+package resample
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+type resample struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &resample{}
+	functions := []string{"resample", "changeResolution"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+var upsampleMethods = []string{"repeat", "interpolate"}
+
+// resample(seriesList, intervalString, func='average', method='repeat')
+func (f *resample) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	step32, err := e.GetIntervalArg(1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if step32 <= 0 {
+		return nil, parser.ErrBadType
+	}
+	step := int64(step32)
+
+	aggFunc, err := e.GetStringNamedOrPosArgDefault("func", 2, "average")
+	if err != nil {
+		return nil, err
+	}
+	if !consolidations.IsValidSummarizer(aggFunc) {
+		return nil, fmt.Errorf("unsupported func '%s'", aggFunc)
+	}
+	_, funcOk := e.NamedArgs()["func"]
+	if !funcOk {
+		funcOk = len(e.Args()) > 2
+	}
+
+	method, err := e.GetStringNamedOrPosArgDefault("method", 3, "repeat")
+	if err != nil {
+		return nil, err
+	}
+	if method != "repeat" && method != "interpolate" {
+		return nil, fmt.Errorf("unsupported method '%s', supported: %v", method, upsampleMethods)
+	}
+	_, methodOk := e.NamedArgs()["method"]
+	if !methodOk {
+		methodOk = len(e.Args()) > 3
+	}
+
+	results := make([]*types.MetricData, 0, len(args))
+	for _, arg := range args {
+		name := fmt.Sprintf("%s(%s,'%s'", e.Target(), arg.Name, e.Args()[1].StringValue())
+		if funcOk || methodOk {
+			name += fmt.Sprintf(",'%s'", aggFunc)
+		}
+		if methodOk {
+			name += fmt.Sprintf(",'%s'", method)
+		}
+		name += ")"
+
+		start, stop := helper.AlignToBucketSize(arg.StartTime, arg.StopTime, step)
+		r := &types.MetricData{FetchResponse: pb.FetchResponse{
+			Name:              name,
+			Values:            make([]float64, helper.GetBuckets(start, stop, step)),
+			StepTime:          step,
+			StartTime:         start,
+			StopTime:          stop,
+			XFilesFactor:      arg.XFilesFactor,
+			PathExpression:    arg.PathExpression,
+			ConsolidationFunc: arg.ConsolidationFunc,
+		}, Tags: arg.Tags}
+
+		if step >= arg.StepTime {
+			downsample(arg, r, aggFunc)
+		} else {
+			upsample(arg, r, method == "interpolate")
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// downsample aggregates all non-null values of arg that fall into each step of r
+func downsample(arg, r *types.MetricData, aggFunc string) {
+	buckets := make([][]float64, len(r.Values))
+	for i, v := range arg.Values {
+		if math.IsNaN(v) {
+			continue
+		}
+		idx := (arg.StartTime + int64(i)*arg.StepTime - r.StartTime) / r.StepTime
+		if idx >= 0 && idx < int64(len(buckets)) {
+			buckets[idx] = append(buckets[idx], v)
+		}
+	}
+	for i, b := range buckets {
+		r.Values[i] = consolidations.SummarizeValues(aggFunc, b)
+	}
+}
+
+// upsample fills each step of r with the value of arg that covers it, optionally interpolating to the next value
+func upsample(arg, r *types.MetricData, interpolate bool) {
+	for i := range r.Values {
+		t := r.StartTime + int64(i)*r.StepTime
+		if t < arg.StartTime {
+			r.Values[i] = math.NaN()
+			continue
+		}
+		idx := int((t - arg.StartTime) / arg.StepTime)
+		if idx >= len(arg.Values) {
+			r.Values[i] = math.NaN()
+			continue
+		}
+
+		v := arg.Values[idx]
+		if interpolate && idx+1 < len(arg.Values) && !math.IsNaN(arg.Values[idx+1]) {
+			frac := float64(t-arg.StartTime-int64(idx)*arg.StepTime) / float64(arg.StepTime)
+			v += (arg.Values[idx+1] - v) * frac
+		}
+		r.Values[i] = v
+	}
+}
+
+func (f *resample) Description() map[string]types.FunctionDescription {
+	res := make(map[string]types.FunctionDescription)
+	for _, n := range []string{"resample", "changeResolution"} {
+		res[n] = types.FunctionDescription{
+			Description: "Resamples each series to the specified step, so series with different retentions can be combined\nwithout implicit normalization.\n\nIf the new step is bigger than the step of the series, all non-null values within each new step are\naggregated by func. Otherwise each value is repeated or, if method is 'interpolate', linearly\ninterpolated towards the next one.\n\nExample:\n\n.. code-block:: none\n\n  &target=divideSeries(resample(app.errors, '1min', 'sum'), resample(app.requests, '1min', 'sum'))",
+			Function:    n + "(seriesList, intervalString, func='average', method='repeat')",
+			Group:       "Transform",
+			Module:      "graphite.render.functions.custom",
+			Name:        n,
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "intervalString",
+					Required: true,
+					Suggestions: types.NewSuggestions(
+						"10s",
+						"1min",
+						"5min",
+						"1h",
+					),
+					Type: types.Interval,
+				},
+				{
+					Name:    "func",
+					Default: types.NewSuggestion("average"),
+					Options: consolidations.AvailableSummarizers,
+					Type:    types.AggFunc,
+				},
+				{
+					Name:    "method",
+					Default: types.NewSuggestion("repeat"),
+					Options: upsampleMethods,
+					Type:    types.String,
+				},
+			},
+		}
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package resample
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestFunction(t *testing.T) {
+	tests := []th.EvalTestItem{
+		{
+			"resample(metric1,'20s')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 3, math.NaN(), 4, math.NaN(), math.NaN()}, 10, 0)},
+			},
+			[]*types.MetricData{types.MakeMetricData("resample(metric1,'20s')", []float64{2, 4, math.NaN()}, 20, 0)},
+		},
+		{
+			"resample(metric1,'30s','sum')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5}, 10, 0)},
+			},
+			[]*types.MetricData{types.MakeMetricData("resample(metric1,'30s','sum')", []float64{6, 9}, 30, 0)},
+		},
+		{
+			"changeResolution(metric1,'5s')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 3, math.NaN()}, 10, 0)},
+			},
+			[]*types.MetricData{types.MakeMetricData("changeResolution(metric1,'5s')", []float64{1, 1, 3, 3, math.NaN(), math.NaN()}, 5, 0)},
+		},
+		{
+			"resample(metric1,'5s',method='interpolate')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 3, math.NaN()}, 10, 0)},
+			},
+			[]*types.MetricData{types.MakeMetricData("resample(metric1,'5s','average','interpolate')", []float64{1, 2, 3, 3, math.NaN(), math.NaN()}, 5, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
+
+func TestStep(t *testing.T) {
+	exp, _, err := parser.ParseExpr("resample(metric1,'1min','max')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := metadata.GetEvaluator().EvalExpr(exp, 0, 1, map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6, 7}, 10, 0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(res))
+	}
+	if res[0].StepTime != 60 || res[0].StartTime != 0 || res[0].StopTime != 120 {
+		t.Errorf("unexpected time range: step=%d start=%d stop=%d", res[0].StepTime, res[0].StartTime, res[0].StopTime)
+	}
+}
+
+func TestBadArgs(t *testing.T) {
+	for _, target := range []string{
+		"resample(metric1,'1min','foo')",
+		"resample(metric1,'1min',method='foo')",
+	} {
+		exp, _, err := parser.ParseExpr(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = metadata.GetEvaluator().EvalExpr(exp, 0, 1, map[parser.MetricRequest][]*types.MetricData{
+			{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2}, 10, 0)},
+		})
+		if err == nil {
+			t.Errorf("%s: expected error", target)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package round
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type round struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &round{}
+	functions := []string{"round"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// roundToPrecision rounds v to precision decimal places, negative precision rounds to tens, hundreds, etc.
+func roundToPrecision(v float64, precision int) float64 {
+	if precision < 0 {
+		factor := math.Pow10(-precision)
+		return math.Round(v/factor) * factor
+	}
+	factor := math.Pow10(precision)
+	return math.Round(v*factor) / factor
+}
+
+// round(seriesList, precision=None)
+func (f *round) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+	precision, err := e.GetIntNamedOrPosArgDefault("precision", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, ok := e.NamedArgs()["precision"]
+	if !ok {
+		ok = len(e.Args()) > 1
+	}
+
+	var results []*types.MetricData
+	for _, a := range arg {
+		r := a.CopyLink()
+		if ok {
+			r.Name = fmt.Sprintf("round(%s,%d)", a.Name, precision)
+		} else {
+			r.Name = fmt.Sprintf("round(%s)", a.Name)
+		}
+		r.Values = make([]float64, len(a.Values))
+
+		results = append(results, helper.PointwiseTransform(func(v float64) float64 {
+			return roundToPrecision(v, precision)
+		})(a, r))
+	}
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *round) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"round": {
+			Description: "Takes one metric or a wildcard seriesList optionally followed by a precision, and rounds each\ndatapoint to the specified precision.\n\nExample:\n\n.. code-block:: none\n\n  &target=round(Server.instance01.threads.busy)\n  &target=round(Server.instance01.threads.busy,2)",
+			Function:    "round(seriesList, precision=None)",
+			Group:       "Transform",
+			Module:      "graphite.render.functions",
+			Name:        "round",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name: "precision",
+					Type: types.Integer,
+				},
+			},
+		},
+	}
+}
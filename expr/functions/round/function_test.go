@@ -0,0 +1,62 @@
+package round
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestFunction(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"round(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1.4, 1.5, -1.5, 0.3333333333333333, math.NaN()}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("round(metric1)",
+				[]float64{1, 2, -2, 0, math.NaN()}, 1, now32)},
+		},
+		{
+			"round(metric1,2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1.234, 0.3333333333333333, 2, math.NaN()}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("round(metric1,2)",
+				[]float64{1.23, 0.33, 2, math.NaN()}, 1, now32)},
+		},
+		{
+			"round(metric1,precision=-2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1234, 1250, 49}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("round(metric1,-2)",
+				[]float64{1200, 1300, 0}, 1, now32)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+
+}
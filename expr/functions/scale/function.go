@@ -39,14 +39,14 @@ func (f *scale) Do(e parser.Expr, from, until int64, values map[parser.MetricReq
 	var results []*types.MetricData
 
 	for _, a := range arg {
-		r := *a
+		r := a.CopyLink()
 		r.Name = fmt.Sprintf("scale(%s,%g)", a.Name, scale)
 		r.Values = make([]float64, len(a.Values))
 
 		for i, v := range a.Values {
 			r.Values[i] = v * scale
 		}
-		results = append(results, &r)
+		results = append(results, r)
 	}
 	return results, nil
 }
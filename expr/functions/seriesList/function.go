@@ -57,7 +57,11 @@ func (f *seriesList) Do(e parser.Expr, from, until int64, values map[parser.Metr
 		compute = func(l, r float64) float64 { return math.Pow(l, r) }
 	}
 	for i, numerator := range numerators {
-		denominator := denominators[i]
+		normalized, err := helper.NormalizeSteps([]*types.MetricData{numerator, denominators[i]})
+		if err != nil {
+			return nil, err
+		}
+		numerator, denominator := normalized[0], normalized[1]
 		if numerator.StepTime != denominator.StepTime || len(numerator.Values) != len(denominator.Values) {
 			return nil, fmt.Errorf("series %s must have the same length as %s", numerator.Name, denominator.Name)
 		}
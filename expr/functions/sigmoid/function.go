@@ -0,0 +1,55 @@
+package sigmoid
+
+import (
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type sigmoid struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &sigmoid{}
+	functions := []string{"sigmoid"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// sigmoid(seriesList)
+func (f *sigmoid) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	return helper.ForEachSeriesDo(e, from, until, values, helper.PointwiseTransform(func(v float64) float64 {
+		return 1 / (1 + math.Exp(-v))
+	}))
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *sigmoid) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"sigmoid": {
+			Description: "Takes one metric or a wildcard seriesList and applies the sigmoid\nfunction `1 / (1 + exp(-x))` to each datapoint.\n\nExample:\n\n.. code-block:: none\n\n  &target=sigmoid(Server.instance01.threads.busy)",
+			Function:    "sigmoid(seriesList)",
+			Group:       "Transform",
+			Module:      "graphite.render.functions",
+			Name:        "sigmoid",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+			},
+		},
+	}
+}
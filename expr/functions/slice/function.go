@@ -0,0 +1,132 @@
+package slice
+
+import (
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type slice struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &slice{}
+	functions := []string{"sliceSeries", "pickSeries"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// sliceSeries(seriesList, start, stop=None)
+// pickSeries(seriesList, *indexes)
+func (f *slice) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Target() == "pickSeries" {
+		indexes, err := e.GetIntArgs(1)
+		if err != nil {
+			return nil, err
+		}
+		picked := make(map[int]bool, len(indexes))
+		var results []*types.MetricData
+		for _, i := range indexes {
+			if i < 0 {
+				i += len(args)
+			}
+			if i < 0 || i >= len(args) || picked[i] {
+				continue
+			}
+			picked[i] = true
+			results = append(results, args[i])
+		}
+		return results, nil
+	}
+
+	start, err := e.GetIntArg(1)
+	if err != nil {
+		return nil, err
+	}
+	stop, err := e.GetIntArgDefault(2, len(args))
+	if err != nil {
+		return nil, err
+	}
+	start, stop = sliceIndex(start, len(args)), sliceIndex(stop, len(args))
+	if start >= stop {
+		return nil, nil
+	}
+	return args[start:stop], nil
+}
+
+// sliceIndex converts index of a python-like slice to index of the list of length n: negative indexes are counted
+// from the end, indexes out of range are clamped
+func sliceIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+func (f *slice) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"sliceSeries": {
+			Description: "Takes one metric or a wildcard seriesList and returns series from start up to, but not including, stop, like python slices. Negative indexes are counted from the end, stop is the end of the list by default.\n\nSeries keep order of the seriesList: series of path expressions are sorted by name, like in the legend, unless they are reordered by other functions (e.x. sortByMaxima).\n\nExample:\n\n.. code-block:: none\n\n  &target=sliceSeries(server*.instance*.memory.free,10,20)\n\nDraws the second 10 of matched series.",
+			Function:    "sliceSeries(seriesList, start, stop=None)",
+			Group:       "Filter Series",
+			Module:      "graphite.render.functions.custom",
+			Name:        "sliceSeries",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "start",
+					Required: true,
+					Type:     types.Integer,
+				},
+				{
+					Name: "stop",
+					Type: types.Integer,
+				},
+			},
+		},
+		"pickSeries": {
+			Description: "Takes one metric or a wildcard seriesList and returns series with the given indexes in order of indexes. Negative indexes are counted from the end, indexes out of range are ignored.\n\nSeries keep order of the seriesList: series of path expressions are sorted by name, like in the legend, unless they are reordered by other functions (e.x. sortByMaxima).\n\nExample:\n\n.. code-block:: none\n\n  &target=pickSeries(server*.instance*.memory.free,0,-1)\n\nDraws the first and the last of matched series.",
+			Function:    "pickSeries(seriesList, *indexes)",
+			Group:       "Filter Series",
+			Module:      "graphite.render.functions.custom",
+			Name:        "pickSeries",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Multiple: true,
+					Name:     "indexes",
+					Required: true,
+					Type:     types.Integer,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package slice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	metrics := func() map[parser.MetricRequest][]*types.MetricData {
+		return map[parser.MetricRequest][]*types.MetricData{
+			{"metric*", 0, 1}: {
+				types.MakeMetricData("metricA", []float64{1, 1, 1}, 1, now32),
+				types.MakeMetricData("metricB", []float64{2, 2, 2}, 1, now32),
+				types.MakeMetricData("metricC", []float64{3, 3, 3}, 1, now32),
+				types.MakeMetricData("metricD", []float64{4, 4, 4}, 1, now32),
+			},
+		}
+	}
+	series := map[string]*types.MetricData{
+		"A": types.MakeMetricData("metricA", []float64{1, 1, 1}, 1, now32),
+		"B": types.MakeMetricData("metricB", []float64{2, 2, 2}, 1, now32),
+		"C": types.MakeMetricData("metricC", []float64{3, 3, 3}, 1, now32),
+		"D": types.MakeMetricData("metricD", []float64{4, 4, 4}, 1, now32),
+	}
+
+	tests := []th.EvalTestItem{
+		{
+			"sliceSeries(metric*,1,3)",
+			metrics(),
+			[]*types.MetricData{series["B"], series["C"]},
+		},
+		{
+			"sliceSeries(metric*,2)",
+			metrics(),
+			[]*types.MetricData{series["C"], series["D"]},
+		},
+		{
+			"sliceSeries(metric*,-3,-1)",
+			metrics(),
+			[]*types.MetricData{series["B"], series["C"]},
+		},
+		{
+			"sliceSeries(metric*,-10,10)",
+			metrics(),
+			[]*types.MetricData{series["A"], series["B"], series["C"], series["D"]},
+		},
+		{
+			"sliceSeries(metric*,3,1)",
+			metrics(),
+			[]*types.MetricData{},
+		},
+		{
+			"pickSeries(metric*,3,0,-1,10)",
+			metrics(),
+			[]*types.MetricData{series["D"], series["A"]},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
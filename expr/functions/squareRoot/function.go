@@ -1,7 +1,6 @@
 package squareRoot
 
 import (
-	"fmt"
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
@@ -20,7 +19,7 @@ func GetOrder() interfaces.Order {
 func New(configFile string) []interfaces.FunctionMetadata {
 	res := make([]interfaces.FunctionMetadata, 0)
 	f := &squareRoot{}
-	functions := []string{"squareRoot"}
+	functions := []string{"squareRoot", "sqrt"}
 	for _, n := range functions {
 		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
 	}
@@ -29,34 +28,20 @@ func New(configFile string) []interfaces.FunctionMetadata {
 
 // squareRoot(seriesList)
 func (f *squareRoot) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
-	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
-	if err != nil {
-		return nil, err
-	}
-	var results []*types.MetricData
-
-	for _, a := range arg {
-		r := *a
-		r.Name = fmt.Sprintf("squareRoot(%s)", a.Name)
-		r.Values = make([]float64, len(a.Values))
-
-		for i, v := range a.Values {
-			r.Values[i] = math.Sqrt(v)
-		}
-		results = append(results, &r)
-	}
-	return results, nil
+	// negative values are converted to NaN by math.Sqrt
+	return helper.ForEachSeriesDo(e, from, until, values, helper.PointwiseTransform(math.Sqrt))
 }
 
 // Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
 func (f *squareRoot) Description() map[string]types.FunctionDescription {
-	return map[string]types.FunctionDescription{
-		"squareRoot": {
-			Description: "Takes one metric or a wildcard seriesList, and computes the square root of each datapoint.\n\nExample:\n\n.. code-block:: none\n\n  &target=squareRoot(Server.instance01.threads.busy)",
-			Function:    "squareRoot(seriesList)",
+	res := make(map[string]types.FunctionDescription)
+	for _, n := range []string{"squareRoot", "sqrt"} {
+		res[n] = types.FunctionDescription{
+			Description: "Takes one metric or a wildcard seriesList, and computes the square root of each datapoint.\n\nExample:\n\n.. code-block:: none\n\n  &target=" + n + "(Server.instance01.threads.busy)",
+			Function:    n + "(seriesList)",
 			Group:       "Transform",
 			Module:      "graphite.render.functions",
-			Name:        "squareRoot",
+			Name:        n,
 			Params: []types.FunctionParam{
 				{
 					Name:     "seriesList",
@@ -64,6 +49,7 @@ func (f *squareRoot) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 			},
-		},
+		}
 	}
+	return res
 }
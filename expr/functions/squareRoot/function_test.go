@@ -34,6 +34,13 @@ func TestFunction(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("squareRoot(metric1)",
 				[]float64{1, 1.4142135623730951, 0, 2.6457513110645907, 2.8284271247461903, 4.47213595499958, 5.477225575051661, math.NaN()}, 1, now32)},
 		},
+		{
+			"sqrt(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{4, -1, math.NaN()}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("sqrt(metric1)", []float64{2, math.NaN(), math.NaN()}, 1, now32)},
+		},
 	}
 
 	for _, tt := range tests {
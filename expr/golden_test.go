@@ -0,0 +1,11 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/go-graphite/carbonapi/tests/golden"
+)
+
+func TestGoldenFixtures(t *testing.T) {
+	golden.RunFixtures(t, "testdata/golden")
+}
@@ -2,3 +2,6 @@ package helper
 
 // ExtrapolatePoints defines if we should extrapolate when we are aligning series together
 var ExtrapolatePoints = false
+
+// NormalizeSeries defines if AlignSeries should bring series with different steps together using types.Normalize
+var NormalizeSeries = false
@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"strings"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// NodesKey returns nodes (negative ones are counted from the end) and tags of the series joined by '.'. Missing
+// nodes and tags are empty strings
+func NodesKey(s *types.MetricData, nodes []parser.NodeOrTag) string {
+	t := templateSeries{s: s}
+	parts := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if n.IsTag {
+			parts = append(parts, t.Tag(n.Value.(string)))
+		} else {
+			parts = append(parts, t.Node(n.Value.(int)))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// GroupByNodes splits series into groups, that have the same nodes and tags (see NodesKey). Keys of groups are
+// returned in order of their first series, series keep their order inside of groups
+func GroupByNodes(series []*types.MetricData, nodes []parser.NodeOrTag) (map[string][]*types.MetricData, []string) {
+	groups := make(map[string][]*types.MetricData)
+	var keys []string
+	for _, s := range series {
+		key := NodesKey(s, nodes)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], s)
+	}
+	return groups, keys
+}
@@ -112,8 +112,30 @@ func ForEachSeriesDo(e parser.Expr, from, until int64, values map[parser.MetricR
 	return results, nil
 }
 
-// AlignSeries aligns different series together. By default it only prepends and appends NaNs in case of different length, but if ExtrapolatePoints is enabled, it can extrapolate
+// PointwiseTransform returns seriesFunc that applies function to each non-null point of the series. Null points stay
+// null, function should return NaN for values it's not defined for.
+func PointwiseTransform(function func(float64) float64) seriesFunc {
+	return func(a *types.MetricData, r *types.MetricData) *types.MetricData {
+		for i, v := range a.Values {
+			if math.IsNaN(v) {
+				r.Values[i] = math.NaN()
+				continue
+			}
+			r.Values[i] = function(v)
+		}
+		return r
+	}
+}
+
+// AlignSeries aligns different series together. By default it only prepends and appends NaNs in case of different length, but if ExtrapolatePoints is enabled, it can extrapolate.
+// If NormalizeSeries is enabled, series are normalized with types.Normalize using default method
 func AlignSeries(args []*types.MetricData) []*types.MetricData {
+	if NormalizeSeries && !ExtrapolatePoints {
+		if res, err := types.Normalize(args, ""); err == nil {
+			return res
+		}
+	}
+
 	minStart := args[0].StartTime
 	maxStop := args[0].StopTime
 	maxVals := 0
@@ -189,10 +211,26 @@ type AggregateFunc func([]float64) float64
 func AggregateSeries(e parser.Expr, args []*types.MetricData, function AggregateFunc) ([]*types.MetricData, error) {
 	args = AlignSeries(args)
 	length := len(args[0].Values)
-	r := *args[0]
+	r := args[0].CopyLink()
 	r.Name = fmt.Sprintf("%s(%s)", e.Target(), e.RawArgs())
 	r.Values = make([]float64, length)
 
+	// like in graphite-web, result has only tags that are common for all series
+	if r.Tags == nil {
+		r.Tags = make(map[string]string)
+	}
+	for k, v := range r.Tags {
+		for _, arg := range args[1:] {
+			if av, ok := arg.Tags[k]; !ok || av != v {
+				delete(r.Tags, k)
+				break
+			}
+		}
+	}
+	if _, ok := r.Tags["name"]; !ok {
+		r.Tags["name"] = r.Name
+	}
+
 	for i := range args[0].Values {
 		var values []float64
 		for _, arg := range args {
@@ -205,7 +243,7 @@ func AggregateSeries(e parser.Expr, args []*types.MetricData, function Aggregate
 		}
 	}
 
-	return []*types.MetricData{&r}, nil
+	return []*types.MetricData{r}, nil
 }
 
 // ExtractMetric extracts metric out of function list
@@ -264,3 +302,46 @@ func Contains(a []int, i int) bool {
 	}
 	return false
 }
+
+// GetIntervalNamedOrPosArgDefault returns interval argument (e.x. "1min") in seconds or d if it's not specified
+func GetIntervalNamedOrPosArgDefault(e parser.Expr, k string, n int, d int32) (int32, error) {
+	s, err := e.GetStringNamedOrPosArgDefault(k, n, "")
+	if err != nil {
+		return 0, err
+	}
+	if s == "" {
+		return d, nil
+	}
+	interval, err := parser.IntervalString(s, 1)
+	if err != nil || interval <= 0 {
+		return 0, parser.ErrBadType
+	}
+	return interval, nil
+}
+
+// RegexpFlags are RE2 flags accepted by CompileRegexp: i - case-insensitive, m - multi-line, s - '.' matches '\n',
+// U - ungreedy
+const RegexpFlags = "imsU"
+
+// CompileRegexp compiles pattern with RE2 flags (e.x. "i" for case-insensitive match), flags may be empty
+func CompileRegexp(pattern, flags string) (*regexp.Regexp, error) {
+	if flags == "" {
+		return regexp.Compile(pattern)
+	}
+	for _, f := range flags {
+		if !strings.ContainsRune(RegexpFlags, f) {
+			return nil, fmt.Errorf("unknown regexp flag '%c', supported flags are %s", f, RegexpFlags)
+		}
+	}
+	return regexp.Compile("(?" + flags + ")" + pattern)
+}
+
+// CounterDelta returns difference between subsequent values of a counter. If resetThreshold is not NaN and counter
+// decreased by at least resetThreshold, it's considered to be reset to zero and v is returned
+func CounterDelta(v, prev, resetThreshold float64) float64 {
+	delta := v - prev
+	if delta < 0 && !math.IsNaN(resetThreshold) && -delta >= resetThreshold {
+		return v
+	}
+	return delta
+}
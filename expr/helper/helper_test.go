@@ -1,9 +1,13 @@
 package helper
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/tags"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
 )
 
 func TestExtractTags(t *testing.T) {
@@ -47,3 +51,91 @@ func TestExtractTags(t *testing.T) {
 		})
 	}
 }
+
+func TestAggregateSeriesTags(t *testing.T) {
+	e, _, err := parser.ParseExpr("sumSeries(seriesByTag('name=cpu'))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []*types.MetricData{
+		types.MakeMetricData("cpu;dc=1;host=a", []float64{1, 2}, 1, 0),
+		types.MakeMetricData("cpu;dc=1;host=b", []float64{3, 4}, 1, 0),
+	}
+
+	res, err := AggregateSeries(e, args, consolidations.AggSum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"name": "cpu", "dc": "1"}
+	if !reflect.DeepEqual(res[0].Tags, expected) {
+		t.Errorf("tags = %v, want %v", res[0].Tags, expected)
+	}
+	if args[0].Tags["host"] != "a" {
+		t.Errorf("tags of the argument were changed: %v", args[0].Tags)
+	}
+}
+
+func TestNormalizeSteps(t *testing.T) {
+	defer func() { StrictSteps, StepAggregation = false, "" }()
+	series := func() []*types.MetricData {
+		return []*types.MetricData{
+			types.MakeMetricData("a", []float64{1, 2, 3, 4}, 60, 0),
+			types.MakeMetricData("b", []float64{10, 20}, 120, 0),
+		}
+	}
+
+	same := []*types.MetricData{types.MakeMetricData("a", []float64{1}, 60, 0), types.MakeMetricData("b", []float64{2, 3}, 60, 0)}
+	res, err := NormalizeSteps(same)
+	if err != nil || res[0] != same[0] || res[1] != same[1] {
+		t.Errorf("series with the same step should be returned as is, got %v, %v", res, err)
+	}
+
+	res, err = NormalizeSteps(series())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].StepTime != 120 || !reflect.DeepEqual(res[0].Values, []float64{1.5, 3.5}) || !reflect.DeepEqual(res[1].Values, []float64{10, 20}) {
+		t.Errorf("unexpected normalized series %v, %v", res[0], res[1])
+	}
+
+	StepAggregation = "sum"
+	res, err = NormalizeSteps(series())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res[0].Values, []float64{3, 7}) || res[0].ConsolidationFunc != "" {
+		t.Errorf("unexpected normalized series %v", res[0])
+	}
+
+	StrictSteps = true
+	if _, err = NormalizeSteps(series()); err == nil {
+		t.Error("expected error in strict mode")
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"host2", "host10", true},
+		{"host10", "host2", false},
+		{"host2", "host2", false},
+		{"host02", "host2", false},
+		{"host2", "host02", true},
+		{"host02", "host10", true},
+		{"host", "host1", true},
+		{"host1.cpu2", "host1.cpu10", true},
+		{"a1b", "a1c", true},
+		{"a10", "ab", true},
+		{"host99999999999999999999", "host100000000000000000000", true},
+		{"disk0", "disk00", true},
+	}
+
+	for _, tt := range tests {
+		if got := NaturalLess(tt.a, tt.b); got != tt.less {
+			t.Errorf("NaturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.less)
+		}
+	}
+}
@@ -1,10 +1,6 @@
 package helper
 
 import (
-	"fmt"
-	"regexp"
-	"strconv"
-
 	"github.com/go-graphite/carbonapi/expr/types"
 )
 
@@ -43,20 +39,9 @@ func (s ByName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 // Less compares two elements with specified IDs, required to be sortable
 func (s ByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
 
-// ByNameNatural sorts metric naturally by name
+// ByNameNatural sorts metric naturally by name (see NaturalLess)
 type ByNameNatural []*types.MetricData
 
-var dre = regexp.MustCompile(`\d+`)
-
-func (s ByNameNatural) pad(str string) string {
-	f := func(match []byte) []byte {
-		n, _ := strconv.ParseInt(string(match), 10, 64)
-		return []byte(fmt.Sprintf("%010d", n))
-	}
-
-	return string(dre.ReplaceAllFunc([]byte(str), f))
-}
-
 // Len returns length, required to be sortable
 func (s ByNameNatural) Len() int { return len(s) }
 
@@ -64,4 +49,58 @@ func (s ByNameNatural) Len() int { return len(s) }
 func (s ByNameNatural) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
 // Less compares two elements with specified IDs, required to be sortable
-func (s ByNameNatural) Less(i, j int) bool { return s.pad(s[i].Name) < s.pad(s[j].Name) }
+func (s ByNameNatural) Less(i, j int) bool { return NaturalLess(s[i].Name, s[j].Name) }
+
+// NaturalLess compares strings naturally: runs of digits are compared as numbers of any length, so host2 goes before
+// host10, other characters are compared byte by byte. Numbers that differ only by leading zeros (host02 and host2)
+// are ordered by amount of zeros, the shorter one goes first
+func NaturalLess(a, b string) bool {
+	// zeros is the first difference of leading zeros, that is used if strings are equal otherwise
+	zeros := 0
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !isDigit(a[i]) || !isDigit(b[j]) {
+			if a[i] != b[j] {
+				return a[i] < b[j]
+			}
+			i++
+			j++
+			continue
+		}
+
+		// skip leading zeros, but keep the last digit of numbers made of zeros
+		ai, bj := i, j
+		for ai < len(a)-1 && a[ai] == '0' && isDigit(a[ai+1]) {
+			ai++
+		}
+		for bj < len(b)-1 && b[bj] == '0' && isDigit(b[bj+1]) {
+			bj++
+		}
+		if zeros == 0 && ai-i != bj-j {
+			zeros = (ai - i) - (bj - j)
+		}
+		ae, be := ai, bj
+		for ae < len(a) && isDigit(a[ae]) {
+			ae++
+		}
+		for be < len(b) && isDigit(b[be]) {
+			be++
+		}
+		// numbers without leading zeros are compared by length first
+		if ae-ai != be-bj {
+			return ae-ai < be-bj
+		}
+		if na, nb := a[ai:ae], b[bj:be]; na != nb {
+			return na < nb
+		}
+		i, j = ae, be
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return zeros < 0
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,63 @@
+package helper
+
+import (
+	"fmt"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+// StrictSteps makes functions that combine series point by point (e.x. divideSeries) fail on series with different
+// steps instead of normalizing them
+var StrictSteps = false
+
+// StepAggregation is a consolidation function (e.x. "sum") values of series are consolidated by, when they are
+// normalized to a coarser step. Empty - consolidation function of each series (see consolidateBy), average by default
+var StepAggregation = ""
+
+// ErrStepMismatch is returned by NormalizeSteps in strict mode
+type ErrStepMismatch struct {
+	First, Second *types.MetricData
+}
+
+func (e ErrStepMismatch) Error() string {
+	return fmt.Sprintf("series %s and %s have different steps %d and %d", e.First.Name, e.Second.Name, e.First.StepTime, e.Second.StepTime)
+}
+
+// NormalizeSteps brings series with different steps together for functions that combine them point by point. Series
+// are consolidated to the least common multiple of steps (by StepAggregation) and aligned to the same start and stop
+// time. If normalizeMethod is configured (see NormalizeSeries), it's used instead. Series with the same step are
+// returned as is. If StrictSteps is enabled, ErrStepMismatch is returned instead of normalized series
+func NormalizeSteps(series []*types.MetricData) ([]*types.MetricData, error) {
+	if len(series) < 2 {
+		return series, nil
+	}
+	if NormalizeSeries && !StrictSteps {
+		return types.Normalize(series, "")
+	}
+	for _, s := range series[1:] {
+		if s.StepTime == series[0].StepTime {
+			continue
+		}
+		if StrictSteps {
+			return nil, ErrStepMismatch{First: series[0], Second: s}
+		}
+		if StepAggregation == "" {
+			return types.Normalize(series, types.NormalizeAggregate)
+		}
+
+		aggregated := make([]*types.MetricData, len(series))
+		for i, s := range series {
+			aggregated[i] = s.CopyLink()
+			aggregated[i].ConsolidationFunc = StepAggregation
+		}
+		normalized, err := types.Normalize(aggregated, types.NormalizeAggregate)
+		if err != nil {
+			return nil, err
+		}
+		for i, s := range normalized {
+			s.ConsolidationFunc = series[i].ConsolidationFunc
+		}
+		return normalized, nil
+	}
+	return series, nil
+}
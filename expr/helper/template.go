@@ -0,0 +1,162 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/tags"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// RegexpReplacement converts graphite-style backreferences (\1) in replacement string to go regexp syntax (${1}).
+// Go style references ($1, ${name}) are kept as is
+func RegexpReplacement(replace string) string {
+	return Backref.ReplaceAllString(replace, "$${$1}")
+}
+
+// NameTemplate is a series name template in text/template syntax. Series is available in template as:
+//
+//	{{.Name}}             - name of the series
+//	{{.Node 2}}           - node of the metric name, negative nodes are counted from the end
+//	{{.Tag "dc"}}         - tag value, "name" is the metric name
+//	{{.Value "max"}}      - values reduced by consolidation function, e.x. avg, last, p95
+//	{{.Sub "re" "\\1"}}   - name after regexp replacement, like aliasSub
+//
+// Missing nodes and tags are empty strings
+type NameTemplate struct {
+	t *template.Template
+}
+
+// ParseNameTemplate parses series name template
+func ParseNameTemplate(text string) (*NameTemplate, error) {
+	t, err := template.New("name").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &NameTemplate{t: t}, nil
+}
+
+// Execute returns name of the series generated by template
+func (t *NameTemplate) Execute(s *types.MetricData) (string, error) {
+	var b bytes.Buffer
+	err := t.t.Execute(&b, templateSeries{s: s})
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// templateSeries exposes series to name templates
+type templateSeries struct {
+	s *types.MetricData
+}
+
+func (t templateSeries) Name() string {
+	return t.s.Name
+}
+
+func (t templateSeries) Node(n int) string {
+	// tags are stripped before, as ';' isn't a name character
+	nodes := strings.Split(ExtractMetric(strings.SplitN(t.s.Name, ";", 2)[0]), ".")
+	if n < 0 {
+		n += len(nodes)
+	}
+	if n < 0 || n >= len(nodes) {
+		return ""
+	}
+	return nodes[n]
+}
+
+// Tag returns tag of the series, tags that are only in the name (e.x. 'metric;dc=us') are found too
+func (t templateSeries) Tag(name string) string {
+	if v, ok := t.s.Tags[name]; ok {
+		return v
+	}
+	parsed := tags.ExtractTags(t.s.Name)
+	if name == "name" {
+		return ExtractMetric(parsed["name"])
+	}
+	return parsed[name]
+}
+
+func (t templateSeries) Value(function string) (float64, error) {
+	if f, ok := consolidations.ConsolidationFunc(function); ok {
+		return f(t.s.Values), nil
+	}
+	// percentiles are supported by summarize only
+	if !consolidations.IsValidSummarizer(function) {
+		return 0, fmt.Errorf("unknown function '%s'", function)
+	}
+	return consolidations.SummarizeValues(function, t.s.Values), nil
+}
+
+func (t templateSeries) Sub(search, replace string) (string, error) {
+	re, err := regexp.Compile(search)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(t.s.Name, RegexpReplacement(replace)), nil
+}
+
+// SeriesString is a string argument resolved for each series
+type SeriesString func(s *types.MetricData) string
+
+// IsSeriesStringExpr checks if expression is a contextual string: node(*nodes) or tag(name)
+func IsSeriesStringExpr(e parser.Expr) bool {
+	return e.IsFunc() && (e.Target() == "node" || e.Target() == "tag")
+}
+
+// GetSeriesStringArg returns n-th argument as string, that could depend on series. Besides string constants, it
+// accepts node(*nodes), that is replaced by nodes of the series name joined by '.', and tag(name), that is replaced
+// by tag value, e.x. alias(foo.*.bar, node(1))
+func GetSeriesStringArg(e parser.Expr, n int) (SeriesString, error) {
+	if len(e.Args()) <= n {
+		return nil, parser.ErrMissingArgument
+	}
+	return seriesStringExpr(e.Args()[n])
+}
+
+// GetSeriesStringArgDefault returns n-th argument as string, that could depend on series, or d if it's not specified
+func GetSeriesStringArgDefault(e parser.Expr, n int, d string) (SeriesString, error) {
+	if len(e.Args()) <= n {
+		return func(*types.MetricData) string { return d }, nil
+	}
+	return seriesStringExpr(e.Args()[n])
+}
+
+func seriesStringExpr(arg parser.Expr) (SeriesString, error) {
+	if arg.IsString() {
+		s := arg.StringValue()
+		return func(*types.MetricData) string { return s }, nil
+	}
+	if !IsSeriesStringExpr(arg) {
+		return nil, parser.ErrBadType
+	}
+
+	if arg.Target() == "tag" {
+		name, err := arg.GetStringArg(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *types.MetricData) string {
+			return templateSeries{s: s}.Tag(name)
+		}, nil
+	}
+
+	nodes, err := arg.GetIntArgs(0)
+	if err != nil {
+		return nil, err
+	}
+	return func(s *types.MetricData) string {
+		parts := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			parts = append(parts, templateSeries{s: s}.Node(n))
+		}
+		return strings.Join(parts, ".")
+	}, nil
+}
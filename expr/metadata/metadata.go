@@ -56,6 +56,15 @@ func RegisterFunction(name string, function interfaces.Function) {
 	}
 }
 
+// RegisterAlternateFunction registers alternate implementation of the function (e.x. a refactored one), that is
+// evaluated only to compare its results with the current implementation. Descriptions are not changed
+func RegisterAlternateFunction(name string, function interfaces.Function) {
+	FunctionMD.Lock()
+	defer FunctionMD.Unlock()
+	function.SetEvaluator(FunctionMD.evaluator)
+	FunctionMD.AlternateFunctions[name] = function
+}
+
 // SetEvaluator sets new evaluator function to be default for everything that needs it
 func SetEvaluator(evaluator interfaces.Evaluator) {
 	FunctionMD.Lock()
@@ -69,6 +78,10 @@ func SetEvaluator(evaluator interfaces.Evaluator) {
 	for _, v := range FunctionMD.RewriteFunctions {
 		v.SetEvaluator(evaluator)
 	}
+
+	for _, v := range FunctionMD.AlternateFunctions {
+		v.SetEvaluator(evaluator)
+	}
 }
 
 // GetEvaluator returns evaluator
@@ -85,6 +98,7 @@ type Metadata struct {
 
 	Functions           map[string]interfaces.Function
 	RewriteFunctions    map[string]interfaces.RewriteFunction
+	AlternateFunctions  map[string]interfaces.Function
 	Descriptions        map[string]types.FunctionDescription
 	DescriptionsGrouped map[string]map[string]types.FunctionDescription
 	FunctionConfigFiles map[string]string
@@ -96,6 +110,7 @@ type Metadata struct {
 var FunctionMD = Metadata{
 	RewriteFunctions:    make(map[string]interfaces.RewriteFunction),
 	Functions:           make(map[string]interfaces.Function),
+	AlternateFunctions:  make(map[string]interfaces.Function),
 	Descriptions:        make(map[string]types.FunctionDescription),
 	DescriptionsGrouped: make(map[string]map[string]types.FunctionDescription),
 	FunctionConfigFiles: make(map[string]string),
@@ -0,0 +1,46 @@
+package aboveSeries
+
+import (
+	filter "github.com/go-graphite/carbonapi/expr/functions/aboveSeries"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+type aboveSeries struct {
+	interfaces.FunctionBase
+}
+
+func New(configFile string) []interfaces.RewriteFunctionMetadata {
+	res := make([]interfaces.RewriteFunctionMetadata, 0)
+	f := &aboveSeries{}
+	for _, n := range []string{"useSeriesAbove", "aboveSeries"} {
+		res = append(res, interfaces.RewriteFunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// useSeriesAbove(seriesList, value, search, replace)
+// Related series are fetched by rewritten names, so it's a rewrite function, like applyByNode. Nested calls are
+// evaluated by the regular function
+func (f *aboveSeries) Do(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (bool, []string, error) {
+	args, rename, err := filter.Filter(e, from, until, values)
+	if err != nil {
+		return false, nil, err
+	}
+
+	rv := make([]string, 0, len(args))
+	for _, a := range args {
+		rv = append(rv, rename(a.Name))
+	}
+	return true, rv, nil
+}
+
+// Description is the same as of the regular function
+func (f *aboveSeries) Description() map[string]types.FunctionDescription {
+	return filter.New("")[0].F.Description()
+}
@@ -2,33 +2,70 @@ package tags
 
 import (
 	"strings"
+	"sync"
 )
 
 // ExtractTags extracts all graphite-style tags out of metric name
 // E.x. cpu.usage_idle;cpu=cpu-total;host=test => {"name": "cpu.usage_idle", "cpu": "cpu-total", "host": "test"}
+//
+// Name is parsed in a single pass and only the resulting map is allocated, keys and values share memory with the name.
+// Value is everything after the first '=', so it could contain '=' too. Tags without value or with empty key are
+// skipped, as graphite doesn't allow them. Tag 'name' is always set to the part before the first ';', even if it's empty.
 func ExtractTags(s string) map[string]string {
-	result := make(map[string]string)
-	idx := strings.IndexRune(s, ';')
+	idx := strings.IndexByte(s, ';')
 	if idx < 0 {
-		result["name"] = s
-		return result
+		return map[string]string{"name": s}
 	}
 
-	result["name"] = s[:idx]
-
-	newS := s[idx+1:]
-	for {
-		idx := strings.IndexRune(newS, ';')
-		if idx < 0 {
-			kv := strings.Split(newS, "=")
-			result[kv[0]] = kv[1]
-			break
+	result := make(map[string]string)
+	tags := s[idx+1:]
+	start, eq := 0, -1
+	for i := 0; i <= len(tags); i++ {
+		if i < len(tags) && tags[i] != ';' {
+			if eq < 0 && tags[i] == '=' {
+				eq = i
+			}
+			continue
 		}
 
-		kv := strings.Split(newS[:idx], "=")
-		result[kv[0]] = kv[1]
-		newS = newS[idx+1:]
+		if eq > start && eq < i-1 {
+			result[tags[start:eq]] = tags[eq+1 : i]
+		}
+		start, eq = i+1, -1
 	}
+	result["name"] = s[:idx]
 
 	return result
 }
+
+// cacheSize limits amount of names in cache, it's cleared when limit is reached
+const cacheSize = 100000
+
+var cache = struct {
+	sync.RWMutex
+	tags map[string]map[string]string
+}{
+	tags: make(map[string]map[string]string),
+}
+
+// ExtractTagsCached is like ExtractTags, but results are cached by name, so repeated names don't cause allocations.
+// Returned map is shared and must not be modified.
+func ExtractTagsCached(s string) map[string]string {
+	cache.RLock()
+	t, ok := cache.tags[s]
+	cache.RUnlock()
+	if ok {
+		return t
+	}
+
+	t = ExtractTags(s)
+
+	cache.Lock()
+	if len(cache.tags) >= cacheSize {
+		cache.tags = make(map[string]map[string]string)
+	}
+	cache.tags[s] = t
+	cache.Unlock()
+
+	return t
+}
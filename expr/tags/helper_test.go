@@ -0,0 +1,66 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractTagsEdgeCases(t *testing.T) {
+	tests := []struct {
+		metric   string
+		expected map[string]string
+	}{
+		{"cpu.usage_idle", map[string]string{"name": "cpu.usage_idle"}},
+		{"cpu;a=1;b=2", map[string]string{"name": "cpu", "a": "1", "b": "2"}},
+		{"cpu;expr=a=b;c=", map[string]string{"name": "cpu", "expr": "a=b"}},
+		{"cpu;novalue;=empty;;a=1;", map[string]string{"name": "cpu", "a": "1"}},
+		{";a=1", map[string]string{"name": "", "a": "1"}},
+		{"cpu;name=other;a=1", map[string]string{"name": "cpu", "a": "1"}},
+		{"cpu;", map[string]string{"name": "cpu"}},
+	}
+
+	for _, tt := range tests {
+		if got := ExtractTags(tt.metric); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ExtractTags(%q) = %v, want %v", tt.metric, got, tt.expected)
+		}
+		if got := ExtractTagsCached(tt.metric); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ExtractTagsCached(%q) = %v, want %v", tt.metric, got, tt.expected)
+		}
+	}
+}
+
+func TestExtractTagsAllocations(t *testing.T) {
+	name := "cpu.usage_idle;cpu=cpu-total;host=test"
+
+	// only the map itself is allocated
+	allocs := testing.AllocsPerRun(100, func() {
+		ExtractTags(name)
+	})
+	if allocs > 2 {
+		t.Errorf("ExtractTags allocations = %v, want at most 2", allocs)
+	}
+
+	ExtractTagsCached(name)
+	allocs = testing.AllocsPerRun(100, func() {
+		ExtractTagsCached(name)
+	})
+	if allocs != 0 {
+		t.Errorf("ExtractTagsCached allocations = %v, want 0", allocs)
+	}
+}
+
+func BenchmarkExtractTags(b *testing.B) {
+	name := "cpu.usage_idle;cpu=cpu-total;host=test;dc=dc1;env=prod"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ExtractTags(name)
+	}
+}
+
+func BenchmarkExtractTagsCached(b *testing.B) {
+	name := "cpu.usage_idle;cpu=cpu-total;host=test;dc=dc1;env=prod"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ExtractTagsCached(name)
+	}
+}
@@ -0,0 +1,138 @@
+package types
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/tags"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// MetricDataBuilder constructs MetricData step by step, e.x.
+//
+//	r, err := NewMetricDataBuilder("foo.bar", values).WithStartTime(from).WithStep(60).WithTags(tags).Build()
+//
+// Tags are extracted from the name ("foo.bar;dc=1"), tags set by WithTags are added to them.
+type MetricDataBuilder struct {
+	name              string
+	values            []float64
+	startTime         int64
+	stopTime          int64
+	step              int64
+	tags              map[string]string
+	consolidationFunc string
+	xFilesFactor      float32
+}
+
+// NewMetricDataBuilder starts building of a series with step of 1 second that starts at 0
+func NewMetricDataBuilder(name string, values []float64) *MetricDataBuilder {
+	return &MetricDataBuilder{
+		name:   name,
+		values: values,
+		step:   1,
+	}
+}
+
+// WithStartTime sets timestamp of the first value
+func (b *MetricDataBuilder) WithStartTime(start int64) *MetricDataBuilder {
+	b.startTime = start
+	return b
+}
+
+// WithStopTime sets stop time explicitly, by default it's the timestamp after the last value
+func (b *MetricDataBuilder) WithStopTime(stop int64) *MetricDataBuilder {
+	b.stopTime = stop
+	return b
+}
+
+// WithStep sets step of the series in seconds
+func (b *MetricDataBuilder) WithStep(step int64) *MetricDataBuilder {
+	b.step = step
+	return b
+}
+
+// WithTags adds tags to the ones that are extracted from the name. Tag 'name' can't be overridden
+func (b *MetricDataBuilder) WithTags(tags map[string]string) *MetricDataBuilder {
+	if b.tags == nil {
+		b.tags = make(map[string]string, len(tags))
+	}
+	for k, v := range tags {
+		b.tags[k] = v
+	}
+	return b
+}
+
+// WithConsolidation sets consolidation function of the series, e.x. "sum"
+func (b *MetricDataBuilder) WithConsolidation(consolidationFunc string) *MetricDataBuilder {
+	b.consolidationFunc = consolidationFunc
+	return b
+}
+
+// WithXFilesFactor sets xFilesFactor of the series
+func (b *MetricDataBuilder) WithXFilesFactor(xFilesFactor float32) *MetricDataBuilder {
+	b.xFilesFactor = xFilesFactor
+	return b
+}
+
+// Build validates parameters and returns the series
+func (b *MetricDataBuilder) Build() (*MetricData, error) {
+	if b.step <= 0 {
+		return nil, fmt.Errorf("series %s: step must be positive, got %d", b.name, b.step)
+	}
+	if b.stopTime != 0 {
+		// stop time is either the timestamp of the last value or the one after it
+		last := b.startTime + int64(len(b.values)-1)*b.step
+		if b.stopTime < last || b.stopTime > last+b.step {
+			return nil, fmt.Errorf("series %s: stop time %d doesn't match %d values with step %d starting at %d",
+				b.name, b.stopTime, len(b.values), b.step, b.startTime)
+		}
+	}
+	if b.consolidationFunc != "" {
+		if _, ok := consolidations.ConsolidationFunc(b.consolidationFunc); !ok {
+			return nil, fmt.Errorf("series %s: unknown consolidation function '%s'", b.name, b.consolidationFunc)
+		}
+	}
+	if b.xFilesFactor < 0 || b.xFilesFactor > 1 || math.IsNaN(float64(b.xFilesFactor)) {
+		return nil, fmt.Errorf("series %s: xFilesFactor must be between 0 and 1, got %v", b.name, b.xFilesFactor)
+	}
+
+	return b.build(), nil
+}
+
+// MustBuild is like Build, but panics if parameters are invalid. Intended for tests and static data
+func (b *MetricDataBuilder) MustBuild() *MetricData {
+	r, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// build returns the series without validation
+func (b *MetricDataBuilder) build() *MetricData {
+	stop := b.stopTime
+	if stop == 0 {
+		stop = b.startTime + int64(len(b.values))*b.step
+	}
+
+	t := tags.ExtractTags(b.name)
+	for k, v := range b.tags {
+		if k != "name" {
+			t[k] = v
+		}
+	}
+
+	return &MetricData{
+		FetchResponse: pb.FetchResponse{
+			Name:              b.name,
+			Values:            b.values,
+			StartTime:         b.startTime,
+			StepTime:          b.step,
+			StopTime:          stop,
+			ConsolidationFunc: b.consolidationFunc,
+			XFilesFactor:      b.xFilesFactor,
+		},
+		Tags: t,
+	}
+}
@@ -0,0 +1,54 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetricDataBuilder(t *testing.T) {
+	r, err := NewMetricDataBuilder("foo.bar;dc=1", []float64{1, 2, 3}).
+		WithStartTime(100).
+		WithStep(60).
+		WithTags(map[string]string{"env": "prod", "name": "other"}).
+		WithConsolidation("sum").
+		WithXFilesFactor(0.5).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if r.Name != "foo.bar;dc=1" || r.StartTime != 100 || r.StepTime != 60 || r.StopTime != 280 {
+		t.Errorf("unexpected series: %+v", r.FetchResponse)
+	}
+	if r.ConsolidationFunc != "sum" || r.XFilesFactor != 0.5 {
+		t.Errorf("unexpected consolidation %q and xFilesFactor %v", r.ConsolidationFunc, r.XFilesFactor)
+	}
+	wantTags := map[string]string{"name": "foo.bar", "dc": "1", "env": "prod"}
+	if !reflect.DeepEqual(r.Tags, wantTags) {
+		t.Errorf("tags = %v, want %v", r.Tags, wantTags)
+	}
+
+	r, err = NewMetricDataBuilder("foo", []float64{1, 2}).WithStep(10).WithStopTime(10).Build()
+	if err != nil || r.StopTime != 10 {
+		t.Errorf("stop time at the last value: %v, %v", r, err)
+	}
+}
+
+func TestMetricDataBuilderValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *MetricDataBuilder
+	}{
+		{"zero step", NewMetricDataBuilder("foo", []float64{1}).WithStep(0)},
+		{"stop time too small", NewMetricDataBuilder("foo", []float64{1, 2, 3}).WithStep(10).WithStopTime(10)},
+		{"stop time too big", NewMetricDataBuilder("foo", []float64{1, 2, 3}).WithStep(10).WithStopTime(50)},
+		{"unknown consolidation", NewMetricDataBuilder("foo", []float64{1}).WithConsolidation("foo")},
+		{"xFilesFactor", NewMetricDataBuilder("foo", []float64{1}).WithXFilesFactor(2)},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.builder.Build(); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
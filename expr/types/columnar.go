@@ -0,0 +1,339 @@
+package types
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Columnar encoding is a compact binary encoding of series, that is used to cache results of render requests, so
+// they could be marshaled to any format and consolidated to any maxDataPoints. Series are encoded one after another:
+// metadata, then time range as start, length and step (timestamps of points are implicit), then values compressed
+// with XOR of consecutive values, like Gorilla does.
+
+// columnarVersion is the first byte of encoded data, data of other versions is rejected
+const columnarVersion byte = 1
+
+// ErrColumnarCorrupted is returned if data can't be decoded
+var ErrColumnarCorrupted = errors.New("corrupted columnar data")
+
+// MarshalColumnar encodes series with columnar encoding
+func MarshalColumnar(results []*MetricData) ([]byte, error) {
+	b := []byte{columnarVersion}
+	b = appendUvarint(b, uint64(len(results)))
+	for _, r := range results {
+		b = appendString(b, r.Name)
+		b = appendString(b, r.PathExpression)
+		b = appendString(b, r.ConsolidationFunc)
+		b = appendVarint(b, r.StartTime)
+		b = appendVarint(b, r.StopTime-r.StartTime)
+		b = appendVarint(b, r.StepTime)
+		b = appendVarint(b, r.RequestStartTime)
+		b = appendVarint(b, r.RequestStopTime)
+		b = appendUvarint(b, uint64(math.Float32bits(r.XFilesFactor)))
+		if r.HighPrecisionTimestamps {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+		b = appendUvarint(b, uint64(r.ValuesPerPoint))
+
+		b = appendUvarint(b, uint64(len(r.AppliedFunctions)))
+		for _, f := range r.AppliedFunctions {
+			b = appendString(b, f)
+		}
+		keys := make([]string, 0, len(r.Tags))
+		for k := range r.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendUvarint(b, uint64(len(keys)))
+		for _, k := range keys {
+			b = appendString(b, k)
+			b = appendString(b, r.Tags[k])
+		}
+
+		// options of graph differ between builds with and without cairo
+		opts, err := json.Marshal(r.GraphOptions)
+		if err != nil {
+			return nil, err
+		}
+		b = appendString(b, string(opts))
+
+		values := compressValues(r.Values)
+		b = appendUvarint(b, uint64(len(r.Values)))
+		b = appendUvarint(b, uint64(len(values)))
+		b = append(b, values...)
+	}
+	return b, nil
+}
+
+// UnmarshalColumnar decodes series encoded by MarshalColumnar
+func UnmarshalColumnar(b []byte) ([]*MetricData, error) {
+	if len(b) == 0 || b[0] != columnarVersion {
+		return nil, ErrColumnarCorrupted
+	}
+	d := &columnarDecoder{b: b[1:]}
+	n := d.count()
+	results := make([]*MetricData, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		r := &MetricData{}
+		r.Name = d.string()
+		r.PathExpression = d.string()
+		r.ConsolidationFunc = d.string()
+		r.StartTime = d.varint()
+		r.StopTime = r.StartTime + d.varint()
+		r.StepTime = d.varint()
+		r.RequestStartTime = d.varint()
+		r.RequestStopTime = d.varint()
+		r.XFilesFactor = math.Float32frombits(uint32(d.uvarint()))
+		r.HighPrecisionTimestamps = d.bytes(1)[0] == 1
+		r.ValuesPerPoint = int(d.uvarint())
+
+		if n := d.count(); n > 0 {
+			r.AppliedFunctions = make([]string, n)
+			for j := range r.AppliedFunctions {
+				r.AppliedFunctions[j] = d.string()
+			}
+		}
+		if n := d.count(); n > 0 {
+			r.Tags = make(map[string]string, n)
+			for j := 0; j < n; j++ {
+				k := d.string()
+				r.Tags[k] = d.string()
+			}
+		}
+
+		if opts := d.string(); d.err == nil {
+			if err := json.Unmarshal([]byte(opts), &r.GraphOptions); err != nil {
+				return nil, ErrColumnarCorrupted
+			}
+		}
+
+		points := int(d.uvarint())
+		values := d.bytes(d.count())
+		if d.err == nil {
+			r.Values, d.err = decompressValues(values, points)
+		}
+		results = append(results, r)
+	}
+	if d.err != nil || len(d.b) != 0 {
+		return nil, ErrColumnarCorrupted
+	}
+	return results, nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// columnarDecoder reads encoded fields, the first error is kept and zero values are returned after it
+type columnarDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *columnarDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = ErrColumnarCorrupted
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *columnarDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = ErrColumnarCorrupted
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// count reads length of a list, that can't be longer than the rest of data
+func (d *columnarDecoder) count() int {
+	v := d.uvarint()
+	if v > uint64(len(d.b)) {
+		d.err = ErrColumnarCorrupted
+		return 0
+	}
+	return int(v)
+}
+
+func (d *columnarDecoder) bytes(n int) []byte {
+	if d.err == nil && n > len(d.b) {
+		d.err = ErrColumnarCorrupted
+	}
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *columnarDecoder) string() string {
+	return string(d.bytes(d.count()))
+}
+
+// bitWriter appends bits to the buffer, starting from the most significant bit of each byte
+type bitWriter struct {
+	b    []byte
+	free uint
+}
+
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for n > 0 {
+		if w.free == 0 {
+			w.b = append(w.b, 0)
+			w.free = 8
+		}
+		k := n
+		if k > w.free {
+			k = w.free
+		}
+		chunk := byte(v>>(n-k)) & byte(1<<k-1)
+		w.b[len(w.b)-1] |= chunk << (w.free - k)
+		w.free -= k
+		n -= k
+	}
+}
+
+type bitReader struct {
+	b    []byte
+	used uint
+}
+
+func (r *bitReader) readBits(n uint) (uint64, bool) {
+	var v uint64
+	for n > 0 {
+		if len(r.b) == 0 {
+			return 0, false
+		}
+		k := 8 - r.used
+		if k > n {
+			k = n
+		}
+		chunk := (r.b[0] >> (8 - r.used - k)) & byte(1<<k-1)
+		v = v<<k | uint64(chunk)
+		r.used += k
+		n -= k
+		if r.used == 8 {
+			r.b = r.b[1:]
+			r.used = 0
+		}
+	}
+	return v, true
+}
+
+// compressValues encodes the first value as is and each next one as XOR with the previous one: single 0 bit if
+// values are equal, otherwise meaningful bits of XOR, reusing position of meaningful bits of the previous XOR if
+// they fit into it
+func compressValues(values []float64) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+	w := &bitWriter{}
+	prev := math.Float64bits(values[0])
+	w.writeBits(prev, 64)
+
+	leading, trailing := uint(64), uint(0)
+	for _, v := range values[1:] {
+		cur := math.Float64bits(v)
+		x := cur ^ prev
+		prev = cur
+		if x == 0 {
+			w.writeBits(0, 1)
+			continue
+		}
+		w.writeBits(1, 1)
+
+		l, t := uint(bits.LeadingZeros64(x)), uint(bits.TrailingZeros64(x))
+		if l > 31 {
+			l = 31
+		}
+		if leading != 64 && l >= leading && t >= trailing {
+			w.writeBits(0, 1)
+			w.writeBits(x>>trailing, 64-leading-trailing)
+			continue
+		}
+		leading, trailing = l, t
+		w.writeBits(1, 1)
+		w.writeBits(uint64(leading), 5)
+		// amount of meaningful bits is 1..64, stored as 0..63
+		w.writeBits(uint64(64-leading-trailing-1), 6)
+		w.writeBits(x>>trailing, 64-leading-trailing)
+	}
+	return w.b
+}
+
+func decompressValues(b []byte, n int) ([]float64, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	// every value except the first one takes at least 1 bit
+	if n > 8*len(b)-63 {
+		return nil, ErrColumnarCorrupted
+	}
+	r := &bitReader{b: b}
+	values := make([]float64, n)
+	prev, ok := r.readBits(64)
+	if !ok {
+		return nil, ErrColumnarCorrupted
+	}
+	values[0] = math.Float64frombits(prev)
+
+	leading, trailing := uint(0), uint(0)
+	for i := 1; i < n; i++ {
+		changed, ok := r.readBits(1)
+		if !ok {
+			return nil, ErrColumnarCorrupted
+		}
+		if changed == 1 {
+			newWindow, ok := r.readBits(1)
+			if !ok {
+				return nil, ErrColumnarCorrupted
+			}
+			if newWindow == 1 {
+				l, ok1 := r.readBits(5)
+				size, ok2 := r.readBits(6)
+				if !ok1 || !ok2 || l+size+1 > 64 {
+					return nil, ErrColumnarCorrupted
+				}
+				leading, trailing = uint(l), uint(64-l-size-1)
+			}
+			x, ok := r.readBits(64 - leading - trailing)
+			if !ok {
+				return nil, ErrColumnarCorrupted
+			}
+			prev ^= x << trailing
+		}
+		values[i] = math.Float64frombits(prev)
+	}
+	return values, nil
+}
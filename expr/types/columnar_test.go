@@ -0,0 +1,90 @@
+package types
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestColumnarRoundTrip(t *testing.T) {
+	random := make([]float64, 1000)
+	for i := range random {
+		switch i % 7 {
+		case 0:
+			random[i] = math.NaN()
+		case 1:
+			random[i] = random[i-1]
+		default:
+			random[i] = rand.NormFloat64() * 1e6
+		}
+	}
+
+	withMeta := MakeMetricData("metric2;foo=bar", []float64{1, 1, 1.5, math.Inf(1), -2, 0, math.NaN(), 1e300}, 60, 1510913280)
+	withMeta.PathExpression = "metric*"
+	withMeta.ConsolidationFunc = "max"
+	withMeta.XFilesFactor = 0.5
+	withMeta.RequestStartTime = 1510913200
+	withMeta.RequestStopTime = 1510913760
+	withMeta.ValuesPerPoint = 2
+	withMeta.AppliedFunctions = []string{"scale"}
+
+	results := []*MetricData{
+		MakeMetricData("metric1", random, 10, 100),
+		withMeta,
+		MakeMetricData("empty", nil, 60, 100),
+		MakeMetricData("single", []float64{42}, 1, 1),
+	}
+
+	b, err := MarshalColumnar(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalColumnar(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(results) {
+		t.Fatalf("expected %d series, got %d", len(results), len(got))
+	}
+	for i, want := range results {
+		g := got[i]
+		if len(g.Values) != len(want.Values) {
+			t.Fatalf("%s: expected %d values, got %d", want.Name, len(want.Values), len(g.Values))
+		}
+		for j := range want.Values {
+			if math.Float64bits(g.Values[j]) != math.Float64bits(want.Values[j]) {
+				t.Fatalf("%s: value %d: expected %v, got %v", want.Name, j, want.Values[j], g.Values[j])
+			}
+		}
+		g.Values, want.Values = nil, nil
+		if !reflect.DeepEqual(g, want) {
+			t.Errorf("%s: expected %+v, got %+v", want.Name, want, g)
+		}
+	}
+
+	// constant series take 1 bit per point
+	constant := make([]float64, 8000)
+	b, _ = MarshalColumnar([]*MetricData{MakeMetricData("c", constant, 1, 1)})
+	if len(b) > 1100 {
+		t.Errorf("constant series is encoded to %d bytes", len(b))
+	}
+}
+
+func TestColumnarCorrupted(t *testing.T) {
+	b, err := MarshalColumnar([]*MetricData{MakeMetricData("metric1", []float64{1, 2, 3, math.NaN()}, 60, 100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(b); i++ {
+		if _, err := UnmarshalColumnar(b[:i]); err != ErrColumnarCorrupted {
+			t.Errorf("truncated to %d bytes: expected %v, got %v", i, ErrColumnarCorrupted, err)
+		}
+	}
+	if _, err := UnmarshalColumnar(append(b, 0)); err != ErrColumnarCorrupted {
+		t.Errorf("trailing data: expected %v, got %v", ErrColumnarCorrupted, err)
+	}
+	if _, err := UnmarshalColumnar([]byte(`[{"target":"metric1"}]`)); err != ErrColumnarCorrupted {
+		t.Errorf("json: expected %v, got %v", ErrColumnarCorrupted, err)
+	}
+}
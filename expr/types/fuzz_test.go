@@ -0,0 +1,92 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	pickle "github.com/lomik/og-rek"
+)
+
+func fuzzValues(values ...float64) []byte {
+	b := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(b[8*i:], math.Float64bits(v))
+	}
+	return b
+}
+
+// FuzzMarshal marshals the series to all formats, formats that could be decoded are checked to keep name and points.
+// Values are little-endian float64 bits
+func FuzzMarshal(f *testing.F) {
+	f.Add("metric1", fuzzValues(1, 1.5, 2.25, math.NaN()), uint8(0))
+	f.Add("metric2;foo=bar", fuzzValues(math.Inf(1), math.Inf(-1), -0.0, 1e300), uint8(2))
+	f.Add("metric\"1\xff\U0001F600é", fuzzValues(1), uint8(3))
+	f.Add("", []byte{}, uint8(1))
+
+	f.Fuzz(func(t *testing.T, name string, data []byte, precision uint8) {
+		values := make([]float64, 0, len(data)/8)
+		for ; len(data) >= 8; data = data[8:] {
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+		}
+		r := MakeMetricData(name, values, 60, 0)
+		results := []*MetricData{r}
+
+		var js []struct {
+			Target     string          `json:"target"`
+			Datapoints [][]interface{} `json:"datapoints"`
+		}
+		b := MarshalJSONWithPrecision(results, int(precision%4)-1)
+		if err := json.Unmarshal(b, &js); err != nil {
+			t.Fatalf("invalid JSON %q: %v", b, err)
+		}
+		if len(js) != 1 || len(js[0].Datapoints) != len(r.Values) {
+			t.Fatalf("JSON doesn't match series: %q", b)
+		}
+
+		p, err := pickle.NewDecoder(bytes.NewReader(MarshalPickle(results))).Decode()
+		if err != nil {
+			t.Fatalf("invalid pickle: %v", err)
+		}
+		if l, ok := p.([]interface{}); !ok || len(l) != 1 {
+			t.Fatalf("pickle doesn't match series: %#v", p)
+		}
+		if m, ok := p.([]interface{})[0].(map[interface{}]interface{}); !ok || m["name"] != r.Name {
+			t.Fatalf("pickle doesn't match series: %#v", p)
+		}
+
+		b, err = MarshalProtobufV3(results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var response pb.MultiFetchResponse
+		if err := response.Unmarshal(b); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Metrics) != 1 || response.Metrics[0].Name != r.Name || len(response.Metrics[0].Values) != len(r.Values) {
+			t.Fatalf("protobuf doesn't match series: %+v", response)
+		}
+
+		if _, err := MarshalProtobufV2(results); err != nil {
+			t.Fatal(err)
+		}
+		b, err = MarshalColumnar(results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := UnmarshalColumnar(b); err != nil {
+			t.Fatal(err)
+		}
+
+		MarshalCSV(results)
+		MarshalRaw(results)
+		MarshalGraphlot(results)
+		MarshalDygraph(results)
+		MarshalRickshaw(results)
+		MarshalC3(results)
+		MarshalParquet(results)
+	})
+}
@@ -222,6 +222,8 @@ type FunctionParam struct {
 	Options     []string      `json:"options,omitempty"`
 	Suggestions []*Suggestion `json:"suggestions,omitempty"`
 	Default     *Suggestion   `json:"default,omitempty"`
+	// PerSeries is set for string parameters, that also accept node(*nodes) and tag(name) resolved for each series
+	PerSeries bool `json:"perSeries,omitempty"`
 }
 
 // FunctionDescription contains full function description.
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"math"
 	"math/rand"
+	"reflect"
 	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
 )
 
 func TestJSONResponse(t *testing.T) {
@@ -20,6 +23,12 @@ func TestJSONResponse(t *testing.T) {
 			},
 			[]byte(`[{"target":"metric1","datapoints":[[1,100],[1.5,200],[2.25,300],[null,400]],"tags":{"name":"metric1"}},{"target":"metric2;foo=bar","datapoints":[[2,100],[2.5,200],[3.25,300],[4,400],[5,500]],"tags":{"foo":"bar","name":"metric2"}}]`),
 		},
+		{
+			[]*MetricData{
+				MakeMetricData("metric\"1\xff\U0001F600é", []float64{1}, 100, 100),
+			},
+			[]byte(`[{"target":"metric\"1\ufffd\ud83d\ude00\u00e9","datapoints":[[1,100]],"tags":{"name":"metric\"1\ufffd\ud83d\ude00\u00e9"}}]`),
+		},
 	}
 
 	for _, tt := range tests {
@@ -30,6 +39,28 @@ func TestJSONResponse(t *testing.T) {
 	}
 }
 
+func TestJSONResponseWithPrecision(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("metric1", []float64{0.3333333333333333, 2, -0.0001, 1.25, math.NaN()}, 100, 100),
+	}
+
+	tests := []struct {
+		precision int
+		out       []byte
+	}{
+		{-1, []byte(`[{"target":"metric1","datapoints":[[0.3333333333333333,100],[2,200],[-0.0001,300],[1.25,400],[null,500]],"tags":{"name":"metric1"}}]`)},
+		{0, []byte(`[{"target":"metric1","datapoints":[[0,100],[2,200],[0,300],[1,400],[null,500]],"tags":{"name":"metric1"}}]`)},
+		{3, []byte(`[{"target":"metric1","datapoints":[[0.333,100],[2,200],[0,300],[1.25,400],[null,500]],"tags":{"name":"metric1"}}]`)},
+	}
+
+	for _, tt := range tests {
+		b := MarshalJSONWithPrecision(results, tt.precision)
+		if !bytes.Equal(b, tt.out) {
+			t.Errorf("marshalJSONWithPrecision(%d):\n    got %+v\n    want %+v", tt.precision, string(b), string(tt.out))
+		}
+	}
+}
+
 func TestRawResponse(t *testing.T) {
 
 	tests := []struct {
@@ -53,6 +84,174 @@ func TestRawResponse(t *testing.T) {
 	}
 }
 
+func TestGraphlotResponse(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("metric1", []float64{1, 1.5, math.NaN()}, 100, 100),
+		MakeMetricData("metric2", []float64{2}, 60, 120),
+	}
+	out := `[{"name":"metric1","start":100,"end":400,"step":100,"data":[1,1.5,null]},` +
+		`{"name":"metric2","start":120,"end":180,"step":60,"data":[2]}]`
+
+	b := MarshalGraphlot(results)
+	if string(b) != out {
+		t.Errorf("MarshalGraphlot()=%s, want %s", b, out)
+	}
+}
+
+func TestDygraphResponse(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("metric1", []float64{1, 1.5, math.NaN()}, 100, 100),
+		MakeMetricData("metric2;foo=bar", []float64{2, math.Inf(1)}, 50, 150),
+	}
+	out := `{"labels":["Time","metric1","metric2;foo=bar"],"data":[` +
+		`[100000,1,null],[150000,null,2],[200000,1.5,null],[300000,null,null]]}`
+
+	b := MarshalDygraph(results)
+	if string(b) != out {
+		t.Errorf("MarshalDygraph()=%s, want %s", b, out)
+	}
+}
+
+func TestRickshawResponse(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("metric1", []float64{1, 1.5, math.NaN()}, 100, 100),
+		MakeMetricData("metric2", []float64{2, 4, 6, 8}, 60, 120),
+	}
+	results[1].SetValuesPerPoint(2)
+	out := `[{"target":"metric1","datapoints":[{"x":100,"y":1},{"x":200,"y":1.5},{"x":300,"y":null}]},` +
+		`{"target":"metric2","datapoints":[{"x":120,"y":3},{"x":240,"y":7}]}]`
+
+	b := MarshalRickshaw(results)
+	if string(b) != out {
+		t.Errorf("MarshalRickshaw()=%s, want %s", b, out)
+	}
+}
+
+func TestC3Response(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("metric1", []float64{1, 1.5, math.NaN()}, 100, 100),
+		MakeMetricData("metric2", []float64{2}, 50, 150),
+	}
+	out := `{"x":"x","columns":[["x",100000,150000,200000,300000],["metric1",1,null,1.5,null],["metric2",null,2,null,null]]}`
+
+	b := MarshalC3(results)
+	if string(b) != out {
+		t.Errorf("MarshalC3()=%s, want %s", b, out)
+	}
+}
+
+func TestScalarsResponse(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("metric1;dc=1", []float64{5, 1, 2, math.NaN()}, 60, 0),
+		MakeMetricData("metric2", []float64{math.NaN(), math.NaN()}, 60, 0),
+		MakeMetricData("metric3", []float64{}, 60, 0),
+	}
+
+	tests := []struct {
+		reduce func([]float64) float64
+		window int64
+		out    string
+	}{
+		{consolidations.AggMax, 0, `[{"target":"metric1;dc=1","tags":{"dc":"1","name":"metric1"},"value":5},` +
+			`{"target":"metric2","tags":{"name":"metric2"},"value":null},{"target":"metric3","tags":{"name":"metric3"},"value":null}]`},
+		{consolidations.AggMax, 180, `[{"target":"metric1;dc=1","tags":{"dc":"1","name":"metric1"},"value":2},` +
+			`{"target":"metric2","tags":{"name":"metric2"},"value":null},{"target":"metric3","tags":{"name":"metric3"},"value":null}]`},
+		{consolidations.AggLast, 0, `[{"target":"metric1;dc=1","tags":{"dc":"1","name":"metric1"},"value":2},` +
+			`{"target":"metric2","tags":{"name":"metric2"},"value":null},{"target":"metric3","tags":{"name":"metric3"},"value":null}]`},
+	}
+
+	for _, tt := range tests {
+		b := MarshalScalars(results, tt.reduce, tt.window)
+		if string(b) != tt.out {
+			t.Errorf("MarshalScalars(window=%d)=%s, want %s", tt.window, b, tt.out)
+		}
+	}
+}
+
+func TestBreachesResponse(t *testing.T) {
+	nan := math.NaN()
+	results := []*MetricData{
+		MakeMetricData("metric1", []float64{1, 0, 1, 1, 1, nan}, 60, 0),
+		MakeMetricData("metric2", []float64{1, 1, nan, 1, 0, nan}, 60, 0),
+		MakeMetricData("metric3", []float64{1, nan, 1, 1, 1, 1}, 60, 0),
+		MakeMetricData("metric4", []float64{nan, nan}, 60, 0),
+	}
+	above := func(v float64) bool { return v > 0.5 }
+
+	tests := []struct {
+		duration int64
+		out      string
+	}{
+		{0, `[{"target":"metric1","tags":{"name":"metric1"},"since":120,"value":1},` +
+			`{"target":"metric3","tags":{"name":"metric3"},"since":120,"value":1}]`},
+		{240, `[{"target":"metric3","tags":{"name":"metric3"},"since":120,"value":1}]`},
+		{300, `[]`},
+	}
+
+	for _, tt := range tests {
+		b := MarshalBreaches(results, above, tt.duration)
+		if string(b) != tt.out {
+			t.Errorf("MarshalBreaches(duration=%d)=%s, want %s", tt.duration, b, tt.out)
+		}
+	}
+}
+
+func TestCopyLink(t *testing.T) {
+	m := MakeMetricData("metric1;dc=1", []float64{1, 2, 3, 4}, 10, 100)
+	m.AppliedFunctions = []string{"sum"}
+	m.ConsolidationFunc = "average"
+	m.SetValuesPerPoint(2)
+	m.AggregatedValues()
+
+	c := m.CopyLink()
+	c.Tags["dc"] = "2"
+	c.AppliedFunctions[0] = "avg"
+	c.Values = []float64{5, 6, 7, 8}
+
+	if m.Tags["dc"] != "1" || m.AppliedFunctions[0] != "sum" {
+		t.Errorf("original series was changed: tags %v, applied functions %v", m.Tags, m.AppliedFunctions)
+	}
+	if got := c.AggregatedValues(); !equalValues(got, []float64{5.5, 7.5}) {
+		t.Errorf("aggregated values of the copy = %v, want [5.5 7.5]", got)
+	}
+
+	d := m.CopyData()
+	d.Values[0] = 10
+	if m.Values[0] != 1 {
+		t.Errorf("values of the original series were changed: %v", m.Values)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	m := MakeMetricData("metric1", []float64{1, 2, 3, 4, 5}, 10, 100)
+
+	tests := []struct {
+		from, until int64
+		start, stop int64
+		values      []float64
+	}{
+		{0, 1000, 100, 150, []float64{1, 2, 3, 4, 5}},
+		{110, 130, 110, 130, []float64{2, 3}},
+		{105, 131, 110, 140, []float64{2, 3, 4}},
+		{200, 300, 150, 150, []float64{}},
+		{0, 50, 100, 100, []float64{}},
+	}
+
+	for _, tt := range tests {
+		s := m.Slice(tt.from, tt.until)
+		if s.StartTime != tt.start || s.StopTime != tt.stop || !equalValues(s.Values, tt.values) {
+			t.Errorf("Slice(%d, %d) = %d-%d %v, want %d-%d %v", tt.from, tt.until, s.StartTime, s.StopTime, s.Values,
+				tt.start, tt.stop, tt.values)
+		}
+	}
+
+	s := m.Slice(110, 130)
+	_ = append(s.Values, 10)
+	if m.Values[3] != 4 {
+		t.Errorf("appending to slice changed original values: %v", m.Values)
+	}
+}
+
 func getData(rangeSize int) []float64 {
 	var data = make([]float64, rangeSize)
 	var r = rand.New(rand.NewSource(99))
@@ -74,3 +273,94 @@ func BenchmarkMarshalJSON(b *testing.B) {
 		_ = MarshalJSON(data)
 	}
 }
+
+func TestAggregateValuesUnknownConsolidation(t *testing.T) {
+	defer func(fallback bool) { ConsolidationFallback = fallback }(ConsolidationFallback)
+
+	newSeries := func() *MetricData {
+		r := MakeMetricData("metric1", []float64{1, 3, 5, 7, 9}, 60, 0)
+		r.ConsolidationFunc = "unknown"
+		r.SetValuesPerPoint(2)
+		return r
+	}
+
+	ConsolidationFallback = true
+	before := UnknownConsolidations.Value()
+	r := newSeries()
+	if err := r.AggregateValues(); err != nil {
+		t.Fatalf("unexpected error with fallback: %v", err)
+	}
+	if got, expected := r.AggregatedValues(), []float64{2, 6, 9}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+	if UnknownConsolidations.Value() != before+1 {
+		t.Errorf("unknown consolidation should be counted")
+	}
+
+	ConsolidationFallback = false
+	r = newSeries()
+	err := r.AggregateValues()
+	if _, ok := err.(ErrUnknownConsolidationFunc); !ok {
+		t.Fatalf("expected ErrUnknownConsolidationFunc, got %v", err)
+	}
+	if got := r.AggregatedValues(); len(got) != 3 || !math.IsNaN(got[0]) {
+		t.Errorf("series that can't be consolidated should be absent, got %v", got)
+	}
+	if err = ConsolidateJSON(1, []*MetricData{newSeries()}); err == nil {
+		t.Error("expected error from ConsolidateJSON")
+	}
+
+	r = newSeries()
+	r.ConsolidationFunc = ""
+	if err = r.AggregateValues(); err != nil {
+		t.Errorf("series without consolidation function should be averaged, got %v", err)
+	}
+}
+
+func TestRetainAggregatedValues(t *testing.T) {
+	defer func(retain bool) { RetainAggregatedValues = retain }(RetainAggregatedValues)
+
+	newResults := func() []*MetricData {
+		return []*MetricData{
+			MakeMetricData("metric1", []float64{1, 3, 5, 7, 9}, 60, 0),
+			MakeMetricData("metric2", []float64{1, math.NaN(), 2, 4}, 60, 0),
+		}
+	}
+
+	RetainAggregatedValues = true
+	retained := newResults()
+	if err := ConsolidateJSON(2, retained); err != nil {
+		t.Fatal(err)
+	}
+	if retained[0].aggregatedValues != nil {
+		t.Fatal("values shouldn't be consolidated before they are marshaled")
+	}
+	want := [][]byte{MarshalJSON(retained), MarshalRickshaw(retained), MarshalC3(retained)}
+	if retained[0].aggregatedValues == nil {
+		t.Fatal("consolidated values should be retained")
+	}
+	retained[0].ResetAggregatedValues()
+	if retained[0].aggregatedValues != nil {
+		t.Error("consolidated values should be reset")
+	}
+
+	RetainAggregatedValues = false
+	results := newResults()
+	if err := ConsolidateJSON(2, results); err != nil {
+		t.Fatal(err)
+	}
+	got := [][]byte{MarshalJSON(results), MarshalRickshaw(results), MarshalC3(results)}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("got %s, want %s", got[i], want[i])
+		}
+	}
+	if v := results[0].AggregatedValues(); !reflect.DeepEqual(v, []float64{3, 8}) {
+		t.Errorf("got %v, want %v", v, []float64{3, 8})
+	}
+	for _, r := range results {
+		if r.aggregatedValues != nil {
+			t.Errorf("consolidated values of %s shouldn't be retained", r.Name)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package types
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+)
+
+// Methods of bringing series with different steps together
+const (
+	// NormalizeNaN keeps values at their timestamps, missing points are filled with NaN
+	NormalizeNaN = "nan"
+	// NormalizeRepeat repeats each value until the next one
+	NormalizeRepeat = "repeat"
+	// NormalizeInterpolate interpolates linearly between values
+	NormalizeInterpolate = "interpolate"
+	// NormalizeAggregate consolidates values to the least common multiple of steps using ConsolidationFunc of the series
+	NormalizeAggregate = "aggregate"
+)
+
+// NormalizeMethods lists all supported normalization methods
+var NormalizeMethods = []string{NormalizeNaN, NormalizeRepeat, NormalizeInterpolate, NormalizeAggregate}
+
+// DefaultNormalizeMethod is used by Normalize when method is not specified
+var DefaultNormalizeMethod = NormalizeNaN
+
+// IsValidNormalizeMethod checks if method is supported by Normalize
+func IsValidNormalizeMethod(method string) bool {
+	for _, m := range NormalizeMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b int64) int64 {
+	return a / gcd(a, b) * b
+}
+
+// Normalize brings series to the same step, start and stop time, so they can be combined point by point.
+// Aggregate method uses least common multiple of steps, all others use greatest common divisor.
+// If method is empty, DefaultNormalizeMethod is used. Original series are not modified.
+func Normalize(series []*MetricData, method string) ([]*MetricData, error) {
+	if method == "" {
+		method = DefaultNormalizeMethod
+	}
+	if !IsValidNormalizeMethod(method) {
+		return nil, fmt.Errorf("unknown normalize method '%s', supported: %v", method, NormalizeMethods)
+	}
+	if len(series) == 0 {
+		return series, nil
+	}
+
+	step := series[0].StepTime
+	start := series[0].StartTime
+	stop := series[0].StopTime
+	aligned := true
+	for _, s := range series {
+		if s.StepTime <= 0 {
+			return nil, fmt.Errorf("series %s has invalid step %d", s.Name, s.StepTime)
+		}
+		aligned = aligned && s.StepTime == series[0].StepTime && s.StartTime == series[0].StartTime &&
+			len(s.Values) == len(series[0].Values)
+		if method == NormalizeAggregate {
+			step = lcm(step, s.StepTime)
+		} else {
+			step = gcd(step, s.StepTime)
+		}
+		if s.StartTime < start {
+			start = s.StartTime
+		}
+		if s.StopTime > stop {
+			stop = s.StopTime
+		}
+	}
+	if aligned {
+		return series, nil
+	}
+
+	start -= start % step
+	n := int((stop - start + step - 1) / step)
+
+	res := make([]*MetricData, 0, len(series))
+	for _, s := range series {
+		r := *s
+		r.Values = make([]float64, n)
+		for i := range r.Values {
+			r.Values[i] = math.NaN()
+		}
+		r.StepTime = step
+		r.StartTime = start
+		r.StopTime = start + int64(n)*step
+		r.SetValuesPerPoint(s.ValuesPerPoint)
+
+		switch method {
+		case NormalizeNaN:
+			for i, v := range s.Values {
+				if idx := int((s.StartTime + int64(i)*s.StepTime - start) / step); idx < n {
+					r.Values[idx] = v
+				}
+			}
+		case NormalizeRepeat, NormalizeInterpolate:
+			upsampleValues(s, &r, method == NormalizeInterpolate)
+		case NormalizeAggregate:
+			aggregateValues(s, &r)
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+// upsampleValues fills each point of r with the value of s that covers it, optionally interpolating to the next value
+func upsampleValues(s, r *MetricData, interpolate bool) {
+	for i := range r.Values {
+		t := r.StartTime + int64(i)*r.StepTime
+		if t < s.StartTime {
+			continue
+		}
+		idx := int((t - s.StartTime) / s.StepTime)
+		if idx >= len(s.Values) {
+			break
+		}
+
+		v := s.Values[idx]
+		if interpolate && idx+1 < len(s.Values) && !math.IsNaN(s.Values[idx+1]) {
+			frac := float64(t-s.StartTime-int64(idx)*s.StepTime) / float64(s.StepTime)
+			v += (s.Values[idx+1] - v) * frac
+		}
+		r.Values[i] = v
+	}
+}
+
+// aggregateValues consolidates all values of s that fall into each point of r
+func aggregateValues(s, r *MetricData) {
+	f, ok := consolidations.ConsolidationFunc(s.ConsolidationFunc)
+	if !ok {
+		f = consolidations.AggMean
+	}
+
+	buckets := make([][]float64, len(r.Values))
+	for i, v := range s.Values {
+		idx := int((s.StartTime + int64(i)*s.StepTime - r.StartTime) / r.StepTime)
+		if idx < len(buckets) {
+			buckets[idx] = append(buckets[idx], v)
+		}
+	}
+	for i, b := range buckets {
+		if len(b) > 0 {
+			r.Values[i] = f(b)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+func equalValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNormalize(t *testing.T) {
+	nan := math.NaN()
+
+	tests := []struct {
+		method string
+		step   int64
+		start  int64
+		want   [][]float64
+	}{
+		{
+			NormalizeNaN, 10, 0,
+			[][]float64{
+				{1, 2, 3, 4, 5, 6, nan, nan},
+				{nan, nan, 7, nan, 8, nan, 9, nan},
+			},
+		},
+		{
+			NormalizeRepeat, 10, 0,
+			[][]float64{
+				{1, 2, 3, 4, 5, 6, nan, nan},
+				{nan, nan, 7, 7, 8, 8, 9, 9},
+			},
+		},
+		{
+			NormalizeInterpolate, 10, 0,
+			[][]float64{
+				{1, 2, 3, 4, 5, 6, nan, nan},
+				{nan, nan, 7, 7.5, 8, 8.5, 9, 9},
+			},
+		},
+		{
+			NormalizeAggregate, 20, 0,
+			[][]float64{
+				{1.5, 3.5, 5.5, nan},
+				{nan, 7, 8, 9},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			series := []*MetricData{
+				MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 10, 0),
+				MakeMetricData("metric2", []float64{7, 8, 9}, 20, 20),
+			}
+
+			res, err := Normalize(series, tt.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != len(tt.want) {
+				t.Fatalf("unexpected number of series: %d", len(res))
+			}
+			for i, r := range res {
+				if r.StepTime != tt.step || r.StartTime != tt.start || r.StopTime != tt.start+int64(len(tt.want[i]))*tt.step {
+					t.Errorf("%s: unexpected time range: step=%d start=%d stop=%d", r.Name, r.StepTime, r.StartTime, r.StopTime)
+				}
+				if !equalValues(r.Values, tt.want[i]) {
+					t.Errorf("%s: got %v, want %v", r.Name, r.Values, tt.want[i])
+				}
+			}
+			if len(series[0].Values) != 6 || series[1].StepTime != 20 {
+				t.Error("original series were modified")
+			}
+		})
+	}
+}
+
+func TestNormalizeDefault(t *testing.T) {
+	defer func(m string) { DefaultNormalizeMethod = m }(DefaultNormalizeMethod)
+	DefaultNormalizeMethod = NormalizeRepeat
+
+	res, err := Normalize([]*MetricData{
+		MakeMetricData("metric1", []float64{1, 2}, 10, 0),
+		MakeMetricData("metric2", []float64{3}, 20, 0),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalValues(res[1].Values, []float64{3, 3}) {
+		t.Errorf("got %v, want [3 3]", res[1].Values)
+	}
+
+	if _, err := Normalize(res, "foo"); err == nil {
+		t.Error("expected error for unknown method")
+	}
+}
@@ -0,0 +1,153 @@
+package types
+
+import "math"
+
+// Float32Values enables storage of values of series kept by caches (see PackedSeries) with float32 precision. That
+// halves memory of cached values, but values lose precision: float32 has 24 significant bits, so integers greater
+// than 16777216 and fractions are rounded to about 7 significant digits. NaNs and infinities are kept.
+//
+// Evaluation of functions and consolidation still use float64 values, values are converted when series are taken
+// from caches
+var Float32Values = false
+
+// SparseValues enables storage of series kept by caches (see PackedSeries) as runs of present values, absent values
+// between them aren't stored. Series are stored that way only if it takes less memory than storage of all values
+var SparseValues = false
+
+// packedRun is a run of present values, that starts at offset of the series
+type packedRun struct {
+	offset int32
+	length int32
+}
+
+// packedRunSize is the size of packedRun in bytes
+const packedRunSize = 8
+
+// PackedSeries is a copy of series, that is kept by a cache. Values are stored with float32 precision, if
+// Float32Values was enabled when series was packed, and only present values are stored, if SparseValues was enabled
+// and series has enough absent values
+type PackedSeries struct {
+	// series has no values, they are in values or values32
+	series *MetricData
+	length int
+	// runs are nil, if all values are stored
+	runs     []packedRun
+	values   []float64
+	values32 []float32
+}
+
+// PackSeries copies the series for storage
+func PackSeries(r *MetricData) PackedSeries {
+	p := PackedSeries{series: r.CopyLink(), length: len(r.Values)}
+	p.series.Values = nil
+
+	valueSize := 8
+	if Float32Values {
+		valueSize = 4
+	}
+	present := r.Values
+	if SparseValues {
+		runs, count := presentRuns(r.Values)
+		if len(runs)*packedRunSize+count*valueSize < len(r.Values)*valueSize {
+			p.runs = runs
+			present = make([]float64, 0, count)
+			for _, run := range runs {
+				present = append(present, r.Values[run.offset:run.offset+run.length]...)
+			}
+		}
+	}
+
+	if Float32Values {
+		p.values32 = make([]float32, len(present))
+		for i, v := range present {
+			p.values32[i] = float32(v)
+		}
+	} else {
+		p.values = make([]float64, len(present))
+		copy(p.values, present)
+	}
+	return p
+}
+
+// presentRuns returns runs of present values and their total amount
+func presentRuns(values []float64) ([]packedRun, int) {
+	var runs []packedRun
+	var count int
+	for i := 0; i < len(values); {
+		if math.IsNaN(values[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(values) && !math.IsNaN(values[i]) {
+			i++
+		}
+		runs = append(runs, packedRun{offset: int32(start), length: int32(i - start)})
+		count += i - start
+	}
+	return runs, count
+}
+
+// Unpack returns a new copy of the series, so callers could modify it
+func (p PackedSeries) Unpack() *MetricData {
+	r := p.series.CopyLink()
+	r.Values = make([]float64, p.length)
+	if p.runs == nil {
+		p.copyValues(r.Values, 0)
+		return r
+	}
+
+	for i := range r.Values {
+		r.Values[i] = math.NaN()
+	}
+	var stored int
+	for _, run := range p.runs {
+		p.copyValues(r.Values[run.offset:run.offset+run.length], stored)
+		stored += int(run.length)
+	}
+	return r
+}
+
+// copyValues copies stored values, starting from the offset, to dst
+func (p PackedSeries) copyValues(dst []float64, offset int) {
+	if p.values32 == nil {
+		copy(dst, p.values[offset:])
+		return
+	}
+	for i, v := range p.values32[offset : offset+len(dst)] {
+		dst[i] = float64(v)
+	}
+}
+
+// Series returns metadata of the packed series, values must be taken by Unpack. Returned series must not be modified
+func (p PackedSeries) Series() *MetricData {
+	return p.series
+}
+
+// Len returns amount of values, including absent ones
+func (p PackedSeries) Len() int {
+	return p.length
+}
+
+// Size returns approximate size of the packed series in bytes
+func (p PackedSeries) Size() uint64 {
+	return uint64(packedRunSize*len(p.runs) + 8*len(p.values) + 4*len(p.values32) + len(p.series.Name))
+}
+
+// PackSeriesList packs all series
+func PackSeriesList(series []*MetricData) []PackedSeries {
+	res := make([]PackedSeries, len(series))
+	for i, s := range series {
+		res[i] = PackSeries(s)
+	}
+	return res
+}
+
+// UnpackSeriesList unpacks all series
+func UnpackSeriesList(packed []PackedSeries) []*MetricData {
+	res := make([]*MetricData, len(packed))
+	for i, p := range packed {
+		res[i] = p.Unpack()
+	}
+	return res
+}
@@ -0,0 +1,104 @@
+package types
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestPackedSeries(t *testing.T) {
+	defer func(float32Values bool) { Float32Values = float32Values }(Float32Values)
+
+	values := []float64{1, 0.1, math.NaN(), math.Inf(-1), 16777217, 1e300}
+	r := MakeMetricData("metric1;foo=bar", values, 60, 0)
+	r.ConsolidationFunc = "max"
+
+	Float32Values = false
+	p := PackSeries(r)
+	if p.Size() != uint64(8*len(values)+len(r.Name)) {
+		t.Errorf("unexpected size %d", p.Size())
+	}
+	got := p.Unpack()
+	if !reflect.DeepEqual(got.Tags, r.Tags) || got.ConsolidationFunc != "max" || p.Len() != len(values) {
+		t.Errorf("unexpected series %+v", got)
+	}
+	for i, v := range values {
+		if math.Float64bits(got.Values[i]) != math.Float64bits(v) {
+			t.Errorf("value %d: got %v, want %v", i, got.Values[i], v)
+		}
+	}
+
+	Float32Values = true
+	p = PackSeries(r)
+	if p.Size() != uint64(4*len(values)+len(r.Name)) || p.Len() != len(values) {
+		t.Errorf("unexpected size %d or length %d", p.Size(), p.Len())
+	}
+	// series is packed with the mode that was enabled when it was packed
+	Float32Values = false
+	got = p.Unpack()
+	want := []float64{1, float64(float32(0.1)), math.NaN(), math.Inf(-1), 16777216, math.Inf(1)}
+	for i, v := range want {
+		if !(got.Values[i] == v || math.IsNaN(got.Values[i]) && math.IsNaN(v)) {
+			t.Errorf("value %d: got %v, want %v", i, got.Values[i], v)
+		}
+	}
+	if got.Name != r.Name || got.ConsolidationFunc != "max" || !reflect.DeepEqual(got.Tags, r.Tags) {
+		t.Errorf("unexpected series %+v", got)
+	}
+
+	// unpacked series are copies
+	got.Values[0] = 42
+	got.Tags["foo"] = "baz"
+	if again := p.Unpack(); again.Values[0] != 1 || again.Tags["foo"] != "bar" {
+		t.Errorf("packed series was modified: %+v", again)
+	}
+	if r.Values[1] != 0.1 {
+		t.Errorf("original series was modified: %v", r.Values)
+	}
+}
+
+func TestPackedSeriesSparse(t *testing.T) {
+	defer func(float32Values, sparseValues bool) {
+		Float32Values, SparseValues = float32Values, sparseValues
+	}(Float32Values, SparseValues)
+	SparseValues = true
+
+	sparse := make([]float64, 1000)
+	for i := range sparse {
+		sparse[i] = math.NaN()
+	}
+	copy(sparse[10:], []float64{1, 2, 3})
+	sparse[500] = 4
+	sparse[999] = 5
+	dense := []float64{1, math.NaN(), 3, math.NaN(), 5}
+
+	for _, float32Values := range []bool{false, true} {
+		Float32Values = float32Values
+		valueSize := 8
+		if float32Values {
+			valueSize = 4
+		}
+		for _, values := range [][]float64{sparse, dense, nil} {
+			r := MakeMetricData("metric1", values, 60, 0)
+			p := PackSeries(r)
+			got := p.Unpack()
+			if p.Len() != len(values) || len(got.Values) != len(values) {
+				t.Fatalf("got %d values, want %d", len(got.Values), len(values))
+			}
+			for i, v := range values {
+				if !(got.Values[i] == v || math.IsNaN(got.Values[i]) && math.IsNaN(v)) {
+					t.Errorf("value %d: got %v, want %v", i, got.Values[i], v)
+				}
+			}
+
+			// series are stored as runs only if it's smaller
+			size := uint64(len(values)*valueSize + len(r.Name))
+			if len(values) == len(sparse) {
+				size = uint64(3*packedRunSize + 5*valueSize + len(r.Name))
+			}
+			if p.Size() != size {
+				t.Errorf("%d values: got size %d, want %d", len(values), p.Size(), size)
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package types
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Parquet file has a row per point with columns name (string), timestamp (milliseconds) and value (double, null if
+// absent). All rows are written to a single row group with a single uncompressed data page per column, values are
+// PLAIN encoded. Metadata is encoded by thrift compact protocol, see https://github.com/apache/parquet-format
+
+const parquetMagic = "PAR1"
+
+// physical types, repetitions, converted types, encodings and page types of parquet-format
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetDataPage = 0
+)
+
+// types of fields of thrift compact protocol
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetColumn is a column chunk: its schema and encoded page
+type parquetColumn struct {
+	name          string
+	typ           int32
+	repetition    int32
+	convertedType int32
+	data          []byte
+}
+
+// MarshalParquet marshals metric data to Apache Parquet file
+func MarshalParquet(results []*MetricData) []byte {
+	var names, timestamps, values, defined []byte
+	rows := 0
+	for _, r := range results {
+		t := r.StartTime
+		for _, v := range r.Values {
+			names = appendParquetString(names, r.Name)
+			timestamps = appendUint64LE(timestamps, uint64(t*1000))
+			if rows%8 == 0 {
+				defined = append(defined, 0)
+			}
+			if !math.IsNaN(v) {
+				values = appendUint64LE(values, math.Float64bits(v))
+				defined[len(defined)-1] |= 1 << uint(rows%8)
+			}
+			rows++
+			t += r.StepTime
+		}
+	}
+
+	// definition levels of optional column are bit-packed run of RLE/bit-packing hybrid encoding, prefixed by length
+	levels := appendUvarint(nil, uint64(len(defined))<<1|1)
+	levels = append(levels, defined...)
+	valueData := appendUint32LE(nil, uint32(len(levels)))
+	valueData = append(valueData, levels...)
+	valueData = append(valueData, values...)
+
+	columns := []parquetColumn{
+		{name: "name", typ: parquetByteArray, repetition: parquetRequired, convertedType: parquetUTF8, data: names},
+		{name: "timestamp", typ: parquetInt64, repetition: parquetRequired, convertedType: parquetTimestampMillis, data: timestamps},
+		{name: "value", typ: parquetDouble, repetition: parquetOptional, convertedType: -1, data: valueData},
+	}
+
+	b := []byte(parquetMagic)
+	offsets := make([]int64, len(columns))
+	sizes := make([]int64, len(columns))
+	if rows > 0 {
+		for i, c := range columns {
+			offsets[i] = int64(len(b))
+			b = append(b, parquetPageHeader(c.data, rows)...)
+			b = append(b, c.data...)
+			sizes[i] = int64(len(b)) - offsets[i]
+		}
+	}
+
+	w := newThriftWriter()
+	w.i32(1, 1)
+	w.beginList(2, thriftStruct, len(columns)+1)
+	w.beginElem()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(columns)))
+	w.endStruct()
+	for _, c := range columns {
+		w.beginElem()
+		w.i32(1, c.typ)
+		w.i32(3, c.repetition)
+		w.binary(4, c.name)
+		if c.convertedType >= 0 {
+			w.i32(6, c.convertedType)
+		}
+		w.endStruct()
+	}
+	w.i64(3, int64(rows))
+	if rows == 0 {
+		w.beginList(4, thriftStruct, 0)
+	} else {
+		w.beginList(4, thriftStruct, 1)
+		w.beginElem()
+		w.beginList(1, thriftStruct, len(columns))
+		total := int64(0)
+		for i, c := range columns {
+			w.beginElem()
+			w.i64(2, offsets[i])
+			w.beginStruct(3)
+			w.i32(1, c.typ)
+			w.beginList(2, thriftI32, 2)
+			w.b = appendVarint(w.b, parquetPlain)
+			w.b = appendVarint(w.b, parquetRLE)
+			w.beginList(3, thriftBinary, 1)
+			w.b = appendString(w.b, c.name)
+			w.i32(4, 0)
+			w.i64(5, int64(rows))
+			w.i64(6, sizes[i])
+			w.i64(7, sizes[i])
+			w.i64(9, offsets[i])
+			w.endStruct()
+			w.endStruct()
+			total += sizes[i]
+		}
+		w.i64(2, total)
+		w.i64(3, int64(rows))
+		w.endStruct()
+	}
+	w.binary(6, "carbonapi")
+	w.endStruct()
+
+	b = append(b, w.b...)
+	b = appendUint32LE(b, uint32(len(w.b)))
+	return append(b, parquetMagic...)
+}
+
+// parquetPageHeader encodes header of data page with PLAIN encoded values
+func parquetPageHeader(data []byte, rows int) []byte {
+	w := newThriftWriter()
+	w.i32(1, parquetDataPage)
+	w.i32(2, int32(len(data)))
+	w.i32(3, int32(len(data)))
+	w.beginStruct(5)
+	w.i32(1, int32(rows))
+	w.i32(2, parquetPlain)
+	w.i32(3, parquetRLE)
+	w.i32(4, parquetRLE)
+	w.endStruct()
+	w.endStruct()
+	return w.b
+}
+
+func appendParquetString(b []byte, s string) []byte {
+	b = appendUint32LE(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func appendUint32LE(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64LE(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// thriftWriter encodes structs by thrift compact protocol. Field ids are encoded as deltas from the previous field
+// of the same struct, so fields must be written in order of their ids
+type thriftWriter struct {
+	b    []byte
+	last []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.b = append(w.b, byte(delta)<<4|typ)
+	} else {
+		w.b = append(w.b, typ)
+		w.b = appendVarint(w.b, int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.b = appendVarint(w.b, int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.b = appendVarint(w.b, v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.b = appendString(w.b, s)
+}
+
+// beginList writes header of the list, elements are written after it
+func (w *thriftWriter) beginList(id int16, elem byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.b = append(w.b, byte(n)<<4|elem)
+		return
+	}
+	w.b = append(w.b, 0xf0|elem)
+	w.b = appendUvarint(w.b, uint64(n))
+}
+
+func (w *thriftWriter) beginStruct(id int16) {
+	w.field(id, thriftStruct)
+	w.last = append(w.last, 0)
+}
+
+// beginElem starts struct that is an element of a list
+func (w *thriftWriter) beginElem() {
+	w.last = append(w.last, 0)
+}
+
+func (w *thriftWriter) endStruct() {
+	w.b = append(w.b, 0)
+	w.last = w.last[:len(w.last)-1]
+}
@@ -0,0 +1,198 @@
+package types
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// thriftReader decodes thrift compact protocol: structs to maps by field id, lists to slices, integers to int64 and
+// binaries to strings
+type thriftReader struct {
+	b   []byte
+	err bool
+}
+
+func (r *thriftReader) byte() byte {
+	if len(r.b) == 0 {
+		r.err = true
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = true
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.err = true
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		if n > len(r.b) {
+			r.err = true
+			return ""
+		}
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case thriftList:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := []interface{}{}
+		for i := 0; i < n && !r.err; i++ {
+			list = append(list, r.value(h&0x0f))
+		}
+		return list
+	case thriftStruct:
+		fields := map[int16]interface{}{}
+		id := int16(0)
+		for !r.err {
+			h := r.byte()
+			if h == 0 {
+				break
+			}
+			if h>>4 == 0 {
+				id = int16(r.varint())
+			} else {
+				id += int16(h >> 4)
+			}
+			fields[id] = r.value(h & 0x0f)
+		}
+		return fields
+	}
+	r.err = true
+	return nil
+}
+
+func readThriftStruct(t *testing.T, b []byte) (map[int16]interface{}, int) {
+	r := &thriftReader{b: b}
+	v := r.value(thriftStruct)
+	if r.err {
+		t.Fatalf("failed to decode thrift struct")
+	}
+	return v.(map[int16]interface{}), len(b) - len(r.b)
+}
+
+func TestMarshalParquet(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("metric1", []float64{1, math.NaN(), 3}, 60, 1510913280),
+		MakeMetricData("metric.two", []float64{math.NaN(), 0.5, -2, 4, 5, 6, 7, 8, 9}, 10, 100),
+	}
+	b := MarshalParquet(results)
+
+	if string(b[:4]) != parquetMagic || string(b[len(b)-4:]) != parquetMagic {
+		t.Fatalf("no magic bytes")
+	}
+	size := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	meta, n := readThriftStruct(t, b[len(b)-8-size:len(b)-8])
+	if n != size {
+		t.Fatalf("metadata size %d, decoded %d", size, n)
+	}
+
+	var schema []string
+	for _, e := range meta[2].([]interface{}) {
+		schema = append(schema, e.(map[int16]interface{})[4].(string))
+	}
+	if !reflect.DeepEqual(schema, []string{"schema", "name", "timestamp", "value"}) {
+		t.Errorf("unexpected schema %v", schema)
+	}
+	if meta[3].(int64) != 12 {
+		t.Errorf("expected 12 rows, got %v", meta[3])
+	}
+
+	groups := meta[4].([]interface{})
+	if len(groups) != 1 {
+		t.Fatalf("expected single row group, got %d", len(groups))
+	}
+	chunks := groups[0].(map[int16]interface{})[1].([]interface{})
+	pages := make([][]byte, len(chunks))
+	for i, c := range chunks {
+		cm := c.(map[int16]interface{})[3].(map[int16]interface{})
+		offset := cm[9].(int64)
+		header, n := readThriftStruct(t, b[offset:])
+		if cm[6].(int64) != int64(n)+header[2].(int64) {
+			t.Errorf("column %d: size %d doesn't match header %d and page %d", i, cm[6], n, header[2])
+		}
+		if rows := header[5].(map[int16]interface{})[1].(int64); rows != 12 {
+			t.Errorf("column %d: expected 12 values, got %d", i, rows)
+		}
+		pages[i] = b[offset+int64(n) : offset+int64(n)+header[2].(int64)]
+	}
+
+	var names []string
+	for p := pages[0]; len(p) > 0; {
+		n := binary.LittleEndian.Uint32(p)
+		names = append(names, string(p[4:4+n]))
+		p = p[4+n:]
+	}
+	var timestamps []int64
+	for p := pages[1]; len(p) > 0; p = p[8:] {
+		timestamps = append(timestamps, int64(binary.LittleEndian.Uint64(p)))
+	}
+	levels := pages[2][4 : 4+binary.LittleEndian.Uint32(pages[2])]
+	values := pages[2][4+len(levels):]
+	if levels[0] != 2<<1|1 {
+		t.Fatalf("expected 2 bit-packed groups of definition levels, got header %d", levels[0])
+	}
+
+	i, valueIdx := 0, 0
+	for _, r := range results {
+		for j, v := range r.Values {
+			if names[i] != r.Name || timestamps[i] != (r.StartTime+int64(j)*r.StepTime)*1000 {
+				t.Errorf("row %d: got %s at %d", i, names[i], timestamps[i])
+			}
+			defined := levels[1+i/8]&(1<<uint(i%8)) != 0
+			if defined == math.IsNaN(v) {
+				t.Errorf("row %d: definition level doesn't match value %v", i, v)
+			}
+			if defined {
+				got := math.Float64frombits(binary.LittleEndian.Uint64(values[8*valueIdx:]))
+				if got != v {
+					t.Errorf("row %d: expected %v, got %v", i, v, got)
+				}
+				valueIdx++
+			}
+			i++
+		}
+	}
+	if len(names) != 12 || len(timestamps) != 12 || len(values) != 8*valueIdx {
+		t.Errorf("unexpected amount of values: %d names, %d timestamps, %d bytes of values", len(names), len(timestamps), len(values))
+	}
+}
+
+func TestMarshalParquetEmpty(t *testing.T) {
+	b := MarshalParquet(nil)
+	size := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	if 4+size+8 != len(b) {
+		t.Fatalf("unexpected size of empty file %d with metadata of %d", len(b), size)
+	}
+	meta, _ := readThriftStruct(t, b[4:4+size])
+	if meta[3].(int64) != 0 || len(meta[4].([]interface{})) != 0 {
+		t.Errorf("expected no rows and row groups, got %v", meta)
+	}
+}
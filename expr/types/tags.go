@@ -0,0 +1,36 @@
+package types
+
+import (
+	"sort"
+	"strings"
+)
+
+// FormatNameWithTags returns canonical graphite form of tagged series name: name followed by ';tag=value' for each tag,
+// sorted by tag. Tag 'name' is skipped, as it's the name itself. Series with the same tags always get the same name,
+// so it's safe to use it as a key
+func FormatNameWithTags(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	size := len(name)
+	for k, v := range tags {
+		if k == "name" {
+			continue
+		}
+		keys = append(keys, k)
+		size += len(k) + len(v) + 2
+	}
+	if len(keys) == 0 {
+		return name
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.Grow(size)
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte(';')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,22 @@
+package types
+
+import "testing"
+
+func TestFormatNameWithTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags map[string]string
+		want string
+	}{
+		{"cpu", nil, "cpu"},
+		{"cpu", map[string]string{"name": "other"}, "cpu"},
+		{"cpu", map[string]string{"host": "a", "dc": "1", "name": "cpu"}, "cpu;dc=1;host=a"},
+		{"cpu", map[string]string{"env": ""}, "cpu;env="},
+	}
+
+	for _, tt := range tests {
+		if got := FormatNameWithTags(tt.name, tt.tags); got != tt.want {
+			t.Errorf("FormatNameWithTags(%q, %v) = %q, want %q", tt.name, tt.tags, got, tt.want)
+		}
+	}
+}
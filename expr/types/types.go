@@ -3,16 +3,17 @@ package types
 import (
 	"bytes"
 	"errors"
+	"expvar"
 	"fmt"
 	"math"
-	"runtime/debug"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/go-graphite/carbonapi/expr/consolidations"
-	"github.com/go-graphite/carbonapi/expr/tags"
+	pbv2 "github.com/go-graphite/protocol/carbonapi_v2_pb"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	pickle "github.com/lomik/og-rek"
 )
@@ -38,6 +39,12 @@ type MetricData struct {
 
 // MarshalCSV marshals metric data to CSV
 func MarshalCSV(results []*MetricData) []byte {
+	return MarshalCSVHumanized(results, "")
+}
+
+// MarshalCSVHumanized marshals metric data to CSV, values are formatted with prefixes of the unit system
+// (see AppendHumanized). If unitSystem is empty, values are written as is
+func MarshalCSVHumanized(results []*MetricData, unitSystem string) []byte {
 
 	var b []byte
 
@@ -53,7 +60,11 @@ func MarshalCSV(results []*MetricData) []byte {
 			b = append(b, time.Unix(t, 0).Format("2006-01-02 15:04:05")...)
 			b = append(b, ',')
 			if !math.IsNaN(v) {
-				b = strconv.AppendFloat(b, v, 'f', -1, 64)
+				if unitSystem != "" {
+					b = AppendHumanized(b, v, unitSystem)
+				} else {
+					b = strconv.AppendFloat(b, v, 'f', -1, 64)
+				}
 			}
 			b = append(b, '\n')
 			t += step
@@ -62,8 +73,9 @@ func MarshalCSV(results []*MetricData) []byte {
 	return b
 }
 
-// ConsolidateJSON consolidates values to maxDataPoints size
-func ConsolidateJSON(maxDataPoints int, results []*MetricData) {
+// ConsolidateJSON sets values per point of series, so they are consolidated to maxDataPoints size on demand (see
+// AggregatedValues). Returns ErrUnknownConsolidationFunc if any of the series can't be consolidated
+func ConsolidateJSON(maxDataPoints int, results []*MetricData) error {
 	startTime := results[0].StartTime
 	endTime := results[0].StopTime
 	for _, r := range results {
@@ -80,7 +92,7 @@ func ConsolidateJSON(maxDataPoints int, results []*MetricData) {
 	timeRange := endTime - startTime
 
 	if timeRange <= 0 {
-		return
+		return nil
 	}
 
 	for _, r := range results {
@@ -88,12 +100,74 @@ func ConsolidateJSON(maxDataPoints int, results []*MetricData) {
 		if numberOfDataPoints > float64(maxDataPoints) {
 			valuesPerPoint := math.Ceil(numberOfDataPoints / float64(maxDataPoints))
 			r.SetValuesPerPoint(int(valuesPerPoint))
+			// values are consolidated by marshalers, only consolidation function is checked here
+			if _, err := r.aggregateFunction(); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
 
 // MarshalJSON marshals metric data to JSON
 func MarshalJSON(results []*MetricData) []byte {
+	return MarshalJSONWithPrecision(results, -1)
+}
+
+// appendJSONFloat appends v rounded to precision decimal places without trailing zeros. Negative precision means
+// the smallest number of digits necessary to represent the value exactly
+func appendJSONFloat(b []byte, v float64, precision int) []byte {
+	if precision < 0 {
+		return strconv.AppendFloat(b, v, 'f', -1, 64)
+	}
+
+	start := len(b)
+	b = strconv.AppendFloat(b, v, 'f', precision, 64)
+	if precision > 0 {
+		b = bytes.TrimRight(b, "0")
+		b = bytes.TrimSuffix(b, []byte{'.'})
+	}
+	if string(b[start:]) == "-0" {
+		b = append(b[:start], '0')
+	}
+	return b
+}
+
+// AppendJSONString appends s as JSON string of ASCII characters. Unlike strconv.AppendQuoteToASCII, non-ASCII
+// characters are escaped as UTF-16 (\uXXXX or surrogate pairs) and invalid UTF-8 bytes are replaced by U+FFFD, so
+// the result is always valid JSON
+func AppendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	appendRune := func(b []byte, r rune) []byte {
+		return append(b, '\\', 'u', hex[r>>12&0xf], hex[r>>8&0xf], hex[r>>4&0xf], hex[r&0xf])
+	}
+
+	b = append(b, '"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b = append(b, '\\', byte(r))
+		case r == '\n':
+			b = append(b, '\\', 'n')
+		case r == '\r':
+			b = append(b, '\\', 'r')
+		case r == '\t':
+			b = append(b, '\\', 't')
+		case r >= 0x20 && r < utf8.RuneSelf:
+			b = append(b, byte(r))
+		case r > 0xffff:
+			r1, r2 := utf16.EncodeRune(r)
+			b = appendRune(appendRune(b, r1), r2)
+		default:
+			// control characters, non-ASCII ones and utf8.RuneError, that invalid bytes are decoded to
+			b = appendRune(b, r)
+		}
+	}
+	return append(b, '"')
+}
+
+// MarshalJSONWithPrecision marshals metric data to JSON, values are rounded to precision decimal places
+func MarshalJSONWithPrecision(results []*MetricData, precision int) []byte {
 	var b []byte
 	b = append(b, '[')
 
@@ -109,23 +183,22 @@ func MarshalJSON(results []*MetricData) []byte {
 		topComma = true
 
 		b = append(b, `{"target":`...)
-		b = strconv.AppendQuoteToASCII(b, r.Name)
+		b = AppendJSONString(b, r.Name)
 		b = append(b, `,"datapoints":[`...)
 
-		var innerComma bool
 		t := r.StartTime
-		for _, v := range r.AggregatedValues() {
-			if innerComma {
+		step := r.AggregatedTimeStep()
+		r.EachAggregatedValue(func(i int, v float64) {
+			if i > 0 {
 				b = append(b, ',')
 			}
-			innerComma = true
 
 			b = append(b, '[')
 
 			if math.IsInf(v, 0) || math.IsNaN(v) {
 				b = append(b, "null"...)
 			} else {
-				b = strconv.AppendFloat(b, v, 'f', -1, 64)
+				b = appendJSONFloat(b, v, precision)
 			}
 
 			b = append(b, ',')
@@ -134,32 +207,311 @@ func MarshalJSON(results []*MetricData) []byte {
 
 			b = append(b, ']')
 
-			t += r.AggregatedTimeStep()
+			t += step
+		})
+
+		b = append(b, `],"tags":`...)
+		b = appendJSONTags(b, r.Tags)
+		b = append(b, '}')
+	}
+
+	b = append(b, ']')
+
+	return b
+}
+
+// appendJSONTags appends tags as JSON object with sorted keys
+func appendJSONTags(b []byte, tags map[string]string) []byte {
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+
+	b = append(b, '{')
+	for i, tag := range names {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = AppendJSONString(b, tag)
+		b = append(b, ':')
+		b = AppendJSONString(b, tags[tag])
+	}
+	return append(b, '}')
+}
+
+// MarshalGraphlot marshals metric data to JSON format that is returned by graphite-web's /graphlot/rawdata
+func MarshalGraphlot(results []*MetricData) []byte {
+	var b []byte
+	b = append(b, '[')
+
+	var topComma bool
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+
+		if topComma {
+			b = append(b, ',')
+		}
+		topComma = true
+
+		b = append(b, `{"name":`...)
+		b = AppendJSONString(b, r.Name)
+		b = append(b, `,"start":`...)
+		b = strconv.AppendInt(b, r.StartTime, 10)
+		b = append(b, `,"end":`...)
+		b = strconv.AppendInt(b, r.StopTime, 10)
+		b = append(b, `,"step":`...)
+		b = strconv.AppendInt(b, r.StepTime, 10)
+		b = append(b, `,"data":[`...)
+
+		for i, v := range r.Values {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if math.IsInf(v, 0) || math.IsNaN(v) {
+				b = append(b, "null"...)
+			} else {
+				b = strconv.AppendFloat(b, v, 'f', -1, 64)
+			}
+		}
+
+		b = append(b, `]}`...)
+	}
+
+	b = append(b, ']')
+
+	return b
+}
+
+// alignedTimestamps returns sorted timestamps of points of all series, taking consolidation into account
+func alignedTimestamps(results []*MetricData) []int64 {
+	seen := make(map[int64]bool)
+	var timestamps []int64
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		step := r.AggregatedTimeStep()
+		for i := 0; i < r.AggregatedLen(); i++ {
+			t := r.StartTime + int64(i)*step
+			if !seen[t] {
+				seen[t] = true
+				timestamps = append(timestamps, t)
+			}
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps
+}
+
+// aggregatedValueAt returns consolidated value of the series at timestamp t or NaN if series has no point there
+func (r *MetricData) aggregatedValueAt(t int64) float64 {
+	step := r.AggregatedTimeStep()
+	values := r.AggregatedValues()
+	if d := t - r.StartTime; d >= 0 && step > 0 && d%step == 0 && d/step < int64(len(values)) {
+		return values[d/step]
+	}
+	return math.NaN()
+}
+
+// appendJSONValue appends v or null if v is absent or infinite
+func appendJSONValue(b []byte, v float64) []byte {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return append(b, "null"...)
+	}
+	return strconv.AppendFloat(b, v, 'f', -1, 64)
+}
+
+// MarshalDygraph marshals metric data to JSON format of dygraph: labels and rows of timestamp in milliseconds followed
+// by values of all series. Series with different steps or start times are aligned, rows contain all timestamps of all
+// series and values are null where series have no points
+func MarshalDygraph(results []*MetricData) []byte {
+	var b []byte
+	b = append(b, `{"labels":["Time"`...)
+	for _, r := range results {
+		if r != nil {
+			b = append(b, ',')
+			b = AppendJSONString(b, r.Name)
+		}
+	}
+
+	b = append(b, `],"data":[`...)
+	for i, t := range alignedTimestamps(results) {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '[')
+		b = strconv.AppendInt(b, t*1000, 10)
+		for _, r := range results {
+			if r != nil {
+				b = append(b, ',')
+				b = appendJSONValue(b, r.aggregatedValueAt(t))
+			}
+		}
+		b = append(b, ']')
+	}
+	b = append(b, "]}"...)
+
+	return b
+}
+
+// MarshalRickshaw marshals metric data to JSON format of rickshaw: list of series with points as {"x":timestamp,"y":value}
+func MarshalRickshaw(results []*MetricData) []byte {
+	var b []byte
+	b = append(b, '[')
+
+	var topComma bool
+	for _, r := range results {
+		if r == nil {
+			continue
 		}
 
-		b = append(b, `],"tags":{`...)
-		notFirstTag := false
-		tags := make([]string, 0, len(r.Tags))
-		for tag := range r.Tags {
-			tags = append(tags, tag)
+		if topComma {
+			b = append(b, ',')
 		}
-		sort.Strings(tags)
-		for _, tag := range tags {
-			v := r.Tags[tag]
-			if notFirstTag {
+		topComma = true
+
+		b = append(b, `{"target":`...)
+		b = AppendJSONString(b, r.Name)
+		b = append(b, `,"datapoints":[`...)
+
+		t := r.StartTime
+		step := r.AggregatedTimeStep()
+		r.EachAggregatedValue(func(i int, v float64) {
+			if i > 0 {
 				b = append(b, ',')
 			}
-			b = strconv.AppendQuoteToASCII(b, tag)
-			b = append(b, ':')
-			b = strconv.AppendQuoteToASCII(b, v)
-			notFirstTag = true
+			b = append(b, `{"x":`...)
+			b = strconv.AppendInt(b, t, 10)
+			b = append(b, `,"y":`...)
+			b = appendJSONValue(b, v)
+			b = append(b, '}')
+			t += step
+		})
+
+		b = append(b, `]}`...)
+	}
+
+	b = append(b, ']')
+
+	return b
+}
+
+// MarshalC3 marshals metric data to JSON format of c3 data: column "x" with timestamps in milliseconds and column for
+// each series. Series are aligned the same way as in MarshalDygraph
+func MarshalC3(results []*MetricData) []byte {
+	timestamps := alignedTimestamps(results)
+
+	var b []byte
+	b = append(b, `{"x":"x","columns":[["x"`...)
+	for _, t := range timestamps {
+		b = append(b, ',')
+		b = strconv.AppendInt(b, t*1000, 10)
+	}
+	b = append(b, ']')
+
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		b = append(b, ",["...)
+		b = AppendJSONString(b, r.Name)
+		for _, t := range timestamps {
+			b = append(b, ',')
+			b = appendJSONValue(b, r.aggregatedValueAt(t))
+		}
+		b = append(b, ']')
+	}
+	b = append(b, "]}"...)
+
+	return b
+}
+
+// MarshalScalars marshals each series reduced to a single value to JSON: [{"target":...,"tags":{...},"value":...}].
+// If window is positive, only points of the last window seconds of series are reduced
+func MarshalScalars(results []*MetricData, reduce func([]float64) float64, window int64) []byte {
+	var b []byte
+	b = append(b, '[')
+
+	var comma bool
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		if comma {
+			b = append(b, ',')
+		}
+		comma = true
+
+		values := r.Values
+		if window > 0 && r.StepTime > 0 {
+			if n := (window + r.StepTime - 1) / r.StepTime; n < int64(len(values)) {
+				values = values[int64(len(values))-n:]
+			}
 		}
 
-		b = append(b, `}}`...)
+		b = append(b, `{"target":`...)
+		b = AppendJSONString(b, r.Name)
+		b = append(b, `,"tags":`...)
+		b = appendJSONTags(b, r.Tags)
+		b = append(b, `,"value":`...)
+		if len(values) == 0 {
+			b = append(b, "null"...)
+		} else {
+			b = appendJSONValue(b, reduce(values))
+		}
+		b = append(b, '}')
 	}
 
 	b = append(b, ']')
+	return b
+}
+
+// MarshalBreaches marshals series whose latest points satisfy breach for at least duration seconds to JSON:
+// [{"target":...,"tags":{...},"since":...,"value":...}], other series are skipped. since is the timestamp of the first
+// point of the breach, value is the latest one. Absent points at the end of series are ignored, as they could be not
+// written yet, other absent points interrupt the breach
+func MarshalBreaches(results []*MetricData, breach func(float64) bool, duration int64) []byte {
+	var b []byte
+	b = append(b, '[')
+
+	var comma bool
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+
+		last := len(r.Values) - 1
+		for last >= 0 && math.IsNaN(r.Values[last]) {
+			last--
+		}
+		first := last + 1
+		for first > 0 && !math.IsNaN(r.Values[first-1]) && breach(r.Values[first-1]) {
+			first--
+		}
+		if first > last || int64(last-first+1)*r.StepTime < duration {
+			continue
+		}
+
+		if comma {
+			b = append(b, ',')
+		}
+		comma = true
+
+		b = append(b, `{"target":`...)
+		b = AppendJSONString(b, r.Name)
+		b = append(b, `,"tags":`...)
+		b = appendJSONTags(b, r.Tags)
+		b = append(b, `,"since":`...)
+		b = strconv.AppendInt(b, r.StartTime+int64(first)*r.StepTime, 10)
+		b = append(b, `,"value":`...)
+		b = appendJSONValue(b, r.Values[last])
+		b = append(b, '}')
+	}
 
+	b = append(b, ']')
 	return b
 }
 
@@ -198,8 +550,38 @@ func MarshalPickle(results []*MetricData) []byte {
 	return buf.Bytes()
 }
 
-// MarshalProtobuf marshals metric data to protobuf
-func MarshalProtobuf(results []*MetricData) ([]byte, error) {
+// MarshalProtobufV2 marshals metric data to carbonapi_v2_pb protobuf
+func MarshalProtobufV2(results []*MetricData) ([]byte, error) {
+	response := pbv2.MultiFetchResponse{}
+	for _, metric := range results {
+		fmv2 := pbv2.FetchResponse{
+			Name:      metric.Name,
+			StartTime: int32(metric.StartTime),
+			StopTime:  int32(metric.StopTime),
+			StepTime:  int32(metric.StepTime),
+			Values:    make([]float64, len(metric.Values)),
+			IsAbsent:  make([]bool, len(metric.Values)),
+		}
+
+		for i, v := range metric.Values {
+			if math.IsNaN(v) {
+				fmv2.IsAbsent[i] = true
+			} else {
+				fmv2.Values[i] = v
+			}
+		}
+		response.Metrics = append(response.Metrics, fmv2)
+	}
+	b, err := response.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// MarshalProtobufV3 marshals metric data to carbonapi_v3_pb protobuf
+func MarshalProtobufV3(results []*MetricData) ([]byte, error) {
 	response := pb.MultiFetchResponse{}
 	for _, metric := range results {
 		response.Metrics = append(response.Metrics, (*metric).FetchResponse)
@@ -247,6 +629,67 @@ func MarshalRaw(results []*MetricData) []byte {
 	return b
 }
 
+// CopyLink returns a copy of the series that shares values with the original one. Tags and applied functions are
+// copied, so they could be changed independently, aggregation cache is reset. Values must be replaced, not modified
+// in place, if original series should stay intact.
+func (r *MetricData) CopyLink() *MetricData {
+	res := *r
+	res.aggregatedValues = nil
+
+	if r.Tags != nil {
+		res.Tags = make(map[string]string, len(r.Tags))
+		for k, v := range r.Tags {
+			res.Tags[k] = v
+		}
+	}
+	if r.AppliedFunctions != nil {
+		res.AppliedFunctions = make([]string, len(r.AppliedFunctions))
+		copy(res.AppliedFunctions, r.AppliedFunctions)
+	}
+
+	return &res
+}
+
+// CopyData returns a deep copy of the series, including values
+func (r *MetricData) CopyData() *MetricData {
+	res := r.CopyLink()
+	if r.Values != nil {
+		res.Values = make([]float64, len(r.Values))
+		copy(res.Values, r.Values)
+	}
+	return res
+}
+
+// Slice returns a copy of the series (see CopyLink) that contains only points with timestamps in [from, until).
+// Start and stop time are aligned to the step of the series. Values are shared with the original series.
+func (r *MetricData) Slice(from, until int64) *MetricData {
+	res := r.CopyLink()
+	if r.StepTime <= 0 {
+		return res
+	}
+
+	start := 0
+	if from > r.StartTime {
+		start = int((from - r.StartTime + r.StepTime - 1) / r.StepTime)
+	}
+	stop := len(r.Values)
+	if until < r.StartTime {
+		stop = 0
+	} else if n := int((until - r.StartTime + r.StepTime - 1) / r.StepTime); n < stop {
+		stop = n
+	}
+	if start > stop {
+		start = stop
+	}
+
+	res.Values = r.Values[start:stop:stop]
+	res.StartTime = r.StartTime + int64(start)*r.StepTime
+	if stop < len(r.Values) {
+		res.StopTime = r.StartTime + int64(stop)*r.StepTime
+	}
+	return res
+}
+
 // SetValuesPerPoint sets value per point coefficient.
 func (r *MetricData) SetValuesPerPoint(v int) {
 	r.ValuesPerPoint = v
@@ -262,64 +705,145 @@ func (r *MetricData) AggregatedTimeStep() int64 {
 	return r.StepTime * int64(r.ValuesPerPoint)
 }
 
-// AggregatedValues aggregates values (with cache)
+// ErrUnknownConsolidationFunc is returned when series can't be consolidated, because its consolidation function
+// is unknown and fallback to average is disabled
+type ErrUnknownConsolidationFunc string
+
+func (e ErrUnknownConsolidationFunc) Error() string {
+	return fmt.Sprintf("unknown consolidation function '%s'", string(e))
+}
+
+// ConsolidationFallback enables consolidation of series with unknown consolidation function by average
+var ConsolidationFallback = true
+
+// UnknownConsolidations counts consolidations of series with unknown consolidation function
+var UnknownConsolidations = new(expvar.Int)
+
+// RetainAggregatedValues enables caching of consolidated values in the series until values per point are changed or
+// ResetAggregatedValues is called. If it's disabled, marshalers consolidate values on the fly and AggregatedValues
+// computes them on every call, that saves memory of the copy of values at the cost of CPU for formats that read them
+// several times (e.x. png)
+var RetainAggregatedValues = true
+
+// AggregatedValues aggregates values (with cache, see RetainAggregatedValues). Series that can't be consolidated are
+// absent. Returned slice must not be modified
 func (r *MetricData) AggregatedValues() []float64 {
-	if r.aggregatedValues == nil {
-		r.AggregateValues()
+	if r.aggregatedValues != nil {
+		return r.aggregatedValues
+	}
+	values, err := r.aggregate()
+	if err != nil {
+		values = make([]float64, r.AggregatedLen())
+		for i := range values {
+			values[i] = math.NaN()
+		}
+	}
+	if RetainAggregatedValues {
+		r.aggregatedValues = values
 	}
-	return r.aggregatedValues
+	return values
 }
 
-// AggregateValues aggregates values
-func (r *MetricData) AggregateValues() {
-	if r.ValuesPerPoint == 1 || r.ValuesPerPoint == 0 {
-		r.aggregatedValues = make([]float64, len(r.Values))
-		copy(r.aggregatedValues, r.Values)
+// EachAggregatedValue calls f for every consolidated value. Values are consolidated on the fly, if they aren't
+// cached yet, so intermediate slice isn't allocated
+func (r *MetricData) EachAggregatedValue(f func(i int, v float64)) {
+	if r.aggregatedValues != nil {
+		for i, v := range r.aggregatedValues {
+			f(i, v)
+		}
 		return
 	}
+	r.consolidate(f)
+}
 
-	if r.AggregateFunction == nil {
-		var ok bool
-		if r.AggregateFunction, ok = consolidations.ConsolidationToFunc[strings.ToLower(r.ConsolidationFunc)]; !ok {
-			fmt.Printf("\nconsolidateFunc = %+v\n\nstack:\n%v\n\n", r.ConsolidationFunc, string(debug.Stack()))
+// consolidate calls f for every value consolidated from current values, ignoring cache
+func (r *MetricData) consolidate(f func(i int, v float64)) {
+	if r.ValuesPerPoint == 1 || r.ValuesPerPoint == 0 {
+		for i, v := range r.Values {
+			f(i, v)
 		}
+		return
 	}
 
-	n := len(r.Values)/r.ValuesPerPoint + 1
-	aggV := make([]float64, 0, n)
-
+	aggregate, err := r.aggregateFunction()
 	v := r.Values
-
-	for len(v) >= r.ValuesPerPoint {
-		val := r.AggregateFunction(v[:r.ValuesPerPoint])
-		aggV = append(aggV, val)
-		v = v[r.ValuesPerPoint:]
+	for i := 0; len(v) > 0; i++ {
+		n := r.ValuesPerPoint
+		if n > len(v) {
+			n = len(v)
+		}
+		if err != nil {
+			f(i, math.NaN())
+		} else {
+			f(i, aggregate(v[:n]))
+		}
+		v = v[n:]
 	}
+}
 
-	if len(v) > 0 {
-		val := r.AggregateFunction(v)
-		aggV = append(aggV, val)
+// AggregatedLen returns amount of consolidated values
+func (r *MetricData) AggregatedLen() int {
+	if r.ValuesPerPoint == 1 || r.ValuesPerPoint == 0 {
+		return len(r.Values)
 	}
+	return (len(r.Values) + r.ValuesPerPoint - 1) / r.ValuesPerPoint
+}
 
-	r.aggregatedValues = aggV
+// ResetAggregatedValues drops cached consolidated values, e.x. when the series is retained after the response is
+// marshaled. Values are consolidated again on demand
+func (r *MetricData) ResetAggregatedValues() {
+	r.aggregatedValues = nil
 }
 
-// MakeMetricData creates new metrics data with given metric timeseries
-func MakeMetricData(name string, values []float64, step, start int64) *MetricData {
-	return makeMetricDataWithTags(name, values, step, start, tags.ExtractTags(name))
+// AggregateValues aggregates values. Series without consolidation function are consolidated by average, like in
+// graphite. Aggregated values are cached regardless of RetainAggregatedValues
+func (r *MetricData) AggregateValues() error {
+	values, err := r.aggregate()
+	if err != nil {
+		return err
+	}
+	r.aggregatedValues = values
+	return nil
+}
+
+// aggregateFunction returns function values are consolidated by, see AggregateValues
+func (r *MetricData) aggregateFunction() (func([]float64) float64, error) {
+	if r.AggregateFunction == nil {
+		f, ok := consolidations.ConsolidationFunc(r.ConsolidationFunc)
+		if !ok {
+			if r.ConsolidationFunc != "" {
+				UnknownConsolidations.Add(1)
+				if !ConsolidationFallback {
+					return nil, ErrUnknownConsolidationFunc(r.ConsolidationFunc)
+				}
+			}
+			f = consolidations.AggMean
+		}
+		r.AggregateFunction = f
+	}
+	return r.AggregateFunction, nil
 }
 
-// MakeMetricDataWithTags creates new metrics data with given metric Time Series (with tags)
-func makeMetricDataWithTags(name string, values []float64, step, start int64, tags map[string]string) *MetricData {
-	stop := start + int64(len(values))*step
+// aggregate returns new slice of consolidated values
+func (r *MetricData) aggregate() ([]float64, error) {
+	if r.ValuesPerPoint == 1 || r.ValuesPerPoint == 0 {
+		values := make([]float64, len(r.Values))
+		copy(values, r.Values)
+		return values, nil
+	}
 
-	return &MetricData{FetchResponse: pb.FetchResponse{
-		Name:      name,
-		Values:    values,
-		StartTime: start,
-		StepTime:  step,
-		StopTime:  stop,
-	},
-		Tags: tags,
+	if _, err := r.aggregateFunction(); err != nil {
+		return nil, err
 	}
+	values := make([]float64, 0, r.AggregatedLen())
+	r.consolidate(func(i int, v float64) {
+		values = append(values, v)
+	})
+	return values, nil
+}
+
+// MakeMetricData creates new metrics data with given metric timeseries. Tags are extracted from the name.
+// Use NewMetricDataBuilder to set other parameters or validate them
+func MakeMetricData(name string, values []float64, step, start int64) *MetricData {
+	return NewMetricDataBuilder(name, values).WithStep(step).WithStartTime(start).build()
 }
@@ -0,0 +1,100 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// UnitPrefix is a suffix that is used for values that are greater than or equal to Size
+type UnitPrefix struct {
+	Prefix string  `mapstructure:"prefix"`
+	Size   float64 `mapstructure:"size"`
+}
+
+// Built-in unit systems
+const (
+	UnitSystemBinary = "binary"
+	UnitSystemSI     = "si"
+	UnitSystemNone   = "none"
+)
+
+// UnitSystems contains known unit systems, prefixes are sorted by size in descending order
+var UnitSystems = map[string][]UnitPrefix{
+	UnitSystemBinary: {
+		{"Pi", 1125899906842624}, // 1024^5
+		{"Ti", 1099511627776},    // 1024^4
+		{"Gi", 1073741824},       // 1024^3
+		{"Mi", 1048576},          // 1024^2
+		{"Ki", 1024},
+	},
+	UnitSystemSI: {
+		{"P", 1000000000000000}, // 1000^5
+		{"T", 1000000000000},    // 1000^4
+		{"G", 1000000000},       // 1000^3
+		{"M", 1000000},          // 1000^2
+		{"K", 1000},
+	},
+	UnitSystemNone: {},
+}
+
+const unitsEpsilon = 0.00000000001
+
+// RegisterUnitSystem adds custom unit system or replaces existing one. Built-in systems can't be replaced.
+func RegisterUnitSystem(name string, prefixes []UnitPrefix) error {
+	switch name {
+	case "":
+		return fmt.Errorf("empty unit system name")
+	case UnitSystemBinary, UnitSystemSI, UnitSystemNone:
+		return fmt.Errorf("unit system '%s' is built-in and can't be redefined", name)
+	}
+
+	sorted := make([]UnitPrefix, len(prefixes))
+	copy(sorted, prefixes)
+	for _, p := range sorted {
+		if p.Size <= 1 || math.IsInf(p.Size, 0) || math.IsNaN(p.Size) {
+			return fmt.Errorf("unit system '%s': size of prefix '%s' must be greater than 1, got %v", name, p.Prefix, p.Size)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Size > sorted[j].Size
+	})
+
+	UnitSystems[name] = sorted
+	return nil
+}
+
+// FormatUnits divides v by the largest prefix of the unit system that is not greater than both v and step.
+// If step is NaN, only v is taken into account. Unknown systems have no prefixes.
+func FormatUnits(v, step float64, system string) (float64, string) {
+	var condition func(float64) bool
+
+	if math.IsNaN(step) {
+		condition = func(size float64) bool { return math.Abs(v) >= size }
+	} else {
+		condition = func(size float64) bool { return math.Abs(v) >= size && step >= size }
+	}
+
+	for _, p := range UnitSystems[system] {
+		if condition(p.Size) {
+			v2 := v / p.Size
+			if (v2-math.Floor(v2)) < unitsEpsilon && v > 1 {
+				v2 = math.Floor(v2)
+			}
+			return v2, p.Prefix
+		}
+	}
+
+	if (v-math.Floor(v)) < unitsEpsilon && v > 1 {
+		v = math.Floor(v)
+	}
+	return v, ""
+}
+
+// AppendHumanized appends v with two decimal places followed by prefix of the unit system, e.x. 1.50Ki
+func AppendHumanized(b []byte, v float64, system string) []byte {
+	v, prefix := FormatUnits(v, math.NaN(), system)
+	b = strconv.AppendFloat(b, v, 'f', 2, 64)
+	return append(b, prefix...)
+}
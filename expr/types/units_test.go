@@ -0,0 +1,68 @@
+package types
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAppendHumanized(t *testing.T) {
+	tests := []struct {
+		v      float64
+		system string
+		want   string
+	}{
+		{1536, UnitSystemBinary, "1.50Ki"},
+		{1536, UnitSystemSI, "1.54K"},
+		{1536, UnitSystemNone, "1536.00"},
+		{-2500000, UnitSystemSI, "-2.50M"},
+		{0.5, UnitSystemSI, "0.50"},
+		{1536, "unknown", "1536.00"},
+	}
+
+	for _, tt := range tests {
+		got := string(AppendHumanized(nil, tt.v, tt.system))
+		if got != tt.want {
+			t.Errorf("AppendHumanized(%v, %q) = %q, want %q", tt.v, tt.system, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterUnitSystem(t *testing.T) {
+	defer delete(UnitSystems, "time")
+
+	err := RegisterUnitSystem("time", []UnitPrefix{{"m", 60}, {"d", 86400}, {"h", 3600}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(AppendHumanized(nil, 7200, "time")); got != "2.00h" {
+		t.Errorf("got %q, want %q", got, "2.00h")
+	}
+	if v, prefix := FormatUnits(7200, 60, "time"); v != 120 || prefix != "m" {
+		t.Errorf("FormatUnits with step 60 = %v %q, want 120 \"m\"", v, prefix)
+	}
+
+	for _, name := range []string{"", UnitSystemSI, UnitSystemBinary, UnitSystemNone} {
+		if err := RegisterUnitSystem(name, nil); err == nil {
+			t.Errorf("expected error for unit system %q", name)
+		}
+	}
+	if err := RegisterUnitSystem("bad", []UnitPrefix{{"x", 1}}); err == nil {
+		t.Error("expected error for prefix with size 1")
+	}
+}
+
+func TestMarshalCSVHumanized(t *testing.T) {
+	data := MakeMetricData("metric", []float64{2048, math.NaN()}, 60, 0)
+
+	got := string(MarshalCSVHumanized([]*MetricData{data}, UnitSystemBinary))
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], ",2.00Ki") || !strings.HasSuffix(lines[1], ",") {
+		t.Errorf("unexpected CSV: %q", got)
+	}
+
+	got = string(MarshalCSV([]*MetricData{data}))
+	if !strings.Contains(got, ",2048\n") {
+		t.Errorf("unexpected CSV: %q", got)
+	}
+}
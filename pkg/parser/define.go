@@ -1,23 +1,66 @@
 package parser
 
 import (
+	"fmt"
 	"strings"
+	"sync/atomic"
 	"text/template"
 )
 
+// maxMacroDepth limits nesting of macro expansions
+const maxMacroDepth = 32
+
 type defineStruct struct {
-	tpl *template.Template
+	tpl    *template.Template
+	macros map[string]*macro
+}
+
+func newDefineStruct() *defineStruct {
+	return &defineStruct{tpl: template.New("define"), macros: make(map[string]*macro)}
+}
+
+// defineMap holds the current *defineStruct, it's replaced as a whole by SetDefines
+var defineMap atomic.Value
+
+func init() {
+	defineMap.Store(newDefineStruct())
 }
 
-var defineMap = &defineStruct{tpl: template.New("define")}
+func getDefineMap() *defineStruct {
+	return defineMap.Load().(*defineStruct)
+}
 
-// Define new template
+// Define new template. It must not be called concurrently with parsing, use SetDefines to change defines at runtime
 func Define(name string, tmpl string) error {
-	return defineMap.define(name, tmpl)
+	return getDefineMap().define(name, tmpl)
 }
 
 func defineCleanUp() {
-	defineMap = &defineStruct{tpl: template.New("define")}
+	defineMap.Store(newDefineStruct())
+}
+
+// Defines is a set of defines and macros, that replaces the current one by SetDefines, e.x. on config reload
+type Defines struct {
+	d *defineStruct
+}
+
+func NewDefines() *Defines {
+	return &Defines{d: newDefineStruct()}
+}
+
+// Define adds template to the set, see Define
+func (d *Defines) Define(name string, tmpl string) error {
+	return d.d.define(name, tmpl)
+}
+
+// DefineMacro adds macro to the set, see DefineMacro
+func (d *Defines) DefineMacro(definition string) error {
+	return d.d.defineMacro(definition)
+}
+
+// SetDefines replaces all defines and macros. Expressions that are being parsed are expanded by the previous ones
+func SetDefines(d *Defines) {
+	defineMap.Store(d.d)
 }
 
 func (d *defineStruct) define(name string, tmpl string) error {
@@ -27,13 +70,28 @@ func (d *defineStruct) define(name string, tmpl string) error {
 }
 
 func (d *defineStruct) expandExpr(exp *expr) (*expr, error) {
+	return d.expandExprDepth(exp, 0)
+}
+
+// expandExprDepth expands defines and macros, depth is amount of macros expanded to get the expression
+func (d *defineStruct) expandExprDepth(exp *expr, depth int) (*expr, error) {
 	if exp == nil {
 		return exp, nil
 	}
 
 	var err error
 
-	if exp.etype == EtName || exp.etype == EtFunc {
+	if m, ok := d.macros[exp.target]; ok && exp.etype == EtFunc {
+		if depth >= maxMacroDepth {
+			return exp, fmt.Errorf("macro %s: expansion is too deep, macros could be recursive", m.name)
+		}
+		exp, err = m.expand(exp)
+		if err != nil {
+			return exp, err
+		}
+		// expression could be a call of another macro
+		return d.expandExprDepth(exp, depth+1)
+	} else if exp.etype == EtName || exp.etype == EtFunc {
 		t := d.tpl.Lookup(exp.target)
 		if t != nil {
 			var b strings.Builder
@@ -63,14 +121,14 @@ func (d *defineStruct) expandExpr(exp *expr) (*expr, error) {
 	}
 
 	for i := 0; i < len(exp.args); i++ {
-		exp.args[i], err = d.expandExpr(exp.args[i])
+		exp.args[i], err = d.expandExprDepth(exp.args[i], depth)
 		if err != nil {
 			return exp, err
 		}
 	}
 
 	for k, v := range exp.namedArgs {
-		exp.namedArgs[k], err = d.expandExpr(v)
+		exp.namedArgs[k], err = d.expandExprDepth(v, depth)
 		if err != nil {
 			return exp, err
 		}
@@ -119,3 +119,76 @@ func TestDefineExpand(t *testing.T) {
 		assert.Equal(tt.e, e, tt.s)
 	}
 }
+
+func TestDefineMacro(t *testing.T) {
+	assert := assert.New(t)
+
+	defer defineCleanUp()
+
+	assert.NoError(DefineMacro("errRate(s) = divideSeries(sumSeries(s.errors), sumSeries(s.total))"))
+	assert.NoError(DefineMacro("perHost(s, node) = aliasByNode(perSecond(s), node)"))
+	assert.NoError(DefineMacro("hostErrRate(host) = errRate(servers.host.http)"))
+	assert.NoError(DefineMacro("sorted(s) = sortByName(s, natural=true)"))
+
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"errRate(servers.*.http)", "divideSeries(sumSeries(servers.*.http.errors),sumSeries(servers.*.http.total))"},
+		{"perHost(foo.*.cpu, 1)", "aliasByNode(perSecond(foo.*.cpu),1)"},
+		{"perHost(sumSeries(foo.*), node=0)", "aliasByNode(perSecond(sumSeries(foo.*)),0)"},
+		{"hostErrRate(web1)", "divideSeries(sumSeries(servers.web1.http.errors),sumSeries(servers.web1.http.total))"},
+		{"sorted(foo.*)", "sortByName(foo.*,natural=true)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			e, _, err := ParseExpr(tt.s)
+			if assert.NoError(err) {
+				want, _, err := ParseExpr(tt.want)
+				assert.NoError(err)
+				assert.Equal(want.ToString(), e.ToString())
+				assert.Equal(want.Metrics(), e.Metrics())
+			}
+		})
+	}
+
+	// macros in arguments are expanded too, but the raw arguments are kept as is
+	e, _, err := ParseExpr("scale(sorted(foo.*), 2)")
+	if assert.NoError(err) {
+		assert.Equal("sortByName(foo.*,natural=true)", e.Args()[0].ToString())
+	}
+
+	assert.NoError(DefineMacro("ping(s) = pong(s)"))
+	assert.NoError(DefineMacro("pong(s) = sumSeries(ping(s))"))
+	for _, s := range []string{"errRate(foo, bar)", "errRate(sumSeries(foo))", "ping(foo)"} {
+		_, _, err := ParseExpr(s)
+		assert.Error(err, s)
+	}
+
+	for _, d := range []string{"errRate", "1rate(s) = s", "rate(s, s) = s", "rate(s) s", "rate(s) = rate(s)", "rate(s) = sum(s"} {
+		assert.Error(DefineMacro(d), d)
+	}
+}
+
+func TestSetDefines(t *testing.T) {
+	defer defineCleanUp()
+
+	assert.NoError(t, Define("old", "metric.old"))
+
+	d := NewDefines()
+	assert.NoError(t, d.Define("new", "metric.new"))
+	assert.NoError(t, d.DefineMacro("errRate(s) = divideSeries(s.errors, s.total)"))
+	assert.Error(t, d.DefineMacro("broken("))
+	SetDefines(d)
+
+	for target, want := range map[string]string{
+		"old":              "old",
+		"new":              "metric.new",
+		"errRate(foo.bar)": "divideSeries(foo.bar.errors,foo.bar.total)",
+	} {
+		e, _, err := ParseExpr(target)
+		assert.NoError(t, err)
+		assert.Equal(t, want, e.ToString(), target)
+	}
+}
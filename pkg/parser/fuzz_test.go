@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"testing"
+)
+
+// FuzzParseExpr parses target. Parsed expression is printed and must be parsed again, metric requests are extracted
+// from it
+func FuzzParseExpr(f *testing.F) {
+	for _, s := range []string{
+		"metric",
+		"sum(a ",
+		"sum(a, b  ",
+		"sum(a,",
+		`func(metric, key="value", 1.5e3, true)`,
+		"seriesByTag('name=foo', 'a!=~b')",
+		`applyByNode(servers.*.disk.bytes_free, 1, "divideSeries(%.disk.bytes_free,sumSeries(%.disk.bytes_*))")`,
+		"foo.{bar,baz}.qux[0-9]",
+		"-1.5",
+	} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		e, rem, err := ParseExpr(s)
+		if err != nil || rem != "" {
+			return
+		}
+		e.Metrics()
+		printed := e.ToString()
+		if _, rem, err := ParseExpr(printed); err != nil || rem != "" {
+			t.Fatalf("printed expression %q of %q can't be parsed: %v, rest '%s'", printed, s, err, rem)
+		}
+	})
+}
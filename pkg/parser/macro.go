@@ -0,0 +1,180 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// macro is a function defined by expression with named parameters, e.x.
+// errRate(s) = divideSeries(sumSeries(s.errors), sumSeries(s.total))
+type macro struct {
+	name   string
+	params []string
+	body   *expr
+}
+
+// DefineMacro defines a macro by its definition in form "name(param1, param2) = expression". Calls of the macro are
+// replaced by the expression at parse time. Parameters are replaced by arguments of the call: a parameter could be
+// used as an argument of functions or as a node of metric paths, e.x. s.errors is expanded to foo.bar.errors for
+// s=foo.bar, in that case the argument must be a metric path too
+func DefineMacro(definition string) error {
+	return getDefineMap().defineMacro(definition)
+}
+
+func (d *defineStruct) defineMacro(definition string) error {
+	m, err := parseMacro(definition)
+	if err != nil {
+		return err
+	}
+	d.macros[m.name] = m
+	return nil
+}
+
+func parseMacro(definition string) (*macro, error) {
+	open := strings.IndexByte(definition, '(')
+	closing := strings.IndexByte(definition, ')')
+	if open < 0 || closing < open {
+		return nil, fmt.Errorf("macro %q: expected name(params) = expression", definition)
+	}
+	m := &macro{name: strings.TrimSpace(definition[:open])}
+	if !isMacroIdentifier(m.name) {
+		return nil, fmt.Errorf("macro %q: invalid name %q", definition, m.name)
+	}
+
+	if params := strings.TrimSpace(definition[open+1 : closing]); params != "" {
+		seen := make(map[string]bool)
+		for _, p := range strings.Split(params, ",") {
+			p = strings.TrimSpace(p)
+			if !isMacroIdentifier(p) || seen[p] {
+				return nil, fmt.Errorf("macro %s: invalid or duplicate parameter %q", m.name, p)
+			}
+			seen[p] = true
+			m.params = append(m.params, p)
+		}
+	}
+
+	body := strings.TrimSpace(definition[closing+1:])
+	if !strings.HasPrefix(body, "=") {
+		return nil, fmt.Errorf("macro %s: expected '=' after parameters", m.name)
+	}
+	body = strings.TrimSpace(body[1:])
+	exp, rest, err := parseExprInner(body)
+	if err != nil {
+		return nil, fmt.Errorf("macro %s: %v", m.name, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("macro %s: unexpected %q after expression", m.name, rest)
+	}
+	m.body = exp.(*expr)
+	if m.calls(m.body, m.name) {
+		return nil, fmt.Errorf("macro %s: recursive macros aren't supported", m.name)
+	}
+	return m, nil
+}
+
+// isMacroIdentifier checks if s could be a name of macro or parameter: letters, digits and '_', not starting with digit
+func isMacroIdentifier(s string) bool {
+	if s == "" || isDigit(s[0]) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// calls checks if expression calls the function
+func (m *macro) calls(e *expr, name string) bool {
+	if e.etype == EtFunc && e.target == name {
+		return true
+	}
+	for _, a := range e.args {
+		if m.calls(a, name) {
+			return true
+		}
+	}
+	for _, a := range e.namedArgs {
+		if m.calls(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand returns expression of the macro called by exp
+func (m *macro) expand(exp *expr) (*expr, error) {
+	if len(exp.args)+len(exp.namedArgs) != len(m.params) {
+		return exp, fmt.Errorf("macro %s expects %d arguments, got %d", m.name, len(m.params), len(exp.args)+len(exp.namedArgs))
+	}
+	args := make(map[string]*expr, len(m.params))
+	for i, p := range m.params {
+		if i < len(exp.args) {
+			args[p] = exp.args[i]
+			continue
+		}
+		a, ok := exp.namedArgs[p]
+		if !ok {
+			return exp, fmt.Errorf("macro %s: missing argument %s", m.name, p)
+		}
+		args[p] = a
+	}
+
+	s, err := m.render(m.body, args)
+	if err != nil {
+		return exp, err
+	}
+	newExp, _, err := parseExprInner(s)
+	if err != nil {
+		return exp, err
+	}
+	return newExp.(*expr), nil
+}
+
+// render returns the expression as string with parameters replaced by arguments
+func (m *macro) render(e *expr, args map[string]*expr) (string, error) {
+	switch e.etype {
+	case EtName:
+		if a, ok := args[e.target]; ok {
+			return a.ToString(), nil
+		}
+		nodes := strings.Split(e.target, ".")
+		for i, node := range nodes {
+			a, ok := args[node]
+			if !ok {
+				continue
+			}
+			if a.etype != EtName {
+				return "", fmt.Errorf("macro %s: argument %s must be a metric path to be used in %s", m.name, node, e.target)
+			}
+			nodes[i] = a.target
+		}
+		return strings.Join(nodes, "."), nil
+	case EtFunc:
+		parts := make([]string, 0, len(e.args)+len(e.namedArgs))
+		for _, a := range e.args {
+			s, err := m.render(a, args)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		names := make([]string, 0, len(e.namedArgs))
+		for k := range e.namedArgs {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			s, err := m.render(e.namedArgs[k], args)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, k+"="+s)
+		}
+		return e.target + "(" + strings.Join(parts, ",") + ")", nil
+	}
+	return e.ToString(), nil
+}
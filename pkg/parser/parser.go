@@ -57,7 +57,7 @@ func (e *expr) ToString() string {
 		s = strings.Replace(s, `'`, `\'`, -1)
 		return "'" + s + "'"
 	case EtBool:
-		return fmt.Sprint(e.val)
+		return e.valStr
 	}
 
 	return e.target
@@ -463,7 +463,7 @@ func ParseExpr(e string) (Expr, string, error) {
 	if err != nil {
 		return exp, e, err
 	}
-	exp, err = defineMap.expandExpr(exp.(*expr))
+	exp, err = getDefineMap().expandExpr(exp.(*expr))
 	return exp, e, err
 }
 
@@ -599,6 +599,10 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 			e = e[1:]
 		}
 
+		if e == "" {
+			return "", nil, nil, "", ErrMissingComma
+		}
+
 		if e[0] == ')' {
 			return argStringBuffer.String(), posArgs, namedArgs, e[1:], nil
 		}
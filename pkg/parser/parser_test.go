@@ -371,3 +371,18 @@ func TestParseExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []string{
+		"sum(a ",
+		"sum(a, b  ",
+		"sum(a,",
+	}
+
+	for _, s := range tests {
+		t.Run(s, func(t *testing.T) {
+			_, _, err := ParseExpr(s)
+			assert.Error(t, err)
+		})
+	}
+}
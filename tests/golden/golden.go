@@ -0,0 +1,316 @@
+// Package golden runs expr functions against test vectors stored as JSON fixtures, e.x. ones converted from
+// graphite-web's function tests, and reports parity gaps of implementations.
+//
+// A fixture file is a JSON array of cases:
+//
+//	[
+//	  {
+//	    "name": "scale",
+//	    "target": "scale(collectd.test-db1.load.value,2)",
+//	    "from": 0, "until": 3,
+//	    "inputs": {
+//	      "collectd.test-db1.load.value": [
+//	        {"name": "collectd.test-db1.load.value", "start": 0, "step": 1, "values": [1, null, 3]}
+//	      ]
+//	    },
+//	    "expected": [
+//	      {"name": "scale(collectd.test-db1.load.value,2)", "start": 0, "step": 1, "values": [2, null, 6]}
+//	    ]
+//	  }
+//	]
+//
+// Inputs are keyed by metric paths of the target, null values are absent points. Cases that are known to differ
+// from graphite-web have "gap" set to the description of the difference, they are skipped and reported.
+//
+// Functions are evaluated by metadata.GetEvaluator(), so the same fixtures can be used by tests of a single function
+// package (with the evaluator set up as in other function tests) and by tests of all functions.
+package golden
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// DefaultTolerance is used to compare values if case doesn't set its own one
+const DefaultTolerance = 1e-9
+
+// Values are points of series, null in JSON is NaN
+type Values []float64
+
+// UnmarshalJSON decodes array of numbers and nulls
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var points []*float64
+	if err := json.Unmarshal(data, &points); err != nil {
+		return err
+	}
+	*v = make(Values, len(points))
+	for i, p := range points {
+		if p == nil {
+			(*v)[i] = math.NaN()
+		} else {
+			(*v)[i] = *p
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes NaNs as nulls
+func (v Values) MarshalJSON() ([]byte, error) {
+	points := make([]*float64, len(v))
+	for i := range v {
+		if !math.IsNaN(v[i]) {
+			points[i] = &v[i]
+		}
+	}
+	return json.Marshal(points)
+}
+
+// Series is an input or expected series
+type Series struct {
+	Name   string `json:"name"`
+	Start  int64  `json:"start"`
+	Step   int64  `json:"step"`
+	Values Values `json:"values"`
+	// Tags are compared only if they are set in expected series
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// MetricData converts series to the form functions work with
+func (s *Series) MetricData() *types.MetricData {
+	m := types.MakeMetricData(s.Name, append([]float64(nil), s.Values...), s.Step, s.Start)
+	if s.Tags != nil {
+		m.Tags = make(map[string]string, len(s.Tags))
+		for k, v := range s.Tags {
+			m.Tags[k] = v
+		}
+	}
+	return m
+}
+
+// Case is a test vector of a target
+type Case struct {
+	Name     string              `json:"name"`
+	Target   string              `json:"target"`
+	From     int64               `json:"from"`
+	Until    int64               `json:"until"`
+	Inputs   map[string][]Series `json:"inputs"`
+	Expected []Series            `json:"expected"`
+	// Error is set if evaluation should fail
+	Error bool `json:"error,omitempty"`
+	// Tolerance is max relative difference of values, DefaultTolerance if it's 0
+	Tolerance float64 `json:"tolerance,omitempty"`
+	// Gap describes known difference from graphite-web, case is skipped if it's set
+	Gap string `json:"gap,omitempty"`
+
+	// File is the fixture the case is loaded from
+	File string `json:"-"`
+}
+
+// Gap is a discrepancy between expected and actual results of a case
+type Gap struct {
+	File   string
+	Case   string
+	Target string
+	Reason string
+	// Known is set if the case describes the gap itself
+	Known bool
+}
+
+func (g Gap) String() string {
+	return fmt.Sprintf("%s: %s: %s: %s", g.File, g.Case, g.Target, g.Reason)
+}
+
+// Load reads cases from the fixture file or from all *.json files of the directory, sorted by name
+func Load(path string) ([]Case, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if st.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	var cases []Case
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var fileCases []Case
+		if err := json.Unmarshal(data, &fileCases); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		for i := range fileCases {
+			fileCases[i].File = filepath.Base(file)
+			if fileCases[i].Name == "" {
+				fileCases[i].Name = fileCases[i].Target
+			}
+		}
+		cases = append(cases, fileCases...)
+	}
+	return cases, nil
+}
+
+// Check evaluates the case and returns description of the first discrepancy, empty string if results are expected.
+// Known gap of the case isn't taken into account
+func Check(c *Case) string {
+	exp, rem, err := parser.ParseExpr(c.Target)
+	if err != nil {
+		return fmt.Sprintf("failed to parse target: %v", err)
+	}
+	if rem != "" {
+		return fmt.Sprintf("failed to parse target: unexpected '%s'", rem)
+	}
+
+	values := make(map[parser.MetricRequest][]*types.MetricData)
+	for _, m := range exp.Metrics() {
+		inputs := c.Inputs[m.Metric]
+		series := make([]*types.MetricData, 0, len(inputs))
+		for i := range inputs {
+			series = append(series, inputs[i].MetricData())
+		}
+		m.From += c.From
+		m.Until += c.Until
+		values[m] = series
+	}
+
+	results, err := evalExpr(exp, c.From, c.Until, values)
+	switch {
+	case c.Error && err == nil:
+		return "expected error, got none"
+	case c.Error:
+		return ""
+	case err != nil:
+		return fmt.Sprintf("failed to eval: %v", err)
+	}
+
+	tolerance := c.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	return compare(results, c.Expected, tolerance)
+}
+
+// evalExpr evaluates the expression, recovering from panics of functions
+func evalExpr(exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (results []*types.MetricData, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return metadata.GetEvaluator().EvalExpr(exp, from, until, values)
+}
+
+func compare(results []*types.MetricData, expected []Series, tolerance float64) string {
+	if len(results) != len(expected) {
+		names := make([]string, len(results))
+		for i, r := range results {
+			names[i] = r.Name
+		}
+		return fmt.Sprintf("got %d series %q, want %d", len(results), names, len(expected))
+	}
+	for i, r := range results {
+		want := &expected[i]
+		switch {
+		case r.Name != want.Name:
+			return fmt.Sprintf("series %d: got name '%s', want '%s'", i, r.Name, want.Name)
+		case r.StepTime != want.Step:
+			return fmt.Sprintf("series '%s': got step %d, want %d", r.Name, r.StepTime, want.Step)
+		case r.StartTime != want.Start:
+			return fmt.Sprintf("series '%s': got start %d, want %d", r.Name, r.StartTime, want.Start)
+		case len(r.Values) != len(want.Values):
+			return fmt.Sprintf("series '%s': got %d points %v, want %d %v", r.Name, len(r.Values), r.Values, len(want.Values), []float64(want.Values))
+		}
+		for j, v := range r.Values {
+			if !equal(v, want.Values[j], tolerance) {
+				return fmt.Sprintf("series '%s': got %v, want %v", r.Name, r.Values, []float64(want.Values))
+			}
+		}
+		if want.Tags != nil {
+			for k, v := range want.Tags {
+				if r.Tags[k] != v {
+					return fmt.Sprintf("series '%s': got tags %v, want %v", r.Name, r.Tags, want.Tags)
+				}
+			}
+			if len(r.Tags) != len(want.Tags) {
+				return fmt.Sprintf("series '%s': got tags %v, want %v", r.Name, r.Tags, want.Tags)
+			}
+		}
+	}
+	return ""
+}
+
+// equal compares values relatively to the greater one, or absolutely if both are less than 1
+func equal(a, b, tolerance float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	if a == b {
+		return true
+	}
+	scale := math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+	return math.Abs(a-b) <= tolerance*scale
+}
+
+// Gaps checks all cases and returns discrepancies, including known ones
+func Gaps(cases []Case) []Gap {
+	var gaps []Gap
+	for i := range cases {
+		c := &cases[i]
+		if c.Gap != "" {
+			gaps = append(gaps, Gap{File: c.File, Case: c.Name, Target: c.Target, Reason: c.Gap, Known: true})
+			continue
+		}
+		if reason := Check(c); reason != "" {
+			gaps = append(gaps, Gap{File: c.File, Case: c.Name, Target: c.Target, Reason: reason})
+		}
+	}
+	return gaps
+}
+
+// Run checks every case in a subtest. Cases with known gaps are skipped, summary of parity is logged
+func Run(t *testing.T, cases []Case) {
+	var known, failed int
+	for i := range cases {
+		c := &cases[i]
+		ok := t.Run(c.File+"/"+c.Name, func(t *testing.T) {
+			if c.Gap != "" {
+				t.Skipf("known gap: %s", c.Gap)
+			}
+			if reason := Check(c); reason != "" {
+				t.Errorf("%s: %s", c.Target, reason)
+			}
+		})
+		switch {
+		case c.Gap != "":
+			known++
+		case !ok:
+			failed++
+		}
+	}
+	t.Logf("parity: %d of %d cases match, %d known gaps, %d failed", len(cases)-known-failed, len(cases), known, failed)
+}
+
+// RunFixtures loads cases from the path (see Load) and runs them
+func RunFixtures(t *testing.T, path string) {
+	cases, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+	Run(t, cases)
+}
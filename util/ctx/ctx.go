@@ -14,6 +14,7 @@ const (
 	uuidKey key = iota
 	headersToPassKey
 	headersToLogKey
+	backendGroupKey
 )
 
 func ifaceToString(v interface{}) string {
@@ -75,6 +76,15 @@ func SetUUID(ctx context.Context, v string) context.Context {
 	return context.WithValue(ctx, uuidKey, v)
 }
 
+// GetBackendGroup returns name of the backend group that was selected for the request, empty string means all groups
+func GetBackendGroup(ctx context.Context) string {
+	return getCtxString(ctx, backendGroupKey)
+}
+
+func SetBackendGroup(ctx context.Context, v string) context.Context {
+	return context.WithValue(ctx, backendGroupKey, v)
+}
+
 func ParseCtx(h http.HandlerFunc, uuidKey string) http.HandlerFunc {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		uuid := req.Header.Get(uuidKey)
@@ -0,0 +1,119 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// ClientConfig describes TLS settings that are used to connect to servers
+type ClientConfig struct {
+	CAFiles            []string `mapstructure:"caFiles"`
+	CertFile           string   `mapstructure:"certFile"`
+	KeyFile            string   `mapstructure:"keyFile"`
+	ServerName         string   `mapstructure:"serverName"`
+	InsecureSkipVerify bool     `mapstructure:"insecureSkipVerify"`
+}
+
+// ServerConfig describes TLS settings of the listener
+type ServerConfig struct {
+	CertFile      string   `mapstructure:"certFile"`
+	KeyFile       string   `mapstructure:"keyFile"`
+	ClientCAFiles []string `mapstructure:"clientCAFiles"`
+	// AllowedClientNames is a list of CN or DNS SANs that clients' certificates must have. Empty list allows any
+	// certificate signed by ClientCAFiles
+	AllowedClientNames []string `mapstructure:"allowedClientNames"`
+}
+
+func loadCertPool(files []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, f := range files {
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %v", f)
+		}
+	}
+	return pool, nil
+}
+
+// TLSConfig returns tls.Config for the client
+func (c *ClientConfig) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if len(c.CAFiles) > 0 {
+		pool, err := loadCertPool(c.CAFiles)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// TLSConfig returns tls.Config for the listener. If ClientCAFiles are set, clients are required to present
+// valid certificate.
+func (c *ServerConfig) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if len(c.ClientCAFiles) > 0 {
+		pool, err := loadCertPool(c.ClientCAFiles)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	} else if len(c.AllowedClientNames) > 0 {
+		return nil, fmt.Errorf("allowedClientNames requires clientCAFiles to be set")
+	}
+
+	if len(c.AllowedClientNames) > 0 {
+		allowed := make(map[string]struct{}, len(c.AllowedClientNames))
+		for _, name := range c.AllowedClientNames {
+			allowed[name] = struct{}{}
+		}
+		cfg.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+			for _, chain := range verifiedChains {
+				if len(chain) > 0 && certNameAllowed(chain[0], allowed) {
+					return nil
+				}
+			}
+			return fmt.Errorf("client certificate name is not allowed")
+		}
+	}
+
+	return cfg, nil
+}
+
+func certNameAllowed(cert *x509.Certificate, allowed map[string]struct{}) bool {
+	if _, ok := allowed[cert.Subject.CommonName]; ok {
+		return true
+	}
+	for _, name := range cert.DNSNames {
+		if _, ok := allowed[name]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, dir, name string, dnsNames []string, parent *testCert) (*testCert, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	signer := &testCert{cert: template, key: key}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}, certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caFile, _ := newTestCert(t, dir, "ca", nil, nil)
+	_, serverCert, serverKey := newTestCert(t, dir, "server", []string{"localhost"}, ca)
+	_, goodCert, goodKey := newTestCert(t, dir, "good", []string{"good.example.com"}, ca)
+	_, badCert, badKey := newTestCert(t, dir, "bad", []string{"bad.example.com"}, ca)
+
+	serverConfig := ServerConfig{
+		CertFile:           serverCert,
+		KeyFile:            serverKey,
+		ClientCAFiles:      []string{caFile},
+		AllowedClientNames: []string{"good.example.com"},
+	}
+	serverTLS, err := serverConfig.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.TLS = serverTLS
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		config  ClientConfig
+		success bool
+	}{
+		{
+			name:    "allowed client",
+			config:  ClientConfig{CAFiles: []string{caFile}, CertFile: goodCert, KeyFile: goodKey, ServerName: "localhost"},
+			success: true,
+		},
+		{
+			name:    "not allowed client",
+			config:  ClientConfig{CAFiles: []string{caFile}, CertFile: badCert, KeyFile: badKey, ServerName: "localhost"},
+			success: false,
+		},
+		{
+			name:    "no client certificate",
+			config:  ClientConfig{CAFiles: []string{caFile}, ServerName: "localhost"},
+			success: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientTLS, err := tt.config.TLSConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.success && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.success && err == nil {
+				t.Errorf("expected error, got none")
+			}
+		})
+	}
+}
+
+func TestServerConfigErrors(t *testing.T) {
+	c := ServerConfig{CertFile: "/nonexistent.crt", KeyFile: "/nonexistent.key"}
+	if _, err := c.TLSConfig(); err == nil {
+		t.Error("expected error for missing certificate")
+	}
+
+	cc := ClientConfig{CAFiles: []string{"/nonexistent.crt"}}
+	if _, err := cc.TLSConfig(); err == nil {
+		t.Error("expected error for missing CA file")
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/pathcache"
 	"github.com/go-graphite/carbonapi/zipper/errors"
+	"github.com/go-graphite/carbonapi/zipper/hashring"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
 
@@ -16,18 +18,30 @@ import (
 )
 
 type BroadcastGroup struct {
-	limiter              limiter.ServerLimiter
 	groupName            string
 	timeout              types.Timeouts
-	backends             []types.BackendServer
-	servers              []string
 	maxMetricsPerRequest int
 
+	// mu protects backends, servers, limiter and hashRing, that could be replaced by SetBackends
+	mu       sync.RWMutex
+	limiter  limiter.ServerLimiter
+	backends []types.BackendServer
+	servers  []string
+	hashRing *hashring.Ring
+
+	// maxPatternsPerRequest limits amount of path expressions batched in one request, 0 means unlimited
+	maxPatternsPerRequest int
+	mergePolicy           types.MergePolicy
+	// prefixIndex skips backends that don't have requested first-level prefixes, nil if disabled
+	prefixIndex *prefixIndex
+
 	pathCache pathcache.PathCache
 	logger    *zap.Logger
 }
 
 func (bg *BroadcastGroup) Children() []types.BackendServer {
+	bg.mu.RLock()
+	defer bg.mu.RUnlock()
 	return bg.backends
 }
 
@@ -67,11 +81,74 @@ func NewBroadcastGroupWithLimiter(logger *zap.Logger, groupName string, servers
 	return b, nil
 }
 
-func (bg BroadcastGroup) Name() string {
+// SetMergePolicy changes the way responses for the same series from different backends are merged
+func (bg *BroadcastGroup) SetMergePolicy(policy types.MergePolicy) {
+	bg.mergePolicy = policy
+}
+
+// SetMaxPatternsPerRequest limits amount of path expressions that are sent to backends in one request, requests with
+// more of them are split
+func (bg *BroadcastGroup) SetMaxPatternsPerRequest(n int) {
+	bg.maxPatternsPerRequest = n
+}
+
+// SetHashRing allows to send requests only to the servers that own the metric according to consistent hashing
+func (bg *BroadcastGroup) SetHashRing(ring *hashring.Ring) {
+	bg.mu.Lock()
+	bg.hashRing = ring
+	bg.mu.Unlock()
+}
+
+// SetBackends replaces backends of the group and their hash ring, requests that are already running aren't affected.
+// Backends that are kept should be passed as they are, so their state (prefixes, breakers, connections) is preserved
+func (bg *BroadcastGroup) SetBackends(backends []types.BackendServer, ring *hashring.Ring) {
+	names := make([]string, 0, len(backends))
+	kept := make(map[string]bool, len(backends))
+	for _, b := range backends {
+		names = append(names, b.Name())
+		kept[b.Name()] = true
+	}
+
+	bg.mu.Lock()
+	removed := bg.backends
+	bg.limiter = limiter.NewServerLimiter(names, bg.limiter.Capacity())
+	bg.backends = backends
+	bg.servers = names
+	bg.hashRing = ring
+	bg.mu.Unlock()
+
+	if bg.prefixIndex != nil {
+		for _, b := range removed {
+			if !kept[b.Name()] {
+				bg.prefixIndex.set(b.Name(), nil)
+			}
+		}
+	}
+	bg.logger.Info("backends changed",
+		zap.Strings("backends", names),
+	)
+}
+
+// members returns limiter and hash ring of the current backends
+func (bg *BroadcastGroup) members() (limiter.ServerLimiter, *hashring.Ring) {
+	bg.mu.RLock()
+	defer bg.mu.RUnlock()
+	return bg.limiter, bg.hashRing
+}
+
+// SetPrefixIndex makes group skip backends, that don't have first-level prefixes of requested metrics according to
+// the last probe, for both find and fetch requests
+func (bg *BroadcastGroup) SetPrefixIndex() {
+	bg.prefixIndex = newPrefixIndex()
+}
+
+func (bg *BroadcastGroup) Name() string {
 	return bg.groupName
 }
 
-func (bg BroadcastGroup) Backends() []string {
+func (bg *BroadcastGroup) Backends() []string {
+	bg.mu.RLock()
+	defer bg.mu.RUnlock()
 	return bg.servers
 }
 
@@ -107,7 +184,54 @@ func (bg *BroadcastGroup) filterServersByTLD(requests []string, backends []types
 	return filteredBackends
 }
 
-func (bg BroadcastGroup) MaxMetricsPerRequest() int {
+// backendPriority returns position of the backend in the group, backends that are listed first have higher priority
+func (bg *BroadcastGroup) backendPriority(backend types.BackendServer) int {
+	backends := bg.Children()
+	for i, b := range backends {
+		if b.Name() == backend.Name() {
+			return i
+		}
+	}
+	return len(backends)
+}
+
+// filterServersByHash returns servers that own requested metrics according to hash ring. If owner of any of the
+// requests can't be determined (e.x. there are wildcards in hashed part of the name), all backends are returned.
+func (bg *BroadcastGroup) filterServersByHash(requests []string, backends []types.BackendServer, isFind bool) []types.BackendServer {
+	_, ring := bg.members()
+	if ring == nil || (isFind && !ring.HashesPrefix()) {
+		return backends
+	}
+
+	owners := make(map[string]bool)
+	for _, request := range requests {
+		if strings.HasPrefix(request, "seriesByTag") {
+			return backends
+		}
+		servers, ok := ring.Get(request)
+		if !ok {
+			return backends
+		}
+		for _, s := range servers {
+			owners[s] = true
+		}
+	}
+
+	var filteredBackends []types.BackendServer
+	for _, k := range backends {
+		if owners[k.Name()] {
+			filteredBackends = append(filteredBackends, k)
+		}
+	}
+
+	if len(filteredBackends) == 0 {
+		return backends
+	}
+
+	return filteredBackends
+}
+
+func (bg *BroadcastGroup) MaxMetricsPerRequest() int {
 	return bg.maxMetricsPerRequest
 }
 
@@ -121,26 +245,29 @@ func (bg *BroadcastGroup) doSingleFetch(ctx context.Context, logger *zap.Logger,
 		)
 	}
 	logger = logger.With(zap.String("backend_name", backend.Name()))
+	limiter, _ := bg.members()
 	logger.Debug("waiting for slot",
-		zap.Int("max_connections", bg.limiter.Capacity()),
+		zap.Int("max_connections", limiter.Capacity()),
 	)
 
 	response := types.NewServerFetchResponse()
 	response.Server = backend.Name()
+	response.Priority = bg.backendPriority(backend)
 
-	if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
+	if err := limiter.Enter(ctx, backend.Name()); err != nil {
 		logger.Debug("timeout waiting for a slot")
 		resCh <- response.NonFatalError(err)
 		return
 	}
 
 	logger.Debug("got slot")
-	defer bg.limiter.Leave(ctx, backend.Name())
+	defer limiter.Leave(ctx, backend.Name())
 
 	// uuid := util.GetUUID(ctx)
 	for _, req := range requests {
 		logger.Debug("sending request")
 		r := types.NewServerFetchResponse()
+		r.Priority = response.Priority
 		r.Response, r.Stats, r.Err = backend.Fetch(ctx, req)
 		logger.Debug("got response")
 		response.Merge(r)
@@ -149,24 +276,79 @@ func (bg *BroadcastGroup) doSingleFetch(ctx context.Context, logger *zap.Logger,
 	resCh <- response
 }
 
+// requestBatcher packs fetch requests of different path expressions into as few requests as possible, starting new
+// one when it reaches maxMetrics metrics or maxPatterns path expressions. Zero limits mean unlimited
+type requestBatcher struct {
+	maxMetrics  int
+	maxPatterns int
+
+	requests []*protov3.MultiFetchRequest
+	current  *protov3.MultiFetchRequest
+	patterns map[string]struct{}
+}
+
+func newRequestBatcher(maxMetrics, maxPatterns int) *requestBatcher {
+	return &requestBatcher{
+		maxMetrics:  maxMetrics,
+		maxPatterns: maxPatterns,
+	}
+}
+
+func (b *requestBatcher) add(metric protov3.FetchRequest) {
+	if b.current != nil && b.maxPatterns > 0 && len(b.patterns) == b.maxPatterns {
+		if _, ok := b.patterns[metric.PathExpression]; !ok {
+			b.flush()
+		}
+	}
+	if b.current == nil {
+		b.current = &protov3.MultiFetchRequest{}
+		b.patterns = make(map[string]struct{})
+	}
+
+	b.current.Metrics = append(b.current.Metrics, metric)
+	b.patterns[metric.PathExpression] = struct{}{}
+	if b.maxMetrics > 0 && len(b.current.Metrics) == b.maxMetrics {
+		b.flush()
+	}
+}
+
+func (b *requestBatcher) flush() {
+	if b.current != nil {
+		b.requests = append(b.requests, b.current)
+		b.current = nil
+	}
+}
+
+// batches returns all requests, including incomplete one
+func (b *requestBatcher) batches() []*protov3.MultiFetchRequest {
+	b.flush()
+	return b.requests
+}
+
+// splitRequest batches metrics of all path expressions of the request into as few requests as possible. If
+// maxMetricsPerRequest is set, globs are resolved by find first and matched metrics are fetched, not more than
+// maxMetricsPerRequest per request. Otherwise path expressions are sent as is, up to maxPatternsPerRequest per request
 func (bg *BroadcastGroup) splitRequest(ctx context.Context, request *protov3.MultiFetchRequest) []*protov3.MultiFetchRequest {
-	if bg.MaxMetricsPerRequest() == 0 {
+	if bg.MaxMetricsPerRequest() == 0 && (bg.maxPatternsPerRequest == 0 || len(request.Metrics) <= bg.maxPatternsPerRequest) {
 		return []*protov3.MultiFetchRequest{request}
 	}
 
-	var requests []*protov3.MultiFetchRequest
+	b := newRequestBatcher(bg.MaxMetricsPerRequest(), bg.maxPatternsPerRequest)
 	for _, metric := range request.Metrics {
-		newRequest := &protov3.MultiFetchRequest{}
+		if bg.MaxMetricsPerRequest() == 0 {
+			b.add(metric)
+			continue
+		}
+
 		// TODO(Civil): Tags: improve logic
 		if strings.HasPrefix(metric.Name, "seriesByTag") {
-			newRequest.Metrics = append(newRequest.Metrics, protov3.FetchRequest{
+			b.add(protov3.FetchRequest{
 				Name:            metric.PathExpression,
 				StartTime:       metric.StartTime,
 				StopTime:        metric.StopTime,
 				PathExpression:  metric.PathExpression,
 				FilterFunctions: metric.FilterFunctions,
 			})
-			requests = append(requests, newRequest)
 			continue
 		}
 
@@ -184,27 +366,18 @@ func (bg *BroadcastGroup) splitRequest(ctx context.Context, request *protov3.Mul
 
 		for _, m := range f.Metrics {
 			for _, match := range m.Matches {
-				newRequest.Metrics = append(newRequest.Metrics, protov3.FetchRequest{
+				b.add(protov3.FetchRequest{
 					Name:            match.Path,
 					StartTime:       metric.StartTime,
 					StopTime:        metric.StopTime,
 					PathExpression:  metric.PathExpression,
 					FilterFunctions: metric.FilterFunctions,
 				})
-
-				if len(newRequest.Metrics) == bg.MaxMetricsPerRequest() {
-					requests = append(requests, newRequest)
-					newRequest = &protov3.MultiFetchRequest{}
-				}
 			}
 		}
-
-		if len(newRequest.Metrics) > 0 {
-			requests = append(requests, newRequest)
-		}
 	}
 
-	return requests
+	return b.batches()
 }
 
 func (bg *BroadcastGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, *errors.Errors) {
@@ -215,11 +388,18 @@ func (bg *BroadcastGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 	logger := bg.logger.With(zap.String("type", "fetch"), zap.Strings("request", requestNames))
 	logger.Debug("will try to fetch data")
 
-	backends := bg.filterServersByTLD(requestNames, bg.Children())
+	var backends []types.BackendServer
+	if bg.prefixIndex != nil {
+		backends = bg.prefixIndex.filter(requestNames, bg.Children())
+	} else {
+		backends = bg.filterServersByTLD(requestNames, bg.Children())
+	}
+	backends = bg.filterServersByHash(requestNames, backends, false)
 	requests := bg.splitRequest(ctx, request)
 	zipperRequests, totalMetricsCount := getFetchRequestMetricStats(requests, bg, backends)
 
 	result := types.NewServerFetchResponse()
+	result.MergePolicy = bg.mergePolicy
 	result.Stats.ZipperRequests = int64(zipperRequests)
 	result.Stats.TotalMetricsCount = int64(totalMetricsCount)
 
@@ -266,10 +446,10 @@ func getFetchRequestMetricStats(requests []*protov3.MultiFetchRequest, bg *Broad
 	if bg.MaxMetricsPerRequest() > 0 {
 		zipperRequests = 1
 	}
-	if len(requests) > 0 {
-		totalMetricsCount = (len(requests)-1)*bg.MaxMetricsPerRequest() + len(requests[len(requests)-1].Metrics)
-		zipperRequests += len(requests) * len(backends)
+	for _, r := range requests {
+		totalMetricsCount += len(r.Metrics)
 	}
+	zipperRequests += len(requests) * len(backends)
 	return zipperRequests, totalMetricsCount
 }
 
@@ -292,7 +472,8 @@ func (bg *BroadcastGroup) doFind(ctx context.Context, logger *zap.Logger, backen
 	r := types.NewServerFindResponse()
 	r.Server = backend.Name()
 
-	if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
+	limiter, _ := bg.members()
+	if err := limiter.Enter(ctx, backend.Name()); err != nil {
 		logger.Debug("timeout waiting for a slot")
 		r.Err = errors.FromErrNonFatal(types.ErrTimeoutExceeded)
 		resCh <- r
@@ -300,7 +481,7 @@ func (bg *BroadcastGroup) doFind(ctx context.Context, logger *zap.Logger, backen
 	}
 
 	logger.Debug("got slot")
-	defer bg.limiter.Leave(ctx, backend.Name())
+	defer limiter.Leave(ctx, backend.Name())
 
 	r.Response, r.Stats, r.Err = backend.Find(ctx, request)
 	logger.Debug("fetched response",
@@ -313,6 +494,10 @@ func (bg *BroadcastGroup) Find(ctx context.Context, request *protov3.MultiGlobRe
 	logger := bg.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
 
 	backends := bg.Children()
+	if bg.prefixIndex != nil {
+		backends = bg.prefixIndex.filter(request.Metrics, backends)
+	}
+	backends = bg.filterServersByHash(request.Metrics, backends, true)
 
 	logger.Debug("will do query with timeout",
 		zap.Any("backends", backends),
@@ -372,13 +557,14 @@ func (bg *BroadcastGroup) doInfoRequest(ctx context.Context, logger *zap.Logger,
 		Server: backend.Name(),
 	}
 
-	if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
+	limiter, _ := bg.members()
+	if err := limiter.Enter(ctx, backend.Name()); err != nil {
 		logger.Debug("timeout waiting for a slot")
 		r.Err = errors.FromErrNonFatal(err)
 		resCh <- r
 		return
 	}
-	defer bg.limiter.Leave(ctx, backend.Name())
+	defer limiter.Leave(ctx, backend.Name())
 
 	logger.Debug("got a slot")
 	r.Response, r.Stats, r.Err = backend.Info(ctx, request)
@@ -415,8 +601,86 @@ func (bg *BroadcastGroup) Info(ctx context.Context, request *protov3.MultiMetric
 	return result.Response, result.Stats, result.Err
 }
 
+type listResponse struct {
+	server  types.BackendServer
+	metrics *protov3.ListMetricsResponse
+	stats   *types.Stats
+	err     *errors.Errors
+}
+
+func doList(ctx context.Context, backend types.BackendServer, resCh chan<- listResponse) {
+	res, stats, err := backend.List(ctx)
+
+	resCh <- listResponse{
+		server:  backend,
+		metrics: res,
+		stats:   stats,
+		err:     err,
+	}
+}
+
+// List returns sorted names of metrics of all backends. List is used to build indexes, so incomplete one is useless and
+// error of any backend is fatal
 func (bg *BroadcastGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, *errors.Errors) {
-	return nil, nil, errors.FromErr(types.ErrNotImplementedYet)
+	logger := bg.logger.With(zap.String("type", "list"))
+
+	backends := bg.Children()
+	resCh := make(chan listResponse, len(backends))
+	for _, backend := range backends {
+		go doList(ctx, backend, resCh)
+	}
+
+	responses := 0
+	stats := &types.Stats{}
+	var err errors.Errors
+	answeredServers := make(map[string]struct{})
+	seen := make(map[string]struct{})
+	res := &protov3.ListMetricsResponse{}
+
+GATHER:
+	for responses < len(backends) {
+		select {
+		case r := <-resCh:
+			answeredServers[r.server.Name()] = struct{}{}
+			responses++
+			if r.stats != nil {
+				stats.Merge(r.stats)
+			}
+			if r.err != nil && len(r.err.Errors) > 0 {
+				err.Merge(r.err)
+				continue
+			}
+			if r.metrics == nil {
+				continue
+			}
+			for _, m := range r.metrics.Metrics {
+				if _, ok := seen[m]; !ok {
+					seen[m] = struct{}{}
+					res.Metrics = append(res.Metrics, m)
+				}
+			}
+
+		case <-ctx.Done():
+			logger.Warn("timeout waiting for more responses",
+				zap.Strings("no_answers_from", types.NoAnswerBackends(backends, answeredServers)),
+			)
+			err.Add(types.ErrTimeoutExceeded)
+			break GATHER
+		}
+	}
+
+	if len(err.Errors) > 0 {
+		err.HaveFatalErrors = true
+		return nil, stats, &err
+	}
+	sort.Strings(res.Metrics)
+
+	logger.Debug("got some responses",
+		zap.Int("backends_count", len(backends)),
+		zap.Int("metrics", len(res.Metrics)),
+	)
+
+	return res, stats, &err
 }
 func (bg *BroadcastGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, *errors.Errors) {
 	return nil, nil, errors.FromErr(types.ErrNotImplementedYet)
@@ -449,12 +713,13 @@ func (bg *BroadcastGroup) doTagRequest(ctx context.Context, logger *zap.Logger,
 
 	logger.Debug("waiting for a slot")
 
-	if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
+	limiter, _ := bg.members()
+	if err := limiter.Enter(ctx, backend.Name()); err != nil {
 		logger.Debug("timeout waiting for a slot")
 		resCh <- res
 		return
 	}
-	defer bg.limiter.Leave(ctx, backend.Name())
+	defer limiter.Leave(ctx, backend.Name())
 
 	logger.Debug("got a slot")
 	if request.IsName {
@@ -501,9 +766,10 @@ func (bg *BroadcastGroup) tagEverything(ctx context.Context, isTagName bool, que
 		)
 	}
 
-	if limit != -1 && int64(len(result.Response)) > limit {
-		sort.Strings(result.Response)
-		result.Response = result.Response[:limit-1]
+	// responses of different backends are merged in arbitrary order
+	sort.Strings(result.Response)
+	if limit >= 0 && int64(len(result.Response)) > limit {
+		result.Response = result.Response[:limit]
 	}
 
 	logger.Debug("got some responses",
@@ -569,8 +835,14 @@ GATHER:
 			responses++
 			if r.err != nil && len(r.err.Errors) > 0 {
 				err.Merge(r.err)
+				if bg.prefixIndex != nil {
+					bg.prefixIndex.set(r.server.Name(), nil)
+				}
 				continue
 			}
+			if bg.prefixIndex != nil {
+				bg.prefixIndex.set(r.server.Name(), append([]string{}, r.tlds...))
+			}
 			for _, tld := range r.tlds {
 				tldSet[tld] = struct{}{}
 				cache[tld] = append(cache[tld], r.server)
@@ -585,6 +857,14 @@ GATHER:
 		}
 	}
 
+	if bg.prefixIndex != nil {
+		for _, b := range backends {
+			if _, ok := answeredServers[b.Name()]; !ok {
+				bg.prefixIndex.set(b.Name(), nil)
+			}
+		}
+	}
+
 	var tlds []string
 	for tld, _ := range tldSet {
 		tlds = append(tlds, tld)
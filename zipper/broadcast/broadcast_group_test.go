@@ -11,6 +11,7 @@ import (
 
 	"github.com/go-graphite/carbonapi/zipper/dummy"
 	"github.com/go-graphite/carbonapi/zipper/errors"
+	"github.com/go-graphite/carbonapi/zipper/hashring"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -173,6 +174,37 @@ func TestProbeTLDs(t *testing.T) {
 	}
 }
 
+func TestTagNames(t *testing.T) {
+	client1 := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	client1.SetTagNamesResponse([]string{"host", "dc", "env"})
+	client2 := dummy.NewDummyClient("client2", []string{"backend2"}, 1)
+	client2.SetTagNamesResponse([]string{"dc", "app", "app"})
+
+	b, err := NewBroadcastGroup(logger, "tags", []types.BackendServer{client1, client2}, 60, 500, 100, timeouts)
+	if err != nil && (err.HaveFatalErrors || len(err.Errors) > 0) {
+		t.Fatalf("error while initializing group, when it shouldn't be: %v", err)
+	}
+
+	tests := []struct {
+		limit    int64
+		response []string
+	}{
+		{-1, []string{"app", "dc", "env", "host"}},
+		{2, []string{"app", "dc"}},
+		{4, []string{"app", "dc", "env", "host"}},
+		{0, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("limit=%d", tt.limit), func(t *testing.T) {
+			res, _ := b.TagNames(context.Background(), "expr=dc%3D~dc.%2A", tt.limit)
+			if !reflect.DeepEqual(res, tt.response) {
+				t.Errorf("got %v, expected %v", res, tt.response)
+			}
+		})
+	}
+}
+
 type testCaseFetch struct {
 	name           string
 	servers        []types.BackendServer
@@ -1192,3 +1224,196 @@ func TestFetchRequests(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterServersByHash(t *testing.T) {
+	names := []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080"}
+	servers := make([]types.BackendServer, 0, len(names))
+	for _, n := range names {
+		servers = append(servers, dummy.NewDummyClient(n, []string{n}, 0))
+	}
+
+	b, err := NewBroadcastGroup(logger, "hashed", servers, 60, 500, 100, timeouts)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b.SetHashRing(hashring.New(names, nil, 0, 1, 0))
+
+	backends := b.filterServersByHash([]string{"foo.bar.baz"}, b.Children(), false)
+	if len(backends) != 1 || backends[0].Name() != "http://10.0.0.2:8080" {
+		t.Errorf("unexpected backends for exact name: %v", backends)
+	}
+
+	backends = b.filterServersByHash([]string{"foo.*.baz"}, b.Children(), false)
+	if len(backends) != len(names) {
+		t.Errorf("wildcard request should be sent to all backends, got %v", backends)
+	}
+
+	backends = b.filterServersByHash([]string{"foo.bar.baz"}, b.Children(), true)
+	if len(backends) != len(names) {
+		t.Errorf("find request should be sent to all backends when whole name is hashed, got %v", backends)
+	}
+}
+
+func TestSplitRequest(t *testing.T) {
+	client := dummy.NewDummyClient("client1", []string{"backend1"}, 0)
+	for pattern, matches := range map[string][]string{
+		"foo.*": {"foo.a", "foo.b", "foo.c"},
+		"bar.*": {"bar.a"},
+		"baz":   {"baz"},
+	} {
+		glob := protov3.GlobResponse{Name: pattern}
+		for _, m := range matches {
+			glob.Matches = append(glob.Matches, protov3.GlobMatch{Path: m, IsLeaf: true})
+		}
+		client.AddFindResponse(
+			&protov3.MultiGlobRequest{Metrics: []string{pattern}},
+			&protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{glob}},
+			&types.Stats{}, &errors.Errors{},
+		)
+	}
+
+	request := &protov3.MultiFetchRequest{}
+	for _, pattern := range []string{"foo.*", "bar.*", "baz"} {
+		request.Metrics = append(request.Metrics, protov3.FetchRequest{
+			Name:           pattern,
+			PathExpression: pattern,
+			StartTime:      0,
+			StopTime:       120,
+		})
+	}
+
+	tests := []struct {
+		name        string
+		maxMetrics  int
+		maxPatterns int
+		expected    [][]string
+	}{
+		{
+			name:     "unlimited",
+			expected: [][]string{{"foo.*", "bar.*", "baz"}},
+		},
+		{
+			name:        "patterns limit",
+			maxPatterns: 2,
+			expected:    [][]string{{"foo.*", "bar.*"}, {"baz"}},
+		},
+		{
+			name:       "metrics of different patterns are batched",
+			maxMetrics: 100,
+			expected:   [][]string{{"foo.a", "foo.b", "foo.c", "bar.a", "baz"}},
+		},
+		{
+			name:       "metrics limit",
+			maxMetrics: 2,
+			expected:   [][]string{{"foo.a", "foo.b"}, {"foo.c", "bar.a"}, {"baz"}},
+		},
+		{
+			name:        "both limits",
+			maxMetrics:  4,
+			maxPatterns: 1,
+			expected:    [][]string{{"foo.a", "foo.b", "foo.c"}, {"bar.a"}, {"baz"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBroadcastGroup(logger, tt.name, []types.BackendServer{client}, 60, 500, tt.maxMetrics, timeouts)
+			if err != nil && (err.HaveFatalErrors || len(err.Errors) > 0) {
+				t.Fatalf("error while initializing group, when it shouldn't be: %v", err)
+			}
+			b.SetMaxPatternsPerRequest(tt.maxPatterns)
+
+			var got [][]string
+			for _, r := range b.splitRequest(context.Background(), request) {
+				var names []string
+				for _, m := range r.Metrics {
+					names = append(names, m.Name)
+				}
+				got = append(got, names)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPrefixIndex(t *testing.T) {
+	var servers []types.BackendServer
+	for name, response := range map[string]dummy.ProbeResponse{
+		"client1": {Response: []string{"a", "b"}},
+		"client2": {Response: []string{"carbon"}},
+		"client3": {Errors: errors.Fatal("probe failed")},
+	} {
+		s := dummy.NewDummyClient(name, []string{name}, 0)
+		s.SetTLDResponse(response)
+		servers = append(servers, s)
+	}
+	b, err := NewBroadcastGroup(logger, "indexed", servers, 60, 500, 100, timeouts)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b.SetPrefixIndex()
+	b.ProbeTLDs(context.Background())
+
+	names := func(backends []types.BackendServer) []string {
+		var res []string
+		for _, b := range backends {
+			res = append(res, b.Name())
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	tests := []struct {
+		requests []string
+		expected []string
+	}{
+		{[]string{"a.foo"}, []string{"client1", "client3"}},
+		{[]string{"carbon.agents.*"}, []string{"client2", "client3"}},
+		{[]string{"c*.agents.*"}, []string{"client2", "client3"}},
+		{[]string{"b.foo", "carbon.agents"}, []string{"client1", "client2", "client3"}},
+		// backend that failed probe is unknown and always gets requests
+		{[]string{"d.foo"}, []string{"client3"}},
+		{[]string{"{a,carbon}.foo"}, []string{"client1", "client2", "client3"}},
+		{[]string{"seriesByTag('name=a')"}, []string{"client1", "client2", "client3"}},
+	}
+	for _, tt := range tests {
+		if got := names(b.prefixIndex.filter(tt.requests, b.Children())); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%v: got %v, expected %v", tt.requests, got, tt.expected)
+		}
+	}
+
+	// prefix that isn't known by any backend is requested from all of them
+	b.prefixIndex.set("client3", []string{"x"})
+	if got := names(b.prefixIndex.filter([]string{"new.metric"}, b.Children())); len(got) != 3 {
+		t.Errorf("unknown prefix should be requested from all backends, got %v", got)
+	}
+}
+
+func TestList(t *testing.T) {
+	client1 := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	client1.SetListResponse(dummy.ListResponse{Response: &protov3.ListMetricsResponse{Metrics: []string{"b.c", "a.b"}}})
+	client2 := dummy.NewDummyClient("client2", []string{"backend2"}, 1)
+	client2.SetListResponse(dummy.ListResponse{Response: &protov3.ListMetricsResponse{Metrics: []string{"a.b", "c.d"}}})
+
+	b, err := NewBroadcastGroup(logger, "list", []types.BackendServer{client1, client2}, 60, 500, 100, timeouts)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res, _, err := b.List(context.Background())
+	if err != nil && len(err.Errors) > 0 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"a.b", "b.c", "c.d"}
+	if !reflect.DeepEqual(res.Metrics, expected) {
+		t.Errorf("expected %v, got %v", expected, res.Metrics)
+	}
+
+	client2.SetListResponse(dummy.ListResponse{Errors: errors.FromErrNonFatal(types.ErrNoResponseFetched)})
+	res, _, err = b.List(context.Background())
+	if res != nil || err == nil || !err.HaveFatalErrors {
+		t.Errorf("incomplete list should be a fatal error, got %v, %v", res, err)
+	}
+}
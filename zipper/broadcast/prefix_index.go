@@ -0,0 +1,97 @@
+package broadcast
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// prefixIndexSkipped is a number of requests to backends that weren't sent because backends don't have requested
+// first-level prefixes
+var prefixIndexSkipped int64
+
+// GetPrefixIndexSkipped returns number of requests to backends that were skipped by prefix index
+func GetPrefixIndexSkipped() int64 {
+	return atomic.LoadInt64(&prefixIndexSkipped)
+}
+
+// prefixIndex contains first-level prefixes of metrics of backends, found by probes. Backends that didn't answer the
+// last probe are unknown and get all requests
+type prefixIndex struct {
+	sync.RWMutex
+	prefixes map[string]map[string]struct{}
+}
+
+func newPrefixIndex() *prefixIndex {
+	return &prefixIndex{prefixes: make(map[string]map[string]struct{})}
+}
+
+// set replaces prefixes of the backend, nil means that backend is unknown
+func (idx *prefixIndex) set(backend string, prefixes []string) {
+	idx.Lock()
+	defer idx.Unlock()
+	if prefixes == nil {
+		delete(idx.prefixes, backend)
+		return
+	}
+	set := make(map[string]struct{}, len(prefixes))
+	for _, p := range prefixes {
+		set[p] = struct{}{}
+	}
+	idx.prefixes[backend] = set
+}
+
+// has checks if backend could have metrics matching first-level pattern
+func (idx *prefixIndex) has(backend, pattern string) bool {
+	set, ok := idx.prefixes[backend]
+	if !ok {
+		return true
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		_, ok := set[pattern]
+		return ok
+	}
+	for p := range set {
+		if ok, err := path.Match(pattern, p); ok || err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns backends that could have metrics of any of the requests. If there are no such backends (e.x.
+// prefix appeared after the last probe), all backends are returned
+func (idx *prefixIndex) filter(requests []string, backends []types.BackendServer) []types.BackendServer {
+	patterns := make([]string, 0, len(requests))
+	for _, request := range requests {
+		pattern := request
+		if i := strings.IndexByte(request, '.'); i >= 0 {
+			pattern = request[:i]
+		}
+		// tags and alternatives are not indexed
+		if strings.HasPrefix(request, "seriesByTag") || strings.Contains(pattern, "{") || pattern == "" {
+			return backends
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	idx.RLock()
+	defer idx.RUnlock()
+	filtered := make([]types.BackendServer, 0, len(backends))
+	for _, b := range backends {
+		for _, p := range patterns {
+			if idx.has(b.Name(), p) {
+				filtered = append(filtered, b)
+				break
+			}
+		}
+	}
+	if len(filtered) == 0 {
+		return backends
+	}
+	atomic.AddInt64(&prefixIndexSkipped, int64(len(backends)-len(filtered)))
+	return filtered
+}
@@ -13,7 +13,9 @@ type Config struct {
 	Backends                  []string         `mapstructure:"backends"`
 	BackendsV2                types.BackendsV2 `mapstructure:"backendsv2"`
 	MaxBatchSize              int              `mapstructure:"maxBatchSize"`
+	MaxPatternsPerRequest     int              `mapstructure:"maxPatternsPerRequest"`
 	MaxTries                  int              `mapstructure:"maxTries"`
+	MergePolicy               string           `mapstructure:"mergePolicy"`
 
 	CarbonSearch   types.CarbonSearch
 	CarbonSearchV2 types.CarbonSearchV2
@@ -0,0 +1,209 @@
+package zipper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const defaultDiscoveryInterval = 30 * time.Second
+
+// discoveredBackends returns backend groups with discovery
+func discoveredBackends(config *config.Config) []*types.BackendV2 {
+	var backends []*types.BackendV2
+	for _, list := range [][]types.BackendV2{config.BackendsV2.Backends, config.CarbonSearchV2.Backends} {
+		for i := range list {
+			if list[i].Discovery != nil {
+				backends = append(backends, &list[i])
+			}
+		}
+	}
+	return backends
+}
+
+// DiscoveryInterval returns the shortest interval of re-resolving servers of backend groups, 0 if there are no groups
+// with discovery
+func DiscoveryInterval(config *config.Config) time.Duration {
+	var interval time.Duration
+	for _, backend := range discoveredBackends(config) {
+		i := backend.Discovery.Interval
+		if i <= 0 {
+			i = defaultDiscoveryInterval
+		}
+		if interval == 0 || i < interval {
+			interval = i
+		}
+	}
+	return interval
+}
+
+// DiscoverServers resolves servers of backend groups with discovery. Config isn't modified, as zipper that is running
+// could still use it: its copy with new servers is returned with the groups, which servers changed. Groups that failed
+// to resolve keep previous servers
+func DiscoverServers(ctx context.Context, cfg *config.Config) (*config.Config, []*types.BackendV2, error) {
+	next := *cfg
+	next.BackendsV2.Backends = append([]types.BackendV2(nil), cfg.BackendsV2.Backends...)
+	next.CarbonSearchV2.Backends = append([]types.BackendV2(nil), cfg.CarbonSearchV2.Backends...)
+
+	var changed []*types.BackendV2
+	var firstErr error
+	for _, backend := range discoveredBackends(&next) {
+		servers, zones, err := discoverServers(ctx, backend.Discovery)
+		if err == nil && len(servers) == 0 {
+			err = fmt.Errorf("no servers discovered")
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("backend group '%v': %v", backend.GroupName, err)
+			}
+			continue
+		}
+
+		current := append([]string(nil), backend.Servers...)
+		sort.Strings(current)
+		serversChanged := !reflect.DeepEqual(current, servers)
+		zonesChanged := zones != nil && !reflect.DeepEqual(zones, backend.ServerZones)
+		if serversChanged {
+			backend.Servers = servers
+		}
+		if zonesChanged {
+			backend.ServerZones = zones
+		}
+		if serversChanged || zonesChanged {
+			changed = append(changed, backend)
+		}
+	}
+	return &next, changed, firstErr
+}
+
+// discoverServers returns sorted list of unique servers and their zones, if source knows them
+func discoverServers(ctx context.Context, d *types.Discovery) ([]string, map[string]string, error) {
+	var servers []string
+	var zones map[string]string
+	var err error
+	switch {
+	case d.DNS != "":
+		servers, err = lookupServers(ctx, d.DNS)
+	case d.File != "":
+		var f *os.File
+		f, err = os.Open(d.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		servers, err = readServers(f)
+	case d.Consul != "":
+		servers, err = fetchConsulServers(ctx, d.Consul)
+	case d.Kubernetes != nil:
+		servers, zones, err = kubernetesServers(ctx, d.Kubernetes)
+	default:
+		return nil, nil, fmt.Errorf("no discovery source specified")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(servers)
+	unique := servers[:0]
+	for i, s := range servers {
+		if i == 0 || s != servers[i-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique, zones, nil
+}
+
+// lookupServers resolves host of the server URL, SRV records are used if host starts with '_'
+func lookupServers(ctx context.Context, server string) ([]string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	host, port := u.Hostname(), u.Port()
+
+	var hosts []string
+	if strings.HasPrefix(host, "_") {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", host)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			hosts = append(hosts, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+		}
+	} else {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			switch {
+			case port != "":
+				hosts = append(hosts, net.JoinHostPort(addr, port))
+			case strings.Contains(addr, ":"):
+				hosts = append(hosts, "["+addr+"]")
+			default:
+				hosts = append(hosts, addr)
+			}
+		}
+	}
+
+	servers := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		s := *u
+		s.Host = h
+		servers = append(servers, s.String())
+	}
+	return servers, nil
+}
+
+// readServers reads server URLs one per line, empty lines and comments are skipped
+func readServers(r io.Reader) ([]string, error) {
+	var servers []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		servers = append(servers, line)
+	}
+	return servers, scanner.Err()
+}
+
+// fetchConsulServers reads server URLs from raw value of Consul KV key
+func fetchConsulServers(ctx context.Context, key string) ([]string, error) {
+	u, err := url.Parse(key)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("raw", "")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return readServers(resp.Body)
+}
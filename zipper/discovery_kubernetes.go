@@ -0,0 +1,150 @@
+package zipper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// endpointSliceList is a part of discovery.k8s.io/v1 EndpointSliceList that is used for discovery
+type endpointSliceList struct {
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready       *bool `json:"ready"`
+				Terminating *bool `json:"terminating"`
+			} `json:"conditions"`
+			Zone string `json:"zone"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port *int   `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// kubernetesServers returns servers of ready pods of the service and their zones. If zone is set and there are ready
+// pods in it, only they are returned
+func kubernetesServers(ctx context.Context, d *types.KubernetesDiscovery) ([]string, map[string]string, error) {
+	namespace := d.Namespace
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/namespace")
+		if err != nil {
+			return nil, nil, fmt.Errorf("kubernetes namespace isn't specified: %v", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	selector := d.LabelSelector
+	if selector == "" {
+		if d.Service == "" {
+			return nil, nil, fmt.Errorf("kubernetes service or labelSelector should be specified")
+		}
+		selector = "kubernetes.io/service-name=" + d.Service
+	}
+
+	var slices endpointSliceList
+	err := kubernetesGet(ctx, d.APIServer, "/apis/discovery.k8s.io/v1/namespaces/"+url.PathEscape(namespace)+
+		"/endpointslices?labelSelector="+url.QueryEscape(selector), &slices)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scheme := d.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	var servers, zoneServers []string
+	zones := make(map[string]string)
+	for _, slice := range slices.Items {
+		port := -1
+		for _, p := range slice.Ports {
+			if p.Port != nil && (d.Port == "" || p.Name == d.Port) {
+				port = *p.Port
+				break
+			}
+		}
+		if port < 0 {
+			continue
+		}
+		for _, e := range slice.Endpoints {
+			// unset conditions mean that the pod is ready and isn't terminating
+			if (e.Conditions.Ready != nil && !*e.Conditions.Ready) || (e.Conditions.Terminating != nil && *e.Conditions.Terminating) {
+				continue
+			}
+			for _, addr := range e.Addresses {
+				server := scheme + "://" + net.JoinHostPort(addr, strconv.Itoa(port))
+				servers = append(servers, server)
+				if e.Zone != "" {
+					zones[server] = e.Zone
+				}
+				if d.Zone != "" && e.Zone == d.Zone {
+					zoneServers = append(zoneServers, server)
+				}
+			}
+		}
+	}
+	if len(zoneServers) > 0 {
+		return zoneServers, zones, nil
+	}
+	return servers, zones, nil
+}
+
+// kubernetesGet decodes response of Kubernetes API to v. In-cluster API is used if apiServer is empty
+func kubernetesGet(ctx context.Context, apiServer, path string, v interface{}) error {
+	client, token := http.DefaultClient, ""
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return fmt.Errorf("kubernetes apiServer isn't specified and carbonapi isn't running in cluster")
+		}
+		t, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/token")
+		if err != nil {
+			return err
+		}
+		ca, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/ca.crt")
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificates found in kubernetes CA")
+		}
+		client = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}}
+		apiServer, token = "https://"+net.JoinHostPort(host, port), strings.TrimSpace(string(t))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(apiServer, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,149 @@
+package zipper
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestDiscoverServers(t *testing.T) {
+	f, err := ioutil.TempFile("", "backends")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# go-carbon\nhttp://10.0.0.2:8080\n\nhttp://10.0.0.1:8080\nhttp://10.0.0.2:8080\n")
+	f.Close()
+
+	consulValue := "http://10.0.1.1:8080\n"
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["raw"]; !ok || r.URL.Path != "/v1/kv/carbonapi/backends" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(consulValue))
+	}))
+	defer consul.Close()
+
+	cfg := &config.Config{
+		BackendsV2: types.BackendsV2{
+			Backends: []types.BackendV2{
+				{GroupName: "static", Servers: []string{"http://10.0.2.1:8080"}},
+				{GroupName: "file", Discovery: &types.Discovery{File: f.Name(), Interval: time.Minute}},
+				{GroupName: "consul", Discovery: &types.Discovery{Consul: consul.URL + "/v1/kv/carbonapi/backends", Interval: 10 * time.Second}},
+				{GroupName: "dns", Discovery: &types.Discovery{DNS: "http://localhost:8080/"}},
+			},
+		},
+	}
+	if i := DiscoveryInterval(cfg); i != 10*time.Second {
+		t.Errorf("unexpected interval %v", i)
+	}
+
+	next, changed, err := DiscoverServers(context.Background(), cfg)
+	if err != nil || len(changed) != 3 {
+		t.Fatalf("unexpected result %v, error %v", changed, err)
+	}
+	if cfg.BackendsV2.Backends[1].Servers != nil {
+		t.Errorf("original config is modified: %v", cfg.BackendsV2.Backends[1].Servers)
+	}
+	cfg = next
+	expected := map[string][]string{
+		"static": {"http://10.0.2.1:8080"},
+		"file":   {"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+		"consul": {"http://10.0.1.1:8080"},
+	}
+	for _, b := range cfg.BackendsV2.Backends {
+		if b.GroupName == "dns" {
+			var found bool
+			for _, s := range b.Servers {
+				found = found || s == "http://127.0.0.1:8080/"
+			}
+			if !found {
+				t.Errorf("localhost isn't resolved: %v", b.Servers)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(b.Servers, expected[b.GroupName]) {
+			t.Errorf("group %v: got %v, expected %v", b.GroupName, b.Servers, expected[b.GroupName])
+		}
+	}
+
+	cfg, changed, err = DiscoverServers(context.Background(), cfg)
+	if err != nil || len(changed) != 0 {
+		t.Errorf("servers shouldn't change, got %v, error %v", changed, err)
+	}
+
+	// failed group keeps previous servers
+	consulValue = ""
+	cfg, changed, err = DiscoverServers(context.Background(), cfg)
+	if err == nil || len(changed) != 0 {
+		t.Errorf("expected error, got %v, error %v", changed, err)
+	}
+	if servers := cfg.BackendsV2.Backends[2].Servers; !reflect.DeepEqual(servers, expected["consul"]) {
+		t.Errorf("servers of failed group changed: %v", servers)
+	}
+
+	consulValue = "http://10.0.1.2:8080\nhttp://10.0.1.1:8080\n"
+	cfg, changed, err = DiscoverServers(context.Background(), cfg)
+	if err != nil || len(changed) != 1 || changed[0].GroupName != "consul" {
+		t.Errorf("expected change of consul group, got %v, error %v", changed, err)
+	}
+	if servers := cfg.BackendsV2.Backends[2].Servers; !reflect.DeepEqual(servers, []string{"http://10.0.1.1:8080", "http://10.0.1.2:8080"}) {
+		t.Errorf("unexpected servers %v", servers)
+	}
+}
+
+func TestKubernetesServers(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/graphite/endpointslices" ||
+			r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=go-carbon" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"items": [{
+			"endpoints": [
+				{"addresses": ["10.0.0.1"], "conditions": {"ready": true}, "zone": "a"},
+				{"addresses": ["10.0.0.2"], "conditions": {"ready": false}, "zone": "a"},
+				{"addresses": ["10.0.0.3"], "conditions": {"ready": true, "terminating": true}, "zone": "a"},
+				{"addresses": ["10.0.0.4"], "conditions": {}, "zone": "b"}
+			],
+			"ports": [{"name": "carbonlink", "port": 7002}, {"name": "http", "port": 8080}]
+		}]}`))
+	}))
+	defer api.Close()
+
+	tests := []struct {
+		zone     string
+		expected []string
+	}{
+		{zone: "", expected: []string{"http://10.0.0.1:8080", "http://10.0.0.4:8080"}},
+		{zone: "a", expected: []string{"http://10.0.0.1:8080"}},
+		{zone: "c", expected: []string{"http://10.0.0.1:8080", "http://10.0.0.4:8080"}},
+	}
+	for _, tt := range tests {
+		servers, zones, err := kubernetesServers(context.Background(), &types.KubernetesDiscovery{
+			APIServer: api.URL,
+			Namespace: "graphite",
+			Service:   "go-carbon",
+			Port:      "http",
+			Zone:      tt.zone,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(servers, tt.expected) {
+			t.Errorf("zone '%v': got %v, expected %v", tt.zone, servers, tt.expected)
+		}
+		if zones["http://10.0.0.4:8080"] != "b" {
+			t.Errorf("unexpected zones %v", zones)
+		}
+	}
+}
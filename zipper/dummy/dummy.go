@@ -58,6 +58,7 @@ type DummyClient struct {
 	tagNameResponse   []string
 	tagValuesResponse []string
 	probeResponses    ProbeResponse
+	listResponse      *ListResponse
 	alwaysTimeout     time.Duration
 }
 
@@ -192,8 +193,15 @@ func (c *DummyClient) Info(ctx context.Context, request *protov3.MultiMetricsInf
 	return nil, nil, errors.Fatalf("not implemented")
 }
 
+func (c *DummyClient) SetListResponse(response ListResponse) {
+	c.listResponse = &response
+}
+
 func (c *DummyClient) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, *errors.Errors) {
-	return nil, nil, errors.Fatalf("not implemented")
+	if c.listResponse == nil {
+		return nil, nil, errors.Fatalf("not implemented")
+	}
+	return c.listResponse.Response, c.listResponse.Stats, c.listResponse.Errors
 }
 
 func (c *DummyClient) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, *errors.Errors) {
@@ -217,7 +225,7 @@ func (c *DummyClient) SetTagValuesResponse(response []string) {
 }
 
 func (c *DummyClient) TagValues(ctx context.Context, query string, limit int64) ([]string, *errors.Errors) {
-	return c.tagNameResponse, nil
+	return c.tagValuesResponse, nil
 }
 
 func (c *DummyClient) ProbeTLDs(ctx context.Context) ([]string, *errors.Errors) {
@@ -0,0 +1,145 @@
+package hashring
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultReplicas is amount of points on the ring per server, same as graphite and carbon-c-relay use
+const DefaultReplicas = 100
+
+type ringEntry struct {
+	position uint16
+	key      string
+	server   string
+}
+
+// Ring is a consistent hash ring compatible with graphite's and carbon-c-relay's carbon_ch. It allows to find out which
+// servers own the metric without asking all of them.
+type Ring struct {
+	entries           []ringEntry
+	servers           int
+	replicationFactor int
+	keyNodes          int
+}
+
+// NodeKey returns key that graphite uses for the server, it's python representation of (host, instance) tuple
+func NodeKey(server, instance string) string {
+	host := server
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+
+	if instance == "" {
+		return fmt.Sprintf("('%s', None)", host)
+	}
+	return fmt.Sprintf("('%s', '%s')", host, instance)
+}
+
+func position(key string) uint16 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint16(sum[:2])
+}
+
+// New creates ring for servers. instances allows to specify carbon instance name for the server, replicas is amount
+// of points per server on the ring (0 means DefaultReplicas), replicationFactor is amount of servers that have copy of
+// each metric and keyNodes is amount of leading metric name nodes that are used as hash key (0 means whole name).
+func New(servers []string, instances map[string]string, replicas, replicationFactor, keyNodes int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	if replicationFactor <= 0 {
+		replicationFactor = 1
+	}
+
+	r := &Ring{
+		entries:           make([]ringEntry, 0, len(servers)*replicas),
+		servers:           len(servers),
+		replicationFactor: replicationFactor,
+		keyNodes:          keyNodes,
+	}
+
+	for _, server := range servers {
+		key := NodeKey(server, instances[server])
+		for i := 0; i < replicas; i++ {
+			r.entries = append(r.entries, ringEntry{
+				position: position(fmt.Sprintf("%s:%d", key, i)),
+				key:      key,
+				server:   server,
+			})
+		}
+	}
+
+	sort.Slice(r.entries, func(i, j int) bool {
+		if r.entries[i].position == r.entries[j].position {
+			return r.entries[i].key < r.entries[j].key
+		}
+		return r.entries[i].position < r.entries[j].position
+	})
+
+	return r
+}
+
+// Key returns part of the metric name that is used for hashing. Second value is false if that part contains wildcards
+// or metric name is shorter than the key, so it's not possible to find the owner.
+func (r *Ring) Key(metric string) (string, bool) {
+	key := metric
+	if r.keyNodes > 0 {
+		nodes := strings.SplitN(metric, ".", r.keyNodes+1)
+		if len(nodes) < r.keyNodes {
+			return "", false
+		}
+		key = strings.Join(nodes[:r.keyNodes], ".")
+	}
+
+	if strings.ContainsAny(key, "*?[]{}") {
+		return "", false
+	}
+
+	return key, true
+}
+
+// HashesPrefix returns true if only leading nodes of the name are hashed. In that case all metrics under the prefix
+// live on the same servers, so even find requests can be routed.
+func (r *Ring) HashesPrefix() bool {
+	return r.keyNodes > 0
+}
+
+// Get returns servers that own the metric. Second value is false if owners can't be determined.
+func (r *Ring) Get(metric string) ([]string, bool) {
+	if len(r.entries) == 0 {
+		return nil, false
+	}
+
+	key, ok := r.Key(metric)
+	if !ok {
+		return nil, false
+	}
+
+	pos := position(key)
+	idx := sort.Search(len(r.entries), func(i int) bool {
+		return r.entries[i].position >= pos
+	})
+
+	want := r.replicationFactor
+	if want > r.servers {
+		want = r.servers
+	}
+
+	res := make([]string, 0, want)
+	seen := make(map[string]struct{}, want)
+	for i := 0; i < len(r.entries) && len(res) < want; i++ {
+		e := r.entries[(idx+i)%len(r.entries)]
+		if _, ok := seen[e.key]; ok {
+			continue
+		}
+		seen[e.key] = struct{}{}
+		res = append(res, e.server)
+	}
+
+	return res, true
+}
@@ -0,0 +1,76 @@
+package hashring
+
+import (
+	"reflect"
+	"testing"
+)
+
+var servers = []string{
+	"http://10.0.0.1:8080",
+	"http://10.0.0.2:8080",
+	"http://10.0.0.3:8080",
+}
+
+var instances = map[string]string{
+	"http://10.0.0.3:8080": "b",
+}
+
+func TestRingGet(t *testing.T) {
+	// Expected values were computed with graphite's ConsistentHashRing
+	tests := []struct {
+		metric   string
+		expected []string
+	}{
+		{"foo.bar.baz", []string{"http://10.0.0.2:8080"}},
+		{"carbon.agents.host1.cpuUsage", []string{"http://10.0.0.2:8080"}},
+		{"a", []string{"http://10.0.0.3:8080"}},
+		{"x0", []string{"http://10.0.0.1:8080"}},
+	}
+
+	r := New(servers, instances, 0, 1, 0)
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			got, ok := r.Get(tt.metric)
+			if !ok {
+				t.Fatalf("owner for %v not found", tt.metric)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("unexpected owner for %v, got %v, expected %v", tt.metric, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRingGetReplicationFactor(t *testing.T) {
+	r := New(servers, instances, 0, 2, 0)
+	got, ok := r.Get("foo.bar.baz")
+	if !ok || len(got) != 2 || got[0] != "http://10.0.0.2:8080" || got[1] == got[0] {
+		t.Errorf("unexpected owners %v", got)
+	}
+}
+
+func TestRingKey(t *testing.T) {
+	tests := []struct {
+		keyNodes int
+		metric   string
+		key      string
+		ok       bool
+	}{
+		{0, "foo.bar.baz", "foo.bar.baz", true},
+		{0, "foo.*.baz", "", false},
+		{2, "foo.bar.*", "foo.bar", true},
+		{2, "foo.bar", "foo.bar", true},
+		{2, "foo", "", false},
+		{2, "foo.{bar,baz}.qux", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			r := New(servers, nil, 0, 1, tt.keyNodes)
+			key, ok := r.Key(tt.metric)
+			if key != tt.key || ok != tt.ok {
+				t.Errorf("unexpected key for %v: got (%v, %v), expected (%v, %v)", tt.metric, key, ok, tt.key, tt.ok)
+			}
+		})
+	}
+}
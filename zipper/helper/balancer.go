@@ -0,0 +1,146 @@
+package helper
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// minSlowStartWeight is a share of weight that server gets right after recovery
+const minSlowStartWeight = 0.1
+
+// balancer picks servers of the group by their weights, servers that recently recovered get only part of their weight
+// during slow start
+type balancer struct {
+	mu        sync.Mutex
+	method    types.LBMethod
+	group     string
+	slowStart time.Duration
+	servers   map[string]*balancedServer
+
+	counter int
+}
+
+type balancedServer struct {
+	host     string
+	weight   float64
+	current  float64
+	inflight int
+}
+
+func newBalancer(method types.LBMethod, group string, servers []string, weights map[string]int, slowStart time.Duration) *balancer {
+	b := &balancer{
+		method:    method,
+		group:     group,
+		slowStart: slowStart,
+	}
+	b.setServers(servers, weights)
+	return b
+}
+
+// setServers replaces servers of the balancer, servers that are kept preserve their state
+func (b *balancer) setServers(servers []string, weights map[string]int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := make(map[string]*balancedServer, len(servers))
+	for _, s := range servers {
+		weight, ok := weights[s]
+		if !ok {
+			weight = 1
+		}
+		if old, ok := b.servers[s]; ok {
+			old.weight = float64(weight)
+			kept[s] = old
+			continue
+		}
+		host := s
+		if u, err := url.Parse(s); err == nil {
+			host = u.Host
+		}
+		kept[s] = &balancedServer{host: host, weight: float64(weight)}
+	}
+	b.servers = kept
+}
+
+// weight returns current weight of the server, it grows linearly from minSlowStartWeight during slow start after the
+// server's circuit breaker was closed
+func (b *balancer) weight(s *balancedServer, now time.Time) float64 {
+	if b.slowStart <= 0 {
+		return s.weight
+	}
+	recovered := breakerRecoveredAt(b.group, s.host)
+	if recovered.IsZero() {
+		return s.weight
+	}
+	share := float64(now.Sub(recovered)) / float64(b.slowStart)
+	if share >= 1 {
+		return s.weight
+	}
+	if share < minSlowStartWeight {
+		share = minSlowStartWeight
+	}
+	return s.weight * share
+}
+
+// pick returns one of the servers, prev is avoided if there are other servers with non-zero weight
+func (b *balancer) pick(servers []string, prev string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.counter++
+
+	var best string
+	var bestScore, total float64
+	for i := range servers {
+		// start from different server every time, so equal servers share requests
+		server := servers[(b.counter+i)%len(servers)]
+		s, ok := b.servers[server]
+		if !ok {
+			// server was removed after the list was taken
+			continue
+		}
+		w := b.weight(s, now)
+		if w <= 0 || (server == prev && len(servers) > 1) {
+			continue
+		}
+
+		var score float64
+		if b.method == types.LeastLoadedLB {
+			score = -float64(s.inflight) / w
+		} else {
+			// smooth weighted round-robin
+			s.current += w
+			total += w
+			score = s.current
+		}
+		if best == "" || score > bestScore {
+			best, bestScore = server, score
+		}
+	}
+	if best == "" {
+		return servers[b.counter%len(servers)]
+	}
+	if b.method != types.LeastLoadedLB {
+		b.servers[best].current -= total
+	}
+	return best
+}
+
+// start and done track requests in flight for least loaded balancing
+func (b *balancer) start(server string) {
+	b.mu.Lock()
+	if s, ok := b.servers[server]; ok {
+		s.inflight++
+	}
+	b.mu.Unlock()
+}
+
+func (b *balancer) done(server string) {
+	b.mu.Lock()
+	if s, ok := b.servers[server]; ok {
+		s.inflight--
+	}
+	b.mu.Unlock()
+}
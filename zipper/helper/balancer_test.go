@@ -0,0 +1,87 @@
+package helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestBalancerWeighted(t *testing.T) {
+	servers := []string{"http://a:8080", "http://b:8080"}
+	b := newBalancer(types.WeightedRoundRobinLB, "weighted", servers, map[string]int{"http://b:8080": 3}, 0)
+
+	picks := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		picks[b.pick(servers, "")]++
+	}
+	if picks["http://a:8080"] != 100 || picks["http://b:8080"] != 300 {
+		t.Errorf("requests aren't spread by weights: %v", picks)
+	}
+
+	if s := b.pick(servers, "http://b:8080"); s != "http://a:8080" {
+		t.Errorf("server of previous try shouldn't be picked, got %v", s)
+	}
+}
+
+func TestBalancerLeastLoaded(t *testing.T) {
+	servers := []string{"http://a:8080", "http://b:8080", "http://c:8080"}
+	b := newBalancer(types.LeastLoadedLB, "leastloaded", servers, map[string]int{"http://c:8080": 2}, 0)
+
+	b.start("http://a:8080")
+	b.start("http://c:8080")
+	if s := b.pick(servers, ""); s != "http://b:8080" {
+		t.Errorf("expected idle server, got %v", s)
+	}
+	b.start("http://b:8080")
+	// c has 1 request per 2 weight
+	if s := b.pick(servers, ""); s != "http://c:8080" {
+		t.Errorf("expected least loaded server by weight, got %v", s)
+	}
+	b.done("http://a:8080")
+	if s := b.pick(servers, ""); s != "http://a:8080" {
+		t.Errorf("expected server with finished request, got %v", s)
+	}
+}
+
+func TestBalancerSlowStart(t *testing.T) {
+	servers := []string{"http://a:8080", "http://b:8080"}
+	b := newBalancer(types.WeightedRoundRobinLB, "slowstart", servers, nil, time.Minute)
+
+	br := newBreaker(types.CircuitBreaker{ErrorRate: 1}, "slowstart", "b:8080")
+	br.recoveredAt = time.Now().Add(-15 * time.Second)
+
+	picks := make(map[string]int)
+	for i := 0; i < 500; i++ {
+		picks[b.pick(servers, "")]++
+	}
+	// recovered server has quarter of its weight
+	if picks["http://b:8080"] < 90 || picks["http://b:8080"] > 110 {
+		t.Errorf("recovered server should get reduced share of requests: %v", picks)
+	}
+
+	br.recoveredAt = time.Now().Add(-time.Minute)
+	picks = make(map[string]int)
+	for i := 0; i < 500; i++ {
+		picks[b.pick(servers, "")]++
+	}
+	if picks["http://a:8080"] != 250 {
+		t.Errorf("server should get full weight after slow start: %v", picks)
+	}
+}
+
+func TestBalancerSetServers(t *testing.T) {
+	servers := []string{"http://a:8080", "http://b:8080"}
+	b := newBalancer(types.LeastLoadedLB, "changed", servers, nil, 0)
+	b.start("http://a:8080")
+
+	b.setServers([]string{"http://a:8080", "http://c:8080"}, nil)
+	if s := b.pick([]string{"http://a:8080", "http://c:8080"}, ""); s != "http://c:8080" {
+		t.Errorf("load of kept server is lost, got %v", s)
+	}
+	// list of servers could be taken before they were changed
+	if s := b.pick(servers, ""); s != "http://a:8080" {
+		t.Errorf("removed server shouldn't be picked, got %v", s)
+	}
+	b.done("http://b:8080")
+}
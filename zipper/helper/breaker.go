@@ -0,0 +1,261 @@
+package helper
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// CircuitBreakerStatus is a state of circuit breaker of a backend server
+type CircuitBreakerStatus struct {
+	Group    string    `json:"group"`
+	Server   string    `json:"server"`
+	State    string    `json:"state"`
+	Requests int       `json:"requests"`
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+}
+
+// breakerRejected is a number of requests that weren't sent because circuit breaker was open
+var breakerRejected int64
+
+// breakers of all backend servers by group and host, newer breakers replace old ones after config reload
+var breakers struct {
+	sync.Mutex
+	m map[[2]string]*breaker
+}
+
+// GetCircuitBreakers returns states of all circuit breakers sorted by group and server
+func GetCircuitBreakers() []CircuitBreakerStatus {
+	breakers.Lock()
+	res := make([]CircuitBreakerStatus, 0, len(breakers.m))
+	for _, b := range breakers.m {
+		res = append(res, b.status())
+	}
+	breakers.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Group != res[j].Group {
+			return res[i].Group < res[j].Group
+		}
+		return res[i].Server < res[j].Server
+	})
+	return res
+}
+
+// GetCircuitBreakersOpen returns amount of servers that don't get requests because of circuit breakers
+func GetCircuitBreakersOpen() int {
+	var open int
+	for _, s := range GetCircuitBreakers() {
+		if s.State != breakerClosed {
+			open++
+		}
+	}
+	return open
+}
+
+// GetCircuitBreakerRejected returns amount of requests that weren't sent because circuit breaker was open
+func GetCircuitBreakerRejected() int64 {
+	return atomic.LoadInt64(&breakerRejected)
+}
+
+// breakerRecoveredAt returns when circuit breaker of the server was closed after being open last time, zero time if it
+// never was open
+func breakerRecoveredAt(group, server string) time.Time {
+	breakers.Lock()
+	b, ok := breakers.m[[2]string{group, server}]
+	breakers.Unlock()
+	if !ok {
+		return time.Time{}
+	}
+	b.Lock()
+	defer b.Unlock()
+	return b.recoveredAt
+}
+
+// breaker counts failed requests to the server in tumbling windows
+type breaker struct {
+	sync.Mutex
+	config types.CircuitBreaker
+	group  string
+	server string
+
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	recoveredAt time.Time
+	probing     bool
+}
+
+func newBreaker(config types.CircuitBreaker, group, server string) *breaker {
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Window <= 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 5 * time.Second
+	}
+
+	b := &breaker{
+		config:      config,
+		group:       group,
+		server:      server,
+		state:       breakerClosed,
+		windowStart: time.Now(),
+	}
+
+	breakers.Lock()
+	if breakers.m == nil {
+		breakers.m = make(map[[2]string]*breaker)
+	}
+	breakers.m[[2]string{group, server}] = b
+	breakers.Unlock()
+	return b
+}
+
+// allow checks if request could be sent, in half-open state only single probe request is allowed
+func (b *breaker) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// done records result of the request
+func (b *breaker) done(failed bool) {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.state = breakerOpen
+			b.openedAt = now
+			return
+		}
+		b.state = breakerClosed
+		b.windowStart = now
+		b.recoveredAt = now
+		b.requests, b.failures = 0, 0
+		return
+	}
+
+	if now.Sub(b.windowStart) > b.config.Window {
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if b.state == breakerClosed && b.requests >= b.config.MinRequests && float64(b.failures) >= b.config.ErrorRate*float64(b.requests) {
+		b.state = breakerOpen
+		b.openedAt = now
+	}
+}
+
+// abort releases probe without result
+func (b *breaker) abort() {
+	b.Lock()
+	b.probing = false
+	b.Unlock()
+}
+
+func (b *breaker) status() CircuitBreakerStatus {
+	b.Lock()
+	defer b.Unlock()
+	s := CircuitBreakerStatus{
+		Group:    b.group,
+		Server:   b.server,
+		State:    b.state,
+		Requests: b.requests,
+		Failures: b.failures,
+	}
+	if b.state != breakerClosed {
+		s.OpenedAt = b.openedAt
+	}
+	return s
+}
+
+// breakerTransport fails requests to servers with open circuit breaker immediately. Errors, 5xx responses and
+// requests that got no response in slowRequest time are failures
+type breakerTransport struct {
+	http.RoundTripper
+	config types.CircuitBreaker
+	group  string
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakerTransport(rt http.RoundTripper, config types.CircuitBreaker, group string) *breakerTransport {
+	return &breakerTransport{
+		RoundTripper: rt,
+		config:       config,
+		group:        group,
+		breakers:     make(map[string]*breaker),
+	}
+}
+
+func (t *breakerTransport) breaker(host string) *breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = newBreaker(t.config, t.group, host)
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breaker(req.URL.Host)
+	if !b.allow() {
+		atomic.AddInt64(&breakerRejected, 1)
+		return nil, types.ErrCircuitOpen
+	}
+
+	t0 := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	// requests canceled by carbonapi itself tell nothing about the server
+	if err != nil && req.Context().Err() == context.Canceled {
+		b.abort()
+		return resp, err
+	}
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	if t.config.SlowRequest > 0 && time.Since(t0) > t.config.SlowRequest {
+		failed = true
+	}
+	b.done(failed)
+	return resp, err
+}
@@ -0,0 +1,104 @@
+package helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestBreakerStates(t *testing.T) {
+	b := newBreaker(types.CircuitBreaker{ErrorRate: 0.5, MinRequests: 4, OpenTimeout: 20 * time.Millisecond}, "states", "server")
+
+	for i := 0; i < 3; i++ {
+		b.done(true)
+	}
+	if !b.allow() {
+		t.Fatal("breaker shouldn't open before minRequests")
+	}
+	b.done(false)
+	if b.allow() {
+		t.Fatal("breaker should open when error rate is reached")
+	}
+	if s := b.status(); s.State != breakerOpen || s.Failures != 3 || s.Requests != 4 {
+		t.Errorf("unexpected status %+v", s)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("probe request should be allowed after openTimeout")
+	}
+	if b.allow() {
+		t.Fatal("only single probe request should be allowed")
+	}
+	b.done(true)
+	if b.allow() {
+		t.Fatal("failed probe should open breaker again")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("probe request should be allowed after openTimeout")
+	}
+	b.done(false)
+	if s := b.status(); s.State != breakerClosed || s.Requests != 0 {
+		t.Errorf("successful probe should close breaker, got %+v", s)
+	}
+}
+
+func TestBreakerTransport(t *testing.T) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.URL.Path == "/slow" {
+			time.Sleep(30 * time.Millisecond)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: newBreakerTransport(http.DefaultTransport, types.CircuitBreaker{
+		ErrorRate:   1,
+		MinRequests: 2,
+		SlowRequest: 10 * time.Millisecond,
+	}, "transport")}
+
+	for _, path := range []string{"/slow", "/error"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	rejected := GetCircuitBreakerRejected()
+	_, err := client.Get(srv.URL)
+	if e, ok := err.(*url.Error); !ok || e.Err != types.ErrCircuitOpen {
+		t.Errorf("expected %v, got %v", types.ErrCircuitOpen, err)
+	}
+	if n := atomic.LoadInt64(&requests); n != 2 {
+		t.Errorf("request shouldn't be sent to the server, got %v requests", n)
+	}
+	if GetCircuitBreakerRejected() != rejected+1 {
+		t.Error("rejected request isn't counted")
+	}
+
+	u, _ := url.Parse(srv.URL)
+	var found bool
+	for _, s := range GetCircuitBreakers() {
+		if s.Group == "transport" && s.Server == u.Host {
+			found = true
+			if s.State != breakerOpen {
+				t.Errorf("unexpected status %+v", s)
+			}
+		}
+	}
+	if !found {
+		t.Error("breaker status isn't reported")
+	}
+}
@@ -8,11 +8,14 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/go-graphite/carbonapi/limiter"
 	util "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/errors"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	"go.uber.org/zap"
 )
@@ -20,39 +23,145 @@ import (
 type ServerResponse struct {
 	Server   string
 	Response []byte
+	// Encoding is a compression applied to the response by carbonapi server, see httpHeaders.HeaderEncoding
+	Encoding string
 }
 
 type HttpQuery struct {
 	groupName string
-	servers   []string
 	maxTries  int
+	retry     types.Retry
 	limiter   limiter.ServerLimiter
 	client    *http.Client
 	encoding  string
+	// headers are added to every request
+	headers map[string]string
+
+	// mu protects servers and their zones, that could be changed by SetServers
+	mu      sync.RWMutex
+	servers []string
+	zone    string
+	// servers in the same zone are tried first, others only after they fail
+	local  []string
+	remote []string
+
+	// balancer is used for weighted and least loaded balancing, nil means round-robin
+	balancer *balancer
+	weights  map[string]int
 
 	counter uint64
 }
 
-func NewHttpQuery(groupName string, servers []string, maxTries int, limiter limiter.ServerLimiter, client *http.Client, encoding string) *HttpQuery {
+func NewHttpQuery(groupName string, servers []string, maxTries int, retry *types.Retry, limiter limiter.ServerLimiter, client *http.Client, encoding string) *HttpQuery {
+	if retry == nil {
+		retry = &types.Retry{}
+	}
 	return &HttpQuery{
 		groupName: groupName,
 		servers:   servers,
 		maxTries:  maxTries,
+		retry:     *retry,
 		limiter:   limiter,
 		client:    client,
 		encoding:  encoding,
 	}
 }
 
-func (c *HttpQuery) pickServer(logger *zap.Logger) string {
-	if len(c.servers) == 1 {
+// SetHeader adds header to every request to servers
+func (c *HttpQuery) SetHeader(name, value string) {
+	if c.headers == nil {
+		c.headers = make(map[string]string)
+	}
+	c.headers[name] = value
+}
+
+// SetZone makes servers in the zone preferred, servers in other zones get requests only when tries of preferred ones
+// fail. Servers with unknown zone are considered to be in other zones
+func (c *HttpQuery) SetZone(zone string, serverZones map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.zone = zone
+	c.splitZones(serverZones)
+}
+
+// SetServers replaces servers of the group, requests that are already running aren't affected. State of the servers
+// that are kept (e.x. their load) is preserved
+func (c *HttpQuery) SetServers(servers []string, serverZones map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.servers = servers
+	c.splitZones(serverZones)
+	if c.balancer != nil {
+		c.balancer.setServers(servers, c.weights)
+	}
+}
+
+// Servers returns current servers of the group
+func (c *HttpQuery) Servers() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.servers
+}
+
+// splitZones splits servers to local and remote ones, mu must be held
+func (c *HttpQuery) splitZones(serverZones map[string]string) {
+	c.local, c.remote = nil, nil
+	if c.zone == "" {
+		return
+	}
+	var local, remote []string
+	for _, s := range c.servers {
+		if serverZones[s] == c.zone {
+			local = append(local, s)
+		} else {
+			remote = append(remote, s)
+		}
+	}
+	if len(local) > 0 && len(remote) > 0 {
+		c.local, c.remote = local, remote
+	}
+}
+
+// SetLoadBalancing sets the way requests are spread between servers, weights and slowStart are used by weighted and
+// leastloaded methods
+func (c *HttpQuery) SetLoadBalancing(lbMethod string, weights map[string]int, slowStart time.Duration) {
+	var method types.LBMethod
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := method.FromString(lbMethod); err != nil || (method != types.WeightedRoundRobinLB && method != types.LeastLoadedLB) {
+		c.balancer = nil
+		return
+	}
+	c.weights = weights
+	c.balancer = newBalancer(method, c.groupName, c.servers, weights, slowStart)
+}
+
+// pickServer returns server for the try, prev is a server of previous try
+func (c *HttpQuery) pickServer(logger *zap.Logger, try int, prev string) string {
+	c.mu.RLock()
+	servers := c.servers
+	if c.local != nil {
+		servers = c.local
+		if try >= len(c.local) {
+			servers = c.remote
+		}
+	}
+	c.mu.RUnlock()
+	if len(servers) == 1 {
 		// No need to do heavy operations here
-		return c.servers[0]
+		return servers[0]
 	}
 	logger = logger.With(zap.String("function", "picker"))
+	if c.balancer != nil {
+		srv := c.balancer.pick(servers, prev)
+		logger.Debug("picked",
+			zap.String("server", srv),
+		)
+		return srv
+	}
 	counter := atomic.AddUint64(&(c.counter), 1)
-	idx := counter % uint64(len(c.servers))
-	srv := c.servers[int(idx)]
+	idx := counter % uint64(len(servers))
+	srv := servers[int(idx)]
 	logger.Debug("picked",
 		zap.Uint64("counter", counter),
 		zap.Uint64("idx", idx),
@@ -62,15 +171,19 @@ func (c *HttpQuery) pickServer(logger *zap.Logger) string {
 	return srv
 }
 
-func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri string, r types.Request) (*ServerResponse, error) {
+// doRequest sends request to the server, returns if failed request could be retried
+func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server string, uri string, r types.Request) (*ServerResponse, bool, error) {
+	if c.retry.TryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.retry.TryTimeout)
+		defer cancel()
+	}
 	logger = logger.With(
 		zap.String("function", "HttpQuery.doRequest"),
 	)
-	server := c.pickServer(logger)
-
 	u, err := url.Parse(server + uri)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	var reader io.Reader
@@ -78,7 +191,7 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 	if r != nil {
 		body, err = r.Marshal()
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		if body != nil {
 			reader = bytes.NewReader(body)
@@ -92,8 +205,11 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 
 	req, err := http.NewRequest("GET", u.String(), reader)
 	req.Header.Set("Accept", c.encoding)
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	req = util.MarshalPassHeaders(ctx, util.MarshalCtx(ctx, util.MarshalCtx(ctx, req, util.HeaderUUIDZipper), util.HeaderUUIDAPI))
 
@@ -103,11 +219,16 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 	err = c.limiter.Enter(ctx, server)
 	if err != nil {
 		logger.Debug("timeout waiting for a slot")
-		return nil, err
+		return nil, false, err
 	}
 
 	defer c.limiter.Leave(ctx, server)
 
+	if c.balancer != nil {
+		c.balancer.start(server)
+		defer c.balancer.done(server)
+	}
+
 	logger.Debug("got slot for server",
 		zap.String("name", server),
 	)
@@ -120,7 +241,7 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 		logger.Error("error fetching result",
 			zap.Error(err),
 		)
-		return nil, err
+		return nil, isRetryableTransportError(err), err
 	}
 	defer resp.Body.Close()
 
@@ -129,34 +250,52 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 		logger.Error("error reading body",
 			zap.Error(err),
 		)
-		return nil, err
+		return nil, isRetryableTransportError(err), err
 	}
 
 	if resp.StatusCode >= http.StatusInternalServerError {
 		logger.Info("status not ok",
 			zap.Int("status_code", resp.StatusCode),
 		)
-		return nil, fmt.Errorf(types.ErrFailedToFetchFmt, c.groupName, resp.StatusCode, string(body))
+		return nil, true, fmt.Errorf(types.ErrFailedToFetchFmt, c.groupName, resp.StatusCode, string(body))
 	}
 	logger.Debug("got response")
 
-	return &ServerResponse{Server: server, Response: body}, nil
+	return &ServerResponse{Server: server, Response: body, Encoding: resp.Header.Get(httpHeaders.HeaderEncoding)}, false, nil
 }
 
+// DoQuery sends request to the servers of the group, failed requests are retried according to retry policy and
+// global retry budget
 func (c *HttpQuery) DoQuery(ctx context.Context, logger *zap.Logger, uri string, r types.Request) (*ServerResponse, *errors.Errors) {
 	maxTries := c.maxTries
-	if len(c.servers) > maxTries {
-		maxTries = len(c.servers)
+	if n := len(c.Servers()); n > maxTries {
+		maxTries = n
+	}
+	if c.retry.TotalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.retry.TotalTimeout)
+		defer cancel()
 	}
 
+	budget.request()
 	var e errors.Errors
+	var server string
 	for try := 0; try < maxTries; try++ {
-		res, err := c.doRequest(ctx, logger, uri, r)
+		if try > 0 && !budget.retry() {
+			logger.Debug("retry budget is exhausted")
+			return nil, &e
+		}
+		server = c.pickServer(logger, try, server)
+		res, retryable, err := c.doRequest(ctx, logger, server, uri, r)
 		if err != nil {
 			logger.Debug("have errors",
 				zap.Error(err),
+				zap.Bool("retryable", retryable),
 			)
 			e.Add(err)
+			if !retryable || ctx.Err() != nil {
+				return nil, &e
+			}
 			continue
 		}
 
@@ -0,0 +1,91 @@
+package helper
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// RetryStats contains statistics of retries to all http-based backends
+type RetryStats struct {
+	// Retries is a number of retried requests
+	Retries int64
+	// BudgetExhausted is a number of failed requests that weren't retried because of retry budget
+	BudgetExhausted int64
+}
+
+var retryStats RetryStats
+
+// GetRetryStats returns snapshot of current retry statistics
+func GetRetryStats() RetryStats {
+	return RetryStats{
+		Retries:         atomic.LoadInt64(&retryStats.Retries),
+		BudgetExhausted: atomic.LoadInt64(&retryStats.BudgetExhausted),
+	}
+}
+
+// retryBudget counts requests and retries in one second windows
+type retryBudget struct {
+	sync.Mutex
+	ratio        float64
+	minPerSecond float64
+
+	window   int64
+	requests int64
+	retries  int64
+}
+
+// budget is shared by all backend groups
+var budget = &retryBudget{}
+
+// SetRetryBudget replaces global retry budget, zero budget doesn't limit retries
+func SetRetryBudget(config types.RetryBudget) {
+	budget.Lock()
+	budget.ratio = config.Ratio
+	budget.minPerSecond = float64(config.MinPerSecond)
+	budget.Unlock()
+}
+
+func (b *retryBudget) roll() {
+	if now := time.Now().Unix(); now != b.window {
+		b.window = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+// request records the first try of request
+func (b *retryBudget) request() {
+	b.Lock()
+	b.roll()
+	b.requests++
+	b.Unlock()
+}
+
+// retry checks if there is budget left for one more retry and spends it
+func (b *retryBudget) retry() bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.ratio > 0 || b.minPerSecond > 0 {
+		b.roll()
+		if float64(b.retries) >= b.minPerSecond+b.ratio*float64(b.requests) {
+			atomic.AddInt64(&retryStats.BudgetExhausted, 1)
+			return false
+		}
+		b.retries++
+	}
+	atomic.AddInt64(&retryStats.Retries, 1)
+	return true
+}
+
+// isRetryableTransportError checks if error returned by http client could be fixed by retry. Request shaping errors
+// are caused by carbonapi itself, so they aren't
+func isRetryableTransportError(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	return err != types.ErrBackendQueueFull && err != types.ErrResponseTooLarge
+}
@@ -0,0 +1,179 @@
+package helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	"go.uber.org/zap"
+)
+
+func newTestHttpQuery(t *testing.T, servers []string, maxTries int, retry *types.Retry, shaping *types.Shaping) *HttpQuery {
+	maxIdleConnsPerHost := 10
+	keepAlive := 30 * time.Second
+	client, err := NewHttpClient(types.BackendV2{
+		Timeouts:            &types.Timeouts{Connect: 100 * time.Millisecond},
+		MaxIdleConnsPerHost: &maxIdleConnsPerHost,
+		KeepAliveInterval:   &keepAlive,
+		Shaping:             shaping,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHttpQuery("test", servers, maxTries, retry, limiter.NoopLimiter{}, client, "")
+}
+
+func TestDoQueryRetries(t *testing.T) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&requests, 1)
+		switch r.URL.Path {
+		case "/flaky":
+			if n%2 == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/slow":
+			if n%2 == 1 {
+				time.Sleep(100 * time.Millisecond)
+			}
+		case "/large":
+			w.Write(make([]byte, 200))
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	SetRetryBudget(types.RetryBudget{})
+
+	tests := []struct {
+		name             string
+		uri              string
+		retry            *types.Retry
+		expectedRequests int64
+		expectedOk       bool
+	}{
+		{
+			name:             "5xx is retried",
+			uri:              "/flaky",
+			expectedRequests: 2,
+			expectedOk:       true,
+		},
+		{
+			name:             "try timeout is retried",
+			uri:              "/slow",
+			retry:            &types.Retry{TryTimeout: 20 * time.Millisecond},
+			expectedRequests: 2,
+			expectedOk:       true,
+		},
+		{
+			name:             "total timeout stops retries",
+			uri:              "/slow",
+			retry:            &types.Retry{TotalTimeout: 20 * time.Millisecond},
+			expectedRequests: 1,
+		},
+		{
+			name:             "too large response isn't retried",
+			uri:              "/large",
+			expectedRequests: 1,
+		},
+		{
+			name:             "max tries",
+			uri:              "/broken",
+			expectedRequests: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestHttpQuery(t, []string{srv.URL}, 3, tt.retry, &types.Shaping{MaxResponseSize: 100})
+			atomic.StoreInt64(&requests, 0)
+			res, e := q.DoQuery(context.Background(), zap.NewNop(), tt.uri, nil)
+			if tt.expectedOk && (e != nil || res == nil || string(res.Response) != "ok") {
+				t.Errorf("unexpected result %v, errors %v", res, e)
+			}
+			if !tt.expectedOk && e == nil {
+				t.Errorf("expected errors, got %v", res)
+			}
+			if n := atomic.LoadInt64(&requests); n != tt.expectedRequests {
+				t.Errorf("expected %v requests, got %v", tt.expectedRequests, n)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := &retryBudget{ratio: 0.5, minPerSecond: 1}
+	// requests shouldn't cross the second boundary
+	for time.Now().Nanosecond() > 900*int(time.Millisecond) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.request()
+	b.request()
+	// 1 + 0.5 * 2 retries are allowed
+	if !b.retry() || !b.retry() {
+		t.Fatal("retries within budget are not allowed")
+	}
+	exhausted := GetRetryStats().BudgetExhausted
+	if b.retry() {
+		t.Error("retry over budget is allowed")
+	}
+	if GetRetryStats().BudgetExhausted != exhausted+1 {
+		t.Error("exhausted budget isn't counted")
+	}
+
+	unlimited := &retryBudget{}
+	for i := 0; i < 10; i++ {
+		if !unlimited.retry() {
+			t.Fatal("zero budget shouldn't limit retries")
+		}
+	}
+}
+
+func TestZonePreference(t *testing.T) {
+	var localRequests, remoteRequests int64
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&localRequests, 1)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("local"))
+	}))
+	defer local.Close()
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&remoteRequests, 1)
+		w.Write([]byte("remote"))
+	}))
+	defer remote.Close()
+	SetRetryBudget(types.RetryBudget{})
+
+	q := newTestHttpQuery(t, []string{remote.URL, local.URL}, 2, nil, nil)
+	q.SetZone("a", map[string]string{local.URL: "a", remote.URL: "b"})
+
+	for i := 0; i < 4; i++ {
+		res, e := q.DoQuery(context.Background(), zap.NewNop(), "/", nil)
+		if e != nil || string(res.Response) != "local" {
+			t.Fatalf("expected response from the same zone, got %v, errors %v", res, e)
+		}
+	}
+	if remoteRequests != 0 {
+		t.Errorf("servers in other zones shouldn't get requests, got %v", remoteRequests)
+	}
+
+	res, e := q.DoQuery(context.Background(), zap.NewNop(), "/broken", nil)
+	if e != nil || string(res.Response) != "remote" {
+		t.Errorf("expected fallback to other zone, got %v, errors %v", res, e)
+	}
+	if localRequests != 5 || remoteRequests != 1 {
+		t.Errorf("unexpected requests: %v local, %v remote", localRequests, remoteRequests)
+	}
+}
@@ -0,0 +1,174 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// ShapingStats contains request shaping statistics for all http-based backends
+type ShapingStats struct {
+	// Queued is a number of requests that are waiting for concurrency or QPS limits now
+	Queued int64
+	// Rejected is a number of requests rejected because too many requests were waiting
+	Rejected int64
+	// Throttled is a number of requests delayed by QPS limit
+	Throttled int64
+	// TooLarge is a number of responses that exceeded maxResponseSize
+	TooLarge int64
+}
+
+var shapingStats ShapingStats
+
+// GetShapingStats returns snapshot of current request shaping statistics
+func GetShapingStats() ShapingStats {
+	return ShapingStats{
+		Queued:    atomic.LoadInt64(&shapingStats.Queued),
+		Rejected:  atomic.LoadInt64(&shapingStats.Rejected),
+		Throttled: atomic.LoadInt64(&shapingStats.Throttled),
+		TooLarge:  atomic.LoadInt64(&shapingStats.TooLarge),
+	}
+}
+
+// shaper enforces limits of backend group. Request holds concurrency slot until its response body is closed
+type shaper struct {
+	// queued is the first field to be 64-bit aligned for atomic operations
+	queued int64
+
+	slots           chan struct{}
+	interval        time.Duration
+	maxQueue        int64
+	maxResponseSize int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newShaper returns nil if there are no limits
+func newShaper(config *types.Shaping) *shaper {
+	if config == nil || (config.MaxConcurrent <= 0 && config.MaxQPS <= 0 && config.MaxResponseSize <= 0) {
+		return nil
+	}
+
+	s := &shaper{
+		maxQueue:        int64(config.MaxQueue),
+		maxResponseSize: config.MaxResponseSize,
+	}
+	if config.MaxConcurrent > 0 {
+		s.slots = make(chan struct{}, config.MaxConcurrent)
+	}
+	if config.MaxQPS > 0 {
+		s.interval = time.Duration(float64(time.Second) / config.MaxQPS)
+	}
+	return s
+}
+
+// enter waits until request could be sent according to QPS and concurrency limits
+func (s *shaper) enter(ctx context.Context) error {
+	if s.slots == nil && s.interval == 0 {
+		return nil
+	}
+
+	if queued := atomic.AddInt64(&s.queued, 1); s.maxQueue > 0 && queued > s.maxQueue {
+		atomic.AddInt64(&s.queued, -1)
+		atomic.AddInt64(&shapingStats.Rejected, 1)
+		return types.ErrBackendQueueFull
+	}
+	atomic.AddInt64(&shapingStats.Queued, 1)
+	defer func() {
+		atomic.AddInt64(&s.queued, -1)
+		atomic.AddInt64(&shapingStats.Queued, -1)
+	}()
+
+	if s.interval > 0 {
+		s.mu.Lock()
+		now := time.Now()
+		at := s.next
+		if at.Before(now) {
+			at = now
+		}
+		s.next = at.Add(s.interval)
+		s.mu.Unlock()
+
+		if wait := at.Sub(now); wait > 0 {
+			atomic.AddInt64(&shapingStats.Throttled, 1)
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *shaper) leave() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// shapingTransport sends requests according to limits of backend group
+type shapingTransport struct {
+	http.RoundTripper
+	shaper *shaper
+}
+
+func (t shapingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.shaper.enter(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		t.shaper.leave()
+		return nil, err
+	}
+	if t.shaper.maxResponseSize > 0 && resp.ContentLength > t.shaper.maxResponseSize {
+		resp.Body.Close()
+		t.shaper.leave()
+		atomic.AddInt64(&shapingStats.TooLarge, 1)
+		return nil, types.ErrResponseTooLarge
+	}
+	resp.Body = &shapedBody{ReadCloser: resp.Body, shaper: t.shaper}
+	return resp, nil
+}
+
+// shapedBody frees concurrency slot when it's closed and fails reading after maxResponseSize bytes
+type shapedBody struct {
+	io.ReadCloser
+	shaper *shaper
+	read   int64
+	once   sync.Once
+}
+
+func (b *shapedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.shaper.maxResponseSize > 0 && b.read > b.shaper.maxResponseSize {
+		atomic.AddInt64(&shapingStats.TooLarge, 1)
+		return n, types.ErrResponseTooLarge
+	}
+	return n, err
+}
+
+func (b *shapedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.shaper.leave)
+	return err
+}
@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestShaperQueue(t *testing.T) {
+	s := newShaper(&types.Shaping{MaxConcurrent: 1, MaxQueue: 1})
+	ctx := context.Background()
+
+	if err := s.enter(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entered := make(chan error)
+	go func() {
+		entered <- s.enter(ctx)
+	}()
+	for atomic.LoadInt64(&s.queued) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rejected := GetShapingStats().Rejected
+	if err := s.enter(ctx); err != types.ErrBackendQueueFull {
+		t.Errorf("request over queue limit should be rejected, got %v", err)
+	}
+	if GetShapingStats().Rejected != rejected+1 {
+		t.Error("rejected request isn't counted")
+	}
+
+	s.leave()
+	if err := <-entered; err != nil {
+		t.Errorf("queued request failed: %v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := s.enter(timeout); err == nil {
+		t.Error("request should wait for the slot until timeout")
+	}
+}
+
+func TestShaperQPS(t *testing.T) {
+	s := newShaper(&types.Shaping{MaxQPS: 100})
+	ctx := context.Background()
+
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := s.enter(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.leave()
+	}
+	if d := time.Since(t0); d < 40*time.Millisecond {
+		t.Errorf("5 requests at 100 qps should take at least 40ms, took %v", d)
+	}
+}
+
+func TestShapingTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// no content length is known in advance
+			w.Write([]byte(strings.Repeat("x", 100)))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	maxIdleConnsPerHost := 10
+	keepAlive := 30 * time.Second
+	client, err := NewHttpClient(types.BackendV2{
+		Timeouts:            &types.Timeouts{Connect: 100 * time.Millisecond},
+		MaxIdleConnsPerHost: &maxIdleConnsPerHost,
+		KeepAliveInterval:   &keepAlive,
+		Shaping:             &types.Shaping{MaxConcurrent: 1, MaxResponseSize: 150},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || len(body) != 100 {
+			t.Errorf("unexpected response: %v %v", len(body), err)
+		}
+	}
+
+	tooLarge := GetShapingStats().TooLarge
+	resp, err := client.Get(srv.URL + "/chunked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != types.ErrResponseTooLarge {
+		t.Errorf("expected %v, got %v", types.ErrResponseTooLarge, err)
+	}
+	if GetShapingStats().TooLarge != tooLarge+1 {
+		t.Error("too large response isn't counted")
+	}
+
+	// slot is freed after the failed response
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err = client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// PoolStats contains connection pool statistics for all http-based backends
+type PoolStats struct {
+	NewConnections    int64
+	ReusedConnections int64
+	// ReusedIdleConnections counts reused connections, that were idle in the pool before
+	ReusedIdleConnections int64
+	DialErrors            int64
+}
+
+var poolStats PoolStats
+
+// GetPoolStats returns snapshot of current connection pool statistics
+func GetPoolStats() PoolStats {
+	return PoolStats{
+		NewConnections:        atomic.LoadInt64(&poolStats.NewConnections),
+		ReusedConnections:     atomic.LoadInt64(&poolStats.ReusedConnections),
+		ReusedIdleConnections: atomic.LoadInt64(&poolStats.ReusedIdleConnections),
+		DialErrors:            atomic.LoadInt64(&poolStats.DialErrors),
+	}
+}
+
+var poolTrace = &httptrace.ClientTrace{
+	GotConn: func(info httptrace.GotConnInfo) {
+		if !info.Reused {
+			atomic.AddInt64(&poolStats.NewConnections, 1)
+			return
+		}
+		atomic.AddInt64(&poolStats.ReusedConnections, 1)
+		if info.WasIdle {
+			atomic.AddInt64(&poolStats.ReusedIdleConnections, 1)
+		}
+	},
+	ConnectDone: func(network, addr string, err error) {
+		if err != nil {
+			atomic.AddInt64(&poolStats.DialErrors, 1)
+		}
+	},
+}
+
+// poolTracingTransport counts new and reused (kept alive) connections
+type poolTracingTransport struct {
+	http.RoundTripper
+}
+
+func (t poolTracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.RoundTripper.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), poolTrace)))
+}
+
+// NewHttpClient creates http client for backend group according to its transport, shaping, circuit breaker and TLS settings
+func NewHttpClient(config types.BackendV2) (*http.Client, error) {
+	dialTimeout := config.Timeouts.Connect
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: *config.MaxIdleConnsPerHost,
+	}
+
+	if config.TLS != nil {
+		tlsConfig, err := config.TLS.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if config.Transport != nil {
+		if config.Transport.DialTimeout > 0 {
+			dialTimeout = config.Transport.DialTimeout
+		}
+		transport.MaxIdleConns = config.Transport.MaxIdleConns
+		transport.MaxConnsPerHost = config.Transport.MaxConnsPerHost
+		transport.IdleConnTimeout = config.Transport.IdleConnTimeout
+		transport.ForceAttemptHTTP2 = config.Transport.HTTP2
+		if config.Transport.TLSSessionCacheSize > 0 {
+			if transport.TLSClientConfig == nil {
+				transport.TLSClientConfig = &tls.Config{}
+			}
+			transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(config.Transport.TLSSessionCacheSize)
+		}
+	}
+
+	transport.DialContext = (&net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: *config.KeepAliveInterval,
+		DualStack: true,
+	}).DialContext
+
+	if config.Transports != nil {
+		config.Transports.Add(transport)
+	}
+
+	var roundTripper http.RoundTripper = poolTracingTransport{transport}
+	if config.CircuitBreaker != nil && config.CircuitBreaker.ErrorRate > 0 {
+		roundTripper = newBreakerTransport(roundTripper, *config.CircuitBreaker, config.GroupName)
+	}
+	if s := newShaper(config.Shaping); s != nil {
+		roundTripper = shapingTransport{RoundTripper: roundTripper, shaper: s}
+	}
+
+	return &http.Client{
+		Transport: roundTripper,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package helper
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestNewHttpClient(t *testing.T) {
+	maxIdleConnsPerHost := 10
+	keepAlive := 30 * time.Second
+	config := types.BackendV2{
+		Timeouts:            &types.Timeouts{Connect: 100 * time.Millisecond},
+		MaxIdleConnsPerHost: &maxIdleConnsPerHost,
+		KeepAliveInterval:   &keepAlive,
+		Transport: &types.Transport{
+			MaxIdleConns:        20,
+			MaxConnsPerHost:     5,
+			IdleConnTimeout:     time.Minute,
+			HTTP2:               true,
+			TLSSessionCacheSize: 64,
+		},
+		Transports: &types.Transports{},
+	}
+
+	client, err := NewHttpClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := client.Transport.(poolTracingTransport).RoundTripper.(*http.Transport)
+	if transport.MaxIdleConns != 20 || transport.MaxConnsPerHost != 5 || transport.MaxIdleConnsPerHost != 10 {
+		t.Errorf("unexpected pool limits: %v %v %v", transport.MaxIdleConns, transport.MaxConnsPerHost, transport.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != time.Minute {
+		t.Errorf("unexpected idle timeout: %v", transport.IdleConnTimeout)
+	}
+	if !transport.ForceAttemptHTTP2 {
+		t.Error("http2 is not enabled")
+	}
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.ClientSessionCache == nil {
+		t.Error("tls session cache is not set")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	before := GetPoolStats()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	after := GetPoolStats()
+
+	if n := after.NewConnections - before.NewConnections; n != 1 {
+		t.Errorf("expected 1 new connection, got %v", n)
+	}
+	if n := after.ReusedConnections - before.ReusedConnections; n != 2 {
+		t.Errorf("expected 2 reused connections, got %v", n)
+	}
+
+	// idle connections of closed zipper are dropped, so the next request needs a new one
+	config.Transports.CloseIdleConnections()
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if n := GetPoolStats().NewConnections - after.NewConnections; n != 1 {
+		t.Errorf("expected new connection after closing idle ones, got %v", n)
+	}
+}
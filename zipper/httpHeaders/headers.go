@@ -7,3 +7,16 @@ const (
 	ContentTypeCarbonAPIv3PB = "application/x-carbonapi-v3-pb"
 	ContentTypeCarbonAPIv2PB = "application/x-protobuf"
 )
+
+const (
+	// HeaderAcceptEncoding is sent by carbonapi clients to request compressed fetch response. Servers that don't
+	// support it send plain response
+	HeaderAcceptEncoding = "X-Carbonapi-Accept-Encoding"
+	// HeaderEncoding is set by server to the compression applied to the response
+	HeaderEncoding = "X-Carbonapi-Encoding"
+
+	// EncodingGorilla is a columnar encoding of series with values compressed like Gorilla does
+	EncodingGorilla = "gorilla"
+	// EncodingGzip is gzip of protobuf response
+	EncodingGzip = "gzip"
+)
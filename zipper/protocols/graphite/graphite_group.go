@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"math"
-	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -36,7 +35,6 @@ func init() {
 // RoundRobin is used to connect to backends inside clientGroups, implements BackendServer interface
 type GraphiteGroup struct {
 	groupName string
-	servers   []string
 	protocol  string
 
 	client *http.Client
@@ -57,22 +55,17 @@ func (g *GraphiteGroup) Children() []types.BackendServer {
 func NewWithLimiter(logger *zap.Logger, config types.BackendV2, limiter limiter.ServerLimiter) (types.BackendServer, *errors.Errors) {
 	logger = logger.With(zap.String("type", "graphite"), zap.String("protocol", config.Protocol), zap.String("name", config.GroupName))
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost: *config.MaxIdleConnsPerHost,
-			DialContext: (&net.Dialer{
-				Timeout:   config.Timeouts.Connect,
-				KeepAlive: *config.KeepAliveInterval,
-				DualStack: true,
-			}).DialContext,
-		},
+	httpClient, err := helper.NewHttpClient(config)
+	if err != nil {
+		return nil, errors.Fatalf("failed to create http client: %v", err)
 	}
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, config.Retry, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery.SetZone(config.Zone, config.ServerZones)
+	httpQuery.SetLoadBalancing(config.LBMethod, config.Weights, config.SlowStart)
 
 	c := &GraphiteGroup{
 		groupName:            config.GroupName,
-		servers:              config.Servers,
 		protocol:             config.Protocol,
 		timeout:              *config.Timeouts,
 		maxTries:             *config.MaxTries,
@@ -107,8 +100,13 @@ func (c GraphiteGroup) Name() string {
 	return c.groupName
 }
 
-func (c GraphiteGroup) Backends() []string {
-	return c.servers
+func (c *GraphiteGroup) Backends() []string {
+	return c.httpQuery.Servers()
+}
+
+// SetServers replaces servers of the group, it implements types.ServersSetter
+func (c *GraphiteGroup) SetServers(servers []string, serverZones map[string]string) {
+	c.httpQuery.SetServers(servers, serverZones)
 }
 
 func (c *GraphiteGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, *errors.Errors) {
@@ -242,8 +240,8 @@ func (c *GraphiteGroup) Info(ctx context.Context, request *protov3.MultiMetricsI
 	r.Info = make(map[string]protov3.MultiMetricsInfoResponse)
 	data := protov3.MultiMetricsInfoResponse{}
 	server := c.groupName
-	if len(c.servers) == 1 {
-		server = c.servers[0]
+	if servers := c.httpQuery.Servers(); len(servers) == 1 {
+		server = servers[0]
 	}
 
 	for _, query := range request.Names {
@@ -39,6 +39,7 @@ type ClientGRPCGroup struct {
 	cleanup              func()
 	timeout              types.Timeouts
 	maxMetricsPerRequest int
+	filterPushdown       bool
 
 	client protov3grpc.CarbonV1Client
 	logger *zap.Logger
@@ -87,6 +88,7 @@ func NewClientGRPCGroup(logger *zap.Logger, config types.BackendV2) (types.Backe
 		groupName:            config.GroupName,
 		servers:              config.Servers,
 		maxMetricsPerRequest: config.MaxBatchSize,
+		filterPushdown:       config.FilterPushdown,
 
 		r:       r,
 		cleanup: cleanup,
@@ -117,6 +119,9 @@ func (c *ClientGRPCGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 	}
 	ctx, cancel := context.WithTimeout(ctx, c.timeout.Render)
 	defer cancel()
+	if !c.filterPushdown {
+		request = types.WithoutFilterFunctions(request)
+	}
 
 	res, err := c.client.FetchMetrics(ctx, request)
 	if err != nil {
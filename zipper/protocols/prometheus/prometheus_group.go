@@ -11,7 +11,6 @@ import (
 	"github.com/go-graphite/carbonapi/zipper/metadata"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
-	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -53,7 +52,6 @@ func (s *startDelay) String() string {
 // RoundRobin is used to connect to backends inside clientGroups, implements BackendServer interface
 type PrometheusGroup struct {
 	groupName string
-	servers   []string
 	protocol  string
 
 	client *http.Client
@@ -75,15 +73,9 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, limiter limiter.
 
 	logger.Warn("support for this backend protocol is experimental, use with caution")
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost: *config.MaxIdleConnsPerHost,
-			DialContext: (&net.Dialer{
-				Timeout:   config.Timeouts.Connect,
-				KeepAlive: *config.KeepAliveInterval,
-				DualStack: true,
-			}).DialContext,
-		},
+	httpClient, err := helper.NewHttpClient(config)
+	if err != nil {
+		return nil, errors.Fatalf("failed to create http client: %v", err)
 	}
 
 	step := int64(15)
@@ -139,11 +131,12 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, limiter limiter.
 		}
 	}
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, config.Retry, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery.SetZone(config.Zone, config.ServerZones)
+	httpQuery.SetLoadBalancing(config.LBMethod, config.Weights, config.SlowStart)
 
 	c := &PrometheusGroup{
 		groupName:            config.GroupName,
-		servers:              config.Servers,
 		protocol:             config.Protocol,
 		timeout:              *config.Timeouts,
 		maxTries:             *config.MaxTries,
@@ -184,8 +177,13 @@ func (c PrometheusGroup) Name() string {
 	return c.groupName
 }
 
-func (c PrometheusGroup) Backends() []string {
-	return c.servers
+func (c *PrometheusGroup) Backends() []string {
+	return c.httpQuery.Servers()
+}
+
+// SetServers replaces servers of the group, it implements types.ServersSetter
+func (c *PrometheusGroup) SetServers(servers []string, serverZones map[string]string) {
+	c.httpQuery.SetServers(servers, serverZones)
 }
 
 func (c *PrometheusGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, *errors.Errors) {
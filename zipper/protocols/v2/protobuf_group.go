@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"math"
-	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -59,19 +58,15 @@ func (c *ClientProtoV2Group) Children() []types.BackendServer {
 func NewWithLimiter(logger *zap.Logger, config types.BackendV2, l limiter.ServerLimiter) (types.BackendServer, *errors.Errors) {
 	logger = logger.With(zap.String("type", "protoV2Group"), zap.String("name", config.GroupName))
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost: *config.MaxIdleConnsPerHost,
-			DialContext: (&net.Dialer{
-				Timeout:   config.Timeouts.Connect,
-				KeepAlive: *config.KeepAliveInterval,
-				DualStack: true,
-			}).DialContext,
-		},
+	httpClient, err := helper.NewHttpClient(config)
+	if err != nil {
+		return nil, errors.Fatalf("failed to create http client: %v", err)
 	}
 
 	httpLimiter := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, httpLimiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, config.Retry, httpLimiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery.SetZone(config.Zone, config.ServerZones)
+	httpQuery.SetLoadBalancing(config.LBMethod, config.Weights, config.SlowStart)
 
 	c := &ClientProtoV2Group{
 		groupName:            config.GroupName,
@@ -370,8 +365,33 @@ func (c *ClientProtoV2Group) TagValues(ctx context.Context, query string, limit
 	return c.doTagQuery(ctx, false, query, limit)
 }
 
+// List returns names of all metrics of the backend, it's served by go-carbon's /metrics/list/ handler
 func (c *ClientProtoV2Group) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, *errors.Errors) {
-	return nil, nil, errors.FromErr(types.ErrNotImplementedYet)
+	logger := c.logger.With(zap.String("type", "list"))
+	stats := &types.Stats{}
+	rewrite, _ := url.Parse("http://127.0.0.1/metrics/list/")
+
+	v := url.Values{
+		"format": []string{format},
+	}
+	rewrite.RawQuery = v.Encode()
+
+	res, e := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+	if e != nil {
+		return nil, stats, e
+	}
+	if res == nil {
+		return nil, stats, errors.FromErrNonFatal(types.ErrNoResponseFetched)
+	}
+
+	var r protov2.ListMetricsResponse
+	err := r.Unmarshal(res.Response)
+	if err != nil {
+		return nil, stats, errors.FromErrNonFatal(err)
+	}
+	stats.MemoryUsage = int64(r.Size())
+
+	return &protov3.ListMetricsResponse{Metrics: r.Metrics}, stats, nil
 }
 func (c *ClientProtoV2Group) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, *errors.Errors) {
 	return nil, nil, errors.FromErr(types.ErrNotImplementedYet)
@@ -1,12 +1,16 @@
 package v3
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
-	"net"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 
+	exprTypes "github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/zipper/errors"
 	"github.com/go-graphite/carbonapi/zipper/helper"
@@ -36,7 +40,6 @@ func init() {
 // RoundRobin is used to connect to backends inside clientGroups, implements BackendServer interface
 type ClientProtoV3Group struct {
 	groupName string
-	servers   []string
 
 	client *http.Client
 
@@ -45,6 +48,7 @@ type ClientProtoV3Group struct {
 	timeout              types.Timeouts
 	maxTries             int
 	maxMetricsPerRequest int
+	filterPushdown       bool
 
 	httpQuery *helper.HttpQuery
 }
@@ -66,27 +70,30 @@ func New(logger *zap.Logger, config types.BackendV2) (types.BackendServer, *erro
 }
 
 func NewWithLimiter(logger *zap.Logger, config types.BackendV2, limiter limiter.ServerLimiter) (types.BackendServer, *errors.Errors) {
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost: *config.MaxIdleConnsPerHost,
-			DialContext: (&net.Dialer{
-				Timeout:   config.Timeouts.Connect,
-				KeepAlive: *config.KeepAliveInterval,
-				DualStack: true,
-			}).DialContext,
-		},
+	httpClient, err := helper.NewHttpClient(config)
+	if err != nil {
+		return nil, errors.Fatalf("failed to create http client: %v", err)
 	}
 
 	logger = logger.With(zap.String("type", "protoV3Group"), zap.String("name", config.GroupName))
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, config.Retry, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB)
+	httpQuery.SetZone(config.Zone, config.ServerZones)
+	httpQuery.SetLoadBalancing(config.LBMethod, config.Weights, config.SlowStart)
+	switch config.TransportCompression {
+	case "":
+	case httpHeaders.EncodingGorilla, httpHeaders.EncodingGzip:
+		httpQuery.SetHeader(httpHeaders.HeaderAcceptEncoding, config.TransportCompression)
+	default:
+		return nil, errors.Fatalf("unknown transportCompression '%s', supported: %s, %s", config.TransportCompression, httpHeaders.EncodingGorilla, httpHeaders.EncodingGzip)
+	}
 
 	c := &ClientProtoV3Group{
 		groupName:            config.GroupName,
-		servers:              config.Servers,
 		timeout:              *config.Timeouts,
 		maxTries:             *config.MaxTries,
 		maxMetricsPerRequest: config.MaxBatchSize,
+		filterPushdown:       config.FilterPushdown,
 
 		client:  httpClient,
 		limiter: limiter,
@@ -105,8 +112,13 @@ func (c ClientProtoV3Group) Name() string {
 	return c.groupName
 }
 
-func (c ClientProtoV3Group) Backends() []string {
-	return c.servers
+func (c *ClientProtoV3Group) Backends() []string {
+	return c.httpQuery.Servers()
+}
+
+// SetServers replaces servers of the group, it implements types.ServersSetter
+func (c *ClientProtoV3Group) SetServers(servers []string, serverZones map[string]string) {
+	c.httpQuery.SetServers(servers, serverZones)
 }
 
 func (c *ClientProtoV3Group) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, *errors.Errors) {
@@ -118,6 +130,9 @@ func (c *ClientProtoV3Group) Fetch(ctx context.Context, request *protov3.MultiFe
 		"format": []string{format},
 	}
 	rewrite.RawQuery = v.Encode()
+	if !c.filterPushdown {
+		request = types.WithoutFilterFunctions(request)
+	}
 
 	res, e := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), types.MultiFetchRequestV3{*request})
 	if e != nil {
@@ -130,8 +145,7 @@ func (c *ClientProtoV3Group) Fetch(ctx context.Context, request *protov3.MultiFe
 	}
 	e = &errors.Errors{}
 
-	var r protov3.MultiFetchResponse
-	err := r.Unmarshal(res.Response)
+	r, err := unmarshalFetchResponse(res.Encoding, res.Response)
 	if err != nil {
 		e.AddFatal(err)
 		return nil, stats, e
@@ -141,9 +155,44 @@ func (c *ClientProtoV3Group) Fetch(ctx context.Context, request *protov3.MultiFe
 		logger.Error("errors occurred while getting results",
 			zap.Any("errors", e.Errors),
 		)
-		return &r, stats, e
+		return r, stats, e
 	}
-	return &r, stats, nil
+	return r, stats, nil
+}
+
+// unmarshalFetchResponse decodes fetch response compressed by carbonapi server. Servers that don't support
+// compression send plain protobuf without encoding header
+func unmarshalFetchResponse(encoding string, b []byte) (*protov3.MultiFetchResponse, error) {
+	switch encoding {
+	case "":
+	case httpHeaders.EncodingGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		b, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, err
+		}
+	case httpHeaders.EncodingGorilla:
+		series, err := exprTypes.UnmarshalColumnar(b)
+		if err != nil {
+			return nil, err
+		}
+		r := &protov3.MultiFetchResponse{Metrics: make([]protov3.FetchResponse, 0, len(series))}
+		for _, s := range series {
+			r.Metrics = append(r.Metrics, s.FetchResponse)
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding of response: '%s'", encoding)
+	}
+
+	var r protov3.MultiFetchResponse
+	if err := r.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	return &r, nil
 }
 
 func (c *ClientProtoV3Group) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, *errors.Errors) {
@@ -216,8 +265,33 @@ func (c *ClientProtoV3Group) Info(ctx context.Context, request *protov3.MultiMet
 	return r, stats, nil
 }
 
+// List returns names of all metrics of the backend, it's served by go-carbon's /metrics/list/ handler
 func (c *ClientProtoV3Group) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, *errors.Errors) {
-	return nil, nil, errors.FromErr(types.ErrNotImplementedYet)
+	logger := c.logger.With(zap.String("type", "list"))
+	stats := &types.Stats{}
+	rewrite, _ := url.Parse("http://127.0.0.1/metrics/list/")
+
+	v := url.Values{
+		"format": []string{format},
+	}
+	rewrite.RawQuery = v.Encode()
+
+	res, e := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+	if e != nil {
+		return nil, stats, e
+	}
+	if res == nil {
+		return nil, stats, errors.FromErrNonFatal(types.ErrNoResponseFetched)
+	}
+
+	var r protov3.ListMetricsResponse
+	err := r.Unmarshal(res.Response)
+	if err != nil {
+		return nil, stats, errors.FromErrNonFatal(err)
+	}
+	stats.MemoryUsage = int64(r.Size())
+
+	return &r, stats, nil
 }
 func (c *ClientProtoV3Group) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, *errors.Errors) {
 	return nil, nil, errors.FromErr(types.ErrNotImplementedYet)
@@ -2,30 +2,144 @@ package types
 
 import (
 	"time"
+
+	"github.com/go-graphite/carbonapi/util/tlsconfig"
 )
 
 type BackendsV2 struct {
-	Backends                  []BackendV2   `mapstructure:"backends"`
-	MaxIdleConnsPerHost       int           `mapstructure:"maxIdleConnsPerHost"`
-	ConcurrencyLimitPerServer int           `mapstructure:"concurrencyLimit"`
-	Timeouts                  Timeouts      `mapstructure:"timeouts"`
-	KeepAliveInterval         time.Duration `mapstructure:"keepAliveInterval"`
-	MaxTries                  int           `mapstructure:"maxTries"`
-	MaxBatchSize              int           `mapstructure:"maxBatchSize"`
+	Backends                  []BackendV2    `mapstructure:"backends"`
+	MaxIdleConnsPerHost       int            `mapstructure:"maxIdleConnsPerHost"`
+	ConcurrencyLimitPerServer int            `mapstructure:"concurrencyLimit"`
+	Timeouts                  Timeouts       `mapstructure:"timeouts"`
+	KeepAliveInterval         time.Duration  `mapstructure:"keepAliveInterval"`
+	MaxTries                  int            `mapstructure:"maxTries"`
+	MaxBatchSize              int            `mapstructure:"maxBatchSize"`
+	MaxPatternsPerRequest     int            `mapstructure:"maxPatternsPerRequest"`
+	Transport                 Transport      `mapstructure:"transport"`
+	Shaping                   Shaping        `mapstructure:"shaping"`
+	Retry                     Retry          `mapstructure:"retry"`
+	RetryBudget               RetryBudget    `mapstructure:"retryBudget"`
+	CircuitBreaker            CircuitBreaker `mapstructure:"circuitBreaker"`
+	Zone                      string         `mapstructure:"zone"`        // Zone of carbonapi, "auto" detects it from node metadata
+	PrefixIndex               bool           `mapstructure:"prefixIndex"` // Skip backends that don't have first-level prefix of requested metrics
 }
 
 type BackendV2 struct {
-	GroupName           string                 `mapstructure:"groupName"`
-	Protocol            string                 `mapstructure:"protocol"`
-	LBMethod            string                 `mapstructure:"lbMethod"` // Valid: rr/roundrobin, broadcast/all
-	Servers             []string               `mapstructure:"servers"`
-	Timeouts            *Timeouts              `mapstructure:"timeouts"`
-	ConcurrencyLimit    *int                   `mapstructure:"concurrencyLimit"`
-	KeepAliveInterval   *time.Duration         `mapstructure:"keepAliveInterval"`
-	MaxIdleConnsPerHost *int                   `mapstructure:"maxIdleConnsPerHost"`
-	MaxTries            *int                   `mapstructure:"maxTries"`
-	MaxBatchSize        int                    `mapstructure:"maxBatchSize"`
-	BackendOptions      map[string]interface{} `mapstructure:"backendOptions"`
+	GroupName             string                  `mapstructure:"groupName"`
+	Protocol              string                  `mapstructure:"protocol"`
+	LBMethod              string                  `mapstructure:"lbMethod"`    // Valid: rr/roundrobin, broadcast/all, weighted/wrr, leastloaded/ll
+	MergePolicy           string                  `mapstructure:"mergePolicy"` // Valid: merge-by-nonnull, prefer-first, newest-point-wins
+	Servers               []string                `mapstructure:"servers"`
+	Timeouts              *Timeouts               `mapstructure:"timeouts"`
+	ConcurrencyLimit      *int                    `mapstructure:"concurrencyLimit"`
+	KeepAliveInterval     *time.Duration          `mapstructure:"keepAliveInterval"`
+	MaxIdleConnsPerHost   *int                    `mapstructure:"maxIdleConnsPerHost"`
+	MaxTries              *int                    `mapstructure:"maxTries"`
+	MaxBatchSize          int                     `mapstructure:"maxBatchSize"`
+	MaxPatternsPerRequest int                     `mapstructure:"maxPatternsPerRequest"` // 0 means no limit
+	BackendOptions        map[string]interface{}  `mapstructure:"backendOptions"`
+	HashRing              *HashRing               `mapstructure:"hashRing"`
+	Transport             *Transport              `mapstructure:"transport"`
+	Shaping               *Shaping                `mapstructure:"shaping"`
+	Retry                 *Retry                  `mapstructure:"retry"`
+	CircuitBreaker        *CircuitBreaker         `mapstructure:"circuitBreaker"`
+	Discovery             *Discovery              `mapstructure:"discovery"`
+	Zone                  string                  `mapstructure:"zone"`                 // Servers in this zone are preferred
+	ServerZones           map[string]string       `mapstructure:"serverZones"`          // Zones of servers
+	Weights               map[string]int          `mapstructure:"weights"`              // Weights of servers for weighted and leastloaded lbMethod, default is 1
+	SlowStart             time.Duration           `mapstructure:"slowStart"`            // Weight of recovered server grows during this time
+	FilterPushdown        bool                    `mapstructure:"filterPushdown"`       // Backends apply filtering functions of fetch requests, e.x. graphite-clickhouse
+	TransportCompression  string                  `mapstructure:"transportCompression"` // Compression of fetch responses of carbonapi backends: gorilla or gzip
+	Shadow                bool                    `mapstructure:"shadow"`               // Group serves only requests that select it, e.x. mirrored traffic
+	TLS                   *tlsconfig.ClientConfig `mapstructure:"tls"`
+
+	// Transports collects transports of http clients of the group, set by zipper
+	Transports *Transports `mapstructure:"-" json:"-"`
+}
+
+// Transport contains tuning options for connection pool of http-based backend groups
+type Transport struct {
+	MaxIdleConns        int           `mapstructure:"maxIdleConns"`        // 0 means no limit
+	MaxConnsPerHost     int           `mapstructure:"maxConnsPerHost"`     // 0 means no limit
+	IdleConnTimeout     time.Duration `mapstructure:"idleConnTimeout"`     // 0 means no timeout
+	DialTimeout         time.Duration `mapstructure:"dialTimeout"`         // Overrides timeouts.connect if set
+	HTTP2               bool          `mapstructure:"http2"`               // Try to use HTTP/2 for https backends
+	TLSSessionCacheSize int           `mapstructure:"tlsSessionCacheSize"` // 0 disables TLS session resumption
+}
+
+// Shaping limits requests to http-based backend groups, so a single carbonapi can't overload undersized backends.
+// Limits apply to each server of broadcast groups and to the whole group otherwise
+type Shaping struct {
+	MaxConcurrent   int     `mapstructure:"maxConcurrent"`   // 0 means no limit
+	MaxQPS          float64 `mapstructure:"maxQPS"`          // 0 means no limit, requests are spaced evenly
+	MaxQueue        int     `mapstructure:"maxQueue"`        // Requests waiting for limits, more are rejected. 0 means no limit
+	MaxResponseSize int64   `mapstructure:"maxResponseSize"` // In bytes, 0 means no limit
+}
+
+// Retry describes how failed requests to http-based backend groups are retried, amount of tries is limited by
+// maxTries. Only connection errors, timeouts and 5xx responses are retried
+type Retry struct {
+	TryTimeout   time.Duration `mapstructure:"tryTimeout"`   // Timeout of a single try, 0 means no limit besides request timeout
+	TotalTimeout time.Duration `mapstructure:"totalTimeout"` // Timeout of all tries, 0 means no limit besides request timeout
+}
+
+// RetryBudget limits retries to all backend groups, so they don't amplify load during backend brownouts. Every
+// second retries are allowed up to MinPerSecond plus Ratio of requests sent in this second. Zero budget is unlimited
+type RetryBudget struct {
+	Ratio        float64 `mapstructure:"ratio"`
+	MinPerSecond int     `mapstructure:"minPerSecond"`
+}
+
+// CircuitBreaker stops sending requests to a server of http-based backend group, when too many of them fail or are
+// slow. After OpenTimeout single probe request is sent, and if it succeeds, server gets requests again
+type CircuitBreaker struct {
+	ErrorRate   float64       `mapstructure:"errorRate"`   // Share of failed requests that opens breaker, 0 disables breaker
+	MinRequests int           `mapstructure:"minRequests"` // Min requests in window to open breaker
+	Window      time.Duration `mapstructure:"window"`      // Period of time requests are counted in
+	SlowRequest time.Duration `mapstructure:"slowRequest"` // Requests without response for that time are failed, 0 means no limit
+	OpenTimeout time.Duration `mapstructure:"openTimeout"` // Time before probe request is sent to the server
+}
+
+// Discovery describes where servers of backend group are found, instead of static list. Only one source should be set
+type Discovery struct {
+	// DNS is a server URL, host of which is resolved: SRV records if it starts with '_' (e.x.
+	// http://_carbonapi._tcp.example.com), A and AAAA records otherwise. Scheme and port are taken from the URL
+	DNS string `mapstructure:"dns"`
+	// File contains server URLs, one per line. Empty lines and lines starting with '#' are skipped
+	File string `mapstructure:"file"`
+	// Consul is an URL of Consul KV key, value of which contains server URLs like File does
+	Consul string `mapstructure:"consul"`
+	// Kubernetes finds ready pods of the service from its EndpointSlices
+	Kubernetes *KubernetesDiscovery `mapstructure:"kubernetes"`
+	// Interval of re-resolving servers, default is 30s
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// KubernetesDiscovery describes EndpointSlices of the service that are used as servers of backend group
+type KubernetesDiscovery struct {
+	// APIServer is an URL of Kubernetes API, default is in-cluster one from KUBERNETES_SERVICE_HOST and
+	// KUBERNETES_SERVICE_PORT with service account token and CA
+	APIServer string `mapstructure:"apiServer"`
+	// Namespace of the service, default is namespace of the pod
+	Namespace string `mapstructure:"namespace"`
+	// Service is a name of the service
+	Service string `mapstructure:"service"`
+	// LabelSelector selects EndpointSlices by labels of the service instead of its name
+	LabelSelector string `mapstructure:"labelSelector"`
+	// Port is a name of the port, default is the first port
+	Port string `mapstructure:"port"`
+	// Scheme of server URLs, default is http
+	Scheme string `mapstructure:"scheme"`
+	// Zone is preferred: only pods in this zone are used if there are ready ones
+	Zone string `mapstructure:"zone"`
+}
+
+// HashRing describes consistent hashing (carbon_ch) that was used to shard metrics between servers of the group
+type HashRing struct {
+	Replicas          int               `mapstructure:"replicas"`
+	ReplicationFactor int               `mapstructure:"replicationFactor"`
+	KeyNodes          int               `mapstructure:"keyNodes"`
+	Instances         map[string]string `mapstructure:"instances"`
 }
 
 func (b *BackendV2) FillDefaults() {
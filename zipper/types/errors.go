@@ -17,6 +17,10 @@ var ErrNotFound = errors.New("metric not found")
 var ErrNoResponseFetched = errors.New("no responses fetched from upstream")
 var ErrNoMetricsFetched = errors.New("no metrics in the Response")
 var ErrMaxTriesExceeded = errors.New("max tries exceeded")
+var ErrUnknownBackendGroup = errors.New("unknown backend group")
+var ErrBackendQueueFull = errors.New("too many requests are waiting for backend")
+var ErrResponseTooLarge = errors.New("response exceeds maxResponseSize")
+var ErrCircuitOpen = errors.New("circuit breaker is open")
 
 var ErrFailedToFetchFmt = "failed to fetch data from server group %v, code %v, body %v"
 
@@ -32,6 +32,11 @@ type BackendServer interface {
 	Children() []BackendServer
 }
 
+// ServersSetter is implemented by backend groups, which servers could be replaced while they serve requests
+type ServersSetter interface {
+	SetServers(servers []string, serverZones map[string]string)
+}
+
 /*
 type Fetcher interface {
 	// PB-compatible methods
@@ -13,6 +13,8 @@ type LBMethod int
 const (
 	RoundRobinLB LBMethod = iota
 	BroadcastLB
+	WeightedRoundRobinLB
+	LeastLoadedLB
 )
 
 func (p LBMethod) keys(m map[string]LBMethod) []string {
@@ -24,11 +26,15 @@ func (p LBMethod) keys(m map[string]LBMethod) []string {
 }
 
 var supportedLBMethods = map[string]LBMethod{
-	"roundrobin": RoundRobinLB,
-	"rr":         RoundRobinLB,
-	"any":        RoundRobinLB,
-	"broadcast":  BroadcastLB,
-	"all":        BroadcastLB,
+	"roundrobin":  RoundRobinLB,
+	"rr":          RoundRobinLB,
+	"any":         RoundRobinLB,
+	"broadcast":   BroadcastLB,
+	"all":         BroadcastLB,
+	"weighted":    WeightedRoundRobinLB,
+	"wrr":         WeightedRoundRobinLB,
+	"leastloaded": LeastLoadedLB,
+	"ll":          LeastLoadedLB,
 }
 
 func (m *LBMethod) FromString(method string) error {
@@ -60,6 +66,10 @@ func (m LBMethod) MarshalJSON() ([]byte, error) {
 		return json.Marshal("RoundRobin")
 	case BroadcastLB:
 		return json.Marshal("Broadcast")
+	case WeightedRoundRobinLB:
+		return json.Marshal("WeightedRoundRobin")
+	case LeastLoadedLB:
+		return json.Marshal("LeastLoaded")
 	}
 
 	return nil, fmt.Errorf(ErrUnknownLBMethodFmt, m, m.keys(supportedLBMethods))
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownMergePolicyFmt = "unknown merge policy: '%v', supported: %v"
+
+// MergePolicy defines how responses for the same series that came from different backends are merged together
+type MergePolicy int
+
+const (
+	// MergeNonNullPolicy fills gaps in one response with non-null values of another one
+	MergeNonNullPolicy MergePolicy = iota
+	// PreferFirstPolicy takes whole series from the backend that's listed first in the config
+	PreferFirstPolicy
+	// NewestPointWinsPolicy takes values from the response that have more recent data and fills its gaps from others
+	NewestPointWinsPolicy
+	// LongestPolicy takes whole series from the response that have more non-null values
+	LongestPolicy
+)
+
+func (p MergePolicy) keys(m map[string]MergePolicy) []string {
+	res := make([]string, 0)
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
+
+var supportedMergePolicies = map[string]MergePolicy{
+	"":                  MergeNonNullPolicy,
+	"merge-by-nonnull":  MergeNonNullPolicy,
+	"fill":              MergeNonNullPolicy,
+	"prefer-first":      PreferFirstPolicy,
+	"first":             PreferFirstPolicy,
+	"newest-point-wins": NewestPointWinsPolicy,
+	"longest":           LongestPolicy,
+}
+
+func (p *MergePolicy) FromString(policy string) error {
+	var ok bool
+	if *p, ok = supportedMergePolicies[strings.ToLower(policy)]; !ok {
+		return fmt.Errorf(ErrUnknownMergePolicyFmt, policy, p.keys(supportedMergePolicies))
+	}
+	return nil
+}
+
+func (p *MergePolicy) UnmarshalJSON(data []byte) error {
+	var policy string
+	err := json.Unmarshal(data, &policy)
+	if err != nil {
+		return err
+	}
+
+	return p.FromString(policy)
+}
+
+func (p *MergePolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var policy string
+	err := unmarshal(&policy)
+	if err != nil {
+		return err
+	}
+
+	return p.FromString(policy)
+}
+
+func (p MergePolicy) String() string {
+	switch p {
+	case MergeNonNullPolicy:
+		return "merge-by-nonnull"
+	case PreferFirstPolicy:
+		return "prefer-first"
+	case NewestPointWinsPolicy:
+		return "newest-point-wins"
+	case LongestPolicy:
+		return "longest"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+func (p MergePolicy) MarshalJSON() ([]byte, error) {
+	if _, ok := supportedMergePolicies[p.String()]; !ok {
+		return nil, fmt.Errorf(ErrUnknownMergePolicyFmt, p, p.keys(supportedMergePolicies))
+	}
+
+	return json.Marshal(p.String())
+}
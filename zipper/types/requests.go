@@ -52,3 +52,20 @@ func (request CapabilityRequestV3) Marshal() ([]byte, error) {
 func (request CapabilityRequestV3) LogInfo() interface{} {
 	return request.CapabilityRequest
 }
+
+// WithoutFilterFunctions returns request without filtering functions, that are hints for backends which can apply
+// them (e.x. graphite-clickhouse). Request is copied only if it has any
+func WithoutFilterFunctions(request *protov3.MultiFetchRequest) *protov3.MultiFetchRequest {
+	for i := range request.Metrics {
+		if len(request.Metrics[i].FilterFunctions) == 0 {
+			continue
+		}
+		res := &protov3.MultiFetchRequest{Metrics: make([]protov3.FetchRequest, len(request.Metrics))}
+		copy(res.Metrics, request.Metrics)
+		for j := range res.Metrics {
+			res.Metrics[j].FilterFunctions = nil
+		}
+		return res
+	}
+	return request
+}
@@ -117,6 +117,7 @@ func (first *ServerTagResponse) Merge(second *ServerTagResponse) *errors.Errors
 
 	for _, v := range second.Response {
 		if _, ok := firstMap[v]; !ok {
+			firstMap[v] = struct{}{}
 			first.Response = append(first.Response, v)
 		}
 	}
@@ -265,6 +266,13 @@ type ServerFetchResponse struct {
 	Response *protov3.MultiFetchResponse
 	Stats    *Stats
 	Err      *errors.Errors
+
+	// MergePolicy defines how series with the same name from different servers are merged
+	MergePolicy MergePolicy
+	// Priority of the server that sent the response, lower is better. Used by PreferFirstPolicy
+	Priority int
+
+	priorities map[fetchResponseCoordinates]int
 }
 
 func NewServerFetchResponse() *ServerFetchResponse {
@@ -301,6 +309,20 @@ func (s *ServerFetchResponse) NonFatalError(err error) *ServerFetchResponse {
 	return s
 }
 
+func (s *ServerFetchResponse) priority(c fetchResponseCoordinates) int {
+	if p, ok := s.priorities[c]; ok {
+		return p
+	}
+	return s.Priority
+}
+
+func (s *ServerFetchResponse) setPriority(c fetchResponseCoordinates, priority int) {
+	if s.priorities == nil {
+		s.priorities = make(map[fetchResponseCoordinates]int)
+	}
+	s.priorities[c] = priority
+}
+
 func swapFetchResponses(m1, m2 *protov3.FetchResponse) {
 	m1.Name, m2.Name = m2.Name, m1.Name
 	m1.StartTime, m2.StartTime = m2.StartTime, m1.StartTime
@@ -312,9 +334,42 @@ func swapFetchResponses(m1, m2 *protov3.FetchResponse) {
 	m1.StopTime, m2.StopTime = m2.StopTime, m1.StopTime
 }
 
+// mergeFetchResponsesWithShiftedStartTimes merges responses from replicas that returned different time ranges. Result
+// covers both ranges and gaps are filled point by point.
+func mergeFetchResponsesWithShiftedStartTimes(m1, m2 *protov3.FetchResponse) error {
+	step := m1.StepTime
+	if step == 0 || (m1.StartTime-m2.StartTime)%step != 0 {
+		return ErrResponseStartTimeMismatch
+	}
+
+	start := m1.StartTime
+	if m2.StartTime < start {
+		start = m2.StartTime
+	}
+	end := m1.StartTime + int64(len(m1.Values))*step
+	if m2End := m2.StartTime + int64(len(m2.Values))*step; m2End > end {
+		end = m2End
+	}
+
+	values := make([]float64, (end-start)/step)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	copy(values[(m1.StartTime-start)/step:], m1.Values)
+
+	m1.Values = values
+	m1.StartTime = start
+	if m2.StopTime > m1.StopTime {
+		m1.StopTime = m2.StopTime
+	}
+	fillFetchResponseGaps(m1, m2)
+
+	return nil
+}
+
 func mergeFetchResponsesWithEqualStepTimes(m1, m2 *protov3.FetchResponse) error {
 	if m1.StartTime != m2.StartTime {
-		return ErrResponseStartTimeMismatch
+		return mergeFetchResponsesWithShiftedStartTimes(m1, m2)
 	}
 
 	if len(m1.Values) < len(m2.Values) {
@@ -349,6 +404,53 @@ func mergeFetchResponsesWithUnequalStepTimes(m1, m2 *protov3.FetchResponse) erro
 	return nil
 }
 
+func nonNullValues(r *protov3.FetchResponse) int {
+	cnt := 0
+	for _, v := range r.Values {
+		if !math.IsNaN(v) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// fillFetchResponseGaps replaces NaNs in m1 with values from m2 that have the same timestamp
+func fillFetchResponseGaps(m1, m2 *protov3.FetchResponse) {
+	if m1.StepTime != m2.StepTime || m1.StepTime == 0 {
+		return
+	}
+
+	for i := range m1.Values {
+		if !math.IsNaN(m1.Values[i]) {
+			continue
+		}
+		t := m1.StartTime + int64(i)*m1.StepTime
+		if t < m2.StartTime || (t-m2.StartTime)%m2.StepTime != 0 {
+			continue
+		}
+		j := (t - m2.StartTime) / m2.StepTime
+		if j < int64(len(m2.Values)) {
+			m1.Values[i] = m2.Values[j]
+		}
+	}
+}
+
+// MergeFetchResponsesNewestWins merges two responses, taking values from the one that have most recent data and
+// filling its gaps with values from the other one.
+func MergeFetchResponsesNewestWins(m1, m2 *protov3.FetchResponse) *errors.Errors {
+	if m1.RequestStartTime != m2.RequestStartTime || m1.StepTime != m2.StepTime {
+		return MergeFetchResponses(m1, m2)
+	}
+
+	if m2.StopTime > m1.StopTime {
+		swapFetchResponses(m1, m2)
+	}
+
+	fillFetchResponseGaps(m1, m2)
+
+	return nil
+}
+
 func MergeFetchResponses(m1, m2 *protov3.FetchResponse) *errors.Errors {
 	var err error
 	if m1.RequestStartTime != m2.RequestStartTime {
@@ -404,14 +506,32 @@ func (first *ServerFetchResponse) Merge(second *ServerFetchResponse) *errors.Err
 	}
 
 	for i := range second.Response.Metrics {
-		if j, ok := metrics[coordinates(&second.Response.Metrics[i])]; ok {
-			err := MergeFetchResponses(&first.Response.Metrics[j], &second.Response.Metrics[i])
+		c := coordinates(&second.Response.Metrics[i])
+		if j, ok := metrics[c]; ok {
+			var err *errors.Errors
+			switch first.MergePolicy {
+			case PreferFirstPolicy:
+				if p := second.priority(c); p < first.priority(c) {
+					first.Response.Metrics[j] = second.Response.Metrics[i]
+					first.setPriority(c, p)
+				}
+			case NewestPointWinsPolicy:
+				err = MergeFetchResponsesNewestWins(&first.Response.Metrics[j], &second.Response.Metrics[i])
+			case LongestPolicy:
+				if nonNullValues(&second.Response.Metrics[i]) > nonNullValues(&first.Response.Metrics[j]) {
+					first.Response.Metrics[j] = second.Response.Metrics[i]
+				}
+			default:
+				err = MergeFetchResponses(&first.Response.Metrics[j], &second.Response.Metrics[i])
+			}
 			if err != nil {
 				// TODO: Normal error handling
 				continue
 			}
 		} else {
+			metrics[c] = len(first.Response.Metrics)
 			first.Response.Metrics = append(first.Response.Metrics, second.Response.Metrics[i])
+			first.setPriority(c, second.priority(c))
 		}
 	}
 	return nil
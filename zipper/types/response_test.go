@@ -31,6 +31,78 @@ func TestMergeFetchResponsesWithNanAppending(t *testing.T) {
 	}
 }
 
+func TestServerFetchResponseMergePolicies(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name     string
+		policy   MergePolicy
+		first    protov3.FetchResponse
+		second   protov3.FetchResponse
+		expected []float64
+	}{
+		{
+			name:     "merge-by-nonnull",
+			policy:   MergeNonNullPolicy,
+			first:    protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 240, StepTime: 60, Values: []float64{nan, 2, nan}},
+			second:   protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 240, StepTime: 60, Values: []float64{1, nan, 3}},
+			expected: []float64{1, 2, 3},
+		},
+		{
+			name:     "prefer-first",
+			policy:   PreferFirstPolicy,
+			first:    protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 240, StepTime: 60, Values: []float64{nan, 2, nan}},
+			second:   protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 240, StepTime: 60, Values: []float64{1, 3, 3}},
+			expected: []float64{nan, 2, nan},
+		},
+		{
+			name:     "newest-point-wins",
+			policy:   NewestPointWinsPolicy,
+			first:    protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 240, StepTime: 60, Values: []float64{1, 2, nan}},
+			second:   protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 300, StepTime: 60, Values: []float64{nan, 3, nan, 4}},
+			expected: []float64{1, 3, nan, 4},
+		},
+		{
+			name:     "fill with shifted start time",
+			policy:   MergeNonNullPolicy,
+			first:    protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 240, StepTime: 60, Values: []float64{1, nan, 3}},
+			second:   protov3.FetchResponse{Name: "a", StartTime: 120, StopTime: 300, StepTime: 60, Values: []float64{2, nan, 4}},
+			expected: []float64{1, 2, 3, 4},
+		},
+		{
+			name:     "longest",
+			policy:   LongestPolicy,
+			first:    protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 240, StepTime: 60, Values: []float64{1, 2, nan}},
+			second:   protov3.FetchResponse{Name: "a", StartTime: 60, StopTime: 240, StepTime: 60, Values: []float64{nan, nan, 3}},
+			expected: []float64{1, 2, nan},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewServerFetchResponse()
+			result.MergePolicy = tt.policy
+
+			// second server answers first, but it have lower priority
+			second := NewServerFetchResponse()
+			second.Priority = 1
+			second.Response.Metrics = []protov3.FetchResponse{tt.second}
+			first := NewServerFetchResponse()
+			first.Priority = 0
+			first.Response.Metrics = []protov3.FetchResponse{tt.first}
+
+			result.Merge(second)
+			result.Merge(first)
+
+			if len(result.Response.Metrics) != 1 {
+				t.Fatalf("series were not deduplicated: %v", result.Response.Metrics)
+			}
+			if !cmpFloat64Arrays(result.Response.Metrics[0].Values, tt.expected, 0.00001) {
+				t.Errorf("Error merging responses\nExp: %v\nGot: %v", tt.expected, result.Response.Metrics[0].Values)
+			}
+		})
+	}
+}
+
 func cmpFloat64Arrays(a, b []float64, epsilon float64) bool {
 	if len(a) != len(b) {
 		return false
@@ -52,3 +124,22 @@ func cmpFloat64Arrays(a, b []float64, epsilon float64) bool {
 
 	return true
 }
+
+func TestWithoutFilterFunctions(t *testing.T) {
+	plain := &protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{{Name: "foo.*"}}}
+	if WithoutFilterFunctions(plain) != plain {
+		t.Error("request without filtering functions shouldn't be copied")
+	}
+
+	filtered := &protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{
+		{Name: "foo.*"},
+		{Name: "bar.*", FilterFunctions: []*protov3.FilteringFunction{{Name: "highestMax", Arguments: []string{"3"}}}},
+	}}
+	res := WithoutFilterFunctions(filtered)
+	if len(res.Metrics) != 2 || res.Metrics[1].Name != "bar.*" || res.Metrics[1].FilterFunctions != nil {
+		t.Errorf("filtering functions should be removed, got %v", res)
+	}
+	if filtered.Metrics[1].FilterFunctions == nil {
+		t.Error("original request shouldn't be changed")
+	}
+}
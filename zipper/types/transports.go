@@ -0,0 +1,38 @@
+package types
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Transports keeps http transports of backend groups of one zipper, so their connections could be closed when the
+// zipper isn't used anymore
+type Transports struct {
+	sync.Mutex
+	list []*http.Transport
+}
+
+func (t *Transports) Add(transport *http.Transport) {
+	t.Lock()
+	t.list = append(t.list, transport)
+	t.Unlock()
+}
+
+// AddAll adds transports of other set, e.x. of one backend that could be removed from the group
+func (t *Transports) AddAll(other *Transports) {
+	other.Lock()
+	list := append([]*http.Transport(nil), other.list...)
+	other.Unlock()
+	t.Lock()
+	t.list = append(t.list, list...)
+	t.Unlock()
+}
+
+// CloseIdleConnections closes idle connections of all transports, connections in use aren't affected
+func (t *Transports) CloseIdleConnections() {
+	t.Lock()
+	defer t.Unlock()
+	for _, transport := range t.list {
+		transport.CloseIdleConnections()
+	}
+}
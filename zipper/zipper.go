@@ -2,14 +2,18 @@ package zipper
 
 import (
 	"context"
+	"fmt"
 	"math"
 	_ "net/http/pprof"
 	"strings"
 	"time"
 
+	util "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/broadcast"
 	"github.com/go-graphite/carbonapi/zipper/config"
 	"github.com/go-graphite/carbonapi/zipper/errors"
+	"github.com/go-graphite/carbonapi/zipper/hashring"
+	"github.com/go-graphite/carbonapi/zipper/helper"
 	"github.com/go-graphite/carbonapi/zipper/metadata"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	protov2 "github.com/go-graphite/protocol/carbonapi_v2_pb"
@@ -39,11 +43,18 @@ type Zipper struct {
 	searchPrefix     string
 
 	// Will broadcast to all servers there
-	storeBackends             types.BackendServer
+	storeBackends types.BackendServer
+	// groupBackends contains top-level backend groups by name, so request can be sent to only one of them
+	groupBackends             map[string]types.BackendServer
 	concurrencyLimitPerServer int
 
 	sendStats func(*types.Stats)
 
+	// transports of http-based backends, their connections are closed by Close
+	transports *types.Transports
+	// serversSetters replace servers of backend groups by name, see SetServers
+	serversSetters map[string][]serversSetter
+
 	logger *zap.Logger
 }
 
@@ -68,16 +79,30 @@ func sanitizeTimouts(timeouts, defaultTimeouts types.Timeouts) types.Timeouts {
 	return timeouts
 }
 
-func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelaySec int32) ([]types.BackendServer, *errors.Errors) {
+// serversSetter replaces servers of backend group, groups that don't support it have no setter
+type serversSetter func(servers []string, serverZones map[string]string) error
+
+func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelaySec int32, transports *types.Transports, setters map[string][]serversSetter) ([]types.BackendServer, *errors.Errors) {
 	storeClients := make([]types.BackendServer, 0)
 	var e errors.Errors
 	var ePtr *errors.Errors
 	timeouts := backends.Timeouts
+	prefixIndex := backends.PrefixIndex
 	for _, backend := range backends.Backends {
 		concurrencyLimit := backends.ConcurrencyLimitPerServer
 		tries := backends.MaxTries
 		maxIdleConnsPerHost := backends.MaxIdleConnsPerHost
 		keepAliveInterval := backends.KeepAliveInterval
+		transport := backends.Transport
+		shaping := backends.Shaping
+		retry := backends.Retry
+		circuitBreaker := backends.CircuitBreaker
+		if backend.MaxPatternsPerRequest == 0 {
+			backend.MaxPatternsPerRequest = backends.MaxPatternsPerRequest
+		}
+		if backend.Zone == "" {
+			backend.Zone = backends.Zone
+		}
 
 		if backend.Timeouts == nil {
 			backend.Timeouts = &timeouts
@@ -94,6 +119,19 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 		if backend.KeepAliveInterval == nil {
 			backend.KeepAliveInterval = &keepAliveInterval
 		}
+		if backend.Transport == nil {
+			backend.Transport = &transport
+		}
+		if backend.Shaping == nil {
+			backend.Shaping = &shaping
+		}
+		if backend.Retry == nil {
+			backend.Retry = &retry
+		}
+		if backend.CircuitBreaker == nil {
+			backend.CircuitBreaker = &circuitBreaker
+		}
+		backend.Transports = transports
 
 		var client types.BackendServer
 		logger.Debug("creating lb group",
@@ -128,44 +166,195 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 				zap.Error(err),
 			)
 		}
-		if lbMethod == types.RoundRobinLB {
+		if lbMethod != types.BroadcastLB {
 			client, ePtr = backendInit(logger, backend)
 			e.Merge(ePtr)
 			if e.HaveFatalErrors {
 				return nil, &e
 			}
+			if s, ok := client.(types.ServersSetter); ok {
+				setters[backend.GroupName] = append(setters[backend.GroupName], func(servers []string, serverZones map[string]string) error {
+					s.SetServers(servers, serverZones)
+					return nil
+				})
+			}
 		} else {
-			config := backend
-
+			// every server has its own transports, so its connections could be closed when it's removed from group
+			serverTransports := make(map[string]*types.Transports, len(backend.Servers))
 			backends := make([]types.BackendServer, 0, len(backend.Servers))
 			for _, server := range backend.Servers {
-				config.Servers = []string{server}
-				config.GroupName = server
-				client, ePtr = backendInit(logger, config)
+				serverTransports[server] = &types.Transports{}
+				client, ePtr = newBroadcastMember(logger, backendInit, backend, server, serverTransports[server])
 				e.Merge(ePtr)
 				if e.HaveFatalErrors {
 					return nil, &e
 				}
+				transports.AddAll(serverTransports[server])
 				backends = append(backends, client)
 			}
 
-			client, ePtr = broadcast.NewBroadcastGroup(logger, backend.GroupName, backends, expireDelaySec, *backend.ConcurrencyLimit, backend.MaxBatchSize, timeouts)
+			var bg *broadcast.BroadcastGroup
+			bg, ePtr = broadcast.NewBroadcastGroup(logger, backend.GroupName, backends, expireDelaySec, *backend.ConcurrencyLimit, backend.MaxBatchSize, timeouts)
 			e.Merge(ePtr)
 			if e.HaveFatalErrors {
 				return nil, &e
 			}
+			bg.SetMergePolicy(parseMergePolicy(logger, backend.MergePolicy))
+			bg.SetMaxPatternsPerRequest(backend.MaxPatternsPerRequest)
+			if prefixIndex {
+				bg.SetPrefixIndex()
+			}
+			if backend.HashRing != nil {
+				bg.SetHashRing(hashring.New(backend.Servers, backend.HashRing.Instances, backend.HashRing.Replicas, backend.HashRing.ReplicationFactor, backend.HashRing.KeyNodes))
+			}
+			setters[backend.GroupName] = append(setters[backend.GroupName], broadcastServersSetter(logger, backendInit, backend, bg, transports, serverTransports))
+			client = bg
 		}
 		storeClients = append(storeClients, client)
 	}
 	return storeClients, nil
 }
 
+// newBroadcastMember creates client of one server of broadcast group
+func newBroadcastMember(logger *zap.Logger, backendInit func(*zap.Logger, types.BackendV2) (types.BackendServer, *errors.Errors), backend types.BackendV2, server string, transports *types.Transports) (types.BackendServer, *errors.Errors) {
+	config := backend
+	config.Servers = []string{server}
+	config.GroupName = server
+	config.Transports = transports
+	return backendInit(logger, config)
+}
+
+// broadcastServersSetter returns setter, that creates clients for new servers of broadcast group and reuses clients of
+// servers that are kept. Idle connections of removed servers are closed after render timeout
+func broadcastServersSetter(logger *zap.Logger, backendInit func(*zap.Logger, types.BackendV2) (types.BackendServer, *errors.Errors), backend types.BackendV2, bg *broadcast.BroadcastGroup, transports *types.Transports, serverTransports map[string]*types.Transports) serversSetter {
+	return func(servers []string, serverZones map[string]string) error {
+		current := make(map[string]types.BackendServer)
+		for _, c := range bg.Children() {
+			current[c.Name()] = c
+		}
+
+		backend.ServerZones = serverZones
+		backends := make([]types.BackendServer, 0, len(servers))
+		added := make(map[string]*types.Transports)
+		for _, server := range servers {
+			if c, ok := current[server]; ok {
+				backends = append(backends, c)
+				delete(current, server)
+				continue
+			}
+			t := &types.Transports{}
+			client, err := newBroadcastMember(logger, backendInit, backend, server, t)
+			if err != nil && err.HaveFatalErrors {
+				return fmt.Errorf("server '%v': %v", server, err.Errors)
+			}
+			added[server] = t
+			backends = append(backends, client)
+		}
+
+		var ring *hashring.Ring
+		if backend.HashRing != nil {
+			ring = hashring.New(servers, backend.HashRing.Instances, backend.HashRing.Replicas, backend.HashRing.ReplicationFactor, backend.HashRing.KeyNodes)
+		}
+		bg.SetBackends(backends, ring)
+
+		for server, t := range added {
+			transports.AddAll(t)
+			serverTransports[server] = t
+		}
+		for server := range current {
+			if t, ok := serverTransports[server]; ok {
+				time.AfterFunc(backend.Timeouts.Render, t.CloseIdleConnections)
+				delete(serverTransports, server)
+			}
+		}
+		return nil
+	}
+}
+
+func parseMergePolicy(logger *zap.Logger, policy string) types.MergePolicy {
+	var mergePolicy types.MergePolicy
+	err := mergePolicy.FromString(policy)
+	if err != nil {
+		logger.Fatal("failed to parse mergePolicy",
+			zap.String("mergePolicy", policy),
+			zap.Error(err),
+		)
+	}
+	return mergePolicy
+}
+
+// ValidateConfig checks configuration for errors that would be fatal for NewZipper, so it's possible to refuse
+// invalid configuration without stopping already running zipper
+func ValidateConfig(config *config.Config) error {
+	if len(config.Backends) == 0 && len(config.BackendsV2.Backends) == 0 {
+		return fmt.Errorf("no backends specified")
+	}
+
+	var mergePolicy types.MergePolicy
+	err := mergePolicy.FromString(config.MergePolicy)
+	if err != nil {
+		return err
+	}
+
+	backends := make([]types.BackendV2, 0, len(config.BackendsV2.Backends)+len(config.CarbonSearchV2.Backends))
+	backends = append(backends, config.BackendsV2.Backends...)
+	backends = append(backends, config.CarbonSearchV2.Backends...)
+	for _, backend := range backends {
+		// servers of groups with discovery are resolved when zipper is created
+		if len(backend.Servers) == 0 && backend.Discovery == nil {
+			return fmt.Errorf("backend group '%v': no servers specified", backend.GroupName)
+		}
+
+		metadata.Metadata.RLock()
+		_, ok := metadata.Metadata.ProtocolInits[backend.Protocol]
+		metadata.Metadata.RUnlock()
+		if !ok {
+			return fmt.Errorf("backend group '%v': unknown backend protocol '%v'", backend.GroupName, backend.Protocol)
+		}
+
+		var lbMethod types.LBMethod
+		err = lbMethod.FromString(backend.LBMethod)
+		if err != nil {
+			return fmt.Errorf("backend group '%v': %v", backend.GroupName, err)
+		}
+
+		err = mergePolicy.FromString(backend.MergePolicy)
+		if err != nil {
+			return fmt.Errorf("backend group '%v': %v", backend.GroupName, err)
+		}
+
+		if backend.TLS != nil {
+			_, err = backend.TLS.TLSConfig()
+			if err != nil {
+				return fmt.Errorf("backend group '%v': %v", backend.GroupName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// selectBackends returns backend group that was selected for the request or all backends if none was selected
+func (z Zipper) selectBackends(ctx context.Context) (types.BackendServer, error) {
+	group := util.GetBackendGroup(ctx)
+	if group == "" {
+		return z.storeBackends, nil
+	}
+	backends, ok := z.groupBackends[group]
+	if !ok {
+		return nil, types.ErrUnknownBackendGroup
+	}
+	return backends, nil
+}
+
 // NewZipper allows to create new Zipper
 func NewZipper(sender func(*types.Stats), config *config.Config, logger *zap.Logger) (*Zipper, error) {
 	config.Timeouts = sanitizeTimouts(config.Timeouts, defaultTimeouts)
 
 	var searchBackends types.BackendServer
 	var prefix string
+	transports := &types.Transports{}
+	setters := make(map[string][]serversSetter)
 
 	if config.InternalRoutingCache.Seconds() < 30 {
 		logger.Warn("internalRoutingCache is too low",
@@ -200,7 +389,7 @@ func NewZipper(sender func(*types.Stats), config *config.Config, logger *zap.Log
 
 	if len(config.CarbonSearchV2.BackendsV2.Backends) > 0 {
 		prefix = config.CarbonSearchV2.Prefix
-		searchClients, err := createBackendsV2(logger, config.CarbonSearchV2.BackendsV2, int32(config.InternalRoutingCache.Seconds()))
+		searchClients, err := createBackendsV2(logger, config.CarbonSearchV2.BackendsV2, int32(config.InternalRoutingCache.Seconds()), transports, setters)
 		if err != nil && err.HaveFatalErrors {
 			logger.Fatal("errors while initialing zipper search backends",
 				zap.Any("errors", err.Errors),
@@ -220,16 +409,17 @@ func NewZipper(sender func(*types.Stats), config *config.Config, logger *zap.Log
 		config.BackendsV2 = types.BackendsV2{
 			Backends: []types.BackendV2{
 				{
-					GroupName:           "backends",
-					Protocol:            "carbonapi_v2_pb",
-					LBMethod:            "broadcast",
-					Servers:             config.Backends,
-					Timeouts:            &config.Timeouts,
-					ConcurrencyLimit:    &config.ConcurrencyLimitPerServer,
-					KeepAliveInterval:   &config.KeepAliveInterval,
-					MaxIdleConnsPerHost: &config.MaxIdleConnsPerHost,
-					MaxTries:            &config.MaxTries,
-					MaxBatchSize:        config.MaxBatchSize,
+					GroupName:             "backends",
+					Protocol:              "carbonapi_v2_pb",
+					LBMethod:              "broadcast",
+					Servers:               config.Backends,
+					Timeouts:              &config.Timeouts,
+					ConcurrencyLimit:      &config.ConcurrencyLimitPerServer,
+					KeepAliveInterval:     &config.KeepAliveInterval,
+					MaxIdleConnsPerHost:   &config.MaxIdleConnsPerHost,
+					MaxTries:              &config.MaxTries,
+					MaxBatchSize:          config.MaxBatchSize,
+					MaxPatternsPerRequest: config.MaxPatternsPerRequest,
 				},
 			},
 			MaxIdleConnsPerHost:       config.MaxIdleConnsPerHost,
@@ -238,6 +428,7 @@ func NewZipper(sender func(*types.Stats), config *config.Config, logger *zap.Log
 			KeepAliveInterval:         config.KeepAliveInterval,
 			MaxTries:                  config.MaxTries,
 			MaxBatchSize:              config.MaxBatchSize,
+			MaxPatternsPerRequest:     config.MaxPatternsPerRequest,
 		}
 	}
 
@@ -251,20 +442,55 @@ func NewZipper(sender func(*types.Stats), config *config.Config, logger *zap.Log
 		config.BackendsV2.Backends[i].Timeouts = &timeouts
 	}
 
-	storeClients, err := createBackendsV2(logger, config.BackendsV2, int32(config.InternalRoutingCache.Seconds()))
+	helper.SetRetryBudget(config.BackendsV2.RetryBudget)
+	if config.BackendsV2.Zone == "auto" {
+		zone, err := DetectZone()
+		if err != nil {
+			logger.Warn("failed to detect zone, servers in all zones are equal",
+				zap.Error(err),
+			)
+		}
+		config.BackendsV2.Zone = zone
+	}
+	storeClients, err := createBackendsV2(logger, config.BackendsV2, int32(config.InternalRoutingCache.Seconds()), transports, setters)
 	if err != nil && err.HaveFatalErrors {
 		logger.Fatal("errors while initialing zipper store backends",
 			zap.Any("errors", err.Errors),
 		)
 	}
 
-	var storeBackends types.BackendServer
-	storeBackends, err = broadcast.NewBroadcastGroup(logger, "root", storeClients, int32(config.InternalRoutingCache.Seconds()), config.ConcurrencyLimitPerServer, config.MaxBatchSize, config.Timeouts)
+	// shadow groups are reachable only by backend group selection
+	shadowGroups := make(map[string]bool)
+	for _, backend := range config.BackendsV2.Backends {
+		if backend.Shadow {
+			shadowGroups[backend.GroupName] = true
+		}
+	}
+	rootClients := make([]types.BackendServer, 0, len(storeClients))
+	for _, c := range storeClients {
+		if !shadowGroups[c.Name()] {
+			rootClients = append(rootClients, c)
+		}
+	}
+
+	rootBackends, err := broadcast.NewBroadcastGroup(logger, "root", rootClients, int32(config.InternalRoutingCache.Seconds()), config.ConcurrencyLimitPerServer, config.MaxBatchSize, config.Timeouts)
 	if err != nil && err.HaveFatalErrors {
 		logger.Fatal("errors while initialing zipper store backends",
 			zap.Any("errors", err.Errors),
 		)
 	}
+	// Root group merges responses from different backend groups, e.x. from different DCs in federated setup
+	rootBackends.SetMergePolicy(parseMergePolicy(logger, config.MergePolicy))
+	rootBackends.SetMaxPatternsPerRequest(config.MaxPatternsPerRequest)
+	if config.BackendsV2.PrefixIndex {
+		rootBackends.SetPrefixIndex()
+	}
+	var storeBackends types.BackendServer = rootBackends
+
+	groupBackends := make(map[string]types.BackendServer, len(storeClients))
+	for _, c := range storeClients {
+		groupBackends[c.Name()] = c
+	}
 
 	z := &Zipper{
 		probeTicker: time.NewTicker(config.InternalRoutingCache),
@@ -274,6 +500,7 @@ func NewZipper(sender func(*types.Stats), config *config.Config, logger *zap.Log
 		sendStats: sender,
 
 		storeBackends:             storeBackends,
+		groupBackends:             groupBackends,
 		searchBackends:            searchBackends,
 		searchPrefix:              prefix,
 		searchConfigured:          len(prefix) > 0 && len(searchBackends.Backends()) > 0,
@@ -281,6 +508,8 @@ func NewZipper(sender func(*types.Stats), config *config.Config, logger *zap.Log
 		keepAliveInterval:         config.KeepAliveInterval,
 		timeout:                   config.Timeouts.Render,
 		timeoutConnect:            config.Timeouts.Connect,
+		transports:                transports,
+		serversSetters:            setters,
 		logger:                    logger,
 	}
 
@@ -294,6 +523,37 @@ func NewZipper(sender func(*types.Stats), config *config.Config, logger *zap.Log
 	return z, nil
 }
 
+// Close stops probes and closes idle connections to backends. Requests that are still running are finished, their
+// connections are closed when render timeout expires
+func (z *Zipper) Close() {
+	close(z.ProbeQuit)
+	z.transports.CloseIdleConnections()
+	time.AfterFunc(z.timeout, z.transports.CloseIdleConnections)
+}
+
+// SetServers replaces servers of backend groups, that were changed since zipper was created (e.x. by discovery). Groups
+// keep their state (probed prefixes, load of servers, connections). Error is returned if any of the groups doesn't
+// support it, such zipper should be recreated
+func (z *Zipper) SetServers(groups []*types.BackendV2) error {
+	for _, g := range groups {
+		setters, ok := z.serversSetters[g.GroupName]
+		if !ok {
+			return fmt.Errorf("backend group '%v': protocol '%v' doesn't support changing servers", g.GroupName, g.Protocol)
+		}
+		for _, set := range setters {
+			if err := set(g.Servers, g.ServerZones); err != nil {
+				return fmt.Errorf("backend group '%v': %v", g.GroupName, err)
+			}
+		}
+	}
+	// new servers are probed right away, so prefix index knows them
+	select {
+	case z.ProbeForce <- 1:
+	default:
+	}
+	return nil
+}
+
 func (z *Zipper) doProbe(logger *zap.Logger) {
 	ctx := context.Background()
 
@@ -377,7 +637,12 @@ func (z Zipper) FetchProtoV3(ctx context.Context, request *protov3.MultiFetchReq
 		}
 	}
 
-	res, stats, err := z.storeBackends.Fetch(ctx, request)
+	backends, gErr := z.selectBackends(ctx)
+	if gErr != nil {
+		return nil, nil, gErr
+	}
+
+	res, stats, err := backends.Fetch(ctx, request)
 	if statsSearch != nil {
 		if stats == nil {
 			stats = statsSearch
@@ -414,7 +679,12 @@ func (z Zipper) FindProtoV3(ctx context.Context, request *protov3.MultiGlobReque
 		}
 	}
 
-	res, stats, err := z.storeBackends.Find(ctx, request)
+	backends, gErr := z.selectBackends(ctx)
+	if gErr != nil {
+		return nil, nil, gErr
+	}
+
+	res, stats, err := backends.Find(ctx, request)
 	if err == nil {
 		err = &errors.Errors{}
 	}
@@ -464,7 +734,12 @@ func (z Zipper) InfoProtoV3(ctx context.Context, request *protov3.MultiGlobReque
 		realRequest.Names = append(realRequest.Names, request.Metrics...)
 	}
 
-	r, stats, e := z.storeBackends.Info(ctx, realRequest)
+	backends, err := z.selectBackends(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, stats, e := backends.Info(ctx, realRequest)
 	if e.HaveFatalErrors {
 		z.logger.Error("had fatal errors during request",
 			zap.Any("errors", e.Errors),
@@ -653,7 +928,12 @@ func (z Zipper) StatsProtoV2(ctx context.Context) (*protov2.MetricDetailsRespons
 // Tags
 
 func (z Zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, error) {
-	data, e := z.storeBackends.TagNames(ctx, query, limit)
+	backends, err := z.selectBackends(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, e := backends.TagNames(ctx, query, limit)
 	if e.HaveFatalErrors {
 		z.logger.Error("had fatal errors during request",
 			zap.Any("errors", e.Errors),
@@ -672,7 +952,12 @@ func (z Zipper) TagNames(ctx context.Context, query string, limit int64) ([]stri
 }
 
 func (z Zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, error) {
-	data, e := z.storeBackends.TagValues(ctx, query, limit)
+	backends, err := z.selectBackends(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, e := backends.TagValues(ctx, query, limit)
 	if e.HaveFatalErrors {
 		z.logger.Error("had fatal errors during request",
 			zap.Any("errors", e.Errors),
@@ -1,13 +1,20 @@
 package zipper
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"reflect"
 	"testing"
+	"time"
 
+	util "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/dummy"
 	"github.com/go-graphite/carbonapi/zipper/errors"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
 )
 
 type mergeValuesData struct {
@@ -211,3 +218,117 @@ func TestMergeValues(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateConfig(t *testing.T) {
+	backend := types.BackendV2{
+		GroupName: "group",
+		Protocol:  "carbonapi_v3_pb",
+		LBMethod:  "broadcast",
+		Servers:   []string{"http://127.0.0.1:8080"},
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(c *config.Config, b *types.BackendV2)
+		valid  bool
+	}{
+		{"valid", func(c *config.Config, b *types.BackendV2) {}, true},
+		{"unknown protocol", func(c *config.Config, b *types.BackendV2) { b.Protocol = "unknown" }, false},
+		{"unknown lbMethod", func(c *config.Config, b *types.BackendV2) { b.LBMethod = "unknown" }, false},
+		{"unknown group mergePolicy", func(c *config.Config, b *types.BackendV2) { b.MergePolicy = "unknown" }, false},
+		{"unknown root mergePolicy", func(c *config.Config, b *types.BackendV2) { c.MergePolicy = "unknown" }, false},
+		{"no servers", func(c *config.Config, b *types.BackendV2) { b.Servers = nil }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := backend
+			c := &config.Config{}
+			tt.mutate(c, &b)
+			c.BackendsV2.Backends = []types.BackendV2{b}
+			err := ValidateConfig(c)
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected error, got none")
+			}
+		})
+	}
+
+	if err := ValidateConfig(&config.Config{}); err == nil {
+		t.Errorf("expected error for empty config")
+	}
+}
+
+func TestSelectBackends(t *testing.T) {
+	prod := dummy.NewDummyClient("prod", []string{"http://prod:8080"}, 0)
+	staging := dummy.NewDummyClient("staging", []string{"http://staging:8080"}, 0)
+	root := dummy.NewDummyClient("root", []string{"http://prod:8080", "http://staging:8080"}, 0)
+	z := Zipper{
+		storeBackends: root,
+		groupBackends: map[string]types.BackendServer{"prod": prod, "staging": staging},
+	}
+
+	tests := []struct {
+		group    string
+		expected types.BackendServer
+		err      error
+	}{
+		{"", root, nil},
+		{"staging", staging, nil},
+		{"dev", nil, types.ErrUnknownBackendGroup},
+	}
+
+	for _, tt := range tests {
+		backends, err := z.selectBackends(util.SetBackendGroup(context.Background(), tt.group))
+		if err != tt.err {
+			t.Errorf("group '%v': unexpected error: got %v, expected %v", tt.group, err, tt.err)
+		}
+		if backends != tt.expected {
+			t.Errorf("group '%v': unexpected backends: got %v, expected %v", tt.group, backends, tt.expected)
+		}
+	}
+}
+
+func TestSetServers(t *testing.T) {
+	cfg := &config.Config{
+		InternalRoutingCache: time.Minute,
+		BackendsV2: types.BackendsV2{
+			Backends: []types.BackendV2{
+				{GroupName: "shards", Protocol: "carbonapi_v3_pb", LBMethod: "broadcast", Servers: []string{"http://127.0.0.1:1", "http://127.0.0.2:1"}},
+				{GroupName: "replicas", Protocol: "carbonapi_v3_pb", LBMethod: "roundrobin", Servers: []string{"http://127.0.0.3:1"}},
+				{GroupName: "legacy", Protocol: "carbonapi_v2_pb", LBMethod: "roundrobin", Servers: []string{"http://127.0.0.4:1"}},
+			},
+		},
+	}
+	z, err := NewZipper(func(*types.Stats) {}, cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+
+	shards := z.groupBackends["shards"]
+	kept := shards.Children()[1]
+	err = z.SetServers([]*types.BackendV2{
+		{GroupName: "shards", Servers: []string{"http://127.0.0.2:1", "http://127.0.0.5:1"}},
+		{GroupName: "replicas", Servers: []string{"http://127.0.0.3:1", "http://127.0.0.6:1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.groupBackends["shards"] != shards {
+		t.Errorf("group is recreated")
+	}
+	children := shards.Children()
+	if len(children) != 2 || children[0] != kept || children[1].Name() != "http://127.0.0.5:1" {
+		t.Errorf("unexpected backends of broadcast group: %v", shards.Backends())
+	}
+	if servers := z.groupBackends["replicas"].Backends(); !reflect.DeepEqual(servers, []string{"http://127.0.0.3:1", "http://127.0.0.6:1"}) {
+		t.Errorf("unexpected servers of round-robin group: %v", servers)
+	}
+
+	if err := z.SetServers([]*types.BackendV2{{GroupName: "legacy", Protocol: "carbonapi_v2_pb"}}); err == nil {
+		t.Errorf("expected error for group that can't change servers")
+	}
+}
@@ -0,0 +1,93 @@
+package zipper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const zoneDetectTimeout = 2 * time.Second
+
+var detectedZone struct {
+	sync.Once
+	zone string
+	err  error
+}
+
+// DetectZone returns zone of carbonapi from labels of kubernetes node (NODE_NAME environment variable should be set
+// from spec.nodeName), AWS or GCE instance metadata. Zone is detected only once
+func DetectZone() (string, error) {
+	detectedZone.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), zoneDetectTimeout)
+		defer cancel()
+		detectedZone.zone, detectedZone.err = detectZone(ctx)
+	})
+	return detectedZone.zone, detectedZone.err
+}
+
+func detectZone(ctx context.Context) (string, error) {
+	if node := os.Getenv("NODE_NAME"); node != "" {
+		var n struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		}
+		if err := kubernetesGet(ctx, "", "/api/v1/nodes/"+url.PathEscape(node), &n); err != nil {
+			return "", fmt.Errorf("failed to get kubernetes node: %v", err)
+		}
+		for _, label := range []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"} {
+			if zone := n.Metadata.Labels[label]; zone != "" {
+				return zone, nil
+			}
+		}
+		return "", fmt.Errorf("kubernetes node '%v' has no zone label", node)
+	}
+
+	if zone, err := awsZone(ctx); err == nil {
+		return zone, nil
+	}
+	// GCE returns projects/<project>/zones/<zone>
+	zone, err := metadataGet(ctx, http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/zone", map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return "", fmt.Errorf("zone isn't found in node metadata")
+	}
+	return zone[strings.LastIndex(zone, "/")+1:], nil
+}
+
+// awsZone gets availability zone from instance metadata with IMDSv2 token
+func awsZone(ctx context.Context) (string, error) {
+	token, err := metadataGet(ctx, http.MethodPut, "http://169.254.169.254/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil {
+		return "", err
+	}
+	return metadataGet(ctx, http.MethodGet, "http://169.254.169.254/latest/meta-data/placement/availability-zone", map[string]string{"X-aws-ec2-metadata-token": token})
+}
+
+func metadataGet(ctx context.Context, method, u string, headers map[string]string) (string, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}